@@ -0,0 +1,78 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"strings"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+type allOf []Interface
+
+// AllOf allows the entries allowed by every controller, the controllers are
+// consulted in order until one rejects the entry
+func AllOf(controllers ...Interface) Interface {
+	return allOf(controllers)
+}
+
+func (a allOf) CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	for _, ac := range a {
+		if err := ac.CanAppend(ctx, e, provider, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type anyOf []Interface
+
+// AnyOf allows the entries allowed by at least one controller, the errors
+// of every controller are returned when none allows the entry
+func AnyOf(controllers ...Interface) Interface {
+	return anyOf(controllers)
+}
+
+func (a anyOf) CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	if len(a) == 0 {
+		return errors.Wrap(errmsg.AccessDenied, "no access controller")
+	}
+
+	messages := []string{}
+	for _, ac := range a {
+		err := ac.CanAppend(ctx, e, provider, state)
+		if err == nil {
+			return nil
+		}
+
+		messages = append(messages, err.Error())
+	}
+
+	return errors.Wrap(errmsg.AccessDenied, strings.Join(messages, "; "))
+}
+
+type not struct {
+	ac Interface
+}
+
+// Not allows the entries denied by the controller, other errors such as
+// invalid signatures are returned as is
+func Not(ac Interface) Interface {
+	return &not{ac: ac}
+}
+
+func (n *not) CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	err := n.ac.CanAppend(ctx, e, provider, state)
+	if err == nil {
+		return errors.Wrap(errmsg.AccessDenied, "entry is allowed by a negated access controller")
+	}
+
+	if !errors.Is(err, errmsg.AccessDenied) {
+		return err
+	}
+
+	return nil
+}
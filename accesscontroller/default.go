@@ -1,14 +1,16 @@
 package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
 
 import (
-	"berty.tech/go-ipfs-log/entry"
+	"context"
+
 	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 )
 
 type Default struct {
 }
 
-func (d *Default) CanAppend(*entry.Entry, *identityprovider.Identity) error {
+func (d *Default) CanAppend(context.Context, iface.IPFSLogEntry, identityprovider.Interface, LogState) error {
 	return nil
 }
 
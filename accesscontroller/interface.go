@@ -1,10 +1,55 @@
 package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
 
 import (
-	"berty.tech/go-ipfs-log/entry"
+	"context"
+
 	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
 )
 
 type Interface interface {
-	CanAppend(*entry.Entry, *identityprovider.Identity) error
+	CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error
+}
+
+// LogState exposes the log an entry is appended to or joined with, so
+// controllers can take the entries written before into account. When
+// joining, the entries of the joined log are found too so the history of
+// the joined entries can be walked.
+type LogState interface {
+	// GetHeads returns the heads of the log
+	GetHeads() []iface.IPFSLogEntry
+
+	// GetEntry returns the entry of the log with the given hash
+	GetEntry(hash cid.Cid) (iface.IPFSLogEntry, bool)
+}
+
+// reaches checks whether the target entry is one of the given entries or one
+// of their ancestors found in the log state. Ancestors have lower Lamport
+// times, the entries older than minTime aren't walked.
+func reaches(state LogState, from []cid.Cid, target cid.Cid, minTime int) bool {
+	stack := append([]cid.Cid{}, from...)
+	seen := cid.NewSet()
+
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if hash.Equals(target) {
+			return true
+		}
+
+		if !seen.Visit(hash) {
+			continue
+		}
+
+		e, ok := state.GetEntry(hash)
+		if !ok || e.GetClock() == nil || e.GetClock().Time < minTime {
+			continue
+		}
+
+		stack = append(stack, e.GetNext()...)
+	}
+
+	return false
 }
@@ -0,0 +1,160 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// IPFSType is the type of the access controllers stored on IPFS, as named
+// by orbit-db-access-controllers
+const IPFSType = "ipfs"
+
+// Addressable is implemented by the access controllers stored on IPFS, the
+// address is recorded in the manifest of the log
+type Addressable interface {
+	Address() cid.Cid
+}
+
+// IPFS is an access controller allowing the identities of an immutable
+// allow-list to write, "*" allows every identity. The list is stored as an
+// IPFS object compatible with orbit-db-access-controllers.
+type IPFS struct {
+	mu      sync.RWMutex
+	write   map[string]bool
+	keys    []string
+	address cid.Cid
+}
+
+// cborIPFSManifest is the stored allow-list, orbit-db stores it as a JSON
+// encoded string
+type cborIPFSManifest struct {
+	Write string
+}
+
+// NewIPFS creates an access controller allowing the given identity IDs to
+// write, it has to be saved before its address can be recorded
+func NewIPFS(write []string) *IPFS {
+	a := &IPFS{
+		write: map[string]bool{},
+		keys:  append([]string{}, write...),
+	}
+
+	for _, k := range write {
+		a.write[k] = true
+	}
+
+	return a
+}
+
+// Save stores the allow-list and returns its address
+func (a *IPFS) Save(services io.IpfsServices) (cid.Cid, error) {
+	if services == nil {
+		return cid.Cid{}, errmsg.IPFSNotDefined
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	write, err := json.MarshalIndent(a.keys, "", "  ")
+	if err != nil {
+		return cid.Cid{}, errors.Wrap(err, "unable to encode access controller")
+	}
+
+	c, err := io.WriteCBOR(services, &cborIPFSManifest{Write: string(write)})
+	if err != nil {
+		return cid.Cid{}, errors.Wrap(err, "unable to save access controller")
+	}
+
+	a.address = c
+
+	return c, nil
+}
+
+// LoadIPFS loads the access controller stored at the address, the
+// allow-list is kept in memory
+func LoadIPFS(services io.IpfsServices, address cid.Cid) (*IPFS, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	nd, err := io.ReadCBOR(services, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load access controller")
+	}
+
+	manifest := &cborIPFSManifest{}
+	if err := cbornode.DecodeInto(nd.RawData(), manifest); err != nil {
+		return nil, errors.Wrap(err, "unable to decode access controller")
+	}
+
+	write := []string{}
+	if err := json.Unmarshal([]byte(manifest.Write), &write); err != nil {
+		return nil, errors.Wrap(err, "unable to decode access controller")
+	}
+
+	a := NewIPFS(write)
+	a.address = address
+
+	return a, nil
+}
+
+// Address returns the address of the allow-list, undefined until saved
+func (a *IPFS) Address() cid.Cid {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.address
+}
+
+// Write returns the identity IDs allowed to write
+func (a *IPFS) Write() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return append([]string{}, a.keys...)
+}
+
+func (a *IPFS) CanAppend(_ context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, _ LogState) error {
+	identity := e.GetIdentity()
+	if identity == nil {
+		return errors.Wrap(errmsg.AccessDenied, "entry doesn't have an identity")
+	}
+
+	a.mu.RLock()
+	allowed := a.write[identity.ID] || a.write["*"]
+	a.mu.RUnlock()
+
+	if !allowed {
+		return errors.Wrapf(errmsg.AccessDenied, "identity %s", identity.ID)
+	}
+
+	return entry.VerifyIdentity(e, provider)
+}
+
+var _ Interface = &IPFS{}
+var _ Addressable = &IPFS{}
+
+var AtlasIPFSManifest = atlas.BuildEntry(cborIPFSManifest{}).
+	StructMap().
+	AddField("Write", atlas.StructMapEntry{SerialName: "write"}).
+	Complete()
+
+// MarshalCBOR encodes the manifest as dag-cbor
+func (m *cborIPFSManifest) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(m)
+}
+
+func init() {
+	cbornode.RegisterCborType(AtlasIPFSManifest)
+}
@@ -0,0 +1,230 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// Permission operations written in a permissions log
+const (
+	OpGrant  = "grant"
+	OpRevoke = "revoke"
+)
+
+// PermissionOp is the payload of the entries of a permissions log, Heads
+// are the heads of the controlled log when the operation was written
+type PermissionOp struct {
+	Op    string   `json:"op"`
+	ID    string   `json:"id"`
+	Heads []string `json:"heads,omitempty"`
+}
+
+// GrantPayload returns the payload of a permissions log entry allowing the
+// identity to write the entries descending from the heads of the
+// controlled log, any entry when there are no heads
+func GrantPayload(id string, heads ...cid.Cid) []byte {
+	return permissionPayload(OpGrant, id, heads)
+}
+
+// RevokePayload returns the payload of a permissions log entry no longer
+// allowing the identity to write, except the entries reachable from the
+// heads of the controlled log
+func RevokePayload(id string, heads ...cid.Cid) []byte {
+	return permissionPayload(OpRevoke, id, heads)
+}
+
+func permissionPayload(op, id string, heads []cid.Cid) []byte {
+	payload := &PermissionOp{Op: op, ID: id}
+	for _, h := range heads {
+		payload.Heads = append(payload.Heads, io.CIDString(h))
+	}
+
+	data, _ := json.Marshal(payload)
+
+	return data
+}
+
+type permissionOp struct {
+	PermissionOp
+	clock *lamportclock.LamportClock
+	heads []cid.Cid
+}
+
+// appliesTo checks whether the operation applies to the entry: a grant
+// applies to the entries descending from its heads and a revocation to the
+// entries it can't reach from its heads, entries written later or
+// concurrently
+func (op *permissionOp) appliesTo(e iface.IPFSLogEntry, state LogState) bool {
+	if op.Op == OpRevoke {
+		return !reaches(state, op.heads, e.GetHash(), e.GetClock().Time)
+	}
+
+	if len(op.heads) == 0 {
+		return true
+	}
+
+	for _, h := range op.heads {
+		head, ok := state.GetEntry(h)
+		if ok && reaches(state, e.GetNext(), h, head.GetClock().Time) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Permissions is an access controller whose write permissions are granted
+// and revoked by the entries of a dedicated permissions log, written by its
+// admins. An operation carries the heads of the controlled log its admin
+// saw, so it applies to the entries according to their position in the
+// history of the log rather than to their Lamport time, which their signer
+// chooses.
+type Permissions struct {
+	mu     sync.RWMutex
+	admins map[string]bool
+	seen   map[string]bool
+	ops    map[string][]*permissionOp
+}
+
+// NewPermissions creates an access controller administered by the given
+// identity IDs, admins are always allowed to write
+func NewPermissions(admins []string) *Permissions {
+	p := &Permissions{
+		admins: map[string]bool{},
+		seen:   map[string]bool{},
+		ops:    map[string][]*permissionOp{},
+	}
+
+	for _, id := range admins {
+		p.admins[id] = true
+	}
+
+	return p
+}
+
+// Update applies the entries of the permissions log, entries already applied
+// are skipped so the values of the log can be passed after each join. The
+// identities are verified by the identity provider registered for their type.
+func (p *Permissions) Update(entries []iface.IPFSLogEntry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range entries {
+		hash := e.GetHash().KeyString()
+		if p.seen[hash] {
+			continue
+		}
+
+		if err := p.canAdminister(e, nil); err != nil {
+			return err
+		}
+
+		op := &permissionOp{clock: e.GetClock()}
+		if err := json.Unmarshal(e.GetPayload(), &op.PermissionOp); err != nil {
+			return errors.Wrap(err, "unable to decode permission")
+		}
+
+		if op.Op != OpGrant && op.Op != OpRevoke {
+			return errors.Errorf("unknown permission operation: %s", op.Op)
+		}
+
+		for _, h := range op.Heads {
+			c, err := cid.Decode(h)
+			if err != nil {
+				return errors.Wrap(err, "unable to decode permission heads")
+			}
+
+			op.heads = append(op.heads, c)
+		}
+
+		ops := append(p.ops[op.ID], op)
+		sort.SliceStable(ops, func(a, b int) bool {
+			return lamportclock.Compare(ops[a].clock, ops[b].clock) < 0
+		})
+
+		p.ops[op.ID] = ops
+		p.seen[hash] = true
+	}
+
+	return nil
+}
+
+// canAdminister checks that the entry is written by an admin, the identity
+// is verified with the provider
+func (p *Permissions) canAdminister(e iface.IPFSLogEntry, provider identityprovider.Interface) error {
+	identity := e.GetIdentity()
+	if identity == nil || !p.admins[identity.ID] {
+		return errors.Wrap(errmsg.AccessDenied, "permissions can only be changed by admins")
+	}
+
+	return entry.VerifyIdentity(e, provider)
+}
+
+// IsAllowed returns whether the identity of the entry can write it, the
+// operations are evaluated against the history of the entry in the log
+// state. The last operation applying to the entry decides.
+func (p *Permissions) IsAllowed(e iface.IPFSLogEntry, state LogState) bool {
+	identity := e.GetIdentity()
+	if identity == nil || e.GetClock() == nil {
+		return false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.admins[identity.ID] {
+		return true
+	}
+
+	allowed := false
+	for _, op := range p.ops[identity.ID] {
+		if op.appliesTo(e, state) {
+			allowed = op.Op == OpGrant
+		}
+	}
+
+	return allowed
+}
+
+func (p *Permissions) CanAppend(_ context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	identity := e.GetIdentity()
+	if identity == nil || e.GetClock() == nil {
+		return errors.Wrap(errmsg.AccessDenied, "entry doesn't have an identity")
+	}
+
+	if !p.IsAllowed(e, state) {
+		return errors.Wrapf(errmsg.AccessDenied, "identity %s", identity.ID)
+	}
+
+	return entry.VerifyIdentity(e, provider)
+}
+
+// Admins returns the access controller of the permissions log, only
+// allowing admins to write
+func (p *Permissions) Admins() Interface {
+	return &permissionsAdmins{p}
+}
+
+type permissionsAdmins struct {
+	p *Permissions
+}
+
+func (a *permissionsAdmins) CanAppend(_ context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, _ LogState) error {
+	a.p.mu.RLock()
+	defer a.p.mu.RUnlock()
+
+	return a.p.canAdminister(e, provider)
+}
+
+var _ Interface = &Permissions{}
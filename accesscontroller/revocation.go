@@ -0,0 +1,131 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"sync"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// RevocationChecker reports the entries signed by keys which are no longer
+// trusted
+type RevocationChecker interface {
+	CheckRevocation(e iface.IPFSLogEntry) error
+}
+
+// Revocations is a RevocationChecker rejecting the entries signed by revoked
+// keys, except the entries the log held when the key was revoked. The
+// revocation is anchored in the history of the log rather than in the
+// Lamport time of the entries, which their signer chooses.
+type Revocations struct {
+	mu      sync.RWMutex
+	revoked map[string]*cid.Set
+}
+
+func NewRevocations() *Revocations {
+	return &Revocations{revoked: map[string]*cid.Set{}}
+}
+
+// Revoke rejects the entries signed by key, except the ones reachable from
+// the heads of the log state: entries written later, or backdated, by the
+// holder of the key are rejected. When a key is revoked several times only
+// the entries kept by every revocation are accepted. Every entry of the key
+// is rejected when the state is nil.
+func (r *Revocations) Revoke(key []byte, state LogState) {
+	kept := cid.NewSet()
+	if state != nil {
+		stack := []cid.Cid{}
+		for _, h := range state.GetHeads() {
+			stack = append(stack, h.GetHash())
+		}
+
+		seen := cid.NewSet()
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if !seen.Visit(hash) {
+				continue
+			}
+
+			e, ok := state.GetEntry(hash)
+			if !ok {
+				continue
+			}
+
+			if bytes.Equal(e.GetKey(), key) {
+				kept.Add(hash)
+			}
+
+			stack = append(stack, e.GetNext()...)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := hex.EncodeToString(key)
+	if current, ok := r.revoked[k]; ok {
+		_ = kept.ForEach(func(c cid.Cid) error {
+			if !current.Has(c) {
+				kept.Remove(c)
+			}
+
+			return nil
+		})
+	}
+
+	r.revoked[k] = kept
+}
+
+// IsRevoked returns whether the entry is signed by a revoked key and wasn't
+// kept by its revocation
+func (r *Revocations) IsRevoked(e iface.IPFSLogEntry) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	kept, ok := r.revoked[hex.EncodeToString(e.GetKey())]
+
+	return ok && !kept.Has(e.GetHash())
+}
+
+func (r *Revocations) CheckRevocation(e iface.IPFSLogEntry) error {
+	if r.IsRevoked(e) {
+		return errors.Wrapf(errmsg.KeyRevoked, "key %x is revoked", e.GetKey())
+	}
+
+	return nil
+}
+
+var _ RevocationChecker = &Revocations{}
+
+// revocable is an access controller also rejecting entries signed by
+// revoked keys
+type revocable struct {
+	Interface
+	checker RevocationChecker
+}
+
+// Revocable wraps an access controller so entries signed by revoked keys
+// are rejected before it is consulted
+func Revocable(ac Interface, checker RevocationChecker) Interface {
+	if checker == nil {
+		return ac
+	}
+
+	return &revocable{Interface: ac, checker: checker}
+}
+
+func (r *revocable) CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	if err := r.checker.CheckRevocation(e); err != nil {
+		return err
+	}
+
+	return r.Interface.CanAppend(ctx, e, provider, state)
+}
@@ -0,0 +1,158 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// Role is the role of a member of a Roles access controller
+type Role string
+
+const (
+	// RoleAdmin members can write, at least one member keeps this role
+	RoleAdmin Role = "admin"
+
+	// RoleWriter members can write
+	RoleWriter Role = "writer"
+
+	// RoleReader members can't write
+	RoleReader Role = "reader"
+)
+
+// Roles is an access controller allowing its admins and writers to write.
+// The membership is local to the process: it isn't persisted nor
+// replicated, only the identities having the admin role can change it. Use
+// Permissions for a membership written by admins in a replicated log.
+type Roles struct {
+	mu      sync.RWMutex
+	members map[string]Role
+}
+
+// NewRoles creates an access controller administered by the given identity
+// IDs
+func NewRoles(admins []string) *Roles {
+	r := &Roles{members: map[string]Role{}}
+	for _, id := range admins {
+		r.members[id] = RoleAdmin
+	}
+
+	return r
+}
+
+// Grant gives a role to the identity ID, replacing its current role. The
+// granting identity must be an admin.
+func (r *Roles) Grant(by *identityprovider.Identity, id string, role Role) error {
+	switch role {
+	case RoleAdmin, RoleWriter, RoleReader:
+	default:
+		return errors.Errorf("unknown role: %s", role)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkAdmin(by); err != nil {
+		return err
+	}
+
+	if r.members[id] == RoleAdmin && role != RoleAdmin && r.countAdmins() == 1 {
+		return errors.New("the last admin can't be demoted")
+	}
+
+	r.members[id] = role
+
+	return nil
+}
+
+// Revoke removes the identity ID from the members. The revoking identity
+// must be an admin.
+func (r *Roles) Revoke(by *identityprovider.Identity, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkAdmin(by); err != nil {
+		return err
+	}
+
+	if r.members[id] == RoleAdmin && r.countAdmins() == 1 {
+		return errors.New("the last admin can't be revoked")
+	}
+
+	delete(r.members, id)
+
+	return nil
+}
+
+// Role returns the role of the identity ID, false when it isn't a member
+func (r *Roles) Role(id string) (Role, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	role, ok := r.members[id]
+
+	return role, ok
+}
+
+// Members returns the sorted identity IDs having the role
+func (r *Roles) Members(role Role) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := []string{}
+	for id, memberRole := range r.members {
+		if memberRole == role {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (r *Roles) CanAppend(_ context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, _ LogState) error {
+	identity := e.GetIdentity()
+	if identity == nil {
+		return errors.Wrap(errmsg.AccessDenied, "entry doesn't have an identity")
+	}
+
+	role, _ := r.Role(identity.ID)
+	if role != RoleAdmin && role != RoleWriter {
+		return errors.Wrapf(errmsg.AccessDenied, "identity %s", identity.ID)
+	}
+
+	return entry.VerifyIdentity(e, provider)
+}
+
+// checkAdmin returns errmsg.AccessDenied unless the identity is an admin
+func (r *Roles) checkAdmin(identity *identityprovider.Identity) error {
+	if identity == nil {
+		return errors.Wrap(errmsg.AccessDenied, "no identity")
+	}
+
+	if r.members[identity.ID] != RoleAdmin {
+		return errors.Wrapf(errmsg.AccessDenied, "identity %s isn't an admin", identity.ID)
+	}
+
+	return nil
+}
+
+func (r *Roles) countAdmins() int {
+	count := 0
+	for _, role := range r.members {
+		if role == RoleAdmin {
+			count++
+		}
+	}
+
+	return count
+}
+
+var _ Interface = &Roles{}
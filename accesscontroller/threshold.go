@@ -0,0 +1,57 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"encoding/hex"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// Threshold is an access controller requiring entries to be signed by at
+// least M keys of a signer set, counting the key of the entry and its
+// co-signatures
+type Threshold struct {
+	m       int
+	signers map[string]bool
+}
+
+// NewThreshold creates an access controller requiring m signatures from the
+// given public keys, as stored in identities
+func NewThreshold(m int, signers [][]byte) (*Threshold, error) {
+	if m < 1 || m > len(signers) {
+		return nil, errors.Errorf("threshold must be between 1 and %d", len(signers))
+	}
+
+	t := &Threshold{m: m, signers: map[string]bool{}}
+	for _, k := range signers {
+		t.signers[hex.EncodeToString(k)] = true
+	}
+
+	return t, nil
+}
+
+func (t *Threshold) CanAppend(_ context.Context, e iface.IPFSLogEntry, _ identityprovider.Interface, _ LogState) error {
+	keys, err := entry.SignedKeys(e)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, k := range keys {
+		if t.signers[hex.EncodeToString(k)] {
+			count++
+		}
+	}
+
+	if count < t.m {
+		return errors.Wrapf(errmsg.AccessDenied, "entry has %d of the %d required signatures", count, t.m)
+	}
+
+	return nil
+}
+
+var _ Interface = &Threshold{}
@@ -0,0 +1,418 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	"github.com/btcsuite/btcd/btcec"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	"github.com/multiformats/go-multibase"
+	"github.com/pkg/errors"
+)
+
+const (
+	// UCANMetadataKey is the entry metadata key holding the UCAN allowing
+	// the entry to be written
+	UCANMetadataKey = "ucan"
+
+	// UCANAppendAbility is the ability required to append to a log
+	UCANAppendAbility = "log/append"
+
+	ucanVersion = "0.8.1"
+
+	// maxUCANDepth bounds the length of proof chains
+	maxUCANDepth = 16
+
+	// DefaultUCANClockSkew is the default bound of how far in the future
+	// entry timestamps can be
+	DefaultUCANClockSkew = 5 * time.Minute
+)
+
+// did:key multicodec prefixes
+var (
+	didKeyEd25519   = []byte{0xed, 0x01}
+	didKeySecp256k1 = []byte{0xe7, 0x01}
+)
+
+// UCANCapability is an ability over a resource, "*" matches any resource or
+// ability
+type UCANCapability struct {
+	With string `json:"with"`
+	Can  string `json:"can"`
+}
+
+// covers returns whether the capability includes the required one
+func (c UCANCapability) covers(required UCANCapability) bool {
+	return (c.With == "*" || c.With == required.With) && (c.Can == "*" || c.Can == required.Can)
+}
+
+// UCAN is a capability token issued by a did:key to an audience, proofs are
+// the encoded tokens the issuer received its capabilities from
+type UCAN struct {
+	Issuer       string           `json:"iss"`
+	Audience     string           `json:"aud"`
+	Capabilities []UCANCapability `json:"att"`
+	NotBefore    int64            `json:"nbf,omitempty"`
+	Expiration   int64            `json:"exp,omitempty"`
+	Proofs       []string         `json:"prf"`
+}
+
+type ucanHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	UCV string `json:"ucv"`
+}
+
+// Sign encodes the token signed by the key of its issuer, the issuer is set
+// from the key when empty
+func (t *UCAN) Sign(key crypto.PrivKey) (string, error) {
+	did, err := DIDFromPublicKey(key.GetPublic())
+	if err != nil {
+		return "", err
+	}
+
+	if t.Issuer == "" {
+		t.Issuer = did
+	} else if t.Issuer != did {
+		return "", errors.New("key doesn't match the issuer of the token")
+	}
+
+	if t.Proofs == nil {
+		t.Proofs = []string{}
+	}
+
+	alg, err := ucanAlgorithm(int(key.Type()))
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(&ucanHeader{Alg: alg, Typ: "JWT", UCV: ucanVersion})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	sig, err := key.Sign([]byte(input))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to sign token")
+	}
+
+	// JWT expects secp256k1 signatures as R || S
+	if key.Type() == crypto.Secp256k1 {
+		if sig, err = derToCompact(sig); err != nil {
+			return "", err
+		}
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseUCAN decodes a token and verifies the signature of its issuer, its
+// proofs and time bounds aren't checked
+func ParseUCAN(raw string) (*UCAN, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := &ucanHeader{}
+	if err := decodeUCANPart(parts[0], header); err != nil {
+		return nil, err
+	}
+
+	t := &UCAN{}
+	if err := decodeUCANPart(parts[1], t); err != nil {
+		return nil, err
+	}
+
+	pubKey, err := PublicKeyFromDID(t.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg, err := ucanAlgorithm(int(pubKey.Type())); err != nil || alg != header.Alg {
+		return nil, errors.Errorf("unexpected token algorithm: %s", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode token signature")
+	}
+
+	if pubKey.Type() == crypto.Secp256k1 {
+		if sig, err = compactToDER(sig); err != nil {
+			return nil, err
+		}
+	}
+
+	ok, err := pubKey.Verify([]byte(parts[0]+"."+parts[1]), sig)
+	if err != nil || !ok {
+		return nil, errors.New("token signature is invalid")
+	}
+
+	return t, nil
+}
+
+// UCANController is an access controller allowing entries carrying a UCAN
+// delegated to their key, whose proof chain starts at the root authority of
+// the log and grants UCANAppendAbility over the resource.
+//
+// The validity of the tokens is checked at the hybrid logical clock
+// timestamp of the entries (see hlc.Type), so entries written before their
+// token expired can still be joined. The timestamp must not be in the
+// future nor older than the ones of the parents of the entry. Entries
+// without timestamp are checked at the current time.
+type UCANController struct {
+	// Root is the DID of the root authority of the log
+	Root string
+
+	// Resource names the log in capabilities
+	Resource string
+
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+
+	// ClockSkew bounds how far in the future of the current time entry
+	// timestamps can be, DefaultUCANClockSkew when 0
+	ClockSkew time.Duration
+}
+
+// NewUCANController creates an access controller trusting the root DID
+func NewUCANController(root, resource string) *UCANController {
+	return &UCANController{Root: root, Resource: resource}
+}
+
+func (u *UCANController) CanAppend(_ context.Context, e iface.IPFSLogEntry, provider identityprovider.Interface, state LogState) error {
+	raw := e.GetMetadata()[UCANMetadataKey]
+	if raw == "" {
+		return errors.Wrap(errmsg.AccessDenied, "entry doesn't carry a UCAN")
+	}
+
+	token, err := ParseUCAN(raw)
+	if err != nil {
+		return errors.Wrap(errmsg.AccessDenied, err.Error())
+	}
+
+	key, err := identityprovider.UnmarshalPublicKey(e.GetKey())
+	if err != nil {
+		return errors.Wrap(err, "unable to unmarshal entry key")
+	}
+
+	did, err := DIDFromPublicKey(key)
+	if err != nil {
+		return err
+	}
+
+	if token.Audience != did {
+		return errors.Wrap(errmsg.AccessDenied, "UCAN isn't delegated to the entry key")
+	}
+
+	at, err := u.checkTime(e, state)
+	if err != nil {
+		return errors.Wrap(errmsg.AccessDenied, err.Error())
+	}
+
+	required := UCANCapability{With: u.Resource, Can: UCANAppendAbility}
+	if err := u.verify(token, required, at.Unix(), 0); err != nil {
+		return errors.Wrap(errmsg.AccessDenied, err.Error())
+	}
+
+	return entry.VerifyIdentity(e, provider)
+}
+
+// checkTime returns the time the token of the entry is checked at, the
+// timestamp of the entry bounded by the current time and the timestamps of
+// its parents
+func (u *UCANController) checkTime(e iface.IPFSLogEntry, state LogState) (time.Time, error) {
+	now := time.Now
+	if u.Now != nil {
+		now = u.Now
+	}
+
+	ts := e.GetHLC()
+	if ts == nil {
+		return now(), nil
+	}
+
+	skew := u.ClockSkew
+	if skew == 0 {
+		skew = DefaultUCANClockSkew
+	}
+
+	if ts.Time().After(now().Add(skew)) {
+		return time.Time{}, errors.New("entry timestamp is in the future")
+	}
+
+	for _, next := range e.GetNext() {
+		parent, ok := state.GetEntry(next)
+		if !ok || parent.GetHLC() == nil {
+			continue
+		}
+
+		if hlc.Compare(ts, parent.GetHLC()) <= 0 {
+			return time.Time{}, errors.New("entry timestamp isn't after the timestamps of its parents")
+		}
+	}
+
+	return ts.Time(), nil
+}
+
+// verify checks that the token grants the capability and that one of its
+// proof chains terminates at the root authority
+func (u *UCANController) verify(t *UCAN, required UCANCapability, now int64, depth int) error {
+	if depth > maxUCANDepth {
+		return errors.New("UCAN proof chain is too long")
+	}
+
+	if t.NotBefore != 0 && now < t.NotBefore {
+		return errors.New("UCAN isn't valid yet")
+	}
+
+	if t.Expiration != 0 && now >= t.Expiration {
+		return errors.New("UCAN is expired")
+	}
+
+	granted := false
+	for _, c := range t.Capabilities {
+		if c.covers(required) {
+			granted = true
+			break
+		}
+	}
+
+	if !granted {
+		return errors.Errorf("UCAN doesn't grant %s on %s", required.Can, required.With)
+	}
+
+	if t.Issuer == u.Root {
+		return nil
+	}
+
+	for _, raw := range t.Proofs {
+		proof, err := ParseUCAN(raw)
+		if err != nil || proof.Audience != t.Issuer {
+			continue
+		}
+
+		if u.verify(proof, required, now, depth+1) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("UCAN proof chain doesn't terminate at the root authority")
+}
+
+var _ Interface = &UCANController{}
+
+// DIDFromPublicKey returns the did:key of an Ed25519 or secp256k1 key
+func DIDFromPublicKey(pubKey crypto.PubKey) (string, error) {
+	raw, err := pubKey.Raw()
+	if err != nil {
+		return "", err
+	}
+
+	var prefix []byte
+	switch pubKey.Type() {
+	case crypto.Ed25519:
+		prefix = didKeyEd25519
+	case crypto.Secp256k1:
+		prefix = didKeySecp256k1
+	default:
+		return "", errors.Errorf("unsupported did:key type: %d", pubKey.Type())
+	}
+
+	encoded, err := multibase.Encode(multibase.Base58BTC, append(append([]byte{}, prefix...), raw...))
+	if err != nil {
+		return "", err
+	}
+
+	return "did:key:" + encoded, nil
+}
+
+// PublicKeyFromDID returns the key of a did:key
+func PublicKeyFromDID(did string) (crypto.PubKey, error) {
+	if !strings.HasPrefix(did, "did:key:") {
+		return nil, errors.Errorf("unsupported DID: %s", did)
+	}
+
+	_, data, err := multibase.Decode(strings.TrimPrefix(did, "did:key:"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode did:key")
+	}
+
+	switch {
+	case bytes.HasPrefix(data, didKeyEd25519):
+		return crypto.UnmarshalEd25519PublicKey(data[len(didKeyEd25519):])
+	case bytes.HasPrefix(data, didKeySecp256k1):
+		return crypto.UnmarshalSecp256k1PublicKey(data[len(didKeySecp256k1):])
+	}
+
+	return nil, errors.Errorf("unsupported did:key: %s", did)
+}
+
+func ucanAlgorithm(keyType int) (string, error) {
+	switch keyType {
+	case crypto.Ed25519:
+		return "EdDSA", nil
+	case crypto.Secp256k1:
+		return "ES256K", nil
+	}
+
+	return "", errors.Errorf("unsupported token key type: %d", keyType)
+}
+
+func decodeUCANPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode token")
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "unable to decode token")
+	}
+
+	return nil
+}
+
+func derToCompact(der []byte) ([]byte, error) {
+	sig, err := btcec.ParseDERSignature(der, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+
+	compact := make([]byte, 64)
+	r, s := sig.R.Bytes(), sig.S.Bytes()
+	copy(compact[32-len(r):32], r)
+	copy(compact[64-len(s):], s)
+
+	return compact, nil
+}
+
+func compactToDER(compact []byte) ([]byte, error) {
+	if len(compact) != 64 {
+		return nil, errors.New("malformed secp256k1 signature")
+	}
+
+	sig := &btcec.Signature{
+		R: new(big.Int).SetBytes(compact[:32]),
+		S: new(big.Int).SetBytes(compact[32:]),
+	}
+
+	return sig.Serialize(), nil
+}
@@ -0,0 +1,288 @@
+// Package anchor commits the digest of the heads of a log to an external
+// chain, so the entries written before an anchor can't be rewritten
+// without being noticed
+package anchor // import "berty.tech/go-ipfs-log/anchor"
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// DefaultInterval is the time between two anchors when none is set
+const DefaultInterval = time.Hour
+
+// Anchorer records digests on an external chain
+type Anchorer interface {
+	// Commit records the digest and returns a receipt proving it, such
+	// as a transaction ID
+	Commit(ctx context.Context, digest []byte) ([]byte, error)
+
+	// Verify checks that the receipt proves the digest was recorded
+	Verify(ctx context.Context, digest []byte, receipt []byte) error
+}
+
+// Anchor is a set of heads of a log whose digest was committed
+type Anchor struct {
+	LogID string
+
+	// Heads are sorted by CID
+	Heads []cid.Cid
+
+	// Receipt is returned by the Anchorer
+	Receipt []byte
+
+	// Time is the local time of the commit, it isn't part of the digest
+	Time time.Time
+}
+
+// Digest returns the SHA-256 digest of the log ID and the heads, the order
+// of the heads doesn't matter
+func Digest(id string, heads []cid.Cid) []byte {
+	sorted := sortedHeads(heads)
+
+	h := sha256.New()
+	for _, b := range append([][]byte{[]byte(id)}, cidBytes(sorted)...) {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+		_, _ = h.Write(b)
+	}
+
+	return h.Sum(nil)
+}
+
+// Digest returns the digest of the anchored heads
+func (a *Anchor) Digest() []byte {
+	return Digest(a.LogID, a.Heads)
+}
+
+func sortedHeads(heads []cid.Cid) []cid.Cid {
+	sorted := append([]cid.Cid{}, heads...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+	})
+
+	return sorted
+}
+
+func cidBytes(cids []cid.Cid) [][]byte {
+	res := make([][]byte, len(cids))
+	for i, c := range cids {
+		res[i] = c.Bytes()
+	}
+
+	return res
+}
+
+// Options defines when the heads are anchored
+type Options struct {
+	// Interval is the time between two anchors, DefaultInterval when 0
+	Interval time.Duration
+
+	// OnAnchor is called after the heads are committed
+	OnAnchor func(a *Anchor)
+
+	// OnError is called when the heads can't be committed
+	OnError func(err error)
+}
+
+// Anchoring periodically commits the heads of a log. The log must not be
+// modified while it runs, except through Do.
+type Anchoring struct {
+	log      *log.Log
+	anchorer Anchorer
+	options  Options
+
+	lock   sync.Mutex
+	last   *Anchor
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates the anchoring of the log, Start runs it in the background
+func New(l *log.Log, anchorer Anchorer, options *Options) *Anchoring {
+	if options == nil {
+		options = &Options{}
+	}
+
+	a := &Anchoring{
+		log:      l,
+		anchorer: anchorer,
+		options:  *options,
+	}
+
+	if a.options.Interval <= 0 {
+		a.options.Interval = DefaultInterval
+	}
+
+	return a
+}
+
+// Anchor commits the current heads of the log, the last anchor is returned
+// when the heads didn't change since
+func (a *Anchoring) Anchor(ctx context.Context) (*Anchor, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	heads := []cid.Cid{}
+	for _, h := range a.log.GetHeads() {
+		heads = append(heads, h.GetHash())
+	}
+
+	if len(heads) == 0 {
+		return nil, errors.Wrap(errmsg.InvalidAnchor, "log is empty")
+	}
+
+	anchor := &Anchor{LogID: a.log.ID, Heads: sortedHeads(heads)}
+	if a.last != nil && bytes.Equal(a.last.Digest(), anchor.Digest()) {
+		return a.last, nil
+	}
+
+	receipt, err := a.anchorer.Commit(ctx, anchor.Digest())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to commit heads")
+	}
+
+	anchor.Receipt = receipt
+	anchor.Time = time.Now()
+	a.last = anchor
+
+	return anchor, nil
+}
+
+// Last returns the last anchor, nil before the first one
+func (a *Anchoring) Last() *Anchor {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.last
+}
+
+// Start anchors the heads at every interval until the context is done or
+// Close is called
+func (a *Anchoring) Start(ctx context.Context) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.cancel != nil {
+		return
+	}
+
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(a.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			a.run(ctx)
+		}
+	}(a.done)
+}
+
+func (a *Anchoring) run(ctx context.Context) {
+	previous := a.Last()
+
+	anchor, err := a.Anchor(ctx)
+	if err != nil {
+		if a.options.OnError != nil && ctx.Err() == nil {
+			a.options.OnError(err)
+		}
+
+		return
+	}
+
+	if anchor != previous && a.options.OnAnchor != nil {
+		a.options.OnAnchor(anchor)
+	}
+}
+
+// Close stops the background anchoring and waits for it to return
+func (a *Anchoring) Close() error {
+	a.lock.Lock()
+	cancel, done := a.cancel, a.done
+	a.cancel, a.done = nil, nil
+	a.lock.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	return nil
+}
+
+// Do calls fn with the log while its heads aren't anchored
+func (a *Anchoring) Do(fn func(l *log.Log) error) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return fn(a.log)
+}
+
+// Prove returns the chain of entries linking a head of the anchor to the
+// entry with the hash, see VerifyPredates
+func Prove(l *log.Log, a *Anchor, hash cid.Cid) (*log.Proof, error) {
+	if a == nil || a.LogID != l.ID {
+		return nil, errors.Wrap(errmsg.InvalidAnchor, "anchor of another log")
+	}
+
+	return l.ProveFrom(a.Heads, hash)
+}
+
+// VerifyPredates checks that the anchor was recorded by the anchorer and
+// that the proof links one of its heads to the entry with the hash, the
+// entry was then written before the anchor
+func VerifyPredates(ctx context.Context, anchorer Anchorer, a *Anchor, hash cid.Cid, proof *log.Proof) error {
+	if a == nil || len(a.Heads) == 0 {
+		return errors.Wrap(errmsg.InvalidAnchor, "anchor has no heads")
+	}
+
+	if err := anchorer.Verify(ctx, a.Digest(), a.Receipt); err != nil {
+		return errors.Wrapf(errmsg.InvalidAnchor, "receipt not verified: %s", err)
+	}
+
+	if proof == nil || len(proof.Path) == 0 {
+		return errors.Wrap(errmsg.InvalidProof, "malformed proof")
+	}
+
+	anchored := false
+	for _, h := range a.Heads {
+		if h.Equals(proof.Path[0]) {
+			anchored = true
+			break
+		}
+	}
+
+	if !anchored {
+		return errors.Wrapf(errmsg.InvalidProof, "proof starts at %s which isn't anchored", proof.Path[0])
+	}
+
+	e, err := log.VerifyProof(proof, proof.Path[0])
+	if err != nil {
+		return err
+	}
+
+	if !e.GetHash().Equals(hash) || e.GetLogID() != a.LogID {
+		return errors.Wrapf(errmsg.InvalidProof, "proof doesn't lead to %s", hash)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package ots // import "berty.tech/go-ipfs-log/anchor/ots"
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	goio "io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"github.com/pkg/errors"
+)
+
+// DefaultCalendars are the public calendars run by the OpenTimestamps
+// project
+var DefaultCalendars = []string{
+	"https://a.pool.opentimestamps.org",
+	"https://b.pool.opentimestamps.org",
+	"https://a.pool.eternitywall.com",
+}
+
+// Calendar is an OpenTimestamps calendar server aggregating digests into
+// Bitcoin transactions
+type Calendar struct {
+	URL string
+
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// NewCalendars returns the calendars with the given URLs
+func NewCalendars(urls ...string) []*Calendar {
+	calendars := []*Calendar{}
+	for _, u := range urls {
+		calendars = append(calendars, &Calendar{URL: u})
+	}
+
+	return calendars
+}
+
+// Submit sends the digest to the calendar, the returned timestamp holds a
+// pending attestation until the calendar commits it to Bitcoin
+func (c *Calendar) Submit(ctx context.Context, digest []byte) (*Timestamp, error) {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.URL, "/")+"/digest", bytes.NewReader(digest))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.do(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to submit digest to %s", c.URL)
+	}
+
+	return Unmarshal(digest, data)
+}
+
+// Upgrade asks the calendar for the timestamp of a commitment it made a
+// pending attestation for, errmsg.TimestampNotVerified is returned while it
+// isn't committed to Bitcoin
+func (c *Calendar) Upgrade(ctx context.Context, commitment []byte) (*Timestamp, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.URL, "/")+"/timestamp/"+hex.EncodeToString(commitment), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.do(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to upgrade timestamp from %s", c.URL)
+	}
+
+	return Unmarshal(commitment, data)
+}
+
+func (c *Calendar) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req.Header.Set("Accept", "application/vnd.opentimestamps.v1")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(goio.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxResponseSize {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "calendar response too large")
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errors.Wrap(errmsg.TimestampNotVerified, "commitment isn't known yet")
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return data, nil
+}
+
+// maxResponseSize bounds the responses of the calendars
+const maxResponseSize = 10000
+
+// Upgrade adds to the timestamp the Bitcoin attestations the given
+// calendars hold for their pending attestations, it returns true if the
+// timestamp changed. Calendars not listed are never contacted.
+func Upgrade(ctx context.Context, t *Timestamp, calendars []*Calendar) (bool, error) {
+	changed := false
+
+	var firstErr error
+	var upgrade func(t *Timestamp)
+	upgrade = func(t *Timestamp) {
+		for _, b := range t.Branches {
+			upgrade(b.Timestamp)
+		}
+
+		for _, a := range t.Attestations {
+			uri, ok := a.Calendar()
+			if !ok {
+				continue
+			}
+
+			for _, c := range calendars {
+				if strings.TrimSuffix(c.URL, "/") != strings.TrimSuffix(uri, "/") {
+					continue
+				}
+
+				upgraded, err := c.Upgrade(ctx, t.Msg)
+				if err == nil {
+					err = t.Merge(upgraded)
+				}
+
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+
+				changed = true
+			}
+		}
+	}
+
+	upgrade(t)
+
+	if !changed {
+		return false, firstErr
+	}
+
+	return true, nil
+}
@@ -0,0 +1,249 @@
+package ots // import "berty.tech/go-ipfs-log/anchor/ots"
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// BlockHeaders gives access to the Bitcoin block headers the attestations
+// are checked against, typically backed by a trusted node
+type BlockHeaders interface {
+	// MerkleRoot returns the merkle root of the block at the height, in
+	// the byte order of the block header, and the time of the block
+	MerkleRoot(ctx context.Context, height uint64) ([]byte, time.Time, error)
+}
+
+// Verify checks the Bitcoin attestations of the timestamp and returns the
+// time of the earliest block, the message existed before that time
+func Verify(ctx context.Context, t *Timestamp, headers BlockHeaders) (time.Time, error) {
+	var earliest time.Time
+	var firstErr error
+
+	for _, a := range t.Attested() {
+		height, ok := a.Attestation.BitcoinHeight()
+		if !ok {
+			continue
+		}
+
+		root, blockTime, err := headers.MerkleRoot(ctx, height)
+		if err == nil && !bytes.Equal(root, a.Msg) {
+			err = errors.Wrapf(errmsg.TimestampNotVerified, "merkle root of block %d doesn't match", height)
+		}
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if earliest.IsZero() || blockTime.Before(earliest) {
+			earliest = blockTime
+		}
+	}
+
+	if earliest.IsZero() {
+		if firstErr != nil {
+			return time.Time{}, firstErr
+		}
+
+		return time.Time{}, errors.Wrap(errmsg.TimestampNotVerified, "no Bitcoin attestation")
+	}
+
+	return earliest, nil
+}
+
+// Proof is stored on IPFS and links an entry to the timestamp of the
+// SHA-256 digest of its block
+type Proof struct {
+	Entry cid.Cid
+
+	// Timestamp is a detached timestamp file, see Timestamp.MarshalFile
+	Timestamp []byte
+}
+
+// entryDigest returns the SHA-256 digest of the block of the entry
+func entryDigest(ctx context.Context, services io.IpfsServices, hash cid.Cid) ([]byte, error) {
+	nd, err := services.DAG().Get(ctx, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read entry")
+	}
+
+	sum := sha256.Sum256(nd.RawData())
+
+	return sum[:], nil
+}
+
+// StampEntry submits the digest of the entry to the calendars and stores
+// the resulting proof, it fails when no calendar answers
+func StampEntry(ctx context.Context, services io.IpfsServices, hash cid.Cid, calendars []*Calendar) (cid.Cid, error) {
+	digest, err := entryDigest(ctx, services, hash)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	t := &Timestamp{Msg: digest}
+
+	var firstErr error
+	for _, c := range calendars {
+		stamp, err := c.Submit(ctx, digest)
+		if err == nil {
+			err = t.Merge(stamp)
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if len(t.Attested()) == 0 {
+		if firstErr == nil {
+			firstErr = errors.New("no calendar")
+		}
+
+		return cid.Cid{}, errors.Wrap(firstErr, "unable to timestamp entry")
+	}
+
+	return WriteProof(services, &Proof{Entry: hash, Timestamp: t.MarshalFile()})
+}
+
+// WriteProof stores the proof on IPFS
+func WriteProof(services io.IpfsServices, p *Proof) (cid.Cid, error) {
+	c, err := io.WriteCBOR(services, p)
+	if err != nil {
+		return cid.Cid{}, errors.Wrap(err, "unable to write proof")
+	}
+
+	return c, nil
+}
+
+// ReadProof reads the proof stored at the address and parses its timestamp
+func ReadProof(ctx context.Context, services io.IpfsServices, hash cid.Cid) (*Proof, *Timestamp, error) {
+	nd, err := services.DAG().Get(ctx, hash)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to read proof")
+	}
+
+	p := &Proof{}
+	if err := cbornode.DecodeInto(nd.RawData(), p); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decode proof")
+	}
+
+	t, err := UnmarshalFile(p.Timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, t, nil
+}
+
+// UpgradeProof upgrades the timestamp of the proof with the calendars, see
+// Upgrade, and stores the upgraded proof. The address of the proof is
+// returned unchanged when no calendar has a Bitcoin attestation yet.
+func UpgradeProof(ctx context.Context, services io.IpfsServices, hash cid.Cid, calendars []*Calendar) (cid.Cid, error) {
+	p, t, err := ReadProof(ctx, services, hash)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	changed, err := Upgrade(ctx, t, calendars)
+	if !changed {
+		return hash, err
+	}
+
+	return WriteProof(services, &Proof{Entry: p.Entry, Timestamp: t.MarshalFile()})
+}
+
+// VerifyEntry checks that the proof timestamps the block of its entry and
+// returns the entry with the time it existed before
+func VerifyEntry(ctx context.Context, services io.IpfsServices, hash cid.Cid, headers BlockHeaders) (cid.Cid, time.Time, error) {
+	p, t, err := ReadProof(ctx, services, hash)
+	if err != nil {
+		return cid.Cid{}, time.Time{}, err
+	}
+
+	digest, err := entryDigest(ctx, services, p.Entry)
+	if err != nil {
+		return cid.Cid{}, time.Time{}, err
+	}
+
+	if !bytes.Equal(digest, t.Msg) {
+		return cid.Cid{}, time.Time{}, errors.Wrap(errmsg.TimestampNotVerified, "timestamp of another block")
+	}
+
+	before, err := Verify(ctx, t, headers)
+	if err != nil {
+		return cid.Cid{}, time.Time{}, err
+	}
+
+	return p.Entry, before, nil
+}
+
+// Stamper timestamps the entries appended to a log, see
+// log.NewLogOptions.Stamper
+type Stamper struct {
+	services  io.IpfsServices
+	calendars []*Calendar
+
+	lock   sync.Mutex
+	proofs map[cid.Cid]cid.Cid
+}
+
+// NewStamper creates a stamper submitting the entries to the calendars
+func NewStamper(services io.IpfsServices, calendars []*Calendar) *Stamper {
+	return &Stamper{
+		services:  services,
+		calendars: calendars,
+		proofs:    map[cid.Cid]cid.Cid{},
+	}
+}
+
+// Stamp timestamps the entry and remembers the address of its proof
+func (s *Stamper) Stamp(ctx context.Context, e iface.IPFSLogEntry) error {
+	proof, err := StampEntry(ctx, s.services, e.GetHash(), s.calendars)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.proofs[e.GetHash()] = proof
+	s.lock.Unlock()
+
+	return nil
+}
+
+// Proof returns the address of the proof of an entry stamped by Stamp
+func (s *Stamper) Proof(hash cid.Cid) (cid.Cid, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	proof, ok := s.proofs[hash]
+
+	return proof, ok
+}
+
+var atlasProof = atlas.BuildEntry(Proof{}).
+	StructMap().
+	AddField("Entry", atlas.StructMapEntry{SerialName: "entry"}).
+	AddField("Timestamp", atlas.StructMapEntry{SerialName: "timestamp"}).
+	Complete()
+
+// MarshalCBOR encodes the proof as dag-cbor
+func (p *Proof) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(p)
+}
+
+func init() {
+	cbornode.RegisterCborType(atlasProof)
+}
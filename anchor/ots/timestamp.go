@@ -0,0 +1,418 @@
+// Package ots creates and verifies OpenTimestamps proofs of log entries,
+// giving evidence that an entry existed before the time of a Bitcoin block
+package ots // import "berty.tech/go-ipfs-log/anchor/ots"
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	goio "io"
+	"io/ioutil"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Operation tags of the OpenTimestamps format
+const (
+	OpSHA1      byte = 0x02
+	OpRIPEMD160 byte = 0x03
+	OpSHA256    byte = 0x08
+	OpKeccak256 byte = 0x67
+	OpAppend    byte = 0xf0
+	OpPrepend   byte = 0xf1
+	OpReverse   byte = 0xf2
+	OpHexlify   byte = 0xf3
+)
+
+const (
+	attestationTag = 0x00
+	forkTag        = 0xff
+
+	// maxSize bounds the messages, arguments and payloads of a timestamp
+	maxSize = 4096
+
+	// maxDepth bounds the nesting of the operations of a timestamp
+	maxDepth = 256
+)
+
+// fileMagic starts the detached timestamp files
+var fileMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+var (
+	pendingTag = [8]byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	bitcoinTag = [8]byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+)
+
+// Op is an operation applied to the message of a timestamp
+type Op struct {
+	Tag byte
+
+	// Arg is the argument of OpAppend and OpPrepend
+	Arg []byte
+}
+
+func (o Op) binary() bool {
+	return o.Tag == OpAppend || o.Tag == OpPrepend
+}
+
+// Apply returns the result of the operation on the message
+func (o Op) Apply(msg []byte) ([]byte, error) {
+	var res []byte
+
+	switch o.Tag {
+	case OpAppend:
+		res = append(append([]byte{}, msg...), o.Arg...)
+	case OpPrepend:
+		res = append(append([]byte{}, o.Arg...), msg...)
+	case OpReverse:
+		res = make([]byte, len(msg))
+		for i, b := range msg {
+			res[len(msg)-1-i] = b
+		}
+	case OpHexlify:
+		res = []byte(hex.EncodeToString(msg))
+	case OpSHA1:
+		sum := sha1.Sum(msg)
+		res = sum[:]
+	case OpRIPEMD160:
+		h := ripemd160.New()
+		_, _ = h.Write(msg)
+		res = h.Sum(nil)
+	case OpSHA256:
+		sum := sha256.Sum256(msg)
+		res = sum[:]
+	case OpKeccak256:
+		h := sha3.NewLegacyKeccak256()
+		_, _ = h.Write(msg)
+		res = h.Sum(nil)
+	default:
+		return nil, errors.Wrapf(errmsg.InvalidTimestamp, "unknown operation 0x%02x", o.Tag)
+	}
+
+	if len(res) > maxSize {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "message too large")
+	}
+
+	return res, nil
+}
+
+// Attestation states that a message was recorded by a calendar or a
+// Bitcoin block
+type Attestation struct {
+	Tag     [8]byte
+	Payload []byte
+}
+
+// PendingAttestation is the promise of a calendar to record the message
+func PendingAttestation(uri string) Attestation {
+	return Attestation{Tag: pendingTag, Payload: appendVarBytes(nil, []byte(uri))}
+}
+
+// BitcoinAttestation states that the message is the merkle root of the
+// Bitcoin block at the height
+func BitcoinAttestation(height uint64) Attestation {
+	return Attestation{Tag: bitcoinTag, Payload: appendUvarint(nil, height)}
+}
+
+// Calendar returns the URI of the calendar of a pending attestation
+func (a Attestation) Calendar() (string, bool) {
+	if a.Tag != pendingTag {
+		return "", false
+	}
+
+	uri, err := readVarBytes(bufio.NewReader(bytes.NewReader(a.Payload)))
+	if err != nil {
+		return "", false
+	}
+
+	return string(uri), true
+}
+
+// BitcoinHeight returns the block height of a Bitcoin attestation
+func (a Attestation) BitcoinHeight() (uint64, bool) {
+	if a.Tag != bitcoinTag {
+		return 0, false
+	}
+
+	height, err := binary.ReadUvarint(bytes.NewReader(a.Payload))
+	if err != nil {
+		return 0, false
+	}
+
+	return height, true
+}
+
+// Branch is an operation and the timestamp of its result
+type Branch struct {
+	Op        Op
+	Timestamp *Timestamp
+}
+
+// Timestamp commits a message to attestations, directly or through
+// operations
+type Timestamp struct {
+	Msg          []byte
+	Attestations []Attestation
+	Branches     []*Branch
+}
+
+// Attested is an attestation and the message it attests
+type Attested struct {
+	Msg         []byte
+	Attestation Attestation
+}
+
+// Attested returns the attestations of the timestamp and of its branches
+func (t *Timestamp) Attested() []Attested {
+	res := []Attested{}
+	for _, a := range t.Attestations {
+		res = append(res, Attested{Msg: t.Msg, Attestation: a})
+	}
+
+	for _, b := range t.Branches {
+		res = append(res, b.Timestamp.Attested()...)
+	}
+
+	return res
+}
+
+// Merge adds the attestations and operations of other, a timestamp of the
+// same message
+func (t *Timestamp) Merge(other *Timestamp) error {
+	if !bytes.Equal(t.Msg, other.Msg) {
+		return errors.Wrap(errmsg.InvalidTimestamp, "can't merge timestamps of different messages")
+	}
+
+	for _, a := range other.Attestations {
+		if !t.hasAttestation(a) {
+			t.Attestations = append(t.Attestations, a)
+		}
+	}
+
+	for _, ob := range other.Branches {
+		merged := false
+		for _, b := range t.Branches {
+			if b.Op.Tag == ob.Op.Tag && bytes.Equal(b.Op.Arg, ob.Op.Arg) {
+				if err := b.Timestamp.Merge(ob.Timestamp); err != nil {
+					return err
+				}
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			t.Branches = append(t.Branches, ob)
+		}
+	}
+
+	return nil
+}
+
+func (t *Timestamp) hasAttestation(a Attestation) bool {
+	for _, x := range t.Attestations {
+		if x.Tag == a.Tag && bytes.Equal(x.Payload, a.Payload) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Marshal serializes the timestamp without its message, as calendars do
+func (t *Timestamp) Marshal() []byte {
+	return t.appendTo(nil)
+}
+
+func (t *Timestamp) appendTo(buf []byte) []byte {
+	count := len(t.Attestations) + len(t.Branches)
+	item := 0
+	fork := func() {
+		if item < count-1 {
+			buf = append(buf, forkTag)
+		}
+		item++
+	}
+
+	for _, a := range t.Attestations {
+		fork()
+		buf = append(buf, attestationTag)
+		buf = append(buf, a.Tag[:]...)
+		buf = appendVarBytes(buf, a.Payload)
+	}
+
+	for _, b := range t.Branches {
+		fork()
+		buf = append(buf, b.Op.Tag)
+		if b.Op.binary() {
+			buf = appendVarBytes(buf, b.Op.Arg)
+		}
+		buf = b.Timestamp.appendTo(buf)
+	}
+
+	return buf
+}
+
+// Unmarshal parses a timestamp of the message serialized by Marshal
+func Unmarshal(msg []byte, data []byte) (*Timestamp, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	t, err := readTimestamp(r, msg, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.ReadByte(); err != goio.EOF {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "trailing data")
+	}
+
+	return t, nil
+}
+
+// MarshalFile serializes the timestamp of a SHA-256 digest as a detached
+// timestamp file, the .ots files of the OpenTimestamps clients
+func (t *Timestamp) MarshalFile() []byte {
+	buf := append([]byte{}, fileMagic...)
+	buf = appendUvarint(buf, 1)
+	buf = append(buf, OpSHA256)
+	buf = append(buf, t.Msg...)
+
+	return t.appendTo(buf)
+}
+
+// UnmarshalFile parses a detached timestamp file of a SHA-256 digest
+func UnmarshalFile(data []byte) (*Timestamp, error) {
+	if !bytes.HasPrefix(data, fileMagic) {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "not a timestamp file")
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data[len(fileMagic):]))
+
+	version, err := binary.ReadUvarint(r)
+	if err != nil || version != 1 {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "unsupported timestamp file version")
+	}
+
+	if op, err := r.ReadByte(); err != nil || op != OpSHA256 {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "file digest isn't SHA-256")
+	}
+
+	digest := make([]byte, sha256.Size)
+	if _, err := goio.ReadFull(r, digest); err != nil {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "truncated digest")
+	}
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, err.Error())
+	}
+
+	return Unmarshal(digest, rest)
+}
+
+func readTimestamp(r *bufio.Reader, msg []byte, depth int) (*Timestamp, error) {
+	if depth > maxDepth {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "too many nested operations")
+	}
+
+	t := &Timestamp{Msg: msg}
+
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(errmsg.InvalidTimestamp, "truncated timestamp")
+		}
+
+		last := tag != forkTag
+		if !last {
+			if tag, err = r.ReadByte(); err != nil {
+				return nil, errors.Wrap(errmsg.InvalidTimestamp, "truncated timestamp")
+			}
+		}
+
+		if err := t.readItem(r, tag, depth); err != nil {
+			return nil, err
+		}
+
+		if last {
+			return t, nil
+		}
+	}
+}
+
+func (t *Timestamp) readItem(r *bufio.Reader, tag byte, depth int) error {
+	if tag == attestationTag {
+		a := Attestation{}
+		if _, err := goio.ReadFull(r, a.Tag[:]); err != nil {
+			return errors.Wrap(errmsg.InvalidTimestamp, "truncated attestation")
+		}
+
+		payload, err := readVarBytes(r)
+		if err != nil {
+			return err
+		}
+		a.Payload = payload
+
+		t.Attestations = append(t.Attestations, a)
+
+		return nil
+	}
+
+	op := Op{Tag: tag}
+	if op.binary() {
+		arg, err := readVarBytes(r)
+		if err != nil {
+			return err
+		}
+		op.Arg = arg
+	}
+
+	res, err := op.Apply(t.Msg)
+	if err != nil {
+		return err
+	}
+
+	child, err := readTimestamp(r, res, depth+1)
+	if err != nil {
+		return err
+	}
+
+	t.Branches = append(t.Branches, &Branch{Op: op, Timestamp: child})
+
+	return nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarBytes(buf []byte, data []byte) []byte {
+	return append(appendUvarint(buf, uint64(len(data))), data...)
+}
+
+func readVarBytes(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "truncated length")
+	}
+
+	if size > maxSize {
+		return nil, errors.Wrapf(errmsg.InvalidTimestamp, "%d bytes exceed the maximum size", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := goio.ReadFull(r, data); err != nil {
+		return nil, errors.Wrap(errmsg.InvalidTimestamp, "truncated data")
+	}
+
+	return data, nil
+}
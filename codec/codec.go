@@ -0,0 +1,75 @@
+package codec // import "berty.tech/go-ipfs-log/codec"
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Codec encodes application values into entry payloads and decodes them
+// back, its name is recorded in the entries so readers can pick the right
+// codec
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecs   = map[string]Codec{}
+	codecsMu sync.RWMutex
+)
+
+// Register adds a codec to the registry, replacing any codec with the
+// same name
+func Register(c Codec) error {
+	if c == nil {
+		return errors.New("codec not defined")
+	}
+
+	if c.Name() == "" {
+		return errors.New("codec name not defined")
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.Name()] = c
+
+	return nil
+}
+
+// Unregister removes a codec from the registry
+func Unregister(name string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	delete(codecs, name)
+}
+
+// Get returns the codec registered with the given name, entries without a
+// codec name use the raw codec
+func Get(name string) (Codec, error) {
+	if name == "" {
+		name = RawName
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("payload codec '%s' is not supported", name))
+	}
+
+	return c, nil
+}
+
+func init() {
+	for _, c := range []Codec{&Raw{}, &JSON{}, &CBOR{}, &Protobuf{}} {
+		if err := Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package codec // import "berty.tech/go-ipfs-log/codec"
+
+import (
+	"encoding/json"
+
+	"github.com/gogo/protobuf/proto"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+)
+
+const (
+	RawName      = "raw"
+	JSONName     = "json"
+	CBORName     = "cbor"
+	ProtobufName = "protobuf"
+)
+
+// Raw stores bytes and strings as they are
+type Raw struct{}
+
+func (*Raw) Name() string {
+	return RawName
+}
+
+func (*Raw) Marshal(v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	}
+
+	return nil, errors.New("raw codec only supports []byte and string values")
+}
+
+func (*Raw) Unmarshal(data []byte, v interface{}) error {
+	switch val := v.(type) {
+	case *[]byte:
+		*val = data
+		return nil
+	case *string:
+		*val = string(data)
+		return nil
+	}
+
+	return errors.New("raw codec only supports *[]byte and *string values")
+}
+
+// JSON encodes values using encoding/json
+type JSON struct{}
+
+func (*JSON) Name() string {
+	return JSONName
+}
+
+func (*JSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (*JSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// CBOR encodes values using the IPLD CBOR atlas, custom types need to be
+// registered with cbornode.RegisterCborType
+type CBOR struct{}
+
+func (*CBOR) Name() string {
+	return CBORName
+}
+
+func (*CBOR) Marshal(v interface{}) ([]byte, error) {
+	return cbornode.DumpObject(v)
+}
+
+func (*CBOR) Unmarshal(data []byte, v interface{}) error {
+	return cbornode.DecodeInto(data, v)
+}
+
+// Protobuf encodes protobuf messages
+type Protobuf struct{}
+
+func (*Protobuf) Name() string {
+	return ProtobufName
+}
+
+func (*Protobuf) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("protobuf codec only supports proto.Message values")
+	}
+
+	return proto.Marshal(msg)
+}
+
+func (*Protobuf) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("protobuf codec only supports proto.Message values")
+	}
+
+	return proto.Unmarshal(data, msg)
+}
+
+var _ Codec = &Raw{}
+var _ Codec = &JSON{}
+var _ Codec = &CBOR{}
+var _ Codec = &Protobuf{}
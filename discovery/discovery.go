@@ -0,0 +1,242 @@
+// Package discovery announces logs on the DHT and finds the peers holding
+// them
+package discovery // import "berty.tech/go-ipfs-log/discovery"
+
+import (
+	"context"
+	"sync"
+
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/pkg/errors"
+)
+
+// keyPrefix is prepended to the log ID to build the block of the log key
+const keyPrefix = "/ipfs-log/"
+
+// KeyBlock returns the block whose CID every peer holding the log with the
+// given ID provides
+func KeyBlock(id string) (blocks.Block, error) {
+	data := []byte(keyPrefix + id)
+
+	c, err := cid.Prefix{
+		Version:  1,
+		Codec:    cid.Raw,
+		MhType:   mh.SHA2_256,
+		MhLength: -1,
+	}.Sum(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// Key returns the CID provided by the peers holding the log with the given
+// ID
+func Key(id string) (cid.Cid, error) {
+	b, err := KeyBlock(id)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	return b.Cid(), nil
+}
+
+// FindPeers returns the peers providing the log with the given ID, at most
+// count peers are returned when count is positive
+func FindPeers(ctx context.Context, dht coreiface.DhtAPI, id string, count int) (<-chan pstore.PeerInfo, error) {
+	key, err := Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []options.DhtFindProvidersOption{}
+	if count > 0 {
+		opts = append(opts, options.Dht.NumProviders(count))
+	}
+
+	peers, err := dht.FindProviders(ctx, coreiface.IpldPath(key), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find log providers")
+	}
+
+	return peers, nil
+}
+
+// AnnouncerOptions defines what is announced
+type AnnouncerOptions struct {
+	// Heads also provides the heads of the log each time entries are
+	// appended or joined, only the log key is provided otherwise
+	Heads bool
+
+	// Limiter bounds the number of CIDs provided per second, the heads
+	// changing while waiting are coalesced so only the latest ones are
+	// provided
+	Limiter *ratelimit.Limiter
+
+	// OnError is called when a CID can't be provided, errors are dropped
+	// when nil
+	OnError func(err error)
+}
+
+// Announcer provides the key of a log on the DHT, and optionally its heads
+// as they change, so peers can find it without exchanging addresses out of
+// band
+type Announcer struct {
+	dht     coreiface.DhtAPI
+	log     *log.Log
+	options AnnouncerOptions
+	key     cid.Cid
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending chan []cid.Cid
+	done    chan struct{}
+	once    sync.Once
+
+	unsubscribe func()
+}
+
+// NewAnnouncer stores the key block of the log and starts providing it,
+// providing happens in the background until Close is called
+func NewAnnouncer(ctx context.Context, dht coreiface.DhtAPI, l *log.Log, options *AnnouncerOptions) (*Announcer, error) {
+	if dht == nil {
+		return nil, errors.New("dht api is not defined")
+	}
+
+	if l == nil {
+		return nil, errors.New("log is not defined")
+	}
+
+	if options == nil {
+		options = &AnnouncerOptions{}
+	}
+
+	block, err := KeyBlock(l.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A node only provides the blocks it holds
+	if err := l.Storage.BlockStore().Put(block); err != nil {
+		return nil, errors.Wrap(err, "unable to store log key")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	a := &Announcer{
+		dht:     dht,
+		log:     l,
+		options: *options,
+		key:     block.Cid(),
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(chan []cid.Cid, 1),
+		done:    make(chan struct{}),
+	}
+
+	if options.Heads {
+		a.pending <- headHashes(l)
+
+		a.unsubscribe = l.OnUpdate(func(l *log.Log) {
+			a.queue(headHashes(l))
+		})
+	}
+
+	go a.run()
+
+	return a, nil
+}
+
+// Close stops providing and waits for the current provide to return
+func (a *Announcer) Close() error {
+	a.once.Do(func() {
+		if a.unsubscribe != nil {
+			a.unsubscribe()
+		}
+
+		a.cancel()
+		<-a.done
+	})
+
+	return nil
+}
+
+// queue replaces the CIDs waiting to be provided, appends don't wait for
+// the DHT
+func (a *Announcer) queue(keys []cid.Cid) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	for {
+		select {
+		case a.pending <- keys:
+			return
+		default:
+		}
+
+		select {
+		case <-a.pending:
+		default:
+		}
+	}
+}
+
+func (a *Announcer) run() {
+	defer close(a.done)
+
+	// The log key is provided before the heads
+	if !a.provide(a.key) {
+		return
+	}
+
+	for {
+		select {
+		case keys := <-a.pending:
+			for _, k := range keys {
+				if !a.provide(k) {
+					return
+				}
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// provide provides a CID once the limiter allows it, it returns false once
+// the announcer is closed
+func (a *Announcer) provide(k cid.Cid) bool {
+	if err := a.options.Limiter.Wait(a.ctx); err != nil {
+		return false
+	}
+
+	if err := a.dht.Provide(a.ctx, coreiface.IpldPath(k)); err != nil && a.ctx.Err() == nil {
+		a.error(errors.Wrapf(err, "unable to provide %s", k))
+	}
+
+	return a.ctx.Err() == nil
+}
+
+func (a *Announcer) error(err error) {
+	if a.options.OnError != nil {
+		a.options.OnError(err)
+	}
+}
+
+func headHashes(l *log.Log) []cid.Cid {
+	hashes := []cid.Cid{}
+	for _, h := range l.GetHeads() {
+		hashes = append(hashes, h.GetHash())
+	}
+
+	return hashes
+}
@@ -0,0 +1,200 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/tok"
+)
+
+// IsCanonical returns an error if the raw data of a block isn't encoded as
+// canonical CBOR. The tokens of the data are encoded again rather than its
+// IPLD node, which can't hold the unsigned integers above math.MaxInt64.
+func IsCanonical(data []byte) error {
+	r := bytes.NewReader(data)
+	dec := cbor.NewDecoder(cbor.DecodeOptions{}, r)
+
+	buf := &bytes.Buffer{}
+	enc := cbor.NewEncoder(buf)
+
+	tokens := &cborTokens{canonical: true}
+	for {
+		var tk tok.Token
+		done, err := dec.Step(&tk)
+		if err != nil {
+			return err
+		}
+
+		if (tk.Type == tok.TMapOpen || tk.Type == tok.TArrOpen) && tk.Length < 0 {
+			return errmsg.NotCanonical
+		}
+
+		if _, _, err := tokens.step(&tk); err != nil {
+			return err
+		}
+
+		if _, err := enc.Step(&tk); err != nil {
+			return err
+		}
+
+		if done {
+			break
+		}
+	}
+
+	if r.Len() > 0 {
+		return errors.Errorf("%d bytes of trailing data", r.Len())
+	}
+
+	if !bytes.Equal(data, buf.Bytes()) {
+		return errmsg.NotCanonical
+	}
+
+	return nil
+}
+
+// cborTokens follows the tokens of a CBOR value to tell the key of the map
+// entry each value belongs to. When canonical is set, map keys which aren't
+// sorted as canonical CBOR requires, shorter keys first then bytewise, are
+// rejected.
+type cborTokens struct {
+	canonical bool
+	frames    []cborFrame
+}
+
+type cborFrame struct {
+	isMap   bool
+	wantKey bool
+	hasKey  bool
+	key     string
+}
+
+// step records a token, it returns the key of the map entry the token is
+// the value of and the depth of that map, 0 when the token isn't a value
+// of a map entry
+func (t *cborTokens) step(tk *tok.Token) (string, int, error) {
+	var top *cborFrame
+	if len(t.frames) > 0 {
+		top = &t.frames[len(t.frames)-1]
+	}
+
+	switch {
+	case tk.Type == tok.TMapClose || tk.Type == tok.TArrClose:
+		if top == nil {
+			return "", 0, errUnexpectedCBOR
+		}
+
+		t.frames = t.frames[:len(t.frames)-1]
+		t.valueDone()
+
+		return "", 0, nil
+
+	case top != nil && top.isMap && top.wantKey:
+		if tk.Type != tok.TString {
+			return "", 0, errUnexpectedCBOR
+		}
+
+		if t.canonical && top.hasKey && !canonicalLess(top.key, tk.Str) {
+			return "", 0, errmsg.NotCanonical
+		}
+
+		top.key, top.hasKey, top.wantKey = tk.Str, true, false
+
+		return "", 0, nil
+	}
+
+	key, depth := "", 0
+	if top != nil && top.isMap {
+		key, depth = top.key, len(t.frames)
+	}
+
+	switch tk.Type {
+	case tok.TMapOpen:
+		t.frames = append(t.frames, cborFrame{isMap: true, wantKey: true})
+	case tok.TArrOpen:
+		t.frames = append(t.frames, cborFrame{})
+	default:
+		t.valueDone()
+	}
+
+	return key, depth, nil
+}
+
+func (t *cborTokens) valueDone() {
+	if n := len(t.frames); n > 0 && t.frames[n-1].isMap {
+		t.frames[n-1].wantKey = true
+	}
+}
+
+// canonicalLess returns true if the key a is sorted before b
+func canonicalLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+// EncodingVerifier is implemented by the entries able to check that they
+// are encoded as their hash expects
+type EncodingVerifier interface {
+	VerifyEncoding() error
+}
+
+// VerifyEncoding checks that encoding the entry again reproduces its hash,
+// see VerifyEncoding
+func (e *Entry) VerifyEncoding() error {
+	return VerifyEncoding(e)
+}
+
+// VerifyEncoding checks that encoding the entry again reproduces its hash
+func VerifyEncoding(e *Entry) error {
+	if e == nil {
+		return errors.New("entry is not defined")
+	}
+
+	if !e.Hash.Defined() {
+		return errors.New("entry has no hash")
+	}
+
+	prefix := e.Hash.Prefix()
+
+	if e.encoding == EncodingDagJSON {
+		data, err := marshalDagJSON(e.ToCborEntry())
+		if err != nil {
+			return errors.Wrap(err, "unable to encode entry")
+		}
+
+		hash, err := prefix.Sum(data)
+		if err != nil {
+			return err
+		}
+
+		if !hash.Equals(e.Hash) {
+			return errors.Wrapf(errmsg.HashMismatch, "expected %s, got %s", e.Hash, hash)
+		}
+
+		return nil
+	}
+
+	data, err := e.ToCborEntry().MarshalCBOR()
+	if err != nil {
+		return errors.Wrap(err, "unable to encode entry")
+	}
+
+	prefix.Version, prefix.Codec = 1, cid.DagCBOR
+
+	hash, err := prefix.Sum(data)
+	if err != nil {
+		return err
+	}
+
+	if !hash.Equals(e.Hash) {
+		return errors.Wrapf(errmsg.HashMismatch, "expected %s, got %s", e.Hash, hash)
+	}
+
+	return IsCanonical(data)
+}
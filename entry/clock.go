@@ -0,0 +1,42 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// CheckClock returns errmsg.ClockNotMonotonic if the Lamport time of an
+// entry isn't strictly greater than the time of its parent
+func CheckClock(e, parent iface.IPFSLogEntry) error {
+	if e.GetClock().Time <= parent.GetClock().Time {
+		return errors.Wrapf(errmsg.ClockNotMonotonic, "entry %s has time %d, parent %s has time %d", e.GetHash(), e.GetClock().Time, parent.GetHash(), parent.GetClock().Time)
+	}
+
+	return nil
+}
+
+// CheckClocks checks the clock of each entry against its parents found in
+// entries or known, missing parents are skipped
+func CheckClocks(entries []iface.IPFSLogEntry, known *OrderedMap) error {
+	index := NewOrderedMapFromEntries(entries)
+
+	for _, e := range entries {
+		for _, next := range e.GetNext() {
+			parent, ok := index.GetCID(next)
+			if !ok && known != nil {
+				parent, ok = known.GetCID(next)
+			}
+
+			if !ok {
+				continue
+			}
+
+			if err := CheckClock(e, parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// CoSignature is a signature of the entry by another key than the one of
+// its identity, over the same data
+type CoSignature struct {
+	Key []byte
+	Sig []byte
+}
+
+type CborCoSignature struct {
+	Key string
+	Sig string
+}
+
+func (s *CoSignature) ToCborCoSignature() *CborCoSignature {
+	return &CborCoSignature{
+		Key: hex.EncodeToString(s.Key),
+		Sig: hex.EncodeToString(s.Sig),
+	}
+}
+
+func (c *CborCoSignature) ToCoSignature() (*CoSignature, error) {
+	key, err := hex.DecodeString(c.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := hex.DecodeString(c.Sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CoSignature{Key: key, Sig: sig}, nil
+}
+
+// CoSignedEntry is implemented by the entries able to list the keys having
+// signed them, see SignedKeys
+type CoSignedEntry interface {
+	SignedKeys() ([][]byte, error)
+}
+
+// SignedKeys returns the keys having validly signed the entry, the key of
+// the entry first followed by its co-signers, each key once. The entry must
+// implement CoSignedEntry.
+func SignedKeys(e iface.IPFSLogEntry) ([][]byte, error) {
+	s, ok := e.(CoSignedEntry)
+	if !ok {
+		return nil, errors.Errorf("unsupported entry type %T", e)
+	}
+
+	return s.SignedKeys()
+}
+
+// SignedKeys verifies the signature and co-signatures of the entry and
+// returns their keys
+func (e *Entry) SignedKeys() ([][]byte, error) {
+	data, err := ToBuffer(e.ToHashable())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build string buffer")
+	}
+
+	if err := verifySignature(e.Key, e.Sig, data); err != nil {
+		return nil, err
+	}
+
+	keys := [][]byte{e.Key}
+	for _, s := range e.CoSignatures {
+		if err := verifySignature(s.Key, s.Sig, data); err != nil {
+			return nil, errors.Wrap(err, "invalid co-signature")
+		}
+
+		known := false
+		for _, k := range keys {
+			if bytes.Equal(k, s.Key) {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			keys = append(keys, s.Key)
+		}
+	}
+
+	return keys, nil
+}
+
+func verifySignature(key, sig, data []byte) error {
+	pubKey, err := identityprovider.UnmarshalPublicKey(key)
+	if err != nil {
+		return errors.Wrapf(errmsg.MalformedEntry, "unable to unmarshal public key: %s", err)
+	}
+
+	ok, err := pubKey.Verify(data, sig)
+	if err != nil || !ok {
+		return errors.Wrap(errmsg.BadSignature, "unable to verify entry signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+)
+
+// Denylist lists the entries and authors whose content must be neither
+// fetched nor merged into a log
+type Denylist interface {
+	// DeniesEntry returns true if the entry with the given hash is denied
+	DeniesEntry(hash cid.Cid) bool
+
+	// DeniesAuthor returns true if the entries signed by the identity are
+	// denied
+	DeniesAuthor(identity *identityprovider.Identity) bool
+}
+
+// IsDenied returns true if the entry or its author is denied, a nil
+// denylist denies nothing
+func IsDenied(d Denylist, e iface.IPFSLogEntry) bool {
+	if d == nil || e == nil {
+		return false
+	}
+
+	if d.DeniesEntry(e.GetHash()) {
+		return true
+	}
+
+	return e.GetIdentity() != nil && d.DeniesAuthor(e.GetIdentity())
+}
+
+// MemoryDenylist is a Denylist held in memory, it is safe for concurrent
+// use
+type MemoryDenylist struct {
+	mu      sync.RWMutex
+	entries *cid.Set
+	authors map[string]struct{}
+	keys    map[string]struct{}
+}
+
+func NewDenylist() *MemoryDenylist {
+	return &MemoryDenylist{
+		entries: cid.NewSet(),
+		authors: map[string]struct{}{},
+		keys:    map[string]struct{}{},
+	}
+}
+
+// DenyEntry denies the entry with the given hash
+func (d *MemoryDenylist) DenyEntry(hash cid.Cid) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries.Add(hash)
+}
+
+// DenyAuthor denies the entries signed by the identity with the given ID
+func (d *MemoryDenylist) DenyAuthor(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.authors[id] = struct{}{}
+}
+
+// DenyKey denies the entries signed by the identity with the given public
+// key
+func (d *MemoryDenylist) DenyKey(key []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.keys[hex.EncodeToString(key)] = struct{}{}
+}
+
+func (d *MemoryDenylist) DeniesEntry(hash cid.Cid) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.entries.Has(hash)
+}
+
+func (d *MemoryDenylist) DeniesAuthor(identity *identityprovider.Identity) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.authors[identity.ID]; ok {
+		return true
+	}
+
+	_, ok := d.keys[hex.EncodeToString(identity.PublicKey)]
+	return ok
+}
+
+var _ Denylist = &MemoryDenylist{}
@@ -0,0 +1,57 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"berty.tech/go-ipfs-log/errmsg"
+	"github.com/pkg/errors"
+)
+
+// EncryptionProvider encrypts and decrypts the payload of entries
+type EncryptionProvider interface {
+	// Encrypt encrypts a payload and returns the ID of the key used
+	Encrypt(payload []byte) (keyID string, encrypted []byte, err error)
+
+	// Decrypt decrypts a payload, errmsg.KeyNotFound is returned when
+	// the key isn't available
+	Decrypt(keyID string, encrypted []byte) ([]byte, error)
+}
+
+// IsOpaque returns true if the payload of the entry is encrypted with a
+// key that wasn't available
+func (e *Entry) IsOpaque() bool {
+	return e.PayloadKeyID != "" && len(e.Payload) == 0
+}
+
+// PayloadDecrypter is implemented by the entries whose payload can be
+// decrypted once fetched
+type PayloadDecrypter interface {
+	DecryptPayload(provider EncryptionProvider) error
+}
+
+// DecryptPayload decrypts the payload of the entry, see DecryptPayload
+func (e *Entry) DecryptPayload(provider EncryptionProvider) error {
+	return DecryptPayload(e, provider)
+}
+
+// DecryptPayload decrypts the payload of an entry, entries whose key is
+// unknown to the provider are left opaque
+func DecryptPayload(e *Entry, provider EncryptionProvider) error {
+	if provider == nil || !e.IsOpaque() || e.rawPayload == nil {
+		return nil
+	}
+
+	data, err := provider.Decrypt(e.PayloadKeyID, e.rawPayload)
+	if errors.Cause(err) == errmsg.KeyNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "unable to decrypt payload")
+	}
+
+	payload, err := decompressPayload(e.PayloadCompression, data)
+	if err != nil {
+		return errors.Wrap(err, "unable to decompress payload")
+	}
+
+	e.Payload = payload
+
+	return nil
+}
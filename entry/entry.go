@@ -1,23 +1,23 @@
 package entry // import "berty.tech/go-ipfs-log/entry"
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"math"
 	"sort"
 	"time"
 
+	"berty.tech/go-ipfs-log/errmsg"
 	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/hlc"
 	"berty.tech/go-ipfs-log/utils/lamportclock"
+	"berty.tech/go-ipfs-log/utils/vectorclock"
 	cid "github.com/ipfs/go-cid"
-	cbornode "github.com/ipfs/go-ipld-cbor"
-	ic "github.com/libp2p/go-libp2p-crypto"
 	"github.com/pkg/errors"
-	_ "github.com/polydawn/refmt"
-	"github.com/polydawn/refmt/obj/atlas"
 )
 
 type Entry struct {
@@ -30,38 +30,91 @@ type Entry struct {
 	Identity *identityprovider.Identity
 	Hash     cid.Cid
 	Clock    *lamportclock.LamportClock
+	Metadata map[string]string
+
+	// PayloadCodec is the name of the codec used to encode the payload
+	PayloadCodec string
+
+	// PayloadRef is the CID of the payload when it is stored in its own
+	// blocks instead of inline
+	PayloadRef cid.Cid
+
+	// PayloadCompression is the algorithm used to compress the payload
+	PayloadCompression string
+
+	// PayloadKeyID is the ID of the key used to encrypt the payload
+	PayloadKeyID string
+
+	// ClockType is the type of the clock carried by the entry in addition
+	// to its Lamport clock, empty for Lamport clocks only
+	ClockType string
+
+	// VectorClock is the vector clock of the entry when ClockType is
+	// vectorclock.Type
+	VectorClock vectorclock.VectorClock
+
+	// HLC is the hybrid logical clock timestamp of the entry when
+	// ClockType is hlc.Type
+	HLC *hlc.Timestamp
+
+	// Timestamp is the wall time at which the entry was written as a Unix
+	// time in milliseconds, it is advisory only and never used for ordering
+	Timestamp int64
+
+	// CoSignatures are the signatures of other keys over the signed data
+	// of the entry, see SignedKeys
+	CoSignatures []*CoSignature
+
+	// rawPayload is the payload as stored when it differs from Payload
+	rawPayload []byte
+
+	// encoding is the IPLD format of the entry block, dag-cbor when empty
+	encoding string
+
+	// prefix holds the CID version and hash function of the entry block,
+	// io.DefaultPrefix is used when unset
+	prefix *cid.Prefix
 }
 
 type EntryToHash struct {
-	Hash    interface{}
-	ID      string
-	Payload []byte
-	Next    []string
-	V       uint64
-	Clock   *lamportclock.LamportClock
-	Key     []byte
-}
-
-var AtlasEntryToHash = atlas.BuildEntry(EntryToHash{}).
-	StructMap().
-	AddField("Hash", atlas.StructMapEntry{SerialName: "hash"}).
-	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
-	AddField("Payload", atlas.StructMapEntry{SerialName: "payload"}).
-	AddField("Next", atlas.StructMapEntry{SerialName: "next"}).
-	AddField("V", atlas.StructMapEntry{SerialName: "v"}).
-	AddField("Clock", atlas.StructMapEntry{SerialName: "clock"}).
-	Complete()
+	Hash               interface{}
+	ID                 string
+	Payload            []byte
+	Next               []string
+	V                  uint64
+	Clock              *lamportclock.LamportClock
+	Key                []byte
+	Metadata           map[string]string
+	PayloadCodec       string
+	PayloadRef         string
+	PayloadCompression string
+	PayloadKeyID       string
+	ClockType          string
+	VectorClock        map[string]int
+	HLC                *hlc.Timestamp
+	Timestamp          int64
+}
 
 type CborEntry struct {
-	V        uint64
-	LogID    string
-	Key      string
-	Sig      string
-	Hash     interface{}
-	Next     []cid.Cid
-	Clock    *lamportclock.CborLamportClock
-	Payload  string
-	Identity *identityprovider.CborIdentity
+	V                  uint64
+	LogID              string
+	Key                string
+	Sig                string
+	Hash               interface{}
+	Next               []cid.Cid
+	Clock              *lamportclock.CborLamportClock
+	Payload            string
+	Identity           *identityprovider.CborIdentity
+	Metadata           map[string]string
+	PayloadCodec       string
+	PayloadRef         *cid.Cid
+	PayloadCompression string
+	PayloadKeyID       string
+	ClockType          string
+	VectorClock        map[string]int
+	HLC                *hlc.Timestamp
+	Timestamp          int64
+	CoSignatures       []*CborCoSignature
 }
 
 func (c *CborEntry) ToEntry(provider identityprovider.Interface) (*Entry, error) {
@@ -85,50 +138,119 @@ func (c *CborEntry) ToEntry(provider identityprovider.Interface) (*Entry, error)
 		return nil, err
 	}
 
-	return &Entry{
-		V:        c.V,
-		LogID:    c.LogID,
-		Key:      key,
-		Sig:      sig,
-		Next:     c.Next,
-		Clock:    clock,
-		Payload:  []byte(c.Payload),
-		Identity: identity,
-	}, nil
+	e := &Entry{
+		V:                  c.V,
+		LogID:              c.LogID,
+		Key:                key,
+		Sig:                sig,
+		Next:               c.Next,
+		Clock:              clock,
+		Identity:           identity,
+		Metadata:           c.Metadata,
+		PayloadCodec:       c.PayloadCodec,
+		PayloadCompression: c.PayloadCompression,
+		PayloadKeyID:       c.PayloadKeyID,
+		ClockType:          c.ClockType,
+		VectorClock:        c.VectorClock,
+		HLC:                c.HLC,
+		Timestamp:          c.Timestamp,
+	}
+
+	if c.PayloadRef != nil {
+		e.PayloadRef = *c.PayloadRef
+	}
+
+	for _, s := range c.CoSignatures {
+		coSignature, err := s.ToCoSignature()
+		if err != nil {
+			return nil, err
+		}
+
+		e.CoSignatures = append(e.CoSignatures, coSignature)
+	}
+
+	// The payload is converted once, decoded payloads share this slice
+	if err := e.setRawPayload([]byte(c.Payload)); err != nil {
+		return nil, err
+	}
+
+	return e, nil
 }
 
+// ToCborEntry returns the serializable form of the entry, payloads stored
+// externally are only referenced by their CID
 func (e *Entry) ToCborEntry() *CborEntry {
-	return &CborEntry{
-		V:        e.V,
-		LogID:    e.LogID,
-		Key:      hex.EncodeToString(e.Key),
-		Sig:      hex.EncodeToString(e.Sig),
-		Hash:     nil,
-		Next:     e.Next,
-		Clock:    e.Clock.ToCborLamportClock(),
-		Payload:  string(e.Payload),
-		Identity: e.Identity.ToCborIdentity(),
-	}
-}
-
-func init() {
-	AtlasEntry := atlas.BuildEntry(CborEntry{}).
-		StructMap().
-		AddField("V", atlas.StructMapEntry{SerialName: "v"}).
-		AddField("LogID", atlas.StructMapEntry{SerialName: "id"}).
-		AddField("Key", atlas.StructMapEntry{SerialName: "key"}).
-		AddField("Sig", atlas.StructMapEntry{SerialName: "sig"}).
-		AddField("Hash", atlas.StructMapEntry{SerialName: "hash"}).
-		AddField("Next", atlas.StructMapEntry{SerialName: "next"}).
-		AddField("Clock", atlas.StructMapEntry{SerialName: "clock"}).
-		AddField("Payload", atlas.StructMapEntry{SerialName: "payload"}).
-		AddField("Identity", atlas.StructMapEntry{SerialName: "identity"}).
-		Complete()
-
-	cbornode.RegisterCborType(AtlasEntry)
-}
-
-func CreateEntry(ipfsInstance *io.IpfsServices, identity *identityprovider.Identity, data *Entry, clock *lamportclock.LamportClock) (*Entry, error) {
+	c := &CborEntry{
+		V:                  e.V,
+		LogID:              e.LogID,
+		Key:                hex.EncodeToString(e.Key),
+		Sig:                hex.EncodeToString(e.Sig),
+		Hash:               nil,
+		Next:               e.Next,
+		Clock:              e.Clock.ToCborLamportClock(),
+		Identity:           e.Identity.ToCborIdentity(),
+		Metadata:           e.Metadata,
+		PayloadCodec:       e.PayloadCodec,
+		PayloadCompression: e.PayloadCompression,
+		PayloadKeyID:       e.PayloadKeyID,
+		ClockType:          e.ClockType,
+		VectorClock:        e.VectorClock,
+		HLC:                e.HLC,
+		Timestamp:          e.Timestamp,
+	}
+
+	if e.PayloadRef.Defined() {
+		ref := e.PayloadRef
+		c.PayloadRef = &ref
+	} else {
+		c.Payload = string(e.storedPayload())
+	}
+
+	for _, s := range e.CoSignatures {
+		c.CoSignatures = append(c.CoSignatures, s.ToCborCoSignature())
+	}
+
+	return c
+}
+
+// CreateEntryOptions defines the options used when creating an entry
+type CreateEntryOptions struct {
+	// PayloadThreshold is the size in bytes above which the payload is
+	// stored in its own blocks, 0 keeps all payloads inline
+	PayloadThreshold int
+
+	// Compression is the algorithm used to compress the payload
+	Compression string
+
+	// Encryption encrypts the payload, it is stored in clear when nil
+	Encryption EncryptionProvider
+
+	// Encoding is the IPLD format of the entry, EncodingDagCBOR when
+	// empty
+	Encoding string
+
+	// CIDPrefix sets the CID version and hash function of the entry,
+	// io.DefaultPrefix is used when nil
+	CIDPrefix *cid.Prefix
+
+	// Signer signs the entry instead of the identity provider, its key
+	// must belong to the identity
+	Signer identityprovider.Signer
+
+	// CoSigners add their signature of the entry, see SignedKeys
+	CoSigners []identityprovider.Signer
+}
+
+func CreateEntry(ipfsInstance io.IpfsServices, identity *identityprovider.Identity, data *Entry, clock *lamportclock.LamportClock) (*Entry, error) {
+	return CreateEntryWithOptions(ipfsInstance, identity, data, clock, nil)
+}
+
+// CreateEntryWithOptions creates and stores a signed entry
+func CreateEntryWithOptions(ipfsInstance io.IpfsServices, identity *identityprovider.Identity, data *Entry, clock *lamportclock.LamportClock, opts *CreateEntryOptions) (*Entry, error) {
+	if opts == nil {
+		opts = &CreateEntryOptions{}
+	}
+
 	if ipfsInstance == nil {
 		return nil, errors.New("ipfs instance not defined")
 	}
@@ -152,34 +274,81 @@ func CreateEntry(ipfsInstance *io.IpfsServices, identity *identityprovider.Ident
 	data = data.Copy()
 	data.Clock = clock
 	data.V = 1
+	data.PayloadCompression = opts.Compression
 
-	jsonBytes, err := ToBuffer(data.ToHashable())
-	if err != nil {
-		return nil, err
+	switch opts.Encoding {
+	case "", EncodingDagCBOR:
+	case EncodingDagJSON:
+		data.encoding = EncodingDagJSON
+	default:
+		return nil, errors.Errorf("unsupported entry encoding: %s", opts.Encoding)
 	}
 
-	signature, err := identity.Provider.Sign(identity, jsonBytes)
+	data.prefix = opts.CIDPrefix
 
+	stored, err := compressPayload(data.PayloadCompression, data.Payload)
 	if err != nil {
 		return nil, err
 	}
 
-	data.Key = identity.PublicKey
-	data.Sig = signature
+	if opts.Encryption != nil {
+		data.PayloadKeyID, stored, err = opts.Encryption.Encrypt(stored)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encrypt payload")
+		}
+	}
 
-	data.Identity = identity.Filtered()
-	data.Hash, err = ToMultihash(ipfsInstance, data)
+	if opts.PayloadThreshold > 0 && len(stored) > opts.PayloadThreshold {
+		data.PayloadRef, err = io.WritePayload(ipfsInstance, stored)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to store payload")
+		}
+	}
+
+	if data.PayloadCompression != CompressionNone || data.PayloadKeyID != "" {
+		data.rawPayload = stored
+	}
+
+	jsonBytes, err := ToBuffer(data.ToHashable())
 	if err != nil {
 		return nil, err
 	}
 
-	nd, err := cbornode.WrapObject(data.ToCborEntry(), math.MaxUint64, -1)
+	data.Key = identity.SigningKey()
+
+	var signature []byte
+	if opts.Signer != nil {
+		if data.Key, err = identityprovider.SignerPublicKey(opts.Signer); err != nil {
+			return nil, err
+		}
+
+		signature, err = opts.Signer.Sign(context.Background(), jsonBytes)
+	} else {
+		signature, err = identity.Provider.Sign(identity, jsonBytes)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*5)
-	err = ipfsInstance.DAG.Add(ctx, nd)
+	data.Sig = signature
+
+	for _, s := range opts.CoSigners {
+		key, err := identityprovider.SignerPublicKey(s)
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := s.Sign(context.Background(), jsonBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to co-sign entry")
+		}
+
+		data.CoSignatures = append(data.CoSignatures, &CoSignature{Key: key, Sig: sig})
+	}
+
+	data.Identity = identity.Filtered()
+	data.Hash, err = ToMultihash(ipfsInstance, data)
 	if err != nil {
 		return nil, err
 	}
@@ -189,16 +358,165 @@ func CreateEntry(ipfsInstance *io.IpfsServices, identity *identityprovider.Ident
 
 func (e *Entry) Copy() *Entry {
 	return &Entry{
-		Payload:  e.Payload,
-		LogID:    e.LogID,
-		Next:     uniqueCIDs(e.Next),
-		V:        e.V,
-		Key:      e.Key,
-		Sig:      e.Sig,
-		Identity: e.Identity,
-		Hash:     e.Hash,
-		Clock:    e.Clock,
+		Payload:            e.Payload,
+		LogID:              e.LogID,
+		Next:               uniqueCIDs(e.Next),
+		V:                  e.V,
+		Key:                e.Key,
+		Sig:                e.Sig,
+		Identity:           e.Identity,
+		Hash:               e.Hash,
+		Clock:              e.Clock,
+		Metadata:           e.Metadata,
+		PayloadCodec:       e.PayloadCodec,
+		PayloadRef:         e.PayloadRef,
+		PayloadCompression: e.PayloadCompression,
+		PayloadKeyID:       e.PayloadKeyID,
+		ClockType:          e.ClockType,
+		VectorClock:        e.VectorClock,
+		HLC:                e.HLC,
+		Timestamp:          e.Timestamp,
+		CoSignatures:       e.CoSignatures,
+		rawPayload:         e.rawPayload,
+		encoding:           e.encoding,
+		prefix:             e.prefix,
+	}
+}
+
+func (e *Entry) GetLogID() string {
+	return e.LogID
+}
+
+// GetPayload returns the payload without copying it, it is shared with the
+// copies of the entry and must be treated as read-only, see CopyPayload
+func (e *Entry) GetPayload() []byte {
+	return e.Payload
+}
+
+// CopyPayload returns a copy of the payload the caller owns
+func (e *Entry) CopyPayload() []byte {
+	if e.Payload == nil {
+		return nil
+	}
+
+	return append([]byte{}, e.Payload...)
+}
+
+func (e *Entry) GetNext() []cid.Cid {
+	return e.Next
+}
+
+func (e *Entry) GetV() uint64 {
+	return e.V
+}
+
+func (e *Entry) GetKey() []byte {
+	return e.Key
+}
+
+func (e *Entry) GetSig() []byte {
+	return e.Sig
+}
+
+func (e *Entry) GetIdentity() *identityprovider.Identity {
+	return e.Identity
+}
+
+func (e *Entry) GetHash() cid.Cid {
+	return e.Hash
+}
+
+func (e *Entry) GetClock() *lamportclock.LamportClock {
+	return e.Clock
+}
+
+func (e *Entry) GetMetadata() map[string]string {
+	return e.Metadata
+}
+
+func (e *Entry) GetPayloadCodec() string {
+	return e.PayloadCodec
+}
+
+func (e *Entry) GetPayloadRef() cid.Cid {
+	return e.PayloadRef
+}
+
+func (e *Entry) GetPayloadCompression() string {
+	return e.PayloadCompression
+}
+
+func (e *Entry) GetClockType() string {
+	return e.ClockType
+}
+
+func (e *Entry) GetVectorClock() vectorclock.VectorClock {
+	return e.VectorClock
+}
+
+func (e *Entry) GetHLC() *hlc.Timestamp {
+	return e.HLC
+}
+
+// GetTimestamp returns the wall time at which the entry was written, zero
+// when it was not recorded
+func (e *Entry) GetTimestamp() time.Time {
+	if e.Timestamp == 0 {
+		return time.Time{}
 	}
+
+	return time.Unix(0, e.Timestamp*int64(time.Millisecond))
+}
+
+// GetEncoding returns the IPLD format of the entry block
+func (e *Entry) GetEncoding() string {
+	if e.encoding == "" {
+		return EncodingDagCBOR
+	}
+
+	return e.encoding
+}
+
+func (e *Entry) GetPayloadKeyID() string {
+	return e.PayloadKeyID
+}
+
+// storedPayload returns the payload as it is stored in IPFS
+func (e *Entry) storedPayload() []byte {
+	if e.rawPayload != nil {
+		return e.rawPayload
+	}
+
+	return e.Payload
+}
+
+// setRawPayload sets the payload from its stored form
+func (e *Entry) setRawPayload(data []byte) error {
+	if len(data) > 0 && e.PayloadKeyID != "" {
+		// Encrypted payloads are decoded by DecryptPayload
+		e.Payload = nil
+		e.rawPayload = data
+		return nil
+	}
+
+	if e.PayloadCompression == CompressionNone || len(data) == 0 {
+		e.Payload = data
+		return nil
+	}
+
+	payload, err := decompressPayload(e.PayloadCompression, data)
+	if err != nil {
+		return errors.Wrap(err, "unable to decompress payload")
+	}
+
+	e.Payload = payload
+	e.rawPayload = data
+
+	return nil
+}
+
+func (e *Entry) SetHash(hash cid.Cid) {
+	e.Hash = hash
 }
 
 func uniqueCIDs(cids []cid.Cid) []cid.Cid {
@@ -222,7 +540,7 @@ func ToBuffer(e *EntryToHash) ([]byte, error) {
 		return nil, errors.New("entry is not defined")
 	}
 
-	jsonBytes, err := json.Marshal(map[string]interface{}{
+	data := map[string]interface{}{
 		"hash":    nil,
 		"id":      e.ID,
 		"payload": string(e.Payload),
@@ -232,34 +550,105 @@ func ToBuffer(e *EntryToHash) ([]byte, error) {
 			"id":   hex.EncodeToString(e.Clock.ID),
 			"time": e.Clock.Time,
 		},
-	})
-	if err != nil {
+	}
+
+	// Metadata is only signed when present to keep the signatures of
+	// entries without metadata unchanged
+	if len(e.Metadata) > 0 {
+		data["metadata"] = e.Metadata
+	}
+
+	if e.PayloadCodec != "" {
+		data["payloadCodec"] = e.PayloadCodec
+	}
+
+	if e.PayloadRef != "" {
+		data["payloadRef"] = e.PayloadRef
+	}
+
+	if e.PayloadCompression != "" {
+		data["payloadCompression"] = e.PayloadCompression
+	}
+
+	if e.PayloadKeyID != "" {
+		data["payloadKeyID"] = e.PayloadKeyID
+	}
+
+	if e.ClockType != "" {
+		data["clockType"] = e.ClockType
+	}
+
+	if len(e.VectorClock) > 0 {
+		data["vectorClock"] = e.VectorClock
+	}
+
+	if e.HLC != nil {
+		data["hlc"] = e.HLC
+	}
+
+	if e.Timestamp != 0 {
+		data["timestamp"] = e.Timestamp
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
 		return nil, err
 	}
 
-	return jsonBytes, nil
+	// Encode terminates the value with a newline json.Marshal doesn't add,
+	// the signed bytes must stay the same
+	return append([]byte(nil), bytes.TrimSuffix(buf.Bytes(), []byte("\n"))...), nil
 }
 
 func (e *Entry) ToHashable() *EntryToHash {
 	nexts := []string{}
 
 	for _, n := range e.Next {
-		nexts = append(nexts, n.String())
+		nexts = append(nexts, io.CIDString(n))
+	}
+
+	h := &EntryToHash{
+		Hash:               nil,
+		ID:                 e.LogID,
+		Payload:            e.Payload,
+		Next:               nexts,
+		V:                  e.V,
+		Clock:              e.Clock,
+		Key:                e.Key,
+		Metadata:           e.Metadata,
+		PayloadCodec:       e.PayloadCodec,
+		PayloadCompression: e.PayloadCompression,
+		PayloadKeyID:       e.PayloadKeyID,
+		ClockType:          e.ClockType,
+		VectorClock:        e.VectorClock,
+		HLC:                e.HLC,
+		Timestamp:          e.Timestamp,
+	}
+
+	// Encrypted payloads are signed in their encrypted form so entries
+	// can be verified without the key
+	if e.PayloadKeyID != "" {
+		h.Payload = e.rawPayload
 	}
 
-	return &EntryToHash{
-		Hash:    nil,
-		ID:      e.LogID,
-		Payload: e.Payload,
-		Next:    nexts,
-		V:       e.V,
-		Clock:   e.Clock,
-		Key:     e.Key,
+	// External payloads are signed through their reference
+	if e.PayloadRef.Defined() {
+		h.Payload = nil
+		h.PayloadRef = io.CIDString(e.PayloadRef)
 	}
+
+	return h
 }
 
 func (e *Entry) IsValid() bool {
-	return e.LogID != "" && len(e.Payload) > 0 && e.V >= 0 && e.V <= 1
+	return e.LogID != "" && (len(e.storedPayload()) > 0 || e.PayloadRef.Defined()) && e.V >= 0 && e.V <= 1
+}
+
+// Verify checks the signature of the entry
+func (e *Entry) Verify(identity identityprovider.Interface) error {
+	return Verify(identity, e)
 }
 
 func Verify(identity identityprovider.Interface, entry *Entry) error {
@@ -268,11 +657,11 @@ func Verify(identity identityprovider.Interface, entry *Entry) error {
 	}
 
 	if len(entry.Key) == 0 {
-		return errors.New("Entry doesn't have a key")
+		return errors.Wrap(errmsg.MalformedEntry, "Entry doesn't have a key")
 	}
 
 	if len(entry.Sig) == 0 {
-		return errors.New("Entry doesn't have a signature")
+		return errors.Wrap(errmsg.MalformedEntry, "Entry doesn't have a signature")
 	}
 
 	// TODO: Check against trusted keys
@@ -282,24 +671,33 @@ func Verify(identity identityprovider.Interface, entry *Entry) error {
 		return errors.Wrap(err, "unable to build string buffer")
 	}
 
-	pubKey, err := ic.UnmarshalSecp256k1PublicKey(entry.Key)
+	cache := VerificationCacheFor(identity)
+	if cache != nil && entry.Hash.Defined() && cache.Has(entry.Hash, jsonBytes, entry.Key, entry.Sig) {
+		return nil
+	}
+
+	pubKey, err := identityprovider.UnmarshalPublicKey(entry.Key)
 	if err != nil {
-		return errors.Wrap(err, "unable to unmarshal public key")
+		return errors.Wrapf(errmsg.MalformedEntry, "unable to unmarshal public key: %s", err)
 	}
 
 	ok, err := pubKey.Verify(jsonBytes, entry.Sig)
 	if err != nil {
-		return errors.Wrap(err, "error whild verifying signature")
+		return errors.Wrapf(errmsg.BadSignature, "error whild verifying signature: %s", err)
 	}
 
 	if !ok {
-		return errors.New("unable to verify entry signature")
+		return errors.Wrap(errmsg.BadSignature, "unable to verify entry signature")
+	}
+
+	if cache != nil && entry.Hash.Defined() {
+		cache.Add(entry.Hash, jsonBytes, entry.Key, entry.Sig)
 	}
 
 	return nil
 }
 
-func ToMultihash(ipfsInstance *io.IpfsServices, entry *Entry) (cid.Cid, error) {
+func ToMultihash(ipfsInstance io.IpfsServices, entry *Entry) (cid.Cid, error) {
 	if entry == nil {
 		return cid.Cid{}, errors.New("entry is not defined")
 	}
@@ -309,12 +707,25 @@ func ToMultihash(ipfsInstance *io.IpfsServices, entry *Entry) (cid.Cid, error) {
 	}
 
 	e := &Entry{
-		Hash:    cid.Cid{},
-		LogID:   entry.LogID,
-		Payload: entry.Payload,
-		Next:    entry.Next,
-		V:       entry.V,
-		Clock:   entry.Clock,
+		Hash:               cid.Cid{},
+		LogID:              entry.LogID,
+		Payload:            entry.Payload,
+		Next:               entry.Next,
+		V:                  entry.V,
+		Clock:              entry.Clock,
+		Metadata:           entry.Metadata,
+		PayloadCodec:       entry.PayloadCodec,
+		PayloadRef:         entry.PayloadRef,
+		PayloadCompression: entry.PayloadCompression,
+		PayloadKeyID:       entry.PayloadKeyID,
+		ClockType:          entry.ClockType,
+		VectorClock:        entry.VectorClock,
+		HLC:                entry.HLC,
+		Timestamp:          entry.Timestamp,
+		CoSignatures:       entry.CoSignatures,
+		rawPayload:         entry.rawPayload,
+		encoding:           entry.encoding,
+		prefix:             entry.prefix,
 	}
 
 	if entry.Key != nil {
@@ -329,24 +740,90 @@ func ToMultihash(ipfsInstance *io.IpfsServices, entry *Entry) (cid.Cid, error) {
 		e.Sig = entry.Sig
 	}
 
-	entryCID, err := io.WriteCBOR(ipfsInstance, e.ToCborEntry())
+	prefix := io.DefaultPrefix
+	if e.prefix != nil {
+		prefix = *e.prefix
+	}
+
+	if e.encoding == EncodingDagJSON {
+		data, err := marshalDagJSON(e.ToCborEntry())
+		if err != nil {
+			return cid.Cid{}, err
+		}
+
+		return io.WriteDagJSON(ipfsInstance, data, prefix)
+	}
+
+	data, err := e.ToCborEntry().MarshalCBOR()
+	if err != nil {
+		return cid.Cid{}, err
+	}
 
-	return entryCID, err
+	return io.WriteRawCBOR(ipfsInstance, data, prefix)
 }
 
-func FromMultihash(ipfs *io.IpfsServices, hash cid.Cid, provider identityprovider.Interface) (*Entry, error) {
+func FromMultihash(ipfs io.IpfsServices, hash cid.Cid, provider identityprovider.Interface) (*Entry, error) {
+	return FromMultihashContext(context.Background(), ipfs, hash, provider)
+}
+
+// FromMultihashContext fetches an entry and its payload, fetching is
+// canceled with the context
+func FromMultihashContext(ctx context.Context, ipfs io.IpfsServices, hash cid.Cid, provider identityprovider.Interface) (*Entry, error) {
 	if ipfs == nil {
 		return nil, errors.New("ipfs instance not defined")
 	}
 
-	result, err := io.ReadCBOR(ipfs, hash)
+	result, err := io.ReadCBORContext(ctx, ipfs, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := FromRawData(result.RawData(), hash, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ResolvePayloadContext(ctx, ipfs, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ResolvePayload fetches the payload of an entry when it is stored in its
+// own blocks
+func ResolvePayload(ipfs io.IpfsServices, e *Entry) error {
+	return ResolvePayloadContext(context.Background(), ipfs, e)
+}
+
+// ResolvePayloadContext fetches the payload of an entry when it is stored
+// in its own blocks, fetching is canceled with the context
+func ResolvePayloadContext(ctx context.Context, ipfs io.IpfsServices, e *Entry) error {
+	if !e.PayloadRef.Defined() || len(e.Payload) > 0 || e.rawPayload != nil {
+		return nil
+	}
+
+	payload, err := io.ReadPayloadContext(ctx, ipfs, e.PayloadRef, DefaultDecodeLimits.MaxPayloadSize)
 	if err != nil {
+		return errors.Wrap(err, "unable to fetch payload")
+	}
+
+	return e.setRawPayload(payload)
+}
+
+// FromRawData decodes an entry from the raw data of its block
+func FromRawData(data []byte, hash cid.Cid, provider identityprovider.Interface) (*Entry, error) {
+	limits := DefaultDecodeLimits
+	if err := limits.checkSize(len(data)); err != nil {
 		return nil, err
 	}
 
-	obj := &CborEntry{}
-	err = cbornode.DecodeInto(result.RawData(), obj)
+	obj, err := decodeCborEntry(data, hash)
 	if err != nil {
+		return nil, errors.Wrap(errmsg.MalformedEntry, err.Error())
+	}
+
+	if err := limits.checkFields(obj); err != nil {
 		return nil, err
 	}
 
@@ -357,10 +834,52 @@ func FromMultihash(ipfs *io.IpfsServices, hash cid.Cid, provider identityprovide
 		return nil, err
 	}
 
+	entry.Hash = hash
+
+	if hash.Type() == io.DagJSON {
+		entry.encoding = EncodingDagJSON
+	}
+
+	if prefix := hash.Prefix(); prefix.Version == 1 {
+		entry.prefix = &prefix
+	}
+
 	return entry, nil
 }
 
-func Sort(compFunc func(a, b *Entry) (int, error), values []*Entry) {
+// RawDataMarshaler is implemented by the entries able to encode themselves
+// in a form FromRawData decodes, see ToRawData
+type RawDataMarshaler interface {
+	MarshalRawData() ([]byte, error)
+}
+
+// ToRawData encodes an entry so it can be decoded by FromRawData, the entry
+// must implement RawDataMarshaler
+func ToRawData(e iface.IPFSLogEntry) ([]byte, error) {
+	if e == nil {
+		return nil, errors.New("entry is not defined")
+	}
+
+	m, ok := e.(RawDataMarshaler)
+	if !ok {
+		return nil, errors.Errorf("unsupported entry type %T", e)
+	}
+
+	return m.MarshalRawData()
+}
+
+// MarshalRawData encodes the entry for ToRawData, external payloads are
+// kept inline so the entry doesn't need to be resolved again
+func (e *Entry) MarshalRawData() ([]byte, error) {
+	c := e.ToCborEntry()
+	if e.PayloadRef.Defined() {
+		c.Payload = string(e.storedPayload())
+	}
+
+	return encodeCborEntry(e.encoding, c)
+}
+
+func Sort(compFunc func(a, b iface.IPFSLogEntry) (int, error), values []iface.IPFSLogEntry) {
 	sort.SliceStable(values, func(i, j int) bool {
 		ret, err := compFunc(values[i], values[j])
 		if err != nil {
@@ -371,22 +890,22 @@ func Sort(compFunc func(a, b *Entry) (int, error), values []*Entry) {
 	})
 }
 
-func Compare(a, b *Entry) (int, error) {
+func Compare(a, b iface.IPFSLogEntry) (int, error) {
 	// TODO: Make it a Golang slice-compatible sort function
 	if a == nil || b == nil {
 		return 0, errors.New("entry is not defined")
 	}
 
-	return lamportclock.Compare(a.Clock, b.Clock), nil
+	return lamportclock.Compare(a.GetClock(), b.GetClock()), nil
 }
 
-func IsEqual(a, b *Entry) bool {
-	return a.Hash.String() == b.Hash.String()
+func IsEqual(a, b iface.IPFSLogEntry) bool {
+	return a.GetHash().String() == b.GetHash().String()
 }
 
-func IsParent(entry1, entry2 *Entry) bool {
-	for _, next := range entry2.Next {
-		if next.String() == entry1.Hash.String() {
+func IsParent(entry1, entry2 iface.IPFSLogEntry) bool {
+	for _, next := range entry2.GetNext() {
+		if next.String() == entry1.GetHash().String() {
 			return true
 		}
 	}
@@ -394,10 +913,10 @@ func IsParent(entry1, entry2 *Entry) bool {
 	return false
 }
 
-func FindChildren(entry *Entry, values []*Entry) []*Entry {
-	stack := []*Entry{}
+func FindChildren(entry iface.IPFSLogEntry, values []iface.IPFSLogEntry) []iface.IPFSLogEntry {
+	stack := []iface.IPFSLogEntry{}
 
-	var parent *Entry
+	var parent iface.IPFSLogEntry
 	for _, e := range values {
 		if IsParent(entry, e) {
 			parent = e
@@ -421,8 +940,10 @@ func FindChildren(entry *Entry, values []*Entry) []*Entry {
 	}
 
 	sort.SliceStable(stack, func(i, j int) bool {
-		return stack[i].Clock.Time <= stack[j].Clock.Time
+		return stack[i].GetClock().Time <= stack[j].GetClock().Time
 	})
 
 	return stack
 }
+
+var _ iface.IPFSLogEntry = &Entry{}
@@ -0,0 +1,595 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+	"math"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/shared"
+	"github.com/polydawn/refmt/tok"
+)
+
+// The entries are built as IPLD data model nodes and encoded with the
+// dag-cbor codec of go-ipld-prime, which sorts map keys as canonical CBOR
+// requires. Decoding is strict, unknown fields and values of an unexpected
+// kind are rejected.
+
+var (
+	errUnexpectedCBOR = errors.New("unexpected CBOR")
+	errUndefinedLink  = errors.New("undefined CID")
+	errEntryHash      = errors.New("the hash of an entry isn't encoded")
+)
+
+// MarshalCBOR encodes the entry as canonical dag-cbor
+func (c *CborEntry) MarshalCBOR() ([]byte, error) {
+	nd, err := c.ToNode()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	sink := &versionSink{sink: cbor.NewEncoder(buf)}
+	if err := dagcbor.Marshal(nd, sink, dagcbor.EncodeOptions{AllowLinks: true, MapSortMode: codec.MapSortMode_RFC7049}); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+
+	return data, nil
+}
+
+// UnmarshalCBOR decodes an entry encoded as dag-cbor
+func (c *CborEntry) UnmarshalCBOR(data []byte) error {
+	r := bytes.NewReader(data)
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	source := &versionSource{source: cbor.NewDecoder(cbor.DecodeOptions{}, r)}
+	if err := dagcbor.Unmarshal(nb, source, dagcbor.DecodeOptions{AllowLinks: true}); err != nil {
+		return err
+	}
+
+	if r.Len() > 0 {
+		return errors.Errorf("%d bytes of trailing data", r.Len())
+	}
+
+	decoded, err := CborEntryFromNode(nb.Build())
+	if err != nil {
+		return err
+	}
+
+	*c = *decoded
+
+	return nil
+}
+
+// The data model has no unsigned integers, the node of an entry holds its
+// version as the int64 having the same bits. versionSink encodes it as an
+// unsigned integer and versionSource decodes it back.
+
+type versionSink struct {
+	sink   shared.TokenSink
+	tokens cborTokens
+}
+
+func (s *versionSink) Step(tk *tok.Token) (bool, error) {
+	key, depth, err := s.tokens.step(tk)
+	if err != nil {
+		return false, err
+	}
+
+	if depth == 1 && key == "v" && tk.Type == tok.TInt {
+		v := *tk
+		v.Type, v.Uint = tok.TUint, uint64(tk.Int)
+		return s.sink.Step(&v)
+	}
+
+	return s.sink.Step(tk)
+}
+
+type versionSource struct {
+	source shared.TokenSource
+	tokens cborTokens
+}
+
+func (s *versionSource) Step(tk *tok.Token) (bool, error) {
+	done, err := s.source.Step(tk)
+	if err != nil {
+		return done, err
+	}
+
+	key, depth, err := s.tokens.step(tk)
+	if err != nil {
+		return done, err
+	}
+
+	if depth == 1 && key == "v" {
+		switch tk.Type {
+		case tok.TUint:
+			tk.Type, tk.Int = tok.TInt, int64(tk.Uint)
+		case tok.TInt:
+			return done, errUnexpectedCBOR
+		}
+	}
+
+	return done, nil
+}
+
+// ToNode returns the entry as an IPLD node, empty optional fields are
+// omitted and the version is held as the int64 having the same bits
+func (c *CborEntry) ToNode() (datamodel.Node, error) {
+	if c.Hash != nil {
+		return nil, errEntryHash
+	}
+
+	return qp.BuildMap(basicnode.Prototype.Map, -1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "v", qp.Int(int64(c.V)))
+		qp.MapEntry(ma, "id", qp.String(c.LogID))
+		qp.MapEntry(ma, "key", qp.String(c.Key))
+		qp.MapEntry(ma, "sig", qp.String(c.Sig))
+		qp.MapEntry(ma, "hash", qp.Null())
+
+		if c.Next == nil {
+			qp.MapEntry(ma, "next", qp.Null())
+		} else {
+			qp.MapEntry(ma, "next", qp.List(int64(len(c.Next)), func(la datamodel.ListAssembler) {
+				for _, n := range c.Next {
+					qp.ListEntry(la, linkNode(n))
+				}
+			}))
+		}
+
+		qp.MapEntry(ma, "clock", clockNode(c.Clock))
+		qp.MapEntry(ma, "payload", qp.String(c.Payload))
+		qp.MapEntry(ma, "identity", identityNode(c.Identity))
+
+		if c.HLC != nil {
+			qp.MapEntry(ma, "hlc", qp.Map(2, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "wall", qp.Int(c.HLC.Wall))
+				qp.MapEntry(ma, "logical", qp.Int(int64(c.HLC.Logical)))
+			}))
+		}
+
+		if len(c.Metadata) > 0 {
+			qp.MapEntry(ma, "metadata", qp.Map(int64(len(c.Metadata)), func(ma datamodel.MapAssembler) {
+				for k, v := range c.Metadata {
+					qp.MapEntry(ma, k, qp.String(v))
+				}
+			}))
+		}
+
+		if c.ClockType != "" {
+			qp.MapEntry(ma, "clockType", qp.String(c.ClockType))
+		}
+
+		if c.Timestamp != 0 {
+			qp.MapEntry(ma, "timestamp", qp.Int(c.Timestamp))
+		}
+
+		if c.PayloadRef != nil {
+			qp.MapEntry(ma, "payloadRef", linkNode(*c.PayloadRef))
+		}
+
+		if len(c.VectorClock) > 0 {
+			qp.MapEntry(ma, "vectorClock", qp.Map(int64(len(c.VectorClock)), func(ma datamodel.MapAssembler) {
+				for k, v := range c.VectorClock {
+					qp.MapEntry(ma, k, qp.Int(int64(v)))
+				}
+			}))
+		}
+
+		if len(c.CoSignatures) > 0 {
+			qp.MapEntry(ma, "cosignatures", qp.List(int64(len(c.CoSignatures)), func(la datamodel.ListAssembler) {
+				for _, s := range c.CoSignatures {
+					if s == nil {
+						qp.ListEntry(la, qp.Null())
+						continue
+					}
+
+					qp.ListEntry(la, qp.Map(2, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "key", qp.String(s.Key))
+						qp.MapEntry(ma, "sig", qp.String(s.Sig))
+					}))
+				}
+			}))
+		}
+
+		if c.PayloadCodec != "" {
+			qp.MapEntry(ma, "payloadCodec", qp.String(c.PayloadCodec))
+		}
+
+		if c.PayloadKeyID != "" {
+			qp.MapEntry(ma, "payloadKeyID", qp.String(c.PayloadKeyID))
+		}
+
+		if c.PayloadCompression != "" {
+			qp.MapEntry(ma, "payloadCompression", qp.String(c.PayloadCompression))
+		}
+	})
+}
+
+func linkNode(c cid.Cid) qp.Assemble {
+	if !c.Defined() {
+		panic(errUndefinedLink)
+	}
+
+	return qp.Link(cidlink.Link{Cid: c})
+}
+
+func clockNode(c *lamportclock.CborLamportClock) qp.Assemble {
+	if c == nil {
+		return qp.Null()
+	}
+
+	return qp.Map(2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "id", qp.String(c.ID))
+		qp.MapEntry(ma, "time", qp.Int(int64(c.Time)))
+	})
+}
+
+func identityNode(i *identityprovider.CborIdentity) qp.Assemble {
+	if i == nil {
+		return qp.Null()
+	}
+
+	return qp.Map(-1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "id", qp.String(i.ID))
+		qp.MapEntry(ma, "type", qp.String(i.Type))
+		qp.MapEntry(ma, "publicKey", qp.String(i.PublicKey))
+
+		if i.Signatures == nil {
+			qp.MapEntry(ma, "signatures", qp.Null())
+		} else {
+			qp.MapEntry(ma, "signatures", qp.Map(2, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "id", qp.String(i.Signatures.ID))
+				qp.MapEntry(ma, "publicKey", qp.String(i.Signatures.PublicKey))
+			}))
+		}
+
+		if len(i.Rotations) > 0 {
+			qp.MapEntry(ma, "rotations", qp.List(int64(len(i.Rotations)), func(la datamodel.ListAssembler) {
+				for _, r := range i.Rotations {
+					if r == nil {
+						qp.ListEntry(la, qp.Null())
+						continue
+					}
+
+					qp.ListEntry(la, qp.Map(4, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "nextKey", qp.String(r.NextKey))
+						qp.MapEntry(ma, "previousKey", qp.String(r.PreviousKey))
+						qp.MapEntry(ma, "nextSignature", qp.String(r.NextSignature))
+						qp.MapEntry(ma, "previousSignature", qp.String(r.PreviousSignature))
+					}))
+				}
+			}))
+		}
+
+		if len(i.Delegations) > 0 {
+			qp.MapEntry(ma, "delegations", qp.List(int64(len(i.Delegations)), func(la datamodel.ListAssembler) {
+				for _, d := range i.Delegations {
+					if d == nil {
+						qp.ListEntry(la, qp.Null())
+						continue
+					}
+
+					qp.ListEntry(la, qp.Map(3, func(ma datamodel.MapAssembler) {
+						qp.MapEntry(ma, "issuer", qp.String(d.Issuer))
+						qp.MapEntry(ma, "delegate", qp.String(d.Delegate))
+						qp.MapEntry(ma, "signature", qp.String(d.Signature))
+					}))
+				}
+			}))
+		}
+	})
+}
+
+// fields calls fn for each entry of a map node
+func fields(nd datamodel.Node, fn func(key string, v datamodel.Node) error) error {
+	if nd.Kind() != datamodel.Kind_Map {
+		return errUnexpectedCBOR
+	}
+
+	for it := nd.MapIterator(); !it.Done(); {
+		k, v, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		key, err := k.AsString()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(key, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// items calls fn for each item of a list node
+func items(nd datamodel.Node, fn func(v datamodel.Node) error) error {
+	if nd.Kind() != datamodel.Kind_List {
+		return errUnexpectedCBOR
+	}
+
+	for it := nd.ListIterator(); !it.Done(); {
+		_, v, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func textField(nd datamodel.Node, v *string) (err error) {
+	*v, err = nd.AsString()
+	return err
+}
+
+func intField(nd datamodel.Node, v *int) error {
+	n, err := nd.AsInt()
+	if err != nil {
+		return err
+	}
+
+	if n < math.MinInt || n > math.MaxInt {
+		return errUnexpectedCBOR
+	}
+
+	*v = int(n)
+
+	return nil
+}
+
+func linkField(nd datamodel.Node) (cid.Cid, error) {
+	lnk, err := nd.AsLink()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	c, ok := lnk.(cidlink.Link)
+	if !ok {
+		return cid.Cid{}, errUnexpectedCBOR
+	}
+
+	return c.Cid, nil
+}
+
+func isNull(nd datamodel.Node) bool {
+	return nd.Kind() == datamodel.Kind_Null
+}
+
+// CborEntryFromNode returns the entry held by an IPLD node
+func CborEntryFromNode(nd datamodel.Node) (*CborEntry, error) {
+	c := &CborEntry{}
+
+	err := fields(nd, func(key string, v datamodel.Node) error {
+		var err error
+
+		switch key {
+		case "v":
+			var n int64
+			n, err = v.AsInt()
+			c.V = uint64(n)
+		case "id":
+			err = textField(v, &c.LogID)
+		case "hlc":
+			c.HLC = &hlc.Timestamp{}
+			err = fields(v, func(key string, v datamodel.Node) error {
+				switch key {
+				case "wall":
+					var err error
+					c.HLC.Wall, err = v.AsInt()
+					return err
+				case "logical":
+					return intField(v, &c.HLC.Logical)
+				}
+				return errUnexpectedCBOR
+			})
+		case "key":
+			err = textField(v, &c.Key)
+		case "sig":
+			err = textField(v, &c.Sig)
+		case "hash":
+			if !isNull(v) {
+				err = errUnexpectedCBOR
+			}
+		case "next":
+			if isNull(v) {
+				break
+			}
+
+			c.Next = []cid.Cid{}
+			err = items(v, func(v datamodel.Node) error {
+				n, err := linkField(v)
+				c.Next = append(c.Next, n)
+				return err
+			})
+		case "clock":
+			c.Clock, err = clockFromNode(v)
+		case "payload":
+			err = textField(v, &c.Payload)
+		case "identity":
+			c.Identity, err = identityFromNode(v)
+		case "metadata":
+			c.Metadata = map[string]string{}
+			err = fields(v, func(key string, v datamodel.Node) error {
+				s, err := v.AsString()
+				c.Metadata[key] = s
+				return err
+			})
+		case "clockType":
+			err = textField(v, &c.ClockType)
+		case "timestamp":
+			c.Timestamp, err = v.AsInt()
+		case "payloadRef":
+			var ref cid.Cid
+			ref, err = linkField(v)
+			c.PayloadRef = &ref
+		case "vectorClock":
+			c.VectorClock = map[string]int{}
+			err = fields(v, func(key string, v datamodel.Node) error {
+				var n int
+				err := intField(v, &n)
+				c.VectorClock[key] = n
+				return err
+			})
+		case "cosignatures":
+			c.CoSignatures = []*CborCoSignature{}
+			err = items(v, func(v datamodel.Node) error {
+				if isNull(v) {
+					c.CoSignatures = append(c.CoSignatures, nil)
+					return nil
+				}
+
+				s := &CborCoSignature{}
+				c.CoSignatures = append(c.CoSignatures, s)
+				return fields(v, func(key string, v datamodel.Node) error {
+					switch key {
+					case "key":
+						return textField(v, &s.Key)
+					case "sig":
+						return textField(v, &s.Sig)
+					}
+					return errUnexpectedCBOR
+				})
+			})
+		case "payloadCodec":
+			err = textField(v, &c.PayloadCodec)
+		case "payloadKeyID":
+			err = textField(v, &c.PayloadKeyID)
+		case "payloadCompression":
+			err = textField(v, &c.PayloadCompression)
+		default:
+			err = errors.Wrapf(errUnexpectedCBOR, "unknown field %s", key)
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func clockFromNode(nd datamodel.Node) (*lamportclock.CborLamportClock, error) {
+	if isNull(nd) {
+		return nil, nil
+	}
+
+	c := &lamportclock.CborLamportClock{}
+	err := fields(nd, func(key string, v datamodel.Node) error {
+		switch key {
+		case "id":
+			return textField(v, &c.ID)
+		case "time":
+			return intField(v, &c.Time)
+		}
+		return errUnexpectedCBOR
+	})
+
+	return c, err
+}
+
+func identityFromNode(nd datamodel.Node) (*identityprovider.CborIdentity, error) {
+	if isNull(nd) {
+		return nil, nil
+	}
+
+	i := &identityprovider.CborIdentity{}
+	err := fields(nd, func(key string, v datamodel.Node) error {
+		switch key {
+		case "id":
+			return textField(v, &i.ID)
+		case "type":
+			return textField(v, &i.Type)
+		case "publicKey":
+			return textField(v, &i.PublicKey)
+		case "signatures":
+			if isNull(v) {
+				return nil
+			}
+
+			i.Signatures = &identityprovider.CborIdentitySignature{}
+			return fields(v, func(key string, v datamodel.Node) error {
+				switch key {
+				case "id":
+					return textField(v, &i.Signatures.ID)
+				case "publicKey":
+					return textField(v, &i.Signatures.PublicKey)
+				}
+				return errUnexpectedCBOR
+			})
+		case "rotations":
+			i.Rotations = []*identityprovider.CborKeyRotation{}
+			return items(v, func(v datamodel.Node) error {
+				if isNull(v) {
+					i.Rotations = append(i.Rotations, nil)
+					return nil
+				}
+
+				rot := &identityprovider.CborKeyRotation{}
+				i.Rotations = append(i.Rotations, rot)
+				return fields(v, func(key string, v datamodel.Node) error {
+					switch key {
+					case "previousKey":
+						return textField(v, &rot.PreviousKey)
+					case "nextKey":
+						return textField(v, &rot.NextKey)
+					case "previousSignature":
+						return textField(v, &rot.PreviousSignature)
+					case "nextSignature":
+						return textField(v, &rot.NextSignature)
+					}
+					return errUnexpectedCBOR
+				})
+			})
+		case "delegations":
+			i.Delegations = []*identityprovider.CborKeyDelegation{}
+			return items(v, func(v datamodel.Node) error {
+				if isNull(v) {
+					i.Delegations = append(i.Delegations, nil)
+					return nil
+				}
+
+				d := &identityprovider.CborKeyDelegation{}
+				i.Delegations = append(i.Delegations, d)
+				return fields(v, func(key string, v datamodel.Node) error {
+					switch key {
+					case "issuer":
+						return textField(v, &d.Issuer)
+					case "delegate":
+						return textField(v, &d.Delegate)
+					case "signature":
+						return textField(v, &d.Signature)
+					}
+					return errUnexpectedCBOR
+				})
+			})
+		}
+		return errUnexpectedCBOR
+	})
+
+	return i, err
+}
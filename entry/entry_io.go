@@ -6,21 +6,40 @@ import (
 	"time"
 
 	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
 	cid "github.com/ipfs/go-cid"
 )
 
 type FetchOptions struct {
 	Length       *int
-	Exclude      []*Entry
+	Exclude      []iface.IPFSLogEntry
 	Concurrency  int
 	Timeout      time.Duration
-	ProgressChan chan *Entry
+	ProgressChan chan iface.IPFSLogEntry
 	Provider     identityprovider.Interface
+
+	// EntryLimiter and ByteLimiter bound the entries and bytes fetched per
+	// second, they can be shared by several fetches
+	EntryLimiter *ratelimit.Limiter
+	ByteLimiter  *ratelimit.Limiter
+
+	// Denylist skips the denied entries and the entries of denied authors,
+	// their parents aren't fetched
+	Denylist Denylist
+
+	// Offline only reads blocks from the local blockstore, missing entries
+	// fail with errmsg.BlockNotLocal instead of waiting for the network
+	Offline bool
+
+	// Boundary stops the fetch at the entries it returns true for, their
+	// parents aren't fetched
+	Boundary func(iface.IPFSLogEntry) bool
 }
 
-func FetchParallel(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []*Entry {
-	var entries []*Entry
+func FetchParallel(ipfs io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
+	var entries []iface.IPFSLogEntry
 
 	for _, h := range hashes {
 		entries = append(entries, FetchAll(ipfs, []cid.Cid{h}, options)...)
@@ -32,8 +51,12 @@ func FetchParallel(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOption
 	return NewOrderedMapFromEntries(entries).Slice()
 }
 
-func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []*Entry {
-	result := []*Entry{}
+func FetchAll(ipfs io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
+	if options.Offline {
+		ipfs = io.Offline(ipfs)
+	}
+
+	result := []iface.IPFSLogEntry{}
 	cache := NewOrderedMap()
 	loadingQueue := append(hashes[:0:0], hashes...)
 	length := -1
@@ -41,11 +64,13 @@ func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []
 		length = *options.Length
 	}
 
-	addToResults := func(entry *Entry) {
+	addToResults := func(entry iface.IPFSLogEntry) {
 		if entry.IsValid() {
-			loadingQueue = append(loadingQueue, entry.Next...)
+			if options.Boundary == nil || !options.Boundary(entry) {
+				loadingQueue = append(loadingQueue, entry.GetNext()...)
+			}
 			result = append(result, entry)
-			cache.Set(entry.Hash.String(), entry)
+			cache.Put(entry)
 
 			if options.ProgressChan != nil {
 				options.ProgressChan <- entry
@@ -56,7 +81,7 @@ func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []
 	for _, e := range options.Exclude {
 		if e.IsValid() {
 			result = append(result, e)
-			cache.Set(e.Hash.String(), e)
+			cache.Put(e)
 		}
 	}
 
@@ -65,22 +90,27 @@ func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []
 	}
 
 	fetchEntry := func() {
-		var loadingQueueStrings []string
-		for _, c := range loadingQueue {
-			loadingQueueStrings = append(loadingQueueStrings, c.String())
-		}
-
 		hash := loadingQueue[0]
 		loadingQueue = loadingQueue[1:]
 
-		if _, ok := cache.Get(hash.String()); ok {
+		if cache.HasCID(hash) {
+			return
+		}
+
+		if options.Denylist != nil && options.Denylist.DeniesEntry(hash) {
 			return
 		}
 
 		ctx := context.Background()
 
 		if options.Timeout != 0 {
-			ctx, _ = context.WithTimeout(ctx, options.Timeout)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+			defer cancel()
+		}
+
+		if err := options.EntryLimiter.Wait(ctx); err != nil {
+			return
 		}
 
 		entry, err := FromMultihash(ipfs, hash, options.Provider)
@@ -89,8 +119,19 @@ func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []
 			return
 		}
 
+		// Sizes are only computed when bytes are limited
+		if options.ByteLimiter != nil {
+			if err := options.ByteLimiter.WaitN(ctx, fetchedSize(entry)); err != nil {
+				return
+			}
+		}
+
 		entry.Hash = hash
 
+		if IsDenied(options.Denylist, entry) {
+			return
+		}
+
 		if entry.IsValid() {
 			addToResults(entry)
 		}
@@ -102,3 +143,18 @@ func FetchAll(ipfs *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) []
 
 	return result
 }
+
+// fetchedSize returns the number of bytes fetched for the entry and its
+// external payload
+func fetchedSize(e *Entry) int {
+	size := 0
+	if data, err := ToRawData(e); err == nil {
+		size = len(data)
+	}
+
+	if e.PayloadRef.Defined() {
+		size += len(e.Payload)
+	}
+
+	return size
+}
@@ -0,0 +1,273 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"unicode/utf8"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EncodingDagCBOR stores entries as dag-cbor, the default
+	EncodingDagCBOR = "dag-cbor"
+
+	// EncodingDagJSON stores entries as dag-json
+	EncodingDagJSON = "dag-json"
+)
+
+type jsonLink struct {
+	Link string `json:"/"`
+}
+
+type jsonBytes struct {
+	Bytes string `json:"bytes"`
+}
+
+type jsonClock struct {
+	ID   string `json:"id"`
+	Time int    `json:"time"`
+}
+
+type jsonIdentitySignature struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"publicKey"`
+}
+
+type jsonKeyRotation struct {
+	PreviousKey       string `json:"previousKey"`
+	NextKey           string `json:"nextKey"`
+	PreviousSignature string `json:"previousSignature"`
+	NextSignature     string `json:"nextSignature"`
+}
+
+type jsonKeyDelegation struct {
+	Issuer    string `json:"issuer"`
+	Delegate  string `json:"delegate"`
+	Signature string `json:"signature"`
+}
+
+type jsonIdentity struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	PublicKey   string                 `json:"publicKey"`
+	Signatures  *jsonIdentitySignature `json:"signatures"`
+	Rotations   []*jsonKeyRotation     `json:"rotations,omitempty"`
+	Delegations []*jsonKeyDelegation   `json:"delegations,omitempty"`
+}
+
+// jsonEntry is the dag-json representation of an entry, binary payloads
+// are encoded as {"/": {"bytes": "<base64>"}}
+type jsonEntry struct {
+	V                  uint64             `json:"v"`
+	LogID              string             `json:"id"`
+	Key                string             `json:"key"`
+	Sig                string             `json:"sig"`
+	Hash               interface{}        `json:"hash"`
+	Next               []jsonLink         `json:"next"`
+	Clock              *jsonClock         `json:"clock"`
+	Payload            json.RawMessage    `json:"payload"`
+	Identity           *jsonIdentity      `json:"identity"`
+	Metadata           map[string]string  `json:"metadata,omitempty"`
+	PayloadRef         *jsonLink          `json:"payloadRef,omitempty"`
+	PayloadCodec       string             `json:"payloadCodec,omitempty"`
+	PayloadKeyID       string             `json:"payloadKeyID,omitempty"`
+	PayloadCompression string             `json:"payloadCompression,omitempty"`
+	ClockType          string             `json:"clockType,omitempty"`
+	VectorClock        map[string]int     `json:"vectorClock,omitempty"`
+	HLC                *hlc.Timestamp     `json:"hlc,omitempty"`
+	Timestamp          int64              `json:"timestamp,omitempty"`
+	CoSignatures       []*jsonCoSignature `json:"cosignatures,omitempty"`
+}
+
+type jsonCoSignature struct {
+	Key string `json:"key"`
+	Sig string `json:"sig"`
+}
+
+// encodeCborEntry encodes an entry using the given encoding
+func encodeCborEntry(encoding string, c *CborEntry) ([]byte, error) {
+	if encoding == EncodingDagJSON {
+		return marshalDagJSON(c)
+	}
+
+	return c.MarshalCBOR()
+}
+
+// decodeCborEntry decodes an entry stored in a block with the given CID
+func decodeCborEntry(data []byte, hash cid.Cid) (*CborEntry, error) {
+	if hash.Type() == io.DagJSON {
+		return unmarshalDagJSON(data)
+	}
+
+	obj := &CborEntry{}
+	if err := obj.UnmarshalCBOR(data); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func marshalDagJSON(c *CborEntry) ([]byte, error) {
+	var payload interface{} = c.Payload
+	if !utf8.ValidString(c.Payload) {
+		payload = map[string]jsonBytes{"/": {Bytes: base64.RawStdEncoding.EncodeToString([]byte(c.Payload))}}
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &jsonEntry{
+		V:                  c.V,
+		LogID:              c.LogID,
+		Key:                c.Key,
+		Sig:                c.Sig,
+		Next:               []jsonLink{},
+		Payload:            payloadBytes,
+		Metadata:           c.Metadata,
+		PayloadCodec:       c.PayloadCodec,
+		PayloadKeyID:       c.PayloadKeyID,
+		PayloadCompression: c.PayloadCompression,
+		ClockType:          c.ClockType,
+		VectorClock:        c.VectorClock,
+		HLC:                c.HLC,
+		Timestamp:          c.Timestamp,
+	}
+
+	for _, n := range c.Next {
+		j.Next = append(j.Next, jsonLink{Link: io.CIDString(n)})
+	}
+
+	if c.Clock != nil {
+		j.Clock = &jsonClock{ID: c.Clock.ID, Time: c.Clock.Time}
+	}
+
+	if c.Identity != nil {
+		j.Identity = &jsonIdentity{
+			ID:        c.Identity.ID,
+			Type:      c.Identity.Type,
+			PublicKey: c.Identity.PublicKey,
+		}
+
+		if c.Identity.Signatures != nil {
+			j.Identity.Signatures = &jsonIdentitySignature{
+				ID:        c.Identity.Signatures.ID,
+				PublicKey: c.Identity.Signatures.PublicKey,
+			}
+		}
+
+		for _, r := range c.Identity.Rotations {
+			j.Identity.Rotations = append(j.Identity.Rotations, (*jsonKeyRotation)(r))
+		}
+
+		for _, d := range c.Identity.Delegations {
+			j.Identity.Delegations = append(j.Identity.Delegations, (*jsonKeyDelegation)(d))
+		}
+	}
+
+	if c.PayloadRef != nil {
+		j.PayloadRef = &jsonLink{Link: io.CIDString(*c.PayloadRef)}
+	}
+
+	for _, s := range c.CoSignatures {
+		j.CoSignatures = append(j.CoSignatures, (*jsonCoSignature)(s))
+	}
+
+	return json.Marshal(j)
+}
+
+func unmarshalDagJSON(data []byte) (*CborEntry, error) {
+	j := &jsonEntry{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, err
+	}
+
+	c := &CborEntry{
+		V:                  j.V,
+		LogID:              j.LogID,
+		Key:                j.Key,
+		Sig:                j.Sig,
+		Metadata:           j.Metadata,
+		PayloadCodec:       j.PayloadCodec,
+		PayloadKeyID:       j.PayloadKeyID,
+		PayloadCompression: j.PayloadCompression,
+		ClockType:          j.ClockType,
+		VectorClock:        j.VectorClock,
+		HLC:                j.HLC,
+		Timestamp:          j.Timestamp,
+	}
+
+	for _, s := range j.CoSignatures {
+		c.CoSignatures = append(c.CoSignatures, (*CborCoSignature)(s))
+	}
+
+	for _, n := range j.Next {
+		next, err := cid.Decode(n.Link)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid next link")
+		}
+
+		c.Next = append(c.Next, next)
+	}
+
+	if len(j.Payload) > 0 {
+		var binary map[string]jsonBytes
+		if err := json.Unmarshal(j.Payload, &c.Payload); err != nil {
+			if err := json.Unmarshal(j.Payload, &binary); err != nil {
+				return nil, errors.Wrap(err, "invalid payload")
+			}
+
+			payload, err := base64.RawStdEncoding.DecodeString(binary["/"].Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid payload")
+			}
+
+			c.Payload = string(payload)
+		}
+	}
+
+	if j.Clock != nil {
+		c.Clock = &lamportclock.CborLamportClock{ID: j.Clock.ID, Time: j.Clock.Time}
+	}
+
+	if j.Identity != nil {
+		c.Identity = &identityprovider.CborIdentity{
+			ID:        j.Identity.ID,
+			Type:      j.Identity.Type,
+			PublicKey: j.Identity.PublicKey,
+		}
+
+		if j.Identity.Signatures != nil {
+			c.Identity.Signatures = &identityprovider.CborIdentitySignature{
+				ID:        j.Identity.Signatures.ID,
+				PublicKey: j.Identity.Signatures.PublicKey,
+			}
+		}
+
+		for _, r := range j.Identity.Rotations {
+			c.Identity.Rotations = append(c.Identity.Rotations, (*identityprovider.CborKeyRotation)(r))
+		}
+
+		for _, d := range j.Identity.Delegations {
+			c.Identity.Delegations = append(c.Identity.Delegations, (*identityprovider.CborKeyDelegation)(d))
+		}
+	}
+
+	if j.PayloadRef != nil {
+		ref, err := cid.Decode(j.PayloadRef.Link)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid payload link")
+		}
+
+		c.PayloadRef = &ref
+	}
+
+	return c, nil
+}
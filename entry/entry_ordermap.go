@@ -1,28 +1,37 @@
 package entry // import "berty.tech/go-ipfs-log/entry"
 
 import (
-	"github.com/iancoleman/orderedmap"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/orderedmap"
+	iomap "github.com/iancoleman/orderedmap"
+	cid "github.com/ipfs/go-cid"
 )
 
+// OrderedMap holds entries keyed by their CID in insertion order, it is
+// safe for concurrent use and the string based methods expect keys to be
+// CID strings
 type OrderedMap struct {
-	orderedMap *orderedmap.OrderedMap
+	m *orderedmap.OrderedMap[cid.Cid, iface.IPFSLogEntry]
 }
 
 func NewOrderedMap() *OrderedMap {
 	return &OrderedMap{
-		orderedMap: orderedmap.New(),
+		m: orderedmap.New[cid.Cid, iface.IPFSLogEntry](),
 	}
 }
 
-func NewOrderedMapFromEntries(entries []*Entry) *OrderedMap {
-	orderedMap := NewOrderedMap()
+func NewOrderedMapFromEntries(entries []iface.IPFSLogEntry) *OrderedMap {
+	orderedMap := &OrderedMap{
+		m: orderedmap.NewWithCapacity[cid.Cid, iface.IPFSLogEntry](len(entries)),
+	}
 
 	for _, e := range entries {
 		if e == nil {
 			continue
 		}
 
-		orderedMap.Set(e.Hash.String(), e)
+		orderedMap.Put(e)
 	}
 
 	return orderedMap
@@ -31,86 +40,150 @@ func NewOrderedMapFromEntries(entries []*Entry) *OrderedMap {
 func (o *OrderedMap) Merge(other *OrderedMap) *OrderedMap {
 	newMap := o.Copy()
 
-	otherKeys := other.Keys()
-	for _, k := range otherKeys {
-		val, _ := other.Get(k)
-		newMap.Set(k, val)
-	}
+	other.Range(func(c cid.Cid, e iface.IPFSLogEntry) bool {
+		newMap.SetCID(c, e)
+		return true
+	})
 
 	return newMap
 }
 
 func (o *OrderedMap) Copy() *OrderedMap {
-	newMap := NewOrderedMap()
-	keys := o.Keys()
+	return &OrderedMap{m: o.m.Copy()}
+}
 
-	for _, k := range keys {
-		val, _ := o.Get(k)
-		newMap.Set(k, val)
-	}
+// Range calls f for each entry in order until f returns false, the map
+// can be modified while iterating
+func (o *OrderedMap) Range(f func(c cid.Cid, e iface.IPFSLogEntry) bool) {
+	o.m.Range(f)
+}
 
-	return newMap
+// Put adds an entry keyed by its hash
+func (o *OrderedMap) Put(e iface.IPFSLogEntry) {
+	o.SetCID(e.GetHash(), e)
 }
 
-func (o *OrderedMap) Get(key string) (*Entry, bool) {
-	val, exists := o.orderedMap.Get(key)
-	entry, ok := val.(*Entry)
-	if !ok {
-		exists = false
-	}
+// GetCID returns the entry for the given CID
+func (o *OrderedMap) GetCID(c cid.Cid) (iface.IPFSLogEntry, bool) {
+	e, ok := o.m.Get(c)
 
-	return entry, exists
+	return e, ok && e != nil
 }
 
-func (o *OrderedMap) UnsafeGet(key string) *Entry {
-	val, _ := o.Get(key)
+// HasCID returns true if an entry is set for the given CID
+func (o *OrderedMap) HasCID(c cid.Cid) bool {
+	_, ok := o.GetCID(c)
 
-	return val
+	return ok
 }
 
-func (o *OrderedMap) Set(key string, value *Entry) {
-	o.orderedMap.Set(key, value)
+// SetCID sets the entry for the given CID, keeping its position if it is
+// already set
+func (o *OrderedMap) SetCID(c cid.Cid, e iface.IPFSLogEntry) {
+	o.m.Set(c, e)
 }
 
-func (o *OrderedMap) Slice() []*Entry {
-	out := []*Entry{}
+// DeleteCID removes the entry for the given CID
+func (o *OrderedMap) DeleteCID(c cid.Cid) {
+	o.m.Delete(c)
+}
 
-	keys := o.orderedMap.Keys()
-	for _, k := range keys {
-		out = append(out, o.UnsafeGet(k))
+// CIDs returns the keys of the map in order
+func (o *OrderedMap) CIDs() []cid.Cid {
+	return o.m.Keys()
+}
+
+func (o *OrderedMap) Get(key string) (iface.IPFSLogEntry, bool) {
+	c, err := cid.Decode(key)
+	if err != nil {
+		return nil, false
 	}
 
-	return out
+	return o.GetCID(c)
+}
+
+// UnsafeGet returns the entry for the given key or nil, prefer Range or
+// Slice to iterate over the map
+func (o *OrderedMap) UnsafeGet(key string) iface.IPFSLogEntry {
+	val, _ := o.Get(key)
+
+	return val
+}
+
+// Set sets the entry for the given CID string, invalid keys are ignored
+func (o *OrderedMap) Set(key string, value iface.IPFSLogEntry) {
+	c, err := cid.Decode(key)
+	if err != nil {
+		return
+	}
+
+	o.SetCID(c, value)
+}
+
+func (o *OrderedMap) Slice() []iface.IPFSLogEntry {
+	return o.m.Values()
 }
 
 func (o *OrderedMap) Delete(key string) {
-	o.orderedMap.Delete(key)
+	c, err := cid.Decode(key)
+	if err != nil {
+		return
+	}
+
+	o.DeleteCID(c)
 }
 
 func (o *OrderedMap) Keys() []string {
-	return o.orderedMap.Keys()
+	keys := o.m.Keys()
+	out := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		out = append(out, io.CIDString(k))
+	}
+
+	return out
 }
 
 // SortKeys Sort the map keys using your sort func
 func (o *OrderedMap) SortKeys(sortFunc func(keys []string)) {
-	o.orderedMap.SortKeys(sortFunc)
+	o.m.SortKeys(func(keys []cid.Cid) {
+		strs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			strs = append(strs, io.CIDString(k))
+		}
+
+		sortFunc(strs)
+
+		sorted := keys[:0]
+		for _, k := range strs {
+			if c, err := cid.Decode(k); err == nil {
+				sorted = append(sorted, c)
+			}
+		}
+	})
 }
 
 // Sort Sort the map using your sort func
-func (o *OrderedMap) Sort(lessFunc func(a *orderedmap.Pair, b *orderedmap.Pair) bool) {
-	o.orderedMap.Sort(lessFunc)
+func (o *OrderedMap) Sort(lessFunc func(a *iomap.Pair, b *iomap.Pair) bool) {
+	pairs := iomap.New()
+	o.Range(func(c cid.Cid, e iface.IPFSLogEntry) bool {
+		pairs.Set(io.CIDString(c), e)
+		return true
+	})
+
+	pairs.Sort(lessFunc)
+
+	o.SortKeys(func(keys []string) {
+		copy(keys, pairs.Keys())
+	})
 }
 
 func (o *OrderedMap) Len() int {
-	return len(o.orderedMap.Keys())
+	return o.m.Len()
 }
 
-func (o *OrderedMap) At(index uint) *Entry {
-	keys := o.Keys()
-
-	if uint(len(keys)) < index {
-		return nil
-	}
+func (o *OrderedMap) At(index uint) iface.IPFSLogEntry {
+	_, e, _ := o.m.At(int(index))
 
-	return o.UnsafeGet(keys[index])
+	return e
 }
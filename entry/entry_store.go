@@ -0,0 +1,108 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/pkg/errors"
+)
+
+// Store is an index of entries keyed by their hash
+type Store interface {
+	Get(hash cid.Cid) (iface.IPFSLogEntry, bool, error)
+	Has(hash cid.Cid) (bool, error)
+	Put(e iface.IPFSLogEntry) error
+	Delete(hash cid.Cid) error
+}
+
+// Lister is implemented by the stores able to list the hashes of their
+// entries, see log.NewLogOptions.BloomFilter
+type Lister interface {
+	ForEachHash(fn func(hash cid.Cid) error) error
+}
+
+// DatastoreStore is a Store keeping serialized entries in a datastore,
+// allowing logs larger than the available memory
+type DatastoreStore struct {
+	store    datastore.Datastore
+	provider identityprovider.Interface
+}
+
+// NewDatastoreStore creates a Store backed by the given datastore, the
+// provider is set on the identities of the decoded entries
+func NewDatastoreStore(store datastore.Datastore, provider identityprovider.Interface) *DatastoreStore {
+	return &DatastoreStore{
+		store:    store,
+		provider: provider,
+	}
+}
+
+func (s *DatastoreStore) key(hash cid.Cid) datastore.Key {
+	return datastore.NewKey(io.CIDString(hash))
+}
+
+func (s *DatastoreStore) Get(hash cid.Cid) (iface.IPFSLogEntry, bool, error) {
+	data, err := s.store.Get(s.key(hash))
+	if err == datastore.ErrNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, errors.Wrap(err, "unable to read entry from datastore")
+	}
+
+	e, err := FromRawData(data, hash, s.provider)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to decode entry")
+	}
+
+	return e, true, nil
+}
+
+func (s *DatastoreStore) Has(hash cid.Cid) (bool, error) {
+	return s.store.Has(s.key(hash))
+}
+
+func (s *DatastoreStore) Put(e iface.IPFSLogEntry) error {
+	data, err := ToRawData(e)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode entry")
+	}
+
+	return s.store.Put(s.key(e.GetHash()), data)
+}
+
+func (s *DatastoreStore) Delete(hash cid.Cid) error {
+	return s.store.Delete(s.key(hash))
+}
+
+// ForEachHash calls fn with the hash of every entry of the store, the keys
+// of the datastore that aren't CIDs are skipped
+func (s *DatastoreStore) ForEachHash(fn func(hash cid.Cid) error) error {
+	res, err := s.store.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "unable to list entries")
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return errors.Wrap(r.Error, "unable to list entries")
+		}
+
+		hash, err := cid.Decode(datastore.RawKey(r.Key).Name())
+		if err != nil {
+			continue
+		}
+
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ Store = &DatastoreStore{}
+var _ Lister = &DatastoreStore{}
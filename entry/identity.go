@@ -0,0 +1,54 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// VerifyIdentity checks that an entry is signed with the key of its
+// identity, or one it was rotated to, that the identity ID is signed by the
+// identity key and that the identity key is signed by the key of the ID.
+// The latter is checked by the provider when it handles the type of the
+// identity, or else by the registered provider of that type.
+func VerifyIdentity(e iface.IPFSLogEntry, provider identityprovider.Interface) error {
+	identity := e.GetIdentity()
+	if identity == nil {
+		return errors.Wrap(errmsg.UnknownIdentity, "entry doesn't have an identity")
+	}
+
+	if !bytes.Equal(e.GetKey(), identity.PublicKey) {
+		if err := identity.HasKey(e.GetKey()); err != nil {
+			return errors.Wrapf(errmsg.UnknownIdentity, "entry key doesn't match its identity: %s", err)
+		}
+	}
+
+	if identity.Signatures == nil {
+		return errors.Wrap(errmsg.UnknownIdentity, "identity doesn't have signatures")
+	}
+
+	pubKey, err := identityprovider.UnmarshalPublicKey(identity.PublicKey)
+	if err != nil {
+		return errors.Wrapf(errmsg.UnknownIdentity, "unable to unmarshal identity public key: %s", err)
+	}
+
+	ok, err := pubKey.Verify([]byte(identity.ID), identity.Signatures.ID)
+	if err != nil || !ok {
+		return errors.Wrap(errmsg.BadSignature, "identity ID signature is invalid")
+	}
+
+	if provider != nil && provider.GetType() == identity.Type {
+		err = provider.VerifyIdentity(identity)
+	} else {
+		err = identityprovider.VerifyIdentity(identity)
+	}
+
+	if err != nil {
+		return errors.Wrapf(errmsg.BadSignature, "unable to verify identity: %s", err)
+	}
+
+	return nil
+}
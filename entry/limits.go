@@ -0,0 +1,76 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"berty.tech/go-ipfs-log/errmsg"
+	"github.com/pkg/errors"
+)
+
+// DecodeLimits bounds the resources used when decoding an entry received
+// from a peer, a zero value disables the corresponding check
+type DecodeLimits struct {
+	// MaxEntrySize is the maximum size in bytes of an encoded entry
+	MaxEntrySize int
+
+	// MaxPayloadSize is the maximum size in bytes of a payload once
+	// fetched and decompressed
+	MaxPayloadSize int
+
+	// MaxNext is the maximum number of next pointers of an entry
+	MaxNext int
+
+	// MaxMetadata is the maximum number of metadata keys of an entry
+	MaxMetadata int
+}
+
+// DefaultDecodeLimits are the limits used when decoding entries
+var DefaultDecodeLimits = DecodeLimits{
+	MaxEntrySize:   2 << 20,
+	MaxPayloadSize: 64 << 20,
+	MaxNext:        4096,
+	MaxMetadata:    256,
+}
+
+// checkSize returns errmsg.EntryTooLarge if the encoded entry exceeds the
+// limits
+func (l DecodeLimits) checkSize(size int) error {
+	if l.MaxEntrySize > 0 && size > l.MaxEntrySize {
+		return errors.Wrapf(errmsg.EntryTooLarge, "entry is %d bytes, limit is %d", size, l.MaxEntrySize)
+	}
+
+	return nil
+}
+
+// checkPayloadSize returns errmsg.EntryTooLarge if the payload exceeds
+// the limits
+func (l DecodeLimits) checkPayloadSize(size int) error {
+	if l.MaxPayloadSize > 0 && size > l.MaxPayloadSize {
+		return errors.Wrapf(errmsg.EntryTooLarge, "payload is %d bytes, limit is %d", size, l.MaxPayloadSize)
+	}
+
+	return nil
+}
+
+// checkFields sanity checks the fields of a decoded entry
+func (l DecodeLimits) checkFields(c *CborEntry) error {
+	if err := l.checkPayloadSize(len(c.Payload)); err != nil {
+		return err
+	}
+
+	if l.MaxNext > 0 && len(c.Next) > l.MaxNext {
+		return errors.Wrapf(errmsg.EntryTooLarge, "entry has %d next pointers, limit is %d", len(c.Next), l.MaxNext)
+	}
+
+	if l.MaxMetadata > 0 && len(c.Metadata) > l.MaxMetadata {
+		return errors.Wrapf(errmsg.EntryTooLarge, "entry has %d metadata keys, limit is %d", len(c.Metadata), l.MaxMetadata)
+	}
+
+	if c.Clock == nil {
+		return errors.Wrap(errmsg.MalformedEntry, "entry has no clock")
+	}
+
+	if c.Identity == nil {
+		return errors.Wrap(errmsg.MalformedEntry, "entry has no identity")
+	}
+
+	return nil
+}
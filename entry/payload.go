@@ -0,0 +1,101 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+	"compress/gzip"
+	stdio "io"
+	"io/ioutil"
+
+	"berty.tech/go-ipfs-log/codec"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// DecodePayload decodes the payload of an entry into v using the codec
+// recorded in the entry
+func DecodePayload(e iface.IPFSLogEntry, v interface{}) error {
+	if e == nil {
+		return errors.New("entry is not defined")
+	}
+
+	c, err := codec.Get(e.GetPayloadCodec())
+	if err != nil {
+		return err
+	}
+
+	return c.Unmarshal(e.GetPayload(), v)
+}
+
+// DecodedPayload decodes the payload of the entry into v
+func (e *Entry) DecodedPayload(v interface{}) error {
+	return DecodePayload(e, v)
+}
+
+const (
+	// CompressionNone stores payloads as is
+	CompressionNone = ""
+
+	// CompressionGzip compresses payloads using gzip
+	CompressionGzip = "gzip"
+)
+
+// compressPayload compresses a payload using the given algorithm
+func compressPayload(algorithm string, payload []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return payload, nil
+
+	case CompressionGzip:
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		w := gzipPool.Get().(*gzip.Writer)
+		defer gzipPool.Put(w)
+		w.Reset(buf)
+
+		if _, err := w.Write(payload); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return append([]byte(nil), buf.Bytes()...), nil
+	}
+
+	return nil, errors.Errorf("unsupported payload compression: %s", algorithm)
+}
+
+// decompressPayload reverses compressPayload
+func decompressPayload(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		limit := DefaultDecodeLimits.MaxPayloadSize
+		if limit <= 0 {
+			return ioutil.ReadAll(r)
+		}
+
+		payload, err := ioutil.ReadAll(stdio.LimitReader(r, int64(limit)+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := DefaultDecodeLimits.checkPayloadSize(len(payload)); err != nil {
+			return nil, err
+		}
+
+		return payload, nil
+	}
+
+	return nil, errors.Errorf("unsupported payload compression: %s", algorithm)
+}
@@ -0,0 +1,46 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"hash"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which buffers are left to the
+// garbage collector, so a single large entry doesn't pin its memory
+const maxPooledBuffer = 64 << 10
+
+// The pools below hold the intermediate buffers used while encoding,
+// signing and verifying entries. Entries themselves aren't pooled, logs
+// keep references to them.
+var (
+	bufferPool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+	hasherPool = sync.Pool{New: func() interface{} { return sha256.New() }}
+	gzipPool   = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+)
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+func getHasher() hash.Hash {
+	h := hasherPool.Get().(hash.Hash)
+	h.Reset()
+
+	return h
+}
+
+func putHasher(h hash.Hash) {
+	hasherPool.Put(h)
+}
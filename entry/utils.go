@@ -2,13 +2,15 @@ package entry // import "berty.tech/go-ipfs-log/entry"
 
 import (
 	"sort"
+
+	"berty.tech/go-ipfs-log/iface"
 )
 
-func EntriesAsStrings(entries []*Entry) []string {
+func EntriesAsStrings(entries []iface.IPFSLogEntry) []string {
 	var values []string
 
 	for _, e := range entries {
-		values = append(values, string(e.Payload))
+		values = append(values, string(e.GetPayload()))
 	}
 
 	sort.Strings(values)
@@ -16,9 +18,9 @@ func EntriesAsStrings(entries []*Entry) []string {
 	return values
 }
 
-func Slice(entries []*Entry, index int) []*Entry {
+func Slice(entries []iface.IPFSLogEntry, index int) []iface.IPFSLogEntry {
 	if len(entries) == 0 || index >= len(entries) {
-		return []*Entry{}
+		return []iface.IPFSLogEntry{}
 	}
 
 	if index == 0 || (index < 0 && -index >= len(entries)) {
@@ -32,9 +34,9 @@ func Slice(entries []*Entry, index int) []*Entry {
 	return entries[(len(entries) + index):]
 }
 
-func SliceRange(entries []*Entry, from int, to int) []*Entry {
+func SliceRange(entries []iface.IPFSLogEntry, from int, to int) []iface.IPFSLogEntry {
 	if len(entries) == 0 {
-		return []*Entry{}
+		return []iface.IPFSLogEntry{}
 	}
 
 	if from < 0 {
@@ -49,7 +51,7 @@ func SliceRange(entries []*Entry, from int, to int) []*Entry {
 	}
 
 	if from >= len(entries) {
-		return []*Entry{}
+		return []iface.IPFSLogEntry{}
 	}
 
 	if to > len(entries) {
@@ -57,7 +59,7 @@ func SliceRange(entries []*Entry, from int, to int) []*Entry {
 	}
 
 	if from >= to {
-		return []*Entry{}
+		return []iface.IPFSLogEntry{}
 	}
 
 	if from == to {
@@ -67,21 +69,21 @@ func SliceRange(entries []*Entry, from int, to int) []*Entry {
 	return entries[from:to]
 }
 
-func Difference(a []*Entry, b []*Entry) []*Entry {
+func Difference(a []iface.IPFSLogEntry, b []iface.IPFSLogEntry) []iface.IPFSLogEntry {
 	existing := map[string]bool{}
 	processed := map[string]bool{}
-	var diff []*Entry
+	var diff []iface.IPFSLogEntry
 
 	for _, v := range a {
-		existing[v.Hash.String()] = true
+		existing[v.GetHash().String()] = true
 	}
 
 	for _, v := range b {
-		isInFirst := existing[v.Hash.String()]
-		hasBeenProcessed := processed[v.Hash.String()]
+		isInFirst := existing[v.GetHash().String()]
+		hasBeenProcessed := processed[v.GetHash().String()]
 		if !isInFirst && !hasBeenProcessed {
 			diff = append(diff, v)
-			processed[v.Hash.String()] = true
+			processed[v.GetHash().String()] = true
 		}
 	}
 
@@ -0,0 +1,123 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"reflect"
+	"sync"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+)
+
+// DefaultVerificationCacheSize is the number of verified entries remembered
+// for each identity provider
+const DefaultVerificationCacheSize = 4096
+
+// VerificationCache remembers the entries whose signature was successfully
+// verified, along with a digest of their signed data so that entries
+// modified since their verification are checked again
+type VerificationCache struct {
+	lru *lru.Cache
+}
+
+// NewVerificationCache creates a cache holding at most size entries
+func NewVerificationCache(size int) (*VerificationCache, error) {
+	if size <= 0 {
+		size = DefaultVerificationCacheSize
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerificationCache{lru: cache}, nil
+}
+
+// verificationDigest returns the digest of the signed data, key and
+// signature of an entry
+func verificationDigest(data, key, sig []byte) [sha256.Size]byte {
+	h := getHasher()
+	defer putHasher(h)
+
+	for _, b := range [][]byte{data, key, sig} {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+		_, _ = h.Write(b)
+	}
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+
+	return digest
+}
+
+// Has returns true if the entry with the given hash was verified with the
+// same signed data, key and signature
+func (c *VerificationCache) Has(hash cid.Cid, data, key, sig []byte) bool {
+	val, ok := c.lru.Get(hash.KeyString())
+	if !ok {
+		return false
+	}
+
+	return val.([sha256.Size]byte) == verificationDigest(data, key, sig)
+}
+
+// Add records a successful verification
+func (c *VerificationCache) Add(hash cid.Cid, data, key, sig []byte) {
+	c.lru.Add(hash.KeyString(), verificationDigest(data, key, sig))
+}
+
+// Len returns the number of verified entries held by the cache
+func (c *VerificationCache) Len() int {
+	return c.lru.Len()
+}
+
+// Purge removes all the entries from the cache
+func (c *VerificationCache) Purge() {
+	c.lru.Purge()
+}
+
+// MaxVerificationCaches is the number of identity providers whose cache is
+// kept, the caches of the least recently used providers are dropped
+const MaxVerificationCaches = 64
+
+var (
+	verificationCachesMu sync.Mutex
+	verificationCaches   = mustLRU(MaxVerificationCaches)
+)
+
+func mustLRU(size int) *lru.Cache {
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+
+	return cache
+}
+
+// VerificationCacheFor returns the cache shared by the logs using the given
+// identity provider, nil when the provider can't be used as a map key. At
+// most MaxVerificationCaches caches are kept.
+func VerificationCacheFor(provider identityprovider.Interface) *VerificationCache {
+	if provider != nil && !reflect.TypeOf(provider).Comparable() {
+		return nil
+	}
+
+	verificationCachesMu.Lock()
+	defer verificationCachesMu.Unlock()
+
+	if cache, ok := verificationCaches.Get(provider); ok {
+		return cache.(*VerificationCache)
+	}
+
+	cache, err := NewVerificationCache(DefaultVerificationCacheSize)
+	if err != nil {
+		return nil
+	}
+
+	verificationCaches.Add(provider, cache)
+
+	return cache
+}
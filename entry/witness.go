@@ -0,0 +1,193 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/pkg/errors"
+)
+
+// Witness is an attestation by a third party that it observed an entry, it
+// is stored as its own object linking to the entry so the entry is left
+// unchanged and the witness doesn't need to be a writer
+type Witness struct {
+	Entry cid.Cid
+	Key   []byte
+	Sig   []byte
+}
+
+type cborWitness struct {
+	Entry cid.Cid
+	Key   string
+	Sig   string
+}
+
+// witnessStatement returns the data signed by a witness of the entry
+func witnessStatement(hash cid.Cid) []byte {
+	return append([]byte("witness:"), hash.Bytes()...)
+}
+
+// NewWitness signs the hash of an entry with the signer
+func NewWitness(ctx context.Context, signer identityprovider.Signer, hash cid.Cid) (*Witness, error) {
+	if signer == nil {
+		return nil, errors.New("a signer is required")
+	}
+
+	key, err := identityprovider.SignerPublicKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signer.Sign(ctx, witnessStatement(hash))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign witness")
+	}
+
+	return &Witness{Entry: hash, Key: key, Sig: sig}, nil
+}
+
+// Verify checks the signature of the witness
+func (w *Witness) Verify() error {
+	return verifySignature(w.Key, w.Sig, witnessStatement(w.Entry))
+}
+
+// WriteWitness stores the witness and returns its CID
+func WriteWitness(ipfs io.IpfsServices, w *Witness) (cid.Cid, error) {
+	if ipfs == nil {
+		return cid.Cid{}, errmsg.IPFSNotDefined
+	}
+
+	return io.WriteCBOR(ipfs, &cborWitness{
+		Entry: w.Entry,
+		Key:   hex.EncodeToString(w.Key),
+		Sig:   hex.EncodeToString(w.Sig),
+	})
+}
+
+// ReadWitness fetches a witness and verifies its signature
+func ReadWitness(ipfs io.IpfsServices, hash cid.Cid) (*Witness, error) {
+	if ipfs == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	nd, err := io.ReadCBOR(ipfs, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch witness")
+	}
+
+	c := &cborWitness{}
+	if err := c.UnmarshalCBOR(nd.RawData()); err != nil {
+		return nil, errors.Wrap(errmsg.MalformedEntry, err.Error())
+	}
+
+	w := &Witness{Entry: c.Entry}
+	if w.Key, err = hex.DecodeString(c.Key); err != nil {
+		return nil, errors.Wrap(errmsg.MalformedEntry, err.Error())
+	}
+
+	if w.Sig, err = hex.DecodeString(c.Sig); err != nil {
+		return nil, errors.Wrap(errmsg.MalformedEntry, err.Error())
+	}
+
+	if err := w.Verify(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// AddWitness signs the hash of an entry with the signer, stores the witness
+// and returns its CID
+func AddWitness(ctx context.Context, ipfs io.IpfsServices, signer identityprovider.Signer, hash cid.Cid) (cid.Cid, error) {
+	w, err := NewWitness(ctx, signer, hash)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	return WriteWitness(ipfs, w)
+}
+
+// WitnessKeys fetches the witnesses and returns the keys of those validly
+// attesting the entry, each key once
+func WitnessKeys(ipfs io.IpfsServices, hash cid.Cid, witnesses []cid.Cid) ([][]byte, error) {
+	keys := [][]byte{}
+	seen := map[string]bool{}
+
+	for _, c := range witnesses {
+		w, err := ReadWitness(ipfs, c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid witness %s", c)
+		}
+
+		if !w.Entry.Equals(hash) {
+			return nil, errors.Errorf("witness %s attests another entry", c)
+		}
+
+		if k := hex.EncodeToString(w.Key); !seen[k] {
+			seen[k] = true
+			keys = append(keys, w.Key)
+		}
+	}
+
+	return keys, nil
+}
+
+// MarshalCBOR encodes the witness as dag-cbor, its keys aren't sorted and
+// keep the order they always had so witnesses keep their CID
+func (c *cborWitness) MarshalCBOR() ([]byte, error) {
+	if !c.Entry.Defined() {
+		return nil, errUndefinedLink
+	}
+
+	nd, err := qp.BuildMap(basicnode.Prototype.Map, 3, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "entry", qp.Link(cidlink.Link{Cid: c.Entry}))
+		qp.MapEntry(ma, "key", qp.String(c.Key))
+		qp.MapEntry(ma, "sig", qp.String(c.Sig))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := (dagcbor.EncodeOptions{AllowLinks: true, MapSortMode: codec.MapSortMode_None}).Encode(nd, buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes a witness encoded as dag-cbor
+func (c *cborWitness) UnmarshalCBOR(data []byte) error {
+	nd, err := io.DecodeCBOR(data)
+	if err != nil {
+		return err
+	}
+
+	return fields(nd, func(key string, v datamodel.Node) error {
+		var err error
+
+		switch key {
+		case "entry":
+			c.Entry, err = linkField(v)
+		case "key":
+			err = textField(v, &c.Key)
+		case "sig":
+			err = textField(v, &c.Sig)
+		default:
+			err = errors.Wrapf(errUnexpectedCBOR, "unknown field %s", key)
+		}
+
+		return err
+	})
+}
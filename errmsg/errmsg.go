@@ -12,4 +12,32 @@ const (
 	LogJoinNotDefined      = Error("log to join not defined")
 	LogOptionsNotDefined   = Error("log options not defined")
 	FetchOptionsNotDefined = Error("fetch options not defined")
+	KeyNotFound            = Error("key not found")
+	EntryTooLarge          = Error("entry too large")
+	HashMismatch           = Error("hash mismatch")
+	NotCanonical           = Error("not canonically encoded")
+	ClockNotMonotonic      = Error("clock not monotonic")
+	ValidationFailed       = Error("validation failed")
+	EntryNotFound          = Error("entry not found")
+	InvalidProof           = Error("invalid proof")
+	KeyRevoked             = Error("key revoked")
+	AccessDenied           = Error("access denied")
+	BadSignature           = Error("bad signature")
+	UnknownIdentity        = Error("unknown identity")
+	MalformedEntry         = Error("malformed entry")
+	EntryDenied            = Error("entry denied")
+	BlockNotLocal          = Error("block not available locally")
+	PinnerNotDefined       = Error("pinner not defined")
+	InvalidAddress         = Error("invalid log address")
+	UnknownSortFunction    = Error("unknown sort function")
+	LogNotOpen             = Error("log not open")
+	LogsClosed             = Error("logs manager closed")
+	InvalidAnchor          = Error("invalid anchor")
+	InvalidTimestamp       = Error("invalid timestamp")
+	TimestampNotVerified   = Error("timestamp not verified")
+	InvalidCheckpoint      = Error("invalid checkpoint")
+	InvalidPageToken       = Error("invalid page token")
+	InvalidPageLimit       = Error("invalid page limit")
+	ManifestConflict       = Error("options conflict with the log manifest")
+	WrongLog               = Error("entry belongs to another log")
 )
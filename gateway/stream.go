@@ -0,0 +1,287 @@
+// Package gateway serves logs over HTTP
+package gateway // import "berty.tech/go-ipfs-log/gateway"
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// DefaultBuffer is the number of events buffered for each client when none
+// is set
+const DefaultBuffer = 64
+
+// StreamOptions defines how the entries are streamed
+type StreamOptions struct {
+	// Buffer is the number of events buffered for each client, slow
+	// clients are disconnected once it is full. DefaultBuffer when 0.
+	Buffer int
+
+	// Heartbeat is the time between two comments keeping idle connections
+	// open, no heartbeat when 0
+	Heartbeat time.Duration
+}
+
+// Event is the JSON data of the events sent for every new entry
+type Event struct {
+	Hash      string     `json:"hash"`
+	LogID     string     `json:"logId"`
+	Next      []string   `json:"next"`
+	Clock     EventClock `json:"clock"`
+	Identity  string     `json:"identity,omitempty"`
+	Payload   []byte     `json:"payload"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// EventClock is the Lamport clock of an entry, the ID is hex encoded
+type EventClock struct {
+	ID   string `json:"id"`
+	Time int    `json:"time"`
+}
+
+func newEvent(e iface.IPFSLogEntry) *Event {
+	ev := &Event{
+		Hash:    io.CIDString(e.GetHash()),
+		LogID:   e.GetLogID(),
+		Next:    []string{},
+		Clock:   EventClock{ID: hex.EncodeToString(e.GetClock().ID), Time: e.GetClock().Time},
+		Payload: e.GetPayload(),
+	}
+
+	for _, n := range e.GetNext() {
+		ev.Next = append(ev.Next, io.CIDString(n))
+	}
+
+	if identity := e.GetIdentity(); identity != nil {
+		ev.Identity = identity.ID
+	}
+
+	if t := e.GetTimestamp(); !t.IsZero() {
+		ev.Timestamp = &t
+	}
+
+	return ev
+}
+
+// Stream is an http.Handler streaming the entries appended to or joined
+// into a log as server-sent events, so pages can follow a log without
+// polling. Each event is named "entry", its ID is the entry hash and its
+// data an Event. An "error" event whose data is the error message is sent
+// when the entries of an update can't be loaded, some entries might then
+// be missing from the stream.
+type Stream struct {
+	options StreamOptions
+
+	lock    sync.Mutex
+	known   *cid.Set
+	clients map[chan []byte]struct{}
+	done    chan struct{}
+	closed  bool
+
+	unsubscribe func()
+}
+
+// NewStream streams the entries added to the log from now on, it relies on
+// log.OnUpdate and must be created while the log isn't modified
+func NewStream(l *log.Log, options *StreamOptions) (*Stream, error) {
+	if options == nil {
+		options = &StreamOptions{}
+	}
+
+	s := &Stream{
+		options: *options,
+		known:   cid.NewSet(),
+		clients: map[chan []byte]struct{}{},
+		done:    make(chan struct{}),
+	}
+
+	if s.options.Buffer <= 0 {
+		s.options.Buffer = DefaultBuffer
+	}
+
+	values, err := l.ValuesE()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the entries of the log")
+	}
+
+	for _, e := range values.Slice() {
+		s.known.Add(e.GetHash())
+	}
+
+	s.unsubscribe = l.OnUpdate(s.update)
+
+	return s, nil
+}
+
+// update is called by the log, in the goroutine modifying it
+func (s *Stream) update(l *log.Log) {
+	s.lock.Lock()
+	closed := s.closed
+	s.lock.Unlock()
+
+	if closed {
+		return
+	}
+
+	added := []iface.IPFSLogEntry{}
+
+	stack := l.GetHeads()
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !s.known.Visit(e.GetHash()) {
+			continue
+		}
+
+		added = append(added, e)
+
+		for _, n := range e.GetNext() {
+			if s.known.Has(n) {
+				continue
+			}
+
+			next, ok, err := l.GetEntryE(n)
+			if err != nil {
+				data, _ := json.Marshal(err.Error())
+				s.broadcast([]byte(fmt.Sprintf("event: error\ndata: %s\n\n", data)))
+				continue
+			}
+
+			if ok {
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	entry.Sort(l.SortFn, added)
+
+	for _, e := range added {
+		data, err := json.Marshal(newEvent(e))
+		if err != nil {
+			continue
+		}
+
+		s.broadcast([]byte(fmt.Sprintf("id: %s\nevent: entry\ndata: %s\n\n", io.CIDString(e.GetHash()), data)))
+	}
+}
+
+// broadcast sends the event to every client, disconnecting the clients
+// whose buffer is full
+func (s *Stream) broadcast(event []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for c := range s.clients {
+		select {
+		case c <- event:
+		default:
+			delete(s.clients, c)
+			close(c)
+		}
+	}
+}
+
+// ServeHTTP streams the events until the client disconnects, falls behind
+// or the stream is closed
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan []byte, s.options.Buffer)
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		http.Error(w, "stream closed", http.StatusServiceUnavailable)
+		return
+	}
+	s.clients[events] = struct{}{}
+	s.lock.Unlock()
+
+	defer s.remove(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if s.options.Heartbeat > 0 {
+		ticker := time.NewTicker(s.options.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+
+		case <-heartbeat:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+
+		case <-s.done:
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (s *Stream) remove(events chan []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.clients[events]; ok {
+		delete(s.clients, events)
+		close(events)
+	}
+}
+
+// Clients returns the number of connected clients
+func (s *Stream) Clients() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.clients)
+}
+
+// Close stops following the log and disconnects the clients, no client can
+// connect anymore
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.unsubscribe()
+		close(s.done)
+	}
+
+	return nil
+}
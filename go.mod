@@ -1,22 +1,106 @@
 module berty.tech/go-ipfs-log
 
-go 1.12
+go 1.18
 
 require (
 	github.com/btcsuite/btcd v0.0.0-20190213025234-306aecffea32
+	github.com/gogo/protobuf v1.2.1
 	github.com/hashicorp/golang-lru v0.5.1
 	github.com/iancoleman/orderedmap v0.0.0-20190318233801-ac98e3ecb4b0
+	github.com/ipfs/bbloom v0.0.1
+	github.com/ipfs/go-bitswap v0.0.4
+	github.com/ipfs/go-block-format v0.0.2
 	github.com/ipfs/go-blockservice v0.0.3
-	github.com/ipfs/go-cid v0.0.1
+	github.com/ipfs/go-cid v0.0.4
 	github.com/ipfs/go-datastore v0.0.5
+	github.com/ipfs/go-ds-badger v0.0.3
 	github.com/ipfs/go-ipfs v0.4.20
 	github.com/ipfs/go-ipfs-blockstore v0.0.1
+	github.com/ipfs/go-ipfs-chunker v0.0.1
+	github.com/ipfs/go-ipfs-exchange-interface v0.0.1
 	github.com/ipfs/go-ipfs-exchange-offline v0.0.1
+	github.com/ipfs/go-ipfs-routing v0.0.1
 	github.com/ipfs/go-ipld-cbor v0.0.1
 	github.com/ipfs/go-ipld-format v0.0.1
 	github.com/ipfs/go-merkledag v0.0.3
+	github.com/ipfs/go-unixfs v0.0.4
+	github.com/ipfs/interface-go-ipfs-core v0.0.6
+	github.com/ipld/go-ipld-prime v0.12.3
+	github.com/libp2p/go-libp2p v0.0.12
 	github.com/libp2p/go-libp2p-crypto v0.0.2
-	github.com/pkg/errors v0.8.1
-	github.com/polydawn/refmt v0.0.0-20190221155625-df39d6c2d992
-	github.com/smartystreets/goconvey v0.0.0-20190222223459-a17d461953aa
+	github.com/libp2p/go-libp2p-host v0.0.1
+	github.com/libp2p/go-libp2p-net v0.0.2
+	github.com/libp2p/go-libp2p-peer v0.0.1
+	github.com/libp2p/go-libp2p-peerstore v0.0.2
+	github.com/libp2p/go-libp2p-protocol v0.0.1
+	github.com/libp2p/go-libp2p-routing v0.0.1
+	github.com/multiformats/go-multibase v0.0.1
+	github.com/multiformats/go-multihash v0.0.15
+	github.com/pkg/errors v0.9.1
+	github.com/polydawn/refmt v0.0.0-20201211092308-30ac6d18308e
+	github.com/smartystreets/goconvey v1.6.4
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
+)
+
+require (
+	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
+	github.com/Stebalien/go-bitfield v0.0.0-20180330043415-076a62f9ce6e // indirect
+	github.com/coreos/go-semver v0.2.0 // indirect
+	github.com/cskr/pubsub v1.0.2 // indirect
+	github.com/dgraph-io/badger v2.0.0-rc.2+incompatible // indirect
+	github.com/dgryski/go-farm v0.0.0-20190104051053-3adb47b1fb0f // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/golang/protobuf v1.3.0 // indirect
+	github.com/google/uuid v1.1.1 // indirect
+	github.com/gopherjs/gopherjs v0.0.0-20181017120253-0766667cb4d1 // indirect
+	github.com/huin/goupnp v1.0.0 // indirect
+	github.com/ipfs/go-ipfs-delay v0.0.1 // indirect
+	github.com/ipfs/go-ipfs-ds-help v0.0.1 // indirect
+	github.com/ipfs/go-ipfs-files v0.0.2 // indirect
+	github.com/ipfs/go-ipfs-flags v0.0.1 // indirect
+	github.com/ipfs/go-ipfs-posinfo v0.0.1 // indirect
+	github.com/ipfs/go-ipfs-pq v0.0.1 // indirect
+	github.com/ipfs/go-ipfs-util v0.0.1 // indirect
+	github.com/ipfs/go-log v0.0.1 // indirect
+	github.com/ipfs/go-metrics-interface v0.0.1 // indirect
+	github.com/ipfs/go-path v0.0.3 // indirect
+	github.com/ipfs/go-verifcid v0.0.1 // indirect
+	github.com/jackpal/gateway v1.0.5 // indirect
+	github.com/jackpal/go-nat-pmp v1.0.1 // indirect
+	github.com/jbenet/goprocess v0.0.0-20160826012719-b497e2f366b8 // indirect
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/klauspost/cpuid/v2 v2.0.4 // indirect
+	github.com/koron/go-ssdp v0.0.0-20180514024734-4a0ed625a78b // indirect
+	github.com/libp2p/go-buffer-pool v0.0.1 // indirect
+	github.com/libp2p/go-libp2p-interface-connmgr v0.0.1 // indirect
+	github.com/libp2p/go-libp2p-loggables v0.0.1 // indirect
+	github.com/libp2p/go-libp2p-nat v0.0.4 // indirect
+	github.com/libp2p/go-libp2p-netutil v0.0.1 // indirect
+	github.com/libp2p/go-libp2p-record v0.0.1 // indirect
+	github.com/libp2p/go-nat v0.0.3 // indirect
+	github.com/libp2p/go-stream-muxer v0.0.1 // indirect
+	github.com/libp2p/go-testutil v0.0.1 // indirect
+	github.com/mattn/go-colorable v0.1.1 // indirect
+	github.com/mattn/go-isatty v0.0.5 // indirect
+	github.com/minio/blake2b-simd v0.0.0-20160723061019-3f5f724cb5b1 // indirect
+	github.com/minio/sha256-simd v1.0.0 // indirect
+	github.com/mr-tron/base58 v1.2.0 // indirect
+	github.com/multiformats/go-base32 v0.0.3 // indirect
+	github.com/multiformats/go-multiaddr v0.0.1 // indirect
+	github.com/multiformats/go-multiaddr-dns v0.0.2 // indirect
+	github.com/multiformats/go-multiaddr-net v0.0.1 // indirect
+	github.com/multiformats/go-multistream v0.0.1 // indirect
+	github.com/multiformats/go-varint v0.0.6 // indirect
+	github.com/opentracing/opentracing-go v1.0.2 // indirect
+	github.com/smartystreets/assertions v0.0.0-20180927180507-b2de0cb4f26d // indirect
+	github.com/spacemonkeygo/openssl v0.0.0-20181017203307-c2dcc5cca94a // indirect
+	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/whyrusleeping/chunker v0.0.0-20181014151217-fe64bd25879f // indirect
+	github.com/whyrusleeping/go-logging v0.0.0-20170515211332-0457bb6b88fc // indirect
+	github.com/whyrusleeping/go-notifier v0.0.0-20170827234753-097c5d47330f // indirect
+	github.com/whyrusleeping/mafmt v1.2.8 // indirect
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3 // indirect
+	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2 // indirect
+	golang.org/x/text v0.3.0 // indirect
 )
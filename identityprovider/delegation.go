@@ -0,0 +1,194 @@
+package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// KeyDelegation allows a device key to sign entries on behalf of an identity,
+// it is signed by the issuer key which is either the current key of the
+// identity or the key of a previous delegation
+type KeyDelegation struct {
+	Issuer    []byte
+	Delegate  []byte
+	Signature []byte
+}
+
+type CborKeyDelegation struct {
+	Issuer    string
+	Delegate  string
+	Signature string
+}
+
+// delegationStatement returns the data signed by the issuer of a delegation
+func delegationStatement(issuer, delegate []byte) []byte {
+	return []byte("delegate:" + hex.EncodeToString(issuer) + ":" + hex.EncodeToString(delegate))
+}
+
+// Verify checks the signature of the issuer over the delegation
+func (d *KeyDelegation) Verify() error {
+	pubKey, err := UnmarshalPublicKey(d.Issuer)
+	if err != nil {
+		return errors.Wrap(err, "unable to unmarshal delegation issuer")
+	}
+
+	ok, err := pubKey.Verify(delegationStatement(d.Issuer, d.Delegate), d.Signature)
+	if err != nil {
+		return errors.Wrap(err, "unable to verify delegation signature")
+	}
+
+	if !ok {
+		return errors.New("delegation signature is invalid")
+	}
+
+	return nil
+}
+
+// DelegatedKeys returns the keys the identity delegated signing to, in order.
+// The delegations are checked to form a chain starting from the current key
+// of the identity, delegations issued by a key that was since rotated out
+// are rejected.
+func (i *Identity) DelegatedKeys() ([][]byte, error) {
+	if len(i.Delegations) == 0 {
+		return nil, nil
+	}
+
+	keys, err := i.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(keys[len(keys)-1], i.Delegations[0].Issuer) {
+		return nil, errors.New("delegation isn't issued by the current key of the identity")
+	}
+
+	delegated := [][]byte{}
+	for n, d := range i.Delegations {
+		if n > 0 && !bytes.Equal(d.Issuer, i.Delegations[n-1].Delegate) {
+			return nil, errors.New("delegation doesn't follow the previous one")
+		}
+
+		if err := d.Verify(); err != nil {
+			return nil, err
+		}
+
+		delegated = append(delegated, d.Delegate)
+	}
+
+	return delegated, nil
+}
+
+// Delegate allows the given device key to sign entries for the identity, the
+// delegation is signed by the current signing key of the identity
+func (i *Identities) Delegate(identity *Identity, deviceKey []byte) (*KeyDelegation, error) {
+	issuer, err := i.keyStore.GetKey(identity.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the signing key")
+	}
+
+	issuerKey, err := rawPublicKey(issuer.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := issuer.Sign(delegationStatement(issuerKey, deviceKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign delegation")
+	}
+
+	return &KeyDelegation{
+		Issuer:    issuerKey,
+		Delegate:  deviceKey,
+		Signature: sig,
+	}, nil
+}
+
+// CreateDeviceKey creates the key of a device signing for the identity with
+// the given ID, its public key is to be delegated by the identity
+func (i *Identities) CreateDeviceKey(id string) ([]byte, error) {
+	private, err := i.keyStore.CreateKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return rawPublicKey(private.GetPublic())
+}
+
+// DelegatedIdentity returns the identity signing entries with the device key
+// stored in the keystore, as allowed by the delegations
+func (i *Identities) DelegatedIdentity(identity *Identity, delegations ...*KeyDelegation) (*Identity, error) {
+	newProvider, err := GetHandlerFor(identity.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	delegated := identity.Filtered()
+	delegated.Delegations = append(append([]*KeyDelegation{}, identity.Delegations...), delegations...)
+	delegated.Provider = newProvider(&CreateIdentityOptions{Keystore: i.keyStore})
+
+	if _, err := delegated.DelegatedKeys(); err != nil {
+		return nil, err
+	}
+
+	private, err := i.keyStore.GetKey(identity.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the device key")
+	}
+
+	deviceKey, err := rawPublicKey(private.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(deviceKey, delegated.SigningKey()) {
+		return nil, errors.New("device key isn't delegated")
+	}
+
+	return delegated, nil
+}
+
+func (d *KeyDelegation) ToCborKeyDelegation() *CborKeyDelegation {
+	return &CborKeyDelegation{
+		Issuer:    hex.EncodeToString(d.Issuer),
+		Delegate:  hex.EncodeToString(d.Delegate),
+		Signature: hex.EncodeToString(d.Signature),
+	}
+}
+
+func (c *CborKeyDelegation) ToKeyDelegation() (*KeyDelegation, error) {
+	issuer, err := hex.DecodeString(c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	delegate, err := hex.DecodeString(c.Delegate)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyDelegation{
+		Issuer:    issuer,
+		Delegate:  delegate,
+		Signature: sig,
+	}, nil
+}
+
+var AtlasKeyDelegation = atlas.BuildEntry(CborKeyDelegation{}).
+	StructMap().
+	AddField("Issuer", atlas.StructMapEntry{SerialName: "issuer"}).
+	AddField("Delegate", atlas.StructMapEntry{SerialName: "delegate"}).
+	AddField("Signature", atlas.StructMapEntry{SerialName: "signature"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(AtlasKeyDelegation)
+}
@@ -0,0 +1,107 @@
+package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"berty.tech/go-ipfs-log/keystore"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+)
+
+// Ed25519Type is the type of the identities created by the Ed25519 provider
+const Ed25519Type = "ed25519"
+
+// Ed25519IdentityProvider creates identities signing entries with Ed25519
+// keys, the native key type of libp2p
+type Ed25519IdentityProvider struct {
+	keystore keystore.Interface
+}
+
+func NewEd25519IdentityProvider(options *CreateIdentityOptions) Interface {
+	p := &Ed25519IdentityProvider{}
+	if options != nil {
+		p.keystore = options.Keystore
+	}
+
+	return p
+}
+
+// getOrCreateKey returns the Ed25519 key stored for id, creating it when
+// missing
+func (p *Ed25519IdentityProvider) getOrCreateKey(id string) (crypto.PrivKey, error) {
+	if p.keystore == nil {
+		return nil, errors.New("a keystore is required")
+	}
+
+	if private, err := p.keystore.GetKey(id); err == nil && private != nil {
+		if private.Type() != crypto.Ed25519 {
+			return nil, errors.New(fmt.Sprintf("key for %s isn't an Ed25519 key", id))
+		}
+
+		return private, nil
+	}
+
+	ks, ok := p.keystore.(keystore.TypedInterface)
+	if !ok {
+		return nil, errors.New("keystore can't create Ed25519 keys")
+	}
+
+	return ks.CreateKeyWithType(id, crypto.Ed25519)
+}
+
+func (p *Ed25519IdentityProvider) GetID(options *CreateIdentityOptions) (string, error) {
+	private, err := p.getOrCreateKey(options.ID)
+	if err != nil {
+		return "", err
+	}
+
+	pubBytes, err := private.GetPublic().Raw()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(pubBytes), nil
+}
+
+func (p *Ed25519IdentityProvider) SignIdentity(data []byte, id string) ([]byte, error) {
+	key, err := p.keystore.GetKey(id)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Signing key for %s not found", id))
+	}
+
+	// Signs the hex encoded data like the orbitdb provider
+	return key.Sign([]byte(hex.EncodeToString(data)))
+}
+
+func (p *Ed25519IdentityProvider) Sign(identity *Identity, data []byte) ([]byte, error) {
+	return p.SignContext(context.Background(), identity, data)
+}
+
+// SignContext signs data with the key of the identity through the keystore
+func (p *Ed25519IdentityProvider) SignContext(ctx context.Context, identity *Identity, data []byte) ([]byte, error) {
+	key, err := p.keystore.GetKey(identity.ID)
+	if err != nil {
+		return nil, errors.New("Private signing key not found from Keystore")
+	}
+
+	return keystore.SignContext(ctx, p.keystore, key, data)
+}
+
+// VerifyIdentity checks that the public key of the identity is signed by
+// the key its ID is derived from
+func (p *Ed25519IdentityProvider) VerifyIdentity(identity *Identity) error {
+	return verifyPublicKeySignature(identity, crypto.UnmarshalEd25519PublicKey)
+}
+
+// KeyType returns the type of the keys signing the entries
+func (*Ed25519IdentityProvider) KeyType() int {
+	return crypto.Ed25519
+}
+
+func (*Ed25519IdentityProvider) GetType() string {
+	return Ed25519Type
+}
+
+var _ Interface = &Ed25519IdentityProvider{}
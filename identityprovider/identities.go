@@ -1,6 +1,7 @@
 package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 
@@ -11,7 +12,9 @@ import (
 )
 
 var supportedTypes = map[string]func(*CreateIdentityOptions) Interface{
-	"orbitdb": NewOrbitDBIdentityProvider,
+	"orbitdb":   NewOrbitDBIdentityProvider,
+	Ed25519Type: NewEd25519IdentityProvider,
+	SignerType:  NewSignerIdentityProvider,
 }
 var identityKeysPath = "./orbitdb/identity/identitykeys"
 
@@ -34,12 +37,18 @@ func NewIdentities(keyStore keystore.Interface) *Identities {
 }
 
 func (i *Identities) Sign(identity *Identity, data []byte) ([]byte, error) {
+	return i.SignContext(context.Background(), identity, data)
+}
+
+// SignContext signs data with the key of the identity, the context is passed
+// to the keystore
+func (i *Identities) SignContext(ctx context.Context, identity *Identity, data []byte) ([]byte, error) {
 	privKey, err := i.keyStore.GetKey(identity.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	sig, err := i.keyStore.Sign(privKey, data)
+	sig, err := keystore.SignContext(ctx, i.keyStore, privKey, data)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +60,12 @@ func (i *Identities) Verify(signature []byte, publicKey crypto.PubKey, data []by
 	return publicKey.Verify(data, signature)
 }
 
+// VerifyContext verifies the signature through the keystore, the context is
+// passed to the keystore
+func (i *Identities) VerifyContext(ctx context.Context, signature []byte, publicKey crypto.PubKey, data []byte) error {
+	return keystore.VerifyContext(ctx, i.keyStore, signature, publicKey, data)
+}
+
 type MigrateOptions struct {
 	TargetPath string
 	TargetId   string
@@ -76,11 +91,29 @@ func (i *Identities) CreateIdentity(options *CreateIdentityOptions) (*Identity,
 	}
 
 	identityProvider := NewIdentityProvider(options)
+
+	keyType := crypto.Secp256k1
+	if typed, ok := identityProvider.(keyTyped); ok {
+		keyType = typed.KeyType()
+	}
+
+	if options.Seed != nil {
+		if err := i.deriveKey(options.ID, options, "/0'", keyType); err != nil {
+			return nil, err
+		}
+	}
+
 	id, err := identityProvider.GetID(options)
 	if err != nil {
 		return nil, err
 	}
 
+	if options.Seed != nil {
+		if err := i.deriveKey(id, options, "/1'", keyType); err != nil {
+			return nil, err
+		}
+	}
+
 	// FIXME ?
 	//if options.Migrate != nil {
 	//	if err := options.Migrate(&MigrateOptions{ TargetPath: i.keyStore.Path, TargetId: id }); err != nil {
@@ -88,7 +121,7 @@ func (i *Identities) CreateIdentity(options *CreateIdentityOptions) (*Identity,
 	//	}
 	//}
 
-	publicKey, idSignature, err := i.SignID(id)
+	publicKey, idSignature, err := i.signID(id, keyType)
 	if err != nil {
 		return nil, err
 	}
@@ -98,9 +131,11 @@ func (i *Identities) CreateIdentity(options *CreateIdentityOptions) (*Identity,
 		return nil, err
 	}
 
-	publicKeyBytes, err = compressedToUncompressedS256Key(publicKeyBytes)
-	if err != nil {
-		return nil, err
+	if keyType == crypto.Secp256k1 {
+		publicKeyBytes, err = compressedToUncompressedS256Key(publicKeyBytes)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	pubKeyIdSignature, err := identityProvider.SignIdentity(append(publicKeyBytes, idSignature...), options.ID)
@@ -120,10 +155,47 @@ func (i *Identities) CreateIdentity(options *CreateIdentityOptions) (*Identity,
 	}, nil
 }
 
+// deriveKey stores the key derived from the seed of the options for id,
+// unless a key is already stored
+func (i *Identities) deriveKey(id string, options *CreateIdentityOptions, child string, keyType int) error {
+	if _, err := i.keyStore.GetKey(id); err == nil {
+		return nil
+	}
+
+	ks, ok := i.keyStore.(keystore.TypedInterface)
+	if !ok {
+		return errors.New("keystore can't store derived keys")
+	}
+
+	path := options.DerivationPath
+	if path == "" {
+		path = "m"
+	}
+
+	key, err := keystore.DeriveKey(options.Seed, path+child, keyType)
+	if err != nil {
+		return errors.Wrap(err, "unable to derive key")
+	}
+
+	return ks.PutKey(id, key)
+}
+
 func (i *Identities) SignID(id string) (crypto.PubKey, []byte, error) {
+	return i.signID(id, crypto.Secp256k1)
+}
+
+// signID signs the id with its key, creating a key of the given type when
+// missing
+func (i *Identities) signID(id string, keyType int) (crypto.PubKey, []byte, error) {
 	privKey, err := i.keyStore.GetKey(id)
 	if err != nil {
-		privKey, err = i.keyStore.CreateKey(id)
+		if keyType == crypto.Secp256k1 {
+			privKey, err = i.keyStore.CreateKey(id)
+		} else if ks, ok := i.keyStore.(keystore.TypedInterface); ok {
+			privKey, err = ks.CreateKeyWithType(id, keyType)
+		} else {
+			err = errors.New("keystore can't create keys of this type")
+		}
 
 		if err != nil {
 			return nil, nil, err
@@ -26,34 +26,94 @@ type Identity struct {
 	Signatures *IdentitySignature
 	Type       string
 	Provider   Interface
+
+	// Rotations lists the keys which replaced PublicKey to sign entries
+	Rotations []*KeyRotation
+
+	// Delegations allows a device key to sign entries for the identity
+	Delegations []*KeyDelegation
 }
 
 type CborIdentity struct {
-	ID         string
-	PublicKey  string
-	Signatures *CborIdentitySignature
-	Type       string
+	ID          string
+	PublicKey   string
+	Signatures  *CborIdentitySignature
+	Type        string
+	Rotations   []*CborKeyRotation
+	Delegations []*CborKeyDelegation
 }
 
 func (i *Identity) Filtered() *Identity {
 	return &Identity{
-		ID:         i.ID,
-		PublicKey:  i.PublicKey,
-		Signatures: i.Signatures,
-		Type:       i.Type,
+		ID:          i.ID,
+		PublicKey:   i.PublicKey,
+		Signatures:  i.Signatures,
+		Type:        i.Type,
+		Rotations:   i.Rotations,
+		Delegations: i.Delegations,
 	}
 }
 
 func (i *Identity) GetPublicKey() (ic.PubKey, error) {
-	return ic.UnmarshalPublicKey(i.PublicKey)
+	return UnmarshalPublicKey(i.PublicKey)
+}
+
+// ed25519PublicKeySize is the size of raw Ed25519 public keys, secp256k1
+// keys are either 33 or 65 bytes long
+const ed25519PublicKeySize = 32
+
+// UnmarshalPublicKey decodes a raw public key as stored in identities and
+// entries, either an Ed25519 or a secp256k1 key
+func UnmarshalPublicKey(data []byte) (ic.PubKey, error) {
+	if len(data) == ed25519PublicKeySize {
+		return ic.UnmarshalEd25519PublicKey(data)
+	}
+
+	return ic.UnmarshalSecp256k1PublicKey(data)
+}
+
+// verifyPublicKeySignature checks that the public key of the identity and
+// the signature of its ID are signed by the key the ID is the hex encoding
+// of, decoded with unmarshal
+func verifyPublicKeySignature(identity *Identity, unmarshal func([]byte) (ic.PubKey, error)) error {
+	if identity.Signatures == nil {
+		return errors.New("identity doesn't have signatures")
+	}
+
+	idBytes, err := hex.DecodeString(identity.ID)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode identity ID")
+	}
+
+	pubKey, err := unmarshal(idBytes)
+	if err != nil {
+		return errors.Wrap(err, "unable to unmarshal identity ID")
+	}
+
+	data := []byte(hex.EncodeToString(append(append([]byte{}, identity.PublicKey...), identity.Signatures.ID...)))
+
+	ok, err := pubKey.Verify(data, identity.Signatures.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to verify identity signature")
+	}
+
+	if !ok {
+		return errors.New("identity public key signature is invalid")
+	}
+
+	return nil
 }
 
+// Fields are declared in canonical order (shorter keys first, then
+// bytewise) so entries carrying the identity are encoded as canonical CBOR
 var AtlasIdentity = atlas.BuildEntry(CborIdentity{}).
 	StructMap().
 	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
 	AddField("Type", atlas.StructMapEntry{SerialName: "type"}).
 	AddField("PublicKey", atlas.StructMapEntry{SerialName: "publicKey"}).
+	AddField("Rotations", atlas.StructMapEntry{SerialName: "rotations", OmitEmpty: true}).
 	AddField("Signatures", atlas.StructMapEntry{SerialName: "signatures"}).
+	AddField("Delegations", atlas.StructMapEntry{SerialName: "delegations", OmitEmpty: true}).
 	Complete()
 
 var AtlasIdentitySignature = atlas.BuildEntry(CborIdentitySignature{}).
@@ -97,12 +157,22 @@ func init() {
 }
 
 func (i *Identity) ToCborIdentity() *CborIdentity {
-	return &CborIdentity{
+	c := &CborIdentity{
 		ID:         i.ID,
 		PublicKey:  hex.EncodeToString(i.PublicKey),
 		Type:       i.Type,
 		Signatures: i.Signatures.ToCborIdentitySignatures(),
 	}
+
+	for _, r := range i.Rotations {
+		c.Rotations = append(c.Rotations, r.ToCborKeyRotation())
+	}
+
+	for _, d := range i.Delegations {
+		c.Delegations = append(c.Delegations, d.ToCborKeyDelegation())
+	}
+
+	return c
 }
 
 func (c *CborIdentity) ToIdentity(provider Interface) (*Identity, error) {
@@ -116,13 +186,33 @@ func (c *CborIdentity) ToIdentity(provider Interface) (*Identity, error) {
 		return nil, err
 	}
 
-	return &Identity{
+	identity := &Identity{
 		Signatures: idSignatures,
 		PublicKey:  publicKey,
 		Type:       c.Type,
 		ID:         c.ID,
 		Provider:   provider,
-	}, nil
+	}
+
+	for _, r := range c.Rotations {
+		rotation, err := r.ToKeyRotation()
+		if err != nil {
+			return nil, err
+		}
+
+		identity.Rotations = append(identity.Rotations, rotation)
+	}
+
+	for _, d := range c.Delegations {
+		delegation, err := d.ToKeyDelegation()
+		if err != nil {
+			return nil, err
+		}
+
+		identity.Delegations = append(identity.Delegations, delegation)
+	}
+
+	return identity, nil
 }
 
 func (i *IdentitySignature) ToCborIdentitySignatures() *CborIdentitySignature {
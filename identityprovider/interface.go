@@ -1,6 +1,10 @@
 package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
 
-import "berty.tech/go-ipfs-log/keystore"
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/keystore"
+)
 
 type CreateIdentityOptions struct {
 	IdentityKeysPath string
@@ -8,6 +12,15 @@ type CreateIdentityOptions struct {
 	Keystore         keystore.Interface
 	Migrate          func(*MigrateOptions) error
 	ID               string
+
+	// Seed derives the keys of the identity instead of generating them,
+	// see keystore.SeedFromMnemonic
+	Seed []byte
+
+	// DerivationPath is the SLIP-10 path the keys are derived at, such as
+	// m/44'/0'/0' with one path per log. The key of the ID is derived at
+	// its child 0' and the signing key at its child 1'.
+	DerivationPath string
 }
 
 type Interface interface {
@@ -24,3 +37,15 @@ type Interface interface {
 
 	Sign(identity *Identity, bytes []byte) ([]byte, error)
 }
+
+// ContextSigner is implemented by the providers whose signing honors the
+// deadline and cancellation of a context
+type ContextSigner interface {
+	SignContext(ctx context.Context, identity *Identity, bytes []byte) ([]byte, error)
+}
+
+// keyTyped is implemented by the providers whose identities sign entries
+// with other keys than secp256k1
+type keyTyped interface {
+	KeyType() int
+}
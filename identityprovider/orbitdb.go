@@ -1,10 +1,12 @@
 package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 
 	"berty.tech/go-ipfs-log/keystore"
+	crypto "github.com/libp2p/go-libp2p-crypto"
 	"github.com/pkg/errors"
 )
 
@@ -12,14 +14,19 @@ type OrbitDBIdentityProvider struct {
 	keystore keystore.Interface
 }
 
+// VerifyIdentity checks that the public key of the identity is signed by
+// the secp256k1 key its ID is derived from
 func (p *OrbitDBIdentityProvider) VerifyIdentity(identity *Identity) error {
-	panic("implement me")
+	return verifyPublicKeySignature(identity, crypto.UnmarshalSecp256k1PublicKey)
 }
 
 func NewOrbitDBIdentityProvider(options *CreateIdentityOptions) Interface {
-	return &OrbitDBIdentityProvider{
-		keystore: options.Keystore,
+	p := &OrbitDBIdentityProvider{}
+	if options != nil {
+		p.keystore = options.Keystore
 	}
+
+	return p
 }
 
 func (p *OrbitDBIdentityProvider) GetID(options *CreateIdentityOptions) (string, error) {
@@ -59,12 +66,17 @@ func (p *OrbitDBIdentityProvider) SignIdentity(data []byte, id string) ([]byte,
 }
 
 func (p *OrbitDBIdentityProvider) Sign(identity *Identity, data []byte) ([]byte, error) {
+	return p.SignContext(context.Background(), identity, data)
+}
+
+// SignContext signs data with the key of the identity through the keystore
+func (p *OrbitDBIdentityProvider) SignContext(ctx context.Context, identity *Identity, data []byte) ([]byte, error) {
 	key, err := p.keystore.GetKey(identity.ID)
 	if err != nil {
 		return nil, errors.New("Private signing key not found from Keystore")
 	}
 
-	sig, err := key.Sign(data)
+	sig, err := keystore.SignContext(ctx, p.keystore, key, data)
 	if err != nil {
 		return nil, err
 	}
@@ -77,3 +89,4 @@ func (*OrbitDBIdentityProvider) GetType() string {
 }
 
 var _ Interface = &OrbitDBIdentityProvider{}
+var _ ContextSigner = &OrbitDBIdentityProvider{}
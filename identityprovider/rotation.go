@@ -0,0 +1,252 @@
+package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"berty.tech/go-ipfs-log/keystore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// KeyRotation is a statement replacing the signing key of an identity, it is
+// signed by both the previous and the next key
+type KeyRotation struct {
+	PreviousKey       []byte
+	NextKey           []byte
+	PreviousSignature []byte
+	NextSignature     []byte
+}
+
+type CborKeyRotation struct {
+	PreviousKey       string
+	NextKey           string
+	PreviousSignature string
+	NextSignature     string
+}
+
+// rotationStatement returns the data signed by both keys of a rotation
+func rotationStatement(previous, next []byte) []byte {
+	return []byte("rotate:" + hex.EncodeToString(previous) + ":" + hex.EncodeToString(next))
+}
+
+// NewKeyRotation creates a rotation from the previous key to the next one
+func NewKeyRotation(previous, next ic.PrivKey) (*KeyRotation, error) {
+	previousKey, err := rawPublicKey(previous.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	nextKey, err := rawPublicKey(next.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	statement := rotationStatement(previousKey, nextKey)
+
+	previousSig, err := previous.Sign(statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign rotation with the previous key")
+	}
+
+	nextSig, err := next.Sign(statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign rotation with the next key")
+	}
+
+	return &KeyRotation{
+		PreviousKey:       previousKey,
+		NextKey:           nextKey,
+		PreviousSignature: previousSig,
+		NextSignature:     nextSig,
+	}, nil
+}
+
+// Verify checks the signatures of both keys over the rotation
+func (r *KeyRotation) Verify() error {
+	statement := rotationStatement(r.PreviousKey, r.NextKey)
+
+	for _, s := range []struct {
+		key []byte
+		sig []byte
+	}{{r.PreviousKey, r.PreviousSignature}, {r.NextKey, r.NextSignature}} {
+		pubKey, err := UnmarshalPublicKey(s.key)
+		if err != nil {
+			return errors.Wrap(err, "unable to unmarshal rotation key")
+		}
+
+		ok, err := pubKey.Verify(statement, s.sig)
+		if err != nil {
+			return errors.Wrap(err, "unable to verify rotation signature")
+		}
+
+		if !ok {
+			return errors.New("rotation signature is invalid")
+		}
+	}
+
+	return nil
+}
+
+// Keys returns the keys the identity signed with, in order, starting with
+// its public key. The rotations are checked to form a chain.
+func (i *Identity) Keys() ([][]byte, error) {
+	keys := [][]byte{i.PublicKey}
+
+	for _, r := range i.Rotations {
+		if !bytes.Equal(r.PreviousKey, keys[len(keys)-1]) {
+			return nil, errors.New("rotation doesn't follow the previous key")
+		}
+
+		if err := r.Verify(); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, r.NextKey)
+	}
+
+	return keys, nil
+}
+
+// SigningKey returns the key currently used to sign entries, the last
+// delegated key or else the public key of the identity unless it was rotated
+func (i *Identity) SigningKey() []byte {
+	if len(i.Delegations) > 0 {
+		return i.Delegations[len(i.Delegations)-1].Delegate
+	}
+
+	if len(i.Rotations) > 0 {
+		return i.Rotations[len(i.Rotations)-1].NextKey
+	}
+
+	return i.PublicKey
+}
+
+// HasKey checks that the key is the public key of the identity, one it was
+// rotated to or one it delegated signing to
+func (i *Identity) HasKey(key []byte) error {
+	keys, err := i.Keys()
+	if err != nil {
+		return err
+	}
+
+	delegated, err := i.DelegatedKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range append(keys, delegated...) {
+		if bytes.Equal(k, key) {
+			return nil
+		}
+	}
+
+	return errors.New("key doesn't belong to the identity")
+}
+
+// RotateKey replaces the signing key of the identity, the new key is stored
+// in the keystore in place of the previous one and the returned identity
+// carries the rotation proving the continuity between both keys. The
+// delegations issued by the previous key are dropped, they have to be issued
+// again by the new key.
+func (i *Identities) RotateKey(identity *Identity) (*Identity, error) {
+	previous, err := i.keyStore.GetKey(identity.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the signing key")
+	}
+
+	var next ic.PrivKey
+	if previous.Type() == ic.Secp256k1 {
+		next, err = i.keyStore.CreateKey(identity.ID)
+	} else if ks, ok := i.keyStore.(keystore.TypedInterface); ok {
+		next, err = ks.CreateKeyWithType(identity.ID, int(previous.Type()))
+	} else {
+		err = errors.New("keystore can't create keys of this type")
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the next signing key")
+	}
+
+	rotation, err := NewKeyRotation(previous, next)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := identity.Filtered()
+	rotated.Provider = identity.Provider
+	rotated.Rotations = append(append([]*KeyRotation{}, identity.Rotations...), rotation)
+	rotated.Delegations = nil
+
+	return rotated, nil
+}
+
+// RotateKey replaces the signing key of the identity using its keystore
+func RotateKey(identity *Identity, ks keystore.Interface) (*Identity, error) {
+	if ks == nil {
+		return nil, errors.New("a keystore is required")
+	}
+
+	return NewIdentities(ks).RotateKey(identity)
+}
+
+// rawPublicKey returns the public key as stored in identities, secp256k1
+// keys being uncompressed
+func rawPublicKey(key ic.PubKey) ([]byte, error) {
+	raw, err := key.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type() == ic.Secp256k1 {
+		return compressedToUncompressedS256Key(raw)
+	}
+
+	return raw, nil
+}
+
+func (r *KeyRotation) ToCborKeyRotation() *CborKeyRotation {
+	return &CborKeyRotation{
+		PreviousKey:       hex.EncodeToString(r.PreviousKey),
+		NextKey:           hex.EncodeToString(r.NextKey),
+		PreviousSignature: hex.EncodeToString(r.PreviousSignature),
+		NextSignature:     hex.EncodeToString(r.NextSignature),
+	}
+}
+
+func (c *CborKeyRotation) ToKeyRotation() (*KeyRotation, error) {
+	fields := []string{c.PreviousKey, c.NextKey, c.PreviousSignature, c.NextSignature}
+	decoded := make([][]byte, len(fields))
+
+	for i, f := range fields {
+		b, err := hex.DecodeString(f)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded[i] = b
+	}
+
+	return &KeyRotation{
+		PreviousKey:       decoded[0],
+		NextKey:           decoded[1],
+		PreviousSignature: decoded[2],
+		NextSignature:     decoded[3],
+	}, nil
+}
+
+// Fields are declared in canonical order (shorter keys first, then
+// bytewise) so entries carrying the rotation are encoded as canonical CBOR
+var AtlasKeyRotation = atlas.BuildEntry(CborKeyRotation{}).
+	StructMap().
+	AddField("NextKey", atlas.StructMapEntry{SerialName: "nextKey"}).
+	AddField("PreviousKey", atlas.StructMapEntry{SerialName: "previousKey"}).
+	AddField("NextSignature", atlas.StructMapEntry{SerialName: "nextSignature"}).
+	AddField("PreviousSignature", atlas.StructMapEntry{SerialName: "previousSignature"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(AtlasKeyRotation)
+}
@@ -0,0 +1,136 @@
+package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
+
+import (
+	"context"
+	"encoding/hex"
+
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+)
+
+// SignerType is the type of the identities created by NewSignerIdentity
+const SignerType = "signer"
+
+// Signer signs data with a key which doesn't need to be held in the
+// keystore, such as a key stored in a HSM, a cloud KMS or a hardware wallet
+type Signer interface {
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+	PublicKey() ic.PubKey
+}
+
+// keySigner is a Signer using a private key held in memory
+type keySigner struct {
+	key ic.PrivKey
+}
+
+// NewKeySigner returns a Signer using the given private key
+func NewKeySigner(key ic.PrivKey) Signer {
+	return &keySigner{key: key}
+}
+
+func (s *keySigner) Sign(_ context.Context, data []byte) ([]byte, error) {
+	return s.key.Sign(data)
+}
+
+func (s *keySigner) PublicKey() ic.PubKey {
+	return s.key.GetPublic()
+}
+
+// SignerPublicKey returns the public key of the signer as stored in
+// identities and entries
+func SignerPublicKey(signer Signer) ([]byte, error) {
+	return rawPublicKey(signer.PublicKey())
+}
+
+// SignerIdentityProvider signs entries with a Signer, the identity ID is
+// derived from its public key
+type SignerIdentityProvider struct {
+	signer Signer
+}
+
+func NewSignerIdentityProvider(*CreateIdentityOptions) Interface {
+	return &SignerIdentityProvider{}
+}
+
+// NewSignerIdentity creates an identity whose ID, public key and entries are
+// all signed by the given signer
+func NewSignerIdentity(ctx context.Context, signer Signer) (*Identity, error) {
+	if signer == nil {
+		return nil, errors.New("a signer is required")
+	}
+
+	publicKey, err := SignerPublicKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	id := hex.EncodeToString(publicKey)
+
+	idSignature, err := signer.Sign(ctx, []byte(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign identity ID")
+	}
+
+	data := append(append([]byte{}, publicKey...), idSignature...)
+	pubKeyIDSignature, err := signer.Sign(ctx, []byte(hex.EncodeToString(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign identity public key")
+	}
+
+	return &Identity{
+		ID:        id,
+		PublicKey: publicKey,
+		Signatures: &IdentitySignature{
+			ID:        idSignature,
+			PublicKey: pubKeyIDSignature,
+		},
+		Type:     SignerType,
+		Provider: &SignerIdentityProvider{signer: signer},
+	}, nil
+}
+
+func (p *SignerIdentityProvider) GetID(*CreateIdentityOptions) (string, error) {
+	if p.signer == nil {
+		return "", errors.New("a signer is required")
+	}
+
+	publicKey, err := SignerPublicKey(p.signer)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(publicKey), nil
+}
+
+func (p *SignerIdentityProvider) SignIdentity(data []byte, _ string) ([]byte, error) {
+	if p.signer == nil {
+		return nil, errors.New("a signer is required")
+	}
+
+	return p.signer.Sign(context.Background(), []byte(hex.EncodeToString(data)))
+}
+
+func (p *SignerIdentityProvider) Sign(identity *Identity, data []byte) ([]byte, error) {
+	return p.SignContext(context.Background(), identity, data)
+}
+
+// SignContext signs data with the signer, passing it the context
+func (p *SignerIdentityProvider) SignContext(ctx context.Context, _ *Identity, data []byte) ([]byte, error) {
+	if p.signer == nil {
+		return nil, errors.New("a signer is required")
+	}
+
+	return p.signer.Sign(ctx, data)
+}
+
+// VerifyIdentity checks that the public key of the identity is signed by
+// the key its ID is derived from
+func (p *SignerIdentityProvider) VerifyIdentity(identity *Identity) error {
+	return verifyPublicKeySignature(identity, UnmarshalPublicKey)
+}
+
+func (*SignerIdentityProvider) GetType() string {
+	return SignerType
+}
+
+var _ Interface = &SignerIdentityProvider{}
@@ -0,0 +1,46 @@
+package iface // import "berty.tech/go-ipfs-log/iface"
+
+import (
+	"time"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	"berty.tech/go-ipfs-log/utils/vectorclock"
+	cid "github.com/ipfs/go-cid"
+)
+
+// Clock is implemented by the clocks carried by entries
+type Clock interface {
+	// ClockType returns the name of the clock recorded in entries
+	ClockType() string
+}
+
+// IPFSLogEntry is the interface implemented by the entries of a log, it
+// allows downstream projects to use their own entry types
+type IPFSLogEntry interface {
+	GetLogID() string
+	GetPayload() []byte
+	CopyPayload() []byte
+	GetNext() []cid.Cid
+	GetV() uint64
+	GetKey() []byte
+	GetSig() []byte
+	GetIdentity() *identityprovider.Identity
+	GetHash() cid.Cid
+	GetClock() *lamportclock.LamportClock
+	GetMetadata() map[string]string
+	GetPayloadCodec() string
+	GetPayloadRef() cid.Cid
+	GetPayloadCompression() string
+	GetPayloadKeyID() string
+	GetClockType() string
+	GetVectorClock() vectorclock.VectorClock
+	GetHLC() *hlc.Timestamp
+	GetTimestamp() time.Time
+
+	SetHash(cid.Cid)
+
+	IsValid() bool
+	Verify(identity identityprovider.Interface) error
+}
@@ -0,0 +1,113 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"context"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Batch buffers the nodes added through its services and adds them to the
+// DAG together on Commit, so blockstores syncing every write sync once.
+// The buffered nodes can be read before they are committed.
+type Batch struct {
+	services IpfsServices
+	dag      *batchDAG
+}
+
+// NewBatch creates a batch writing to the DAG of the services
+func NewBatch(ctx context.Context, services IpfsServices) *Batch {
+	dag := &batchDAG{
+		DAGService: services.DAG(),
+		batch:      ipld.NewBatch(ctx, services.DAG()),
+		pending:    map[cid.Cid]ipld.Node{},
+	}
+
+	return &Batch{services: &dagServices{IpfsServices: services, dag: dag}, dag: dag}
+}
+
+// Services returns the services whose DAG writes to the batch
+func (b *Batch) Services() IpfsServices {
+	return b.services
+}
+
+// Commit adds the buffered nodes to the DAG
+func (b *Batch) Commit() error {
+	return b.dag.commit()
+}
+
+// Blocks returns the nodes buffered since the last commit
+func (b *Batch) Blocks() []blocks.Block {
+	b.dag.lock.Lock()
+	defer b.dag.lock.Unlock()
+
+	res := make([]blocks.Block, 0, len(b.dag.pending))
+	for _, nd := range b.dag.pending {
+		res = append(res, nd)
+	}
+
+	return res
+}
+
+// batchDAG is a DAGService buffering the added nodes
+type batchDAG struct {
+	ipld.DAGService
+
+	lock    sync.Mutex
+	batch   *ipld.Batch
+	pending map[cid.Cid]ipld.Node
+}
+
+func (d *batchDAG) Add(ctx context.Context, nd ipld.Node) error {
+	return d.AddMany(ctx, []ipld.Node{nd})
+}
+
+func (d *batchDAG) AddMany(ctx context.Context, nds []ipld.Node) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, nd := range nds {
+		d.pending[nd.Cid()] = nd
+	}
+
+	return d.batch.AddMany(ctx, nds)
+}
+
+func (d *batchDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	d.lock.Lock()
+	nd, ok := d.pending[c]
+	d.lock.Unlock()
+
+	if ok {
+		return nd, nil
+	}
+
+	return d.DAGService.Get(ctx, c)
+}
+
+func (d *batchDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	defer close(out)
+
+	for _, c := range cids {
+		nd, err := d.Get(ctx, c)
+		out <- &ipld.NodeOption{Node: nd, Err: err}
+	}
+
+	return out
+}
+
+func (d *batchDAG) commit() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.batch.Commit(); err != nil {
+		return err
+	}
+
+	d.pending = map[cid.Cid]ipld.Node{}
+
+	return nil
+}
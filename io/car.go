@@ -0,0 +1,229 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"bufio"
+	"encoding/binary"
+	goio "io"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/pkg/errors"
+)
+
+// carHeader is the header of a CARv1 archive
+type carHeader struct {
+	Roots   []cid.Cid
+	Version uint64
+}
+
+// CARWriter writes blocks in the CARv1 format
+type CARWriter struct {
+	w goio.Writer
+}
+
+// NewCARWriter writes the header of a CARv1 archive with the given roots
+func NewCARWriter(w goio.Writer, roots []cid.Cid) (*CARWriter, error) {
+	header, err := (&carHeader{Roots: roots, Version: 1}).MarshalCBOR()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode car header")
+	}
+
+	cw := &CARWriter{w: w}
+	if err := cw.writeSection(header); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// Put appends a block to the archive
+func (cw *CARWriter) Put(c cid.Cid, data []byte) error {
+	return cw.writeSection(c.Bytes(), data)
+}
+
+func (cw *CARWriter) writeSection(parts ...[]byte) error {
+	size := 0
+	for _, p := range parts {
+		size += len(p)
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	if _, err := cw.w.Write(buf[:n]); err != nil {
+		return err
+	}
+
+	for _, p := range parts {
+		if _, err := cw.w.Write(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CARReader reads the blocks of a CARv1 archive
+type CARReader struct {
+	r     *bufio.Reader
+	Roots []cid.Cid
+}
+
+// NewCARReader reads the header of a CARv1 archive
+func NewCARReader(r goio.Reader) (*CARReader, error) {
+	cr := &CARReader{r: bufio.NewReader(r)}
+
+	data, err := cr.readSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read car header")
+	}
+
+	header := &carHeader{}
+	if err := header.UnmarshalCBOR(data); err != nil {
+		return nil, errors.Wrap(err, "unable to decode car header")
+	}
+
+	if header.Version != 1 {
+		return nil, errors.Errorf("unsupported car version %d", header.Version)
+	}
+
+	cr.Roots = header.Roots
+
+	return cr, nil
+}
+
+// Next returns the next block of the archive, io.EOF once all blocks are
+// read. The content of the block is checked against its CID.
+func (cr *CARReader) Next() (blocks.Block, error) {
+	data, err := cr.readSection()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := cidLength(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode block cid")
+	}
+
+	c, err := cid.Cast(data[:n])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode block cid")
+	}
+
+	sum, err := c.Prefix().Sum(data[n:])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to hash block")
+	}
+
+	if !sum.Equals(c) {
+		return nil, errors.Errorf("block %s doesn't match its content", c)
+	}
+
+	return blocks.NewBlockWithCid(data[n:], c)
+}
+
+// cidLength returns the length of the CID the data starts with
+func cidLength(data []byte) (int, error) {
+	// CIDv0 are bare sha2-256 multihashes
+	if len(data) >= 34 && data[0] == 0x12 && data[1] == 0x20 {
+		return 34, nil
+	}
+
+	offset := 0
+
+	// version, codec, multihash type and multihash length
+	var length uint64
+	for i := 0; i < 4; i++ {
+		v, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return 0, errors.New("invalid varint")
+		}
+
+		offset += n
+		length = v
+	}
+
+	if uint64(len(data)-offset) < length {
+		return 0, errors.New("truncated multihash")
+	}
+
+	return offset + int(length), nil
+}
+
+func (cr *CARReader) readSection() ([]byte, error) {
+	size, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	if _, err := goio.ReadFull(cr.r, data); err != nil {
+		return nil, errors.Wrap(err, "truncated car section")
+	}
+
+	return data, nil
+}
+
+// MarshalCBOR encodes the header as dag-cbor
+func (h *carHeader) MarshalCBOR() ([]byte, error) {
+	nd, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(int64(len(h.Roots)), func(la datamodel.ListAssembler) {
+			for _, c := range h.Roots {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: c}))
+			}
+		}))
+		qp.MapEntry(ma, "version", qp.Int(int64(h.Version)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeCBOR(nd)
+}
+
+// UnmarshalCBOR decodes a header encoded as dag-cbor
+func (h *carHeader) UnmarshalCBOR(data []byte) error {
+	nd, err := DecodeCBOR(data)
+	if err != nil {
+		return err
+	}
+
+	version, err := nd.LookupByString("version")
+	if err != nil {
+		return err
+	}
+
+	v, err := version.AsInt()
+	if err != nil {
+		return err
+	}
+
+	roots, err := nd.LookupByString("roots")
+	if err != nil {
+		return err
+	}
+
+	if roots.Kind() != datamodel.Kind_List {
+		return errors.New("car roots are not a list")
+	}
+
+	h.Version, h.Roots = uint64(v), nil
+	for it := roots.ListIterator(); !it.Done(); {
+		_, r, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		c, ok := nodeLink(r)
+		if !ok {
+			return errors.New("car root is not a link")
+		}
+
+		h.Roots = append(h.Roots, c)
+	}
+
+	return nil
+}
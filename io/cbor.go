@@ -0,0 +1,253 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/pkg/errors"
+)
+
+// CBORMarshaler is implemented by the values encoding themselves as
+// canonical dag-cbor
+type CBORMarshaler interface {
+	MarshalCBOR() ([]byte, error)
+}
+
+// EncodeCBOR encodes a node as dag-cbor, map keys are sorted as canonical
+// CBOR requires
+func EncodeCBOR(n datamodel.Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := dagcbor.Encode(n, buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeCBOR decodes dag-cbor data into a node, trailing data is an error
+func DecodeCBOR(data []byte) (datamodel.Node, error) {
+	r := bytes.NewReader(data)
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, r); err != nil {
+		return nil, err
+	}
+
+	if r.Len() > 0 {
+		return nil, errors.Errorf("%d bytes of trailing data", r.Len())
+	}
+
+	return nb.Build(), nil
+}
+
+// WriteRawCBOR stores a block already encoded as dag-cbor, its CID is built
+// using the version and hash function of the prefix. The data isn't
+// checked, it must be canonical CBOR.
+func WriteRawCBOR(ipfs IpfsServices, raw []byte, prefix cid.Prefix) (cid.Cid, error) {
+	if err := CheckPrefix(prefix); err != nil {
+		return cid.Cid{}, err
+	}
+
+	prefix.Codec = cid.DagCBOR
+
+	c, err := prefix.Sum(raw)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	block, err := blocks.NewBlockWithCid(raw, c)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	if err := ipfs.DAG().Add(context.Background(), &rawCBORNode{Block: block}); err != nil {
+		return cid.Cid{}, err
+	}
+
+	return c, nil
+}
+
+// rawCBORNode is a dag-cbor node built from its encoded form, it is only
+// decoded when its links or paths are needed
+type rawCBORNode struct {
+	blocks.Block
+
+	once sync.Once
+	node datamodel.Node
+	err  error
+}
+
+func (n *rawCBORNode) decode() (datamodel.Node, error) {
+	n.once.Do(func() {
+		n.node, n.err = DecodeCBOR(n.RawData())
+	})
+
+	return n.node, n.err
+}
+
+// nodeLink returns the CID of a link node
+func nodeLink(nd datamodel.Node) (cid.Cid, bool) {
+	if nd.Kind() != datamodel.Kind_Link {
+		return cid.Cid{}, false
+	}
+
+	lnk, err := nd.AsLink()
+	if err != nil {
+		return cid.Cid{}, false
+	}
+
+	c, ok := lnk.(cidlink.Link)
+	if !ok {
+		return cid.Cid{}, false
+	}
+
+	return c.Cid, true
+}
+
+func (n *rawCBORNode) Resolve(path []string) (interface{}, []string, error) {
+	cur, err := n.decode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, p := range path {
+		if c, ok := nodeLink(cur); ok {
+			return &format.Link{Cid: c}, path[i:], nil
+		}
+
+		switch cur.Kind() {
+		case datamodel.Kind_Map:
+			next, err := cur.LookupByString(p)
+			if err != nil {
+				return nil, nil, errors.Errorf("no such link: %s", p)
+			}
+			cur = next
+
+		case datamodel.Kind_List:
+			idx, err := strconv.ParseInt(p, 10, 64)
+			if err != nil || idx < 0 || idx >= cur.Length() {
+				return nil, nil, errors.Errorf("invalid array index: %s", p)
+			}
+
+			if cur, err = cur.LookupByIndex(idx); err != nil {
+				return nil, nil, err
+			}
+
+		default:
+			return nil, nil, errors.Errorf("no such link: %s", p)
+		}
+	}
+
+	if c, ok := nodeLink(cur); ok {
+		return &format.Link{Cid: c}, nil, nil
+	}
+
+	return cur, nil, nil
+}
+
+func (n *rawCBORNode) ResolveLink(path []string) (*format.Link, []string, error) {
+	obj, rest, err := n.Resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lnk, ok := obj.(*format.Link)
+	if !ok {
+		return nil, rest, errors.New("found non-link at given path")
+	}
+
+	return lnk, rest, nil
+}
+
+// walkNode calls fn for each node below nd with its path, links aren't
+// followed
+func walkNode(nd datamodel.Node, prefix string, level, depth int, fn func(path string, nd datamodel.Node)) {
+	if depth >= 0 && level > depth {
+		return
+	}
+
+	switch nd.Kind() {
+	case datamodel.Kind_Map:
+		for it := nd.MapIterator(); !it.Done(); {
+			k, v, err := it.Next()
+			if err != nil {
+				return
+			}
+
+			key, _ := k.AsString()
+			key = strings.TrimPrefix(prefix+"/"+key, "/")
+			fn(key, v)
+			walkNode(v, key, level+1, depth, fn)
+		}
+
+	case datamodel.Kind_List:
+		for it := nd.ListIterator(); !it.Done(); {
+			i, v, err := it.Next()
+			if err != nil {
+				return
+			}
+
+			key := strings.TrimPrefix(prefix+"/"+strconv.FormatInt(i, 10), "/")
+			fn(key, v)
+			walkNode(v, key, level+1, depth, fn)
+		}
+	}
+}
+
+func (n *rawCBORNode) Tree(p string, depth int) []string {
+	nd, err := n.decode()
+	if err != nil {
+		return nil
+	}
+
+	var out []string
+	walkNode(nd, "", 1, depth, func(path string, _ datamodel.Node) {
+		if p == "" {
+			out = append(out, path)
+		} else if strings.HasPrefix(path, p+"/") {
+			out = append(out, strings.TrimPrefix(path, p+"/"))
+		}
+	})
+
+	return out
+}
+
+func (n *rawCBORNode) Copy() format.Node {
+	return &rawCBORNode{Block: n.Block}
+}
+
+func (n *rawCBORNode) Links() []*format.Link {
+	nd, err := n.decode()
+	if err != nil {
+		return nil
+	}
+
+	var links []*format.Link
+	walkNode(nd, "", 1, -1, func(_ string, nd datamodel.Node) {
+		if c, ok := nodeLink(nd); ok {
+			links = append(links, &format.Link{Cid: c})
+		}
+	})
+
+	return links
+}
+
+func (n *rawCBORNode) Stat() (*format.NodeStat, error) {
+	return &format.NodeStat{}, nil
+}
+
+func (n *rawCBORNode) Size() (uint64, error) {
+	return uint64(len(n.RawData())), nil
+}
+
+var _ format.Node = &rawCBORNode{}
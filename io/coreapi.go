@@ -0,0 +1,205 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/pkg/errors"
+)
+
+// CoreAPITimeout bounds the calls to the block API of a node made through
+// the Blockstore interface, which doesn't take a context
+const CoreAPITimeout = 30 * time.Second
+
+// NewCoreAPIServices returns services storing the log through a CoreAPI,
+// such as the HTTP client of a remote IPFS daemon (go-ipfs-http-client).
+// Blocks are pinned through the pin API of the node.
+func NewCoreAPIServices(api coreiface.CoreAPI) IpfsServices {
+	return &services{
+		dag:        api.Dag(),
+		blockStore: &coreAPIBlockstore{api: api.Block()},
+		pinner:     &coreAPIPinner{api: api.Pin()},
+	}
+}
+
+// coreAPIBlockstore is a Blockstore reading and writing raw blocks through
+// the block API of a node
+type coreAPIBlockstore struct {
+	api coreiface.BlockAPI
+}
+
+func (b *coreAPIBlockstore) DeleteBlock(c cid.Cid) error {
+	ctx, cancel := context.WithTimeout(context.Background(), CoreAPITimeout)
+	defer cancel()
+
+	return b.api.Rm(ctx, coreiface.IpldPath(c))
+}
+
+func (b *coreAPIBlockstore) Has(c cid.Cid) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CoreAPITimeout)
+	defer cancel()
+
+	if _, err := b.api.Stat(ctx, coreiface.IpldPath(c)); isNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "unable to stat block %s", c)
+	}
+
+	return true, nil
+}
+
+func (b *coreAPIBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CoreAPITimeout)
+	defer cancel()
+
+	r, err := b.api.Get(ctx, coreiface.IpldPath(c))
+	if isNotFound(err) {
+		return nil, bstore.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read block")
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (b *coreAPIBlockstore) GetSize(c cid.Cid) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CoreAPITimeout)
+	defer cancel()
+
+	stat, err := b.api.Stat(ctx, coreiface.IpldPath(c))
+	if isNotFound(err) {
+		return -1, bstore.ErrNotFound
+	} else if err != nil {
+		return -1, err
+	}
+
+	return stat.Size(), nil
+}
+
+// Put writes the block with the codec and hash function of its CID, the
+// node must compute the same CID
+func (b *coreAPIBlockstore) Put(block blocks.Block) error {
+	prefix := block.Cid().Prefix()
+
+	codec := "v0"
+	if prefix.Version != 0 {
+		name, ok := cid.CodecToStr[prefix.Codec]
+		if !ok {
+			return errors.Errorf("unsupported codec: %d", prefix.Codec)
+		}
+
+		codec = name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CoreAPITimeout)
+	defer cancel()
+
+	stat, err := b.api.Put(ctx, bytes.NewReader(block.RawData()),
+		options.Block.Format(codec),
+		options.Block.Hash(prefix.MhType, prefix.MhLength),
+	)
+	if err != nil {
+		return err
+	}
+
+	if c := stat.Path().Cid(); !c.Equals(block.Cid()) {
+		return errors.Errorf("block stored as %s instead of %s", c, block.Cid())
+	}
+
+	return nil
+}
+
+func (b *coreAPIBlockstore) PutMany(blks []blocks.Block) error {
+	for _, block := range blks {
+		if err := b.Put(block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *coreAPIBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return nil, errors.New("listing blocks isn't supported by the core API")
+}
+
+func (b *coreAPIBlockstore) HashOnRead(enabled bool) {}
+
+var _ bstore.Blockstore = &coreAPIBlockstore{}
+
+// isNotFound checks whether the error reports a missing block, errors of
+// remote daemons are only known by their message
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if cause := errors.Cause(err); cause == bstore.ErrNotFound || cause == ipld.ErrNotFound {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "not found")
+}
+
+// coreAPIPinner is a Pinner using the pin API of a node
+type coreAPIPinner struct {
+	api coreiface.PinAPI
+}
+
+func (p *coreAPIPinner) Pin(ctx context.Context, c cid.Cid, recursive bool) error {
+	return p.api.Add(ctx, coreiface.IpldPath(c), options.Pin.Recursive(recursive))
+}
+
+func (p *coreAPIPinner) Unpin(ctx context.Context, c cid.Cid) error {
+	for _, pinType := range []options.PinLsOption{options.Pin.Type.Recursive(), options.Pin.Type.Direct()} {
+		ok, err := p.pinned(ctx, c, pinType)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := p.api.Rm(ctx, coreiface.IpldPath(c), options.Pin.RmRecursive(true)); err != nil {
+			return errors.Wrapf(err, "unable to unpin %s", c)
+		}
+	}
+
+	return nil
+}
+
+func (p *coreAPIPinner) IsPinned(ctx context.Context, c cid.Cid) (bool, error) {
+	return p.pinned(ctx, c, options.Pin.Type.All())
+}
+
+// pinned checks whether the block is listed in the pins of the given type,
+// the pin API can't be queried for a single block
+func (p *coreAPIPinner) pinned(ctx context.Context, c cid.Cid, pinType options.PinLsOption) (bool, error) {
+	pins, err := p.api.Ls(ctx, pinType)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to list pins")
+	}
+
+	for _, pin := range pins {
+		if pin.Path().Cid().Equals(c) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
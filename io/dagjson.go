@@ -0,0 +1,254 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/pkg/errors"
+)
+
+// DagJSON is the multicodec of dag-json blocks
+const DagJSON = 0x0129
+
+func init() {
+	format.Register(DagJSON, DecodeDagJSONBlock)
+}
+
+// DagJSONNode is an IPLD node encoded as dag-json, links are represented
+// as {"/": "<cid>"} objects
+type DagJSONNode struct {
+	obj interface{}
+	raw []byte
+	cid cid.Cid
+}
+
+// NewDagJSONNode creates a node from its encoded form, its CID is built
+// using the version and hash function of the prefix
+func NewDagJSONNode(raw []byte, prefix cid.Prefix) (*DagJSONNode, error) {
+	if err := CheckPrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	prefix.Codec = DagJSON
+
+	c, err := prefix.Sum(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDagJSONNode(raw, c)
+}
+
+// DecodeDagJSONBlock decodes a dag-json block
+func DecodeDagJSONBlock(b blocks.Block) (format.Node, error) {
+	return newDagJSONNode(b.RawData(), b.Cid())
+}
+
+func newDagJSONNode(raw []byte, c cid.Cid) (*DagJSONNode, error) {
+	var obj interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, errors.Wrap(err, "invalid dag-json block")
+	}
+
+	return &DagJSONNode{obj: obj, raw: raw, cid: c}, nil
+}
+
+// WriteDagJSON stores a dag-json encoded object
+func WriteDagJSON(ipfs IpfsServices, raw []byte, prefix cid.Prefix) (cid.Cid, error) {
+	nd, err := NewDagJSONNode(raw, prefix)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	if err := ipfs.DAG().Add(context.Background(), nd); err != nil {
+		return cid.Cid{}, err
+	}
+
+	return nd.Cid(), nil
+}
+
+// parseLink returns the CID of a {"/": "<cid>"} object
+func parseLink(obj interface{}) (cid.Cid, bool) {
+	m, ok := obj.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return cid.Cid{}, false
+	}
+
+	s, ok := m["/"].(string)
+	if !ok {
+		return cid.Cid{}, false
+	}
+
+	c, err := cid.Decode(s)
+	if err != nil {
+		return cid.Cid{}, false
+	}
+
+	return c, true
+}
+
+func (n *DagJSONNode) RawData() []byte {
+	return n.raw
+}
+
+func (n *DagJSONNode) Cid() cid.Cid {
+	return n.cid
+}
+
+func (n *DagJSONNode) String() string {
+	return n.cid.String()
+}
+
+func (n *DagJSONNode) Loggable() map[string]interface{} {
+	return map[string]interface{}{
+		"node_type": "dag-json",
+		"cid":       n.cid,
+	}
+}
+
+func (n *DagJSONNode) Resolve(path []string) (interface{}, []string, error) {
+	cur := n.obj
+
+	for i, p := range path {
+		if c, ok := parseLink(cur); ok {
+			return &format.Link{Cid: c}, path[i:], nil
+		}
+
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[p]
+			if !ok {
+				return nil, nil, errors.Errorf("no such link: %s", p)
+			}
+			cur = next
+
+		case []interface{}:
+			var idx int
+			if _, err := fmt.Sscanf(p, "%d", &idx); err != nil || idx < 0 || idx >= len(v) {
+				return nil, nil, errors.Errorf("invalid array index: %s", p)
+			}
+			cur = v[idx]
+
+		default:
+			return nil, nil, errors.Errorf("no such link: %s", p)
+		}
+	}
+
+	if c, ok := parseLink(cur); ok {
+		return &format.Link{Cid: c}, nil, nil
+	}
+
+	return cur, nil, nil
+}
+
+func (n *DagJSONNode) ResolveLink(path []string) (*format.Link, []string, error) {
+	obj, rest, err := n.Resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lnk, ok := obj.(*format.Link)
+	if !ok {
+		return nil, rest, errors.New("found non-link at given path")
+	}
+
+	return lnk, rest, nil
+}
+
+func (n *DagJSONNode) Tree(p string, depth int) []string {
+	var out []string
+
+	var walk func(prefix string, obj interface{}, level int)
+	walk = func(prefix string, obj interface{}, level int) {
+		if depth >= 0 && level > depth {
+			return
+		}
+
+		if _, ok := parseLink(obj); ok {
+			return
+		}
+
+		switch v := obj.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				key := strings.TrimPrefix(prefix+"/"+k, "/")
+				out = append(out, key)
+				walk(key, child, level+1)
+			}
+
+		case []interface{}:
+			for i, child := range v {
+				key := strings.TrimPrefix(fmt.Sprintf("%s/%d", prefix, i), "/")
+				out = append(out, key)
+				walk(key, child, level+1)
+			}
+		}
+	}
+
+	walk("", n.obj, 1)
+
+	if p == "" {
+		return out
+	}
+
+	var filtered []string
+	for _, s := range out {
+		if strings.HasPrefix(s, p+"/") {
+			filtered = append(filtered, strings.TrimPrefix(s, p+"/"))
+		}
+	}
+
+	return filtered
+}
+
+func (n *DagJSONNode) Copy() format.Node {
+	raw := make([]byte, len(n.raw))
+	copy(raw, n.raw)
+
+	nd, _ := newDagJSONNode(raw, n.cid)
+
+	return nd
+}
+
+func (n *DagJSONNode) Links() []*format.Link {
+	var links []*format.Link
+
+	var walk func(obj interface{})
+	walk = func(obj interface{}) {
+		if c, ok := parseLink(obj); ok {
+			links = append(links, &format.Link{Cid: c})
+			return
+		}
+
+		switch v := obj.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+
+	walk(n.obj)
+
+	return links
+}
+
+func (n *DagJSONNode) Stat() (*format.NodeStat, error) {
+	return &format.NodeStat{}, nil
+}
+
+func (n *DagJSONNode) Size() (uint64, error) {
+	return uint64(len(n.raw)), nil
+}
+
+var _ format.Node = &DagJSONNode{}
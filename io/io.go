@@ -3,11 +3,15 @@ package io // import "berty.tech/go-ipfs-log/io"
 import (
 	"context"
 	"fmt"
-	"math"
 
+	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	mbase "github.com/multiformats/go-multibase"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/pkg/errors"
 )
 
 var debug = false
@@ -16,24 +20,94 @@ func SetDebug(val bool) {
 	debug = val
 }
 
-func WriteCBOR(ipfs *IpfsServices, obj interface{}) (cid.Cid, error) {
-	cborNode, err := cbornode.WrapObject(obj, math.MaxUint64, -1)
+// DefaultPrefix is the CID prefix used when writing blocks
+var DefaultPrefix = cid.Prefix{
+	Version:  1,
+	Codec:    cid.DagCBOR,
+	MhType:   mh.SHA2_256,
+	MhLength: -1,
+}
+
+// WriteCBOR stores an object as dag-cbor, the object is an IPLD node, a
+// CBORMarshaler or a type registered with go-ipld-cbor
+func WriteCBOR(ipfs IpfsServices, obj interface{}) (cid.Cid, error) {
+	return WriteCBORWithPrefix(ipfs, obj, DefaultPrefix)
+}
+
+// WriteCBORWithPrefix stores an object as dag-cbor using the CID version
+// and hash function of the prefix
+func WriteCBORWithPrefix(ipfs IpfsServices, obj interface{}, prefix cid.Prefix) (cid.Cid, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch o := obj.(type) {
+	case datamodel.Node:
+		data, err = EncodeCBOR(o)
+	case CBORMarshaler:
+		data, err = o.MarshalCBOR()
+	default:
+		var nd *cbornode.Node
+		if nd, err = cbornode.WrapObject(obj, prefix.MhType, prefix.MhLength); err == nil {
+			data = nd.RawData()
+		}
+	}
+
 	if err != nil {
 		return cid.Cid{}, err
 	}
 
 	if debug {
-		fmt.Printf("\nStr of cbor: %x\n", cborNode.RawData())
+		fmt.Printf("\nStr of cbor: %x\n", data)
 	}
 
-	err = ipfs.DAG.Add(context.Background(), cborNode)
-	if err != nil {
-		return cid.Cid{}, err
+	return WriteRawCBOR(ipfs, data, prefix)
+}
+
+// CIDString returns the base58btc form of a CID, the one used for the CIDs
+// serialized in signed data, addresses and stored indexes. CID.String
+// isn't used as it encodes CIDv1 in base32 since go-cid v0.0.4.
+func CIDString(c cid.Cid) string {
+	return c.Encode(base58)
+}
+
+var base58 = mbase.MustNewEncoder(mbase.Base58BTC)
+
+// CheckPrefix returns an error if blocks can't be written using the prefix
+func CheckPrefix(prefix cid.Prefix) error {
+	if prefix.Version != 1 {
+		return errors.Errorf("unsupported CID version %d, only CIDv1 can address dag-cbor and dag-json blocks", prefix.Version)
+	}
+
+	if _, ok := mh.Codes[prefix.MhType]; !ok {
+		return errors.Errorf("unsupported hash function %d", prefix.MhType)
 	}
 
-	return cborNode.Cid(), nil
+	return nil
+}
+
+// WriteBlocks stores raw blocks, they are decoded with the IPLD format
+// registered for their codec
+func WriteBlocks(ctx context.Context, ipfs IpfsServices, blks []blocks.Block) error {
+	nds := make([]format.Node, 0, len(blks))
+	for _, b := range blks {
+		nd, err := format.Decode(b)
+		if err != nil {
+			return errors.Wrapf(err, "unable to decode block %s", b.Cid())
+		}
+
+		nds = append(nds, nd)
+	}
+
+	return ipfs.DAG().AddMany(ctx, nds)
+}
+
+func ReadCBOR(ipfs IpfsServices, contentIdentifier cid.Cid) (format.Node, error) {
+	return ReadCBORContext(context.Background(), ipfs, contentIdentifier)
 }
 
-func ReadCBOR(ipfs *IpfsServices, contentIdentifier cid.Cid) (format.Node, error) {
-	return ipfs.DAG.Get(context.Background(), contentIdentifier)
+// ReadCBORContext reads a node, the read is canceled with the context
+func ReadCBORContext(ctx context.Context, ipfs IpfsServices, contentIdentifier cid.Cid) (format.Node, error) {
+	return ipfs.DAG().Get(ctx, contentIdentifier)
 }
@@ -0,0 +1,34 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"context"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	ds "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	nilrouting "github.com/ipfs/go-ipfs-routing/none"
+	host "github.com/libp2p/go-libp2p-host"
+	routing "github.com/libp2p/go-libp2p-routing"
+)
+
+// NewNodeServices returns the services of a minimal node exchanging blocks
+// with bitswap over the libp2p host, the blocks and pins are persisted in
+// the datastore. The providers of missing blocks are found through the
+// routing, only the connected peers are asked when it is nil. Bitswap runs
+// until the context is done.
+func NewNodeServices(ctx context.Context, db ds.Batching, h host.Host, r routing.ContentRouting) (IpfsServices, error) {
+	if r == nil {
+		nr, err := nilrouting.ConstructNilRouting(ctx, h, db, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		r = nr
+	}
+
+	bs := bstore.NewBlockstore(db)
+	exchange := bitswap.New(ctx, bsnet.NewFromIpfsHost(h, r), bs)
+
+	return newServices(db, bs, exchange), nil
+}
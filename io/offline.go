@@ -0,0 +1,61 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/pkg/errors"
+)
+
+// Offline returns services reading blocks from the local blockstore only,
+// reading a missing block fails with errmsg.BlockNotLocal instead of
+// waiting for the network. Writes are unchanged.
+func Offline(s IpfsServices) IpfsServices {
+	if s.BlockStore() == nil {
+		return s
+	}
+
+	if _, ok := s.DAG().(*offlineDAG); ok {
+		return s
+	}
+
+	return &dagServices{
+		IpfsServices: s,
+		dag:          &offlineDAG{DAGService: s.DAG(), blocks: s.BlockStore()},
+	}
+}
+
+// offlineDAG is a DAGService failing to get the nodes missing from the
+// blockstore
+type offlineDAG struct {
+	ipld.DAGService
+	blocks bstore.Blockstore
+}
+
+func (d *offlineDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	ok, err := d.blocks.Has(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read blockstore")
+	}
+
+	if !ok {
+		return nil, errors.Wrapf(errmsg.BlockNotLocal, "block %s", c)
+	}
+
+	return d.DAGService.Get(ctx, c)
+}
+
+func (d *offlineDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	defer close(out)
+
+	for _, c := range cids {
+		nd, err := d.Get(ctx, c)
+		out <- &ipld.NodeOption{Node: nd, Err: err}
+	}
+
+	return out
+}
@@ -0,0 +1,51 @@
+package io // import "berty.tech/go-ipfs-log/io"
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	cid "github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-unixfs/importer"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/pkg/errors"
+)
+
+// WritePayload stores a payload as a chunked unixfs file, allowing payloads
+// larger than the maximum size of a block
+func WritePayload(ipfs IpfsServices, payload []byte) (cid.Cid, error) {
+	nd, err := importer.BuildDagFromReader(ipfs.DAG(), chunker.DefaultSplitter(bytes.NewReader(payload)))
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	return nd.Cid(), nil
+}
+
+// ReadPayload reads a payload stored using WritePayload, payloads larger
+// than maxSize bytes are rejected when maxSize is positive
+func ReadPayload(ipfs IpfsServices, contentIdentifier cid.Cid, maxSize int) ([]byte, error) {
+	return ReadPayloadContext(context.Background(), ipfs, contentIdentifier, maxSize)
+}
+
+// ReadPayloadContext reads a payload, the read is canceled with the context
+func ReadPayloadContext(ctx context.Context, ipfs IpfsServices, contentIdentifier cid.Cid, maxSize int) ([]byte, error) {
+	nd, err := ipfs.DAG().Get(ctx, contentIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := uio.NewDagReader(ctx, nd, ipfs.DAG())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if maxSize > 0 && r.Size() > uint64(maxSize) {
+		return nil, errors.Wrapf(errmsg.EntryTooLarge, "payload is %d bytes, limit is %d", r.Size(), maxSize)
+	}
+
+	return ioutil.ReadAll(r)
+}
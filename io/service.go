@@ -1,39 +1,141 @@
 package io // import "berty.tech/go-ipfs-log/io"
 
 import (
+	"context"
+
 	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	"github.com/ipfs/go-ipfs/pin"
 	ipld "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/pkg/errors"
 )
 
-type IpfsServices struct {
-	DAG        ipld.DAGService
-	BlockStore bstore.Blockstore
-	DB         ds.Datastore
-	Blockserv  bserv.BlockService
-	Pinner     pin.Pinner
+// IpfsServices gives the logs access to IPFS, either to a node running in
+// process (NewServices) or to a remote daemon (NewCoreAPIServices)
+type IpfsServices interface {
+	// DAG returns the DAG storing the blocks of the logs
+	DAG() ipld.DAGService
+
+	// BlockStore returns the blockstore of the node, blocks read from it
+	// aren't fetched from the network
+	BlockStore() bstore.Blockstore
+
+	// Pinner returns the pinner of the node, nil when the node can't pin
+	Pinner() Pinner
+}
+
+// Pinner protects blocks from the garbage collection of a node
+type Pinner interface {
+	// Pin pins the block, a recursive pin also protects the blocks it links
+	// to
+	Pin(ctx context.Context, c cid.Cid, recursive bool) error
+
+	// Unpin removes the direct and recursive pins of the block
+	Unpin(ctx context.Context, c cid.Cid) error
+
+	// IsPinned checks whether the block is pinned, either directly or by a
+	// recursive pin of itself or of a block linking to it
+	IsPinned(ctx context.Context, c cid.Cid) (bool, error)
+}
+
+// services are IpfsServices of a node running in process
+type services struct {
+	dag        ipld.DAGService
+	blockStore bstore.Blockstore
+	pinner     Pinner
+}
+
+func (s *services) DAG() ipld.DAGService {
+	return s.dag
+}
+
+func (s *services) BlockStore() bstore.Blockstore {
+	return s.blockStore
+}
+
+func (s *services) Pinner() Pinner {
+	return s.pinner
+}
+
+// dagServices are services whose DAG is replaced, the other services are
+// unchanged
+type dagServices struct {
+	IpfsServices
+	dag ipld.DAGService
+}
+
+func (s *dagServices) DAG() ipld.DAGService {
+	return s.dag
+}
+
+func NewMemoryServices() IpfsServices {
+	return NewServices(dssync.MutexWrap(ds.NewMapDatastore()), nil)
 }
 
-func NewMemoryServices() *IpfsServices {
-	dataStore := ds.NewMapDatastore()
-	db := dssync.MutexWrap(dataStore)
-	bs := bstore.NewBlockstore(db)
-	blockserv := bserv.New(bs, offline.Exchange(bs))
+// NewServices returns services persisting blocks and pins in the datastore
+// and fetching missing blocks through the exchange, such as a bitswap
+// instance running on a libp2p host (see NewNodeServices). Blocks are only
+// read locally when the exchange is nil.
+func NewServices(db ds.Batching, exchange exchange.Interface) IpfsServices {
+	return newServices(db, bstore.NewBlockstore(db), exchange)
+}
+
+// newServices returns services persisting pins in the datastore and blocks
+// in the blockstore
+func newServices(db ds.Batching, bs bstore.Blockstore, exchange exchange.Interface) IpfsServices {
+	if exchange == nil {
+		exchange = offline.Exchange(bs)
+	}
+
+	blockserv := bserv.New(bs, exchange)
 	dag := merkledag.NewDAGService(blockserv)
-	pinner := pin.NewPinner(db, dag, dag)
-
-	// var pinning pin.Pinner = pin.NewPinner()
-	// var blockstore bstore.GCBlockstore = bstore.NewBlockstore()
-	return &IpfsServices{
-		DAG:        dag,
-		BlockStore: bs,
-		DB:         db,
-		Blockserv:  blockserv,
-		Pinner:     pinner,
+
+	return &services{
+		dag:        dag,
+		blockStore: bs,
+		pinner:     &dsPinner{pinner: pin.NewPinner(db, dag, dag)},
+	}
+}
+
+// dsPinner is a Pinner saving the pins in a datastore
+type dsPinner struct {
+	pinner pin.Pinner
+}
+
+func (p *dsPinner) Pin(ctx context.Context, c cid.Cid, recursive bool) error {
+	mode := pin.Direct
+	if recursive {
+		mode = pin.Recursive
 	}
+
+	p.pinner.PinWithMode(c, mode)
+
+	return errors.Wrap(p.pinner.Flush(), "unable to save pins")
+}
+
+func (p *dsPinner) Unpin(ctx context.Context, c cid.Cid) error {
+	for _, mode := range []pin.Mode{pin.Direct, pin.Recursive} {
+		_, ok, err := p.pinner.IsPinnedWithType(c, mode)
+		if err != nil {
+			return errors.Wrapf(err, "unable to check pins of %s", c)
+		}
+
+		if ok {
+			p.pinner.RemovePinWithMode(c, mode)
+		}
+	}
+
+	return errors.Wrap(p.pinner.Flush(), "unable to save pins")
+}
+
+func (p *dsPinner) IsPinned(ctx context.Context, c cid.Cid) (bool, error) {
+	_, ok, err := p.pinner.IsPinned(c)
+
+	return ok, err
 }
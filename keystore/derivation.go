@@ -0,0 +1,136 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// hardenedOffset is added to the indexes of hardened derivation steps
+const hardenedOffset = 1 << 31
+
+// SeedFromMnemonic returns the BIP-39 seed of a mnemonic, the words are
+// expected to be normalized and aren't checked against a word list
+func SeedFromMnemonic(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+// ParseDerivationPath parses a path such as m/44'/0'/1', only hardened
+// indexes are supported as they are the only ones defined for Ed25519
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, errors.Errorf("derivation path %q must start with m", path)
+	}
+
+	indexes := []uint32{}
+	for _, p := range parts[1:] {
+		if !strings.HasSuffix(p, "'") && !strings.HasSuffix(p, "H") {
+			return nil, errors.Errorf("derivation path %q has a non hardened index", path)
+		}
+
+		i, err := strconv.ParseUint(p[:len(p)-1], 10, 31)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid derivation path %q", path)
+		}
+
+		indexes = append(indexes, uint32(i)+hardenedOffset)
+	}
+
+	return indexes, nil
+}
+
+// DeriveKey derives a key of the given type from a seed following SLIP-10,
+// see crypto.Secp256k1 and crypto.Ed25519
+func DeriveKey(seed []byte, path string, keyType int) (crypto.PrivKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch keyType {
+	case crypto.Ed25519:
+		key, _ := slip10(seed, "ed25519 seed", indexes, nil)
+		return crypto.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(key))
+
+	case crypto.Secp256k1:
+		key, err := slip10(seed, "Bitcoin seed", indexes, btcec.S256().N)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.UnmarshalSecp256k1PrivateKey(key)
+	}
+
+	return nil, errors.Errorf("key derivation isn't supported for key type %d", keyType)
+}
+
+// slip10 derives the private key at the given hardened indexes, order is
+// the order of the curve or nil for Ed25519
+func slip10(seed []byte, curve string, indexes []uint32, order *big.Int) ([]byte, error) {
+	mac := hmac.New(sha512.New, []byte(curve))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	// Master keys outside of the curve order are derived again from the
+	// previous output
+	for order != nil && !validScalar(sum[:32], order) {
+		mac := hmac.New(sha512.New, []byte(curve))
+		mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+
+	key, chainCode := sum[:32], sum[32:]
+
+	for _, index := range indexes {
+		data := append(append([]byte{0}, key...), ser32(index)...)
+
+		for {
+			mac := hmac.New(sha512.New, chainCode)
+			mac.Write(data)
+			sum := mac.Sum(nil)
+
+			if order == nil {
+				key, chainCode = sum[:32], sum[32:]
+				break
+			}
+
+			child := new(big.Int).SetBytes(sum[:32])
+			child.Add(child, new(big.Int).SetBytes(key))
+			child.Mod(child, order)
+
+			if new(big.Int).SetBytes(sum[:32]).Cmp(order) < 0 && child.Sign() != 0 {
+				key, chainCode = child.FillBytes(make([]byte, 32)), sum[32:]
+				break
+			}
+
+			data = append(append([]byte{1}, sum[32:]...), ser32(index)...)
+		}
+	}
+
+	return key, nil
+}
+
+func ser32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+
+	return b
+}
+
+func validScalar(b []byte, order *big.Int) bool {
+	k := new(big.Int).SetBytes(b)
+
+	return k.Sign() != 0 && k.Cmp(order) < 0
+}
@@ -0,0 +1,138 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+
+	datastore "github.com/ipfs/go-datastore"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// exportVersion is the version of the format written by ExportKey
+const exportVersion = 1
+
+// scrypt parameters used to derive the encryption key from the passphrase
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// exportedKey is the portable format of an exported key, the private key is
+// encrypted with AES-GCM using a key derived from a passphrase with scrypt
+type exportedKey struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func exportCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive key from passphrase")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ExportKey returns the key stored for id encrypted with the passphrase, it
+// can be imported in another keystore with ImportKey
+func (k *Keystore) ExportKey(id string, passphrase []byte) ([]byte, error) {
+	priv, err := k.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal private key")
+	}
+
+	exported := &exportedKey{
+		Version: exportVersion,
+		KDF:     "scrypt",
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, 16),
+	}
+
+	if _, err := rand.Read(exported.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := exportCipher(passphrase, exported.Salt, exported.N, exported.R, exported.P)
+	if err != nil {
+		return nil, err
+	}
+
+	exported.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(exported.Nonce); err != nil {
+		return nil, err
+	}
+
+	exported.Ciphertext = aead.Seal(nil, exported.Nonce, plaintext, []byte(id))
+
+	return json.Marshal(exported)
+}
+
+// ImportKey decrypts a key exported by ExportKey and stores it for id, keys
+// already stored aren't replaced
+func (k *Keystore) ImportKey(id string, data []byte, passphrase []byte) (crypto.PrivKey, error) {
+	exported := &exportedKey{}
+	if err := json.Unmarshal(data, exported); err != nil {
+		return nil, errors.Wrap(err, "unable to decode exported key")
+	}
+
+	if exported.Version != exportVersion || exported.KDF != "scrypt" {
+		return nil, errors.Errorf("unsupported exported key version %d", exported.Version)
+	}
+
+	aead, err := exportCipher(passphrase, exported.Salt, exported.N, exported.R, exported.P)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(exported.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid exported key nonce")
+	}
+
+	plaintext, err := aead.Open(nil, exported.Nonce, exported.Ciphertext, []byte(id))
+	if err != nil {
+		return nil, errors.New("unable to decrypt exported key, wrong passphrase or ID")
+	}
+
+	priv, err := crypto.UnmarshalPrivateKey(plaintext)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal private key")
+	}
+
+	exists, err := k.store.Has(datastore.NewKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, errors.Errorf("a key is already stored for %s", id)
+	}
+
+	if err := k.PutKey(id, priv); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
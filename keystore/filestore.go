@@ -0,0 +1,180 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	badger "github.com/ipfs/go-ds-badger"
+	"github.com/pkg/errors"
+)
+
+// FileStore is a datastore keeping each value in its own file, the path of
+// the file is the datastore key so stores can be copied between backends
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// NewFileStore creates a file store in dir, the directory is created if
+// missing
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create keystore directory")
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// NewFileKeystore creates a keystore storing one key per file in dir
+func NewFileKeystore(dir string) (*Keystore, error) {
+	store, err := NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeystore(store)
+}
+
+// NewBadgerKeystore creates a keystore storing the keys in a badger
+// database in dir, the keys are named as in the other datastores. The
+// database is released by Close.
+func NewBadgerKeystore(dir string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create keystore directory")
+	}
+
+	store, err := badger.NewDatastore(dir, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open badger datastore")
+	}
+
+	return NewKeystore(store)
+}
+
+func (s *FileStore) path(key datastore.Key) string {
+	return filepath.Join(s.dir, filepath.FromSlash(strings.TrimPrefix(key.String(), "/")))
+}
+
+func (s *FileStore) Put(key datastore.Key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+
+	// Written to a temporary file first so keys are never truncated
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *FileStore) Get(key datastore.Key) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, datastore.ErrNotFound
+	}
+
+	return value, err
+}
+
+func (s *FileStore) Has(key datastore.Key) (bool, error) {
+	_, err := s.GetSize(key)
+	if err == datastore.ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *FileStore) GetSize(key datastore.Key) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return -1, datastore.ErrNotFound
+	} else if err != nil {
+		return -1, err
+	}
+
+	return int(info.Size()), nil
+}
+
+func (s *FileStore) Delete(key datastore.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return datastore.ErrNotFound
+	}
+
+	return err
+}
+
+func (s *FileStore) Query(q dsq.Query) (dsq.Results, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []dsq.Entry{}
+	err := filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+
+		e := dsq.Entry{Key: datastore.NewKey(filepath.ToSlash(rel)).String()}
+		if !q.KeysOnly {
+			if e.Value, err = ioutil.ReadFile(p); err != nil {
+				return err
+			}
+		}
+
+		entries = append(entries, e)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithEntries(q, entries)), nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+var _ datastore.Datastore = &FileStore{}
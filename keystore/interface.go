@@ -1,6 +1,10 @@
 package keystore // import "berty.tech/go-ipfs-log/keystore"
 
-import crypto "github.com/libp2p/go-libp2p-crypto"
+import (
+	"context"
+
+	crypto "github.com/libp2p/go-libp2p-crypto"
+)
 
 type Interface interface {
 	HasKey(id string) (bool, error)
@@ -13,3 +17,55 @@ type Interface interface {
 
 	Verify(signature []byte, publicKey crypto.PubKey, data []byte) error
 }
+
+// TypedInterface is implemented by keystores able to create keys of other
+// types than secp256k1, see crypto.Ed25519
+type TypedInterface interface {
+	Interface
+
+	CreateKeyWithType(id string, keyType int) (crypto.PrivKey, error)
+
+	// PutKey stores a key created elsewhere, such as a derived key
+	PutKey(id string, key crypto.PrivKey) error
+}
+
+// ContextInterface is implemented by keystores whose signing and
+// verification honor the deadline and cancellation of a context, such as
+// remote or hardware backed keystores
+type ContextInterface interface {
+	Interface
+
+	SignContext(ctx context.Context, privKey crypto.PrivKey, bytes []byte) ([]byte, error)
+
+	VerifyContext(ctx context.Context, signature []byte, publicKey crypto.PubKey, data []byte) error
+}
+
+// SignContext signs bytes with the keystore, the context is passed to
+// keystores implementing ContextInterface and checked before signing
+// otherwise
+func SignContext(ctx context.Context, ks Interface, privKey crypto.PrivKey, bytes []byte) ([]byte, error) {
+	if cks, ok := ks.(ContextInterface); ok {
+		return cks.SignContext(ctx, privKey, bytes)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return ks.Sign(privKey, bytes)
+}
+
+// VerifyContext verifies a signature with the keystore, the context is
+// passed to keystores implementing ContextInterface and checked before
+// verifying otherwise
+func VerifyContext(ctx context.Context, ks Interface, signature []byte, publicKey crypto.PubKey, data []byte) error {
+	if cks, ok := ks.(ContextInterface); ok {
+		return cks.VerifyContext(ctx, signature, publicKey, data)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ks.Verify(signature, publicKey, data)
+}
@@ -1,15 +1,20 @@
 package keystore // import "berty.tech/go-ipfs-log/keystore"
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 
 	lru "github.com/hashicorp/golang-lru"
 	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	crypto "github.com/libp2p/go-libp2p-crypto"
 	"github.com/pkg/errors"
 )
 
+// secp256k1PrivateKeySize is the size of the raw secp256k1 keys
+const secp256k1PrivateKeySize = 32
+
 type Keystore struct {
 	store datastore.Datastore
 	cache *lru.Cache
@@ -32,6 +37,24 @@ func (k *Keystore) Verify(signature []byte, publicKey crypto.PubKey, data []byte
 	return nil
 }
 
+// SignContext signs bytes unless the context is done
+func (k *Keystore) SignContext(ctx context.Context, privKey crypto.PrivKey, bytes []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return k.Sign(privKey, bytes)
+}
+
+// VerifyContext verifies the signature unless the context is done
+func (k *Keystore) VerifyContext(ctx context.Context, signature []byte, publicKey crypto.PubKey, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return k.Verify(signature, publicKey, data)
+}
+
 func NewKeystore(store datastore.Datastore) (*Keystore, error) {
 	cache, err := lru.New(128)
 	if err != nil {
@@ -44,6 +67,17 @@ func NewKeystore(store datastore.Datastore) (*Keystore, error) {
 	}, nil
 }
 
+// Close closes the datastore of the keystore
+func (k *Keystore) Close() error {
+	return k.store.Close()
+}
+
+// NewInMemory creates a keystore which isn't persisted, it is safe for
+// concurrent use
+func NewInMemory() (*Keystore, error) {
+	return NewKeystore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
 func (k *Keystore) HasKey(id string) (bool, error) {
 	hasKey := false
 	storedKey, ok := k.cache.Peek(id)
@@ -66,23 +100,44 @@ func (k *Keystore) HasKey(id string) (bool, error) {
 
 func (k *Keystore) CreateKey(id string) (crypto.PrivKey, error) {
 	// FIXME: I kept Secp256k1 for compatibility with OrbitDB, should we change this?
-	priv, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	return k.CreateKeyWithType(id, crypto.Secp256k1)
+}
+
+// CreateKeyWithType creates a key of the given type, see crypto.Ed25519
+func (k *Keystore) CreateKeyWithType(id string, keyType int) (crypto.PrivKey, error) {
+	priv, _, err := crypto.GenerateKeyPairWithReader(keyType, 0, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
 
-	keyBytes, err := priv.Raw()
-	if err != nil {
+	if err := k.PutKey(id, priv); err != nil {
 		return nil, err
 	}
 
+	return priv, nil
+}
+
+// PutKey stores the key for id, secp256k1 keys are stored raw for
+// compatibility and other types are stored with their type
+func (k *Keystore) PutKey(id string, priv crypto.PrivKey) error {
+	var keyBytes []byte
+	var err error
+	if priv.Type() == crypto.Secp256k1 {
+		keyBytes, err = priv.Raw()
+	} else {
+		keyBytes, err = crypto.MarshalPrivateKey(priv)
+	}
+	if err != nil {
+		return err
+	}
+
 	if err := k.store.Put(datastore.NewKey(id), keyBytes); err != nil {
-		return nil, err
+		return err
 	}
 
 	k.cache.Add(id, base64.StdEncoding.EncodeToString(keyBytes))
 
-	return priv, nil
+	return nil
 }
 
 func (k *Keystore) GetKey(id string) (crypto.PrivKey, error) {
@@ -106,12 +161,12 @@ func (k *Keystore) GetKey(id string) (crypto.PrivKey, error) {
 		}
 	}
 
-	privateKey, err := crypto.UnmarshalSecp256k1PrivateKey(keyBytes)
-	if err != nil {
-		return nil, err
+	if len(keyBytes) == secp256k1PrivateKeySize {
+		return crypto.UnmarshalSecp256k1PrivateKey(keyBytes)
 	}
 
-	return privateKey, nil
+	return crypto.UnmarshalPrivateKey(keyBytes)
 }
 
-var _ Interface = &Keystore{}
+var _ TypedInterface = &Keystore{}
+var _ ContextInterface = &Keystore{}
@@ -0,0 +1,97 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"strings"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// AddressProtocol is the first component of log addresses
+const AddressProtocol = "ipfs-log"
+
+// Address identifies a log by its name and its manifest, like orbit-db
+// addresses. Replicas created independently with the same name, access
+// controller and sort function share their address, which is used as log
+// ID.
+type Address struct {
+	// Manifest is the hash of the manifest of the log, see
+	// Manifest.Address
+	Manifest cid.Cid
+
+	// Name is the human readable name of the log
+	Name string
+}
+
+// NewAddress computes the address of the log with the given name and
+// access controller, sorted by sorting.LastWriteWins. The controllers which
+// aren't Addressable, such as the default one, aren't part of the address,
+// the Addressable ones have to be saved.
+func NewAddress(name string, ac accesscontroller.Interface) (Address, error) {
+	return newAddress(name, ac, "")
+}
+
+// newAddress computes the address of the manifest of a log, its access
+// controller has to be saved if it is Addressable
+func newAddress(name string, ac accesscontroller.Interface, sortName string) (Address, error) {
+	if a, ok := ac.(accesscontroller.Addressable); ok && !a.Address().Defined() {
+		return Address{}, errors.Wrap(errmsg.InvalidAddress, "access controller isn't saved")
+	}
+
+	return NewManifest(name, ac, sortName).Address()
+}
+
+// ParseAddress parses an address written as /ipfs-log/<manifest>/<name>,
+// the name may contain slashes
+func ParseAddress(s string) (Address, error) {
+	parts := strings.SplitN(s, "/", 4)
+	if len(parts) != 4 || parts[0] != "" || parts[1] != AddressProtocol {
+		return Address{}, errors.Wrapf(errmsg.InvalidAddress, "%q", s)
+	}
+
+	c, err := cid.Decode(parts[2])
+	if err != nil {
+		return Address{}, errors.Wrapf(errmsg.InvalidAddress, "%q: %s", s, err)
+	}
+
+	if c.Type() != cid.DagCBOR {
+		return Address{}, errors.Wrapf(errmsg.InvalidAddress, "%q: manifest isn't dag-cbor", s)
+	}
+
+	return Address{Manifest: c, Name: parts[3]}, nil
+}
+
+// IsValidAddress returns true if the string can be parsed as an address
+func IsValidAddress(s string) bool {
+	_, err := ParseAddress(s)
+	return err == nil
+}
+
+// VerifyAddress checks that the address is the one of the log with the
+// given access controller sorted by sorting.LastWriteWins, the name is read
+// from the address
+func VerifyAddress(s string, ac accesscontroller.Interface) error {
+	addr, err := ParseAddress(s)
+	if err != nil {
+		return err
+	}
+
+	expected, err := NewAddress(addr.Name, ac)
+	if err != nil {
+		return err
+	}
+
+	if !expected.Manifest.Equals(addr.Manifest) {
+		return errors.Wrapf(errmsg.InvalidAddress, "%q doesn't match the access controller", s)
+	}
+
+	return nil
+}
+
+// String returns the address as /ipfs-log/<manifest>/<name>
+func (a Address) String() string {
+	return "/" + AddressProtocol + "/" + io.CIDString(a.Manifest) + "/" + a.Name
+}
@@ -0,0 +1,274 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"bytes"
+	"context"
+	goio "io"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// ArchiveMetadataKey is the metadata key of the entries written by Archive,
+// its value is the address of the archive
+const ArchiveMetadataKey = "ipfslog.archive"
+
+// IsArchive returns true if the entry was written by Archive
+func IsArchive(e iface.IPFSLogEntry) bool {
+	_, ok := e.GetMetadata()[ArchiveMetadataKey]
+	return ok
+}
+
+// Archive moves the entries Prune would remove to a CARv1 archive stored in
+// IPFS and appends an entry pointing to the heads, the truncation point,
+// whose metadata holds the address of the archive. The archived entries are
+// then removed like by Prune, keep doesn't count the appended entry. Lazy
+// logs page in the archives when they read an archived entry, see also
+// LoadArchives. The appended entry is returned, nil when there is nothing
+// to archive.
+func (l *Log) Archive(keep int, options *AppendOptions) (iface.IPFSLogEntry, error) {
+	if options == nil {
+		options = &AppendOptions{}
+	}
+
+	retained, removed := l.prunable(keep)
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	archive, err := l.writeArchive(context.Background(), removed)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive failed")
+	}
+
+	if l.pin {
+		pinner := l.Storage.Pinner()
+		if pinner == nil {
+			return nil, errmsg.PinnerNotDefined
+		}
+
+		if err := pinner.Pin(context.Background(), archive, true); err != nil {
+			return nil, errors.Wrap(err, "unable to pin archive")
+		}
+	}
+
+	metadata := map[string]string{}
+	for k, v := range options.Metadata {
+		metadata[k] = v
+	}
+	metadata[ArchiveMetadataKey] = io.CIDString(archive)
+
+	archiveOptions := *options
+	archiveOptions.PointerCount = 1
+	archiveOptions.Metadata = metadata
+	archiveOptions.PayloadCodec = ""
+
+	e, err := l.AppendWithOptions([]byte(io.CIDString(archive)), &archiveOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive failed")
+	}
+
+	l.retain(append(retained, e))
+
+	if err := l.saveHeads(); err != nil {
+		return e, errors.Wrap(err, "archive failed")
+	}
+
+	if err := l.RebuildIndexes(); err != nil {
+		return e, errors.Wrap(err, "archive failed")
+	}
+
+	if err := l.release(removed); err != nil {
+		return e, errors.Wrap(err, "archive failed")
+	}
+
+	return e, nil
+}
+
+// writeArchive stores the blocks of the entries and of their payloads in a
+// CARv1 archive, the heads of the entries are its roots
+func (l *Log) writeArchive(ctx context.Context, entries []iface.IPFSLogEntry) (cid.Cid, error) {
+	roots := entrySliceToCids(FindHeads(entry.NewOrderedMapFromEntries(entries)))
+
+	buf := &bytes.Buffer{}
+	cw, err := io.NewCARWriter(buf, roots)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	seen := cid.NewSet()
+	for _, e := range entries {
+		if !seen.Visit(e.GetHash()) {
+			continue
+		}
+
+		if _, err := l.exportBlock(ctx, cw, e.GetHash()); err != nil {
+			return cid.Cid{}, err
+		}
+
+		if ref := e.GetPayloadRef(); ref.Defined() {
+			if err := l.exportDAG(ctx, cw, ref, seen); err != nil {
+				return cid.Cid{}, err
+			}
+		}
+	}
+
+	archive, err := io.WritePayload(l.Storage, buf.Bytes())
+	if err != nil {
+		return cid.Cid{}, errors.Wrap(err, "unable to write archive")
+	}
+
+	return archive, nil
+}
+
+// trackArchive records the archive referenced by an entry written by
+// Archive
+func (l *Log) trackArchive(e iface.IPFSLogEntry) {
+	address, ok := e.GetMetadata()[ArchiveMetadataKey]
+	if !ok {
+		return
+	}
+
+	archive, err := cid.Decode(address)
+	if err != nil {
+		return
+	}
+
+	for _, a := range l.archives {
+		if a.Equals(archive) {
+			return
+		}
+	}
+
+	l.archives = append(l.archives, archive)
+}
+
+// pageIn imports the blocks of the archives known to the log in the local
+// blockstore until it holds the block of the entry
+func (l *Log) pageIn(hash cid.Cid) error {
+	if len(l.archives) == 0 || l.Storage.BlockStore() == nil {
+		return nil
+	}
+
+	for _, archive := range l.archives {
+		if ok, err := l.Storage.BlockStore().Has(hash); err == nil && ok {
+			return nil
+		}
+
+		if l.pagedIn != nil && l.pagedIn.Has(archive) {
+			continue
+		}
+
+		if _, err := l.importArchive(archive); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importArchive imports the blocks of the archive in the local blockstore,
+// the roots of the archive are returned
+func (l *Log) importArchive(archive cid.Cid) ([]cid.Cid, error) {
+	data, err := io.ReadPayload(l.Storage, archive, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read archive %s", archive)
+	}
+
+	cr, err := io.NewCARReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read archive %s", archive)
+	}
+
+	for {
+		block, err := cr.Next()
+		if err == goio.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "unable to read archive %s", archive)
+		}
+
+		if err := l.Storage.BlockStore().Put(block); err != nil {
+			return nil, errors.Wrap(err, "unable to import archive")
+		}
+	}
+
+	if l.pagedIn == nil {
+		l.pagedIn = cid.NewSet()
+	}
+	l.pagedIn.Add(archive)
+
+	return cr.Roots, nil
+}
+
+// LoadArchives pages in every archive known to the log and joins the
+// entries they hold, including the ones of the archives found in them. The
+// joined entries are returned.
+func (l *Log) LoadArchives() ([]iface.IPFSLogEntry, error) {
+	if l.Storage.BlockStore() == nil {
+		return nil, errors.New("unable to load archives without a blockstore")
+	}
+
+	loaded := []iface.IPFSLogEntry{}
+	done := cid.NewSet()
+
+	for {
+		roots := []cid.Cid{}
+		for _, archive := range l.archives {
+			if !done.Visit(archive) {
+				continue
+			}
+
+			archiveRoots, err := l.importArchive(archive)
+			if err != nil {
+				return loaded, err
+			}
+
+			roots = append(roots, archiveRoots...)
+		}
+
+		if len(roots) == 0 {
+			return loaded, nil
+		}
+
+		// Every block of the known archives is local, the older archives
+		// are imported by the next iteration
+		entries := entry.FetchAll(l.Storage, roots, &entry.FetchOptions{
+			Provider: l.Identity.Provider,
+			Denylist: l.denylist,
+			Offline:  true,
+		})
+
+		missing := []iface.IPFSLogEntry{}
+		for _, e := range entries {
+			if !l.has(e.GetHash()) {
+				missing = append(missing, e)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		other, err := NewLog(l.Storage, l.Identity, &NewLogOptions{
+			ID:               l.ID,
+			AccessController: l.accessController,
+			Entries:          entry.NewOrderedMapFromEntries(missing),
+			OwnEntries:       true,
+			SortFn:           l.SortFn,
+		})
+		if err != nil {
+			return loaded, err
+		}
+
+		if _, err := l.Join(other, -1); err != nil {
+			return loaded, errors.Wrap(err, "unable to join archived entries")
+		}
+
+		loaded = append(loaded, missing...)
+	}
+}
@@ -0,0 +1,106 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"encoding/hex"
+	"sort"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// AuthorIndex indexes the entries of a log by author, the ID of the
+// identity that wrote them or the hex encoded signing key of the entries
+// without identity. The entries of an author are in the order of Values.
+type AuthorIndex struct {
+	sortFn  func(a, b iface.IPFSLogEntry) (int, error)
+	entries map[string][]iface.IPFSLogEntry
+}
+
+// NewAuthorIndex creates an author index ordering the entries with sortFn
+func NewAuthorIndex(sortFn func(a, b iface.IPFSLogEntry) (int, error)) *AuthorIndex {
+	return &AuthorIndex{
+		sortFn:  sortFn,
+		entries: map[string][]iface.IPFSLogEntry{},
+	}
+}
+
+// Author returns the author of an entry as indexed by AuthorIndex
+func Author(e iface.IPFSLogEntry) string {
+	if identity := e.GetIdentity(); identity != nil && identity.ID != "" {
+		return identity.ID
+	}
+
+	return hex.EncodeToString(e.GetKey())
+}
+
+func (a *AuthorIndex) UpdateIndex(e iface.IPFSLogEntry) error {
+	author := Author(e)
+
+	entries, err := insertSorted(a.entries[author], e, a.sortFn)
+	if err != nil {
+		return err
+	}
+
+	a.entries[author] = entries
+
+	return nil
+}
+
+func (a *AuthorIndex) Reset() error {
+	a.entries = map[string][]iface.IPFSLogEntry{}
+	return nil
+}
+
+// Entries returns the entries of the author
+func (a *AuthorIndex) Entries(author string) []iface.IPFSLogEntry {
+	return append([]iface.IPFSLogEntry{}, a.entries[author]...)
+}
+
+// Authors returns the sorted authors of the indexed entries
+func (a *AuthorIndex) Authors() []string {
+	authors := make([]string, 0, len(a.entries))
+	for author := range a.entries {
+		authors = append(authors, author)
+	}
+
+	sort.Strings(authors)
+
+	return authors
+}
+
+// authorIndex returns the author index of the log, it is built on first
+// use and maintained like the other indexes afterwards
+func (l *Log) authorIndex() (*AuthorIndex, error) {
+	if l.authors != nil {
+		return l.authors, nil
+	}
+
+	authors := NewAuthorIndex(l.SortFn)
+	if err := l.AddIndex(authors); err != nil {
+		return nil, err
+	}
+
+	l.authors = authors
+
+	return authors, nil
+}
+
+// EntriesBy returns the entries written by author, the ID of an identity or
+// a hex encoded signing key, in the order of Values
+func (l *Log) EntriesBy(author string) ([]iface.IPFSLogEntry, error) {
+	authors, err := l.authorIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return authors.Entries(author), nil
+}
+
+// Authors returns the sorted authors of the entries of the log
+func (l *Log) Authors() ([]string, error) {
+	authors, err := l.authorIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return authors.Authors(), nil
+}
@@ -0,0 +1,35 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"github.com/ipfs/bbloom"
+	cid "github.com/ipfs/go-cid"
+)
+
+// bloomFalsePositives is the false positive rate of the filter once it
+// holds the number of entries it was sized for
+const bloomFalsePositives = 0.01
+
+// knownFilter is a bloom filter of the entries held by a log, it answers
+// that an entry is missing without looking it up. Removed entries stay in
+// the filter, they are only false positives.
+type knownFilter struct {
+	bloom *bbloom.Bloom
+}
+
+func newKnownFilter(size int) (*knownFilter, error) {
+	bloom, err := bbloom.New(float64(size), bloomFalsePositives)
+	if err != nil {
+		return nil, err
+	}
+
+	return &knownFilter{bloom: bloom}, nil
+}
+
+func (f *knownFilter) add(hash cid.Cid) {
+	f.bloom.AddTS(hash.Bytes())
+}
+
+// mayHave returns false if the entry was never added
+func (f *knownFilter) mayHave(hash cid.Cid) bool {
+	return f.bloom.HasTS(hash.Bytes())
+}
@@ -0,0 +1,69 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"sync/atomic"
+
+	"berty.tech/go-ipfs-log/iface"
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+)
+
+// DefaultCacheSize is the number of entries kept in memory by a lazy log
+// when no cache size is specified
+const DefaultCacheSize = 1024
+
+// CacheStats holds the hit and miss counters of a lazy log's entry cache
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Len    int
+}
+
+// entryCache is a size bounded LRU of the entries fetched by a lazy log
+type entryCache struct {
+	lru    *lru.Cache
+	hits   uint64
+	misses uint64
+}
+
+func newEntryCache(size int) (*entryCache, error) {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entryCache{lru: cache}, nil
+}
+
+func (c *entryCache) Get(hash cid.Cid) (iface.IPFSLogEntry, bool) {
+	val, ok := c.lru.Get(hash.KeyString())
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+
+	return val.(iface.IPFSLogEntry), true
+}
+
+// Has returns true if the entry is cached, the statistics aren't updated
+func (c *entryCache) Has(hash cid.Cid) bool {
+	return c.lru.Contains(hash.KeyString())
+}
+
+func (c *entryCache) Add(e iface.IPFSLogEntry) {
+	c.lru.Add(e.GetHash().KeyString(), e)
+}
+
+func (c *entryCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Len:    c.lru.Len(),
+	}
+}
@@ -0,0 +1,132 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+	goio "io"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/pkg/errors"
+)
+
+// ExportCAR writes the log in a CARv1 archive, the manifest of the log is
+// its root and is followed by every entry reachable from the heads along
+// with their external payloads
+func (l *Log) ExportCAR(ctx context.Context, w goio.Writer) error {
+	root, err := l.ToMultihash()
+	if err != nil {
+		return errors.Wrap(err, "unable to write log manifest")
+	}
+
+	cw, err := io.NewCARWriter(w, []cid.Cid{root})
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.exportBlock(ctx, cw, root); err != nil {
+		return err
+	}
+
+	seen := cid.NewSet()
+	queue := entrySliceToCids(l.heads.Slice())
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if !seen.Visit(c) {
+			continue
+		}
+
+		nd, err := l.exportBlock(ctx, cw, c)
+		if err != nil {
+			return err
+		}
+
+		e, err := entry.FromRawData(nd.RawData(), c, nil)
+		if err != nil {
+			return errors.Wrapf(err, "unable to decode entry %s", c)
+		}
+
+		if ref := e.GetPayloadRef(); ref.Defined() {
+			if err := l.exportDAG(ctx, cw, ref, seen); err != nil {
+				return err
+			}
+		}
+
+		queue = append(queue, e.GetNext()...)
+	}
+
+	return nil
+}
+
+// exportBlock copies a single block to the archive
+func (l *Log) exportBlock(ctx context.Context, cw *io.CARWriter, c cid.Cid) (format.Node, error) {
+	nd, err := l.Storage.DAG().Get(ctx, c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read block %s", c)
+	}
+
+	if err := cw.Put(c, nd.RawData()); err != nil {
+		return nil, errors.Wrap(err, "unable to write block")
+	}
+
+	return nd, nil
+}
+
+// exportDAG copies the blocks of a chunked payload which weren't seen yet
+func (l *Log) exportDAG(ctx context.Context, cw *io.CARWriter, c cid.Cid, seen *cid.Set) error {
+	if !seen.Visit(c) {
+		return nil
+	}
+
+	nd, err := l.exportBlock(ctx, cw, c)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range nd.Links() {
+		if err := l.exportDAG(ctx, cw, link.Cid, seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewFromCAR imports the blocks of a CARv1 archive written by ExportCAR in
+// the local blockstore and creates the log from its root, no block needs to
+// be fetched from the network
+func NewFromCAR(services io.IpfsServices, identity *identityprovider.Identity, r goio.Reader, logOptions *NewLogOptions, fetchOptions *FetchOptions) (*Log, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	cr, err := io.NewCARReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfromcar failed")
+	}
+
+	if len(cr.Roots) != 1 {
+		return nil, errors.Errorf("newfromcar failed: expected a single root, got %d", len(cr.Roots))
+	}
+
+	for {
+		block, err := cr.Next()
+		if err == goio.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "newfromcar failed")
+		}
+
+		if err := services.BlockStore().Put(block); err != nil {
+			return nil, errors.Wrap(err, "newfromcar failed")
+		}
+	}
+
+	return NewFromMultihash(services, identity, cr.Roots[0], logOptions, fetchOptions)
+}
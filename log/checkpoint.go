@@ -0,0 +1,321 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"bytes"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// CheckpointVersion is the format version of the written checkpoints
+const CheckpointVersion = 1
+
+// CheckpointMetadataKey is the metadata key of the checkpoint entries, its
+// value is the address of their Checkpoint
+const CheckpointMetadataKey = "ipfslog.checkpoint"
+
+// Checkpoint summarizes the history of a log preceding a checkpoint entry.
+// A checkpoint is valid when:
+//   - its ID is the log ID of the entry and its heads are the entry Next,
+//     so it can only summarize the history the signed entry points to
+//   - Time is lower than the clock time of the entry
+//   - the snapshot holds the heads and Length valid entries of the log,
+//     their greatest clock time is Time, and every entry is reachable from
+//     the heads with all its parents in the snapshot, except the parents
+//     of earlier checkpoint entries which their own checkpoint summarizes
+type Checkpoint struct {
+	Version int
+	ID      string
+	Heads   []cid.Cid
+
+	// Time is the greatest clock time of the summarized entries
+	Time int
+
+	// Length is the number of summarized entries
+	Length int
+
+	// Snapshot is the address of the summarized entries, stored as
+	// written by WriteSnapshot
+	Snapshot cid.Cid
+}
+
+// IsCheckpoint returns true if the entry was written by AppendCheckpoint
+func IsCheckpoint(e iface.IPFSLogEntry) bool {
+	_, ok := e.GetMetadata()[CheckpointMetadataKey]
+	return ok
+}
+
+// checkpointBoundary stops fetches at the checkpoint entries when set
+func checkpointBoundary(checkpoints bool) func(iface.IPFSLogEntry) bool {
+	if !checkpoints {
+		return nil
+	}
+
+	return IsCheckpoint
+}
+
+// AppendCheckpoint appends an entry pointing to the heads of the log and
+// referencing a snapshot of its entries, the replicas loading the log with
+// FetchOptions.Checkpoints don't fetch the entries preceding it. The
+// options are used as by AppendWithOptions, the entry only points to the
+// heads and its payload is the address of the checkpoint.
+func (l *Log) AppendCheckpoint(options *AppendOptions) (iface.IPFSLogEntry, error) {
+	if options == nil {
+		options = &AppendOptions{}
+	}
+
+	if l.heads.Len() == 0 {
+		return nil, errors.New("unable to checkpoint an empty log")
+	}
+
+	snapshot := l.ToSnapshot()
+
+	buf := &bytes.Buffer{}
+	if err := WriteSnapshot(buf, snapshot, nil); err != nil {
+		return nil, errors.Wrap(err, "unable to write checkpoint snapshot")
+	}
+
+	snapshotHash, err := io.WritePayload(l.Storage, buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to write checkpoint snapshot")
+	}
+
+	prefix := io.DefaultPrefix
+	if l.prefix != nil {
+		prefix = *l.prefix
+	}
+
+	hash, err := io.WriteCBORWithPrefix(l.Storage, &Checkpoint{
+		Version:  CheckpointVersion,
+		ID:       l.ID,
+		Heads:    snapshot.Heads,
+		Time:     maxClockTimeForEntries(snapshot.Values, 0),
+		Length:   len(snapshot.Values),
+		Snapshot: snapshotHash,
+	}, prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to write checkpoint")
+	}
+
+	metadata := map[string]string{}
+	for k, v := range options.Metadata {
+		metadata[k] = v
+	}
+	metadata[CheckpointMetadataKey] = io.CIDString(hash)
+
+	checkpointOptions := *options
+	checkpointOptions.PointerCount = 1
+	checkpointOptions.Metadata = metadata
+	checkpointOptions.PayloadCodec = ""
+
+	return l.AppendWithOptions([]byte(io.CIDString(hash)), &checkpointOptions)
+}
+
+// ReadCheckpoint reads the checkpoint of the entry, it is checked against
+// the entry but its snapshot isn't read, see VerifyCheckpoint
+func ReadCheckpoint(services io.IpfsServices, e iface.IPFSLogEntry) (*Checkpoint, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	address, ok := e.GetMetadata()[CheckpointMetadataKey]
+	if !ok {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%s isn't a checkpoint entry", e.GetHash())
+	}
+
+	hash, err := cid.Decode(address)
+	if err != nil {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "unable to decode checkpoint address: %v", err)
+	}
+
+	nd, err := io.ReadCBOR(services, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read checkpoint")
+	}
+
+	c := &Checkpoint{}
+	if err := cbornode.DecodeInto(nd.RawData(), c); err != nil {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "unable to decode checkpoint: %v", err)
+	}
+
+	if c.Version < 1 || c.Version > CheckpointVersion {
+		return nil, errors.Errorf("unsupported checkpoint version %d", c.Version)
+	}
+
+	if c.ID != e.GetLogID() {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "checkpoint of log %s in log %s", c.ID, e.GetLogID())
+	}
+
+	next := cid.NewSet()
+	for _, n := range e.GetNext() {
+		next.Add(n)
+	}
+
+	heads := cid.NewSet()
+	for _, h := range c.Heads {
+		if !next.Has(h) {
+			return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "head %s isn't referenced by the entry", h)
+		}
+		heads.Add(h)
+	}
+
+	if heads.Len() != next.Len() {
+		return nil, errors.Wrap(errmsg.InvalidCheckpoint, "the entry references entries which aren't summarized")
+	}
+
+	if c.Time >= e.GetClock().Time {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "time %d isn't before the entry", c.Time)
+	}
+
+	if c.Length < heads.Len() {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%d entries summarized for %d heads", c.Length, heads.Len())
+	}
+
+	return c, nil
+}
+
+// VerifyCheckpoint reads the checkpoint of the entry and its snapshot,
+// the snapshot is returned once the checkpoint is verified, see Checkpoint
+func VerifyCheckpoint(services io.IpfsServices, e iface.IPFSLogEntry, provider identityprovider.Interface) (*Snapshot, error) {
+	c, err := ReadCheckpoint(services, e)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadPayload(services, c.Snapshot, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read checkpoint snapshot")
+	}
+
+	snapshot, err := ReadSnapshot(bytes.NewReader(data), provider)
+	if err != nil {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "unable to decode snapshot: %v", err)
+	}
+
+	if snapshot.ID != c.ID {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "snapshot of log %s", snapshot.ID)
+	}
+
+	if len(snapshot.Values) != c.Length {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "snapshot holds %d entries instead of %d", len(snapshot.Values), c.Length)
+	}
+
+	if maxClockTimeForEntries(snapshot.Values, 0) != c.Time {
+		return nil, errors.Wrap(errmsg.InvalidCheckpoint, "snapshot time doesn't match")
+	}
+
+	for _, v := range snapshot.Values {
+		if ev, ok := v.(entry.EncodingVerifier); ok {
+			if err := ev.VerifyEncoding(); err != nil {
+				return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%s: %v", v.GetHash(), err)
+			}
+		}
+	}
+
+	if err := validateEntries(snapshot.Values, c.ID, provider, nil); err != nil {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%v", err)
+	}
+
+	values := entry.NewOrderedMapFromEntries(snapshot.Values)
+
+	// The heads must be the ones of the snapshot, and the snapshot must be
+	// the history of the heads only
+	visited := cid.NewSet()
+	stack := append([]cid.Cid{}, c.Heads...)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !visited.Visit(h) {
+			continue
+		}
+
+		v, ok := values.GetCID(h)
+		if !ok {
+			return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%s is missing from the snapshot", h)
+		}
+
+		if IsCheckpoint(v) {
+			continue
+		}
+
+		stack = append(stack, v.GetNext()...)
+	}
+
+	if visited.Len() != values.Len() {
+		return nil, errors.Wrapf(errmsg.InvalidCheckpoint, "%d entries of the snapshot aren't history of its heads", values.Len()-visited.Len())
+	}
+
+	snapshot.Heads = c.Heads
+
+	return snapshot, nil
+}
+
+// verifyCheckpoints reads the checkpoints of the checkpoint entries, see
+// ReadCheckpoint
+func verifyCheckpoints(services io.IpfsServices, entries []iface.IPFSLogEntry) error {
+	for _, e := range entries {
+		if !IsCheckpoint(e) {
+			continue
+		}
+
+		if _, err := ReadCheckpoint(services, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// JoinCheckpoint verifies the checkpoint of the entry and joins the history
+// it summarizes, so the log holds the entries it skipped when it was loaded
+// with FetchOptions.Checkpoints
+func (l *Log) JoinCheckpoint(e iface.IPFSLogEntry) error {
+	snapshot, err := VerifyCheckpoint(l.Storage, e, l.Identity.Provider)
+	if err != nil {
+		return err
+	}
+
+	other, err := NewLog(l.Storage, l.Identity, &NewLogOptions{
+		ID:               l.ID,
+		AccessController: l.accessController,
+		Entries:          entry.NewOrderedMapFromEntries(snapshot.Values),
+		OwnEntries:       true,
+		SortFn:           l.SortFn,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.Join(other, -1); err != nil {
+		return errors.Wrap(err, "unable to join checkpoint")
+	}
+
+	return nil
+}
+
+var atlasCheckpoint = atlas.BuildEntry(Checkpoint{}).
+	StructMap().
+	AddField("Version", atlas.StructMapEntry{SerialName: "version"}).
+	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+	AddField("Heads", atlas.StructMapEntry{SerialName: "heads"}).
+	AddField("Time", atlas.StructMapEntry{SerialName: "time"}).
+	AddField("Length", atlas.StructMapEntry{SerialName: "length"}).
+	AddField("Snapshot", atlas.StructMapEntry{SerialName: "snapshot"}).
+	Complete()
+
+// MarshalCBOR encodes the checkpoint as dag-cbor
+func (c *Checkpoint) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(c)
+}
+
+func init() {
+	cbornode.RegisterCborType(atlasCheckpoint)
+}
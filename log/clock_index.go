@@ -0,0 +1,148 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"sort"
+	"time"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// ClockIndex indexes the entries of a log by the time of their Lamport
+// clock and by their timestamp, entries with the same time are in the
+// order of the log
+type ClockIndex struct {
+	sortFn      func(a, b iface.IPFSLogEntry) (int, error)
+	byClock     []iface.IPFSLogEntry
+	byTimestamp []iface.IPFSLogEntry
+}
+
+// NewClockIndex creates a clock index ordering the entries with the same
+// time with sortFn
+func NewClockIndex(sortFn func(a, b iface.IPFSLogEntry) (int, error)) *ClockIndex {
+	return &ClockIndex{sortFn: sortFn}
+}
+
+func (c *ClockIndex) compareClocks(a, b iface.IPFSLogEntry) (int, error) {
+	if ta, tb := a.GetClock().Time, b.GetClock().Time; ta != tb {
+		return ta - tb, nil
+	}
+
+	return c.sortFn(a, b)
+}
+
+func (c *ClockIndex) compareTimestamps(a, b iface.IPFSLogEntry) (int, error) {
+	if ta, tb := a.GetTimestamp(), b.GetTimestamp(); !ta.Equal(tb) {
+		if ta.Before(tb) {
+			return -1, nil
+		}
+
+		return 1, nil
+	}
+
+	return c.sortFn(a, b)
+}
+
+func (c *ClockIndex) UpdateIndex(e iface.IPFSLogEntry) error {
+	byClock, err := insertSorted(c.byClock, e, c.compareClocks)
+	if err != nil {
+		return err
+	}
+
+	c.byClock = byClock
+
+	if e.GetTimestamp().IsZero() {
+		return nil
+	}
+
+	byTimestamp, err := insertSorted(c.byTimestamp, e, c.compareTimestamps)
+	if err != nil {
+		return err
+	}
+
+	c.byTimestamp = byTimestamp
+
+	return nil
+}
+
+func (c *ClockIndex) Reset() error {
+	c.byClock = nil
+	c.byTimestamp = nil
+	return nil
+}
+
+// Range returns the entries whose clock time is in the [from, to] range
+func (c *ClockIndex) Range(from, to int) []iface.IPFSLogEntry {
+	lo := sort.Search(len(c.byClock), func(i int) bool {
+		return c.byClock[i].GetClock().Time >= from
+	})
+	hi := sort.Search(len(c.byClock), func(i int) bool {
+		return c.byClock[i].GetClock().Time > to
+	})
+
+	if lo >= hi {
+		return []iface.IPFSLogEntry{}
+	}
+
+	return append([]iface.IPFSLogEntry{}, c.byClock[lo:hi]...)
+}
+
+// Between returns the entries whose timestamp is in the [since, until)
+// range, a zero until has no upper bound. Entries without timestamp are
+// skipped.
+func (c *ClockIndex) Between(since, until time.Time) []iface.IPFSLogEntry {
+	lo := sort.Search(len(c.byTimestamp), func(i int) bool {
+		return !c.byTimestamp[i].GetTimestamp().Before(since)
+	})
+
+	hi := len(c.byTimestamp)
+	if !until.IsZero() {
+		hi = sort.Search(len(c.byTimestamp), func(i int) bool {
+			return !c.byTimestamp[i].GetTimestamp().Before(until)
+		})
+	}
+
+	if lo >= hi {
+		return []iface.IPFSLogEntry{}
+	}
+
+	return append([]iface.IPFSLogEntry{}, c.byTimestamp[lo:hi]...)
+}
+
+// clockIndex returns the clock index of the log, it is built on first use
+// and maintained like the other indexes afterwards
+func (l *Log) clockIndex() (*ClockIndex, error) {
+	if l.clocks != nil {
+		return l.clocks, nil
+	}
+
+	clocks := NewClockIndex(l.SortFn)
+	if err := l.AddIndex(clocks); err != nil {
+		return nil, err
+	}
+
+	l.clocks = clocks
+
+	return clocks, nil
+}
+
+// Range returns the entries whose clock time is in the [from, to] range,
+// ordered by time
+func (l *Log) Range(from, to int) ([]iface.IPFSLogEntry, error) {
+	clocks, err := l.clockIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return clocks.Range(from, to), nil
+}
+
+// Between returns the entries whose timestamp is in the [since, until)
+// range, ordered by timestamp, a zero until has no upper bound
+func (l *Log) Between(since, until time.Time) ([]iface.IPFSLogEntry, error) {
+	clocks, err := l.clockIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return clocks.Between(since, until), nil
+}
@@ -0,0 +1,140 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+)
+
+// Fork lists the conflicting entries signed by a single author
+type Fork struct {
+	// Author is the public key of the author
+	Author []byte
+
+	// Heads are the entries of the author that aren't followed by another
+	// of its entries, an honest author has a single one
+	Heads []iface.IPFSLogEntry
+
+	// Equivocations are the entries of the author sharing their clock
+	// time with another of its entries
+	Equivocations []iface.IPFSLogEntry
+}
+
+// ForkReport lists the authors that forked the log
+type ForkReport struct {
+	Forks []Fork
+}
+
+// HasForks returns true if at least one author forked the log
+func (r *ForkReport) HasForks() bool {
+	return len(r.Forks) > 0
+}
+
+// Authors returns the public keys of the authors that forked the log
+func (r *ForkReport) Authors() [][]byte {
+	authors := [][]byte{}
+	for _, f := range r.Forks {
+		authors = append(authors, f.Author)
+	}
+
+	return authors
+}
+
+// DetectForks returns the authors of the log that produced concurrent
+// branches or several entries with the same clock time
+func (l *Log) DetectForks() *ForkReport {
+	return DetectForks(l.Values().Slice())
+}
+
+// DetectForks returns the authors of the given entries that produced
+// concurrent branches or several entries with the same clock time, entries
+// are attributed to the key that signed them
+func DetectForks(entries []iface.IPFSLogEntry) *ForkReport {
+	index := entry.NewOrderedMapFromEntries(entries)
+	byAuthor := map[string][]iface.IPFSLogEntry{}
+
+	for _, e := range index.Slice() {
+		author := hex.EncodeToString(e.GetKey())
+		byAuthor[author] = append(byAuthor[author], e)
+	}
+
+	// An entry is covered when another entry of its author descends from
+	// it, walking back from each entry until the entries of the same
+	// author are reached is enough to mark all of them
+	covered := cid.NewSet()
+	for _, e := range index.Slice() {
+		visited := cid.NewSet()
+		stack := append([]cid.Cid{}, e.GetNext()...)
+
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if !visited.Visit(hash) {
+				continue
+			}
+
+			parent, ok := index.GetCID(hash)
+			if !ok {
+				continue
+			}
+
+			if bytes.Equal(parent.GetKey(), e.GetKey()) {
+				covered.Add(hash)
+				continue
+			}
+
+			stack = append(stack, parent.GetNext()...)
+		}
+	}
+
+	report := &ForkReport{}
+
+	for _, authored := range byAuthor {
+		fork := Fork{Author: authored[0].GetKey()}
+
+		times := map[int][]iface.IPFSLogEntry{}
+		for _, e := range authored {
+			if !covered.Has(e.GetHash()) {
+				fork.Heads = append(fork.Heads, e)
+			}
+
+			times[e.GetClock().Time] = append(times[e.GetClock().Time], e)
+		}
+
+		for _, sameTime := range times {
+			if len(sameTime) > 1 {
+				fork.Equivocations = append(fork.Equivocations, sameTime...)
+			}
+		}
+
+		if len(fork.Heads) < 2 && len(fork.Equivocations) == 0 {
+			continue
+		}
+
+		sortByTimeAndHash(fork.Heads)
+		sortByTimeAndHash(fork.Equivocations)
+		report.Forks = append(report.Forks, fork)
+	}
+
+	sort.Slice(report.Forks, func(i, j int) bool {
+		return bytes.Compare(report.Forks[i].Author, report.Forks[j].Author) < 0
+	})
+
+	return report
+}
+
+func sortByTimeAndHash(entries []iface.IPFSLogEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.GetClock().Time != b.GetClock().Time {
+			return a.GetClock().Time < b.GetClock().Time
+		}
+
+		return bytes.Compare(a.GetHash().Bytes(), b.GetHash().Bytes()) < 0
+	})
+}
@@ -0,0 +1,194 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// HeadsIndex keeps the heads and the clock of a log in a local datastore,
+// they are stored every time the log changes so it can be reopened by
+// NewFromHeadsIndex without fetching its multihash
+type HeadsIndex struct {
+	Datastore datastore.Datastore
+
+	// Key is where the heads are stored, the log ID when empty
+	Key datastore.Key
+}
+
+// cborHeadsIndex is the serialized form of the heads of a log
+type cborHeadsIndex struct {
+	ID    string
+	Heads []cid.Cid
+	Clock *lamportclock.CborLamportClock
+}
+
+func (h *HeadsIndex) key(id string) datastore.Key {
+	if k := h.Key.String(); k != "" && k != "/" {
+		return h.Key
+	}
+
+	return datastore.NewKey(id)
+}
+
+// save stores the current heads and clock of the log
+func (h *HeadsIndex) save(l *Log) error {
+	data, err := cbornode.DumpObject(&cborHeadsIndex{
+		ID:    l.ID,
+		Heads: entrySliceToCids(l.heads.Slice()),
+		Clock: l.Clock.ToCborLamportClock(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to encode heads index")
+	}
+
+	if err := h.Datastore.Put(h.key(l.ID), data); err != nil {
+		return errors.Wrap(err, "unable to write heads index")
+	}
+
+	return nil
+}
+
+// load reads the heads stored for the log, false is returned when none are
+func (h *HeadsIndex) load(id string) (*cborHeadsIndex, bool, error) {
+	data, err := h.Datastore.Get(h.key(id))
+	if err == datastore.ErrNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, errors.Wrap(err, "unable to read heads index")
+	}
+
+	c := &cborHeadsIndex{}
+	if err := cbornode.DecodeInto(data, c); err != nil {
+		return nil, false, errors.Wrap(err, "unable to decode heads index")
+	}
+
+	return c, true, nil
+}
+
+// saveHeads stores the heads of the log in its index, if any
+func (l *Log) saveHeads() error {
+	if l.headsIndex == nil {
+		return nil
+	}
+
+	return l.headsIndex.save(l)
+}
+
+// NewFromHeadsIndex reopens the log whose heads are kept in the index, only
+// the heads are read, from the EntryStore or the local blockstore when
+// possible, and the other entries are fetched when needed like in a lazy
+// log. An empty log is created when the index holds no heads for the log,
+// logOptions.ID is required unless index.Key is set.
+func NewFromHeadsIndex(services io.IpfsServices, identity *identityprovider.Identity, index *HeadsIndex, logOptions *NewLogOptions) (*Log, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	if identity == nil {
+		return nil, errmsg.IdentityNotDefined
+	}
+
+	if logOptions == nil {
+		return nil, errmsg.LogOptionsNotDefined
+	}
+
+	if index == nil || index.Datastore == nil {
+		return nil, errors.New("heads index is not defined")
+	}
+
+	if logOptions.ID == "" && index.key("").String() == "/" {
+		return nil, errors.New("log ID is not defined")
+	}
+
+	stored, ok, err := index.load(logOptions.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfromheadsindex failed")
+	}
+
+	if !ok {
+		options := *logOptions
+		options.HeadsIndex = index
+
+		return NewLog(services, identity, &options)
+	}
+
+	if logOptions.ID != "" && logOptions.ID != stored.ID {
+		return nil, errors.Errorf("newfromheadsindex failed: heads of log %s, expected %s", stored.ID, logOptions.ID)
+	}
+
+	report := &RepairReport{}
+
+	heads := []iface.IPFSLogEntry{}
+	for _, h := range stored.Heads {
+		e, err := readHead(services, logOptions.EntryStore, h, identity.Provider)
+		if err != nil && logOptions.Repair != nil {
+			report.Dropped = append(report.Dropped, h)
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "newfromheadsindex failed")
+		}
+
+		heads = append(heads, e)
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(heads, stored.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfromheadsindex failed")
+		}
+	}
+
+	var clock *lamportclock.LamportClock
+	if stored.Clock != nil {
+		if clock, err = stored.Clock.ToLamportClock(); err != nil {
+			return nil, errors.Wrap(err, "unable to decode heads index clock")
+		}
+	}
+
+	options := reopenOptions(logOptions, stored.ID, logOptions.AccessController, entry.NewOrderedMapFromEntries(heads), heads, clock)
+	options.Lazy = true
+	options.HeadsIndex = index
+
+	l, err := NewLog(services, identity, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return repairOnOpen(l, report, logOptions)
+}
+
+// readHead reads a head from the store, falling back to the local
+// blockstore and then IPFS, see fetchEntry
+func readHead(services io.IpfsServices, store entry.Store, hash cid.Cid, provider identityprovider.Interface) (iface.IPFSLogEntry, error) {
+	if store != nil {
+		e, ok, err := store.Get(hash)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read head from store")
+		}
+
+		if ok {
+			return e, nil
+		}
+	}
+
+	return fetchEntry(services, hash, provider)
+}
+
+var atlasCborHeadsIndex = atlas.BuildEntry(cborHeadsIndex{}).
+	StructMap().
+	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+	AddField("Heads", atlas.StructMapEntry{SerialName: "heads"}).
+	AddField("Clock", atlas.StructMapEntry{SerialName: "clock"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(atlasCborHeadsIndex)
+}
@@ -0,0 +1,55 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// EntryHook receives the entries accepted by a log, to feed an external
+// index like a full-text search engine. Unlike an Index, a hook isn't reset
+// when entries are removed, Replay rebuilds the external index instead.
+type EntryHook func(e iface.IPFSLogEntry) error
+
+type entryHook struct {
+	fn   EntryHook
+	seen *cid.Set
+}
+
+// OnEntry registers a hook called with the entries appended or joined from
+// now on, in the order of Values. The hook is called once per entry, an
+// entry joined again by another join or after being removed is skipped. An
+// error of the hook is returned by the operation adding the entry, which
+// stays in the log and isn't passed to the hook again.
+func (l *Log) OnEntry(hook EntryHook) {
+	l.hooks = append(l.hooks, &entryHook{fn: hook, seen: cid.NewSet()})
+}
+
+// Replay calls hook with every entry of the log in the order of Values, to
+// rebuild an external index from scratch
+func (l *Log) Replay(hook EntryHook) error {
+	for _, e := range l.Values().Slice() {
+		if err := hook(e); err != nil {
+			return errors.Wrap(err, "replay failed")
+		}
+	}
+
+	return nil
+}
+
+// runHooks passes the accepted entries to the hooks which haven't seen them
+func (l *Log) runHooks(entries []iface.IPFSLogEntry) error {
+	for _, hook := range l.hooks {
+		for _, e := range entries {
+			if !hook.seen.Visit(e.GetHash()) {
+				continue
+			}
+
+			if err := hook.fn(e); err != nil {
+				return errors.Wrap(err, "entry hook failed")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"sort"
+
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// Index maintains state derived from the entries of a log, like the values
+// of a key-value store, so it isn't computed again from Values on every
+// change. The log updates its indexes as entries are appended or joined
+// and rebuilds them when entries are removed. An error of an index is
+// returned by the operation adding the entries, which stay in the log.
+type Index interface {
+	// UpdateIndex adds an entry to the index, the entries of an append or
+	// a join are added in the order of Values
+	UpdateIndex(e iface.IPFSLogEntry) error
+
+	// Reset clears the index, it is then rebuilt from Values
+	Reset() error
+}
+
+// AddIndex adds an index to the log and builds it from its entries
+func (l *Log) AddIndex(index Index) error {
+	if err := rebuildIndex(index, l.Values().Slice()); err != nil {
+		return err
+	}
+
+	l.indexes = append(l.indexes, index)
+
+	return nil
+}
+
+// RebuildIndexes resets the indexes of the log and adds its entries again,
+// the indexes of lazy logs only hold the entries added since they were
+// opened until they are rebuilt
+func (l *Log) RebuildIndexes() error {
+	if len(l.indexes) == 0 {
+		return nil
+	}
+
+	values := l.Values().Slice()
+	for _, index := range l.indexes {
+		if err := rebuildIndex(index, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rebuildIndex(index Index, values []iface.IPFSLogEntry) error {
+	if err := index.Reset(); err != nil {
+		return errors.Wrap(err, "unable to reset index")
+	}
+
+	for _, e := range values {
+		if err := index.UpdateIndex(e); err != nil {
+			return errors.Wrap(err, "unable to update index")
+		}
+	}
+
+	return nil
+}
+
+// updateIndexes adds the entries to the indexes of the log
+func (l *Log) updateIndexes(entries []iface.IPFSLogEntry) error {
+	for _, index := range l.indexes {
+		for _, e := range entries {
+			if err := index.UpdateIndex(e); err != nil {
+				return errors.Wrap(err, "unable to update index")
+			}
+		}
+	}
+
+	return nil
+}
+
+// insertSorted inserts an entry in entries sorted by compare, entries
+// already present are skipped
+func insertSorted(entries []iface.IPFSLogEntry, e iface.IPFSLogEntry, compare func(a, b iface.IPFSLogEntry) (int, error)) ([]iface.IPFSLogEntry, error) {
+	var err error
+	i := sort.Search(len(entries), func(i int) bool {
+		ret, compareErr := compare(entries[i], e)
+		if compareErr != nil {
+			err = compareErr
+		}
+
+		return ret > 0
+	})
+	if err != nil {
+		return entries, err
+	}
+
+	if i > 0 && entries[i-1].GetHash().Equals(e.GetHash()) {
+		return entries, nil
+	}
+
+	entries = append(entries, nil)
+	copy(entries[i+1:], entries[i:])
+	entries[i] = e
+
+	return entries, nil
+}
@@ -0,0 +1,154 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// Kinds of problems found when verifying the integrity of a log
+const (
+	ProblemHash        = "hash"
+	ProblemSignature   = "signature"
+	ProblemMissingNext = "missing-next"
+
+	// ProblemMissingBlock is reported when the block of an entry can't be
+	// read from the storage of the log
+	ProblemMissingBlock = "missing-block"
+)
+
+// IntegrityProblem describes a problem found on an entry of a log
+type IntegrityProblem struct {
+	Hash cid.Cid
+	Kind string
+	Err  error
+}
+
+// IntegrityReport lists the problems found when verifying a log
+type IntegrityReport struct {
+	// Checked is the number of entries verified
+	Checked  int
+	Problems []IntegrityProblem
+}
+
+// OK returns true if no problem was found
+func (r *IntegrityReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify walks the whole log from its heads, checking that each entry
+// matches its hash, that its signature is valid and that its Next links
+// can be resolved, an error is only returned when ctx is done
+func (l *Log) Verify(ctx context.Context) (*IntegrityReport, error) {
+	report := &IntegrityReport{}
+	visited := cid.NewSet()
+	queue := []iface.IPFSLogEntry{}
+
+	for _, h := range l.heads.Slice() {
+		if visited.Visit(h.GetHash()) {
+			queue = append(queue, h)
+		}
+	}
+
+	for len(queue) > 0 {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+
+		e := queue[0]
+		queue = queue[1:]
+		report.Checked++
+
+		problem := func(kind string, err error) {
+			report.Problems = append(report.Problems, IntegrityProblem{Hash: e.GetHash(), Kind: kind, Err: err})
+		}
+
+		if kind, err := l.verifyHash(ctx, e); err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+
+			problem(kind, err)
+		}
+
+		if err := e.Verify(l.Identity.Provider); err != nil {
+			problem(ProblemSignature, err)
+		}
+
+		for _, next := range e.GetNext() {
+			if !visited.Visit(next) {
+				continue
+			}
+
+			n, err := l.resolve(next)
+			if err != nil {
+				problem(ProblemMissingNext, errors.Wrapf(err, "unable to resolve %s", next))
+				continue
+			}
+
+			queue = append(queue, n)
+		}
+	}
+
+	return report, nil
+}
+
+// verifyHash checks that the entry and its stored block match its hash,
+// the kind of the problem found is returned with the error
+func (l *Log) verifyHash(ctx context.Context, e iface.IPFSLogEntry) (string, error) {
+	if ev, ok := e.(entry.EncodingVerifier); ok {
+		if err := ev.VerifyEncoding(); err != nil {
+			return ProblemHash, err
+		}
+	}
+
+	if err := l.pageIn(e.GetHash()); err != nil {
+		return ProblemMissingBlock, err
+	}
+
+	nd, err := l.Storage.DAG().Get(ctx, e.GetHash())
+	if err != nil {
+		return ProblemMissingBlock, errors.Wrapf(err, "unable to read block %s", e.GetHash())
+	}
+
+	sum, err := e.GetHash().Prefix().Sum(nd.RawData())
+	if err != nil {
+		return ProblemHash, err
+	}
+
+	if !sum.Equals(e.GetHash()) {
+		return ProblemHash, errors.Wrapf(errmsg.HashMismatch, "stored block hashes to %s", sum)
+	}
+
+	return "", nil
+}
+
+// resolve returns the entry for the given hash, fetching it if it isn't
+// known to the log
+func (l *Log) resolve(hash cid.Cid) (iface.IPFSLogEntry, error) {
+	e, ok, err := l.get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return e, nil
+	}
+
+	e, err = l.fetch(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.decrypt(e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
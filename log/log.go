@@ -2,20 +2,26 @@ package log // import "berty.tech/go-ipfs-log/log"
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/codec"
 	"berty.tech/go-ipfs-log/entry"
 	"berty.tech/go-ipfs-log/errmsg"
 	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/sorting"
+	"berty.tech/go-ipfs-log/utils/hlc"
 	"berty.tech/go-ipfs-log/utils/lamportclock"
-	"github.com/iancoleman/orderedmap"
+	"berty.tech/go-ipfs-log/utils/vectorclock"
 	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	"github.com/pkg/errors"
 	"github.com/polydawn/refmt/obj/atlas"
@@ -24,33 +30,248 @@ import (
 type JSONLog struct {
 	ID    string
 	Heads []cid.Cid
+
+	// Clocks holds the clock of each head in the same order as Heads, it
+	// is empty for logs serialized by older versions
+	Clocks []*lamportclock.CborLamportClock
+
+	// AccessController is the address of the access controller stored on
+	// IPFS, empty when it isn't stored
+	AccessController string
+
+	// Manifest is the address of the manifest of the log, empty when it
+	// wasn't written
+	Manifest string
+}
+
+// HeadClock returns the clock of the head at the given index, nil when it
+// isn't known
+func (j *JSONLog) HeadClock(i int) *lamportclock.LamportClock {
+	if i < 0 || i >= len(j.Clocks) || j.Clocks[i] == nil {
+		return nil
+	}
+
+	clock, err := j.Clocks[i].ToLamportClock()
+	if err != nil {
+		return nil
+	}
+
+	return clock
 }
 
+// MaxTime returns the greatest Lamport time of the heads, -1 when the clocks
+// of the heads aren't known
+func (j *JSONLog) MaxTime() int {
+	max := -1
+	for i := range j.Clocks {
+		if clock := j.HeadClock(i); clock != nil && clock.Time > max {
+			max = clock.Time
+		}
+	}
+
+	return max
+}
+
+// Log is an append-only log of entries. Entries holds its entries and Next
+// indexes them by the hashes they point to. A lazy log only holds its heads
+// and the entries appended or joined since it was opened in Entries, the
+// entries it fetches are kept in its cache, see IsLazy.
 type Log struct {
-	Storage          *io.IpfsServices
-	ID               string
-	AccessController accesscontroller.Interface
-	SortFn           func(a *entry.Entry, b *entry.Entry) (int, error)
-	Identity         *identityprovider.Identity
-	Entries          *entry.OrderedMap
-	heads            *entry.OrderedMap
-	Next             *entry.OrderedMap
-	Clock            *lamportclock.LamportClock
+	Storage           io.IpfsServices
+	ID                string
+	AccessController  accesscontroller.Interface
+	accessController  accesscontroller.Interface
+	SortFn            func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)
+	Identity          *identityprovider.Identity
+	Entries           *entry.OrderedMap
+	heads             *entry.OrderedMap
+	Next              *entry.OrderedMap
+	Clock             *lamportclock.LamportClock
+	cache             *entryCache
+	store             entry.Store
+	known             *knownFilter
+	codec             codec.Codec
+	payloadThreshold  int
+	compression       string
+	encryption        entry.EncryptionProvider
+	encoding          string
+	prefix            *cid.Prefix
+	clockType         string
+	hlc               *hlc.Clock
+	timestamps        bool
+	now               func() time.Time
+	strictClocks      bool
+	verifyConcurrency int
+	strictValidation  bool
+	revocations       accesscontroller.RevocationChecker
+	denylist          entry.Denylist
+	pin               bool
+	stamper           Stamper
+	releaseOptions    *ReleaseOptions
+	headsIndex        *HeadsIndex
+	wal               *WAL
+	indexes           []Index
+	authors           *AuthorIndex
+	clocks            *ClockIndex
+	hooks             []*entryHook
+	writes            sync.WaitGroup
+	writeLock         sync.Mutex
+	writeErr          error
+	archives          []cid.Cid
+	pagedIn           *cid.Set
+	name              string
+	sortName          string
+	manifest          cid.Cid
+	listeners         []*listener
+	listenersLock     sync.Mutex
 }
 
 type NewLogOptions struct {
-	ID               string
+	// ID identifies the log, the address of the manifest of Name,
+	// AccessController and SortName is used when empty, see
+	// Manifest.Address
+	ID string
+
+	// Name is the human readable name the address of the log is derived
+	// from when ID is empty
+	Name string
+
 	AccessController accesscontroller.Interface
 	Entries          *entry.OrderedMap
-	Heads            []*entry.Entry
-	Clock            *lamportclock.LamportClock
-	SortFn           func(a *entry.Entry, b *entry.Entry) (int, error)
+
+	// OwnEntries hands Entries over to the log instead of copying it, the
+	// caller must not modify the map afterwards
+	OwnEntries bool
+
+	Heads []iface.IPFSLogEntry
+	Clock *lamportclock.LamportClock
+
+	// SortFn orders the entries of the log, see the sorting package for
+	// the available strategies. Defaults to sorting.LastWriteWins.
+	SortFn func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)
+
+	// SortName is the name of a sort function registered in the sorting
+	// package, it is recorded in the manifest and used when neither SortFn
+	// nor Tiebreaker is set
+	SortName string
+
+	// Manifest is the address of the manifest the log was loaded from, see
+	// WriteManifest
+	Manifest cid.Cid
+
+	// Tiebreaker orders entries having the same Lamport time when SortFn
+	// isn't set, the clock IDs are compared by default.
+	Tiebreaker sorting.Tiebreaker
+
+	// Lazy makes the log fetch entries from IPFS when they are first
+	// needed instead of requiring the whole DAG to be loaded in memory.
+	Lazy bool
+
+	// CacheSize bounds the number of fetched entries a lazy log keeps in
+	// memory, DefaultCacheSize is used when zero.
+	CacheSize int
+
+	// EntryStore keeps the entries of the log outside of memory, it
+	// implies Lazy.
+	EntryStore entry.Store
+
+	// Codec is the payload codec used by AppendValue, defaults to JSON.
+	Codec codec.Codec
+
+	// PayloadThreshold is the payload size in bytes above which appended
+	// payloads are stored in their own blocks, 0 keeps them inline.
+	PayloadThreshold int
+
+	// PayloadCompression is the algorithm used to compress appended
+	// payloads, see entry.CompressionGzip.
+	PayloadCompression string
+
+	// Encryption encrypts appended payloads and decrypts fetched ones,
+	// entries encrypted with unknown keys are kept opaque.
+	Encryption entry.EncryptionProvider
+
+	// EntryEncoding is the IPLD format of appended entries, see
+	// entry.EncodingDagJSON.
+	EntryEncoding string
+
+	// CIDPrefix sets the CID version and hash function used to write
+	// entries and the log manifest, io.DefaultPrefix is used when nil.
+	CIDPrefix *cid.Prefix
+
+	// ClockType selects the clock carried by appended entries in addition
+	// to their Lamport clock, see vectorclock.Type and hlc.Type.
+	ClockType string
+
+	// Timestamps records the wall time in appended entries, timestamps
+	// are signed but never used for ordering
+	Timestamps bool
+
+	// StrictClocks rejects fetched and joined entries whose Lamport time
+	// isn't greater than the time of their parents
+	StrictClocks bool
+
+	// StrictValidation verifies the signature, identity, log ID and clock
+	// of every entry when loading a log, failing with a ValidationError
+	StrictValidation bool
+
+	// Revocations rejects the entries signed by revoked keys when they are
+	// appended, joined or validated
+	Revocations accesscontroller.RevocationChecker
+
+	// Denylist rejects the denied entries and the entries of denied
+	// authors, they are neither fetched nor joined and their parents are
+	// only reached through other entries
+	Denylist entry.Denylist
+
+	// Pin pins every appended entry, see AppendOptions.Pin
+	Pin bool
+
+	// Stamper timestamps every appended entry before it is added to the
+	// log, the append fails when it can't, see the anchor/ots package
+	Stamper Stamper
+
+	// Release unpins or deletes the blocks of the entries removed by Prune
+	// or by a Join with a size, the blocks are kept when nil. Deleting
+	// blocks requires services with a pinner.
+	Release *ReleaseOptions
+
+	// VerifyConcurrency is the number of entry signatures verified in
+	// parallel by Join, GOMAXPROCS when 0
+	VerifyConcurrency int
+
+	// BloomFilter sizes a bloom filter of the entries of the log for this
+	// many entries, Difference and Join use it to skip the lookups of the
+	// entries the log doesn't have. It is disabled when 0 or when the
+	// EntryStore isn't an entry.Lister. Entries must then only be added
+	// through the log.
+	BloomFilter int
+
+	// HeadsIndex stores the heads and the clock of the log every time they
+	// change, see NewFromHeadsIndex
+	HeadsIndex *HeadsIndex
+
+	// WAL records the appended entries before they are written to IPFS,
+	// NewLog recovers the entries it holds, see Log.Recover
+	WAL *WAL
+
+	// Indexes are updated with the entries added to the log, they are
+	// built from the entries of the log when it isn't lazy, see Index
+	Indexes []Index
+
+	// Repair makes NewFromHeadsIndex and NewFromSnapshot repair the log
+	// they open instead of failing or ignoring the heads they can't find,
+	// the function is called with what was repaired, see Log.Repair
+	Repair func(report *RepairReport)
+
+	// Now returns the wall time used by hybrid logical clocks and
+	// timestamps, time.Now when nil
+	Now func() time.Time
 }
 
 type Snapshot struct {
 	ID     string
 	Heads  []cid.Cid
-	Values []*entry.Entry
+	Values []iface.IPFSLogEntry
 	Clock  *lamportclock.LamportClock
 }
 
@@ -62,16 +283,27 @@ func maxInt(x, y int) int {
 	return x
 }
 
-func maxClockTimeForEntries(entries []*entry.Entry, defValue int) int {
+func maxClockTimeForEntries(entries []iface.IPFSLogEntry, defValue int) int {
 	max := defValue
 	for _, e := range entries {
-		max = maxInt(e.Clock.Time, max)
+		max = maxInt(e.GetClock().Time, max)
 	}
 
 	return max
 }
 
-func NewLog(services *io.IpfsServices, identity *identityprovider.Identity, options *NewLogOptions) (*Log, error) {
+func minClockTimeForEntries(entries []iface.IPFSLogEntry) int {
+	min := 0
+	for i, e := range entries {
+		if i == 0 || e.GetClock().Time < min {
+			min = e.GetClock().Time
+		}
+	}
+
+	return min
+}
+
+func NewLog(services io.IpfsServices, identity *identityprovider.Identity, options *NewLogOptions) (*Log, error) {
 	if services == nil {
 		return nil, errmsg.IPFSNotDefined
 	}
@@ -84,12 +316,25 @@ func NewLog(services *io.IpfsServices, identity *identityprovider.Identity, opti
 		options = &NewLogOptions{}
 	}
 
-	if options.ID == "" {
-		options.ID = strconv.FormatInt(time.Now().Unix()/1000, 10)
+	if options.Release != nil && options.Release.Delete && services.Pinner() == nil {
+		return nil, errors.Wrap(errmsg.PinnerNotDefined, "blocks can't be deleted without pinner")
+	}
+
+	if options.SortFn == nil && options.Tiebreaker == nil && options.SortName != "" {
+		fn, ok := sorting.Lookup(options.SortName)
+		if !ok {
+			return nil, errors.Wrapf(errmsg.UnknownSortFunction, "%q", options.SortName)
+		}
+
+		options.SortFn = fn
+	}
+
+	if options.SortFn == nil && options.Tiebreaker != nil {
+		options.SortFn = sorting.LastWriteWinsWithTiebreaker(options.Tiebreaker)
 	}
 
 	if options.SortFn == nil {
-		options.SortFn = LastWriteWins
+		options.SortFn = sorting.LastWriteWins
 	}
 
 	maxTime := 0
@@ -102,68 +347,405 @@ func NewLog(services *io.IpfsServices, identity *identityprovider.Identity, opti
 		options.AccessController = &accesscontroller.Default{}
 	}
 
+	if options.ID == "" {
+		addr, err := newAddress(options.Name, options.AccessController, options.SortName)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to compute log address")
+		}
+
+		options.ID = addr.String()
+	}
+
+	if options.Codec == nil {
+		options.Codec = &codec.JSON{}
+	}
+
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	switch options.ClockType {
+	case "", lamportclock.Type:
+		options.ClockType = ""
+	case vectorclock.Type, hlc.Type:
+	default:
+		return nil, errors.Errorf("unsupported clock type: %s", options.ClockType)
+	}
+
+	if options.CIDPrefix != nil {
+		if err := io.CheckPrefix(*options.CIDPrefix); err != nil {
+			return nil, err
+		}
+	}
+
 	if options.Entries == nil {
 		options.Entries = entry.NewOrderedMap()
 	}
 
-	if len(options.Heads) == 0 && len(options.Entries.Keys()) > 0 {
+	if len(options.Heads) == 0 && options.Entries.Len() > 0 {
 		options.Heads = FindHeads(options.Entries)
 	}
 
 	next := entry.NewOrderedMap()
-	for _, key := range options.Entries.Keys() {
-		entry := options.Entries.UnsafeGet(key)
-		for _, n := range entry.Next {
-			next.Set(n.String(), entry)
+	for _, entry := range options.Entries.Slice() {
+		for _, n := range entry.GetNext() {
+			next.SetCID(n, entry)
 		}
 	}
 
-	return &Log{
-		Storage:          services,
-		ID:               options.ID,
-		Identity:         identity,
-		AccessController: options.AccessController,
-		SortFn:           NoZeroes(options.SortFn),
-		Entries:          options.Entries.Copy(),
-		heads:            entry.NewOrderedMapFromEntries(options.Heads),
-		Next:             next,
-		Clock:            lamportclock.New(identity.PublicKey, maxTime),
-	}, nil
+	var cache *entryCache
+	if options.Lazy || options.EntryStore != nil {
+		var err error
+		if cache, err = newEntryCache(options.CacheSize); err != nil {
+			return nil, errors.Wrap(err, "unable to create entry cache")
+		}
+	}
+
+	entries := options.Entries
+	if !options.OwnEntries {
+		entries = entries.Copy()
+	}
+
+	l := &Log{
+		Storage:           services,
+		ID:                options.ID,
+		Identity:          identity,
+		AccessController:  accesscontroller.Revocable(options.AccessController, options.Revocations),
+		accessController:  options.AccessController,
+		SortFn:            sorting.NoZeroes(options.SortFn),
+		Entries:           entries,
+		heads:             entry.NewOrderedMapFromEntries(options.Heads),
+		Next:              next,
+		Clock:             lamportclock.New(identity.PublicKey, maxTime),
+		cache:             cache,
+		store:             options.EntryStore,
+		codec:             options.Codec,
+		payloadThreshold:  options.PayloadThreshold,
+		compression:       options.PayloadCompression,
+		encryption:        options.Encryption,
+		encoding:          options.EntryEncoding,
+		prefix:            options.CIDPrefix,
+		name:              options.Name,
+		sortName:          options.SortName,
+		manifest:          options.Manifest,
+		clockType:         options.ClockType,
+		hlc:               hlc.New(options.Now),
+		timestamps:        options.Timestamps,
+		now:               options.Now,
+		strictClocks:      options.StrictClocks,
+		verifyConcurrency: options.VerifyConcurrency,
+		strictValidation:  options.StrictValidation,
+		revocations:       options.Revocations,
+		denylist:          options.Denylist,
+		pin:               options.Pin,
+		stamper:           options.Stamper,
+		releaseOptions:    options.Release,
+		headsIndex:        options.HeadsIndex,
+		wal:               options.WAL,
+		indexes:           append([]Index{}, options.Indexes...),
+	}
+
+	for _, e := range append(l.Entries.Slice(), l.heads.Slice()...) {
+		if err := l.decrypt(e); err != nil {
+			return nil, err
+		}
+
+		l.trackArchive(e)
+	}
+
+	if err := l.initKnownFilter(options.BloomFilter); err != nil {
+		return nil, err
+	}
+
+	if !l.IsLazy() && len(l.indexes) > 0 {
+		if err := l.RebuildIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := l.Recover(); err != nil {
+		return nil, errors.Wrap(err, "unable to recover entries")
+	}
+
+	return l, nil
 }
 
-// addToStack Add an entry to the stack and traversed nodes index
-func (l *Log) addToStack(e *entry.Entry, stack []*entry.Entry, traversed *orderedmap.OrderedMap) ([]*entry.Entry, *orderedmap.OrderedMap) {
-	// If we've already processed the entry, don't add it to the stack
-	if _, ok := traversed.Get(e.Hash.String()); ok {
-		return stack, traversed
+// initKnownFilter fills the bloom filter with the entries of the log and of
+// its store
+func (l *Log) initKnownFilter(size int) error {
+	if size <= 0 {
+		return nil
 	}
 
-	// Add the entry in front of the stack and sort
-	stack = append([]*entry.Entry{e}, stack...)
-	entry.Sort(l.SortFn, stack)
-	Reverse(stack)
+	var lister entry.Lister
+	if l.store != nil {
+		var ok bool
+		if lister, ok = l.store.(entry.Lister); !ok {
+			return nil
+		}
+	}
 
-	// Add to the cache of processed entries
-	traversed.Set(e.Hash.String(), true)
+	known, err := newKnownFilter(size)
+	if err != nil {
+		return errors.Wrap(err, "unable to create bloom filter")
+	}
 
-	return stack, traversed
+	for _, h := range l.Entries.CIDs() {
+		known.add(h)
+	}
+
+	if lister != nil {
+		err := lister.ForEachHash(func(hash cid.Cid) error {
+			known.add(hash)
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to fill bloom filter")
+		}
+	}
+
+	l.known = known
+
+	return nil
 }
 
-func (l *Log) Traverse(rootEntries *entry.OrderedMap, amount int, endHash string) ([]*entry.Entry, error) {
+// decrypt decrypts the payload of an entry using the log's encryption
+// provider
+func (l *Log) decrypt(e iface.IPFSLogEntry) error {
+	if d, ok := e.(entry.PayloadDecrypter); ok {
+		return d.DecryptPayload(l.encryption)
+	}
+
+	return nil
+}
+
+// IsLazy returns true if entries are fetched on demand
+func (l *Log) IsLazy() bool {
+	return l.cache != nil
+}
+
+// CacheStats returns the statistics of the entry cache of a lazy log
+func (l *Log) CacheStats() CacheStats {
+	if l.cache == nil {
+		return CacheStats{}
+	}
+
+	return l.cache.Stats()
+}
+
+// get returns the entry for the given hash, fetching it when the log is
+// lazy and the entry isn't held in memory
+func (l *Log) get(hash cid.Cid) (iface.IPFSLogEntry, bool, error) {
+	if e, ok := l.Entries.GetCID(hash); ok {
+		return e, true, nil
+	}
+
+	if l.cache == nil {
+		return nil, false, nil
+	}
+
+	if l.deniesEntry(hash) {
+		return nil, false, nil
+	}
+
+	if e, ok := l.cache.Get(hash); ok {
+		return e, true, nil
+	}
+
+	if l.store != nil {
+		e, ok, err := l.store.Get(hash)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "unable to read entry from store")
+		}
+
+		if ok {
+			if err := l.decrypt(e); err != nil {
+				return nil, false, err
+			}
+
+			l.trackArchive(e)
+			l.cache.Add(e)
+			return e, true, nil
+		}
+	}
+
+	e, err := l.fetch(hash)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to fetch entry")
+	}
+
+	if !e.IsValid() || entry.IsDenied(l.denylist, e) {
+		return nil, false, nil
+	}
+
+	if l.strictValidation {
+		if err := validateEntries([]iface.IPFSLogEntry{e}, l.ID, l.Identity.Provider, l.revocations); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if child, ok := l.Next.GetCID(hash); ok && l.strictClocks {
+		if err := entry.CheckClock(child, e); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := l.decrypt(e); err != nil {
+		return nil, false, err
+	}
+
+	if l.store != nil {
+		if err := l.store.Put(e); err != nil {
+			return nil, false, errors.Wrap(err, "unable to write entry to store")
+		}
+
+		if l.known != nil {
+			l.known.add(hash)
+		}
+	}
+
+	l.trackArchive(e)
+	l.cache.Add(e)
+
+	return e, true, nil
+}
+
+// has returns true if the entry is known to the log without fetching it
+func (l *Log) has(hash cid.Cid) bool {
+	if l.known != nil && !l.known.mayHave(hash) {
+		return false
+	}
+
+	if l.Entries.HasCID(hash) {
+		return true
+	}
+
+	if l.cache != nil && l.cache.Has(hash) {
+		return true
+	}
+
+	if l.store != nil {
+		ok, err := l.store.Has(hash)
+		return err == nil && ok
+	}
+
+	return false
+}
+
+// deniesEntry returns true if the entry with the given hash is denied
+func (l *Log) deniesEntry(hash cid.Cid) bool {
+	return l.denylist != nil && l.denylist.DeniesEntry(hash)
+}
+
+// put adds an entry to the log's entry index
+func (l *Log) put(e iface.IPFSLogEntry) error {
+	l.trackArchive(e)
+
+	if l.known != nil {
+		l.known.add(e.GetHash())
+	}
+
+	if l.store == nil {
+		l.Entries.Put(e)
+		return nil
+	}
+
+	if err := l.store.Put(e); err != nil {
+		return errors.Wrap(err, "unable to write entry to store")
+	}
+
+	l.cache.Add(e)
+
+	return nil
+}
+
+// fetch reads an entry from the local blockstore, falling back to the
+// archives of the log and then IPFS
+func (l *Log) fetch(hash cid.Cid) (iface.IPFSLogEntry, error) {
+	if err := l.pageIn(hash); err != nil {
+		return nil, err
+	}
+
+	return fetchEntry(l.Storage, hash, l.Identity.Provider)
+}
+
+// fetchEntry reads an entry from the local blockstore, falling back to IPFS
+func fetchEntry(services io.IpfsServices, hash cid.Cid, provider identityprovider.Interface) (iface.IPFSLogEntry, error) {
+	if services.BlockStore() != nil {
+		if block, err := services.BlockStore().Get(hash); err == nil {
+			e, err := entry.FromRawData(block.RawData(), hash, provider)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := entry.ResolvePayload(services, e); err != nil {
+				return nil, err
+			}
+
+			return e, nil
+		}
+	}
+
+	return entry.FromMultihash(services, hash, provider)
+}
+
+func (l *Log) Traverse(rootEntries *entry.OrderedMap, amount int, endHash string) ([]iface.IPFSLogEntry, error) {
+	// End result
+	result := make([]iface.IPFSLogEntry, 0, l.traverseHint(amount))
+
+	err := l.traverse(rootEntries, amount, endHash, func(e iface.IPFSLogEntry) bool {
+		result = append(result, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// traverseHint returns the number of entries a traversal is expected to
+// reach, used to size its buffers. The cached entries of a lazy log are
+// counted as they aren't held by Entries.
+func (l *Log) traverseHint(amount int) int {
+	hint := l.Entries.Len()
+	if l.cache != nil {
+		hint += l.cache.Stats().Len
+	}
+
+	if amount >= 0 && amount < hint {
+		hint = amount
+	}
+
+	return hint
+}
+
+// traverse calls yield with the entries in the order returned by Traverse
+// until yield returns false
+func (l *Log) traverse(rootEntries *entry.OrderedMap, amount int, endHash string, yield func(iface.IPFSLogEntry) bool) error {
 	if rootEntries == nil {
-		return nil, errmsg.EntriesNotDefined
+		return errmsg.EntriesNotDefined
+	}
+
+	// An invalid end hash never matches, the whole log is traversed
+	var end cid.Cid
+	if endHash != "" {
+		end, _ = cid.Decode(endHash)
 	}
 
 	// Sort the given given root entries and use as the starting stack
-	stack := rootEntries.Slice()
+	roots := rootEntries.Slice()
 
-	entry.Sort(l.SortFn, stack)
-	Reverse(stack)
+	entry.Sort(l.SortFn, roots)
+	sorting.Reverse(roots)
+
+	stack := newEntryQueue(l.SortFn)
+	for _, e := range roots {
+		stack.push(e)
+	}
 
 	// Cache for checking if we've processed an entry already
-	traversed := orderedmap.New()
-	// End result
-	result := []*entry.Entry{}
+	traversed := make(map[cid.Cid]struct{}, l.traverseHint(amount))
 	// We keep a counter to check if we have traversed requested amount of entries
 	count := 0
 
@@ -171,98 +753,349 @@ func (l *Log) Traverse(rootEntries *entry.OrderedMap, amount int, endHash string
 	// Process stack until it's empty (traversed the full log)
 	// or when we have the requested amount of entries
 	// If requested entry amount is -1, traverse all
-	for len(stack) > 0 && (amount < 0 || count < amount) {
+	for stack.Len() > 0 && (amount < 0 || count < amount) {
 		// Get the next element from the stack
-		e := stack[0]
-		stack = stack[1:]
+		e := stack.pop()
+		if stack.err != nil {
+			return errors.Wrap(stack.err, "traverse failed")
+		}
 
 		// Add to the result
 		count++
-		result = append(result, e)
+		if !yield(e) {
+			return nil
+		}
 
 		// Add entry's next references to the stack
-		for _, next := range e.Next {
-			nextEntry, ok := l.Entries.Get(next.String())
+		for _, next := range e.GetNext() {
+			// If we've already processed the entry, don't look it up again
+			if _, ok := traversed[next]; ok {
+				continue
+			}
+
+			nextEntry, ok, err := l.get(next)
+			if err != nil {
+				return errors.Wrap(err, "traverse failed")
+			}
+
 			if !ok {
 				continue
 			}
 
-			stack, traversed = l.addToStack(nextEntry, stack, traversed)
+			traversed[next] = struct{}{}
+			stack.push(nextEntry)
 		}
 
 		// If it is the specified end hash, break out of the while loop
-		if e.Hash.String() == endHash {
+		if end.Defined() && e.GetHash().Equals(end) {
 			break
 		}
 	}
 
-	return result, nil
+	return nil
 }
 
-func (l *Log) Append(payload []byte, pointerCount int) (*entry.Entry, error) {
-	// INFO: JS default value for pointerCount is 1
-	// Update the clock (find the latest clock)
-	newTime := maxClockTimeForEntries(l.heads.Slice(), 0)
-	newTime = maxInt(l.Clock.Time, newTime) + 1
+// Stamper creates evidence that an appended entry existed at some time
+type Stamper interface {
+	Stamp(ctx context.Context, e iface.IPFSLogEntry) error
+}
 
-	l.Clock = lamportclock.New(l.Clock.ID, newTime)
+// AppendOptions holds the optional parameters of an append
+type AppendOptions struct {
+	PointerCount int
+	Metadata     map[string]string
+	PayloadCodec string
 
-	// Get the required amount of hashes to next entries (as per current state of the log)
-	references, err := l.Traverse(l.heads, maxInt(pointerCount, l.heads.Len()), "")
+	// CoSigners add their signature to the entry, as required by
+	// accesscontroller.Threshold
+	CoSigners []identityprovider.Signer
+
+	// Pin pins the entry block and its payload so garbage collection
+	// doesn't remove them, entries are always pinned when the log pins
+	Pin bool
+}
+
+func (l *Log) Append(payload []byte, pointerCount int) (iface.IPFSLogEntry, error) {
+	return l.AppendWithOptions(payload, &AppendOptions{PointerCount: pointerCount})
+}
+
+// AppendValue encodes a value using the log's codec and appends it
+func (l *Log) AppendValue(v interface{}) (iface.IPFSLogEntry, error) {
+	payload, err := l.codec.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode value")
+	}
+
+	return l.AppendWithOptions(payload, &AppendOptions{
+		PointerCount: 1,
+		PayloadCodec: l.codec.Name(),
+	})
+}
+
+// AppendWithOptions appends a payload to the log using the given options
+func (l *Log) AppendWithOptions(payload []byte, options *AppendOptions) (iface.IPFSLogEntry, error) {
+	entries, err := l.AppendBatch([][]byte{payload}, options)
 	if err != nil {
+		return nil, err
+	}
+
+	return entries[0], nil
+}
+
+// AppendBatch appends the payloads in order using the same options, each
+// entry pointing to the previous one. The blocks of the entries are written
+// to IPFS together and the entries are only added to the log once all of
+// them are written.
+func (l *Log) AppendBatch(payloads [][]byte, options *AppendOptions) ([]iface.IPFSLogEntry, error) {
+	if options == nil {
+		options = &AppendOptions{PointerCount: 1}
+	}
+
+	batch := io.NewBatch(context.Background(), l.Storage)
+
+	heads := l.heads.Slice()
+	clock := l.Clock
+	added := []iface.IPFSLogEntry{}
+
+	for _, payload := range payloads {
+		// INFO: JS default value for pointerCount is 1
+		// Update the clock (find the latest clock)
+		newTime := maxClockTimeForEntries(heads, 0)
+		clock = lamportclock.New(clock.ID, maxInt(clock.Time, newTime)+1)
+
+		references, err := l.references(added, maxInt(options.PointerCount, len(heads)))
+		if err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		e, err := l.createEntry(batch.Services(), payload, options, heads, references, clock)
+		if err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		if err := l.AccessController.CanAppend(context.Background(), e, l.Identity.Provider, l); err != nil {
+			return nil, errors.Wrap(accessDenied(err), "append failed")
+		}
+
+		added = append(added, e)
+		heads = []iface.IPFSLogEntry{e}
+	}
+
+	var record datastore.Key
+	if l.wal != nil && len(added) > 0 {
+		var err error
+		if record, err = l.wal.write(l.ID, added, batch.Blocks()); err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+	}
+
+	pin := options.Pin || l.pin
+	write := func() error {
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+
+		for _, e := range added {
+			if pin {
+				if err := l.pinEntry(e); err != nil {
+					return err
+				}
+			}
+
+			if l.stamper != nil {
+				if err := l.stamper.Stamp(context.Background(), e); err != nil {
+					return err
+				}
+			}
+		}
+
+		if l.wal != nil && len(added) > 0 {
+			return l.wal.Datastore.Delete(record)
+		}
+
+		return nil
+	}
+
+	if l.wal != nil && l.wal.Async && l.stamper == nil {
+		l.writes.Add(1)
+		go func() {
+			defer l.writes.Done()
+
+			if err := write(); err != nil {
+				l.writeFailed(errors.Wrap(err, "unable to write appended entries"))
+			}
+		}()
+	} else if err := write(); err != nil {
+		if l.wal != nil && len(added) > 0 {
+			_ = l.wal.Datastore.Delete(record)
+		}
+
 		return nil, errors.Wrap(err, "append failed")
 	}
 
-	next := []cid.Cid{}
+	parents := l.heads.Slice()
+	for _, e := range added {
+		if err := l.put(e); err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		for _, h := range parents {
+			l.Next.SetCID(h.GetHash(), e)
+		}
+		parents = []iface.IPFSLogEntry{e}
+	}
+
+	if len(added) > 0 {
+		l.Clock = clock
+		l.heads = entry.NewOrderedMapFromEntries(heads)
+
+		if err := l.saveHeads(); err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		if err := l.updateIndexes(added); err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		if err := l.runHooks(added); err != nil {
+			return nil, errors.Wrap(err, "append failed")
+		}
+
+		l.notify()
+	}
+
+	return added, nil
+}
+
+// references returns the amount latest entries of the log once the pending
+// entries, which aren't in the log yet, are appended
+func (l *Log) references(pending []iface.IPFSLogEntry, amount int) ([]iface.IPFSLogEntry, error) {
+	references := []iface.IPFSLogEntry{}
+	for i := len(pending) - 1; i >= 0 && len(references) < amount; i-- {
+		references = append(references, pending[i])
+	}
 
-	keys := l.heads.Keys()
-	for _, k := range keys {
-		e, _ := l.heads.Get(k)
-		next = append(next, e.Hash)
+	if len(references) == amount {
+		return references, nil
+	}
+
+	// Get the required amount of hashes to next entries (as per current state of the log)
+	traversed, err := l.Traverse(l.heads, amount-len(references), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(references, traversed...), nil
+}
+
+// createEntry creates and stores an entry pointing to the heads and the
+// references
+func (l *Log) createEntry(services io.IpfsServices, payload []byte, options *AppendOptions, heads []iface.IPFSLogEntry, references []iface.IPFSLogEntry, clock *lamportclock.LamportClock) (*entry.Entry, error) {
+	next := []cid.Cid{}
+	for _, e := range heads {
+		next = append(next, e.GetHash())
 	}
 	for _, e := range references {
-		next = append(next, e.Hash)
+		next = append(next, e.GetHash())
 	}
 
 	// TODO: ensure port of ```Object.keys(Object.assign({}, this._headsIndex, references))``` is correctly implemented
 
 	// @TODO: Split Entry.create into creating object, checking permission, signing and then posting to IPFS
 	// Create the entry and add it to the internal cache
-	e, err := entry.CreateEntry(l.Storage, l.Identity, &entry.Entry{
-		LogID:   l.ID,
-		Payload: payload,
-		Next:    next,
-	}, l.Clock)
-	if err != nil {
-		return nil, errors.Wrap(err, "append failed")
+	data := &entry.Entry{
+		LogID:        l.ID,
+		Payload:      payload,
+		Next:         next,
+		Metadata:     options.Metadata,
+		PayloadCodec: options.PayloadCodec,
+		ClockType:    l.clockType,
+	}
+
+	if l.clockType == vectorclock.Type {
+		data.VectorClock = vectorclock.New()
+		for _, h := range heads {
+			data.VectorClock.Merge(h.GetVectorClock())
+		}
+		data.VectorClock.Tick(l.Identity.PublicKey)
 	}
 
-	if err := l.AccessController.CanAppend(e, l.Identity); err != nil {
-		return nil, errors.Wrap(err, "append failed")
+	if l.clockType == hlc.Type {
+		for _, h := range heads {
+			l.hlc.Update(h.GetHLC())
+		}
+		data.HLC = l.hlc.Now()
 	}
 
-	l.Entries.Set(e.Hash.String(), e)
-
-	for _, k := range keys {
-		nextEntry, _ := l.heads.Get(k)
-		l.Next.Set(nextEntry.Hash.String(), e)
+	if l.timestamps {
+		data.Timestamp = l.now().UnixNano() / int64(time.Millisecond)
 	}
 
-	l.heads = entry.NewOrderedMap()
-	l.heads.Set(e.Hash.String(), e)
-
-	return e, nil
+	return entry.CreateEntryWithOptions(services, l.Identity, data, clock, &entry.CreateEntryOptions{
+		PayloadThreshold: l.payloadThreshold,
+		Compression:      l.compression,
+		Encryption:       l.encryption,
+		Encoding:         l.encoding,
+		CIDPrefix:        l.prefix,
+		CoSigners:        options.CoSigners,
+	})
 }
 
 type IteratorOptions struct {
-	GT     *entry.Entry
-	GTE    *entry.Entry
-	LT     *entry.Entry
-	LTE    *entry.Entry
+	GT     iface.IPFSLogEntry
+	GTE    iface.IPFSLogEntry
+	LT     iface.IPFSLogEntry
+	LTE    iface.IPFSLogEntry
 	Amount *int
+
+	// Since and Until only return entries whose timestamp is in the
+	// [Since, Until) range, entries without timestamp are skipped when
+	// either is set
+	Since time.Time
+	Until time.Time
+
+	// Author only returns the entries of an author, see EntriesBy
+	Author string
+}
+
+// filtered returns true if the options skip some of the entries between
+// the bounds
+func (o *IteratorOptions) filtered() bool {
+	return !o.Since.IsZero() || !o.Until.IsZero() || o.Author != ""
+}
+
+func (o *IteratorOptions) matches(e iface.IPFSLogEntry) bool {
+	if o.Author != "" && Author(e) != o.Author {
+		return false
+	}
+
+	return o.inTimeRange(e)
+}
+
+func (o *IteratorOptions) inTimeRange(e iface.IPFSLogEntry) bool {
+	if o.Since.IsZero() && o.Until.IsZero() {
+		return true
+	}
+
+	t := e.GetTimestamp()
+	if t.IsZero() {
+		return false
+	}
+
+	if !o.Since.IsZero() && t.Before(o.Since) {
+		return false
+	}
+
+	if !o.Until.IsZero() && !t.Before(o.Until) {
+		return false
+	}
+
+	return true
 }
 
-func (l *Log) iterator(options IteratorOptions, output chan<- *entry.Entry) error {
+// Iterator sends the entries matching the options to output, starting from
+// the heads
+func (l *Log) Iterator(options IteratorOptions, output chan<- iface.IPFSLogEntry) error {
 	amount := -1
 	if options.Amount != nil {
 		if *options.Amount == 0 {
@@ -274,35 +1107,67 @@ func (l *Log) iterator(options IteratorOptions, output chan<- *entry.Entry) erro
 
 	start := l.heads.Slice()
 	if options.LTE != nil {
-		start = []*entry.Entry{options.LTE}
+		start = []iface.IPFSLogEntry{options.LTE}
 	} else if options.LT != nil {
-		start = []*entry.Entry{options.LT}
+		start = []iface.IPFSLogEntry{options.LT}
 	}
 
 	endHash := ""
 	if options.GTE != nil {
-		endHash = options.GTE.Hash.String()
+		endHash = options.GTE.GetHash().String()
 	} else if options.GT != nil {
-		endHash = options.GT.Hash.String()
+		endHash = options.GT.GetHash().String()
 	}
 
+	filtered := options.filtered()
+
 	count := -1
-	if endHash == "" && options.Amount != nil {
+	if endHash == "" && options.Amount != nil && !filtered {
 		count = amount
 	}
 
-	entries, err := l.Traverse(entry.NewOrderedMapFromEntries(start), count, endHash)
-	if err != nil {
-		return errors.Wrap(err, "iterator failed")
+	var entries []iface.IPFSLogEntry
+	if options.Author != "" && endHash == "" && options.LT == nil && options.LTE == nil {
+		// The author index holds the entries of the author without
+		// traversing the others
+		byAuthor, err := l.EntriesBy(options.Author)
+		if err != nil {
+			return errors.Wrap(err, "iterator failed")
+		}
+
+		sorting.Reverse(byAuthor)
+		entries = byAuthor
+	} else {
+		traversed, err := l.Traverse(entry.NewOrderedMapFromEntries(start), count, endHash)
+		if err != nil {
+			return errors.Wrap(err, "iterator failed")
+		}
+
+		entries = traversed
 	}
 
 	if options.GT != nil {
 		entries = entries[:len(entries)-1]
 	}
 
-	// Deal with the amount argument working backwards from gt/gte
-	if (options.GT != nil || options.GTE != nil) && amount > -1 {
-		entries = entries[len(entries)-amount:]
+	if filtered {
+		matching := []iface.IPFSLogEntry{}
+		for _, e := range entries {
+			if options.matches(e) {
+				matching = append(matching, e)
+			}
+		}
+
+		entries = matching
+	}
+
+	if amount > -1 && len(entries) > amount {
+		if endHash != "" {
+			// Deal with the amount argument working backwards from gt/gte
+			entries = entries[len(entries)-amount:]
+		} else {
+			entries = entries[:amount]
+		}
 	}
 
 	for i := range entries {
@@ -312,7 +1177,32 @@ func (l *Log) iterator(options IteratorOptions, output chan<- *entry.Entry) erro
 	return nil
 }
 
+// joinState is the state of a log joined with another one, the entries of
+// the other log are found too
+type joinState struct {
+	*Log
+	other *Log
+}
+
+func (s *joinState) GetEntry(hash cid.Cid) (iface.IPFSLogEntry, bool) {
+	if e, ok := s.other.Entries.GetCID(hash); ok {
+		return e, true
+	}
+
+	if e, ok := s.Log.GetEntry(hash); ok {
+		return e, true
+	}
+
+	return s.other.GetEntry(hash)
+}
+
 func (l *Log) Join(otherLog *Log, size int) (*Log, error) {
+	return l.join(otherLog, size, false)
+}
+
+// join merges the other log, the signatures of its entries are not checked
+// again when verified is set
+func (l *Log) join(otherLog *Log, size int, verified bool) (*Log, error) {
 	// INFO: JS default size is -1
 	if otherLog == nil {
 		return nil, errmsg.LogJoinNotDefined
@@ -322,109 +1212,312 @@ func (l *Log) Join(otherLog *Log, size int) (*Log, error) {
 		return l, nil
 	}
 
-	newItems := Difference(otherLog, l)
-
-	for _, k := range newItems.Keys() {
-		e := newItems.UnsafeGet(k)
-		if err := l.AccessController.CanAppend(e, l.Identity); err != nil {
+	// Entries are verified while the difference is being computed
+	pool := newVerifyPool(context.Background(), l.Identity.Provider, l.verifyConcurrency)
+	state := &joinState{Log: l, other: otherLog}
+	newItems := entry.NewOrderedMap()
+	for e := range StreamDifference(pool.Context(), otherLog, l) {
+		if err := l.AccessController.CanAppend(pool.Context(), e, l.Identity.Provider, state); err != nil {
+			_ = pool.Wait()
+			return nil, errors.Wrap(accessDenied(err), "join failed")
+		}
+
+		if !verified {
+			pool.Verify(e)
+		}
+		newItems.Put(e)
+	}
+
+	if err := pool.Wait(); err != nil {
+		return nil, errors.Wrap(err, "unable to check signature")
+	}
+
+	// The history of a lazy log isn't indexed, the entries it already has
+	// are found by walking it
+	var history *cid.Set
+	if l.IsLazy() && newItems.Len() > 0 {
+		var err error
+		if history, err = l.lazyHistory(minClockTimeForEntries(newItems.Slice())); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
+
+		for _, e := range newItems.Slice() {
+			if history.Has(e.GetHash()) {
+				newItems.DeleteCID(e.GetHash())
+			}
+		}
+	}
+
+	if l.strictClocks {
+		if err := entry.CheckClocks(newItems.Slice(), l.Entries.Merge(otherLog.Entries)); err != nil {
 			return nil, errors.Wrap(err, "join failed")
 		}
+	}
 
-		if err := entry.Verify(l.Identity.Provider, e); err != nil {
-			return nil, errors.Wrap(err, "unable to check signature")
+	for _, e := range newItems.Slice() {
+		for _, next := range e.GetNext() {
+			l.Next.SetCID(next, e)
 		}
-	}
 
-	for _, k := range newItems.Keys() {
-		e := newItems.UnsafeGet(k)
-		for _, next := range e.Next {
-			l.Next.Set(next.String(), e)
+		if err := l.decrypt(e); err != nil {
+			return nil, errors.Wrap(err, "join failed")
 		}
 
-		l.Entries.Set(e.Hash.String(), e)
+		if err := l.put(e); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
 	}
 
-	nextsFromNewItems := orderedmap.New()
-	for _, k := range newItems.Keys() {
-		e := newItems.UnsafeGet(k)
-		for _, n := range e.Next {
-			nextsFromNewItems.Set(n.String(), true)
+	nextsFromNewItems := cid.NewSet()
+	for _, e := range newItems.Slice() {
+		for _, n := range e.GetNext() {
+			nextsFromNewItems.Add(n)
 		}
 	}
 
 	mergedHeads := FindHeads(l.heads.Merge(otherLog.heads))
 	for idx, e := range mergedHeads {
+		// notDenied, the heads already held are kept
+		if !l.heads.HasCID(e.GetHash()) && entry.IsDenied(l.denylist, e) {
+			mergedHeads[idx] = nil
+			continue
+		}
+
 		// notReferencedByNewItems
-		if _, ok := nextsFromNewItems.Get(e.Hash.String()); ok {
+		if nextsFromNewItems.Has(e.GetHash()) {
 			mergedHeads[idx] = nil
 		}
 
 		// notInCurrentNexts
-		if _, ok := l.Next.Get(e.Hash.String()); ok {
+		if l.Next.HasCID(e.GetHash()) {
+			mergedHeads[idx] = nil
+		}
+
+		// notInLazyHistory
+		if history != nil && !l.heads.HasCID(e.GetHash()) && history.Has(e.GetHash()) {
 			mergedHeads[idx] = nil
 		}
 	}
 
 	l.heads = entry.NewOrderedMapFromEntries(mergedHeads)
 
+	var truncated []iface.IPFSLogEntry
 	if size > -1 {
-		tmp := l.Values().Slice()
-		tmp = tmp[len(tmp)-size:]
-		l.Entries = entry.NewOrderedMapFromEntries(tmp)
-		l.heads = entry.NewOrderedMapFromEntries(FindHeads(entry.NewOrderedMapFromEntries(tmp)))
+		truncated = l.truncate(size)
+		if err := l.release(truncated); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
 	}
 
 	// Find the latest clock from the heads
 	maxClock := maxClockTimeForEntries(l.heads.Slice(), 0)
 	l.Clock = lamportclock.New(l.Clock.ID, maxInt(l.Clock.Time, maxClock))
 
+	if newItems.Len() > 0 || size > -1 {
+		if err := l.saveHeads(); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
+	}
+
+	added := newItems.Slice()
+	entry.Sort(l.SortFn, added)
+
+	if len(truncated) > 0 {
+		if err := l.RebuildIndexes(); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
+
+		// Only the joined entries which weren't truncated are accepted
+		kept := []iface.IPFSLogEntry{}
+		for _, e := range added {
+			if l.has(e.GetHash()) {
+				kept = append(kept, e)
+			}
+		}
+
+		added = kept
+	} else if len(added) > 0 {
+		if err := l.updateIndexes(added); err != nil {
+			return nil, errors.Wrap(err, "join failed")
+		}
+	}
+
+	if err := l.runHooks(added); err != nil {
+		return nil, errors.Wrap(err, "join failed")
+	}
+
+	if newItems.Len() > 0 {
+		l.notify()
+	}
+
 	return l, nil
 }
 
+// lazyHistory returns the hashes of the entries reachable from the heads of
+// a lazy log whose clock time isn't lower than minTime, fetching them when
+// needed
+func (l *Log) lazyHistory(minTime int) (*cid.Set, error) {
+	history := cid.NewSet()
+	stack := l.heads.Slice()
+
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !history.Visit(e.GetHash()) {
+			continue
+		}
+
+		for _, n := range e.GetNext() {
+			if history.Has(n) {
+				continue
+			}
+
+			next, ok, err := l.get(n)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok && next.GetClock().Time >= minTime {
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	return history, nil
+}
+
+type listener struct {
+	fn func(*Log)
+}
+
+// OnUpdate registers a function called after entries are appended to or
+// joined into the log, in the goroutine modifying it. The returned function
+// unregisters it.
+func (l *Log) OnUpdate(fn func(*Log)) func() {
+	ln := &listener{fn: fn}
+
+	l.listenersLock.Lock()
+	l.listeners = append(l.listeners, ln)
+	l.listenersLock.Unlock()
+
+	return func() {
+		l.listenersLock.Lock()
+		defer l.listenersLock.Unlock()
+
+		for i, other := range l.listeners {
+			if other == ln {
+				l.listeners = append(l.listeners[:i:i], l.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (l *Log) notify() {
+	l.listenersLock.Lock()
+	listeners := l.listeners
+	l.listenersLock.Unlock()
+
+	for _, ln := range listeners {
+		ln.fn(l)
+	}
+}
+
+// Difference returns the entries of logA that are missing from logB
 func Difference(logA, logB *Log) *entry.OrderedMap {
-	if logA == nil || logA.Entries == nil || logA.Entries.Len() == 0 || logB == nil {
-		return entry.NewOrderedMap()
+	res := entry.NewOrderedMap()
+
+	difference(logA, logB, func(e iface.IPFSLogEntry) bool {
+		res.Put(e)
+		return true
+	})
+
+	return res
+}
+
+// StreamDifference sends the entries of logA that are missing from logB as
+// they are discovered, the channel is closed once the whole difference has
+// been sent or ctx is done
+func StreamDifference(ctx context.Context, logA, logB *Log) <-chan iface.IPFSLogEntry {
+	out := make(chan iface.IPFSLogEntry)
+
+	if logB != nil && logB.Entries == nil {
+		logB.Entries = entry.NewOrderedMap()
+	}
+
+	go func() {
+		defer close(out)
+
+		difference(logA, logB, func(e iface.IPFSLogEntry) bool {
+			select {
+			case out <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return out
+}
+
+// difference walks logA from its heads and calls yield for each entry
+// missing from logB until yield returns false
+func difference(logA, logB *Log, yield func(iface.IPFSLogEntry) bool) {
+	if logA == nil || logA.Entries == nil || logA.heads.Len() == 0 || logB == nil {
+		return
 	}
 
 	if logB.Entries == nil {
 		logB.Entries = entry.NewOrderedMap()
 	}
 
-	stack := logA.heads.Keys()
-	traversed := map[string]bool{}
-	res := entry.NewOrderedMap()
+	stack := entrySliceToCids(logA.heads.Slice())
+	traversed := cid.NewSet()
+	for _, h := range stack {
+		traversed.Add(h)
+	}
 
-	for {
-		if len(stack) == 0 {
-			break
-		}
+	for len(stack) > 0 {
 		hash := stack[0]
 		stack = stack[1:]
 
-		eA, okA := logA.Entries.Get(hash)
-		_, okB := logB.Entries.Get(hash)
-
-		if okA && !okB && eA.LogID == logB.ID {
-			res.Set(hash, eA)
-			traversed[hash] = true
-			for _, h := range eA.Next {
-				hash := h.String()
-				_, okB := logB.Entries.Get(hash)
-				_, okT := traversed[hash]
-				if !okT && !okB {
-					stack = append(stack, hash)
-					traversed[hash] = true
-				}
+		// Entries known to logB are never fetched
+		if logB.has(hash) {
+			continue
+		}
+
+		eA, okA, err := logA.get(hash)
+		if err != nil {
+			continue
+		}
+
+		if !okA || eA.GetLogID() != logB.ID {
+			continue
+		}
+
+		// The parents of denied entries are only reached through other
+		// entries
+		if entry.IsDenied(logB.denylist, eA) {
+			continue
+		}
+
+		if !yield(eA) {
+			return
+		}
+
+		for _, h := range eA.GetNext() {
+			if traversed.Visit(h) && !logB.has(h) {
+				stack = append(stack, h)
 			}
 		}
 	}
-
-	return res
 }
 
-func (l *Log) ToString(payloadMapper func(*entry.Entry) string) string {
+func (l *Log) ToString(payloadMapper func(iface.IPFSLogEntry) string) string {
 	values := l.Values().Slice()
-	Reverse(values)
+	sorting.Reverse(values)
 
 	lines := []string{}
 
@@ -440,7 +1533,7 @@ func (l *Log) ToString(payloadMapper func(*entry.Entry) string) string {
 		if payloadMapper != nil {
 			payload = payloadMapper(e)
 		} else {
-			payload = string(e.Payload)
+			payload = string(e.GetPayload())
 		}
 
 		lines = append(lines, padding+payload)
@@ -454,14 +1547,15 @@ func (l *Log) ToSnapshot() *Snapshot {
 		ID:     l.ID,
 		Heads:  entrySliceToCids(l.heads.Slice()),
 		Values: l.Values().Slice(),
+		Clock:  l.Clock.Clone(),
 	}
 }
 
-func entrySliceToCids(slice []*entry.Entry) []cid.Cid {
+func entrySliceToCids(slice []iface.IPFSLogEntry) []cid.Cid {
 	cids := []cid.Cid{}
 
 	for _, e := range slice {
-		cids = append(cids, e.Hash)
+		cids = append(cids, e.GetHash())
 	}
 
 	return cids
@@ -475,7 +1569,21 @@ func (l *Log) ToMultihash() (cid.Cid, error) {
 	return ToMultihash(l.Storage, l)
 }
 
-func NewFromMultihash(services *io.IpfsServices, identity *identityprovider.Identity, hash cid.Cid, logOptions *NewLogOptions, fetchOptions *FetchOptions) (*Log, error) {
+// reopenOptions returns the options of a log opened from its entries or its
+// manifest: the options of the caller with the state read from the log
+func reopenOptions(logOptions *NewLogOptions, id string, ac accesscontroller.Interface, entries *entry.OrderedMap, heads []iface.IPFSLogEntry, clock *lamportclock.LamportClock) *NewLogOptions {
+	options := *logOptions
+	options.ID = id
+	options.AccessController = ac
+	options.Entries = entries
+	options.OwnEntries = true
+	options.Heads = heads
+	options.Clock = clock
+
+	return &options
+}
+
+func NewFromMultihash(services io.IpfsServices, identity *identityprovider.Identity, hash cid.Cid, logOptions *NewLogOptions, fetchOptions *FetchOptions) (*Log, error) {
 	if services == nil {
 		return nil, errmsg.IPFSNotDefined
 	}
@@ -492,37 +1600,86 @@ func NewFromMultihash(services *io.IpfsServices, identity *identityprovider.Iden
 		return nil, errmsg.FetchOptionsNotDefined
 	}
 
+	logData, err := ReadJSONLog(fetchServices(services, fetchOptions.Offline), hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfrommultihash failed")
+	}
+
+	// The manifest configures the log like its writer did
+	logOptions, err = logManifest(fetchServices(services, fetchOptions.Offline), logData, logOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfrommultihash failed")
+	}
+
+	ac, err := manifestAccessController(fetchServices(services, fetchOptions.Offline), logData, logOptions.AccessController)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfrommultihash failed")
+	}
+
+	if logOptions.Lazy {
+		heads, err := fetchHeads(fetchServices(services, fetchOptions.Offline), logData.Heads, identity.Provider)
+		if err != nil {
+			return nil, errors.Wrap(err, "newfrommultihash failed")
+		}
+
+		// Only the heads are loaded, the other entries are validated
+		// when fetched
+		if logOptions.StrictValidation {
+			if err := validateEntries(heads, logData.ID, identity.Provider, logOptions.Revocations); err != nil {
+				return nil, errors.Wrap(err, "newfrommultihash failed")
+			}
+		}
+
+		return NewLog(services, identity, reopenOptions(logOptions, logData.ID, ac, entry.NewOrderedMapFromEntries(heads), heads, nil))
+	}
+
 	data, err := FromMultihash(services, hash, &FetchOptions{
 		Length:       fetchOptions.Length,
 		Exclude:      fetchOptions.Exclude,
 		ProgressChan: fetchOptions.ProgressChan,
+		EntryLimiter: fetchOptions.EntryLimiter,
+		ByteLimiter:  fetchOptions.ByteLimiter,
+		Denylist:     logOptions.Denylist,
+		Offline:      fetchOptions.Offline,
+		Checkpoints:  fetchOptions.Checkpoints,
 	})
 
 	if err != nil {
 		return nil, errors.Wrap(err, "newfrommultihash failed")
 	}
 
-	heads := []*entry.Entry{}
+	if logOptions.StrictClocks {
+		if err := entry.CheckClocks(data.Values, nil); err != nil {
+			return nil, errors.Wrap(err, "newfrommultihash failed")
+		}
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(data.Values, data.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfrommultihash failed")
+		}
+	}
+
+	if fetchOptions.Checkpoints {
+		if err := verifyCheckpoints(services, data.Values); err != nil {
+			return nil, errors.Wrap(err, "newfrommultihash failed")
+		}
+	}
+
+	heads := []iface.IPFSLogEntry{}
 	for _, e := range data.Values {
 		for _, h := range data.Heads {
-			if e.Hash.String() == h.String() {
+			if e.GetHash().Equals(h) {
 				heads = append(heads, e)
 				break
 			}
 		}
 	}
 
-	return NewLog(services, identity, &NewLogOptions{
-		ID:               data.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(data.Values),
-		Heads:            heads,
-		Clock:            lamportclock.New(data.Clock.ID, data.Clock.Time),
-		SortFn:           logOptions.SortFn,
-	})
+	return NewLog(services, identity, reopenOptions(logOptions, data.ID, ac, entry.NewOrderedMapFromEntries(data.Values), heads, data.Clock))
 }
 
-func NewFromEntryHash(services *io.IpfsServices, identity *identityprovider.Identity, hash cid.Cid, logOptions *NewLogOptions, fetchOptions *FetchOptions) (*Log, error) {
+func NewFromEntryHash(services io.IpfsServices, identity *identityprovider.Identity, hash cid.Cid, logOptions *NewLogOptions, fetchOptions *FetchOptions) (*Log, error) {
 	if logOptions == nil {
 		return nil, errmsg.LogOptionsNotDefined
 	}
@@ -531,25 +1688,59 @@ func NewFromEntryHash(services *io.IpfsServices, identity *identityprovider.Iden
 		return nil, errmsg.FetchOptionsNotDefined
 	}
 
-	// TODO: need to verify the entries with 'key'
+	if logOptions.Lazy {
+		heads, err := fetchHeads(fetchServices(services, fetchOptions.Offline), []cid.Cid{hash}, identity.Provider)
+		if err != nil {
+			return nil, errors.Wrap(err, "newfromentryhash failed")
+		}
+
+		// Only the heads are loaded, the other entries are validated
+		// when fetched
+		if logOptions.StrictValidation {
+			if err := validateEntries(heads, logOptions.ID, identity.Provider, logOptions.Revocations); err != nil {
+				return nil, errors.Wrap(err, "newfromentryhash failed")
+			}
+		}
+
+		return NewLog(services, identity, reopenOptions(logOptions, logOptions.ID, logOptions.AccessController, entry.NewOrderedMapFromEntries(heads), nil, nil))
+	}
+
 	entries, err := FromEntryHash(services, []cid.Cid{hash}, &FetchOptions{
 		Length:       fetchOptions.Length,
 		Exclude:      fetchOptions.Exclude,
 		ProgressChan: fetchOptions.ProgressChan,
+		EntryLimiter: fetchOptions.EntryLimiter,
+		ByteLimiter:  fetchOptions.ByteLimiter,
+		Denylist:     logOptions.Denylist,
+		Offline:      fetchOptions.Offline,
+		Checkpoints:  fetchOptions.Checkpoints,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "newfromentryhash failed")
 	}
 
-	return NewLog(services, identity, &NewLogOptions{
-		ID:               logOptions.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(entries),
-		SortFn:           logOptions.SortFn,
-	})
+	if logOptions.StrictClocks {
+		if err := entry.CheckClocks(entries, nil); err != nil {
+			return nil, errors.Wrap(err, "newfromentryhash failed")
+		}
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(entries, logOptions.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfromentryhash failed")
+		}
+	}
+
+	if fetchOptions.Checkpoints {
+		if err := verifyCheckpoints(services, entries); err != nil {
+			return nil, errors.Wrap(err, "newfromentryhash failed")
+		}
+	}
+
+	return NewLog(services, identity, reopenOptions(logOptions, logOptions.ID, logOptions.AccessController, entry.NewOrderedMapFromEntries(entries), nil, nil))
 }
 
-func NewFromJSON(services *io.IpfsServices, identity *identityprovider.Identity, jsonLog *JSONLog, logOptions *NewLogOptions, fetchOptions *entry.FetchOptions) (*Log, error) {
+func NewFromJSON(services io.IpfsServices, identity *identityprovider.Identity, jsonLog *JSONLog, logOptions *NewLogOptions, fetchOptions *entry.FetchOptions) (*Log, error) {
 	if logOptions == nil {
 		return nil, errmsg.LogOptionsNotDefined
 	}
@@ -558,26 +1749,57 @@ func NewFromJSON(services *io.IpfsServices, identity *identityprovider.Identity,
 		return nil, errmsg.FetchOptionsNotDefined
 	}
 
-	// TODO: need to verify the entries with 'key'
+	ac, err := manifestAccessController(fetchServices(services, fetchOptions.Offline), jsonLog, logOptions.AccessController)
+	if err != nil {
+		return nil, errors.Wrap(err, "newfromjson failed")
+	}
+
+	if logOptions.Lazy {
+		heads, err := fetchHeads(fetchServices(services, fetchOptions.Offline), jsonLog.Heads, identity.Provider)
+		if err != nil {
+			return nil, errors.Wrap(err, "newfromjson failed")
+		}
+
+		// Only the heads are loaded, the other entries are validated
+		// when fetched
+		if logOptions.StrictValidation {
+			if err := validateEntries(heads, jsonLog.ID, identity.Provider, logOptions.Revocations); err != nil {
+				return nil, errors.Wrap(err, "newfromjson failed")
+			}
+		}
+
+		return NewLog(services, identity, reopenOptions(logOptions, jsonLog.ID, ac, entry.NewOrderedMapFromEntries(heads), heads, nil))
+	}
 
 	snapshot, err := FromJSON(services, jsonLog, &entry.FetchOptions{
 		Length:       fetchOptions.Length,
 		Timeout:      fetchOptions.Timeout,
 		ProgressChan: fetchOptions.ProgressChan,
+		EntryLimiter: fetchOptions.EntryLimiter,
+		ByteLimiter:  fetchOptions.ByteLimiter,
+		Denylist:     logOptions.Denylist,
+		Offline:      fetchOptions.Offline,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "newfromjson failed")
 	}
 
-	return NewLog(services, identity, &NewLogOptions{
-		ID:               snapshot.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(snapshot.Values),
-		SortFn:           logOptions.SortFn,
-	})
+	if logOptions.StrictClocks {
+		if err := entry.CheckClocks(snapshot.Values, nil); err != nil {
+			return nil, errors.Wrap(err, "newfromjson failed")
+		}
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(snapshot.Values, snapshot.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfromjson failed")
+		}
+	}
+
+	return NewLog(services, identity, reopenOptions(logOptions, snapshot.ID, ac, entry.NewOrderedMapFromEntries(snapshot.Values), nil, snapshot.Clock))
 }
 
-func NewFromEntry(services *io.IpfsServices, identity *identityprovider.Identity, sourceEntries []*entry.Entry, logOptions *NewLogOptions, fetchOptions *entry.FetchOptions) (*Log, error) {
+func NewFromEntry(services io.IpfsServices, identity *identityprovider.Identity, sourceEntries []iface.IPFSLogEntry, logOptions *NewLogOptions, fetchOptions *entry.FetchOptions) (*Log, error) {
 	if logOptions == nil {
 		return nil, errmsg.LogOptionsNotDefined
 	}
@@ -586,56 +1808,119 @@ func NewFromEntry(services *io.IpfsServices, identity *identityprovider.Identity
 		return nil, errmsg.FetchOptionsNotDefined
 	}
 
-	// TODO: need to verify the entries with 'key'
 	snapshot, err := FromEntry(services, sourceEntries, &entry.FetchOptions{
 		Length:       fetchOptions.Length,
 		Exclude:      fetchOptions.Exclude,
 		ProgressChan: fetchOptions.ProgressChan,
+		EntryLimiter: fetchOptions.EntryLimiter,
+		ByteLimiter:  fetchOptions.ByteLimiter,
+		Denylist:     logOptions.Denylist,
+		Offline:      fetchOptions.Offline,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "newfromentry failed")
 	}
 
-	return NewLog(services, identity, &NewLogOptions{
-		ID:               snapshot.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(snapshot.Values),
-		SortFn:           logOptions.SortFn,
-	})
+	if logOptions.StrictClocks {
+		if err := entry.CheckClocks(snapshot.Values, nil); err != nil {
+			return nil, errors.Wrap(err, "newfromentry failed")
+		}
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(snapshot.Values, snapshot.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfromentry failed")
+		}
+	}
+
+	return NewLog(services, identity, reopenOptions(logOptions, snapshot.ID, logOptions.AccessController, entry.NewOrderedMapFromEntries(snapshot.Values), nil, snapshot.Clock))
+}
+
+// NewFromSnapshot creates a log from a snapshot, restoring its clock
+func NewFromSnapshot(services io.IpfsServices, identity *identityprovider.Identity, snapshot *Snapshot, logOptions *NewLogOptions) (*Log, error) {
+	if identity == nil {
+		return nil, errmsg.IdentityNotDefined
+	}
+
+	if logOptions == nil {
+		return nil, errmsg.LogOptionsNotDefined
+	}
+
+	if snapshot == nil {
+		return nil, errmsg.EntriesNotDefined
+	}
+
+	entries := entry.NewOrderedMapFromEntries(snapshot.Values)
+	report := &RepairReport{}
+
+	heads := []iface.IPFSLogEntry{}
+	for _, h := range snapshot.Heads {
+		if e, ok := entries.GetCID(h); ok {
+			heads = append(heads, e)
+			continue
+		}
+
+		if logOptions.Repair == nil || services == nil {
+			continue
+		}
+
+		e, err := fetchEntry(services, h, identity.Provider)
+		if err != nil {
+			report.Dropped = append(report.Dropped, h)
+			continue
+		}
+
+		entries.Put(e)
+		heads = append(heads, e)
+		report.Refetched = append(report.Refetched, h)
+	}
+
+	if logOptions.StrictValidation {
+		if err := validateEntries(snapshot.Values, snapshot.ID, identity.Provider, logOptions.Revocations); err != nil {
+			return nil, errors.Wrap(err, "newfromsnapshot failed")
+		}
+	}
+
+	l, err := NewLog(services, identity, reopenOptions(logOptions, snapshot.ID, logOptions.AccessController, entries, heads, snapshot.Clock))
+	if err != nil {
+		return nil, err
+	}
+
+	return repairOnOpen(l, report, logOptions)
 }
 
-func FindTails(entries []*entry.Entry) []*entry.Entry {
+func FindTails(entries []iface.IPFSLogEntry) []iface.IPFSLogEntry {
 	// Reverse index { next -> entry }
-	reverseIndex := map[string][]*entry.Entry{}
+	reverseIndex := map[cid.Cid][]iface.IPFSLogEntry{}
 	// Null index containing entries that have no parents (nexts)
-	nullIndex := []*entry.Entry{}
+	nullIndex := []iface.IPFSLogEntry{}
 	// Hashes for all entries for quick lookups
-	hashes := map[string]bool{}
+	hashes := cid.NewSet()
 	// Hashes of all next entries
 	nexts := []cid.Cid{}
 
 	for _, e := range entries {
-		if len(e.Next) == 0 {
+		if len(e.GetNext()) == 0 {
 			nullIndex = append(nullIndex, e)
 		}
 
-		for _, nextE := range e.Next {
-			reverseIndex[nextE.String()] = append(reverseIndex[nextE.String()], e)
+		for _, nextE := range e.GetNext() {
+			reverseIndex[nextE] = append(reverseIndex[nextE], e)
 		}
 
-		nexts = append(nexts, e.Next...)
+		nexts = append(nexts, e.GetNext()...)
 
-		hashes[e.Hash.String()] = true
+		hashes.Add(e.GetHash())
 	}
 
-	tails := []*entry.Entry{}
+	tails := []iface.IPFSLogEntry{}
 
 	for _, n := range nexts {
-		if _, ok := hashes[n.String()]; !ok {
+		if !hashes.Has(n) {
 			continue
 		}
 
-		tails = append(tails, reverseIndex[n.String()]...)
+		tails = append(tails, reverseIndex[n]...)
 	}
 
 	tails = append(tails, nullIndex...)
@@ -643,20 +1928,20 @@ func FindTails(entries []*entry.Entry) []*entry.Entry {
 	return entry.NewOrderedMapFromEntries(tails).Slice()
 }
 
-func FindTailHashes(entries []*entry.Entry) []string {
+func FindTailHashes(entries []iface.IPFSLogEntry) []string {
 	res := []string{}
-	hashes := map[string]bool{}
+	hashes := cid.NewSet()
 	for _, e := range entries {
-		hashes[e.Hash.String()] = true
+		hashes.Add(e.GetHash())
 	}
 
 	for _, e := range entries {
-		nextLength := len(e.Next)
+		nextLength := len(e.GetNext())
 
-		for i := range e.Next {
-			next := e.Next[nextLength-i]
-			if _, ok := hashes[next.String()]; !ok {
-				res = append([]string{e.Hash.String()}, res...)
+		for i := range e.GetNext() {
+			next := e.GetNext()[nextLength-i]
+			if !hashes.Has(next) {
+				res = append([]string{io.CIDString(e.GetHash())}, res...)
 			}
 		}
 	}
@@ -664,67 +1949,160 @@ func FindTailHashes(entries []*entry.Entry) []string {
 	return res
 }
 
-func FindHeads(entries *entry.OrderedMap) []*entry.Entry {
+// FindHeads returns the entries that aren't referenced by any other entry,
+// heads are sorted by clock ID and heads sharing an ID keep their order in
+// entries
+func FindHeads(entries *entry.OrderedMap) []iface.IPFSLogEntry {
 	if entries == nil {
 		return nil
 	}
 
-	result := []*entry.Entry{}
-	items := orderedmap.New()
+	values := entries.Slice()
+	referenced := cid.NewSet()
 
-	for _, k := range entries.Keys() {
-		e := entries.UnsafeGet(k)
-		for _, n := range e.Next {
-			items.Set(n.String(), e.Hash.String())
+	for _, e := range values {
+		for _, n := range e.GetNext() {
+			referenced.Add(n)
 		}
 	}
 
-	for _, h := range entries.Keys() {
-		e, ok := items.Get(h)
-		if ok || e != nil {
-			continue
+	result := []iface.IPFSLogEntry{}
+	for _, e := range values {
+		if !referenced.Has(e.GetHash()) {
+			result = append(result, e)
 		}
-
-		result = append(result, entries.UnsafeGet(h))
 	}
 
 	sort.SliceStable(result, func(a, b int) bool {
-		return bytes.Compare(result[a].Clock.ID, result[b].Clock.ID) < 0
+		return bytes.Compare(result[a].GetClock().ID, result[b].GetClock().ID) < 0
 	})
 
 	return result
 }
 
+// Values returns the entries of the log sorted from the oldest to the
+// newest, an empty map is returned when a lazy log fails to load an entry
+// (see ValuesE)
 func (l *Log) Values() *entry.OrderedMap {
-	if l.heads == nil {
+	values, err := l.ValuesE()
+	if err != nil {
 		return entry.NewOrderedMap()
 	}
-	stack, _ := l.Traverse(l.heads, -1, "")
-	Reverse(stack)
 
-	return entry.NewOrderedMapFromEntries(stack)
+	return values
+}
+
+// ValuesE returns the entries of the log like Values, the error of a lazy
+// log failing to load an entry is returned
+func (l *Log) ValuesE() (*entry.OrderedMap, error) {
+	if l.heads == nil {
+		return entry.NewOrderedMap(), nil
+	}
+
+	stack, err := l.Traverse(l.heads, -1, "")
+	if err != nil {
+		return nil, err
+	}
+	sorting.Reverse(stack)
+
+	return entry.NewOrderedMapFromEntries(stack), nil
+}
+
+// ValuesSeq calls yield with the entries of the log as the traversal from
+// the heads reaches them, in the reverse order of Values, until yield
+// returns false. Only the entries yielded are loaded and sorted.
+func (l *Log) ValuesSeq(yield func(iface.IPFSLogEntry) bool) error {
+	if l.heads == nil {
+		return nil
+	}
+
+	return l.traverse(l.heads, -1, "", yield)
+}
+
+// ValuesChan sends the entries of the log in the order of ValuesSeq, the
+// channel is closed once every entry has been sent, an entry can't be
+// loaded or ctx is done. The log must not be modified until it is closed.
+func (l *Log) ValuesChan(ctx context.Context) <-chan iface.IPFSLogEntry {
+	out := make(chan iface.IPFSLogEntry)
+
+	go func() {
+		defer close(out)
+
+		_ = l.ValuesSeq(func(e iface.IPFSLogEntry) bool {
+			select {
+			case out <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return out
 }
 
 func (l *Log) ToJSON() *JSONLog {
 	stack := l.heads.Slice()
 	entry.Sort(l.SortFn, stack)
-	Reverse(stack)
+	sorting.Reverse(stack)
 
 	hashes := []cid.Cid{}
+	clocks := []*lamportclock.CborLamportClock{}
 	for _, e := range stack {
-		hashes = append(hashes, e.Hash)
+		hashes = append(hashes, e.GetHash())
+		clocks = append(clocks, e.GetClock().ToCborLamportClock())
+	}
+
+	jsonLog := &JSONLog{
+		ID:     l.ID,
+		Heads:  hashes,
+		Clocks: clocks,
+	}
+
+	if ac, ok := l.accessController.(accesscontroller.Addressable); ok && ac.Address().Defined() {
+		jsonLog.AccessController = io.CIDString(ac.Address())
+	}
+
+	if l.manifest.Defined() {
+		jsonLog.Manifest = io.CIDString(l.manifest)
 	}
 
-	return &JSONLog{
-		ID:    l.ID,
-		Heads: hashes,
+	return jsonLog
+}
+
+// GetHeads returns the heads of the log
+func (l *Log) GetHeads() []iface.IPFSLogEntry {
+	return l.Heads().Slice()
+}
+
+// Has returns true if the entry with the given hash is part of the log, it
+// is never fetched
+func (l *Log) Has(hash cid.Cid) bool {
+	return l.has(hash)
+}
+
+// GetEntry returns the entry of the log with the given hash, fetching it
+// when the log is lazy, it isn't found when the fetch fails (see
+// GetEntryE)
+func (l *Log) GetEntry(hash cid.Cid) (iface.IPFSLogEntry, bool) {
+	e, ok, err := l.GetEntryE(hash)
+	if err != nil {
+		return nil, false
 	}
+
+	return e, ok
+}
+
+// GetEntryE returns the entry of the log with the given hash like
+// GetEntry, the error of a failed fetch is returned
+func (l *Log) GetEntryE(hash cid.Cid) (iface.IPFSLogEntry, bool, error) {
+	return l.get(hash)
 }
 
 func (l *Log) Heads() *entry.OrderedMap {
 	heads := l.heads.Slice()
 	entry.Sort(l.SortFn, heads)
-	Reverse(heads)
+	sorting.Reverse(heads)
 
 	return entry.NewOrderedMapFromEntries(heads)
 }
@@ -733,8 +2111,37 @@ var AtlasJSONLog = atlas.BuildEntry(JSONLog{}).
 	StructMap().
 	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
 	AddField("Heads", atlas.StructMapEntry{SerialName: "heads"}).
+	AddField("Clocks", atlas.StructMapEntry{SerialName: "clocks", OmitEmpty: true}).
+	AddField("AccessController", atlas.StructMapEntry{SerialName: "accessController", OmitEmpty: true}).
+	AddField("Manifest", atlas.StructMapEntry{SerialName: "manifest", OmitEmpty: true}).
 	Complete()
 
+var _ accesscontroller.LogState = &Log{}
+
+// MarshalCBOR encodes the log as dag-cbor
+func (j *JSONLog) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(j)
+}
+
+// MarshalJSON encodes the log as JSON, the heads are links holding their
+// base58btc CID as they did before go-cid encoded CIDv1 in base32
+func (j *JSONLog) MarshalJSON() ([]byte, error) {
+	type jsonLog JSONLog
+
+	heads := make([]map[string]string, len(j.Heads))
+	for i, h := range j.Heads {
+		heads[i] = map[string]string{"/": io.CIDString(h)}
+	}
+
+	return json.Marshal(&struct {
+		*jsonLog
+		Heads []map[string]string
+	}{
+		jsonLog: (*jsonLog)(j),
+		Heads:   heads,
+	})
+}
+
 func init() {
 	cbornode.RegisterCborType(AtlasJSONLog)
 }
@@ -3,10 +3,14 @@ package log // import "berty.tech/go-ipfs-log/log"
 import (
 	"time"
 
+	"berty.tech/go-ipfs-log/accesscontroller"
 	"berty.tech/go-ipfs-log/entry"
 	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	"berty.tech/go-ipfs-log/utils/lamportclock"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
 	cid "github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	"github.com/pkg/errors"
@@ -14,20 +18,40 @@ import (
 
 type FetchOptions struct {
 	Length       *int
-	Exclude      []*entry.Entry
-	ProgressChan chan *entry.Entry
+	Exclude      []iface.IPFSLogEntry
+	ProgressChan chan iface.IPFSLogEntry
 	Timeout      time.Duration
+
+	// EntryLimiter and ByteLimiter bound the entries and bytes fetched per
+	// second, see entry.FetchOptions
+	EntryLimiter *ratelimit.Limiter
+	ByteLimiter  *ratelimit.Limiter
+
+	// Denylist skips denied entries, see entry.FetchOptions
+	Denylist entry.Denylist
+
+	// Offline only reads local blocks, see entry.FetchOptions
+	Offline bool
+
+	// Checkpoints stops the fetch at the checkpoint entries, the history
+	// they summarize isn't fetched, see Log.AppendCheckpoint
+	Checkpoints bool
 }
 
-func ToMultihash(services *io.IpfsServices, log *Log) (cid.Cid, error) {
+func ToMultihash(services io.IpfsServices, log *Log) (cid.Cid, error) {
 	if log.Values().Len() < 1 {
 		return cid.Cid{}, errors.New(`Can't serialize an empty log`)
 	}
 
+	if log.prefix != nil {
+		return io.WriteCBORWithPrefix(services, log.ToJSON(), *log.prefix)
+	}
+
 	return io.WriteCBOR(services, log.ToJSON())
 }
 
-func FromMultihash(services *io.IpfsServices, hash cid.Cid, options *FetchOptions) (*Snapshot, error) {
+// ReadJSONLog reads the manifest of a log, without fetching its entries
+func ReadJSONLog(services io.IpfsServices, hash cid.Cid) (*JSONLog, error) {
 	result, err := io.ReadCBOR(services, hash)
 	if err != nil {
 		return nil, err
@@ -39,26 +63,76 @@ func FromMultihash(services *io.IpfsServices, hash cid.Cid, options *FetchOption
 		return nil, err
 	}
 
+	return logData, nil
+}
+
+// manifestAccessController returns the access controller recorded in the
+// manifest of the log unless one is given
+func manifestAccessController(services io.IpfsServices, logData *JSONLog, ac accesscontroller.Interface) (accesscontroller.Interface, error) {
+	if ac != nil || logData.AccessController == "" {
+		return ac, nil
+	}
+
+	address, err := cid.Decode(logData.AccessController)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode access controller address")
+	}
+
+	return accesscontroller.LoadIPFS(services, address)
+}
+
+// fetchServices returns the services used to fetch entries, only reading
+// local blocks when offline is set
+func fetchServices(services io.IpfsServices, offline bool) io.IpfsServices {
+	if offline {
+		return io.Offline(services)
+	}
+
+	return services
+}
+
+// fetchHeads fetches only the given entries, without their ancestors
+func fetchHeads(services io.IpfsServices, hashes []cid.Cid, provider identityprovider.Interface) ([]iface.IPFSLogEntry, error) {
+	heads := []iface.IPFSLogEntry{}
+
+	for _, h := range hashes {
+		e, err := entry.FromMultihash(services, h, provider)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to fetch head")
+		}
+
+		e.Hash = h
+		heads = append(heads, e)
+	}
+
+	return heads, nil
+}
+
+func FromMultihash(services io.IpfsServices, hash cid.Cid, options *FetchOptions) (*Snapshot, error) {
+	logData, err := ReadJSONLog(fetchServices(services, options.Offline), hash)
+	if err != nil {
+		return nil, err
+	}
+
 	entries := entry.FetchAll(services, logData.Heads, &entry.FetchOptions{
 		Length:       options.Length,
 		Exclude:      options.Exclude,
 		ProgressChan: options.ProgressChan,
+		EntryLimiter: options.EntryLimiter,
+		ByteLimiter:  options.ByteLimiter,
+		Denylist:     options.Denylist,
+		Offline:      options.Offline,
+		Boundary:     checkpointBoundary(options.Checkpoints),
 	})
 
-	// Find latest clock
-	var clock *lamportclock.LamportClock
-	for _, e := range entries {
-		if clock == nil || e.Clock.Time > clock.Time {
-			clock = lamportclock.New(e.Clock.ID, e.Clock.Time)
-		}
-	}
+	clock := latestClock(entries)
 
 	entry.Sort(entry.Compare, entries)
 
-	heads := []*entry.Entry{}
+	heads := []iface.IPFSLogEntry{}
 	for _, e := range entries {
 		for _, h := range logData.Heads {
-			if h.String() == e.Hash.String() {
+			if h.String() == e.GetHash().String() {
 				heads = append(heads, e)
 			}
 		}
@@ -66,7 +140,7 @@ func FromMultihash(services *io.IpfsServices, hash cid.Cid, options *FetchOption
 
 	headsCids := []cid.Cid{}
 	for _, head := range heads {
-		headsCids = append(headsCids, head.Hash)
+		headsCids = append(headsCids, head.GetHash())
 	}
 
 	return &Snapshot{
@@ -77,7 +151,7 @@ func FromMultihash(services *io.IpfsServices, hash cid.Cid, options *FetchOption
 	}, nil
 }
 
-func FromEntryHash(services *io.IpfsServices, hashes []cid.Cid, options *FetchOptions) ([]*entry.Entry, error) {
+func FromEntryHash(services io.IpfsServices, hashes []cid.Cid, options *FetchOptions) ([]iface.IPFSLogEntry, error) {
 	if services == nil {
 		return nil, errmsg.IPFSNotDefined
 	}
@@ -96,6 +170,11 @@ func FromEntryHash(services *io.IpfsServices, hashes []cid.Cid, options *FetchOp
 		Length:       options.Length,
 		Exclude:      options.Exclude,
 		ProgressChan: options.ProgressChan,
+		EntryLimiter: options.EntryLimiter,
+		ByteLimiter:  options.ByteLimiter,
+		Denylist:     options.Denylist,
+		Offline:      options.Offline,
+		Boundary:     checkpointBoundary(options.Checkpoints),
 	})
 
 	sliced := entries
@@ -106,7 +185,7 @@ func FromEntryHash(services *io.IpfsServices, hashes []cid.Cid, options *FetchOp
 	return sliced, nil
 }
 
-func FromJSON(services *io.IpfsServices, jsonLog *JSONLog, options *entry.FetchOptions) (*Snapshot, error) {
+func FromJSON(services io.IpfsServices, jsonLog *JSONLog, options *entry.FetchOptions) (*Snapshot, error) {
 	if services == nil {
 		return nil, errmsg.IPFSNotDefined
 	}
@@ -117,8 +196,12 @@ func FromJSON(services *io.IpfsServices, jsonLog *JSONLog, options *entry.FetchO
 
 	entries := entry.FetchParallel(services, jsonLog.Heads, &entry.FetchOptions{
 		Length:       options.Length,
-		Exclude:      []*entry.Entry{},
+		Exclude:      []iface.IPFSLogEntry{},
 		ProgressChan: options.ProgressChan,
+		EntryLimiter: options.EntryLimiter,
+		ByteLimiter:  options.ByteLimiter,
+		Denylist:     options.Denylist,
+		Offline:      options.Offline,
 		Concurrency:  16,
 		Timeout:      options.Timeout,
 	})
@@ -129,10 +212,11 @@ func FromJSON(services *io.IpfsServices, jsonLog *JSONLog, options *entry.FetchO
 		ID:     jsonLog.ID,
 		Heads:  jsonLog.Heads,
 		Values: entries,
+		Clock:  latestClock(entries),
 	}, nil
 }
 
-func FromEntry(services *io.IpfsServices, sourceEntries []*entry.Entry, options *entry.FetchOptions) (*Snapshot, error) {
+func FromEntry(services io.IpfsServices, sourceEntries []iface.IPFSLogEntry, options *entry.FetchOptions) (*Snapshot, error) {
 	if services == nil {
 		return nil, errmsg.IPFSNotDefined
 	}
@@ -150,7 +234,7 @@ func FromEntry(services *io.IpfsServices, sourceEntries []*entry.Entry, options
 	// Make sure we pass hashes instead of objects to the fetcher function
 	hashes := []cid.Cid{}
 	for _, e := range sourceEntries {
-		hashes = append(hashes, e.Hash)
+		hashes = append(hashes, e.GetHash())
 	}
 
 	// Fetch the entries
@@ -158,6 +242,10 @@ func FromEntry(services *io.IpfsServices, sourceEntries []*entry.Entry, options
 		Length:       &length,
 		Exclude:      options.Exclude,
 		ProgressChan: options.ProgressChan,
+		EntryLimiter: options.EntryLimiter,
+		ByteLimiter:  options.ByteLimiter,
+		Denylist:     options.Denylist,
+		Offline:      options.Offline,
 	})
 
 	// Combine the fetches with the source entries and take only uniques
@@ -166,7 +254,7 @@ func FromEntry(services *io.IpfsServices, sourceEntries []*entry.Entry, options
 	entry.Sort(entry.Compare, uniques)
 
 	// Cap the result at the right size by taking the last n entries
-	var sliced []*entry.Entry
+	var sliced []iface.IPFSLogEntry
 
 	if length > -1 {
 		sliced = entry.Slice(uniques, -length)
@@ -178,7 +266,21 @@ func FromEntry(services *io.IpfsServices, sourceEntries []*entry.Entry, options
 	result := append(missingSourceEntries, entry.SliceRange(sliced, len(missingSourceEntries), len(sliced))...)
 
 	return &Snapshot{
-		ID:     result[len(result)-1].LogID,
+		ID:     result[len(result)-1].GetLogID(),
 		Values: result,
+		Clock:  latestClock(result),
 	}, nil
 }
+
+// latestClock returns the clock with the greatest time among the entries,
+// nil when there are none
+func latestClock(entries []iface.IPFSLogEntry) *lamportclock.LamportClock {
+	var clock *lamportclock.LamportClock
+	for _, e := range entries {
+		if clock == nil || e.GetClock().Time > clock.Time {
+			clock = lamportclock.New(e.GetClock().ID, e.GetClock().Time)
+		}
+	}
+
+	return clock
+}
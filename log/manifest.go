@@ -0,0 +1,225 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"reflect"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/sorting"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// ManifestVersion is the format version of the written manifests
+const ManifestVersion = 1
+
+// Manifest describes how a log is configured, it is written once per log
+// and recorded when the log is serialized so the peers loading it use the
+// same access controller and sort function
+type Manifest struct {
+	Version int
+
+	// Name is the name of the log, see NewAddress
+	Name string
+
+	// AccessController is the address of the access controller stored on
+	// IPFS, empty when it isn't stored
+	AccessController string
+
+	// SortFn is the name of the sort function registered in the sorting
+	// package, empty for sorting.LastWriteWins
+	SortFn string
+}
+
+// NewManifest returns the manifest of a log, the access controller is only
+// recorded when it is stored on IPFS
+func NewManifest(name string, ac accesscontroller.Interface, sortName string) *Manifest {
+	m := &Manifest{
+		Version: ManifestVersion,
+		Name:    name,
+	}
+
+	if sortName != sorting.LastWriteWinsName {
+		m.SortFn = sortName
+	}
+
+	if a, ok := ac.(accesscontroller.Addressable); ok && a.Address().Defined() {
+		m.AccessController = io.CIDString(a.Address())
+	}
+
+	return m
+}
+
+// Address returns the address of the log described by the manifest, its
+// hash is the one of the manifest written with io.DefaultPrefix so the
+// manifest of a log can be read from its address
+func (m *Manifest) Address() (Address, error) {
+	data, err := m.MarshalCBOR()
+	if err != nil {
+		return Address{}, errors.Wrap(err, "unable to encode manifest")
+	}
+
+	c, err := io.DefaultPrefix.Sum(data)
+	if err != nil {
+		return Address{}, errors.Wrap(err, "unable to hash manifest")
+	}
+
+	return Address{Manifest: c, Name: m.Name}, nil
+}
+
+// WriteManifest stores the manifest of the log, it is only written once
+// and recorded by ToJSON from then on
+func (l *Log) WriteManifest() (cid.Cid, error) {
+	if l.manifest.Defined() {
+		return l.manifest, nil
+	}
+
+	m := NewManifest(l.name, l.accessController, l.sortName)
+
+	prefix := io.DefaultPrefix
+	if l.prefix != nil {
+		prefix = *l.prefix
+	}
+
+	c, err := io.WriteCBORWithPrefix(l.Storage, m, prefix)
+	if err != nil {
+		return cid.Cid{}, errors.Wrap(err, "unable to write manifest")
+	}
+
+	l.manifest = c
+
+	return c, nil
+}
+
+// ReadManifest reads the manifest stored at the address
+func ReadManifest(services io.IpfsServices, hash cid.Cid) (*Manifest, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	nd, err := io.ReadCBOR(services, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+
+	m := &Manifest{}
+	if err := cbornode.DecodeInto(nd.RawData(), m); err != nil {
+		return nil, errors.Wrap(err, "unable to decode manifest")
+	}
+
+	if m.Version < 1 || m.Version > ManifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d", m.Version)
+	}
+
+	return m, nil
+}
+
+// logManifest reads the manifest recorded in the serialized log and
+// completes the options with it. Options configuring the log differently,
+// such as another access controller or sort function, are rejected with
+// errmsg.ManifestConflict.
+func logManifest(services io.IpfsServices, logData *JSONLog, options *NewLogOptions) (*NewLogOptions, error) {
+	if logData.Manifest == "" {
+		return options, nil
+	}
+
+	hash, err := cid.Decode(logData.Manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode manifest address")
+	}
+
+	m, err := ReadManifest(services, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkManifest(m, options); err != nil {
+		return nil, err
+	}
+
+	resolved := *options
+	resolved.Manifest = hash
+
+	if resolved.Name == "" {
+		resolved.Name = m.Name
+	}
+
+	if resolved.SortName == "" {
+		resolved.SortName = m.SortFn
+	}
+
+	if resolved.AccessController == nil && m.AccessController != "" {
+		address, err := cid.Decode(m.AccessController)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode access controller address")
+		}
+
+		if resolved.AccessController, err = accesscontroller.LoadIPFS(services, address); err != nil {
+			return nil, err
+		}
+	}
+
+	return &resolved, nil
+}
+
+// checkManifest returns an error if the options configure the access
+// controller or the sort function of the log differently than the manifest
+func checkManifest(m *Manifest, options *NewLogOptions) error {
+	if options.AccessController != nil {
+		address := ""
+		if ac, ok := options.AccessController.(accesscontroller.Addressable); ok && ac.Address().Defined() {
+			address = io.CIDString(ac.Address())
+		}
+
+		if address != m.AccessController {
+			return errors.Wrapf(errmsg.ManifestConflict, "the log uses the access controller %q", m.AccessController)
+		}
+	}
+
+	sortName := m.SortFn
+	if sortName == "" {
+		sortName = sorting.LastWriteWinsName
+	}
+
+	if options.SortName != "" && options.SortName != sortName {
+		return errors.Wrapf(errmsg.ManifestConflict, "the log is sorted by %q", sortName)
+	}
+
+	if options.Tiebreaker != nil {
+		return errors.Wrapf(errmsg.ManifestConflict, "the log is sorted by %q, it has no tiebreaker", sortName)
+	}
+
+	if options.SortFn != nil {
+		fn, ok := sorting.Lookup(sortName)
+		if !ok {
+			return errors.Wrapf(errmsg.UnknownSortFunction, "%q", sortName)
+		}
+
+		// Functions can't be compared, their code pointers are
+		if reflect.ValueOf(fn).Pointer() != reflect.ValueOf(options.SortFn).Pointer() {
+			return errors.Wrapf(errmsg.ManifestConflict, "the log is sorted by %q", sortName)
+		}
+	}
+
+	return nil
+}
+
+var atlasManifest = atlas.BuildEntry(Manifest{}).
+	StructMap().
+	AddField("Version", atlas.StructMapEntry{SerialName: "version"}).
+	AddField("Name", atlas.StructMapEntry{SerialName: "name"}).
+	AddField("AccessController", atlas.StructMapEntry{SerialName: "accessController", OmitEmpty: true}).
+	AddField("SortFn", atlas.StructMapEntry{SerialName: "sortFn", OmitEmpty: true}).
+	Complete()
+
+// MarshalCBOR encodes the manifest as dag-cbor
+func (m *Manifest) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(m)
+}
+
+func init() {
+	cbornode.RegisterCborType(atlasManifest)
+}
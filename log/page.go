@@ -0,0 +1,112 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"strings"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// ValuesPage returns up to limit entries of the log in the reverse order
+// of Values, from the newest, and the token of the next page, empty after
+// the last page. An empty token returns the first page, a negative limit
+// returns all the entries and a zero limit is an error. Only the entries of
+// the page are loaded and sorted.
+//
+// The token holds the entries the traversal from the heads would visit
+// next, the following pages don't move when entries are appended or joined
+// on top of the log, but they miss the entries joined on a branch the token
+// doesn't reach.
+func (l *Log) ValuesPage(token string, limit int) ([]iface.IPFSLogEntry, string, error) {
+	if limit == 0 {
+		return nil, "", errmsg.InvalidPageLimit
+	}
+
+	roots, err := l.pageRoots(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	stack := newEntryQueue(l.SortFn)
+	traversed := map[cid.Cid]struct{}{}
+	for _, e := range roots {
+		if _, ok := traversed[e.GetHash()]; ok {
+			continue
+		}
+
+		traversed[e.GetHash()] = struct{}{}
+		stack.push(e)
+	}
+
+	entries := []iface.IPFSLogEntry{}
+	for stack.Len() > 0 && (limit < 0 || len(entries) < limit) {
+		e := stack.pop()
+		if stack.err != nil {
+			return nil, "", errors.Wrap(stack.err, "unable to load page")
+		}
+
+		entries = append(entries, e)
+
+		for _, next := range e.GetNext() {
+			if _, ok := traversed[next]; ok {
+				continue
+			}
+
+			nextEntry, ok, err := l.get(next)
+			if err != nil {
+				return nil, "", errors.Wrap(err, "unable to load page")
+			}
+
+			if !ok {
+				continue
+			}
+
+			traversed[next] = struct{}{}
+			stack.push(nextEntry)
+		}
+	}
+
+	hashes := make([]string, 0, stack.Len())
+	for _, item := range stack.items {
+		hashes = append(hashes, io.CIDString(item.entry.GetHash()))
+	}
+
+	return entries, strings.Join(hashes, ","), nil
+}
+
+// pageRoots returns the entries a page token starts from, the heads for an
+// empty token
+func (l *Log) pageRoots(token string) ([]iface.IPFSLogEntry, error) {
+	if token == "" {
+		if l.heads == nil {
+			return nil, nil
+		}
+
+		return l.heads.Slice(), nil
+	}
+
+	roots := []iface.IPFSLogEntry{}
+	for _, s := range strings.Split(token, ",") {
+		hash, err := cid.Decode(s)
+		if err != nil {
+			return nil, errmsg.InvalidPageToken
+		}
+
+		e, ok, err := l.get(hash)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load page")
+		}
+
+		// The entry was removed since the token was returned
+		if !ok {
+			continue
+		}
+
+		roots = append(roots, e)
+	}
+
+	return roots, nil
+}
@@ -0,0 +1,32 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/pkg/errors"
+)
+
+// pinEntry pins the entry block and its external payload, the parents of
+// the entry are pinned separately
+func (l *Log) pinEntry(e iface.IPFSLogEntry) error {
+	pinner := l.Storage.Pinner()
+	if pinner == nil {
+		return errmsg.PinnerNotDefined
+	}
+
+	ctx := context.Background()
+
+	if err := pinner.Pin(ctx, e.GetHash(), false); err != nil {
+		return errors.Wrap(err, "unable to pin entry")
+	}
+
+	if ref := e.GetPayloadRef(); ref.Defined() {
+		if err := pinner.Pin(ctx, ref, true); err != nil {
+			return errors.Wrap(err, "unable to pin payload")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// Proof is the chain of Next links leading from a head of a log to one of
+// its entries
+type Proof struct {
+	// Path holds the hashes of the entries from the head to the proven
+	// entry
+	Path []cid.Cid
+
+	// Blocks holds the encoded entries of Path
+	Blocks [][]byte
+}
+
+// Prove returns the shortest chain of entries linking a head of the log to
+// the entry with the given hash
+func (l *Log) Prove(hash cid.Cid) (*Proof, error) {
+	return l.prove(l.heads.Slice(), hash)
+}
+
+// ProveFrom returns the shortest chain of entries linking one of the given
+// entries of the log, such as former heads, to the entry with the hash
+func (l *Log) ProveFrom(roots []cid.Cid, hash cid.Cid) (*Proof, error) {
+	entries := []iface.IPFSLogEntry{}
+	for _, r := range roots {
+		e, ok, err := l.GetEntryE(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "prove failed")
+		}
+
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+
+	return l.prove(entries, hash)
+}
+
+func (l *Log) prove(roots []iface.IPFSLogEntry, hash cid.Cid) (*Proof, error) {
+	parents := map[cid.Cid]cid.Cid{}
+	visited := cid.NewSet()
+	queue := []iface.IPFSLogEntry{}
+
+	for _, h := range roots {
+		if visited.Visit(h.GetHash()) {
+			queue = append(queue, h)
+		}
+	}
+
+	found := false
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+
+		if e.GetHash().Equals(hash) {
+			found = true
+			break
+		}
+
+		for _, next := range e.GetNext() {
+			if !visited.Visit(next) {
+				continue
+			}
+
+			n, ok, err := l.GetEntryE(next)
+			if err != nil {
+				return nil, errors.Wrap(err, "prove failed")
+			}
+
+			if !ok {
+				continue
+			}
+
+			parents[next] = e.GetHash()
+			queue = append(queue, n)
+		}
+	}
+
+	if !found {
+		return nil, errors.Wrapf(errmsg.EntryNotFound, "entry %s isn't reachable from the roots", hash)
+	}
+
+	path := []cid.Cid{hash}
+	for {
+		parent, ok := parents[path[0]]
+		if !ok {
+			break
+		}
+
+		path = append([]cid.Cid{parent}, path...)
+	}
+
+	proof := &Proof{Path: path}
+	for _, c := range path {
+		nd, err := l.Storage.DAG().Get(context.TODO(), c)
+		if err != nil {
+			return nil, errors.Wrap(err, "prove failed")
+		}
+
+		proof.Blocks = append(proof.Blocks, nd.RawData())
+	}
+
+	return proof, nil
+}
+
+// VerifyProof checks that a proof links the given head to its last entry
+// and returns that entry
+func VerifyProof(proof *Proof, head cid.Cid) (*entry.Entry, error) {
+	if proof == nil || len(proof.Path) == 0 || len(proof.Path) != len(proof.Blocks) {
+		return nil, errors.Wrap(errmsg.InvalidProof, "malformed proof")
+	}
+
+	if !proof.Path[0].Equals(head) {
+		return nil, errors.Wrapf(errmsg.InvalidProof, "proof starts at %s instead of %s", proof.Path[0], head)
+	}
+
+	var e *entry.Entry
+	for i, c := range proof.Path {
+		sum, err := c.Prefix().Sum(proof.Blocks[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to hash block")
+		}
+
+		if !sum.Equals(c) {
+			return nil, errors.Wrapf(errmsg.InvalidProof, "block %d doesn't match %s", i, c)
+		}
+
+		e, err = entry.FromRawData(proof.Blocks[i], c, nil)
+		if err != nil {
+			return nil, errors.Wrapf(errmsg.InvalidProof, "unable to decode %s: %v", c, err)
+		}
+
+		if i == len(proof.Path)-1 {
+			break
+		}
+
+		linked := false
+		for _, next := range e.GetNext() {
+			if next.Equals(proof.Path[i+1]) {
+				linked = true
+				break
+			}
+		}
+
+		if !linked {
+			return nil, errors.Wrapf(errmsg.InvalidProof, "%s doesn't link to %s", c, proof.Path[i+1])
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,288 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// ReleaseOptions defines what happens to the blocks of the entries removed
+// from a log, the blocks reachable from the retained heads are always kept
+type ReleaseOptions struct {
+	// Unpin removes the pins of the entries and of their payloads
+	Unpin bool
+
+	// Delete removes the unpinned entry blocks from the local blockstore,
+	// it requires services with a pinner. The payload blocks are only
+	// unpinned: they may be shared with the other logs of the blockstore,
+	// the garbage collection of the node removes them.
+	Delete bool
+}
+
+// Prune keeps at most the keep latest entries and removes the others from
+// the log, their blocks are released as set by NewLogOptions.Release. The
+// retained entries whose children are removed are removed too, so every
+// retained entry is reachable from the new heads and the Next index only
+// references retained entries. The removed entries are returned, oldest
+// first, so they can be archived.
+func (l *Log) Prune(keep int) ([]iface.IPFSLogEntry, error) {
+	removed := l.prune(keep)
+
+	if len(removed) > 0 {
+		if err := l.saveHeads(); err != nil {
+			return removed, errors.Wrap(err, "prune failed")
+		}
+
+		if err := l.RebuildIndexes(); err != nil {
+			return removed, errors.Wrap(err, "prune failed")
+		}
+	}
+
+	if err := l.release(removed); err != nil {
+		return removed, errors.Wrap(err, "prune failed")
+	}
+
+	return removed, nil
+}
+
+// prune keeps at most the keep latest entries, closed under their
+// children, it returns the removed ones
+func (l *Log) prune(keep int) []iface.IPFSLogEntry {
+	retained, removed := l.prunable(keep)
+	if len(removed) > 0 {
+		l.retain(retained)
+	}
+
+	return removed
+}
+
+// prunable splits the entries of the log between the ones retained by
+// prune and the removed ones
+func (l *Log) prunable(keep int) ([]iface.IPFSLogEntry, []iface.IPFSLogEntry) {
+	values := l.Values().Slice()
+	if keep < 0 || len(values) <= keep {
+		return values, nil
+	}
+
+	byHash := make(map[cid.Cid]iface.IPFSLogEntry, len(values))
+	children := make(map[cid.Cid][]cid.Cid, len(values))
+	for _, e := range values {
+		byHash[e.GetHash()] = e
+		for _, n := range e.GetNext() {
+			children[n] = append(children[n], e.GetHash())
+		}
+	}
+
+	kept := cid.NewSet()
+	queue := make([]cid.Cid, 0, keep)
+	for _, e := range values[len(values)-keep:] {
+		kept.Add(e.GetHash())
+		queue = append(queue, e.GetHash())
+	}
+
+	// A custom sort function may place a child before its parent, the
+	// parents of the dropped entries are checked again
+	for len(queue) > 0 {
+		h := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		if !kept.Has(h) {
+			continue
+		}
+
+		for _, child := range children[h] {
+			if !kept.Has(child) {
+				kept.Remove(h)
+				queue = append(queue, byHash[h].GetNext()...)
+				break
+			}
+		}
+	}
+
+	retained := make([]iface.IPFSLogEntry, 0, kept.Len())
+	removed := make([]iface.IPFSLogEntry, 0, len(values)-kept.Len())
+	for _, e := range values {
+		if kept.Has(e.GetHash()) {
+			retained = append(retained, e)
+		} else {
+			removed = append(removed, e)
+		}
+	}
+
+	return retained, removed
+}
+
+// retain only keeps the given entries, which must hold every child of
+// their entries, the heads and the Next index are updated
+func (l *Log) retain(retained []iface.IPFSLogEntry) {
+	l.Entries = entry.NewOrderedMapFromEntries(retained)
+	l.heads = entry.NewOrderedMapFromEntries(FindHeads(l.Entries))
+
+	for _, parent := range l.Next.CIDs() {
+		if child, _ := l.Next.GetCID(parent); !l.Entries.HasCID(child.GetHash()) {
+			l.Next.DeleteCID(parent)
+		}
+	}
+
+	// A removed child may have been indexed for a parent with retained ones
+	for _, e := range retained {
+		for _, n := range e.GetNext() {
+			if !l.Next.HasCID(n) {
+				l.Next.SetCID(n, e)
+			}
+		}
+	}
+}
+
+// truncate keeps the size latest entries, it returns the removed ones. The
+// Next index isn't updated, as Join of the JS implementation does.
+func (l *Log) truncate(size int) []iface.IPFSLogEntry {
+	values := l.Values().Slice()
+	if size < 0 || len(values) <= size {
+		return nil
+	}
+
+	kept := entry.NewOrderedMapFromEntries(values[len(values)-size:])
+	l.Entries = kept
+	l.heads = entry.NewOrderedMapFromEntries(FindHeads(kept))
+
+	return values[:len(values)-size]
+}
+
+// release unpins the blocks of removed entries and deletes their entry
+// blocks, skipping the blocks still reachable from the heads
+func (l *Log) release(removed []iface.IPFSLogEntry) error {
+	options := l.releaseOptions
+	if options == nil || len(removed) == 0 || (!options.Unpin && !options.Delete) {
+		return nil
+	}
+
+	pinner := l.Storage.Pinner()
+	if options.Delete && pinner == nil {
+		return errors.Wrap(errmsg.PinnerNotDefined, "blocks can't be deleted without pinner")
+	}
+
+	ctx := context.Background()
+
+	retained, err := l.retainedBlocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	blocks := []cid.Cid{}
+	for _, e := range removed {
+		eBlocks, err := l.entryBlocks(ctx, e)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range eBlocks {
+			if !retained.Has(c) {
+				blocks = append(blocks, c)
+			}
+		}
+	}
+
+	if options.Unpin && pinner != nil {
+		for _, c := range blocks {
+			if err := pinner.Unpin(ctx, c); err != nil {
+				return errors.Wrapf(err, "unable to unpin block %s", c)
+			}
+		}
+	}
+
+	if !options.Delete || l.Storage.BlockStore() == nil {
+		return nil
+	}
+
+	for _, e := range removed {
+		c := e.GetHash()
+		if retained.Has(c) {
+			continue
+		}
+
+		// Blocks pinned by other means are kept
+		if ok, err := pinner.IsPinned(ctx, c); err != nil || ok {
+			continue
+		}
+
+		if err := l.Storage.BlockStore().DeleteBlock(c); err != nil {
+			return errors.Wrapf(err, "unable to delete block %s", c)
+		}
+	}
+
+	return nil
+}
+
+// retainedBlocks returns the blocks of the entries reachable from the heads
+// through the entries held by the log
+func (l *Log) retainedBlocks(ctx context.Context) (*cid.Set, error) {
+	retained := cid.NewSet()
+	stack := entrySliceToCids(l.heads.Slice())
+
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		e, ok := l.Entries.GetCID(hash)
+		if !ok || retained.Has(hash) {
+			continue
+		}
+
+		blocks, err := l.entryBlocks(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range blocks {
+			retained.Add(c)
+		}
+
+		stack = append(stack, e.GetNext()...)
+	}
+
+	return retained, nil
+}
+
+// entryBlocks returns the entry block and the local blocks of its payload
+// DAG, payloads may share blocks with other entries
+func (l *Log) entryBlocks(ctx context.Context, e iface.IPFSLogEntry) ([]cid.Cid, error) {
+	blocks := []cid.Cid{e.GetHash()}
+
+	ref := e.GetPayloadRef()
+	if !ref.Defined() {
+		return blocks, nil
+	}
+
+	dag := io.Offline(l.Storage).DAG()
+	stack := []cid.Cid{ref}
+	seen := cid.NewSet()
+
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !seen.Visit(c) {
+			continue
+		}
+
+		blocks = append(blocks, c)
+
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			// Missing blocks have nothing to release
+			continue
+		}
+
+		for _, link := range nd.Links() {
+			stack = append(stack, link.Cid)
+		}
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,222 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// Query selects entries of a log, it is built by chaining its methods and
+// evaluated lazily by Seq or All. The selected entries are in the order of
+// Values, or in the reverse order once Descending is called.
+type Query struct {
+	log        *Log
+	author     string
+	clockRange bool
+	from, to   int
+	since      time.Time
+	until      time.Time
+	metadata   map[string]string
+	predicates []func(iface.IPFSLogEntry) bool
+	limit      int
+	descending bool
+}
+
+// Query returns a query selecting every entry of the log
+func (l *Log) Query() *Query {
+	return &Query{
+		log:      l,
+		metadata: map[string]string{},
+		limit:    -1,
+	}
+}
+
+// Author only selects the entries of an author, see EntriesBy
+func (q *Query) Author(author string) *Query {
+	q.author = author
+	return q
+}
+
+// ClockRange only selects the entries whose clock time is in the
+// [from, to] range
+func (q *Query) ClockRange(from, to int) *Query {
+	q.clockRange = true
+	q.from, q.to = from, to
+	return q
+}
+
+// Between only selects the entries whose timestamp is in the
+// [since, until) range, a zero until has no upper bound
+func (q *Query) Between(since, until time.Time) *Query {
+	q.since, q.until = since, until
+	return q
+}
+
+// Metadata only selects the entries whose metadata holds value for key
+func (q *Query) Metadata(key, value string) *Query {
+	q.metadata[key] = value
+	return q
+}
+
+// Payload only selects the entries whose payload matches the predicate
+func (q *Query) Payload(predicate func(payload []byte) bool) *Query {
+	return q.Where(func(e iface.IPFSLogEntry) bool {
+		return predicate(e.GetPayload())
+	})
+}
+
+// Where only selects the entries matching the predicate
+func (q *Query) Where(predicate func(e iface.IPFSLogEntry) bool) *Query {
+	q.predicates = append(q.predicates, predicate)
+	return q
+}
+
+// Limit selects at most n entries, a negative n has no limit
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Descending selects the entries in the reverse order of Values, from the
+// newest
+func (q *Query) Descending() *Query {
+	q.descending = true
+	return q
+}
+
+func (q *Query) timeRange() bool {
+	return !q.since.IsZero() || !q.until.IsZero()
+}
+
+func (q *Query) matches(e iface.IPFSLogEntry) bool {
+	if q.author != "" && Author(e) != q.author {
+		return false
+	}
+
+	if q.clockRange {
+		if t := e.GetClock().Time; t < q.from || t > q.to {
+			return false
+		}
+	}
+
+	if q.timeRange() {
+		t := e.GetTimestamp()
+		if t.IsZero() || t.Before(q.since) || (!q.until.IsZero() && !t.Before(q.until)) {
+			return false
+		}
+	}
+
+	metadata := e.GetMetadata()
+	for k, v := range q.metadata {
+		if value, ok := metadata[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	for _, predicate := range q.predicates {
+		if !predicate(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// candidates returns the entries selected by an index of the log, in the
+// order of Values, or false when no index applies
+func (q *Query) candidates() ([]iface.IPFSLogEntry, bool, error) {
+	var (
+		entries []iface.IPFSLogEntry
+		err     error
+	)
+
+	switch {
+	case q.author != "":
+		// The author index is already in the order of Values
+		entries, err = q.log.EntriesBy(q.author)
+		return entries, true, err
+
+	case q.clockRange:
+		entries, err = q.log.Range(q.from, q.to)
+
+	case q.timeRange():
+		entries, err = q.log.Between(q.since, q.until)
+
+	default:
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	entry.Sort(q.log.SortFn, entries)
+
+	return entries, true, nil
+}
+
+// Seq calls yield with the selected entries until yield returns false,
+// the entries are only loaded and filtered as they are yielded when no
+// index applies and the query is descending
+func (q *Query) Seq(yield func(iface.IPFSLogEntry) bool) error {
+	if q.limit == 0 {
+		return nil
+	}
+
+	count := 0
+	visit := func(e iface.IPFSLogEntry) bool {
+		if !q.matches(e) {
+			return true
+		}
+
+		count++
+		if !yield(e) {
+			return false
+		}
+
+		return q.limit < 0 || count < q.limit
+	}
+
+	entries, indexed, err := q.candidates()
+	if err != nil {
+		return err
+	}
+
+	if !indexed {
+		if q.descending {
+			return q.log.ValuesSeq(visit)
+		}
+
+		entries = q.log.Values().Slice()
+	}
+
+	if q.descending {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !visit(entries[i]) {
+				return nil
+			}
+		}
+
+		return nil
+	}
+
+	for _, e := range entries {
+		if !visit(e) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// All returns the selected entries
+func (q *Query) All() ([]iface.IPFSLogEntry, error) {
+	entries := []iface.IPFSLogEntry{}
+	err := q.Seq(func(e iface.IPFSLogEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+
+	return entries, err
+}
@@ -0,0 +1,93 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"berty.tech/go-ipfs-log/iface"
+)
+
+type queueItem struct {
+	entry iface.IPFSLogEntry
+	seq   int
+}
+
+// entryQueue is a priority queue popping the greatest entry according to
+// the sort function first, entries comparing equal are popped in insertion
+// order. It is a binary heap on a slice of items rather than a
+// container/heap, which would allocate an interface for every push and pop.
+// The first error returned by the sort function is kept, see err.
+type entryQueue struct {
+	items  []queueItem
+	sortFn func(a, b iface.IPFSLogEntry) (int, error)
+	seq    int
+	err    error
+}
+
+func newEntryQueue(sortFn func(a, b iface.IPFSLogEntry) (int, error)) *entryQueue {
+	return &entryQueue{sortFn: sortFn}
+}
+
+func (q *entryQueue) Len() int { return len(q.items) }
+
+func (q *entryQueue) less(i, j int) bool {
+	ret, err := q.sortFn(q.items[i].entry, q.items[j].entry)
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+
+		return q.items[i].seq < q.items[j].seq
+	}
+
+	if ret == 0 {
+		return q.items[i].seq < q.items[j].seq
+	}
+
+	return ret > 0
+}
+
+// push adds an entry to the queue
+func (q *entryQueue) push(e iface.IPFSLogEntry) {
+	q.items = append(q.items, queueItem{entry: e, seq: q.seq})
+	q.seq++
+
+	i := len(q.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.less(i, parent) {
+			break
+		}
+
+		q.items[i], q.items[parent] = q.items[parent], q.items[i]
+		i = parent
+	}
+}
+
+// pop removes and returns the greatest entry of the queue
+func (q *entryQueue) pop() iface.IPFSLogEntry {
+	last := len(q.items) - 1
+	top := q.items[0].entry
+
+	q.items[0] = q.items[last]
+	q.items[last] = queueItem{}
+	q.items = q.items[:last]
+
+	i := 0
+	for {
+		child := 2*i + 1
+		if child >= len(q.items) {
+			break
+		}
+
+		if right := child + 1; right < len(q.items) && q.less(right, child) {
+			child = right
+		}
+
+		if !q.less(child, i) {
+			break
+		}
+
+		q.items[i], q.items[child] = q.items[child], q.items[i]
+		i = child
+	}
+
+	return top
+}
@@ -0,0 +1,138 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// RepairReport lists what was repaired in a log
+type RepairReport struct {
+	// Refetched are the heads missing from the local state which were
+	// fetched again from IPFS
+	Refetched []cid.Cid
+
+	// Dropped are the heads which couldn't be found, the log is rolled
+	// back to the heads of the entries it holds
+	Dropped []cid.Cid
+
+	// Restored are the heads which were missing from the entries of the
+	// log and were added back
+	Restored []cid.Cid
+
+	// Stale are the heads which were removed because an entry of the log
+	// references them
+	Stale []cid.Cid
+
+	// DanglingNext are the parents whose Next index item referenced an
+	// entry missing from the log, the items were removed
+	DanglingNext []cid.Cid
+
+	// Reindexed are the parents added to the Next index
+	Reindexed []cid.Cid
+}
+
+// OK returns true if nothing was repaired
+func (r *RepairReport) OK() bool {
+	return len(r.Refetched) == 0 && len(r.Dropped) == 0 && len(r.Restored) == 0 &&
+		len(r.Stale) == 0 && len(r.DanglingNext) == 0 && len(r.Reindexed) == 0
+}
+
+// Repair makes the heads and the Next index of the log consistent with
+// its entries: heads missing from the entries are added back, heads
+// referenced by other entries are removed and the Next index items of
+// missing entries are removed. The heads of a log holding all its entries
+// are recomputed from them when none is left, and the missing Next index
+// items are added.
+func (l *Log) Repair() (*RepairReport, error) {
+	report := &RepairReport{}
+	return report, l.repair(report)
+}
+
+func (l *Log) repair(report *RepairReport) error {
+	lazy := l.IsLazy()
+	changed := false
+
+	for _, h := range l.heads.Slice() {
+		if l.has(h.GetHash()) {
+			continue
+		}
+
+		if err := l.put(h); err != nil {
+			return errors.Wrap(err, "unable to restore head")
+		}
+
+		if err := l.updateIndexes([]iface.IPFSLogEntry{h}); err != nil {
+			return err
+		}
+
+		report.Restored = append(report.Restored, h.GetHash())
+	}
+
+	for _, parent := range l.Next.CIDs() {
+		child, _ := l.Next.GetCID(parent)
+		if !l.has(child.GetHash()) {
+			l.Next.DeleteCID(parent)
+			report.DanglingNext = append(report.DanglingNext, parent)
+		}
+	}
+
+	if !lazy {
+		for _, e := range l.Entries.Slice() {
+			for _, n := range e.GetNext() {
+				if !l.Next.HasCID(n) {
+					l.Next.SetCID(n, e)
+					report.Reindexed = append(report.Reindexed, n)
+				}
+			}
+		}
+	}
+
+	heads := []iface.IPFSLogEntry{}
+	for _, h := range l.heads.Slice() {
+		if l.Next.HasCID(h.GetHash()) {
+			report.Stale = append(report.Stale, h.GetHash())
+			changed = true
+			continue
+		}
+
+		heads = append(heads, h)
+	}
+
+	if len(heads) == 0 && !lazy && l.Entries.Len() > 0 {
+		heads = FindHeads(l.Entries)
+		changed = true
+	}
+
+	if changed {
+		l.heads = entry.NewOrderedMapFromEntries(heads)
+		if err := l.saveHeads(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// repairOnOpen repairs a log opened from local state when the options ask
+// for it, the report is completed with what was repaired
+func repairOnOpen(l *Log, report *RepairReport, logOptions *NewLogOptions) (*Log, error) {
+	if logOptions.Repair == nil {
+		return l, nil
+	}
+
+	if err := l.repair(report); err != nil {
+		return nil, errors.Wrap(err, "unable to repair log")
+	}
+
+	if len(report.Dropped) > 0 {
+		if err := l.saveHeads(); err != nil {
+			return nil, errors.Wrap(err, "unable to repair log")
+		}
+	}
+
+	logOptions.Repair(report)
+
+	return l, nil
+}
@@ -0,0 +1,347 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	goio "io"
+	"strconv"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// cborSnapshot is the serialized form of a snapshot kept in a datastore,
+// delta snapshots only hold the entries added since their base and chunked
+// snapshots store their entries in Chunks values next to it
+type cborSnapshot struct {
+	ID     string
+	Heads  []cid.Cid
+	Values []*cborSnapshotEntry
+	Clock  *lamportclock.CborLamportClock
+	Base   string
+	Chunks int
+}
+
+// cborSnapshotEntry holds the raw data of an entry along with its hash
+type cborSnapshotEntry struct {
+	Hash cid.Cid
+	Data []byte
+}
+
+// newCborSnapshot returns the serialized form of the snapshot without its
+// entries
+func newCborSnapshot(snapshot *Snapshot) *cborSnapshot {
+	c := &cborSnapshot{
+		ID:     snapshot.ID,
+		Heads:  snapshot.Heads,
+		Values: []*cborSnapshotEntry{},
+	}
+
+	if snapshot.Clock != nil {
+		c.Clock = snapshot.Clock.ToCborLamportClock()
+	}
+
+	return c
+}
+
+// SaveSnapshot stores the whole snapshot, entries included, in the datastore
+// under the given key so the log can be reopened without the network
+func SaveSnapshot(ds datastore.Datastore, key datastore.Key, snapshot *Snapshot) error {
+	return saveSnapshot(ds, key, nil, snapshot, nil, nil)
+}
+
+// SaveSnapshotWithOptions stores the snapshot like SaveSnapshot, it is
+// compressed and split in several values according to the options
+func SaveSnapshotWithOptions(ds datastore.Datastore, key datastore.Key, snapshot *Snapshot, options *SnapshotOptions) error {
+	return saveSnapshot(ds, key, nil, snapshot, nil, options)
+}
+
+// SaveDeltaSnapshot stores the snapshot under the given key, keeping only the
+// entries which aren't already stored by the snapshot at base or its own
+// bases. LoadSnapshot chains them back into a full snapshot.
+func SaveDeltaSnapshot(ds datastore.Datastore, key datastore.Key, base datastore.Key, snapshot *Snapshot) error {
+	if ds == nil {
+		return errors.New("datastore is not defined")
+	}
+
+	chain, err := readSnapshotChain(ds, base)
+	if err != nil {
+		return err
+	}
+
+	known := cid.NewSet()
+	for _, c := range chain {
+		for _, v := range c.Values {
+			known.Add(v.Hash)
+		}
+	}
+
+	return saveSnapshot(ds, key, &base, snapshot, known, nil)
+}
+
+// saveSnapshot stores the entries of the snapshot which aren't known
+func saveSnapshot(ds datastore.Datastore, key datastore.Key, base *datastore.Key, snapshot *Snapshot, known *cid.Set, options *SnapshotOptions) error {
+	if ds == nil {
+		return errors.New("datastore is not defined")
+	}
+
+	if snapshot == nil {
+		return errmsg.EntriesNotDefined
+	}
+
+	c := newCborSnapshot(snapshot)
+	if base != nil {
+		c.Base = base.String()
+	}
+
+	if options != nil && (options.Compression != entry.CompressionNone || options.ChunkSize > 0) {
+		w := &chunkWriter{ds: ds, key: key, size: options.ChunkSize}
+		if err := writeSnapshotStream(w, snapshot, &c.Base, known, options); err != nil {
+			return err
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		c.Chunks = w.count
+	} else {
+		for _, e := range snapshot.Values {
+			if known != nil && known.Has(e.GetHash()) {
+				continue
+			}
+
+			data, err := entry.ToRawData(e)
+			if err != nil {
+				return errors.Wrap(err, "unable to encode entry")
+			}
+
+			c.Values = append(c.Values, &cborSnapshotEntry{Hash: e.GetHash(), Data: data})
+		}
+	}
+
+	data, err := cbornode.DumpObject(c)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode snapshot")
+	}
+
+	return ds.Put(key, data)
+}
+
+// readSnapshot reads the snapshot stored at key, along with its chunks
+func readSnapshot(ds datastore.Datastore, key datastore.Key) (*cborSnapshot, error) {
+	data, err := ds.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read snapshot")
+	}
+
+	c := &cborSnapshot{}
+	if err := cbornode.DecodeInto(data, c); err != nil {
+		return nil, errors.Wrap(err, "unable to decode snapshot")
+	}
+
+	if c.Chunks > 0 {
+		stream, err := readSnapshotStream(&chunkReader{ds: ds, key: key, count: c.Chunks})
+		if err != nil {
+			return nil, err
+		}
+
+		c.Values = stream.Values
+	}
+
+	return c, nil
+}
+
+// readSnapshotChain reads the snapshot stored at key followed by its bases,
+// the oldest one last
+func readSnapshotChain(ds datastore.Datastore, key datastore.Key) ([]*cborSnapshot, error) {
+	chain := []*cborSnapshot{}
+	seen := map[string]struct{}{}
+
+	for {
+		if _, ok := seen[key.String()]; ok {
+			return nil, errors.Errorf("snapshot %s is its own base", key)
+		}
+
+		seen[key.String()] = struct{}{}
+
+		c, err := readSnapshot(ds, key)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, c)
+
+		if c.Base == "" {
+			return chain, nil
+		}
+
+		key = datastore.NewKey(c.Base)
+	}
+}
+
+// LoadSnapshot reads a snapshot stored by SaveSnapshot or SaveDeltaSnapshot,
+// the provider is set on the identities of the decoded entries
+func LoadSnapshot(ds datastore.Datastore, key datastore.Key, provider identityprovider.Interface) (*Snapshot, error) {
+	if ds == nil {
+		return nil, errors.New("datastore is not defined")
+	}
+
+	chain, err := readSnapshotChain(ds, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot(chain, provider)
+}
+
+// decodeSnapshot merges the entries of a chain of snapshots, the newest one
+// first
+func decodeSnapshot(chain []*cborSnapshot, provider identityprovider.Interface) (*Snapshot, error) {
+	c := chain[0]
+	snapshot := &Snapshot{
+		ID:     c.ID,
+		Heads:  c.Heads,
+		Values: []iface.IPFSLogEntry{},
+	}
+
+	if c.Clock != nil {
+		clock, err := c.Clock.ToLamportClock()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode snapshot clock")
+		}
+
+		snapshot.Clock = clock
+	}
+
+	seen := cid.NewSet()
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, v := range chain[i].Values {
+			if !seen.Visit(v.Hash) {
+				continue
+			}
+
+			e, err := entry.FromRawData(v.Data, v.Hash, provider)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to decode entry")
+			}
+
+			snapshot.Values = append(snapshot.Values, e)
+		}
+	}
+
+	if len(chain) > 1 {
+		entry.Sort(entry.Compare, snapshot.Values)
+	}
+
+	return snapshot, nil
+}
+
+func chunkKey(key datastore.Key, i int) datastore.Key {
+	return key.ChildString(strconv.Itoa(i))
+}
+
+// chunkWriter stores the written data in values of at most size bytes
+type chunkWriter struct {
+	ds    datastore.Datastore
+	key   datastore.Key
+	size  int
+	buf   []byte
+	count int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for w.size > 0 && len(w.buf) >= w.size {
+		if err := w.put(w.buf[:w.size]); err != nil {
+			return 0, err
+		}
+
+		w.buf = w.buf[w.size:]
+	}
+
+	return len(p), nil
+}
+
+// Flush stores the remaining data
+func (w *chunkWriter) Flush() error {
+	if len(w.buf) == 0 && w.count > 0 {
+		return nil
+	}
+
+	err := w.put(w.buf)
+	w.buf = nil
+
+	return err
+}
+
+func (w *chunkWriter) put(data []byte) error {
+	chunk := make([]byte, len(data))
+	copy(chunk, data)
+
+	if err := w.ds.Put(chunkKey(w.key, w.count), chunk); err != nil {
+		return errors.Wrap(err, "unable to write snapshot chunk")
+	}
+
+	w.count++
+
+	return nil
+}
+
+// chunkReader reads the values stored by a chunkWriter one at a time
+type chunkReader struct {
+	ds    datastore.Datastore
+	key   datastore.Key
+	count int
+	next  int
+	buf   []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next == r.count {
+			return 0, goio.EOF
+		}
+
+		data, err := r.ds.Get(chunkKey(r.key, r.next))
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to read snapshot chunk")
+		}
+
+		r.buf = data
+		r.next++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+var atlasCborSnapshot = atlas.BuildEntry(cborSnapshot{}).
+	StructMap().
+	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+	AddField("Heads", atlas.StructMapEntry{SerialName: "heads"}).
+	AddField("Clock", atlas.StructMapEntry{SerialName: "clock"}).
+	AddField("Values", atlas.StructMapEntry{SerialName: "values"}).
+	AddField("Base", atlas.StructMapEntry{SerialName: "base", OmitEmpty: true}).
+	AddField("Chunks", atlas.StructMapEntry{SerialName: "chunks", OmitEmpty: true}).
+	Complete()
+
+var atlasCborSnapshotEntry = atlas.BuildEntry(cborSnapshotEntry{}).
+	StructMap().
+	AddField("Hash", atlas.StructMapEntry{SerialName: "hash"}).
+	AddField("Data", atlas.StructMapEntry{SerialName: "data"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(atlasCborSnapshot)
+	cbornode.RegisterCborType(atlasCborSnapshotEntry)
+}
@@ -0,0 +1,187 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	goio "io"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+)
+
+// SnapshotOptions defines how snapshots are serialized
+type SnapshotOptions struct {
+	// Compression is the algorithm used to compress the snapshot, see
+	// entry.CompressionGzip
+	Compression string
+
+	// ChunkSize is the maximum size in bytes of a datastore value, the
+	// snapshot is stored in a single value when 0
+	ChunkSize int
+}
+
+// WriteSnapshot streams the snapshot to w, entries are encoded one at a time
+// so the whole snapshot is never held in memory
+func WriteSnapshot(w goio.Writer, snapshot *Snapshot, options *SnapshotOptions) error {
+	if snapshot == nil {
+		return errmsg.EntriesNotDefined
+	}
+
+	return writeSnapshotStream(w, snapshot, nil, nil, options)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot, compression is
+// detected automatically
+func ReadSnapshot(r goio.Reader, provider identityprovider.Interface) (*Snapshot, error) {
+	c, err := readSnapshotStream(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot([]*cborSnapshot{c}, provider)
+}
+
+// ToSnapshotBuffer returns the snapshot of the log serialized by
+// WriteSnapshot
+func (l *Log) ToSnapshotBuffer(options *SnapshotOptions) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := WriteSnapshot(buf, l.ToSnapshot(), options); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeSnapshotStream writes a header section followed by a section for
+// each entry which isn't known
+func writeSnapshotStream(w goio.Writer, snapshot *Snapshot, base *string, known *cid.Set, options *SnapshotOptions) error {
+	if options == nil {
+		options = &SnapshotOptions{}
+	}
+
+	var closer goio.Closer
+
+	switch options.Compression {
+	case entry.CompressionNone:
+	case entry.CompressionGzip:
+		gw := gzip.NewWriter(w)
+		w, closer = gw, gw
+	default:
+		return errors.Errorf("unsupported snapshot compression: %s", options.Compression)
+	}
+
+	header := newCborSnapshot(snapshot)
+	if base != nil {
+		header.Base = *base
+	}
+
+	data, err := cbornode.DumpObject(header)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode snapshot")
+	}
+
+	if err := writeSection(w, data); err != nil {
+		return err
+	}
+
+	for _, e := range snapshot.Values {
+		if known != nil && known.Has(e.GetHash()) {
+			continue
+		}
+
+		raw, err := entry.ToRawData(e)
+		if err != nil {
+			return errors.Wrap(err, "unable to encode entry")
+		}
+
+		data, err := cbornode.DumpObject(&cborSnapshotEntry{Hash: e.GetHash(), Data: raw})
+		if err != nil {
+			return errors.Wrap(err, "unable to encode entry")
+		}
+
+		if err := writeSection(w, data); err != nil {
+			return err
+		}
+	}
+
+	if closer != nil {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// readSnapshotStream reads a snapshot written by writeSnapshotStream, the
+// entries are kept encoded
+func readSnapshotStream(r goio.Reader) (*cborSnapshot, error) {
+	br := bufio.NewReader(r)
+
+	// gzip streams start with 0x1f 0x8b, headers can't
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decompress snapshot")
+		}
+		defer gr.Close()
+
+		br = bufio.NewReader(gr)
+	}
+
+	data, err := readSection(br)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read snapshot")
+	}
+
+	c := &cborSnapshot{}
+	if err := cbornode.DecodeInto(data, c); err != nil {
+		return nil, errors.Wrap(err, "unable to decode snapshot")
+	}
+
+	for {
+		data, err := readSection(br)
+		if err == goio.EOF {
+			return c, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "unable to read snapshot")
+		}
+
+		v := &cborSnapshotEntry{}
+		if err := cbornode.DecodeInto(data, v); err != nil {
+			return nil, errors.Wrap(err, "unable to decode entry")
+		}
+
+		c.Values = append(c.Values, v)
+	}
+}
+
+func writeSection(w goio.Writer, data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+func readSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	if _, err := goio.ReadFull(r, data); err != nil {
+		return nil, errors.Wrap(err, "truncated snapshot")
+	}
+
+	return data, nil
+}
@@ -1,72 +1,37 @@
 package log // import "berty.tech/go-ipfs-log/log"
 
 import (
-	"bytes"
-	"errors"
-
-	"berty.tech/go-ipfs-log/entry"
-	"berty.tech/go-ipfs-log/utils/lamportclock"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/sorting"
 )
 
-func SortByClocks(a, b *entry.Entry, resolveConflict func(a *entry.Entry, b *entry.Entry) (int, error)) (int, error) {
-	diff := lamportclock.Compare(a.Clock, b.Clock)
-
-	if diff == 0 {
-		return resolveConflict(a, b)
-	}
+// The following helpers are kept for compatibility, see the sorting
+// package.
 
-	return diff, nil
+func SortByClocks(a, b iface.IPFSLogEntry, resolveConflict func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)) (int, error) {
+	return sorting.SortByClocks(a, b, resolveConflict)
 }
 
-func SortByClockId(a, b *entry.Entry, resolveConflict func(a *entry.Entry, b *entry.Entry) (int, error)) (int, error) {
-	comparedIDs := bytes.Compare(a.Clock.ID, b.Clock.ID)
-
-	if comparedIDs == 0 {
-		return resolveConflict(a, b)
-	}
-	if comparedIDs < 0 {
-		return -1, nil
-	}
-
-	return 1, nil
+func SortByClockId(a, b iface.IPFSLogEntry, resolveConflict func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)) (int, error) {
+	return sorting.SortByClockID(a, b, resolveConflict)
 }
 
-func First(a, b *entry.Entry) (int, error) {
-	return 1, nil
+func First(a, b iface.IPFSLogEntry) (int, error) {
+	return sorting.First(a, b)
 }
 
-func FirstWriteWins(a, b *entry.Entry) (int, error) {
-	res, err := LastWriteWins(a, b)
-
-	return res * -1, err
+func FirstWriteWins(a, b iface.IPFSLogEntry) (int, error) {
+	return sorting.FirstWriteWins(a, b)
 }
 
-func LastWriteWins(a, b *entry.Entry) (int, error) {
-	sortByID := func(a *entry.Entry, b *entry.Entry) (int, error) {
-		return SortByClockId(a, b, First)
-	}
-
-	sortByEntryClocks := func(a *entry.Entry, b *entry.Entry) (int, error) {
-		return SortByClocks(a, b, sortByID)
-	}
-
-	return sortByEntryClocks(a, b)
+func LastWriteWins(a, b iface.IPFSLogEntry) (int, error) {
+	return sorting.LastWriteWins(a, b)
 }
 
-func NoZeroes(compFunc func(a, b *entry.Entry) (int, error)) func(a, b *entry.Entry) (int, error) {
-	return func(a, b *entry.Entry) (int, error) {
-		ret, err := compFunc(a, b)
-		if ret != 0 || err != nil {
-			return ret, err
-		}
-
-		return 0, errors.New(`err: Your log's tiebreaker function has returned zero and therefore cannot be`)
-	}
+func NoZeroes(compFunc func(a, b iface.IPFSLogEntry) (int, error)) func(a, b iface.IPFSLogEntry) (int, error) {
+	return sorting.NoZeroes(compFunc)
 }
 
-func Reverse(a []*entry.Entry) {
-	for i := len(a)/2 - 1; i >= 0; i-- {
-		opp := len(a) - 1 - i
-		a[i], a[opp] = a[opp], a[i]
-	}
+func Reverse(a []iface.IPFSLogEntry) {
+	sorting.Reverse(a)
 }
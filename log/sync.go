@@ -0,0 +1,303 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// SyncEventType is the stage reached by an entry during a sync
+type SyncEventType string
+
+const (
+	// SyncQueued is sent when an entry is found missing
+	SyncQueued SyncEventType = "queued"
+
+	// SyncFetching is sent before an entry is fetched
+	SyncFetching SyncEventType = "fetching"
+
+	// SyncFetched is sent once an entry is fetched
+	SyncFetched SyncEventType = "fetched"
+
+	// SyncVerified is sent once the signature of an entry is verified
+	SyncVerified SyncEventType = "verified"
+
+	// SyncJoined is sent once an entry is joined into the log
+	SyncJoined SyncEventType = "joined"
+
+	// SyncFailed is sent when an entry can't be fetched, verified or
+	// joined, or belongs to another log, Err holds the reason
+	SyncFailed SyncEventType = "failed"
+)
+
+// SyncEvent reports the progress of an entry during a sync
+type SyncEvent struct {
+	Type SyncEventType
+	Hash cid.Cid
+	Err  error
+}
+
+// SyncOptions defines how SyncFromHeads fetches entries
+type SyncOptions struct {
+	// Timeout bounds the time spent fetching each entry, no timeout when 0
+	Timeout time.Duration
+
+	// MaxEntries fails the sync when more entries are missing, no limit
+	// when 0
+	MaxEntries int
+
+	// Events receives the progress of every missing entry, sends block
+	// until the event is read or the context is done
+	Events chan<- SyncEvent
+
+	// EntryLimiter bounds the number of entries fetched per second, it can
+	// be shared by several syncs
+	EntryLimiter *ratelimit.Limiter
+
+	// ByteLimiter bounds the number of entry and payload bytes fetched
+	// per second, it can be shared by several syncs
+	ByteLimiter *ratelimit.Limiter
+
+	// Concurrency is the number of entries fetched in parallel, entries
+	// are fetched one at a time when 0
+	Concurrency int
+
+	// Offline only reads local blocks, the sync fails with
+	// errmsg.BlockNotLocal when an entry is missing
+	Offline bool
+}
+
+// emit sends an event when a channel is set
+func (o *SyncOptions) emit(ctx context.Context, t SyncEventType, hash cid.Cid, err error) {
+	if o.Events == nil {
+		return
+	}
+
+	select {
+	case o.Events <- SyncEvent{Type: t, Hash: hash, Err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// SyncFromHeads fetches the entries reachable from the remote heads which
+// the log lacks, the traversal stops at the entries it already holds. The
+// fetched entries are verified and joined, they are returned in the order
+// they were fetched. Denied entries are skipped.
+func (l *Log) SyncFromHeads(ctx context.Context, heads []cid.Cid, options *SyncOptions) ([]iface.IPFSLogEntry, error) {
+	if options == nil {
+		options = &SyncOptions{}
+	}
+
+	fetched := entry.NewOrderedMap()
+	remoteHeads := []iface.IPFSLogEntry{}
+	queue := []cid.Cid{}
+	seen := cid.NewSet()
+
+	// Denied entries are never fetched
+	enqueue := func(h cid.Cid) {
+		if l.has(h) || !seen.Visit(h) {
+			return
+		}
+
+		if l.deniesEntry(h) {
+			options.emit(ctx, SyncFailed, h, errmsg.EntryDenied)
+			return
+		}
+
+		queue = append(queue, h)
+		options.emit(ctx, SyncQueued, h, nil)
+	}
+
+	for _, h := range heads {
+		enqueue(h)
+	}
+
+	isHead := cid.NewSet()
+	for _, h := range queue {
+		isHead.Add(h)
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "sync failed")
+		}
+
+		batch := queue
+		if len(batch) > concurrency {
+			batch = batch[:concurrency]
+		}
+		queue = queue[len(batch):]
+
+		for i, hash := range batch {
+			if options.MaxEntries > 0 && fetched.Len()+i >= options.MaxEntries {
+				err := errors.Errorf("more than %d entries are missing", options.MaxEntries)
+				options.emit(ctx, SyncFailed, hash, err)
+				return nil, errors.Wrap(err, "sync failed")
+			}
+
+			if err := options.EntryLimiter.Wait(ctx); err != nil {
+				return nil, errors.Wrap(err, "sync failed")
+			}
+
+			options.emit(ctx, SyncFetching, hash, nil)
+		}
+
+		results := l.fetchBatch(ctx, batch, options)
+
+		for i, hash := range batch {
+			e, size, err := results[i].entry, results[i].size, results[i].err
+			if err != nil {
+				options.emit(ctx, SyncFailed, hash, err)
+				return nil, errors.Wrapf(err, "sync failed: unable to fetch entry %s", hash)
+			}
+
+			// The size is only known once fetched, the next batch waits
+			if err := options.ByteLimiter.WaitN(ctx, size); err != nil {
+				return nil, errors.Wrap(err, "sync failed")
+			}
+
+			options.emit(ctx, SyncFetched, hash, nil)
+
+			if e.GetLogID() != l.ID {
+				options.emit(ctx, SyncFailed, hash, errors.Wrapf(errmsg.WrongLog, "entry belongs to log %s instead of %s", e.GetLogID(), l.ID))
+				continue
+			}
+
+			// The parents of entries from denied authors are only reached
+			// through other entries
+			if entry.IsDenied(l.denylist, e) {
+				options.emit(ctx, SyncFailed, hash, errmsg.EntryDenied)
+				continue
+			}
+
+			// Verified before fetching its parents, Join doesn't check it again
+			if err := e.Verify(l.Identity.Provider); err != nil {
+				options.emit(ctx, SyncFailed, hash, err)
+				return nil, errors.Wrap(err, "sync failed: unable to check signature")
+			}
+
+			options.emit(ctx, SyncVerified, hash, nil)
+
+			fetched.Put(e)
+			if isHead.Has(hash) {
+				remoteHeads = append(remoteHeads, e)
+			}
+
+			for _, n := range e.GetNext() {
+				enqueue(n)
+			}
+		}
+	}
+
+	if fetched.Len() == 0 {
+		return nil, nil
+	}
+
+	failAll := func(err error) error {
+		for _, e := range fetched.Slice() {
+			options.emit(ctx, SyncFailed, e.GetHash(), err)
+		}
+
+		return errors.Wrap(err, "sync failed")
+	}
+
+	if l.strictValidation {
+		if err := validateEntries(fetched.Slice(), l.ID, l.Identity.Provider, l.revocations); err != nil {
+			return nil, failAll(err)
+		}
+	}
+
+	other, err := NewLog(l.Storage, l.Identity, &NewLogOptions{
+		ID:               l.ID,
+		AccessController: l.AccessController,
+		Entries:          fetched,
+		OwnEntries:       true,
+		Heads:            remoteHeads,
+	})
+	if err != nil {
+		return nil, failAll(err)
+	}
+
+	if _, err := l.join(other, -1, true); err != nil {
+		return nil, failAll(err)
+	}
+
+	for _, e := range fetched.Slice() {
+		options.emit(ctx, SyncJoined, e.GetHash(), nil)
+	}
+
+	return fetched.Slice(), nil
+}
+
+type fetchResult struct {
+	entry iface.IPFSLogEntry
+	size  int
+	err   error
+}
+
+// fetchBatch fetches the entries in parallel
+func (l *Log) fetchBatch(ctx context.Context, hashes []cid.Cid, options *SyncOptions) []fetchResult {
+	results := make([]fetchResult, len(hashes))
+
+	wg := sync.WaitGroup{}
+	for i, hash := range hashes {
+		wg.Add(1)
+
+		go func(i int, hash cid.Cid) {
+			defer wg.Done()
+
+			e, size, err := l.fetchContext(ctx, hash, options.Timeout, options.Offline)
+			results[i] = fetchResult{entry: e, size: size, err: err}
+		}(i, hash)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// fetchContext fetches an entry, giving up after the timeout when it isn't
+// 0, the number of bytes fetched for the entry and its payload is returned
+func (l *Log) fetchContext(ctx context.Context, hash cid.Cid, timeout time.Duration, offline bool) (iface.IPFSLogEntry, int, error) {
+	services := fetchServices(l.Storage, offline)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	nd, err := io.ReadCBORContext(ctx, services, hash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e, err := entry.FromRawData(nd.RawData(), hash, l.Identity.Provider)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := entry.ResolvePayloadContext(ctx, services, e); err != nil {
+		return nil, 0, err
+	}
+
+	size := len(nd.RawData())
+	if e.GetPayloadRef().Defined() {
+		size += len(e.GetPayload())
+	}
+
+	return e, size, nil
+}
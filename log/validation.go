@@ -0,0 +1,99 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"fmt"
+	"strings"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// ValidationFailure describes why an entry failed validation
+type ValidationFailure struct {
+	Hash cid.Cid
+	Err  error
+}
+
+// ValidationError is returned when entries of a log loaded with
+// StrictValidation are invalid, its cause is errmsg.ValidationFailed
+type ValidationError struct {
+	Failures []ValidationFailure
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{fmt.Sprintf("%s: %d invalid entries", errmsg.ValidationFailed, len(e.Failures))}
+	for _, f := range e.Failures {
+		lines = append(lines, fmt.Sprintf("%s: %s", f.Hash, f.Err))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) Cause() error {
+	return errmsg.ValidationFailed
+}
+
+func (e *ValidationError) Unwrap() error {
+	return errmsg.ValidationFailed
+}
+
+// accessDenied returns the error of an access controller with the
+// errmsg.AccessDenied class unless it already has a class
+func accessDenied(err error) error {
+	var class errmsg.Error
+	if errors.As(err, &class) {
+		return err
+	}
+
+	return errors.Wrap(errmsg.AccessDenied, err.Error())
+}
+
+// validateEntries checks the signature, identity, log ID, clock and
+// revocation of each entry, logID and revocations aren't checked when empty
+func validateEntries(entries []iface.IPFSLogEntry, logID string, provider identityprovider.Interface, revocations accesscontroller.RevocationChecker) error {
+	report := &ValidationError{}
+	index := entry.NewOrderedMapFromEntries(entries)
+
+	for _, e := range entries {
+		fail := func(err error) {
+			report.Failures = append(report.Failures, ValidationFailure{Hash: e.GetHash(), Err: err})
+		}
+
+		if err := e.Verify(provider); err != nil {
+			fail(err)
+		}
+
+		if err := entry.VerifyIdentity(e, provider); err != nil {
+			fail(err)
+		}
+
+		if revocations != nil {
+			if err := revocations.CheckRevocation(e); err != nil {
+				fail(err)
+			}
+		}
+
+		if logID != "" && e.GetLogID() != logID {
+			fail(fmt.Errorf("entry belongs to log %s instead of %s", e.GetLogID(), logID))
+		}
+
+		for _, next := range e.GetNext() {
+			if parent, ok := index.GetCID(next); ok {
+				if err := entry.CheckClock(e, parent); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}
+
+	if len(report.Failures) > 0 {
+		return report
+	}
+
+	return nil
+}
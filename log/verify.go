@@ -0,0 +1,79 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// verifyPool verifies entry signatures using a bounded number of workers,
+// the context is canceled on the first failure
+type verifyPool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   chan iface.IPFSLogEntry
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+func newVerifyPool(ctx context.Context, provider identityprovider.Interface, workers int) *verifyPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &verifyPool{
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(chan iface.IPFSLogEntry),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+
+			for e := range p.jobs {
+				if err := e.Verify(provider); err != nil {
+					p.fail(err)
+				}
+			}
+		}()
+	}
+
+	return p
+}
+
+func (p *verifyPool) fail(err error) {
+	p.once.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+// Context returns a context canceled when a verification fails
+func (p *verifyPool) Context() context.Context {
+	return p.ctx
+}
+
+// Verify queues an entry, it blocks while all workers are busy
+func (p *verifyPool) Verify(e iface.IPFSLogEntry) {
+	select {
+	case p.jobs <- e:
+	case <-p.ctx.Done():
+	}
+}
+
+// Wait waits for the queued entries to be verified and returns the first
+// error
+func (p *verifyPool) Wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	p.cancel()
+
+	return p.err
+}
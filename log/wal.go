@@ -0,0 +1,211 @@
+package log // import "berty.tech/go-ipfs-log/log"
+
+import (
+	"context"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// WAL records the blocks of the appended entries in a local datastore
+// before they are written to IPFS, so the entries signed before a crash
+// can be recovered, see Log.Recover
+type WAL struct {
+	Datastore datastore.Datastore
+
+	// Key prefixes the records, /wal/<log ID> when empty
+	Key datastore.Key
+
+	// Async returns from the appends once their entries are recorded,
+	// the blocks are written to IPFS in the background, see Log.Flush.
+	// Appends are synchronous when the log has a Stamper.
+	Async bool
+}
+
+// cborWALRecord holds the blocks written by an append
+type cborWALRecord struct {
+	Entries []cid.Cid
+	Blocks  []*cborSnapshotEntry
+}
+
+func (w *WAL) prefix(id string) datastore.Key {
+	if k := w.Key.String(); k != "" && k != "/" {
+		return w.Key
+	}
+
+	return datastore.NewKey("wal").Child(datastore.NewKey(id))
+}
+
+// write records the entries and the blocks holding them, it returns the
+// key of the record
+func (w *WAL) write(id string, entries []iface.IPFSLogEntry, blks []blocks.Block) (datastore.Key, error) {
+	c := &cborWALRecord{
+		Entries: entrySliceToCids(entries),
+		Blocks:  make([]*cborSnapshotEntry, 0, len(blks)),
+	}
+
+	for _, b := range blks {
+		c.Blocks = append(c.Blocks, &cborSnapshotEntry{Hash: b.Cid(), Data: b.RawData()})
+	}
+
+	data, err := cbornode.DumpObject(c)
+	if err != nil {
+		return datastore.Key{}, errors.Wrap(err, "unable to encode WAL record")
+	}
+
+	key := w.prefix(id).ChildString(io.CIDString(c.Entries[len(c.Entries)-1]))
+	if err := w.Datastore.Put(key, data); err != nil {
+		return datastore.Key{}, errors.Wrap(err, "unable to write WAL record")
+	}
+
+	return key, nil
+}
+
+// records returns the records of the log by key
+func (w *WAL) records(id string) (map[datastore.Key]*cborWALRecord, error) {
+	results, err := w.Datastore.Query(query.Query{Prefix: w.prefix(id).String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list WAL records")
+	}
+	defer results.Close()
+
+	records := map[datastore.Key]*cborWALRecord{}
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, errors.Wrap(r.Error, "unable to list WAL records")
+		}
+
+		c := &cborWALRecord{}
+		if err := cbornode.DecodeInto(r.Value, c); err != nil {
+			return nil, errors.Wrap(err, "unable to decode WAL record")
+		}
+
+		records[datastore.NewKey(r.Key)] = c
+	}
+
+	return records, nil
+}
+
+// Recover writes to IPFS the blocks of the entries recorded in the WAL and
+// joins the entries the log doesn't have, the recovered entries are
+// returned. It is run by NewLog, after a crash the entries acknowledged by
+// an async append or signed before their blocks were written are then
+// added back to the log.
+func (l *Log) Recover() ([]iface.IPFSLogEntry, error) {
+	if l.wal == nil {
+		return nil, nil
+	}
+
+	if err := l.Flush(); err != nil {
+		return nil, err
+	}
+
+	records, err := l.wal.records(l.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	recovered := []iface.IPFSLogEntry{}
+	for _, r := range records {
+		blks := make([]blocks.Block, 0, len(r.Blocks))
+		for _, b := range r.Blocks {
+			blk, err := blocks.NewBlockWithCid(b.Data, b.Hash)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid WAL block")
+			}
+
+			blks = append(blks, blk)
+		}
+
+		if err := io.WriteBlocks(context.Background(), l.Storage, blks); err != nil {
+			return nil, errors.Wrap(err, "unable to write WAL blocks")
+		}
+
+		for _, h := range r.Entries {
+			if l.has(h) {
+				continue
+			}
+
+			e, err := l.fetch(h)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to read WAL entry")
+			}
+
+			if l.pin {
+				if err := l.pinEntry(e); err != nil {
+					return nil, err
+				}
+			}
+
+			recovered = append(recovered, e)
+		}
+	}
+
+	if len(recovered) > 0 {
+		other, err := NewLog(l.Storage, l.Identity, &NewLogOptions{
+			ID:               l.ID,
+			AccessController: l.accessController,
+			Entries:          entry.NewOrderedMapFromEntries(recovered),
+			OwnEntries:       true,
+			SortFn:           l.SortFn,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := l.Join(other, -1); err != nil {
+			return nil, errors.Wrap(err, "unable to join WAL entries")
+		}
+	}
+
+	for key := range records {
+		if err := l.wal.Datastore.Delete(key); err != nil {
+			return nil, errors.Wrap(err, "unable to delete WAL record")
+		}
+	}
+
+	return recovered, nil
+}
+
+// Flush waits for the blocks of the async appends to be written, it
+// returns the first error since the last call. Their entries stay in the
+// WAL when the write fails.
+func (l *Log) Flush() error {
+	l.writes.Wait()
+
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	err := l.writeErr
+	l.writeErr = nil
+
+	return err
+}
+
+// writeFailed keeps the first error of the async appends
+func (l *Log) writeFailed(err error) {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+
+	if l.writeErr == nil {
+		l.writeErr = err
+	}
+}
+
+var atlasCborWALRecord = atlas.BuildEntry(cborWALRecord{}).
+	StructMap().
+	AddField("Entries", atlas.StructMapEntry{SerialName: "entries"}).
+	AddField("Blocks", atlas.StructMapEntry{SerialName: "blocks"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(atlasCborWALRecord)
+}
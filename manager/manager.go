@@ -0,0 +1,237 @@
+// Package manager opens and tracks many logs sharing the same services,
+// identity and replication settings
+package manager // import "berty.tech/go-ipfs-log/manager"
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/replicator"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/pkg/errors"
+)
+
+// Options defines how the logs are opened
+type Options struct {
+	// LogOptions is the template of the options of every opened log, its
+	// ID, name and access controller are set by Open
+	LogOptions *log.NewLogOptions
+
+	// HeadsStore keeps the heads of the open logs under their address, the
+	// logs are reopened from their heads, see log.NewFromHeadsIndex. The
+	// logs are created empty when nil.
+	HeadsStore datastore.Datastore
+
+	// Replication starts a replicator with these options, shared by the
+	// open logs, the sources are asked for the heads of each log ID
+	Replication *replicator.Options
+}
+
+// Logs opens logs by address and caches them, opening an address twice
+// returns the same log. The logs share the services, the identity and its
+// verification cache.
+type Logs struct {
+	services   io.IpfsServices
+	identity   *identityprovider.Identity
+	options    Options
+	replicator *replicator.Replicator
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	lock   sync.Mutex
+	logs   map[string]*log.Log
+	closed bool
+}
+
+// New creates a manager opening logs with the services and identity
+func New(services io.IpfsServices, identity *identityprovider.Identity, options *Options) (*Logs, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	if identity == nil {
+		return nil, errmsg.IdentityNotDefined
+	}
+
+	if options == nil {
+		options = &Options{}
+	}
+
+	m := &Logs{
+		services: services,
+		identity: identity,
+		options:  *options,
+		logs:     map[string]*log.Log{},
+	}
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	if options.Replication != nil {
+		m.replicator = replicator.New(options.Replication)
+		m.replicator.Start(m.ctx)
+	}
+
+	return m, nil
+}
+
+// Create opens the log with the name and access controller, see
+// log.NewAddress. The log must only be modified through Do.
+func (m *Logs) Create(name string, ac accesscontroller.Interface) (*log.Log, error) {
+	addr, err := log.NewAddress(name, ac)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.open(addr, ac)
+}
+
+// Open opens the log with the address, the access controller must be the
+// one the address was derived from. The cached log is returned when the
+// address is already open. The log must only be modified through Do, the
+// replicator may be joining entries into it otherwise.
+func (m *Logs) Open(address string, ac accesscontroller.Interface) (*log.Log, error) {
+	if err := log.VerifyAddress(address, ac); err != nil {
+		return nil, err
+	}
+
+	addr, err := log.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.open(addr, ac)
+}
+
+func (m *Logs) open(addr log.Address, ac accesscontroller.Interface) (*log.Log, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, errmsg.LogsClosed
+	}
+
+	if l, ok := m.logs[addr.String()]; ok {
+		return l, nil
+	}
+
+	options := log.NewLogOptions{}
+	if m.options.LogOptions != nil {
+		options = *m.options.LogOptions
+	}
+
+	options.ID = addr.String()
+	options.Name = addr.Name
+	options.AccessController = ac
+
+	var (
+		l   *log.Log
+		err error
+	)
+
+	if m.options.HeadsStore != nil {
+		l, err = log.NewFromHeadsIndex(m.services, m.identity, &log.HeadsIndex{Datastore: m.options.HeadsStore}, &options)
+	} else {
+		l, err = log.NewLog(m.services, m.identity, &options)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open log %s", addr)
+	}
+
+	if m.replicator != nil {
+		m.replicator.Add(l)
+	}
+
+	m.logs[addr.String()] = l
+
+	return l, nil
+}
+
+// Get returns the open log with the address
+func (m *Logs) Get(address string) (*log.Log, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	l, ok := m.logs[address]
+
+	return l, ok
+}
+
+// Addresses returns the sorted addresses of the open logs
+func (m *Logs) Addresses() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	addresses := make([]string, 0, len(m.logs))
+	for a := range m.logs {
+		addresses = append(addresses, a)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// Do calls fn with the open log while the replicator doesn't modify it
+func (m *Logs) Do(address string, fn func(l *log.Log) error) error {
+	m.lock.Lock()
+	l, ok := m.logs[address]
+	m.lock.Unlock()
+
+	if !ok {
+		return errors.Wrapf(errmsg.LogNotOpen, "%s", address)
+	}
+
+	if m.replicator == nil {
+		return fn(l)
+	}
+
+	return m.replicator.Do(address, fn)
+}
+
+// VerificationCache returns the cache of verified signatures shared by the
+// logs
+func (m *Logs) VerificationCache() *entry.VerificationCache {
+	return entry.VerificationCacheFor(m.identity.Provider)
+}
+
+// CloseLog stops the replication of the log and forgets it, opening its
+// address again creates a new log
+func (m *Logs) CloseLog(address string) error {
+	m.lock.Lock()
+	_, ok := m.logs[address]
+	delete(m.logs, address)
+	m.lock.Unlock()
+
+	if !ok {
+		return errors.Wrapf(errmsg.LogNotOpen, "%s", address)
+	}
+
+	if m.replicator != nil {
+		m.replicator.Remove(address)
+	}
+
+	return nil
+}
+
+// Close closes every log, the manager can't open logs anymore
+func (m *Logs) Close() error {
+	m.lock.Lock()
+	m.logs = map[string]*log.Log{}
+	m.closed = true
+	m.lock.Unlock()
+
+	m.cancel()
+
+	if m.replicator != nil {
+		return m.replicator.Close()
+	}
+
+	return nil
+}
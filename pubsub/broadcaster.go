@@ -0,0 +1,230 @@
+// Package pubsub announces the heads of logs to their peers
+package pubsub // import "berty.tech/go-ipfs-log/pubsub"
+
+import (
+	"context"
+	"sync"
+
+	"berty.tech/go-ipfs-log/log"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
+)
+
+// HeadsHandler is called with the heads announced by a peer
+type HeadsHandler func(from peer.ID, heads *log.JSONLog)
+
+// BroadcasterOptions defines how heads are announced
+type BroadcasterOptions struct {
+	// Topic is the pubsub topic of the log, the ID of the log when empty
+	Topic string
+
+	// Self is the ID of the local peer, its own announcements are ignored
+	Self peer.ID
+
+	// OnError is called when an announcement can't be published or
+	// decoded, errors are dropped when nil
+	OnError func(err error)
+}
+
+// Broadcaster publishes the heads of a log, as a CBOR encoded JSONLog, each
+// time entries are appended or joined and hands the heads announced by other
+// peers on the same topic to a handler. Heads are published in the
+// background so appends don't wait for pubsub, only the latest heads are
+// published when they change faster than they can be published.
+type Broadcaster struct {
+	api     coreiface.PubSubAPI
+	log     *log.Log
+	topic   string
+	self    peer.ID
+	onHeads HeadsHandler
+	onError func(err error)
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	sub         coreiface.PubSubSubscription
+	unsubscribe func()
+	pending     chan []byte
+	done        chan struct{}
+	published   chan struct{}
+	once        sync.Once
+}
+
+// NewBroadcaster subscribes to the topic of the log and starts announcing its
+// heads, Close stops it
+func NewBroadcaster(ctx context.Context, api coreiface.PubSubAPI, l *log.Log, onHeads HeadsHandler, options *BroadcasterOptions) (*Broadcaster, error) {
+	if api == nil {
+		return nil, errors.New("pubsub api is not defined")
+	}
+
+	if l == nil {
+		return nil, errors.New("log is not defined")
+	}
+
+	if options == nil {
+		options = &BroadcasterOptions{}
+	}
+
+	topic := options.Topic
+	if topic == "" {
+		topic = l.ID
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	sub, err := api.Subscribe(ctx, topic)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "unable to subscribe to the log topic")
+	}
+
+	b := &Broadcaster{
+		api:       api,
+		log:       l,
+		topic:     topic,
+		self:      options.Self,
+		onHeads:   onHeads,
+		onError:   options.OnError,
+		ctx:       ctx,
+		cancel:    cancel,
+		sub:       sub,
+		pending:   make(chan []byte, 1),
+		done:      make(chan struct{}),
+		published: make(chan struct{}),
+	}
+
+	b.unsubscribe = l.OnUpdate(func(l *log.Log) {
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		// The heads are encoded while the log isn't modified
+		data, err := encodeHeads(l)
+		if err != nil {
+			b.error(err)
+			return
+		}
+
+		b.queue(data)
+	})
+
+	go b.listen()
+	go b.publish()
+
+	return b, nil
+}
+
+// Topic returns the pubsub topic heads are announced on
+func (b *Broadcaster) Topic() string {
+	return b.topic
+}
+
+// Announce publishes the current heads of the log
+func (b *Broadcaster) Announce(ctx context.Context) error {
+	if b.ctx.Err() != nil {
+		return errors.New("broadcaster is closed")
+	}
+
+	data, err := encodeHeads(b.log)
+	if err != nil {
+		return err
+	}
+
+	if err := b.api.Publish(ctx, b.topic, data); err != nil {
+		return errors.Wrap(err, "unable to publish heads")
+	}
+
+	return nil
+}
+
+func encodeHeads(l *log.Log) ([]byte, error) {
+	data, err := cbornode.DumpObject(l.ToJSON())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode heads")
+	}
+
+	return data, nil
+}
+
+// queue replaces the heads waiting to be published
+func (b *Broadcaster) queue(data []byte) {
+	for {
+		select {
+		case b.pending <- data:
+			return
+		default:
+		}
+
+		select {
+		case <-b.pending:
+		default:
+		}
+	}
+}
+
+func (b *Broadcaster) publish() {
+	defer close(b.published)
+
+	for {
+		select {
+		case data := <-b.pending:
+			if err := b.api.Publish(b.ctx, b.topic, data); err != nil && b.ctx.Err() == nil {
+				b.error(errors.Wrap(err, "unable to publish heads"))
+			}
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops announcing heads and unsubscribes from the topic
+func (b *Broadcaster) Close() error {
+	var err error
+
+	b.once.Do(func() {
+		b.unsubscribe()
+		b.cancel()
+		err = b.sub.Close()
+		<-b.done
+		<-b.published
+	})
+
+	return err
+}
+
+func (b *Broadcaster) listen() {
+	defer close(b.done)
+
+	for {
+		msg, err := b.sub.Next(b.ctx)
+		if err != nil {
+			if b.ctx.Err() == nil {
+				b.error(errors.Wrap(err, "unable to read announcement"))
+			}
+			return
+		}
+
+		if b.self != "" && msg.From() == b.self {
+			continue
+		}
+
+		heads := &log.JSONLog{}
+		if err := cbornode.DecodeInto(msg.Data(), heads); err != nil {
+			b.error(errors.Wrap(err, "unable to decode announcement"))
+			continue
+		}
+
+		if heads.ID != b.log.ID || b.onHeads == nil {
+			continue
+		}
+
+		b.onHeads(msg.From(), heads)
+	}
+}
+
+func (b *Broadcaster) error(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
@@ -0,0 +1,46 @@
+package pubsub // import "berty.tech/go-ipfs-log/pubsub"
+
+import (
+	"context"
+	"sync"
+
+	"berty.tech/go-ipfs-log/log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// HeadsCache keeps the last heads announced by each peer, its Add method is
+// a HeadsHandler and it can be used as a replicator.HeadSource
+type HeadsCache struct {
+	lock  sync.Mutex
+	heads map[string]map[peer.ID]*log.JSONLog
+}
+
+// NewHeadsCache creates an empty cache
+func NewHeadsCache() *HeadsCache {
+	return &HeadsCache{heads: map[string]map[peer.ID]*log.JSONLog{}}
+}
+
+// Add records the heads announced by a peer, replacing its previous ones
+func (c *HeadsCache) Add(from peer.ID, heads *log.JSONLog) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.heads[heads.ID]; !ok {
+		c.heads[heads.ID] = map[peer.ID]*log.JSONLog{}
+	}
+
+	c.heads[heads.ID][from] = heads
+}
+
+// Heads returns the last heads announced by each peer for the log
+func (c *HeadsCache) Heads(ctx context.Context, id string) ([]*log.JSONLog, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	heads := []*log.JSONLog{}
+	for _, h := range c.heads[id] {
+		heads = append(heads, h)
+	}
+
+	return heads, nil
+}
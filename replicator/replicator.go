@@ -0,0 +1,404 @@
+// Package replicator keeps logs up to date with the heads known by peers
+package replicator // import "berty.tech/go-ipfs-log/replicator"
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// DefaultInterval is the time between two reconciliations when none is set
+const DefaultInterval = 30 * time.Second
+
+// HeadSource returns the heads of the log with the given ID known by peers,
+// see pubsub.HeadsCache
+type HeadSource interface {
+	Heads(ctx context.Context, id string) ([]*log.JSONLog, error)
+}
+
+// HeadSourceFunc is a function implementing HeadSource
+type HeadSourceFunc func(ctx context.Context, id string) ([]*log.JSONLog, error)
+
+// Heads calls the function
+func (f HeadSourceFunc) Heads(ctx context.Context, id string) ([]*log.JSONLog, error) {
+	return f(ctx, id)
+}
+
+// StaticSource always returns the same heads, such as the heads of a
+// manifest shared out of band
+type StaticSource []*log.JSONLog
+
+// Heads returns the heads of the log with the given ID
+func (s StaticSource) Heads(ctx context.Context, id string) ([]*log.JSONLog, error) {
+	heads := []*log.JSONLog{}
+	for _, h := range s {
+		if h.ID == id {
+			heads = append(heads, h)
+		}
+	}
+
+	return heads, nil
+}
+
+// Progress describes the result of a reconciliation with the heads of a
+// source
+type Progress struct {
+	// ID is the ID of the log
+	ID string
+
+	// Round is the number of the reconciliation, starting at 1
+	Round int
+
+	// Heads are the remote heads missing from the log which were fetched
+	Heads []cid.Cid
+
+	// Added is the number of entries joined into the log
+	Added int
+}
+
+// EventType is the kind of a replication event
+type EventType string
+
+const (
+	// EventRoundStarted is sent when a reconciliation starts
+	EventRoundStarted EventType = "round-started"
+
+	// EventRoundFinished is sent when a reconciliation ends, Err holds
+	// its first error
+	EventRoundFinished EventType = "round-finished"
+
+	// EventEntry reports the progress of a missing entry, see Entry
+	EventEntry EventType = "entry"
+)
+
+// Event reports the state of the replication
+type Event struct {
+	Type  EventType
+	Round int
+	Time  time.Time
+
+	// LogID is the ID of the log for EventEntry
+	LogID string
+
+	// Entry is the progress of the entry for EventEntry
+	Entry log.SyncEvent
+
+	// Err is the first error of the round for EventRoundFinished
+	Err error
+}
+
+// Options defines how the logs are replicated
+type Options struct {
+	// Sources provide the heads of the logs known by peers
+	Sources []HeadSource
+
+	// Interval is the time between two reconciliations, DefaultInterval
+	// when 0
+	Interval time.Duration
+
+	// FetchTimeout bounds the time spent fetching each entry, no timeout
+	// when 0
+	FetchTimeout time.Duration
+
+	// OnProgress is called after remote heads are joined into the log
+	OnProgress func(p Progress)
+
+	// OnConflict is called with the heads of the log when a reconciliation
+	// leaves it with concurrent heads
+	OnConflict func(heads []iface.IPFSLogEntry)
+
+	// OnError is called when heads can't be listed, fetched or joined
+	OnError func(err error)
+
+	// Events receives the progress of every round and missing entry,
+	// sends block until the event is read or the replication stops
+	Events chan<- Event
+
+	// EntryLimiter and ByteLimiter bound the entries and bytes fetched per
+	// second, see log.SyncOptions
+	EntryLimiter *ratelimit.Limiter
+	ByteLimiter  *ratelimit.Limiter
+}
+
+// Replicator periodically fetches the heads its sources know and its logs
+// lack, and joins them into the logs. Several logs can share a replicator,
+// they are reconciled one after the other. The logs must not be modified
+// while they are added to the replicator, except through Do.
+type Replicator struct {
+	options Options
+
+	lock   sync.Mutex
+	logs   map[string]*replicatedLog
+	round  int
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// replicatedLog is a log of the replicator, the lock is held while it is
+// modified
+type replicatedLog struct {
+	log     *log.Log
+	lock    sync.Mutex
+	removed bool
+}
+
+// New creates a replicator for the given logs, more can be added with Add.
+// Start runs it in the background.
+func New(options *Options, logs ...*log.Log) *Replicator {
+	if options == nil {
+		options = &Options{}
+	}
+
+	r := &Replicator{
+		options: *options,
+		logs:    map[string]*replicatedLog{},
+	}
+
+	if r.options.Interval <= 0 {
+		r.options.Interval = DefaultInterval
+	}
+
+	for _, l := range logs {
+		r.Add(l)
+	}
+
+	return r
+}
+
+// Add replicates the log, replacing any log with the same ID
+func (r *Replicator) Add(l *log.Log) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.logs[l.ID] = &replicatedLog{log: l}
+}
+
+// Remove stops replicating the log with the given ID, it returns once the
+// log isn't modified by the replicator anymore
+func (r *Replicator) Remove(id string) {
+	r.lock.Lock()
+	rl, ok := r.logs[id]
+	delete(r.logs, id)
+	r.lock.Unlock()
+
+	if ok {
+		rl.lock.Lock()
+		rl.removed = true
+		rl.lock.Unlock()
+	}
+}
+
+// Start reconciles the log at every interval until the context is done or
+// Close is called
+func (r *Replicator) Start(ctx context.Context) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(r.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			_ = r.Reconcile(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(r.done)
+}
+
+// Close stops the background reconciliation and waits for it to return
+func (r *Replicator) Close() error {
+	r.lock.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.lock.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	return nil
+}
+
+// Do calls fn with the log with the given ID while no reconciliation
+// modifies it
+func (r *Replicator) Do(id string, fn func(l *log.Log) error) error {
+	r.lock.Lock()
+	rl, ok := r.logs[id]
+	r.lock.Unlock()
+
+	if !ok {
+		return errors.Errorf("unknown log %s", id)
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	return fn(rl.log)
+}
+
+// Reconcile fetches and joins the missing heads of every log from every
+// source once, the first error is returned after every log is processed
+func (r *Replicator) Reconcile(ctx context.Context) error {
+	r.lock.Lock()
+	r.round++
+	round := r.round
+	logs := make([]*replicatedLog, 0, len(r.logs))
+	for _, rl := range r.logs {
+		logs = append(logs, rl)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].log.ID < logs[j].log.ID
+	})
+
+	r.emit(ctx, Event{Type: EventRoundStarted, Round: round})
+
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if r.options.OnError != nil {
+			r.options.OnError(err)
+		}
+	}
+
+	defer func() {
+		r.emit(ctx, Event{Type: EventRoundFinished, Round: round, Err: firstErr})
+	}()
+
+	for _, rl := range logs {
+		for _, source := range r.options.Sources {
+			if err := ctx.Err(); err != nil {
+				firstErr = err
+				return err
+			}
+
+			remotes, err := source.Heads(ctx, rl.log.ID)
+			if err != nil {
+				fail(errors.Wrapf(err, "unable to list heads of %s", rl.log.ID))
+				continue
+			}
+
+			for _, remote := range remotes {
+				if err := r.reconcile(ctx, round, rl, remote); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// reconcile joins the heads of the remote log which the log lacks
+func (r *Replicator) reconcile(ctx context.Context, round int, rl *replicatedLog, remote *log.JSONLog) error {
+	l := rl.log
+	if remote == nil || remote.ID != l.ID {
+		return nil
+	}
+
+	rl.lock.Lock()
+	if rl.removed {
+		rl.lock.Unlock()
+		return nil
+	}
+
+	missing := []cid.Cid{}
+	for _, h := range remote.Heads {
+		if !l.Has(h) {
+			missing = append(missing, h)
+		}
+	}
+
+	var added []iface.IPFSLogEntry
+	var heads []iface.IPFSLogEntry
+	var err error
+
+	if len(missing) > 0 {
+		options := &log.SyncOptions{
+			Timeout:      r.options.FetchTimeout,
+			EntryLimiter: r.options.EntryLimiter,
+			ByteLimiter:  r.options.ByteLimiter,
+		}
+
+		var forwarded chan struct{}
+		if r.options.Events != nil {
+			events := make(chan log.SyncEvent)
+			forwarded = make(chan struct{})
+			options.Events = events
+
+			go func() {
+				defer close(forwarded)
+				for e := range events {
+					r.emit(ctx, Event{Type: EventEntry, Round: round, LogID: l.ID, Entry: e})
+				}
+			}()
+
+			defer func() {
+				close(events)
+				<-forwarded
+			}()
+		}
+
+		added, err = l.SyncFromHeads(ctx, missing, options)
+		heads = l.GetHeads()
+	}
+	rl.lock.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to sync heads")
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if r.options.OnProgress != nil {
+		r.options.OnProgress(Progress{ID: l.ID, Round: round, Heads: missing, Added: len(added)})
+	}
+
+	if len(heads) > 1 && r.options.OnConflict != nil {
+		r.options.OnConflict(heads)
+	}
+
+	return nil
+}
+
+// emit sends an event when a channel is set
+func (r *Replicator) emit(ctx context.Context, e Event) {
+	if r.options.Events == nil {
+		return
+	}
+
+	e.Time = time.Now()
+
+	select {
+	case r.options.Events <- e:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,514 @@
+// Package shard splits the entries of a log between sub-logs holding a
+// bounded number of entries, so very large histories never need a single
+// log holding all of them in memory
+package shard // import "berty.tech/go-ipfs-log/shard"
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// DefaultMaxEntries is the number of entries of a shard when none is set
+const DefaultMaxEntries = 10000
+
+// Options defines how the entries are split between the shards
+type Options struct {
+	// LogOptions is the template of the options of the shards, their ID
+	// is set by the sharded log
+	LogOptions *log.NewLogOptions
+
+	// MaxEntries is the number of entries after which a shard is sealed
+	// and the next epoch started, DefaultMaxEntries when 0. Joins may
+	// grow a shard beyond it.
+	MaxEntries int
+
+	// Buckets splits the payloads by hash between this number of shards
+	// per epoch, the entries are split by epoch only when 0 or 1
+	Buckets int
+}
+
+// shardInfo locates a shard, Hash is its multihash once it was written
+type shardInfo struct {
+	ID     string
+	Bucket int
+	Epoch  int
+	Length int
+	Hash   cid.Cid
+}
+
+// Log is a log whose entries are split between shards, the entries of a
+// bucket are appended to its latest epoch and a shard is sealed, written
+// to IPFS and unloaded once it holds MaxEntries entries. Only the latest
+// shard of each bucket is kept in memory, the others are loaded when
+// needed. Like logs, sharded logs aren't safe for concurrent use.
+type Log struct {
+	services io.IpfsServices
+	identity *identityprovider.Identity
+	id       string
+	options  Options
+	clock    *lamportclock.LamportClock
+
+	shards []*shardInfo
+	active map[int]*log.Log
+}
+
+// New creates an empty sharded log
+func New(services io.IpfsServices, identity *identityprovider.Identity, id string, options *Options) (*Log, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	if identity == nil {
+		return nil, errmsg.IdentityNotDefined
+	}
+
+	if id == "" {
+		return nil, errors.New("log ID is not defined")
+	}
+
+	if options == nil {
+		options = &Options{}
+	}
+
+	s := &Log{
+		services: services,
+		identity: identity,
+		id:       id,
+		options:  *options,
+		clock:    lamportclock.New(identity.PublicKey, 0),
+		active:   map[int]*log.Log{},
+	}
+
+	if s.options.MaxEntries <= 0 {
+		s.options.MaxEntries = DefaultMaxEntries
+	}
+
+	if s.options.Buckets <= 0 {
+		s.options.Buckets = 1
+	}
+
+	return s, nil
+}
+
+// ID returns the ID of the sharded log, the shards are named after it
+func (s *Log) ID() string {
+	return s.id
+}
+
+// Shards returns the IDs of the shards, ordered by epoch and bucket
+func (s *Log) Shards() []string {
+	ids := make([]string, 0, len(s.shards))
+	for _, info := range s.shards {
+		ids = append(ids, info.ID)
+	}
+
+	return ids
+}
+
+// Loaded returns the number of shards held in memory
+func (s *Log) Loaded() int {
+	return len(s.active)
+}
+
+// Len returns the number of entries of the shards
+func (s *Log) Len() int {
+	length := 0
+	for _, info := range s.shards {
+		length += info.Length
+	}
+
+	return length
+}
+
+// bucket returns the bucket of the payload
+func (s *Log) bucket(payload []byte) int {
+	if s.options.Buckets == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(payload)
+
+	return int(h.Sum32() % uint32(s.options.Buckets))
+}
+
+func (s *Log) shardID(bucket, epoch int) string {
+	return fmt.Sprintf("%s/%d/%d", s.id, bucket, epoch)
+}
+
+// find returns the shard with the ID
+func (s *Log) find(id string) (*shardInfo, bool) {
+	for _, info := range s.shards {
+		if info.ID == id {
+			return info, true
+		}
+	}
+
+	return nil, false
+}
+
+// latest returns the shard of the latest epoch of the bucket
+func (s *Log) latest(bucket int) (*shardInfo, bool) {
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		if s.shards[i].Bucket == bucket {
+			return s.shards[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// add records a new shard, the shards are kept ordered by epoch and bucket
+func (s *Log) add(info *shardInfo) {
+	s.shards = append(s.shards, info)
+	sort.SliceStable(s.shards, func(i, j int) bool {
+		if s.shards[i].Epoch != s.shards[j].Epoch {
+			return s.shards[i].Epoch < s.shards[j].Epoch
+		}
+
+		return s.shards[i].Bucket < s.shards[j].Bucket
+	})
+}
+
+// logOptions returns the options of the shard with the ID
+func (s *Log) logOptions(id string) *log.NewLogOptions {
+	options := log.NewLogOptions{}
+	if s.options.LogOptions != nil {
+		options = *s.options.LogOptions
+	}
+
+	options.ID = id
+
+	return &options
+}
+
+// open returns the shard, loading it from IPFS when it isn't active, the
+// second value is true when it is active
+func (s *Log) open(info *shardInfo) (*log.Log, bool, error) {
+	if l, ok := s.active[info.Bucket]; ok && l.ID == info.ID {
+		return l, true, nil
+	}
+
+	if !info.Hash.Defined() {
+		l, err := log.NewLog(s.services, s.identity, s.logOptions(info.ID))
+		return l, false, err
+	}
+
+	l, err := log.NewFromMultihash(s.services, s.identity, info.Hash, s.logOptions(info.ID), &log.FetchOptions{})
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to load shard %s", info.ID)
+	}
+
+	return l, false, nil
+}
+
+// write stores the shard in IPFS
+func (s *Log) write(info *shardInfo, l *log.Log) error {
+	info.Length = l.Values().Len()
+	if info.Length == 0 {
+		return nil
+	}
+
+	hash, err := l.ToMultihash()
+	if err != nil {
+		return errors.Wrapf(err, "unable to write shard %s", info.ID)
+	}
+
+	info.Hash = hash
+
+	return nil
+}
+
+// seal writes the active shard of the bucket and unloads it
+func (s *Log) seal(bucket int) error {
+	l, ok := s.active[bucket]
+	if !ok {
+		return nil
+	}
+
+	info, _ := s.find(l.ID)
+	if err := s.write(info, l); err != nil {
+		return err
+	}
+
+	delete(s.active, bucket)
+
+	return nil
+}
+
+// current returns the shard the entries of the bucket are appended to,
+// the latest shard of the bucket is sealed once it is full
+func (s *Log) current(bucket int) (*log.Log, *shardInfo, error) {
+	info, ok := s.latest(bucket)
+	if !ok {
+		info = &shardInfo{ID: s.shardID(bucket, 0), Bucket: bucket}
+		s.add(info)
+	} else if info.Length >= s.options.MaxEntries {
+		if err := s.seal(bucket); err != nil {
+			return nil, nil, err
+		}
+
+		epoch := info.Epoch + 1
+		info = &shardInfo{ID: s.shardID(bucket, epoch), Bucket: bucket, Epoch: epoch}
+		s.add(info)
+	}
+
+	l, _, err := s.open(info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.active[bucket] = l
+
+	return l, info, nil
+}
+
+// Append appends the payload to the shard of its bucket, the clock of the
+// entry follows the entries of every shard
+func (s *Log) Append(payload []byte) (iface.IPFSLogEntry, error) {
+	return s.AppendWithOptions(payload, &log.AppendOptions{PointerCount: 1})
+}
+
+// AppendWithOptions appends the payload like Append using the options, see
+// log.Log.AppendWithOptions
+func (s *Log) AppendWithOptions(payload []byte, options *log.AppendOptions) (iface.IPFSLogEntry, error) {
+	l, info, err := s.current(s.bucket(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "append failed")
+	}
+
+	l.Clock.Merge(s.clock)
+
+	e, err := l.AppendWithOptions(payload, options)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Length++
+	s.clock.Merge(l.Clock)
+
+	return e, nil
+}
+
+// Values returns the entries of every shard, sorted as by log.Log.Values.
+// The shards are loaded one at a time and unloaded once read, unless they
+// are active.
+func (s *Log) Values() ([]iface.IPFSLogEntry, error) {
+	values := []iface.IPFSLogEntry{}
+	var sortFn func(a, b iface.IPFSLogEntry) (int, error)
+
+	for _, info := range s.shards {
+		if info.Length == 0 {
+			continue
+		}
+
+		l, _, err := s.open(info)
+		if err != nil {
+			return nil, err
+		}
+
+		sortFn = l.SortFn
+		values = append(values, l.Values().Slice()...)
+	}
+
+	if sortFn != nil {
+		entry.Sort(sortFn, values)
+	}
+
+	return values, nil
+}
+
+// Join merges the shards of the other log in the shards with the same ID,
+// the shards which were sealed are written again
+func (s *Log) Join(other *Log) error {
+	if other == nil {
+		return errmsg.LogJoinNotDefined
+	}
+
+	if other.id != s.id {
+		return nil
+	}
+
+	if other.options.Buckets != s.options.Buckets {
+		return errors.Errorf("join failed: %d buckets, expected %d", other.options.Buckets, s.options.Buckets)
+	}
+
+	for _, otherInfo := range other.shards {
+		if otherInfo.Length == 0 {
+			continue
+		}
+
+		otherShard, _, err := other.open(otherInfo)
+		if err != nil {
+			return errors.Wrap(err, "join failed")
+		}
+
+		info, ok := s.find(otherInfo.ID)
+		if !ok {
+			info = &shardInfo{ID: otherInfo.ID, Bucket: otherInfo.Bucket, Epoch: otherInfo.Epoch}
+			s.add(info)
+		}
+
+		l, active, err := s.open(info)
+		if err != nil {
+			return errors.Wrap(err, "join failed")
+		}
+
+		if _, err := l.Join(otherShard, -1); err != nil {
+			return errors.Wrapf(err, "unable to join shard %s", info.ID)
+		}
+
+		s.clock.Merge(l.Clock)
+
+		if active {
+			info.Length = l.Values().Len()
+		} else if err := s.write(info, l); err != nil {
+			return errors.Wrap(err, "join failed")
+		}
+	}
+
+	// A joined epoch may follow the active shard of a bucket
+	for bucket, l := range s.active {
+		if info, _ := s.latest(bucket); info.ID != l.ID {
+			if err := s.seal(bucket); err != nil {
+				return errors.Wrap(err, "join failed")
+			}
+		}
+	}
+
+	return nil
+}
+
+// cborIndex is the serialized form of a sharded log
+type cborIndex struct {
+	ID         string
+	Buckets    int
+	MaxEntries int
+	Time       int
+	Shards     []*cborShard
+}
+
+type cborShard struct {
+	ID     string
+	Bucket int
+	Epoch  int
+	Length int
+	Hash   cid.Cid
+}
+
+// ToMultihash writes the active shards and the index of the shards to
+// IPFS, the log can be reopened from the returned address with
+// NewFromMultihash
+func (s *Log) ToMultihash() (cid.Cid, error) {
+	index := &cborIndex{
+		ID:         s.id,
+		Buckets:    s.options.Buckets,
+		MaxEntries: s.options.MaxEntries,
+		Time:       s.clock.Time,
+		Shards:     []*cborShard{},
+	}
+
+	for _, l := range s.active {
+		info, _ := s.find(l.ID)
+		if err := s.write(info, l); err != nil {
+			return cid.Cid{}, err
+		}
+	}
+
+	for _, info := range s.shards {
+		if info.Length == 0 {
+			continue
+		}
+
+		index.Shards = append(index.Shards, &cborShard{
+			ID:     info.ID,
+			Bucket: info.Bucket,
+			Epoch:  info.Epoch,
+			Length: info.Length,
+			Hash:   info.Hash,
+		})
+	}
+
+	return io.WriteCBOR(s.services, index)
+}
+
+// NewFromMultihash reopens the sharded log written by ToMultihash, no shard
+// is loaded until it is needed. The number of buckets and of entries per
+// shard are the ones of the written log.
+func NewFromMultihash(services io.IpfsServices, identity *identityprovider.Identity, hash cid.Cid, options *Options) (*Log, error) {
+	if services == nil {
+		return nil, errmsg.IPFSNotDefined
+	}
+
+	nd, err := io.ReadCBOR(services, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read sharded log")
+	}
+
+	index := &cborIndex{}
+	if err := cbornode.DecodeInto(nd.RawData(), index); err != nil {
+		return nil, errors.Wrap(err, "unable to decode sharded log")
+	}
+
+	if options == nil {
+		options = &Options{}
+	}
+
+	resolved := *options
+	resolved.Buckets = index.Buckets
+	resolved.MaxEntries = index.MaxEntries
+
+	s, err := New(services, identity, index.ID, &resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range index.Shards {
+		s.add(&shardInfo{ID: c.ID, Bucket: c.Bucket, Epoch: c.Epoch, Length: c.Length, Hash: c.Hash})
+	}
+
+	s.clock.Time = index.Time
+
+	return s, nil
+}
+
+var atlasCborIndex = atlas.BuildEntry(cborIndex{}).
+	StructMap().
+	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+	AddField("Buckets", atlas.StructMapEntry{SerialName: "buckets"}).
+	AddField("MaxEntries", atlas.StructMapEntry{SerialName: "maxEntries"}).
+	AddField("Time", atlas.StructMapEntry{SerialName: "time"}).
+	AddField("Shards", atlas.StructMapEntry{SerialName: "shards"}).
+	Complete()
+
+var atlasCborShard = atlas.BuildEntry(cborShard{}).
+	StructMap().
+	AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+	AddField("Bucket", atlas.StructMapEntry{SerialName: "bucket"}).
+	AddField("Epoch", atlas.StructMapEntry{SerialName: "epoch"}).
+	AddField("Length", atlas.StructMapEntry{SerialName: "length"}).
+	AddField("Hash", atlas.StructMapEntry{SerialName: "hash"}).
+	Complete()
+
+// MarshalCBOR encodes the index as dag-cbor
+func (i *cborIndex) MarshalCBOR() ([]byte, error) {
+	return cbornode.DumpObject(i)
+}
+
+func init() {
+	cbornode.RegisterCborType(atlasCborIndex)
+	cbornode.RegisterCborType(atlasCborShard)
+}
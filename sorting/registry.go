@@ -0,0 +1,42 @@
+package sorting // import "berty.tech/go-ipfs-log/sorting"
+
+import (
+	"sync"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// Names of the built-in sort functions recorded in log manifests
+const (
+	LastWriteWinsName  = "last-write-wins"
+	FirstWriteWinsName = "first-write-wins"
+	EntryHashName      = "entry-hash"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func(a, b iface.IPFSLogEntry) (int, error){
+		LastWriteWinsName:  LastWriteWins,
+		FirstWriteWinsName: FirstWriteWins,
+		EntryHashName:      SortByEntryHash,
+	}
+)
+
+// Register names a sort function so peers loading a log from its manifest
+// use the same one, it replaces the function registered with that name
+func Register(name string, fn func(a, b iface.IPFSLogEntry) (int, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = fn
+}
+
+// Lookup returns the sort function registered with the name
+func Lookup(name string) (func(a, b iface.IPFSLogEntry) (int, error), bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	fn, ok := registry[name]
+
+	return fn, ok
+}
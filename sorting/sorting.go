@@ -0,0 +1,126 @@
+// Package sorting provides the conflict resolution strategies used to
+// order the entries of a log
+package sorting // import "berty.tech/go-ipfs-log/sorting"
+
+import (
+	"bytes"
+	"errors"
+
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+)
+
+// SortByClocks compares entries by Lamport clock, conflicts are passed to
+// resolveConflict
+func SortByClocks(a, b iface.IPFSLogEntry, resolveConflict func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)) (int, error) {
+	diff := lamportclock.Compare(a.GetClock(), b.GetClock())
+
+	if diff == 0 {
+		return resolveConflict(a, b)
+	}
+
+	return diff, nil
+}
+
+// SortByClockID compares entries by clock ID, conflicts are passed to
+// resolveConflict
+func SortByClockID(a, b iface.IPFSLogEntry, resolveConflict func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error)) (int, error) {
+	comparedIDs := bytes.Compare(a.GetClock().ID, b.GetClock().ID)
+
+	if comparedIDs == 0 {
+		return resolveConflict(a, b)
+	}
+	if comparedIDs < 0 {
+		return -1, nil
+	}
+
+	return 1, nil
+}
+
+// First always sorts a after b
+func First(a, b iface.IPFSLogEntry) (int, error) {
+	return 1, nil
+}
+
+// FirstWriteWins is the reverse of LastWriteWins
+func FirstWriteWins(a, b iface.IPFSLogEntry) (int, error) {
+	res, err := LastWriteWins(a, b)
+
+	return res * -1, err
+}
+
+// Tiebreaker orders two entries having the same Lamport time
+type Tiebreaker func(a, b iface.IPFSLogEntry) (int, error)
+
+// ClockIDTiebreaker orders entries by clock ID, it is the tiebreaker used
+// by LastWriteWins
+func ClockIDTiebreaker(a, b iface.IPFSLogEntry) (int, error) {
+	return SortByClockID(a, b, First)
+}
+
+// EntryHashTiebreaker orders entries by hash
+func EntryHashTiebreaker(a, b iface.IPFSLogEntry) (int, error) {
+	if io.CIDString(a.GetHash()) < io.CIDString(b.GetHash()) {
+		return -1, nil
+	}
+
+	return 1, nil
+}
+
+// LastWriteWins sorts entries by clock, then by clock ID
+func LastWriteWins(a, b iface.IPFSLogEntry) (int, error) {
+	return SortByClocks(a, b, ClockIDTiebreaker)
+}
+
+// LastWriteWinsWithTiebreaker returns a LastWriteWins comparison using
+// tiebreak instead of the clock IDs to order entries having the same
+// Lamport time, LastWriteWins is used when tiebreak returns zero
+func LastWriteWinsWithTiebreaker(tiebreak Tiebreaker) func(a, b iface.IPFSLogEntry) (int, error) {
+	if tiebreak == nil {
+		return LastWriteWins
+	}
+
+	return func(a, b iface.IPFSLogEntry) (int, error) {
+		if diff := a.GetClock().Time - b.GetClock().Time; diff != 0 {
+			return diff, nil
+		}
+
+		ret, err := tiebreak(a, b)
+		if ret != 0 || err != nil {
+			return ret, err
+		}
+
+		return LastWriteWins(a, b)
+	}
+}
+
+// SortByEntryHash sorts entries by clock, then by clock ID, then by hash
+func SortByEntryHash(a, b iface.IPFSLogEntry) (int, error) {
+	sortByID := func(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error) {
+		return SortByClockID(a, b, EntryHashTiebreaker)
+	}
+
+	return SortByClocks(a, b, sortByID)
+}
+
+// NoZeroes wraps a comparison function and returns an error when it can't
+// order two entries
+func NoZeroes(compFunc func(a, b iface.IPFSLogEntry) (int, error)) func(a, b iface.IPFSLogEntry) (int, error) {
+	return func(a, b iface.IPFSLogEntry) (int, error) {
+		ret, err := compFunc(a, b)
+		if ret != 0 || err != nil {
+			return ret, err
+		}
+
+		return 0, errors.New(`err: Your log's tiebreaker function has returned zero and therefore cannot be`)
+	}
+}
+
+// Reverse reverses a slice of entries in place
+func Reverse(a []iface.IPFSLogEntry) {
+	for i := len(a)/2 - 1; i >= 0; i-- {
+		opp := len(a) - 1 - i
+		a[i], a[opp] = a[opp], a[i]
+	}
+}
@@ -0,0 +1,563 @@
+package syncer // import "berty.tech/go-ipfs-log/syncer"
+
+import (
+	"bufio"
+	"context"
+	goio "io"
+	"sort"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+	"github.com/pkg/errors"
+)
+
+// BlockProtocolID is the stream protocol serving the blocks of the logs
+// added to a syncer, each request holds a CID and is answered with the
+// block data, or an empty message when the block is unknown
+const BlockProtocolID protocol.ID = "/ipfs-log/blocks/1.0.0"
+
+// PeerStats are the statistics kept by a fetcher about a peer
+type PeerStats struct {
+	ID peer.ID
+
+	// Latency is the moving average of the time taken to receive a block,
+	// 0 until a block is received
+	Latency time.Duration
+
+	// InFlight is the number of blocks being requested from the peer
+	InFlight int
+
+	// Fetched is the number of blocks received from the peer
+	Fetched int
+
+	// Failed is the number of blocks the peer didn't send
+	Failed int
+
+	// Invalid is the number of blocks the peer sent corrupted or
+	// truncated
+	Invalid int
+}
+
+// invalidPenalty is the number of failed requests an invalid block counts
+// for in the score of a peer
+const invalidPenalty = 10
+
+// Score returns the reliability of the peer between 0 and 1, it starts at
+// 1 and is lowered by failed requests and much more by invalid blocks
+func (s PeerStats) Score() float64 {
+	return float64(s.Fetched+1) / float64(s.Fetched+1+s.Failed+invalidPenalty*s.Invalid)
+}
+
+// Policy selects the peer a block is requested from
+type Policy interface {
+	// Select returns one of the candidates, there is at least one
+	Select(c cid.Cid, candidates []PeerStats) peer.ID
+}
+
+// PolicyFunc is a function implementing Policy
+type PolicyFunc func(c cid.Cid, candidates []PeerStats) peer.ID
+
+func (f PolicyFunc) Select(c cid.Cid, candidates []PeerStats) peer.ID {
+	return f(c, candidates)
+}
+
+// LowLatency prefers the peers with the lowest latency and the fewest
+// blocks in flight, so the requests of a batch are striped across peers
+var LowLatency Policy = PolicyFunc(func(c cid.Cid, candidates []PeerStats) peer.ID {
+	return cheapest(candidates, latencyCost)
+})
+
+// Reliable is LowLatency weighted by the score of the peers, the peers
+// failing requests or sending invalid blocks are demoted
+var Reliable Policy = PolicyFunc(func(c cid.Cid, candidates []PeerStats) peer.ID {
+	return cheapest(candidates, func(s PeerStats) float64 {
+		return latencyCost(s) / s.Score()
+	})
+})
+
+func latencyCost(s PeerStats) float64 {
+	return float64((s.Latency + time.Millisecond) * time.Duration(s.InFlight+1))
+}
+
+// cheapest returns the first candidate with the lowest cost
+func cheapest(candidates []PeerStats, cost func(PeerStats) float64) peer.ID {
+	best, bestCost := candidates[0], cost(candidates[0])
+	for _, s := range candidates[1:] {
+		if c := cost(s); c < bestCost {
+			best, bestCost = s, c
+		}
+	}
+
+	return best.ID
+}
+
+// FetcherOptions defines how a fetcher requests blocks
+type FetcherOptions struct {
+	// Policy selects the peer of each request, Reliable when nil
+	Policy Policy
+
+	// Timeout bounds the time spent requesting blocks from a peer before
+	// trying the next one, no timeout when 0
+	Timeout time.Duration
+}
+
+// Fetcher is a block exchange requesting blocks from the syncers of known
+// peers, the blocks of a batch are requested from several peers in
+// parallel. The statistics of the peers are kept across requests so the
+// policy favors reliable peers. It stores the received blocks in the
+// blockstore, use it with io.NewServices.
+type Fetcher struct {
+	host    Host
+	blocks  bstore.Blockstore
+	options FetcherOptions
+	lock    sync.Mutex
+	peers   map[peer.ID]*PeerStats
+}
+
+// NewFetcher returns a fetcher without peers, see AddPeer
+func NewFetcher(host Host, blockstore bstore.Blockstore, options *FetcherOptions) *Fetcher {
+	if options == nil {
+		options = &FetcherOptions{}
+	}
+
+	f := &Fetcher{
+		host:    host,
+		blocks:  blockstore,
+		options: *options,
+		peers:   map[peer.ID]*PeerStats{},
+	}
+
+	if f.options.Policy == nil {
+		f.options.Policy = Reliable
+	}
+
+	return f
+}
+
+// AddPeer adds a peer blocks can be requested from
+func (f *Fetcher) AddPeer(p peer.ID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.peers[p]; !ok {
+		f.peers[p] = &PeerStats{ID: p}
+	}
+}
+
+// RemovePeer stops requesting blocks from a peer
+func (f *Fetcher) RemovePeer(p peer.ID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.peers, p)
+}
+
+// Stats returns the statistics of the peers ordered by ID
+func (f *Fetcher) Stats() []PeerStats {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.candidates(nil)
+}
+
+// candidates returns the statistics of the peers which weren't tried
+func (f *Fetcher) candidates(tried map[peer.ID]bool) []PeerStats {
+	stats := []PeerStats{}
+	for _, s := range f.peers {
+		if !tried[s.ID] {
+			stats = append(stats, *s)
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+
+	return stats
+}
+
+// pick selects the peer a block is requested from, the block is counted
+// in flight until record is called
+func (f *Fetcher) pick(c cid.Cid, tried map[peer.ID]bool) (peer.ID, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	candidates := f.candidates(tried)
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	p := f.options.Policy.Select(c, candidates)
+	s, ok := f.peers[p]
+	if !ok {
+		return "", false
+	}
+
+	s.InFlight++
+
+	return p, true
+}
+
+// outcome is the result of a block request
+type outcome int
+
+const (
+	fetchOK outcome = iota
+	fetchFailed
+	fetchInvalid
+)
+
+// record updates the statistics of a peer once a request is answered
+func (f *Fetcher) record(p peer.ID, latency time.Duration, o outcome) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	s, known := f.peers[p]
+	if !known {
+		return
+	}
+
+	s.InFlight--
+
+	switch o {
+	case fetchFailed:
+		s.Failed++
+		return
+	case fetchInvalid:
+		s.Invalid++
+		return
+	}
+
+	s.Fetched++
+	if s.Latency == 0 {
+		s.Latency = latency
+	} else {
+		s.Latency = (3*s.Latency + latency) / 4
+	}
+}
+
+// GetBlock requests a block from the peers until one of them has it
+func (f *Fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return f.getBlock(ctx, c, map[peer.ID]bool{})
+}
+
+func (f *Fetcher) getBlock(ctx context.Context, c cid.Cid, tried map[peer.ID]bool) (blocks.Block, error) {
+	for {
+		p, ok := f.pick(c, tried)
+		if !ok {
+			return nil, bstore.ErrNotFound
+		}
+
+		tried[p] = true
+
+		if b := f.request(ctx, p, []cid.Cid{c})[0]; b != nil {
+			return b, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// GetBlocks stripes the requests across the peers selected by the policy,
+// the blocks a peer doesn't have are requested from the others
+func (f *Fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+
+	go func() {
+		defer close(out)
+
+		batches := map[peer.ID][]cid.Cid{}
+		for _, c := range cids {
+			p, ok := f.pick(c, nil)
+			if !ok {
+				return
+			}
+
+			batches[p] = append(batches[p], c)
+		}
+
+		send := func(b blocks.Block) {
+			select {
+			case out <- b:
+			case <-ctx.Done():
+			}
+		}
+
+		wg := sync.WaitGroup{}
+		for p, batch := range batches {
+			wg.Add(1)
+
+			go func(p peer.ID, batch []cid.Cid) {
+				defer wg.Done()
+
+				for i, b := range f.request(ctx, p, batch) {
+					if b == nil {
+						b, _ = f.getBlock(ctx, batch[i], map[peer.ID]bool{p: true})
+					}
+
+					if b != nil {
+						send(b)
+					}
+				}
+			}(p, batch)
+		}
+
+		wg.Wait()
+	}()
+
+	return out, nil
+}
+
+// request asks a peer for blocks over a single stream, the blocks the peer
+// doesn't have or sent corrupted are nil
+func (f *Fetcher) request(ctx context.Context, p peer.ID, cids []cid.Cid) []blocks.Block {
+	res := make([]blocks.Block, len(cids))
+	answered := 0
+
+	defer func() {
+		for range cids[answered:] {
+			f.record(p, 0, fetchFailed)
+		}
+	}()
+
+	if f.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.options.Timeout)
+		defer cancel()
+	}
+
+	stream, err := f.host.NewStream(ctx, p, BlockProtocolID)
+	if err != nil {
+		return res
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(stream)
+	for i, c := range cids {
+		start := time.Now()
+
+		b, err := readBlock(stream, r, c)
+		switch {
+		case err == errInvalidBlock:
+			answered++
+			f.record(p, 0, fetchInvalid)
+			continue
+		case errors.Cause(err) == goio.ErrUnexpectedEOF:
+			answered++
+			f.record(p, 0, fetchInvalid)
+			_ = stream.Reset()
+			return res
+		case err != nil:
+			_ = stream.Reset()
+			return res
+		}
+
+		answered++
+		if b == nil {
+			f.record(p, 0, fetchFailed)
+			continue
+		}
+
+		f.record(p, time.Since(start), fetchOK)
+
+		if err := f.blocks.Put(b); err != nil {
+			continue
+		}
+
+		res[i] = b
+	}
+
+	if err := writeSection(stream, nil); err != nil {
+		_ = stream.Reset()
+		return res
+	}
+
+	_ = stream.Close()
+
+	return res
+}
+
+// errInvalidBlock is returned when a peer sends data not matching the hash
+// of the requested block
+var errInvalidBlock = errors.New("block doesn't match its hash")
+
+// readBlock requests a block on the stream, the block is nil when the peer
+// doesn't have it
+func readBlock(stream inet.Stream, r *bufio.Reader, c cid.Cid) (blocks.Block, error) {
+	if err := writeSection(stream, c.Bytes()); err != nil {
+		return nil, err
+	}
+
+	data, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	sum, err := c.Prefix().Sum(data)
+	if err != nil || !sum.Equals(c) {
+		return nil, errInvalidBlock
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (f *Fetcher) HasBlock(blocks.Block) error { return nil }
+
+func (f *Fetcher) IsOnline() bool { return true }
+
+func (f *Fetcher) Close() error { return nil }
+
+var _ exchange.Interface = &Fetcher{}
+
+// handleBlocks answers the block requests of a peer until it sends an
+// empty message
+func (s *Syncer) handleBlocks(stream inet.Stream) {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			_ = stream.Reset()
+			return
+		}
+	}
+
+	_ = stream.SetDeadline(time.Now().Add(s.options.StreamTimeout))
+
+	r := bufio.NewReader(stream)
+
+	for {
+		data, err := readSection(r)
+		if err != nil {
+			_ = stream.Reset()
+			return
+		}
+
+		if len(data) == 0 {
+			_ = stream.Close()
+			return
+		}
+
+		c, err := cid.Cast(data)
+		if err != nil {
+			_ = stream.Reset()
+			return
+		}
+
+		if err := writeSection(stream, s.localBlock(c)); err != nil {
+			_ = stream.Reset()
+			return
+		}
+	}
+}
+
+// localBlock returns the data of a block of one of the logs, nil when none
+// has it. Only the entries reachable from the heads of the logs and their
+// payloads are served, not the other blocks of their stores.
+func (s *Syncer) localBlock(c cid.Cid) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, l := range s.logs {
+		if l.Storage.BlockStore() == nil {
+			continue
+		}
+
+		served, err := s.servedBlocks(id, l)
+		if err != nil || !served.Has(c) {
+			continue
+		}
+
+		if b, err := l.Storage.BlockStore().Get(c); err == nil {
+			return b.RawData()
+		}
+	}
+
+	return nil
+}
+
+// servedBlocks are the blocks of a log reachable from its heads
+type servedBlocks struct {
+	heads  []cid.Cid
+	blocks *cid.Set
+}
+
+// servedBlocks returns the blocks reachable from the heads of the log, they
+// are computed again once the heads change
+func (s *Syncer) servedBlocks(id string, l *log.Log) (*cid.Set, error) {
+	heads := []cid.Cid{}
+	for _, h := range l.GetHeads() {
+		heads = append(heads, h.GetHash())
+	}
+
+	if served, ok := s.served[id]; ok && sameCids(served.heads, heads) {
+		return served.blocks, nil
+	}
+
+	values, err := l.ValuesE()
+	if err != nil {
+		return nil, err
+	}
+
+	// Payload blocks missing locally can't be served, they aren't fetched
+	dag := io.Offline(l.Storage).DAG()
+	set := cid.NewSet()
+
+	var visit func(c cid.Cid)
+	visit = func(c cid.Cid) {
+		if !set.Visit(c) {
+			return
+		}
+
+		nd, err := dag.Get(context.Background(), c)
+		if err != nil {
+			return
+		}
+
+		for _, link := range nd.Links() {
+			visit(link.Cid)
+		}
+	}
+
+	for _, e := range values.Slice() {
+		set.Add(e.GetHash())
+
+		if ref := e.GetPayloadRef(); ref.Defined() {
+			visit(ref)
+		}
+	}
+
+	s.served[id] = &servedBlocks{heads: heads, blocks: set}
+
+	return set, nil
+}
+
+func sameCids(a, b []cid.Cid) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equals(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
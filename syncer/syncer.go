@@ -0,0 +1,514 @@
+// Package syncer synchronizes logs directly between two libp2p peers
+package syncer // import "berty.tech/go-ipfs-log/syncer"
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	goio "io"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+	"github.com/pkg/errors"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// ProtocolID is the stream protocol of the syncer
+const ProtocolID protocol.ID = "/ipfs-log/sync/1.0.0"
+
+// MaxMessageSize is the maximum size in bytes of a message of the protocol
+const MaxMessageSize = 4 << 20
+
+// DefaultStreamTimeout bounds the time the streams opened by peers stay
+// open when no timeout is set
+const DefaultStreamTimeout = time.Minute
+
+// Host is the part of a libp2p host used by the syncer
+type Host interface {
+	SetStreamHandler(pid protocol.ID, handler inet.StreamHandler)
+	RemoveStreamHandler(pid protocol.ID)
+	NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error)
+}
+
+// Syncer exchanges the heads of its logs with peers and transfers the
+// entry blocks each side is missing over a stream, without going through
+// the DHT or bitswap.
+//
+// Both peers send their heads, then the blocks of the entries which aren't
+// reachable from the heads of the other side, and finally join the heads
+// they received. The logs must not be modified while the syncer is attached
+// to them, except through Do.
+type Syncer struct {
+	host    Host
+	options Options
+	lock    sync.Mutex
+	logs    map[string]*log.Log
+	served  map[string]*servedBlocks
+	slots   chan struct{}
+}
+
+// Options defines the resources a syncer may use
+type Options struct {
+	// MaxPeers is the number of syncs and block streams running at once,
+	// streams opened by peers are reset when none is available, no limit
+	// when 0
+	MaxPeers int
+
+	// ByteLimiter bounds the number of block bytes received per second, it
+	// can be shared with other syncers
+	ByteLimiter *ratelimit.Limiter
+
+	// StreamTimeout bounds the time the streams opened by peers stay open,
+	// DefaultStreamTimeout when 0
+	StreamTimeout time.Duration
+}
+
+type syncBlock struct {
+	Cid  cid.Cid
+	Data []byte
+}
+
+// NewSyncer attaches a syncer to the host, it also serves the blocks of its
+// logs to the fetchers of other peers. Close detaches it.
+func NewSyncer(host Host, options *Options) *Syncer {
+	if options == nil {
+		options = &Options{}
+	}
+
+	s := &Syncer{
+		host:    host,
+		options: *options,
+		logs:    map[string]*log.Log{},
+		served:  map[string]*servedBlocks{},
+	}
+
+	if options.MaxPeers > 0 {
+		s.slots = make(chan struct{}, options.MaxPeers)
+	}
+
+	if s.options.StreamTimeout <= 0 {
+		s.options.StreamTimeout = DefaultStreamTimeout
+	}
+
+	host.SetStreamHandler(ProtocolID, s.handleStream)
+	host.SetStreamHandler(BlockProtocolID, s.handleBlocks)
+
+	return s
+}
+
+// Add makes the log available to peers, replacing any log with the same ID
+func (s *Syncer) Add(l *log.Log) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.logs[l.ID] = l
+	delete(s.served, l.ID)
+}
+
+// Remove stops serving the log with the given ID
+func (s *Syncer) Remove(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.logs, id)
+	delete(s.served, id)
+}
+
+// Do calls fn with the log with the given ID while no synchronization
+// modifies it
+func (s *Syncer) Do(id string, fn func(l *log.Log) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l, ok := s.logs[id]
+	if !ok {
+		return errors.Errorf("unknown log %s", id)
+	}
+
+	return fn(l)
+}
+
+// Close detaches the syncer from the host
+func (s *Syncer) Close() error {
+	s.host.RemoveStreamHandler(ProtocolID)
+	s.host.RemoveStreamHandler(BlockProtocolID)
+
+	return nil
+}
+
+// Sync synchronizes the log with the given ID with the same log on the peer,
+// both logs hold the entries of the other once it returns
+func (s *Syncer) Sync(ctx context.Context, p peer.ID, id string) error {
+	s.lock.Lock()
+	l, ok := s.logs[id]
+	s.lock.Unlock()
+
+	if !ok {
+		return errors.Errorf("unknown log %s", id)
+	}
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	stream, err := s.host.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return errors.Wrap(err, "unable to open sync stream")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := s.sync(ctx, stream, bufio.NewReader(stream), l, nil); err != nil {
+		_ = stream.Reset()
+		return err
+	}
+
+	return stream.Close()
+}
+
+func (s *Syncer) handleStream(stream inet.Stream) {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			_ = stream.Reset()
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.StreamTimeout)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	_ = stream.SetDeadline(deadline)
+
+	r := bufio.NewReader(stream)
+
+	hello, err := readHello(r)
+	if err != nil {
+		_ = stream.Reset()
+		return
+	}
+
+	s.lock.Lock()
+	l, ok := s.logs[hello.ID]
+	s.lock.Unlock()
+
+	if !ok {
+		_ = stream.Reset()
+		return
+	}
+
+	if err := s.sync(ctx, stream, r, l, hello); err != nil {
+		_ = stream.Reset()
+		return
+	}
+
+	_ = stream.Close()
+}
+
+// sync runs the protocol, the peer opening the stream sends its heads
+// first, the remote hello is already read on the other side
+func (s *Syncer) sync(ctx context.Context, stream inet.Stream, r *bufio.Reader, l *log.Log, remote *log.JSONLog) error {
+	initiator := remote == nil
+
+	s.lock.Lock()
+	local := l.ToJSON()
+	s.lock.Unlock()
+
+	if err := writeMessage(stream, local); err != nil {
+		return errors.Wrap(err, "unable to send heads")
+	}
+
+	if initiator {
+		var err error
+		if remote, err = readHello(r); err != nil {
+			return err
+		}
+
+		if remote.ID != l.ID {
+			return errors.Errorf("peer replied with log %s", remote.ID)
+		}
+
+		if err := s.receiveBlocks(ctx, r, l); err != nil {
+			return err
+		}
+
+		if err := s.sendBlocks(ctx, stream, l, remote.Heads); err != nil {
+			return err
+		}
+	} else {
+		if err := s.sendBlocks(ctx, stream, l, remote.Heads); err != nil {
+			return err
+		}
+
+		if err := s.receiveBlocks(ctx, r, l); err != nil {
+			return err
+		}
+	}
+
+	if err := s.join(l, remote); err != nil {
+		return err
+	}
+
+	// The peer accepting the stream acknowledges once it joined
+	if !initiator {
+		return writeSection(stream, nil)
+	}
+
+	if _, err := readSection(r); err != nil {
+		return errors.Wrap(err, "peer didn't acknowledge the sync")
+	}
+
+	return nil
+}
+
+// sendBlocks writes the blocks of the entries of the log which aren't
+// reachable from the remote heads, followed by an empty message
+func (s *Syncer) sendBlocks(ctx context.Context, w goio.Writer, l *log.Log, heads []cid.Cid) error {
+	s.lock.Lock()
+	missing, err := missingEntries(l, heads)
+	s.lock.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list missing entries")
+	}
+
+	seen := cid.NewSet()
+	for _, e := range missing {
+		if err := sendDAG(ctx, w, l, e.GetHash(), seen, false); err != nil {
+			return err
+		}
+
+		if ref := e.GetPayloadRef(); ref.Defined() {
+			if err := sendDAG(ctx, w, l, ref, seen, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeSection(w, nil)
+}
+
+// sendDAG writes a block, and its links when recursive is set
+func sendDAG(ctx context.Context, w goio.Writer, l *log.Log, c cid.Cid, seen *cid.Set, recursive bool) error {
+	if !seen.Visit(c) {
+		return nil
+	}
+
+	nd, err := l.Storage.DAG().Get(ctx, c)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read block %s", c)
+	}
+
+	if err := writeMessage(w, &syncBlock{Cid: c, Data: nd.RawData()}); err != nil {
+		return errors.Wrap(err, "unable to send block")
+	}
+
+	if !recursive {
+		return nil
+	}
+
+	for _, link := range nd.Links() {
+		if err := sendDAG(ctx, w, l, link.Cid, seen, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receiveBlocks stores the blocks sent by the peer until an empty message
+func (s *Syncer) receiveBlocks(ctx context.Context, r *bufio.Reader, l *log.Log) error {
+	for {
+		data, err := readSection(r)
+		if err != nil {
+			return errors.Wrap(err, "unable to read block")
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+
+		if err := s.options.ByteLimiter.WaitN(ctx, len(data)); err != nil {
+			return err
+		}
+
+		b := &syncBlock{}
+		if err := cbornode.DecodeInto(data, b); err != nil {
+			return errors.Wrap(err, "unable to decode block")
+		}
+
+		sum, err := b.Cid.Prefix().Sum(b.Data)
+		if err != nil {
+			return errors.Wrap(err, "unable to hash block")
+		}
+
+		if !sum.Equals(b.Cid) {
+			return errors.Errorf("block %s doesn't match its hash", b.Cid)
+		}
+
+		block, err := blocks.NewBlockWithCid(b.Data, b.Cid)
+		if err != nil {
+			return err
+		}
+
+		if err := l.Storage.BlockStore().Put(block); err != nil {
+			return errors.Wrap(err, "unable to store block")
+		}
+	}
+}
+
+// join merges the remote heads in the log, their blocks are stored locally
+func (s *Syncer) join(l *log.Log, remote *log.JSONLog) error {
+	if len(remote.Heads) == 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	other, err := log.NewFromJSON(l.Storage, l.Identity, remote, &log.NewLogOptions{
+		ID:               l.ID,
+		AccessController: l.AccessController,
+	}, &entry.FetchOptions{})
+	if err != nil {
+		return errors.Wrap(err, "unable to load remote heads")
+	}
+
+	if _, err := l.Join(other, -1); err != nil {
+		return errors.Wrap(err, "unable to join remote heads")
+	}
+
+	return nil
+}
+
+// missingEntries returns the entries of the log which aren't reachable from
+// the heads, unknown heads are ignored
+func missingEntries(l *log.Log, heads []cid.Cid) ([]iface.IPFSLogEntry, error) {
+	reachable := cid.NewSet()
+	queue := append([]cid.Cid{}, heads...)
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if reachable.Has(c) {
+			continue
+		}
+
+		e, ok, err := l.GetEntryE(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok || !reachable.Visit(c) {
+			continue
+		}
+
+		queue = append(queue, e.GetNext()...)
+	}
+
+	values, err := l.ValuesE()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []iface.IPFSLogEntry{}
+	for _, e := range values.Slice() {
+		if !reachable.Has(e.GetHash()) {
+			missing = append(missing, e)
+		}
+	}
+
+	return missing, nil
+}
+
+func readHello(r *bufio.Reader) (*log.JSONLog, error) {
+	data, err := readSection(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read heads")
+	}
+
+	hello := &log.JSONLog{}
+	if err := cbornode.DecodeInto(data, hello); err != nil {
+		return nil, errors.Wrap(err, "unable to decode heads")
+	}
+
+	return hello, nil
+}
+
+func writeMessage(w goio.Writer, v interface{}) error {
+	data, err := cbornode.DumpObject(v)
+	if err != nil {
+		return err
+	}
+
+	return writeSection(w, data)
+}
+
+func writeSection(w goio.Writer, data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+func readSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > MaxMessageSize {
+		return nil, errors.Errorf("message of %d bytes exceeds the maximum size", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := goio.ReadFull(r, data); err != nil {
+		if err == goio.EOF {
+			err = goio.ErrUnexpectedEOF
+		}
+
+		return nil, errors.Wrap(err, "truncated message")
+	}
+
+	return data, nil
+}
+
+var atlasSyncBlock = atlas.BuildEntry(syncBlock{}).
+	StructMap().
+	AddField("Cid", atlas.StructMapEntry{SerialName: "cid"}).
+	AddField("Data", atlas.StructMapEntry{SerialName: "data"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(atlasSyncBlock)
+}
@@ -0,0 +1,630 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// appendOnlyACL rejects the entries which don't point to every head of the
+// log, forks can't be written
+type appendOnlyACL struct {
+	heads [][]iface.IPFSLogEntry
+}
+
+func (a *appendOnlyACL) CanAppend(ctx context.Context, e iface.IPFSLogEntry, provider idp.Interface, state accesscontroller.LogState) error {
+	if ctx == nil || provider == nil {
+		return fmt.Errorf("missing context or provider")
+	}
+
+	heads := state.GetHeads()
+	a.heads = append(a.heads, heads)
+
+	for _, h := range heads {
+		found := false
+		for _, n := range e.GetNext() {
+			if n.Equals(h.GetHash()) {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("entry doesn't follow head %s", h.GetHash())
+		}
+	}
+
+	for _, n := range e.GetNext() {
+		if _, ok := state.GetEntry(n); !ok {
+			return fmt.Errorf("unknown entry %s", n)
+		}
+	}
+
+	return nil
+}
+
+// forgeEntry creates an entry claiming the ID of victim but signed with the
+// key of attacker, the ID signature is valid for the attacker key
+func forgeEntry(ipfs io.IpfsServices, keystore *ks.Keystore, victim, attacker *idp.Identity, logID string, payload []byte) (*entry.Entry, error) {
+	key, err := keystore.GetKey(attacker.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	idSignature, err := key.Sign([]byte(victim.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	forged := &idp.Identity{
+		ID:        victim.ID,
+		PublicKey: attacker.PublicKey,
+		Signatures: &idp.IdentitySignature{
+			ID:        idSignature,
+			PublicKey: attacker.Signatures.PublicKey,
+		},
+		Type:     attacker.Type,
+		Provider: attacker.Provider,
+	}
+
+	return entry.CreateEntryWithOptions(ipfs, forged, &entry.Entry{LogID: logID, Payload: payload}, nil, &entry.CreateEntryOptions{Signer: idp.NewKeySigner(key)})
+}
+
+func TestAccessController(t *testing.T) {
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [3]*idp.Identity
+	for i := range identities {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%d", i),
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Access controller", t, FailureHalts, func(c C) {
+		c.Convey("roles", FailureHalts, func(c C) {
+			admin, member, outsider := identities[0], identities[1], identities[2]
+			roles := accesscontroller.NewRoles([]string{admin.ID})
+
+			memberLog, err := log.NewLog(ipfs, member, &log.NewLogOptions{ID: "A", AccessController: roles})
+			c.So(err, ShouldBeNil)
+
+			_, err = memberLog.Append([]byte("one"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			// Only admins change the roles
+			err = roles.Grant(member, member.ID, accesscontroller.RoleWriter)
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+			c.So(errors.Is(roles.Revoke(outsider, admin.ID), errmsg.AccessDenied), ShouldBeTrue)
+
+			c.So(roles.Grant(admin, member.ID, accesscontroller.RoleReader), ShouldBeNil)
+
+			_, err = memberLog.Append([]byte("one"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+
+			c.So(roles.Grant(admin, member.ID, accesscontroller.RoleWriter), ShouldBeNil)
+
+			// Writers aren't admins
+			err = roles.Grant(member, outsider.ID, accesscontroller.RoleWriter)
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+
+			_, err = memberLog.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			c.So(roles.Grant(admin, member.ID, accesscontroller.RoleAdmin), ShouldBeNil)
+			c.So(roles.Members(accesscontroller.RoleAdmin), ShouldHaveLength, 2)
+			c.So(roles.Revoke(member, admin.ID), ShouldBeNil)
+
+			// The last admin is kept
+			c.So(roles.Revoke(member, member.ID), ShouldNotBeNil)
+			c.So(roles.Grant(member, member.ID, accesscontroller.RoleWriter), ShouldNotBeNil)
+
+			_, ok := roles.Role(admin.ID)
+			c.So(ok, ShouldBeFalse)
+
+			adminLog, err := log.NewLog(ipfs, admin, &log.NewLogOptions{ID: "A", AccessController: roles})
+			c.So(err, ShouldBeNil)
+
+			_, err = adminLog.Append([]byte("two"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			// Entries claiming the ID of an admin are signed by its key
+			forged, err := forgeEntry(ipfs, keystore, member, outsider, "A", []byte("forged"))
+			c.So(err, ShouldBeNil)
+
+			err = roles.CanAppend(context.Background(), forged, member.Provider, memberLog)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+
+			c.So(roles.Grant(member, outsider.ID, "owner"), ShouldNotBeNil)
+		})
+
+		c.Convey("ucan", FailureHalts, func(c C) {
+			rootKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+			c.So(err, ShouldBeNil)
+
+			root, err := accesscontroller.DIDFromPublicKey(rootKey.GetPublic())
+			c.So(err, ShouldBeNil)
+			c.So(root, ShouldStartWith, "did:key:z6Mk")
+
+			didOf := func(identity *idp.Identity) string {
+				pubKey, err := identity.GetPublicKey()
+				c.So(err, ShouldBeNil)
+
+				did, err := accesscontroller.DIDFromPublicKey(pubKey)
+				c.So(err, ShouldBeNil)
+
+				return did
+			}
+
+			appendCap := []accesscontroller.UCANCapability{{With: "log:A", Can: accesscontroller.UCANAppendAbility}}
+			expiration := time.Now().Add(time.Hour).Unix()
+
+			ac := accesscontroller.NewUCANController(root, "log:A")
+			appendWith := func(identity *idp.Identity, token string) error {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = l.AppendWithOptions([]byte("one"), &log.AppendOptions{
+					PointerCount: 1,
+					Metadata:     map[string]string{accesscontroller.UCANMetadataKey: token},
+				})
+
+				return err
+			}
+
+			direct, err := (&accesscontroller.UCAN{
+				Audience:     didOf(identities[0]),
+				Capabilities: appendCap,
+				Expiration:   expiration,
+			}).Sign(rootKey)
+			c.So(err, ShouldBeNil)
+			c.So(appendWith(identities[0], direct), ShouldBeNil)
+
+			// The token is bound to its audience
+			err = appendWith(identities[1], direct)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+
+			l, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", AccessController: ac})
+			c.So(err, ShouldBeNil)
+			_, err = l.Append([]byte("one"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			// Delegated through a secp256k1 key
+			intermediateKey, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+			c.So(err, ShouldBeNil)
+
+			intermediate, err := accesscontroller.DIDFromPublicKey(intermediateKey.GetPublic())
+			c.So(err, ShouldBeNil)
+			c.So(intermediate, ShouldStartWith, "did:key:zQ3s")
+
+			proof, err := (&accesscontroller.UCAN{
+				Audience:     intermediate,
+				Capabilities: []accesscontroller.UCANCapability{{With: "log:A", Can: "*"}},
+				Expiration:   expiration,
+			}).Sign(rootKey)
+			c.So(err, ShouldBeNil)
+
+			delegated, err := (&accesscontroller.UCAN{
+				Audience:     didOf(identities[1]),
+				Capabilities: appendCap,
+				Expiration:   expiration,
+				Proofs:       []string{proof},
+			}).Sign(intermediateKey)
+			c.So(err, ShouldBeNil)
+
+			parsed, err := accesscontroller.ParseUCAN(delegated)
+			c.So(err, ShouldBeNil)
+			c.So(parsed.Issuer, ShouldEqual, intermediate)
+			c.So(appendWith(identities[1], delegated), ShouldBeNil)
+
+			// Chains have to start at the root
+			forged, err := (&accesscontroller.UCAN{
+				Audience:     didOf(identities[2]),
+				Capabilities: appendCap,
+				Expiration:   expiration,
+			}).Sign(intermediateKey)
+			c.So(err, ShouldBeNil)
+			c.So(appendWith(identities[2], forged), ShouldNotBeNil)
+
+			// Capabilities can't be widened
+			other, err := (&accesscontroller.UCAN{
+				Audience:     didOf(identities[2]),
+				Capabilities: []accesscontroller.UCANCapability{{With: "log:B", Can: accesscontroller.UCANAppendAbility}},
+				Expiration:   expiration,
+			}).Sign(rootKey)
+			c.So(err, ShouldBeNil)
+			c.So(appendWith(identities[2], other), ShouldNotBeNil)
+
+			// Tampered tokens are rejected
+			c.So(appendWith(identities[0], direct[:len(direct)-4]+"AAAA"), ShouldNotBeNil)
+
+			// Tokens are checked at the timestamp of the entries
+			hlcLog := func(identity *idp.Identity, offset time.Duration) *log.Log {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{
+					ID:               "A",
+					AccessController: ac,
+					ClockType:        hlc.Type,
+					Now:              func() time.Time { return time.Now().Add(offset) },
+				})
+				c.So(err, ShouldBeNil)
+
+				return l
+			}
+			appendOptions := &log.AppendOptions{
+				PointerCount: 1,
+				Metadata:     map[string]string{accesscontroller.UCANMetadataKey: delegated},
+			}
+
+			written := hlcLog(identities[1], 0)
+			_, err = written.AppendWithOptions([]byte("two"), appendOptions)
+			c.So(err, ShouldBeNil)
+
+			// Entries from the future are rejected
+			_, err = hlcLog(identities[1], 24*time.Hour).AppendWithOptions([]byte("three"), appendOptions)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, "future")
+
+			ac.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			err = appendWith(identities[1], delegated)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, "expired")
+
+			_, err = hlcLog(identities[1], 2*time.Hour).AppendWithOptions([]byte("three"), appendOptions)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, "expired")
+
+			// Entries written before the expiration can still be joined
+			reader := hlcLog(identities[0], 2*time.Hour)
+			_, err = reader.Join(written, -1)
+			c.So(err, ShouldBeNil)
+			c.So(reader.Values().Len(), ShouldEqual, 1)
+		})
+
+		c.Convey("composition", FailureHalts, func(c C) {
+			allowList := accesscontroller.NewIPFS([]string{identities[0].ID, identities[1].ID})
+			banned := accesscontroller.NewIPFS([]string{identities[1].ID})
+			writers := accesscontroller.NewIPFS([]string{identities[2].ID})
+
+			canAppend := func(ac accesscontroller.Interface, identity *idp.Identity) error {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = l.Append([]byte("one"), 1)
+
+				return err
+			}
+
+			policy := accesscontroller.AllOf(allowList, accesscontroller.Not(banned))
+			c.So(canAppend(policy, identities[0]), ShouldBeNil)
+			c.So(canAppend(policy, identities[1]), ShouldNotBeNil)
+			c.So(canAppend(policy, identities[2]), ShouldNotBeNil)
+
+			policy = accesscontroller.AnyOf(policy, writers)
+			c.So(canAppend(policy, identities[0]), ShouldBeNil)
+			c.So(canAppend(policy, identities[1]), ShouldNotBeNil)
+			c.So(canAppend(policy, identities[2]), ShouldBeNil)
+
+			err := canAppend(policy, identities[1])
+			c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+
+			c.So(canAppend(accesscontroller.AllOf(), identities[1]), ShouldBeNil)
+			c.So(canAppend(accesscontroller.AnyOf(), identities[1]), ShouldNotBeNil)
+
+			// Entries failing verification aren't allowed by a negation
+			forged, err := forgeEntry(ipfs, keystore, identities[1], identities[2], "A", []byte("forged"))
+			c.So(err, ShouldBeNil)
+
+			l, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			err = accesscontroller.Not(banned).CanAppend(context.Background(), forged, identities[0].Provider, l)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+		})
+
+		c.Convey("receives the state of the log", FailureHalts, func(c C) {
+			ac := &appendOnlyACL{}
+
+			l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", AccessController: ac})
+			c.So(err, ShouldBeNil)
+
+			_, err = l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			e2, err := l1.Append([]byte("two"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(ac.heads, ShouldHaveLength, 2)
+			c.So(ac.heads[1], ShouldHaveLength, 1)
+
+			// A concurrent entry can't be joined
+			l2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = l2.Append([]byte("fork"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = l1.Join(l2, -1)
+			c.So(err, ShouldNotBeNil)
+			c.So(l1.GetHeads(), ShouldHaveLength, 1)
+			c.So(l1.GetHeads()[0].GetHash().String(), ShouldEqual, e2.GetHash().String())
+		})
+
+		c.Convey("threshold", FailureHalts, func(c C) {
+			signers := []idp.Signer{}
+			keys := [][]byte{identities[0].PublicKey}
+			for i := 0; i < 3; i++ {
+				key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+				c.So(err, ShouldBeNil)
+
+				signer := idp.NewKeySigner(key)
+				signers = append(signers, signer)
+
+				pubKey, err := idp.SignerPublicKey(signer)
+				c.So(err, ShouldBeNil)
+				keys = append(keys, pubKey)
+			}
+
+			// The last signer isn't part of the set
+			ac, err := accesscontroller.NewThreshold(2, keys[:3])
+			c.So(err, ShouldBeNil)
+
+			_, err = accesscontroller.NewThreshold(4, keys[:3])
+			c.So(err, ShouldNotBeNil)
+
+			appendWith := func(identity *idp.Identity, coSigners ...idp.Signer) (*log.Log, error) {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = l.AppendWithOptions([]byte("one"), &log.AppendOptions{PointerCount: 1, CoSigners: coSigners})
+
+				return l, err
+			}
+
+			_, err = appendWith(identities[0])
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+
+			_, err = appendWith(identities[0], signers[2])
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+
+			_, err = appendWith(identities[1], signers[0], signers[0])
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+
+			_, err = appendWith(identities[1], signers[0], signers[1])
+			c.So(err, ShouldBeNil)
+
+			l1, err := appendWith(identities[0], signers[1])
+			c.So(err, ShouldBeNil)
+
+			// Co-signatures are stored with the entry
+			hash, err := l1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			l2, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{AccessController: ac}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			signed, err := entry.SignedKeys(l2.Values().At(0))
+			c.So(err, ShouldBeNil)
+			c.So(signed, ShouldResemble, [][]byte{keys[0], keys[2]})
+
+			l2.Values().At(0).(*entry.Entry).CoSignatures[0].Sig = l2.Values().At(0).GetSig()
+
+			l3, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A", AccessController: ac})
+			c.So(err, ShouldBeNil)
+
+			_, err = l3.Join(l2, -1)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+		})
+
+		c.Convey("permissions log", FailureHalts, func(c C) {
+			admin, writer, outsider := identities[0], identities[1], identities[2]
+			perms := accesscontroller.NewPermissions([]string{admin.ID})
+
+			permLog, err := log.NewLog(ipfs, admin, &log.NewLogOptions{ID: "perms", AccessController: perms.Admins()})
+			c.So(err, ShouldBeNil)
+
+			outsiderPermLog, err := log.NewLog(ipfs, outsider, &log.NewLogOptions{ID: "perms", AccessController: perms.Admins()})
+			c.So(err, ShouldBeNil)
+
+			_, err = outsiderPermLog.Append(accesscontroller.GrantPayload(outsider.ID), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+
+			data, err := log.NewLog(ipfs, writer, &log.NewLogOptions{ID: "A", AccessController: perms})
+			c.So(err, ShouldBeNil)
+
+			_, err = data.Append([]byte("denied"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			_, err = permLog.Append(accesscontroller.GrantPayload(writer.ID), 1)
+			c.So(err, ShouldBeNil)
+			c.So(perms.Update(permLog.Values().Slice()), ShouldBeNil)
+
+			one, err := data.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			outsiderData, err := log.NewLog(ipfs, outsider, &log.NewLogOptions{ID: "A", AccessController: perms})
+			c.So(err, ShouldBeNil)
+
+			_, err = outsiderData.Append([]byte("one"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			// The revocation keeps the entries of the data log its admin saw
+			_, err = permLog.Append(accesscontroller.RevokePayload(writer.ID, entryHashes(data.GetHeads())...), 1)
+			c.So(err, ShouldBeNil)
+
+			// Operations are only applied once
+			c.So(perms.Update(permLog.Values().Slice()), ShouldBeNil)
+			c.So(perms.Update(permLog.Values().Slice()), ShouldBeNil)
+
+			_, err = data.Append([]byte("two"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+
+			// Entries can't be backdated with a lower clock
+			backdated, err := log.NewLog(ipfs, writer, &log.NewLogOptions{ID: "A", AccessController: perms})
+			c.So(err, ShouldBeNil)
+
+			_, err = backdated.Append([]byte("backdated"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			// Entries written before the revocation are still valid
+			adminData, err := log.NewLog(ipfs, admin, &log.NewLogOptions{ID: "A", AccessController: perms})
+			c.So(err, ShouldBeNil)
+
+			_, err = adminData.Join(data, -1)
+			c.So(err, ShouldBeNil)
+			c.So(adminData.Values().Len(), ShouldEqual, 1)
+			c.So(perms.IsAllowed(one, adminData), ShouldBeTrue)
+
+			// A grant applies to the entries written after its heads
+			adminEntry, err := adminData.Append([]byte("admin"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(perms.IsAllowed(adminEntry, adminData), ShouldBeTrue)
+
+			_, err = permLog.Append(accesscontroller.GrantPayload(writer.ID, adminEntry.GetHash()), 1)
+			c.So(err, ShouldBeNil)
+			c.So(perms.Update(permLog.Values().Slice()), ShouldBeNil)
+
+			_, err = backdated.Append([]byte("concurrent"), 1)
+			c.So(err, ShouldNotBeNil)
+
+			_, err = data.Join(adminData, -1)
+			c.So(err, ShouldBeNil)
+
+			three, err := data.Append([]byte("three"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = adminData.Join(data, -1)
+			c.So(err, ShouldBeNil)
+			c.So(perms.IsAllowed(three, adminData), ShouldBeTrue)
+
+			// A forged admin can't grant itself write access
+			forged, err := forgeEntry(ipfs, keystore, admin, outsider, "perms", accesscontroller.GrantPayload(outsider.ID))
+			c.So(err, ShouldBeNil)
+
+			err = perms.Admins().CanAppend(context.Background(), forged, admin.Provider, permLog)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+
+			err = perms.Update([]iface.IPFSLogEntry{forged})
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+
+			outsiderLog, err := log.NewLog(ipfs, outsider, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			outsiderEntry, err := outsiderLog.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(perms.IsAllowed(outsiderEntry, outsiderLog), ShouldBeFalse)
+		})
+
+		c.Convey("ipfs", FailureHalts, func(c C) {
+			c.Convey("allows the identities of the stored allow-list", FailureHalts, func(c C) {
+				ac := accesscontroller.NewIPFS([]string{identities[0].ID, identities[1].ID})
+				c.So(ac.Address().Defined(), ShouldBeFalse)
+
+				address, err := ac.Save(ipfs)
+				c.So(err, ShouldBeNil)
+				c.So(ac.Address().String(), ShouldEqual, address.String())
+
+				loaded, err := accesscontroller.LoadIPFS(ipfs, address)
+				c.So(err, ShouldBeNil)
+				c.So(loaded.Write(), ShouldResemble, ac.Write())
+
+				l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", AccessController: loaded})
+				c.So(err, ShouldBeNil)
+
+				_, err = l1.Append([]byte("one"), 1)
+				c.So(err, ShouldBeNil)
+
+				l3, err := log.NewLog(ipfs, identities[2], &log.NewLogOptions{ID: "A", AccessController: loaded})
+				c.So(err, ShouldBeNil)
+
+				_, err = l3.Append([]byte("one"), 1)
+				c.So(err, ShouldNotBeNil)
+				c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+			})
+
+			c.Convey("rejects identities claiming an allowed ID", FailureHalts, func(c C) {
+				ac := accesscontroller.NewIPFS([]string{identities[0].ID})
+
+				l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				forged, err := forgeEntry(ipfs, keystore, identities[0], identities[2], "A", []byte("forged"))
+				c.So(err, ShouldBeNil)
+				c.So(forged.Verify(identities[0].Provider), ShouldBeNil)
+
+				err = ac.CanAppend(context.Background(), forged, identities[0].Provider, l1)
+				c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+
+				l2, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{forged})})
+				c.So(err, ShouldBeNil)
+
+				_, err = l1.Join(l2, -1)
+				c.So(err, ShouldNotBeNil)
+				c.So(l1.Values().Len(), ShouldEqual, 0)
+			})
+
+			c.Convey("allows every identity with a wildcard", FailureHalts, func(c C) {
+				ac := accesscontroller.NewIPFS([]string{"*"})
+
+				l3, err := log.NewLog(ipfs, identities[2], &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = l3.Append([]byte("one"), 1)
+				c.So(err, ShouldBeNil)
+			})
+
+			c.Convey("is recorded in the log manifest", FailureHalts, func(c C) {
+				ac := accesscontroller.NewIPFS([]string{identities[0].ID})
+				address, err := ac.Save(ipfs)
+				c.So(err, ShouldBeNil)
+
+				l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = l1.Append([]byte("one"), 1)
+				c.So(err, ShouldBeNil)
+
+				hash, err := l1.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				manifest, err := log.ReadJSONLog(ipfs, hash)
+				c.So(err, ShouldBeNil)
+				c.So(manifest.AccessController, ShouldEqual, io.CIDString(address))
+
+				for _, lazy := range []bool{false, true} {
+					l2, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{Lazy: lazy}, &log.FetchOptions{})
+					c.So(err, ShouldBeNil)
+					c.So(l2.Values().Len(), ShouldEqual, 1)
+
+					_, err = l2.Append([]byte("two"), 1)
+					c.So(err, ShouldNotBeNil)
+					c.So(err.Error(), ShouldContainSubstring, errmsg.AccessDenied.Error())
+				}
+			})
+		})
+	})
+}
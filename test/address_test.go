@@ -0,0 +1,136 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"testing"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/sorting"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAddress(t *testing.T) {
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Log addresses", t, FailureHalts, func(c C) {
+		c.Convey("are derived from the name and the access controller", FailureHalts, func(c C) {
+			acA := accesscontroller.NewIPFS([]string{identities[0].ID})
+			_, err := acA.Save(ipfs)
+			c.So(err, ShouldBeNil)
+
+			acB := accesscontroller.NewIPFS([]string{identities[1].ID})
+			_, err = acB.Save(ipfs)
+			c.So(err, ShouldBeNil)
+
+			addr, err := log.NewAddress("notes", acA)
+			c.So(err, ShouldBeNil)
+			c.So(addr.Name, ShouldEqual, "notes")
+
+			// Unsaved controllers don't have an address
+			_, err = log.NewAddress("notes", accesscontroller.NewIPFS([]string{identities[0].ID}))
+			c.So(err, ShouldNotBeNil)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidAddress)
+
+			loaded, err := accesscontroller.LoadIPFS(ipfs, acA.Address())
+			c.So(err, ShouldBeNil)
+
+			same, err := log.NewAddress("notes", loaded)
+			c.So(err, ShouldBeNil)
+			c.So(same.String(), ShouldEqual, addr.String())
+
+			other, err := log.NewAddress("notes", acB)
+			c.So(err, ShouldBeNil)
+			c.So(other.String(), ShouldNotEqual, addr.String())
+
+			other, err = log.NewAddress("todo", acA)
+			c.So(err, ShouldBeNil)
+			c.So(other.String(), ShouldNotEqual, addr.String())
+
+			// Replicas created independently can be joined
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{Name: "notes", AccessController: acA})
+			c.So(err, ShouldBeNil)
+			c.So(logA.ID, ShouldEqual, addr.String())
+
+			_, err = logA.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{Name: "notes", AccessController: loaded})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(logA, -1)
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+
+			c.So(log.VerifyAddress(logA.ID, loaded), ShouldBeNil)
+			c.So(log.VerifyAddress(logA.ID, acB), ShouldNotBeNil)
+
+			// The address is the one of the manifest of the log
+			manifest, err := logA.WriteManifest()
+			c.So(err, ShouldBeNil)
+			c.So(manifest.Equals(addr.Manifest), ShouldBeTrue)
+
+			m, err := log.ReadManifest(ipfs, addr.Manifest)
+			c.So(err, ShouldBeNil)
+			c.So(m.Name, ShouldEqual, "notes")
+			c.So(m.AccessController, ShouldEqual, io.CIDString(acA.Address()))
+
+			sorted, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{Name: "notes", AccessController: acA, SortName: sorting.FirstWriteWinsName})
+			c.So(err, ShouldBeNil)
+			c.So(sorted.ID, ShouldNotEqual, logA.ID)
+
+			sortedAddr, err := log.NewManifest("notes", acA, sorting.FirstWriteWinsName).Address()
+			c.So(err, ShouldBeNil)
+			c.So(sorted.ID, ShouldEqual, sortedAddr.String())
+
+			manifest, err = sorted.WriteManifest()
+			c.So(err, ShouldBeNil)
+			c.So(manifest.Equals(sortedAddr.Manifest), ShouldBeTrue)
+		})
+
+		c.Convey("are parsed and validated", FailureHalts, func(c C) {
+			addr, err := log.NewAddress("my/notes", nil)
+			c.So(err, ShouldBeNil)
+			c.So(addr.String(), ShouldStartWith, "/ipfs-log/")
+
+			parsed, err := log.ParseAddress(addr.String())
+			c.So(err, ShouldBeNil)
+			c.So(parsed.Name, ShouldEqual, "my/notes")
+			c.So(parsed.Manifest.Equals(addr.Manifest), ShouldBeTrue)
+			c.So(log.VerifyAddress(addr.String(), &accesscontroller.Default{}), ShouldBeNil)
+
+			for _, s := range []string{
+				"",
+				"notes",
+				"1571220000",
+				"/orbitdb/" + addr.Manifest.String() + "/notes",
+				"/ipfs-log/notacid/notes",
+				"/ipfs-log/" + addr.Manifest.String(),
+			} {
+				c.So(log.IsValidAddress(s), ShouldBeFalse)
+
+				_, err := log.ParseAddress(s)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidAddress)
+			}
+		})
+	})
+}
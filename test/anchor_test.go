@@ -0,0 +1,166 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/anchor"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryChain records digests, the receipt is the index of the commit
+type memoryChain struct {
+	lock    sync.Mutex
+	digests []string
+}
+
+func (m *memoryChain) Commit(_ context.Context, digest []byte) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.digests = append(m.digests, hex.EncodeToString(digest))
+
+	return []byte(fmt.Sprintf("%d", len(m.digests)-1)), nil
+}
+
+func (m *memoryChain) Verify(_ context.Context, digest []byte, receipt []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var i int
+	if _, err := fmt.Sscanf(string(receipt), "%d", &i); err != nil || i < 0 || i >= len(m.digests) {
+		return fmt.Errorf("unknown receipt")
+	}
+
+	if m.digests[i] != hex.EncodeToString(digest) {
+		return fmt.Errorf("digest mismatch")
+	}
+
+	return nil
+}
+
+func (m *memoryChain) commits() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.digests)
+}
+
+func TestAnchor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Anchoring", t, FailureHalts, func(c C) {
+		chain := &memoryChain{}
+
+		logA, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		c.Convey("proves the entries predate an anchor", FailureHalts, func(c C) {
+			a := anchor.New(logA, chain, nil)
+
+			_, err := a.Anchor(ctx)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidAnchor)
+
+			e1, err := logA.Append([]byte("hello1"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("hello2"), 1)
+			c.So(err, ShouldBeNil)
+
+			first, err := a.Anchor(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(chain.commits(), ShouldEqual, 1)
+
+			// Unchanged heads aren't committed again
+			same, err := a.Anchor(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(same, ShouldEqual, first)
+			c.So(chain.commits(), ShouldEqual, 1)
+
+			var e3 cid.Cid
+			c.So(a.Do(func(l *log.Log) error {
+				e, err := l.Append([]byte("hello3"), 1)
+				e3 = e.GetHash()
+				return err
+			}), ShouldBeNil)
+
+			second, err := a.Anchor(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(second, ShouldNotEqual, first)
+			c.So(a.Last(), ShouldEqual, second)
+			c.So(chain.commits(), ShouldEqual, 2)
+
+			proof, err := anchor.Prove(logA, first, e1.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(anchor.VerifyPredates(ctx, chain, first, e1.GetHash(), proof), ShouldBeNil)
+			c.So(anchor.VerifyPredates(ctx, chain, first, e3, proof), ShouldNotBeNil)
+
+			// The last entry was written after the first anchor
+			_, err = anchor.Prove(logA, first, e3)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.EntryNotFound)
+
+			proof, err = anchor.Prove(logA, second, e3)
+			c.So(err, ShouldBeNil)
+			c.So(anchor.VerifyPredates(ctx, chain, second, e3, proof), ShouldBeNil)
+
+			err = anchor.VerifyPredates(ctx, chain, first, e3, proof)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidProof)
+
+			// The heads of an anchor can't be replaced
+			forged := *first
+			forged.Heads = second.Heads
+			err = anchor.VerifyPredates(ctx, chain, &forged, e3, proof)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidAnchor)
+		})
+
+		c.Convey("anchors the heads periodically", FailureHalts, func(c C) {
+			anchors := make(chan *anchor.Anchor, 16)
+			a := anchor.New(logA, chain, &anchor.Options{
+				Interval: 10 * time.Millisecond,
+				OnAnchor: func(a *anchor.Anchor) { anchors <- a },
+			})
+			a.Start(ctx)
+			defer a.Close()
+
+			c.So(a.Do(func(l *log.Log) error {
+				_, err := l.Append([]byte("hello"), 1)
+				return err
+			}), ShouldBeNil)
+
+			select {
+			case received := <-anchors:
+				c.So(anchor.Digest("X", received.Heads), ShouldResemble, received.Digest())
+				c.So(chain.Verify(ctx, received.Digest(), received.Receipt), ShouldBeNil)
+			case <-ctx.Done():
+				c.So(ctx.Err(), ShouldBeNil)
+			}
+
+			c.So(a.Close(), ShouldBeNil)
+			c.So(chain.commits(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/codec"
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type codecTestValue struct {
+	Title string
+	Count int
+}
+
+func TestPayloadCodec(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       fmt.Sprintf("userA"),
+		Type:     "orbitdb",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Payload codec", t, FailureHalts, func(c C) {
+		c.Convey("appends and decodes JSON values", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			e, err := log1.AppendValue(&codecTestValue{Title: "hello", Count: 2})
+			c.So(err, ShouldBeNil)
+			c.So(e.GetPayloadCodec(), ShouldEqual, codec.JSONName)
+
+			fetched, err := entry.FromMultihash(ipfs, e.GetHash(), identity.Provider)
+			c.So(err, ShouldBeNil)
+
+			value := &codecTestValue{}
+			c.So(fetched.DecodedPayload(value), ShouldBeNil)
+			c.So(value, ShouldResemble, &codecTestValue{Title: "hello", Count: 2})
+		})
+
+		c.Convey("uses the log codec", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", Codec: &codec.CBOR{}})
+			c.So(err, ShouldBeNil)
+
+			e, err := log1.AppendValue(map[string]interface{}{"title": "hello"})
+			c.So(err, ShouldBeNil)
+			c.So(e.GetPayloadCodec(), ShouldEqual, codec.CBORName)
+
+			value := map[string]interface{}{}
+			c.So(entry.DecodePayload(e, &value), ShouldBeNil)
+			c.So(value["title"], ShouldEqual, "hello")
+		})
+
+		c.Convey("decodes entries without codec as raw payloads", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			e, err := log1.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			value := ""
+			c.So(entry.DecodePayload(e, &value), ShouldBeNil)
+			c.So(value, ShouldEqual, "hello")
+		})
+
+		c.Convey("fails on unknown codecs", FailureHalts, func(c C) {
+			_, err := codec.Get("unknown")
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,305 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	goio "io"
+	"io/ioutil"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryCoreAPI is a CoreAPI only implementing the DAG, block and pin APIs
+// on top of in-memory services
+type memoryCoreAPI struct {
+	coreiface.CoreAPI
+	services io.IpfsServices
+	pins     *memoryPinAPI
+}
+
+func (a *memoryCoreAPI) Dag() coreiface.APIDagService {
+	return &memoryDagAPI{DAGService: a.services.DAG()}
+}
+
+func (a *memoryCoreAPI) Block() coreiface.BlockAPI {
+	return &memoryBlockAPI{services: a.services}
+}
+
+func (a *memoryCoreAPI) Pin() coreiface.PinAPI {
+	return a.pins
+}
+
+type memoryDagAPI struct {
+	ipld.DAGService
+}
+
+func (d *memoryDagAPI) Pinning() ipld.NodeAdder {
+	return d.DAGService
+}
+
+type memoryBlockStat struct {
+	c    cid.Cid
+	size int
+}
+
+func (s *memoryBlockStat) Size() int                    { return s.size }
+func (s *memoryBlockStat) Path() coreiface.ResolvedPath { return coreiface.IpldPath(s.c) }
+
+type memoryBlockAPI struct {
+	services io.IpfsServices
+}
+
+func (b *memoryBlockAPI) Put(ctx context.Context, r goio.Reader, opts ...options.BlockPutOption) (coreiface.BlockStat, error) {
+	_, prefix, err := options.BlockPutOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := prefix.Sum(data)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.services.BlockStore().Put(block); err != nil {
+		return nil, err
+	}
+
+	return &memoryBlockStat{c: c, size: len(data)}, nil
+}
+
+func (b *memoryBlockAPI) Get(ctx context.Context, p coreiface.Path) (goio.Reader, error) {
+	block, err := b.services.BlockStore().Get(p.(coreiface.ResolvedPath).Cid())
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(block.RawData()), nil
+}
+
+func (b *memoryBlockAPI) Rm(ctx context.Context, p coreiface.Path, opts ...options.BlockRmOption) error {
+	return b.services.BlockStore().DeleteBlock(p.(coreiface.ResolvedPath).Cid())
+}
+
+func (b *memoryBlockAPI) Stat(ctx context.Context, p coreiface.Path) (coreiface.BlockStat, error) {
+	c := p.(coreiface.ResolvedPath).Cid()
+
+	size, err := b.services.BlockStore().GetSize(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryBlockStat{c: c, size: size}, nil
+}
+
+type memoryPin struct {
+	c       cid.Cid
+	pinType string
+}
+
+func (p *memoryPin) Path() coreiface.ResolvedPath { return coreiface.IpldPath(p.c) }
+func (p *memoryPin) Type() string                 { return p.pinType }
+
+// memoryPinAPI keeps the direct and recursive pins in memory
+type memoryPinAPI struct {
+	coreiface.PinAPI
+	pins map[cid.Cid]string
+}
+
+func (a *memoryPinAPI) Add(ctx context.Context, p coreiface.Path, opts ...options.PinAddOption) error {
+	settings, err := options.PinAddOptions(opts...)
+	if err != nil {
+		return err
+	}
+
+	pinType := "direct"
+	if settings.Recursive {
+		pinType = "recursive"
+	}
+
+	a.pins[p.(coreiface.ResolvedPath).Cid()] = pinType
+
+	return nil
+}
+
+func (a *memoryPinAPI) Ls(ctx context.Context, opts ...options.PinLsOption) ([]coreiface.Pin, error) {
+	settings, err := options.PinLsOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pins := []coreiface.Pin{}
+	for c, pinType := range a.pins {
+		if settings.Type == "all" || settings.Type == pinType {
+			pins = append(pins, &memoryPin{c: c, pinType: pinType})
+		}
+	}
+
+	return pins, nil
+}
+
+func (a *memoryPinAPI) Rm(ctx context.Context, p coreiface.Path, opts ...options.PinRmOption) error {
+	c := p.(coreiface.ResolvedPath).Cid()
+	if _, ok := a.pins[c]; !ok {
+		return fmt.Errorf("%s is not pinned", c)
+	}
+
+	delete(a.pins, c)
+
+	return nil
+}
+
+// unreachableBlockAPI is a block API failing to reach the node
+type unreachableBlockAPI struct {
+	coreiface.BlockAPI
+}
+
+func (b *unreachableBlockAPI) Stat(ctx context.Context, p coreiface.Path) (coreiface.BlockStat, error) {
+	return nil, errors.New("connection refused")
+}
+
+type unreachableCoreAPI struct {
+	coreiface.CoreAPI
+}
+
+func (a *unreachableCoreAPI) Dag() coreiface.APIDagService {
+	return nil
+}
+
+func (a *unreachableCoreAPI) Block() coreiface.BlockAPI {
+	return &unreachableBlockAPI{}
+}
+
+func (a *unreachableCoreAPI) Pin() coreiface.PinAPI {
+	return nil
+}
+
+func TestCoreAPIServices(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("CoreAPI services", t, FailureHalts, func(c C) {
+		c.Convey("stores logs through the core API", FailureHalts, func(c C) {
+			node := io.NewMemoryServices()
+			services := io.NewCoreAPIServices(&memoryCoreAPI{services: node, pins: &memoryPinAPI{pins: map[cid.Cid]string{}}})
+
+			logA, err := log.NewLog(services, identity, &log.NewLogOptions{ID: "X", PayloadThreshold: 8})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello world %d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			for _, e := range logA.Values().Slice() {
+				ok, err := node.BlockStore().Has(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+			}
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewFromMultihash(services, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+			c.So(string(logB.Values().At(2).GetPayload()), ShouldEqual, "hello world 2")
+		})
+
+		c.Convey("reads and writes raw blocks", FailureHalts, func(c C) {
+			node := io.NewMemoryServices()
+			services := io.NewCoreAPIServices(&memoryCoreAPI{services: node, pins: &memoryPinAPI{pins: map[cid.Cid]string{}}})
+
+			for _, prefix := range []cid.Prefix{
+				io.DefaultPrefix,
+				{Version: 1, Codec: cid.Raw, MhType: 0x12, MhLength: -1},
+				{Version: 0, Codec: cid.DagProtobuf, MhType: 0x12, MhLength: -1},
+			} {
+				c1, err := prefix.Sum([]byte("hello"))
+				c.So(err, ShouldBeNil)
+
+				block, err := blocks.NewBlockWithCid([]byte("hello"), c1)
+				c.So(err, ShouldBeNil)
+				c.So(services.BlockStore().Put(block), ShouldBeNil)
+
+				stored, err := services.BlockStore().Get(c1)
+				c.So(err, ShouldBeNil)
+				c.So(stored.RawData(), ShouldResemble, []byte("hello"))
+
+				size, err := services.BlockStore().GetSize(c1)
+				c.So(err, ShouldBeNil)
+				c.So(size, ShouldEqual, 5)
+
+				c.So(services.BlockStore().DeleteBlock(c1), ShouldBeNil)
+				ok, err := services.BlockStore().Has(c1)
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeFalse)
+			}
+		})
+
+		c.Convey("pins blocks through the core API", FailureHalts, func(c C) {
+			node := io.NewMemoryServices()
+			pins := &memoryPinAPI{pins: map[cid.Cid]string{}}
+			services := io.NewCoreAPIServices(&memoryCoreAPI{services: node, pins: pins})
+
+			l, err := log.NewLog(services, identity, &log.NewLogOptions{ID: "X", PayloadThreshold: 8, Pin: true})
+			c.So(err, ShouldBeNil)
+
+			e, err := l.AppendWithOptions([]byte("hello world"), &log.AppendOptions{PointerCount: 1})
+			c.So(err, ShouldBeNil)
+			c.So(pins.pins, ShouldResemble, map[cid.Cid]string{e.GetHash(): "direct", e.GetPayloadRef(): "recursive"})
+
+			ctx := context.Background()
+
+			ok, err := services.Pinner().IsPinned(ctx, e.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+
+			c.So(services.Pinner().Unpin(ctx, e.GetHash()), ShouldBeNil)
+			c.So(services.Pinner().Unpin(ctx, e.GetHash()), ShouldBeNil)
+
+			ok, err = services.Pinner().IsPinned(ctx, e.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeFalse)
+		})
+
+		c.Convey("reports the errors of the node", FailureHalts, func(c C) {
+			services := io.NewCoreAPIServices(&unreachableCoreAPI{})
+
+			c1, err := io.DefaultPrefix.Sum([]byte("hello"))
+			c.So(err, ShouldBeNil)
+
+			_, err = services.BlockStore().Has(c1)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,156 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDenylist(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Denylist", t, FailureHalts, func(c C) {
+		var entries []iface.IPFSLogEntry
+
+		logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 3; i++ {
+			e, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+			c.So(err, ShouldBeNil)
+			entries = append(entries, e)
+		}
+
+		c.Convey("skips denied entries and their parents when joining", FailureHalts, func(c C) {
+			denylist := entry.NewDenylist()
+			denylist.DenyEntry(entries[1].GetHash())
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X", Denylist: denylist})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(logA, -1)
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+			c.So(logB.Has(entries[2].GetHash()), ShouldBeTrue)
+			c.So(logB.Has(entries[1].GetHash()), ShouldBeFalse)
+			c.So(logB.Has(entries[0].GetHash()), ShouldBeFalse)
+			c.So(entryHashes(logB.GetHeads()), ShouldResemble, entryHashes(entries[2:]))
+
+			// Entries referencing a denied ancestor can still be extended
+			e, err := logB.Append([]byte("helloB0"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 2)
+			c.So(entryHashes(logB.GetHeads()), ShouldResemble, entryHashes([]iface.IPFSLogEntry{e}))
+
+			// Denied heads aren't merged
+			denylist.DenyEntry(entries[2].GetHash())
+			logC, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X", Denylist: denylist})
+			c.So(err, ShouldBeNil)
+
+			_, err = logC.Join(logA, -1)
+			c.So(err, ShouldBeNil)
+			c.So(logC.Values().Len(), ShouldEqual, 0)
+			c.So(len(logC.GetHeads()), ShouldEqual, 0)
+		})
+
+		c.Convey("skips the entries of denied authors", FailureHalts, func(c C) {
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(logA, -1)
+			c.So(err, ShouldBeNil)
+
+			eB, err := logB.Append([]byte("helloB0"), 1)
+			c.So(err, ShouldBeNil)
+
+			byID := entry.NewDenylist()
+			byID.DenyAuthor(identities[0].ID)
+
+			byKey := entry.NewDenylist()
+			byKey.DenyKey(identities[0].PublicKey)
+
+			for _, denylist := range []*entry.MemoryDenylist{byID, byKey} {
+				c.So(entry.IsDenied(denylist, entries[0]), ShouldBeTrue)
+				c.So(entry.IsDenied(denylist, eB), ShouldBeFalse)
+
+				logC, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X", Denylist: denylist})
+				c.So(err, ShouldBeNil)
+
+				_, err = logC.Join(logB, -1)
+				c.So(err, ShouldBeNil)
+				c.So(logC.Values().Len(), ShouldEqual, 1)
+				c.So(logC.Has(eB.GetHash()), ShouldBeTrue)
+			}
+
+			c.So(entry.IsDenied(nil, eB), ShouldBeFalse)
+		})
+
+		c.Convey("doesn't fetch denied entries", FailureHalts, func(c C) {
+			denylist := entry.NewDenylist()
+			denylist.DenyEntry(entries[1].GetHash())
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X", Denylist: denylist})
+			c.So(err, ShouldBeNil)
+
+			events := make(chan log.SyncEvent, 64)
+			added, err := logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Events: events})
+			c.So(err, ShouldBeNil)
+			close(events)
+
+			c.So(entryHashes(added), ShouldResemble, entryHashes(entries[2:]))
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+
+			denied := 0
+			for e := range events {
+				c.So(e.Hash, ShouldNotResemble, entries[0].GetHash())
+				if e.Type == log.SyncFailed {
+					c.So(e.Hash, ShouldResemble, entries[1].GetHash())
+					c.So(e.Err, ShouldEqual, errmsg.EntryDenied)
+					denied++
+				}
+			}
+			c.So(denied, ShouldEqual, 1)
+
+			// Loading a log skips the denied entries too
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			logC, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{Denylist: denylist}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logC.Values().Len(), ShouldEqual, 1)
+			c.So(logC.Has(entries[2].GetHash()), ShouldBeTrue)
+
+			logD, err := log.NewFromEntryHash(ipfs, identities[1], entries[2].GetHash(), &log.NewLogOptions{ID: "X", Denylist: denylist}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logD.Values().Len(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,228 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/discovery"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryDHT records the CIDs provided by its peers
+type memoryDHT struct {
+	lock      sync.Mutex
+	providers map[string][]peer.ID
+	provided  chan string
+}
+
+type memoryDHTPeer struct {
+	dht *memoryDHT
+	id  peer.ID
+}
+
+func newMemoryDHT() *memoryDHT {
+	return &memoryDHT{providers: map[string][]peer.ID{}, provided: make(chan string, 64)}
+}
+
+func (d *memoryDHT) Peer(id string) coreiface.DhtAPI {
+	return &memoryDHTPeer{dht: d, id: peer.ID(id)}
+}
+
+func (p *memoryDHTPeer) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	return pstore.PeerInfo{ID: id}, nil
+}
+
+func (p *memoryDHTPeer) FindProviders(ctx context.Context, path coreiface.Path, opts ...options.DhtFindProvidersOption) (<-chan pstore.PeerInfo, error) {
+	settings, err := options.DhtFindProvidersOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.dht.lock.Lock()
+	defer p.dht.lock.Unlock()
+
+	providers := p.dht.providers[path.String()]
+	if len(providers) > settings.NumProviders {
+		providers = providers[:settings.NumProviders]
+	}
+
+	out := make(chan pstore.PeerInfo, len(providers))
+	for _, id := range providers {
+		out <- pstore.PeerInfo{ID: id}
+	}
+	close(out)
+
+	return out, nil
+}
+
+func (p *memoryDHTPeer) Provide(ctx context.Context, path coreiface.Path, opts ...options.DhtProvideOption) error {
+	p.dht.lock.Lock()
+	p.dht.providers[path.String()] = append(p.dht.providers[path.String()], p.id)
+	p.dht.lock.Unlock()
+
+	p.dht.provided <- path.String()
+
+	return nil
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	waitProvided := func(dht *memoryDHT, path string) bool {
+		for {
+			select {
+			case p := <-dht.provided:
+				if p == path {
+					return true
+				}
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	Convey("Discovery", t, FailureHalts, func(c C) {
+		c.Convey("derives a key from the log ID", FailureHalts, func(c C) {
+			keyX, err := discovery.Key("X")
+			c.So(err, ShouldBeNil)
+
+			keyX2, err := discovery.Key("X")
+			c.So(err, ShouldBeNil)
+
+			keyY, err := discovery.Key("Y")
+			c.So(err, ShouldBeNil)
+
+			c.So(keyX.String(), ShouldEqual, keyX2.String())
+			c.So(keyX.String(), ShouldNotEqual, keyY.String())
+		})
+
+		c.Convey("finds the peers announcing a log", FailureHalts, func(c C) {
+			dht := newMemoryDHT()
+			ipfs := io.NewMemoryServices()
+
+			key, err := discovery.Key("X")
+			c.So(err, ShouldBeNil)
+
+			for _, id := range []string{"A", "B", "C"} {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+				c.So(err, ShouldBeNil)
+
+				a, err := discovery.NewAnnouncer(ctx, dht.Peer(id), l, nil)
+				c.So(err, ShouldBeNil)
+				defer a.Close()
+
+				c.So(waitProvided(dht, coreiface.IpldPath(key).String()), ShouldBeTrue)
+			}
+
+			// The key block is stored so the node can provide it
+			has, err := ipfs.BlockStore().Has(key)
+			c.So(err, ShouldBeNil)
+			c.So(has, ShouldBeTrue)
+
+			peers, err := discovery.FindPeers(ctx, dht.Peer("D"), "X", 2)
+			c.So(err, ShouldBeNil)
+
+			found := []string{}
+			for p := range peers {
+				found = append(found, string(p.ID))
+			}
+			c.So(found, ShouldResemble, []string{"A", "B"})
+
+			peers, err = discovery.FindPeers(ctx, dht.Peer("D"), "Y", 0)
+			c.So(err, ShouldBeNil)
+			_, ok := <-peers
+			c.So(ok, ShouldBeFalse)
+		})
+
+		c.Convey("provides the heads on append", FailureHalts, func(c C) {
+			dht := newMemoryDHT()
+
+			l, err := log.NewLog(io.NewMemoryServices(), identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			a, err := discovery.NewAnnouncer(ctx, dht.Peer("A"), l, &discovery.AnnouncerOptions{Heads: true})
+			c.So(err, ShouldBeNil)
+			defer a.Close()
+
+			for i := 0; i < 3; i++ {
+				e, err := l.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+
+				c.So(waitProvided(dht, coreiface.IpldPath(e.GetHash()).String()), ShouldBeTrue)
+			}
+
+			c.So(a.Close(), ShouldBeNil)
+
+			// Nothing is provided once closed
+			_, err = l.Append([]byte("hello3"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(len(dht.provided), ShouldEqual, 0)
+		})
+
+		c.Convey("rate limits the heads provided on append and join", FailureHalts, func(c C) {
+			dht := newMemoryDHT()
+			ipfs := io.NewMemoryServices()
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			a, err := discovery.NewAnnouncer(ctx, dht.Peer("A"), l, &discovery.AnnouncerOptions{
+				Heads:   true,
+				Limiter: ratelimit.New(20, 1),
+			})
+			c.So(err, ShouldBeNil)
+			defer a.Close()
+
+			start := time.Now()
+
+			var last iface.IPFSLogEntry
+			for i := 0; i < 10; i++ {
+				last, err = l.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(waitProvided(dht, coreiface.IpldPath(last.GetHash()).String()), ShouldBeTrue)
+			c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 40*time.Millisecond)
+
+			// The intermediate heads were skipped
+			dht.lock.Lock()
+			c.So(len(dht.providers), ShouldBeLessThan, 11)
+			dht.lock.Unlock()
+
+			other, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			e, err := other.Append([]byte("other"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = l.Join(other, -1)
+			c.So(err, ShouldBeNil)
+			c.So(waitProvided(dht, coreiface.IpldPath(e.GetHash()).String()), ShouldBeTrue)
+		})
+	})
+}
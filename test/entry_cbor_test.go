@@ -0,0 +1,184 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"math"
+	"testing"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/utils/hlc"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEntryCBOR(t *testing.T) {
+	Convey("Entry CBOR", t, FailureHalts, func(c C) {
+		link, err := cid.Decode("zdpuAsPdzSyeux5mFsFV1y3WeHAShGNi4xo22cYBYWUdPtxVB")
+		c.So(err, ShouldBeNil)
+
+		identity := &idp.CborIdentity{
+			ID:         "userA",
+			Type:       "orbitdb",
+			PublicKey:  "0123",
+			Signatures: &idp.CborIdentitySignature{ID: "sig-id", PublicKey: "sig-key"},
+			Rotations: []*idp.CborKeyRotation{
+				{PreviousKey: "a", NextKey: "b", PreviousSignature: "c", NextSignature: "d"},
+				nil,
+			},
+			Delegations: []*idp.CborKeyDelegation{{Issuer: "a", Delegate: "b", Signature: "c"}},
+		}
+
+		full := &entry.CborEntry{
+			V:                  2,
+			LogID:              "A",
+			Key:                "abcd",
+			Sig:                "ef01",
+			Next:               []cid.Cid{link, link},
+			Clock:              &lamportclock.CborLamportClock{ID: "abcd", Time: 300},
+			Payload:            "hello world",
+			Identity:           identity,
+			Metadata:           map[string]string{"bb": "1", "a": "2", "ab": "3", "ccc": ""},
+			PayloadCodec:       "json",
+			PayloadRef:         &link,
+			PayloadCompression: "gzip",
+			PayloadKeyID:       "key",
+			ClockType:          "vector",
+			VectorClock:        map[string]int{"zz": 1, "y": -5, "aaa": math.MaxInt32 + 1},
+			HLC:                &hlc.Timestamp{Wall: 1 << 40, Logical: 3},
+			Timestamp:          -1000,
+			CoSignatures:       []*entry.CborCoSignature{{Key: "01", Sig: "02"}, nil},
+		}
+
+		cases := map[string]*entry.CborEntry{
+			"an empty entry":  {},
+			"a full entry":    full,
+			"empty fields":    {Next: []cid.Cid{}, Metadata: map[string]string{}, VectorClock: map[string]int{}, CoSignatures: []*entry.CborCoSignature{}, HLC: &hlc.Timestamp{}, Clock: &lamportclock.CborLamportClock{}, Identity: &idp.CborIdentity{Rotations: []*idp.CborKeyRotation{}}},
+			"binary payloads": {V: 2, Payload: string([]byte{0xff, 0x00, 0xfe}), Next: []cid.Cid{link}},
+			"large values":    {V: math.MaxUint64, Payload: string(make([]byte, 70000)), Timestamp: math.MinInt64, Clock: &lamportclock.CborLamportClock{Time: math.MaxInt64}},
+		}
+
+		// The CIDs of the entries as encoded with the refmt atlases
+		expectedHashes := map[string]string{
+			"an empty entry":  "zdpuAykcufurGzi3AvzLqWZLG1XFNmer3hKJTtefV6TEjRDeq",
+			"a full entry":    "zdpuAo5DeDucQqEV3eB925KR3mimckzN18W45GPxob9tiYGX9",
+			"empty fields":    "zdpuAt5iygA585jTMJ7hhXQp5QKzvf3hXsoSEKa8AMMrkDZDU",
+			"binary payloads": "zdpuAq55skTzUPtQb9WHtcfrZudoxBjHTrLMrjF2YAQorFAyP",
+			"large values":    "zdpuArJFXsZEC1Hy7sAY3vAwghRsFoXKuSWEZsnJLYAA6BSep",
+		}
+
+		for name, e := range cases {
+			name, e := name, e
+			c.Convey("encodes and decodes "+name+" with the same CID", FailureHalts, func(c C) {
+				data, err := e.MarshalCBOR()
+				c.So(err, ShouldBeNil)
+				c.So(entry.IsCanonical(data), ShouldBeNil)
+
+				hash, err := io.DefaultPrefix.Sum(data)
+				c.So(err, ShouldBeNil)
+				c.So(io.CIDString(hash), ShouldEqual, expectedHashes[name])
+
+				decoded := &entry.CborEntry{}
+				c.So(decoded.UnmarshalCBOR(data), ShouldBeNil)
+
+				encoded, err := decoded.MarshalCBOR()
+				c.So(err, ShouldBeNil)
+				c.So(encoded, ShouldResemble, data)
+			})
+		}
+
+		c.Convey("decodes every field", FailureHalts, func(c C) {
+			data, err := full.MarshalCBOR()
+			c.So(err, ShouldBeNil)
+
+			decoded := &entry.CborEntry{}
+			c.So(decoded.UnmarshalCBOR(data), ShouldBeNil)
+			c.So(decoded, ShouldResemble, full)
+		})
+
+		c.Convey("checks the encoding is canonical", FailureHalts, func(c C) {
+			c.So(entry.IsCanonical([]byte{0xa2, 0x61, 'a', 0x01, 0x62, 'a', 'a', 0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), ShouldBeNil)
+			c.So(entry.IsCanonical([]byte{0xa2, 0x61, 'b', 0x01, 0x61, 'a', 0x02}), ShouldEqual, errmsg.NotCanonical)
+			c.So(entry.IsCanonical([]byte{0xa2, 0x62, 'a', 'a', 0x01, 0x61, 'b', 0x02}), ShouldEqual, errmsg.NotCanonical)
+			c.So(entry.IsCanonical([]byte{0xa1, 0x61, 'a', 0x18, 0x01}), ShouldEqual, errmsg.NotCanonical)
+			c.So(entry.IsCanonical([]byte{0xbf, 0x61, 'a', 0x01, 0xff}), ShouldEqual, errmsg.NotCanonical)
+			c.So(entry.IsCanonical([]byte{0xa1, 0x61, 'a', 0x01, 0x00}), ShouldNotBeNil)
+		})
+
+		c.Convey("rejects what it can't encode or decode", FailureHalts, func(c C) {
+			_, err := (&entry.CborEntry{Next: []cid.Cid{{}}}).MarshalCBOR()
+			c.So(err, ShouldNotBeNil)
+
+			_, err = (&entry.CborEntry{Hash: "hash"}).MarshalCBOR()
+			c.So(err, ShouldNotBeNil)
+
+			unknown, err := cbornode.DumpObject(map[string]interface{}{"v": 1, "unknown": "field"})
+			c.So(err, ShouldBeNil)
+			c.So((&entry.CborEntry{}).UnmarshalCBOR(unknown), ShouldNotBeNil)
+
+			withHash, err := cbornode.DumpObject(map[string]interface{}{"v": 1, "hash": "hash"})
+			c.So(err, ShouldBeNil)
+			c.So((&entry.CborEntry{}).UnmarshalCBOR(withHash), ShouldNotBeNil)
+
+			negative, err := cbornode.DumpObject(map[string]interface{}{"v": -1})
+			c.So(err, ShouldBeNil)
+			c.So((&entry.CborEntry{}).UnmarshalCBOR(negative), ShouldNotBeNil)
+
+			wrongKind, err := cbornode.DumpObject(map[string]interface{}{"v": "1"})
+			c.So(err, ShouldBeNil)
+			c.So((&entry.CborEntry{}).UnmarshalCBOR(wrongKind), ShouldNotBeNil)
+
+			data, err := full.MarshalCBOR()
+			c.So(err, ShouldBeNil)
+
+			decoded := &entry.CborEntry{}
+			c.So(decoded.UnmarshalCBOR(append(data, 0x00)), ShouldNotBeNil)
+			c.So(decoded, ShouldResemble, &entry.CborEntry{})
+		})
+	})
+}
+
+func BenchmarkEntryCBOR(b *testing.B) {
+	link, err := cid.Decode("zdpuAsPdzSyeux5mFsFV1y3WeHAShGNi4xo22cYBYWUdPtxVB")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := &entry.CborEntry{
+		V:        2,
+		LogID:    "A",
+		Key:      "abcd",
+		Sig:      "ef01",
+		Next:     []cid.Cid{link},
+		Clock:    &lamportclock.CborLamportClock{ID: "abcd", Time: 300},
+		Payload:  "hello world",
+		Identity: &idp.CborIdentity{ID: "userA", Type: "orbitdb", PublicKey: "0123", Signatures: &idp.CborIdentitySignature{ID: "a", PublicKey: "b"}},
+	}
+
+	data, err := e.MarshalCBOR()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := e.MarshalCBOR(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := (&entry.CborEntry{}).UnmarshalCBOR(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,17 +1,24 @@
 package test // import "berty.tech/go-ipfs-log/test"
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	cid "github.com/ipfs/go-cid"
 	dssync "github.com/ipfs/go-datastore/sync"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -45,7 +52,7 @@ func TestEntry(t *testing.T) {
 				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil)
 				c.So(err, ShouldBeNil)
 
-				c.So(e.Hash.String(), ShouldEqual, expectedHash)
+				c.So(io.CIDString(e.Hash), ShouldEqual, expectedHash)
 				c.So(e.LogID, ShouldEqual, "A")
 				c.So(e.Clock.ID, ShouldResemble, identity.PublicKey)
 				c.So(e.Clock.Time, ShouldEqual, 0)
@@ -65,7 +72,7 @@ func TestEntry(t *testing.T) {
 				c.So(e.Clock.Time, ShouldEqual, 0)
 				c.So(e.V, ShouldEqual, 1)
 				c.So(len(e.Next), ShouldEqual, 0)
-				c.So(e.Hash.String(), ShouldEqual, expectedHash)
+				c.So(io.CIDString(e.Hash), ShouldEqual, expectedHash)
 			})
 
 			c.Convey("creates an entry with payload and next", FailureContinues, func(c C) {
@@ -80,7 +87,7 @@ func TestEntry(t *testing.T) {
 
 				c.So(string(e2.Payload), ShouldEqual, payload2)
 				c.So(len(e2.Next), ShouldEqual, 1)
-				c.So(e2.Hash.String(), ShouldEqual, expectedHash)
+				c.So(io.CIDString(e2.Hash), ShouldEqual, expectedHash)
 				c.So(e2.Clock.ID, ShouldResemble, identity.PublicKey)
 				c.So(e2.Clock.Time, ShouldEqual, 1)
 			})
@@ -91,7 +98,240 @@ func TestEntry(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				c.So(e.Hash.String(), ShouldEqual, e.Hash.String())
-				c.So(e.Hash.String(), ShouldEqual, expectedHash)
+				c.So(io.CIDString(e.Hash), ShouldEqual, expectedHash)
+			})
+
+			c.Convey("creates an entry with signed metadata", FailureContinues, func(c C) {
+				metadata := map[string]string{"content-type": "text/plain", "schema": "1"}
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A", Metadata: metadata}, nil)
+				c.So(err, ShouldBeNil)
+				c.So(e.Hash.String(), ShouldNotEqual, "zdpuArzxF8fqM5E1zE9TgENc6fHqPXBgMKexM4SfoworsKYnt")
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.Metadata, ShouldResemble, metadata)
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+
+				fetched.Metadata["schema"] = "2"
+				c.So(entry.Verify(identity.Provider, fetched), ShouldNotBeNil)
+			})
+
+			c.Convey("caches successful verifications", FailureContinues, func(c C) {
+				cache := entry.VerificationCacheFor(identity.Provider)
+				c.So(cache, ShouldNotBeNil)
+				c.So(entry.VerificationCacheFor(identity.Provider), ShouldEqual, cache)
+				cache.Purge()
+
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+
+				c.So(entry.Verify(identity.Provider, e), ShouldBeNil)
+				c.So(cache.Len(), ShouldEqual, 1)
+				c.So(entry.Verify(identity.Provider, e), ShouldBeNil)
+				c.So(cache.Len(), ShouldEqual, 1)
+
+				tampered := e.Copy()
+				tampered.Payload = []byte("tampered")
+				c.So(entry.Verify(identity.Provider, tampered), ShouldNotBeNil)
+			})
+
+			c.Convey("keeps the caches of a bounded number of providers", FailureContinues, func(c C) {
+				first := idp.NewOrbitDBIdentityProvider(nil)
+				cache := entry.VerificationCacheFor(first)
+				c.So(entry.VerificationCacheFor(first), ShouldEqual, cache)
+
+				for i := 0; i < entry.MaxVerificationCaches; i++ {
+					c.So(entry.VerificationCacheFor(idp.NewOrbitDBIdentityProvider(nil)), ShouldNotBeNil)
+				}
+
+				c.So(entry.VerificationCacheFor(first), ShouldNotEqual, cache)
+			})
+
+			c.Convey("stores large payloads in their own blocks", FailureContinues, func(c C) {
+				payload := bytes.Repeat([]byte("hello"), 100000)
+				e, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{PayloadThreshold: 1024})
+				c.So(err, ShouldBeNil)
+				c.So(e.PayloadRef.Defined(), ShouldBeTrue)
+				c.So(e.Payload, ShouldResemble, payload)
+
+				block, err := io.ReadCBOR(ipfs, e.Hash)
+				c.So(err, ShouldBeNil)
+				c.So(len(block.RawData()), ShouldBeLessThan, 4096)
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.PayloadRef.String(), ShouldEqual, e.PayloadRef.String())
+				c.So(fetched.Payload, ShouldResemble, payload)
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+
+				small, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil, &entry.CreateEntryOptions{PayloadThreshold: 1024})
+				c.So(err, ShouldBeNil)
+				c.So(small.PayloadRef.Defined(), ShouldBeFalse)
+				c.So(io.CIDString(small.Hash), ShouldEqual, "zdpuArzxF8fqM5E1zE9TgENc6fHqPXBgMKexM4SfoworsKYnt")
+			})
+
+			c.Convey("compresses payloads", FailureContinues, func(c C) {
+				payload := bytes.Repeat([]byte("hello"), 1000)
+				e, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{Compression: entry.CompressionGzip})
+				c.So(err, ShouldBeNil)
+				c.So(e.PayloadCompression, ShouldEqual, entry.CompressionGzip)
+				c.So(e.Payload, ShouldResemble, payload)
+
+				block, err := io.ReadCBOR(ipfs, e.Hash)
+				c.So(err, ShouldBeNil)
+				c.So(len(block.RawData()), ShouldBeLessThan, len(payload))
+
+				hash, err := entry.ToMultihash(ipfs, e)
+				c.So(err, ShouldBeNil)
+				c.So(hash.String(), ShouldEqual, e.Hash.String())
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.Payload, ShouldResemble, payload)
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+
+				external, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{Compression: entry.CompressionGzip, PayloadThreshold: 16})
+				c.So(err, ShouldBeNil)
+				c.So(external.PayloadRef.Defined(), ShouldBeTrue)
+
+				fetched, err = entry.FromMultihash(ipfs, external.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.Payload, ShouldResemble, payload)
+			})
+
+			c.Convey("creates entries concurrently", FailureContinues, func(c C) {
+				wg := sync.WaitGroup{}
+				created := make([]*entry.Entry, 16)
+				errs := make([]error, 16)
+
+				for i := range created {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						payload := bytes.Repeat([]byte(fmt.Sprintf("hello%d", i)), 100)
+						created[i], errs[i] = entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{Compression: entry.CompressionGzip})
+					}(i)
+				}
+				wg.Wait()
+
+				for i, e := range created {
+					c.So(errs[i], ShouldBeNil)
+
+					fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+					c.So(err, ShouldBeNil)
+					c.So(fetched.Payload, ShouldResemble, bytes.Repeat([]byte(fmt.Sprintf("hello%d", i)), 100))
+					c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+				}
+			})
+
+			c.Convey("shares the payload unless it is copied", FailureContinues, func(c C) {
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(&fetched.Copy().GetPayload()[0], ShouldEqual, &fetched.GetPayload()[0])
+
+				owned := fetched.CopyPayload()
+				c.So(owned, ShouldResemble, []byte("hello"))
+
+				owned[0] = 'j'
+				c.So(fetched.GetPayload(), ShouldResemble, []byte("hello"))
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+				c.So((&entry.Entry{}).CopyPayload(), ShouldBeNil)
+			})
+
+			c.Convey("encodes entries canonically", FailureContinues, func(c C) {
+				metadata := map[string]string{"schema": "1", "content-type": "text/plain", "a": "b"}
+				e, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A", Metadata: metadata, PayloadCodec: "json"}, nil, &entry.CreateEntryOptions{Compression: entry.CompressionGzip, PayloadThreshold: 1})
+				c.So(err, ShouldBeNil)
+				c.So(entry.VerifyEncoding(e), ShouldBeNil)
+
+				block, err := io.ReadCBOR(ipfs, e.Hash)
+				c.So(err, ShouldBeNil)
+				c.So(entry.IsCanonical(block.RawData()), ShouldBeNil)
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(entry.VerifyEncoding(fetched), ShouldBeNil)
+
+				fetched.Metadata = map[string]string{"schema": "2"}
+				c.So(errors.Cause(entry.VerifyEncoding(fetched)), ShouldEqual, errmsg.HashMismatch)
+			})
+
+			c.Convey("encodes wrapped entries through their methods", FailureContinues, func(c C) {
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+
+				data, err := entry.ToRawData(&wrappedEntry{Entry: e})
+				c.So(err, ShouldBeNil)
+
+				decoded, err := entry.FromRawData(data, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(decoded.Hash.Equals(e.Hash), ShouldBeTrue)
+
+				keys, err := entry.SignedKeys(&wrappedEntry{Entry: e})
+				c.So(err, ShouldBeNil)
+				c.So(keys, ShouldHaveLength, 1)
+
+				_, err = entry.ToRawData(&opaqueEntry{IPFSLogEntry: e})
+				c.So(err, ShouldNotBeNil)
+
+				_, err = entry.SignedKeys(&opaqueEntry{IPFSLogEntry: e})
+				c.So(err, ShouldNotBeNil)
+			})
+
+			c.Convey("creates entries encoded as dag-json", FailureContinues, func(c C) {
+				e, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil, &entry.CreateEntryOptions{Encoding: entry.EncodingDagJSON})
+				c.So(err, ShouldBeNil)
+				c.So(e.Hash.Type(), ShouldEqual, io.DagJSON)
+				c.So(entry.VerifyEncoding(e), ShouldBeNil)
+
+				block, err := io.ReadCBOR(ipfs, e.Hash)
+				c.So(err, ShouldBeNil)
+				c.So(string(block.RawData()), ShouldContainSubstring, `"payload":"hello"`)
+
+				fetched, err := entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.GetEncoding(), ShouldEqual, entry.EncodingDagJSON)
+				c.So(string(fetched.Payload), ShouldEqual, "hello")
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+				c.So(entry.VerifyEncoding(fetched), ShouldBeNil)
+
+				next, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: bytes.Repeat([]byte("hello"), 100), LogID: "A", Next: []cid.Cid{e.Hash}}, nil, &entry.CreateEntryOptions{Encoding: entry.EncodingDagJSON, Compression: entry.CompressionGzip})
+				c.So(err, ShouldBeNil)
+
+				fetched, err = entry.FromMultihash(ipfs, next.Hash, identity.Provider)
+				c.So(err, ShouldBeNil)
+				c.So(fetched.Payload, ShouldResemble, bytes.Repeat([]byte("hello"), 100))
+				c.So(fetched.Next, ShouldResemble, []cid.Cid{e.Hash})
+				c.So(entry.Verify(identity.Provider, fetched), ShouldBeNil)
+			})
+
+			c.Convey("rejects entries exceeding the decode limits", FailureContinues, func(c C) {
+				limits := entry.DefaultDecodeLimits
+				defer func() { entry.DefaultDecodeLimits = limits }()
+
+				payload := bytes.Repeat([]byte("hello"), 1000)
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+
+				compressed, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{Compression: entry.CompressionGzip})
+				c.So(err, ShouldBeNil)
+
+				external, err := entry.CreateEntryWithOptions(ipfs, identity, &entry.Entry{Payload: payload, LogID: "A"}, nil, &entry.CreateEntryOptions{PayloadThreshold: 16})
+				c.So(err, ShouldBeNil)
+
+				entry.DefaultDecodeLimits.MaxEntrySize = 1024
+				_, err = entry.FromMultihash(ipfs, e.Hash, identity.Provider)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.EntryTooLarge)
+
+				entry.DefaultDecodeLimits.MaxPayloadSize = 1024
+				_, err = entry.FromMultihash(ipfs, compressed.Hash, identity.Provider)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.EntryTooLarge)
+
+				_, err = entry.FromMultihash(ipfs, external.Hash, identity.Provider)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.EntryTooLarge)
 			})
 
 			c.Convey("returns an error if ipfs is not set", FailureContinues, func(c C) {
@@ -127,8 +367,8 @@ func TestEntry(t *testing.T) {
 				hash, err := entry.ToMultihash(ipfs, e)
 				c.So(err, ShouldBeNil)
 
-				c.So(e.Hash.String(), ShouldEqual, expectedHash)
-				c.So(hash.String(), ShouldEqual, expectedHash)
+				c.So(io.CIDString(e.Hash), ShouldEqual, expectedHash)
+				c.So(io.CIDString(hash), ShouldEqual, expectedHash)
 			})
 
 			// TODO
@@ -142,6 +382,56 @@ func TestEntry(t *testing.T) {
 		c.Convey("fromMultihash", FailureContinues, func(c C) {
 		})
 
+		c.Convey("witnesses", FailureHalts, func(c C) {
+			e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("hello"), LogID: "A"}, nil)
+			c.So(err, ShouldBeNil)
+
+			other, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte("world"), LogID: "A"}, nil)
+			c.So(err, ShouldBeNil)
+
+			witnesses := []cid.Cid{}
+			keys := [][]byte{}
+			for i := 0; i < 2; i++ {
+				key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+				c.So(err, ShouldBeNil)
+
+				signer := idp.NewKeySigner(key)
+				pubKey, err := idp.SignerPublicKey(signer)
+				c.So(err, ShouldBeNil)
+				keys = append(keys, pubKey)
+
+				w, err := entry.AddWitness(context.Background(), ipfs, signer, e.Hash)
+				c.So(err, ShouldBeNil)
+				witnesses = append(witnesses, w)
+			}
+
+			// Witnessing doesn't change the entry
+			hash, err := entry.ToMultihash(ipfs, e)
+			c.So(err, ShouldBeNil)
+			c.So(hash.String(), ShouldEqual, e.Hash.String())
+
+			witnessKeys, err := entry.WitnessKeys(ipfs, e.Hash, append(witnesses, witnesses[0]))
+			c.So(err, ShouldBeNil)
+			c.So(witnessKeys, ShouldResemble, keys)
+
+			_, err = entry.WitnessKeys(ipfs, other.Hash, witnesses)
+			c.So(err, ShouldNotBeNil)
+
+			w, err := entry.ReadWitness(ipfs, witnesses[0])
+			c.So(err, ShouldBeNil)
+			c.So(w.Entry.String(), ShouldEqual, e.Hash.String())
+
+			// Witnesses can't be moved to another entry
+			w.Entry = other.Hash
+			c.So(errors.Is(w.Verify(), errmsg.BadSignature), ShouldBeTrue)
+
+			forged, err := entry.WriteWitness(ipfs, w)
+			c.So(err, ShouldBeNil)
+
+			_, err = entry.ReadWitness(ipfs, forged)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
+		})
+
 		c.Convey("isParent", FailureContinues, func(c C) {
 			c.Convey("returns true if entry has a child", FailureContinues, func(c C) {
 				payload1 := "hello world"
@@ -196,5 +486,77 @@ func TestEntry(t *testing.T) {
 		// TODO
 		c.Convey("isEntry", FailureContinues, func(c C) {
 		})
+
+		c.Convey("ordered map", FailureHalts, func(c C) {
+			var entries []iface.IPFSLogEntry
+			for i := 0; i < 3; i++ {
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte(fmt.Sprintf("hello%d", i)), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+				entries = append(entries, e)
+			}
+
+			m := entry.NewOrderedMapFromEntries(entries)
+			c.So(m.Len(), ShouldEqual, 3)
+			c.So(m.CIDs(), ShouldResemble, []cid.Cid{entries[0].GetHash(), entries[1].GetHash(), entries[2].GetHash()})
+
+			e, ok := m.GetCID(entries[1].GetHash())
+			c.So(ok, ShouldBeTrue)
+			c.So(e, ShouldEqual, entries[1])
+			c.So(m.UnsafeGet(entries[1].GetHash().String()), ShouldEqual, entries[1])
+
+			// Setting an existing key keeps its position
+			m.Put(entries[0])
+			c.So(m.At(0), ShouldEqual, entries[0])
+
+			m.DeleteCID(entries[0].GetHash())
+			c.So(m.HasCID(entries[0].GetHash()), ShouldBeFalse)
+			c.So(m.Keys(), ShouldResemble, []string{io.CIDString(entries[1].GetHash()), io.CIDString(entries[2].GetHash())})
+			c.So(m.At(2), ShouldBeNil)
+
+			m.Set("not a cid", entries[0])
+			c.So(m.Len(), ShouldEqual, 2)
+		})
+
+		c.Convey("ordered map can be modified while iterating", FailureHalts, func(c C) {
+			var entries []iface.IPFSLogEntry
+			for i := 0; i < 20; i++ {
+				e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte(fmt.Sprintf("hello%d", i)), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+				entries = append(entries, e)
+			}
+
+			m := entry.NewOrderedMapFromEntries(entries[:10])
+
+			wg := sync.WaitGroup{}
+			for _, e := range entries[10:] {
+				wg.Add(1)
+				go func(e iface.IPFSLogEntry) {
+					defer wg.Done()
+					m.Put(e)
+				}(e)
+			}
+
+			count := 0
+			m.Range(func(k cid.Cid, e iface.IPFSLogEntry) bool {
+				m.DeleteCID(k)
+				count++
+				return true
+			})
+
+			wg.Wait()
+
+			c.So(count, ShouldBeGreaterThanOrEqualTo, 10)
+			c.So(m.Len(), ShouldEqual, 20-count)
+		})
 	})
 }
+
+// wrappedEntry extends an entry, the methods of the entry are promoted
+type wrappedEntry struct {
+	*entry.Entry
+}
+
+// opaqueEntry only exposes the methods of iface.IPFSLogEntry
+type opaqueEntry struct {
+	iface.IPFSLogEntry
+}
@@ -0,0 +1,261 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/syncer"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFetcher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Fetcher", t, FailureHalts, func(c C) {
+		network := newMemoryNetwork()
+
+		// A and B hold the same log, C holds nothing
+		ipfsA := io.NewMemoryServices()
+
+		logA, err := log.NewLog(ipfsA, identity, &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		// Several writers so the log has many heads to fetch at once
+		for i := 0; i < 8; i++ {
+			writer, err := log.NewLog(ipfsA, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for j := 0; j < 3; j++ {
+				_, err := writer.Append([]byte(fmt.Sprintf("hello%d-%d", i, j)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			_, err = logA.Join(writer, -1)
+			c.So(err, ShouldBeNil)
+		}
+
+		hashes := entryHashes(logA.Values().Slice())
+
+		ipfsB := io.NewMemoryServices()
+		c.So(copyBlocks(ipfsA, ipfsB, hashes), ShouldBeNil)
+
+		logB, err := log.NewLog(ipfsB, identity, &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		_, err = logB.Join(logA, -1)
+		c.So(err, ShouldBeNil)
+
+		logC, err := log.NewLog(io.NewMemoryServices(), identity, &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		syncers := map[string]*syncer.Syncer{}
+		for id, l := range map[string]*log.Log{"A": logA, "B": logB, "C": logC} {
+			s := syncer.NewSyncer(network.Host(id), nil)
+			defer s.Close()
+			s.Add(l)
+			syncers[id] = s
+		}
+
+		newFetcher := func(options *syncer.FetcherOptions) (*syncer.Fetcher, io.IpfsServices) {
+			db := dssync.MutexWrap(ds.NewMapDatastore())
+			f := syncer.NewFetcher(network.Host("D"), bstore.NewBlockstore(db), options)
+			for _, p := range []peer.ID{"A", "B", "C"} {
+				f.AddPeer(p)
+			}
+
+			return f, io.NewServices(db, f)
+		}
+
+		fetchedBy := func(f *syncer.Fetcher) map[peer.ID]int {
+			res := map[peer.ID]int{}
+			for _, s := range f.Stats() {
+				c.So(s.InFlight, ShouldEqual, 0)
+				res[s.ID] = s.Fetched
+			}
+
+			return res
+		}
+
+		c.Convey("stripes the requests of a batch across peers", FailureHalts, func(c C) {
+			f, services := newFetcher(nil)
+
+			blocks, err := f.GetBlocks(ctx, hashes[:12])
+			c.So(err, ShouldBeNil)
+
+			received := cid.NewSet()
+			for b := range blocks {
+				received.Add(b.Cid())
+			}
+			c.So(received.Len(), ShouldEqual, 12)
+
+			// The blocks C doesn't have are requested from the others
+			fetched := fetchedBy(f)
+			c.So(fetched["A"], ShouldBeGreaterThan, 0)
+			c.So(fetched["B"], ShouldBeGreaterThan, 0)
+			c.So(fetched["A"]+fetched["B"], ShouldEqual, 12)
+			c.So(fetched["C"], ShouldEqual, 0)
+
+			ok, err := services.BlockStore().Has(hashes[0])
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+
+			_, err = f.GetBlock(ctx, logA.Heads().At(0).GetPayloadRef())
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("only serves the blocks reachable from the logs", FailureHalts, func(c C) {
+			private := blocks.NewBlock([]byte("private"))
+			c.So(ipfsA.BlockStore().Put(private), ShouldBeNil)
+
+			f, _ := newFetcher(nil)
+
+			_, err := f.GetBlock(ctx, private.Cid())
+			c.So(err, ShouldNotBeNil)
+
+			// Entries appended once blocks were served are served too
+			var e iface.IPFSLogEntry
+			c.So(syncers["A"].Do("X", func(l *log.Log) error {
+				e, err = l.Append([]byte("appended"), 1)
+				return err
+			}), ShouldBeNil)
+
+			b, err := f.GetBlock(ctx, e.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(b.Cid(), ShouldResemble, e.GetHash())
+		})
+
+		c.Convey("selects peers with the policy", FailureHalts, func(c C) {
+			f, _ := newFetcher(&syncer.FetcherOptions{
+				Policy: syncer.PolicyFunc(func(_ cid.Cid, candidates []syncer.PeerStats) peer.ID {
+					for _, s := range candidates {
+						if s.ID == "B" {
+							return s.ID
+						}
+					}
+
+					return candidates[0].ID
+				}),
+			})
+
+			blocks, err := f.GetBlocks(ctx, hashes[:6])
+			c.So(err, ShouldBeNil)
+			for range blocks {
+			}
+
+			c.So(fetchedBy(f), ShouldResemble, map[peer.ID]int{"A": 0, "B": 6, "C": 0})
+		})
+
+		c.Convey("demotes the peers failing requests or sending invalid blocks", FailureHalts, func(c C) {
+			// E answers every request with corrupted data
+			network.Host("E").SetStreamHandler(syncer.BlockProtocolID, func(s inet.Stream) {
+				defer s.Close()
+
+				r := bufio.NewReader(s)
+				for {
+					size, err := binary.ReadUvarint(r)
+					if err != nil || size == 0 {
+						return
+					}
+
+					if _, err := r.Discard(int(size)); err != nil {
+						return
+					}
+
+					if _, err := s.Write(append([]byte{7}, "corrupt"...)); err != nil {
+						return
+					}
+				}
+			})
+
+			f, _ := newFetcher(nil)
+			f.AddPeer("E")
+
+			demoted := func() int {
+				n := 0
+				for _, s := range f.Stats() {
+					switch s.ID {
+					case "C":
+						n += s.Failed
+					case "E":
+						n += s.Invalid
+					}
+				}
+
+				return n
+			}
+
+			fetch := func(hashes []cid.Cid) {
+				blocks, err := f.GetBlocks(ctx, hashes)
+				c.So(err, ShouldBeNil)
+
+				received := 0
+				for range blocks {
+					received++
+				}
+				c.So(received, ShouldEqual, len(hashes))
+			}
+
+			fetch(hashes[:12])
+			first := demoted()
+			c.So(first, ShouldBeGreaterThan, 0)
+
+			stats := map[peer.ID]syncer.PeerStats{}
+			for _, s := range f.Stats() {
+				stats[s.ID] = s
+			}
+			c.So(stats["E"].Invalid, ShouldBeGreaterThan, 0)
+			c.So(stats["E"].Fetched, ShouldEqual, 0)
+			c.So(stats["E"].Score(), ShouldBeLessThan, stats["C"].Score())
+			c.So(stats["C"].Score(), ShouldBeLessThan, stats["A"].Score())
+
+			// The following round mostly requests the reliable peers
+			fetch(hashes[12:24])
+			c.So(demoted()-first, ShouldBeLessThan, first)
+		})
+
+		c.Convey("syncs a log from several peers in parallel", FailureHalts, func(c C) {
+			f, services := newFetcher(&syncer.FetcherOptions{Timeout: time.Second})
+
+			logD, err := log.NewLog(services, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			added, err := logD.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Concurrency: 4})
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 24)
+			for _, h := range hashes {
+				c.So(logD.Has(h), ShouldBeTrue)
+			}
+
+			fetched := fetchedBy(f)
+			c.So(fetched["A"]+fetched["B"], ShouldEqual, 24)
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/gateway"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event of a server-sent events stream, skipping
+// the comments
+func readEvent(r *bufio.Reader) (*sseEvent, error) {
+	e := &sseEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.event != "":
+			return e, nil
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Gateway stream", t, FailureHalts, func(c C) {
+		logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		_, err = logA.Append([]byte("before"), 1)
+		c.So(err, ShouldBeNil)
+
+		stream, err := gateway.NewStream(logA, &gateway.StreamOptions{Heartbeat: 5 * time.Millisecond})
+		c.So(err, ShouldBeNil)
+
+		server := httptest.NewServer(stream)
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		c.So(err, ShouldBeNil)
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		c.So(err, ShouldBeNil)
+		defer resp.Body.Close()
+
+		c.So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+		c.So(stream.Clients(), ShouldEqual, 1)
+
+		r := bufio.NewReader(resp.Body)
+
+		c.Convey("streams the appended and joined entries", FailureHalts, func(c C) {
+			e1, err := logA.Append([]byte("hello1"), 1)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for _, p := range []string{"helloB1", "helloB2"} {
+				_, err := logB.Append([]byte(p), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			_, err = logA.Join(logB, -1)
+			c.So(err, ShouldBeNil)
+
+			// Joining known entries doesn't send events
+			_, err = logA.Join(logB, -1)
+			c.So(err, ShouldBeNil)
+
+			payloads := []string{}
+			for i := 0; i < 3; i++ {
+				e, err := readEvent(r)
+				c.So(err, ShouldBeNil)
+				c.So(e.event, ShouldEqual, "entry")
+
+				ev := &gateway.Event{}
+				c.So(json.Unmarshal([]byte(e.data), ev), ShouldBeNil)
+				c.So(ev.Hash, ShouldEqual, e.id)
+				c.So(ev.LogID, ShouldEqual, "X")
+
+				hash, err := cid.Decode(ev.Hash)
+				c.So(err, ShouldBeNil)
+				c.So(logA.Has(hash), ShouldBeTrue)
+
+				if i == 0 {
+					c.So(ev.Hash, ShouldEqual, io.CIDString(e1.GetHash()))
+					c.So(ev.Identity, ShouldEqual, identities[0].ID)
+				}
+
+				payloads = append(payloads, string(ev.Payload))
+			}
+			c.So(payloads, ShouldResemble, []string{"hello1", "helloB1", "helloB2"})
+		})
+
+		c.Convey("disconnects the clients once closed", FailureHalts, func(c C) {
+			c.So(stream.Close(), ShouldBeNil)
+
+			for {
+				if _, err := readEvent(r); err != nil {
+					break
+				}
+			}
+
+			for i := 0; i < 100 && stream.Clients() > 0; i++ {
+				time.Sleep(time.Millisecond)
+			}
+			c.So(stream.Clients(), ShouldEqual, 0)
+
+			resp, err := http.Get(server.URL)
+			c.So(err, ShouldBeNil)
+			resp.Body.Close()
+			c.So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+		})
+	})
+}
@@ -0,0 +1,322 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	badger "github.com/ipfs/go-ds-badger"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestKeystore() *ks.Keystore {
+	keystore, err := ks.NewInMemory()
+	if err != nil {
+		panic(err)
+	}
+
+	return keystore
+}
+
+func TestKeystore(t *testing.T) {
+	Convey("Keystore", t, FailureHalts, func(c C) {
+		c.Convey("exports and imports identity keys", FailureHalts, func(c C) {
+			for _, typ := range []string{"orbitdb", idp.Ed25519Type} {
+				source := newTestKeystore()
+				identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+					Keystore: source,
+					ID:       "userA",
+					Type:     typ,
+				})
+				c.So(err, ShouldBeNil)
+
+				passphrase := []byte("correct horse battery staple")
+				target := newTestKeystore()
+
+				for _, id := range []string{"userA", identity.ID} {
+					exported, err := source.ExportKey(id, passphrase)
+					c.So(err, ShouldBeNil)
+
+					_, err = target.ImportKey(id, exported, []byte("wrong"))
+					c.So(err, ShouldNotBeNil)
+
+					// Exports are bound to their ID
+					_, err = target.ImportKey("other", exported, passphrase)
+					c.So(err, ShouldNotBeNil)
+
+					imported, err := target.ImportKey(id, exported, passphrase)
+					c.So(err, ShouldBeNil)
+
+					original, err := source.GetKey(id)
+					c.So(err, ShouldBeNil)
+					c.So(imported.Equals(original), ShouldBeTrue)
+
+					_, err = target.ImportKey(id, exported, passphrase)
+					c.So(err, ShouldNotBeNil)
+				}
+
+				migrated, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+					Keystore: target,
+					ID:       "userA",
+					Type:     typ,
+				})
+				c.So(err, ShouldBeNil)
+				c.So(migrated.ID, ShouldEqual, identity.ID)
+				c.So(migrated.PublicKey, ShouldResemble, identity.PublicKey)
+			}
+		})
+
+		c.Convey("derives keys from a seed", FailureHalts, func(c C) {
+			mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+			seed := ks.SeedFromMnemonic(mnemonic, "TREZOR")
+			c.So(hex.EncodeToString(seed), ShouldEqual, "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04")
+
+			// SLIP-10 test vectors
+			vectorSeed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+			for _, v := range []struct {
+				path    string
+				keyType int
+				key     string
+			}{
+				{"m", crypto.Ed25519, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+				{"m/0'", crypto.Ed25519, "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+				{"m", crypto.Secp256k1, "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+				{"m/0'", crypto.Secp256k1, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+			} {
+				key, err := ks.DeriveKey(vectorSeed, v.path, v.keyType)
+				c.So(err, ShouldBeNil)
+
+				raw, err := key.Raw()
+				c.So(err, ShouldBeNil)
+				c.So(hex.EncodeToString(raw[:32]), ShouldEqual, v.key)
+			}
+
+			_, err := ks.DeriveKey(vectorSeed, "m/0", crypto.Ed25519)
+			c.So(err, ShouldNotBeNil)
+
+			for _, typ := range []string{"orbitdb", idp.Ed25519Type} {
+				create := func(keystore *ks.Keystore, path string) *idp.Identity {
+					identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+						Keystore:       keystore,
+						ID:             "userA",
+						Type:           typ,
+						Seed:           seed,
+						DerivationPath: path,
+					})
+					c.So(err, ShouldBeNil)
+
+					return identity
+				}
+
+				identity := create(newTestKeystore(), "m/44'/0'/0'")
+
+				// The same identity is recovered from the seed
+				recovered := create(newTestKeystore(), "m/44'/0'/0'")
+				c.So(recovered.ID, ShouldEqual, identity.ID)
+				c.So(recovered.PublicKey, ShouldResemble, identity.PublicKey)
+
+				other := create(newTestKeystore(), "m/44'/0'/1'")
+				c.So(other.ID, ShouldNotEqual, identity.ID)
+			}
+		})
+
+		c.Convey("persists keys in a file tree", FailureHalts, func(c C) {
+			dir, err := ioutil.TempDir("", "keystore")
+			c.So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			for _, typ := range []string{"orbitdb", idp.Ed25519Type} {
+				keystore, err := ks.NewFileKeystore(dir)
+				c.So(err, ShouldBeNil)
+
+				identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+					Keystore: keystore,
+					ID:       "user-" + typ,
+					Type:     typ,
+				})
+				c.So(err, ShouldBeNil)
+
+				reopened, err := ks.NewFileKeystore(dir)
+				c.So(err, ShouldBeNil)
+
+				recovered, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+					Keystore: reopened,
+					ID:       "user-" + typ,
+					Type:     typ,
+				})
+				c.So(err, ShouldBeNil)
+				c.So(recovered.ID, ShouldEqual, identity.ID)
+				c.So(recovered.PublicKey, ShouldResemble, identity.PublicKey)
+			}
+
+			// Keys are stored the same way in every datastore
+			store, err := ks.NewFileStore(dir)
+			c.So(err, ShouldBeNil)
+
+			results, err := store.Query(dsq.Query{})
+			c.So(err, ShouldBeNil)
+
+			entries, err := results.Rest()
+			c.So(err, ShouldBeNil)
+			c.So(len(entries), ShouldEqual, 4)
+
+			memory := dssync.MutexWrap(ds.NewMapDatastore())
+			for _, e := range entries {
+				c.So(memory.Put(ds.NewKey(e.Key), e.Value), ShouldBeNil)
+			}
+
+			keystore, err := ks.NewKeystore(memory)
+			c.So(err, ShouldBeNil)
+
+			copied, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "user-orbitdb",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			original, err := ks.NewFileKeystore(dir)
+			c.So(err, ShouldBeNil)
+
+			key, err := original.GetKey("user-orbitdb")
+			c.So(err, ShouldBeNil)
+
+			copiedKey, err := keystore.GetKey("user-orbitdb")
+			c.So(err, ShouldBeNil)
+			c.So(copiedKey.Equals(key), ShouldBeTrue)
+			c.So(copied.ID, ShouldNotBeEmpty)
+		})
+
+		c.Convey("persists keys in badger", FailureHalts, func(c C) {
+			dir, err := ioutil.TempDir("", "keystore")
+			c.So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			keystore, err := ks.NewBadgerKeystore(dir)
+			c.So(err, ShouldBeNil)
+
+			identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "user-badger",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+			c.So(keystore.Close(), ShouldBeNil)
+
+			// Keys are named as in the file tree
+			store, err := badger.NewDatastore(dir, nil)
+			c.So(err, ShouldBeNil)
+
+			results, err := store.Query(dsq.Query{KeysOnly: true})
+			c.So(err, ShouldBeNil)
+
+			entries, err := results.Rest()
+			c.So(err, ShouldBeNil)
+			c.So(len(entries), ShouldEqual, 2)
+
+			fileDir, err := ioutil.TempDir("", "keystore")
+			c.So(err, ShouldBeNil)
+			defer os.RemoveAll(fileDir)
+
+			files, err := ks.NewFileStore(fileDir)
+			c.So(err, ShouldBeNil)
+
+			for _, e := range entries {
+				value, err := store.Get(ds.NewKey(e.Key))
+				c.So(err, ShouldBeNil)
+				c.So(files.Put(ds.NewKey(e.Key), value), ShouldBeNil)
+			}
+			c.So(store.Close(), ShouldBeNil)
+
+			// The keys are recovered from both stores
+			badgerKeystore, err := ks.NewBadgerKeystore(dir)
+			c.So(err, ShouldBeNil)
+			defer badgerKeystore.Close()
+
+			fileKeystore, err := ks.NewFileKeystore(fileDir)
+			c.So(err, ShouldBeNil)
+
+			for _, keystore := range []*ks.Keystore{badgerKeystore, fileKeystore} {
+				recovered, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+					Keystore: keystore,
+					ID:       "user-badger",
+					Type:     "orbitdb",
+				})
+				c.So(err, ShouldBeNil)
+				c.So(recovered.ID, ShouldEqual, identity.ID)
+			}
+		})
+
+		c.Convey("creates keys concurrently in memory", FailureHalts, func(c C) {
+			keystore, err := ks.NewInMemory()
+			c.So(err, ShouldBeNil)
+
+			wg := sync.WaitGroup{}
+			errs := make(chan error, 20)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, err := keystore.CreateKey(fmt.Sprintf("key%d", i))
+					errs <- err
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				c.So(err, ShouldBeNil)
+			}
+
+			for i := 0; i < 20; i++ {
+				_, err := keystore.GetKey(fmt.Sprintf("key%d", i))
+				c.So(err, ShouldBeNil)
+			}
+		})
+
+		c.Convey("signs and verifies with a context", FailureHalts, func(c C) {
+			keystore := newTestKeystore()
+			identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userA",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			identities := idp.NewIdentities(keystore)
+			pubKey, err := identity.GetPublicKey()
+			c.So(err, ShouldBeNil)
+
+			sig, err := identities.SignContext(context.Background(), identity, []byte("data"))
+			c.So(err, ShouldBeNil)
+			c.So(identities.VerifyContext(context.Background(), sig, pubKey, []byte("data")), ShouldBeNil)
+			c.So(identities.VerifyContext(context.Background(), sig, pubKey, []byte("other")), ShouldNotBeNil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err = identities.SignContext(ctx, identity, []byte("data"))
+			c.So(err, ShouldEqual, context.Canceled)
+			c.So(identities.VerifyContext(ctx, sig, pubKey, []byte("data")), ShouldEqual, context.Canceled)
+
+			_, err = identity.Provider.(idp.ContextSigner).SignContext(ctx, identity, []byte("data"))
+			c.So(err, ShouldEqual, context.Canceled)
+		})
+
+		c.Convey("fails to export missing keys", FailureHalts, func(c C) {
+			_, err := newTestKeystore().ExportKey("missing", []byte("passphrase"))
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,16 +1,22 @@
 package test // import "berty.tech/go-ipfs-log/test"
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"berty.tech/go-ipfs-log/entry"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -51,16 +57,220 @@ func TestLogAppend(t *testing.T) {
 
 				for _, k := range keys {
 					v := values.UnsafeGet(k)
-					c.So(string(v.Payload), ShouldEqual, "hello1")
-					c.So(len(v.Next), ShouldEqual, 0)
-					c.So(v.Clock.ID, ShouldResemble, identity.PublicKey)
-					c.So(v.Clock.Time, ShouldEqual, 1)
+					c.So(string(v.GetPayload()), ShouldEqual, "hello1")
+					c.So(len(v.GetNext()), ShouldEqual, 0)
+					c.So(v.GetClock().ID, ShouldResemble, identity.PublicKey)
+					c.So(v.GetClock().Time, ShouldEqual, 1)
 				}
 				for _, v := range log.FindHeads(log1.Entries) {
-					c.So(v.Hash.String(), ShouldEqual, values.UnsafeGet(keys[0]).Hash.String())
+					c.So(v.GetHash().String(), ShouldEqual, values.UnsafeGet(keys[0]).GetHash().String())
 				}
 			})
 
+			c.Convey("append entries encoded as dag-json", FailureHalts, func(c C) {
+				log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", EntryEncoding: entry.EncodingDagJSON})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 3; i++ {
+					e, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+					c.So(e.GetHash().Type(), ShouldEqual, io.DagJSON)
+				}
+
+				hash, err := log1.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+				c.So(entriesAsStrings(log2.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2"})
+
+				// The entry format is kept by the reopened logs
+				options := func() *log.NewLogOptions {
+					return &log.NewLogOptions{
+						ID:                 "A",
+						EntryEncoding:      entry.EncodingDagJSON,
+						PayloadThreshold:   16,
+						PayloadCompression: entry.CompressionGzip,
+						Timestamps:         true,
+					}
+				}
+
+				checkFormat := func(e iface.IPFSLogEntry) {
+					c.So(e.GetHash().Type(), ShouldEqual, io.DagJSON)
+					c.So(e.(*entry.Entry).PayloadRef.Defined(), ShouldBeTrue)
+					c.So(e.(*entry.Entry).PayloadCompression, ShouldEqual, entry.CompressionGzip)
+					c.So(e.GetTimestamp().IsZero(), ShouldBeFalse)
+				}
+
+				payload := bytes.Repeat([]byte("hello"), 100)
+
+				log3, err := log.NewFromMultihash(ipfs, identity, hash, options(), &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				e, err := log3.Append(payload, 1)
+				c.So(err, ShouldBeNil)
+				checkFormat(e)
+
+				index := &log.HeadsIndex{Datastore: dssync.MutexWrap(ds.NewMapDatastore())}
+				indexOptions := options()
+				indexOptions.HeadsIndex = index
+
+				log4, err := log.NewLog(ipfs, identity, indexOptions)
+				c.So(err, ShouldBeNil)
+
+				_, err = log4.Join(log3, -1)
+				c.So(err, ShouldBeNil)
+
+				log5, err := log.NewFromHeadsIndex(ipfs, identity, index, options())
+				c.So(err, ShouldBeNil)
+
+				e, err = log5.Append(payload, 1)
+				c.So(err, ShouldBeNil)
+				checkFormat(e)
+			})
+
+			c.Convey("append entries using a custom CID prefix", FailureHalts, func(c C) {
+				prefix := &cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: mh.BLAKE2B_MIN + 31, MhLength: -1}
+
+				log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", CIDPrefix: prefix})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 3; i++ {
+					e, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+					c.So(e.GetHash().Prefix().MhType, ShouldEqual, mh.BLAKE2B_MIN+31)
+					c.So(entry.VerifyEncoding(e.(*entry.Entry)), ShouldBeNil)
+				}
+
+				hash, err := log1.ToMultihash()
+				c.So(err, ShouldBeNil)
+				c.So(hash.Prefix().MhType, ShouldEqual, mh.BLAKE2B_MIN+31)
+
+				log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+				c.So(entriesAsStrings(log2.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2"})
+
+				// The prefix is kept by the reopened logs
+				log3, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{CIDPrefix: prefix}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				e, err := log3.Append([]byte("hello3"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(e.GetHash().Prefix().MhType, ShouldEqual, mh.BLAKE2B_MIN+31)
+
+				index := &log.HeadsIndex{Datastore: dssync.MutexWrap(ds.NewMapDatastore())}
+				log4, err := log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "A", CIDPrefix: prefix})
+				c.So(err, ShouldBeNil)
+
+				_, err = log4.Join(log3, -1)
+				c.So(err, ShouldBeNil)
+
+				log5, err := log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "A", CIDPrefix: prefix})
+				c.So(err, ShouldBeNil)
+
+				e, err = log5.Append([]byte("hello4"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(e.GetHash().Prefix().MhType, ShouldEqual, mh.BLAKE2B_MIN+31)
+				c.So(entriesAsStrings(log5.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2", "hello3", "hello4"})
+
+				_, err = log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", CIDPrefix: &cid.Prefix{Version: 0, MhType: mh.SHA2_256, MhLength: -1}})
+				c.So(err, ShouldNotBeNil)
+			})
+
+			c.Convey("append a batch of entries", FailureHalts, func(c C) {
+				payloads := [][]byte{}
+				for i := 0; i < 5; i++ {
+					payloads = append(payloads, []byte(fmt.Sprintf("hello%d", i)))
+				}
+
+				log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+				_, err = log1.Append([]byte("first"), 1)
+				c.So(err, ShouldBeNil)
+				for _, p := range payloads {
+					_, err := log1.Append(p, 4)
+					c.So(err, ShouldBeNil)
+				}
+
+				log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+				_, err = log2.Append([]byte("first"), 1)
+				c.So(err, ShouldBeNil)
+				entries, err := log2.AppendBatch(payloads, &log.AppendOptions{PointerCount: 4})
+				c.So(err, ShouldBeNil)
+				c.So(entries, ShouldHaveLength, 5)
+
+				c.So(entriesAsStrings(log2.Values()), ShouldResemble, entriesAsStrings(log1.Values()))
+				c.So(log2.Heads().Slice(), ShouldResemble, entries[4:])
+				c.So(log2.Clock.Time, ShouldEqual, 6)
+
+				// The entries point to the same positions in both logs
+				positions := func(l *log.Log) [][]int {
+					values := l.Values().Slice()
+					index := map[cid.Cid]int{}
+					for i, e := range values {
+						index[e.GetHash()] = i
+					}
+
+					res := [][]int{}
+					for _, e := range values {
+						next := []int{}
+						for _, n := range e.GetNext() {
+							next = append(next, index[n])
+						}
+						res = append(res, next)
+					}
+
+					return res
+				}
+				c.So(positions(log2), ShouldResemble, positions(log1))
+
+				for _, e := range entries {
+					_, err := io.ReadCBOR(ipfs, e.GetHash())
+					c.So(err, ShouldBeNil)
+				}
+
+				denied, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", AccessController: &DenyAll{}})
+				c.So(err, ShouldBeNil)
+				_, err = denied.AppendBatch(payloads, nil)
+				c.So(err, ShouldNotBeNil)
+				c.So(denied.Values().Len(), ShouldEqual, 0)
+				c.So(denied.Clock.Time, ShouldEqual, 0)
+			})
+
+			c.Convey("serializes the clocks of the heads", FailureHalts, func(c C) {
+				log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 3; i++ {
+					_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				hash, err := log1.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				manifest, err := log.ReadJSONLog(ipfs, hash)
+				c.So(err, ShouldBeNil)
+				c.So(manifest.Heads, ShouldHaveLength, 1)
+				c.So(manifest.HeadClock(0).Time, ShouldEqual, 3)
+				c.So(manifest.HeadClock(0).ID, ShouldResemble, identity.PublicKey)
+				c.So(manifest.MaxTime(), ShouldEqual, 3)
+
+				// Manifests written by older versions only hold the heads
+				legacy, err := io.WriteCBOR(ipfs, map[string]interface{}{"id": "A", "heads": manifest.Heads})
+				c.So(err, ShouldBeNil)
+
+				manifest, err = log.ReadJSONLog(ipfs, legacy)
+				c.So(err, ShouldBeNil)
+				c.So(manifest.HeadClock(0), ShouldBeNil)
+				c.So(manifest.MaxTime(), ShouldEqual, -1)
+
+				log2, err := log.NewFromMultihash(ipfs, identity, legacy, &log.NewLogOptions{}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+				c.So(entriesAsStrings(log2.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2"})
+			})
+
 			c.Convey("append 100 items to a log", FailureHalts, func(c C) {
 				log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
 				c.So(err, ShouldBeNil)
@@ -75,7 +285,7 @@ func TestLogAppend(t *testing.T) {
 					heads := log.FindHeads(log1.Entries)
 
 					c.So(len(heads), ShouldEqual, 1)
-					c.So(heads[0].Hash.String(), ShouldEqual, values.UnsafeGet(keys[len(keys)-1]).Hash.String())
+					c.So(heads[0].GetHash().String(), ShouldEqual, values.UnsafeGet(keys[len(keys)-1]).GetHash().String())
 				}
 
 				c.So(log1.Entries.Len(), ShouldEqual, 100)
@@ -86,10 +296,10 @@ func TestLogAppend(t *testing.T) {
 				for i, k := range keys {
 					v := values.UnsafeGet(k)
 
-					c.So(string(v.Payload), ShouldEqual, fmt.Sprintf("hello%d", i))
-					c.So(v.Clock.Time, ShouldEqual, i+1)
-					c.So(v.Clock.ID, ShouldResemble, identity.PublicKey)
-					c.So(len(v.Next), ShouldEqual, minInt(i, nextPointerAmount))
+					c.So(string(v.GetPayload()), ShouldEqual, fmt.Sprintf("hello%d", i))
+					c.So(v.GetClock().Time, ShouldEqual, i+1)
+					c.So(v.GetClock().ID, ShouldResemble, identity.PublicKey)
+					c.So(len(v.GetNext()), ShouldEqual, minInt(i, nextPointerAmount))
 				}
 			})
 		})
@@ -0,0 +1,110 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogArchive(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	payloads := func(from, to int) []string {
+		p := []string{}
+		for i := from; i < to; i++ {
+			p = append(p, fmt.Sprintf("hello%d", i))
+		}
+
+		return p
+	}
+
+	Convey("Log - Archive", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{
+			ID:      "A",
+			Release: &log.ReleaseOptions{Delete: true},
+		})
+		c.So(err, ShouldBeNil)
+
+		for _, p := range payloads(0, 10) {
+			_, err := log1.Append([]byte(p), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		first := log1.Values().At(0)
+
+		marker, err := log1.Archive(3, nil)
+		c.So(err, ShouldBeNil)
+		c.So(log.IsArchive(marker), ShouldBeTrue)
+
+		c.Convey("truncates the log at the archive entry", FailureHalts, func(c C) {
+			c.So(log1.Values().Len(), ShouldEqual, 4)
+			c.So(entriesAsStrings(log1.Values())[:3], ShouldResemble, payloads(7, 10))
+			c.So(entryHashes(log1.GetHeads()), ShouldResemble, entryHashes(log1.Values().Slice()[3:]))
+			c.So(marker.GetMetadata()[log.ArchiveMetadataKey], ShouldEqual, string(marker.GetPayload()))
+
+			ok, err := ipfs.BlockStore().Has(first.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeFalse)
+
+			e, err := log1.Archive(4, nil)
+			c.So(err, ShouldBeNil)
+			c.So(e, ShouldBeNil)
+		})
+
+		c.Convey("pages in archived history on demand", FailureHalts, func(c C) {
+			hash, err := log1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 11)
+			c.So(entriesAsStrings(log2.Values())[:10], ShouldResemble, payloads(0, 10))
+
+			ok, err := ipfs.BlockStore().Has(first.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+		})
+
+		c.Convey("loads the archives", FailureHalts, func(c C) {
+			for _, p := range payloads(10, 15) {
+				_, err := log1.Append([]byte(p), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			// The first archive entry is archived by the second one
+			_, err := log1.Archive(2, nil)
+			c.So(err, ShouldBeNil)
+			c.So(log1.Values().Len(), ShouldEqual, 3)
+
+			loaded, err := log1.LoadArchives()
+			c.So(err, ShouldBeNil)
+			c.So(len(loaded), ShouldEqual, 14)
+			c.So(log1.Values().Len(), ShouldEqual, 17)
+
+			values := entriesAsStrings(log1.Values())
+			c.So(values[:10], ShouldResemble, payloads(0, 10))
+			c.So(values[11:16], ShouldResemble, payloads(10, 15))
+			c.So(len(log1.GetHeads()), ShouldEqual, 1)
+
+			loaded, err = log1.LoadArchives()
+			c.So(err, ShouldBeNil)
+			c.So(len(loaded), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogAuthorIndex(t *testing.T) {
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	payloads := func(entries []iface.IPFSLogEntry) []string {
+		p := []string{}
+		for _, e := range entries {
+			p = append(p, string(e.GetPayload()))
+		}
+
+		return p
+	}
+
+	Convey("Log - Author index", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 3; i++ {
+			_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		_, err = logA.Join(logB, -1)
+		c.So(err, ShouldBeNil)
+
+		c.Convey("returns the entries of an author in order", FailureHalts, func(c C) {
+			entries, err := logA.EntriesBy(identities[1].ID)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloB0", "helloB1", "helloB2"})
+
+			authors, err := logA.Authors()
+			c.So(err, ShouldBeNil)
+			c.So(len(authors), ShouldEqual, 2)
+			c.So(authors, ShouldContain, identities[0].ID)
+			c.So(authors, ShouldContain, identities[1].ID)
+
+			entries, err = logA.EntriesBy("unknown")
+			c.So(err, ShouldBeNil)
+			c.So(entries, ShouldBeEmpty)
+		})
+
+		c.Convey("is maintained once built", FailureHalts, func(c C) {
+			_, err := logA.EntriesBy(identities[0].ID)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("helloA3"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Append([]byte("helloB3"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Join(logB, -1)
+			c.So(err, ShouldBeNil)
+
+			entries, err := logA.EntriesBy(identities[0].ID)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloA0", "helloA1", "helloA2", "helloA3"})
+
+			entries, err = logA.EntriesBy(identities[1].ID)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloB0", "helloB1", "helloB2", "helloB3"})
+
+			_, err = logA.Prune(3)
+			c.So(err, ShouldBeNil)
+
+			entries, err = logA.EntriesBy(identities[0].ID)
+			c.So(err, ShouldBeNil)
+			c.So(len(entries), ShouldBeLessThan, 4)
+		})
+
+		c.Convey("filters the iterator by author", FailureHalts, func(c C) {
+			amount := 2
+			output := make(chan iface.IPFSLogEntry, 10)
+
+			err := logA.Iterator(log.IteratorOptions{Author: identities[1].ID, Amount: &amount}, output)
+			c.So(err, ShouldBeNil)
+			close(output)
+
+			entries := []iface.IPFSLogEntry{}
+			for e := range output {
+				entries = append(entries, e)
+			}
+
+			c.So(payloads(entries), ShouldResemble, []string{"helloB2", "helloB1"})
+
+			var last iface.IPFSLogEntry
+			for _, e := range logA.Values().Slice() {
+				if string(e.GetPayload()) == "helloA2" {
+					last = e
+				}
+			}
+
+			output = make(chan iface.IPFSLogEntry, 10)
+
+			err = logA.Iterator(log.IteratorOptions{Author: identities[0].ID, LTE: last}, output)
+			c.So(err, ShouldBeNil)
+			close(output)
+
+			entries = []iface.IPFSLogEntry{}
+			for e := range output {
+				entries = append(entries, e)
+			}
+
+			c.So(payloads(entries), ShouldResemble, []string{"helloA2", "helloA1", "helloA0"})
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	goio "io"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogCAR(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - CAR", t, FailureHalts, func(c C) {
+		c.Convey("exports the manifest and every entry", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", PayloadThreshold: 1024})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			// Stored externally over several chunks
+			large := bytes.Repeat([]byte("a"), 300*1024)
+			_, err = log1.Append(large, 1)
+			c.So(err, ShouldBeNil)
+
+			buf := &bytes.Buffer{}
+			c.So(log1.ExportCAR(ctx, buf), ShouldBeNil)
+
+			root, err := log1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			cr, err := io.NewCARReader(buf)
+			c.So(err, ShouldBeNil)
+			c.So(len(cr.Roots), ShouldEqual, 1)
+			c.So(cr.Roots[0].String(), ShouldEqual, root.String())
+
+			hashes := map[string]bool{}
+			for {
+				block, err := cr.Next()
+				if err == goio.EOF {
+					break
+				}
+				c.So(err, ShouldBeNil)
+				hashes[block.Cid().String()] = true
+			}
+
+			c.So(hashes[root.String()], ShouldBeTrue)
+			for _, e := range log1.Values().Slice() {
+				c.So(hashes[e.GetHash().String()], ShouldBeTrue)
+			}
+
+			// manifest, entries and at least two payload chunks
+			c.So(len(hashes), ShouldBeGreaterThan, 1+6+2)
+		})
+
+		c.Convey("imports a log without fetching any block", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", PayloadThreshold: 1024})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			large := bytes.Repeat([]byte("b"), 300*1024)
+			_, err = log1.Append(large, 1)
+			c.So(err, ShouldBeNil)
+
+			buf := &bytes.Buffer{}
+			c.So(log1.ExportCAR(ctx, buf), ShouldBeNil)
+
+			// A fresh offline store, anything missing from the archive fails
+			log2, err := log.NewFromCAR(io.NewMemoryServices(), identity, buf, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.ID, ShouldEqual, "X")
+			c.So(log2.Values().Len(), ShouldEqual, 6)
+			c.So(log2.Values().Keys(), ShouldResemble, log1.Values().Keys())
+			c.So(log2.Heads().At(0).GetPayload(), ShouldResemble, large)
+		})
+
+		c.Convey("rejects corrupted blocks", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			buf := &bytes.Buffer{}
+			c.So(log1.ExportCAR(ctx, buf), ShouldBeNil)
+
+			data := buf.Bytes()
+			i := bytes.Index(data, []byte("hello"))
+			c.So(i, ShouldBeGreaterThan, 0)
+			data[i] = 'j'
+
+			_, err = log.NewFromCAR(io.NewMemoryServices(), identity, bytes.NewReader(data), &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
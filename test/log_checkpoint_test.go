@@ -0,0 +1,161 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogCheckpoint(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Checkpoint", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 5; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		summarized := log1.Values().Slice()
+
+		checkpoint, err := log1.AppendCheckpoint(nil)
+		c.So(err, ShouldBeNil)
+		c.So(log.IsCheckpoint(checkpoint), ShouldBeTrue)
+
+		for i := 5; i < 7; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		c.Convey("points to the heads it summarizes", FailureHalts, func(c C) {
+			cp, err := log.ReadCheckpoint(ipfs, checkpoint)
+			c.So(err, ShouldBeNil)
+			c.So(cp.ID, ShouldEqual, "A")
+			c.So(cp.Heads, ShouldResemble, entryHashes(summarized[4:]))
+			c.So(cp.Length, ShouldEqual, 5)
+			c.So(cp.Time, ShouldEqual, 5)
+			c.So(checkpoint.GetNext(), ShouldResemble, cp.Heads)
+
+			snapshot, err := log.VerifyCheckpoint(ipfs, checkpoint, identity.Provider)
+			c.So(err, ShouldBeNil)
+			c.So(entryHashes(snapshot.Values), ShouldResemble, entryHashes(summarized))
+		})
+
+		c.Convey("loads the entries from the latest checkpoint", FailureHalts, func(c C) {
+			hash, err := log1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{Checkpoints: true})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 3)
+			c.So(log2.Values().At(0).GetHash(), ShouldResemble, checkpoint.GetHash())
+			c.So(entriesAsStrings(log2.Values())[1:], ShouldResemble, []string{"hello5", "hello6"})
+			c.So(log.IsCheckpoint(log2.Values().At(0)), ShouldBeTrue)
+
+			log3, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log3.Values().Len(), ShouldEqual, 8)
+
+			c.So(log2.JoinCheckpoint(checkpoint), ShouldBeNil)
+			c.So(entryHashes(log2.Values().Slice()), ShouldResemble, entryHashes(log1.Values().Slice()))
+			c.So(entryHashes(log2.GetHeads()), ShouldResemble, entryHashes(log1.GetHeads()))
+		})
+
+		c.Convey("rejects checkpoints which don't summarize the entry history", FailureHalts, func(c C) {
+			// Only the oldest entry is summarized while the latest is referenced
+			hash, err := io.WriteCBOR(ipfs, &log.Checkpoint{
+				Version:  log.CheckpointVersion,
+				ID:       "A",
+				Heads:    entryHashes(summarized[:1]),
+				Time:     1,
+				Length:   1,
+				Snapshot: checkpoint.GetHash(),
+			})
+			c.So(err, ShouldBeNil)
+
+			forged, err := log1.AppendWithOptions([]byte("forged"), &log.AppendOptions{
+				PointerCount: 1,
+				Metadata:     map[string]string{log.CheckpointMetadataKey: hash.String()},
+			})
+			c.So(err, ShouldBeNil)
+
+			_, err = log.ReadCheckpoint(ipfs, forged)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidCheckpoint)
+
+			head, err := log1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			_, err = log.NewFromMultihash(ipfs, identity, head, &log.NewLogOptions{}, &log.FetchOptions{Checkpoints: true})
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidCheckpoint)
+		})
+
+		c.Convey("rejects snapshots which rewrite history", FailureHalts, func(c C) {
+			other, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			injected, err := other.Append([]byte("injected"), 1)
+			c.So(err, ShouldBeNil)
+
+			snapshot := log1.ToSnapshot()
+			snapshot.Heads = entryHashes(log1.GetHeads())
+			snapshot.Values = append(log1.Values().Slice(), injected)
+
+			buf := &bytes.Buffer{}
+			c.So(log.WriteSnapshot(buf, snapshot, nil), ShouldBeNil)
+
+			snapshotHash, err := io.WritePayload(ipfs, buf.Bytes())
+			c.So(err, ShouldBeNil)
+
+			hash, err := io.WriteCBOR(ipfs, &log.Checkpoint{
+				Version:  log.CheckpointVersion,
+				ID:       "A",
+				Heads:    entryHashes(log1.GetHeads()),
+				Time:     log1.GetHeads()[0].GetClock().Time,
+				Length:   len(snapshot.Values),
+				Snapshot: snapshotHash,
+			})
+			c.So(err, ShouldBeNil)
+
+			forged, err := log1.AppendWithOptions([]byte("forged"), &log.AppendOptions{
+				PointerCount: 1,
+				Metadata:     map[string]string{log.CheckpointMetadataKey: hash.String()},
+			})
+			c.So(err, ShouldBeNil)
+
+			_, err = log.ReadCheckpoint(ipfs, forged)
+			c.So(err, ShouldBeNil)
+
+			_, err = log.VerifyCheckpoint(ipfs, forged, identity.Provider)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidCheckpoint)
+		})
+
+		c.Convey("can't checkpoint an empty log", FailureHalts, func(c C) {
+			empty, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = empty.AppendCheckpoint(nil)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
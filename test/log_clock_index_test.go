@@ -0,0 +1,107 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogClockIndex(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	payloads := func(entries []iface.IPFSLogEntry) []string {
+		p := []string{}
+		for _, e := range entries {
+			p = append(p, string(e.GetPayload()))
+		}
+
+		return p
+	}
+
+	Convey("Log - Clock index", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+		wall := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", Timestamps: true, Now: func() time.Time { return wall }})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 5; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+			wall = wall.Add(time.Minute)
+		}
+
+		c.Convey("returns the entries in a clock range", FailureHalts, func(c C) {
+			entries, err := log1.Range(2, 4)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello1", "hello2", "hello3"})
+
+			entries, err = log1.Range(6, 10)
+			c.So(err, ShouldBeNil)
+			c.So(entries, ShouldBeEmpty)
+		})
+
+		c.Convey("returns the entries in a timestamp range", FailureHalts, func(c C) {
+			start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			entries, err := log1.Between(start.Add(time.Minute), start.Add(3*time.Minute))
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello1", "hello2"})
+
+			entries, err = log1.Between(start.Add(3*time.Minute), time.Time{})
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello3", "hello4"})
+		})
+
+		c.Convey("is maintained once built", FailureHalts, func(c C) {
+			_, err := log1.Range(0, 0)
+			c.So(err, ShouldBeNil)
+
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Append([]byte("hello5"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Append([]byte("hello6"), 1)
+			c.So(err, ShouldBeNil)
+
+			entries, err := log1.Range(5, 7)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello4", "hello5", "hello6"})
+
+			entries, err = log1.Between(time.Date(2020, 1, 1, 0, 4, 0, 0, time.UTC), time.Time{})
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello4", "hello6"})
+
+			_, err = log1.Prune(2)
+			c.So(err, ShouldBeNil)
+
+			entries, err = log1.Range(0, 10)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"hello5", "hello6"})
+		})
+	})
+}
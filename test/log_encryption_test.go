@@ -0,0 +1,115 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type xorEncryption struct {
+	keyID string
+	keys  map[string]byte
+}
+
+func (x *xorEncryption) xor(key byte, data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ key
+	}
+
+	return out
+}
+
+func (x *xorEncryption) Encrypt(payload []byte) (string, []byte, error) {
+	return x.keyID, x.xor(x.keys[x.keyID], payload), nil
+}
+
+func (x *xorEncryption) Decrypt(keyID string, encrypted []byte) ([]byte, error) {
+	key, ok := x.keys[keyID]
+	if !ok {
+		return nil, errmsg.KeyNotFound
+	}
+
+	return x.xor(key, encrypted), nil
+}
+
+func TestLogEncryption(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       fmt.Sprintf("userA"),
+		Type:     "orbitdb",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Encryption", t, FailureHalts, func(c C) {
+		encryption := &xorEncryption{keyID: "k1", keys: map[string]byte{"k1": 42}}
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", Encryption: encryption, PayloadCompression: entry.CompressionGzip})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 3; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		hash, err := log1.ToMultihash()
+		c.So(err, ShouldBeNil)
+
+		c.Convey("stores encrypted payloads", FailureHalts, func(c C) {
+			e := log1.Values().At(0)
+			c.So(e.GetPayloadKeyID(), ShouldEqual, "k1")
+
+			fetched, err := entry.FromMultihash(ipfs, e.GetHash(), identity.Provider)
+			c.So(err, ShouldBeNil)
+			c.So(fetched.IsOpaque(), ShouldBeTrue)
+			c.So(fetched.Payload, ShouldBeEmpty)
+			c.So(fetched.IsValid(), ShouldBeTrue)
+			c.So(fetched.Verify(identity.Provider), ShouldBeNil)
+		})
+
+		c.Convey("decrypts payloads when loading the log", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Encryption: encryption}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(entriesAsStrings(log2.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2"})
+
+			log3, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Encryption: encryption, Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(entriesAsStrings(log3.Values()), ShouldResemble, []string{"hello0", "hello1", "hello2"})
+		})
+
+		c.Convey("keeps entries opaque without the key", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Encryption: &xorEncryption{}}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 3)
+
+			for _, e := range log2.Values().Slice() {
+				c.So(e.(*entry.Entry).IsOpaque(), ShouldBeTrue)
+			}
+		})
+	})
+}
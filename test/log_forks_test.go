@@ -0,0 +1,113 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogForks(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	var identities []*idp.Identity
+
+	for i := 0; i < 2; i++ {
+		char := 'A' + i
+
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+
+		if err != nil {
+			panic(err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	Convey("Log - Forks", t, FailureHalts, func(c C) {
+		c.Convey("doesn't report honest authors", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+			log2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+				c.So(err, ShouldBeNil)
+				_, err = log2.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+				c.So(err, ShouldBeNil)
+				_, err = log1.Join(log2, -1)
+				c.So(err, ShouldBeNil)
+				_, err = log2.Join(log1, -1)
+				c.So(err, ShouldBeNil)
+			}
+
+			report := log1.DetectForks()
+			c.So(report.HasForks(), ShouldBeFalse)
+		})
+
+		c.Convey("reports an author writing concurrent branches", FailureHalts, func(c C) {
+			base, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+			_, err = base.Append([]byte("helloA0"), 1)
+			c.So(err, ShouldBeNil)
+
+			branch1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+			_, err = branch1.Join(base, -1)
+			c.So(err, ShouldBeNil)
+			branch2, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+			_, err = branch2.Join(base, -1)
+			c.So(err, ShouldBeNil)
+
+			a1, err := branch1.Append([]byte("helloA1"), 1)
+			c.So(err, ShouldBeNil)
+			a2, err := branch2.Append([]byte("helloA1'"), 1)
+			c.So(err, ShouldBeNil)
+
+			observer, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+			_, err = observer.Join(branch1, -1)
+			c.So(err, ShouldBeNil)
+			_, err = observer.Join(branch2, -1)
+			c.So(err, ShouldBeNil)
+
+			report := observer.DetectForks()
+			c.So(report.HasForks(), ShouldBeTrue)
+			c.So(report.Authors(), ShouldResemble, [][]byte{identities[0].PublicKey})
+			c.So(report.Forks[0].Heads, ShouldHaveLength, 2)
+			c.So(report.Forks[0].Equivocations, ShouldHaveLength, 2)
+			c.So(report.Forks[0].Equivocations, ShouldContain, a1)
+			c.So(report.Forks[0].Equivocations, ShouldContain, a2)
+
+			// Another author merging both branches doesn't hide the fork
+			_, err = observer.Append([]byte("helloB0"), 2)
+			c.So(err, ShouldBeNil)
+
+			report = observer.DetectForks()
+			c.So(report.Forks[0].Heads, ShouldHaveLength, 2)
+		})
+	})
+}
@@ -1,12 +1,15 @@
 package test // import "berty.tech/go-ipfs-log/test"
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"berty.tech/go-ipfs-log/entry"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
@@ -89,7 +92,7 @@ func TestLogHeadsTails(t *testing.T) {
 				lastEntry := getLastEntry(log2.Values())
 
 				c.So(len(log.FindHeads(log2.Entries)), ShouldEqual, 1)
-				c.So(log.FindHeads(log2.Entries)[0].Hash.String(), ShouldEqual, lastEntry.Hash.String())
+				c.So(log.FindHeads(log2.Entries)[0].GetHash().String(), ShouldEqual, lastEntry.GetHash().String())
 			})
 
 			c.Convey("finds two heads after a join", FailureContinues, func(c C) {
@@ -114,8 +117,8 @@ func TestLogHeadsTails(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				c.So(len(log.FindHeads(log1.Entries)), ShouldEqual, 2)
-				c.So(log.FindHeads(log1.Entries)[0].Hash.String(), ShouldEqual, lastEntry1.Hash.String())
-				c.So(log.FindHeads(log1.Entries)[1].Hash.String(), ShouldEqual, lastEntry2.Hash.String())
+				c.So(log.FindHeads(log1.Entries)[0].GetHash().String(), ShouldEqual, lastEntry1.GetHash().String())
+				c.So(log.FindHeads(log1.Entries)[1].GetHash().String(), ShouldEqual, lastEntry2.GetHash().String())
 			})
 
 			c.Convey("finds two heads after two joins", FailureContinues, func(c C) {
@@ -152,8 +155,8 @@ func TestLogHeadsTails(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				c.So(len(log.FindHeads(log1.Entries)), ShouldEqual, 2)
-				c.So(log.FindHeads(log1.Entries)[0].Hash.String(), ShouldEqual, lastEntry1.Hash.String())
-				c.So(log.FindHeads(log1.Entries)[1].Hash.String(), ShouldEqual, lastEntry2.Hash.String())
+				c.So(log.FindHeads(log1.Entries)[0].GetHash().String(), ShouldEqual, lastEntry1.GetHash().String())
+				c.So(log.FindHeads(log1.Entries)[1].GetHash().String(), ShouldEqual, lastEntry2.GetHash().String())
 			})
 
 			c.Convey("finds two heads after three joins", FailureContinues, func(c C) {
@@ -192,8 +195,8 @@ func TestLogHeadsTails(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				c.So(len(log.FindHeads(log1.Entries)), ShouldEqual, 2)
-				c.So(log.FindHeads(log1.Entries)[0].Hash.String(), ShouldEqual, lastEntry1.Hash.String())
-				c.So(log.FindHeads(log1.Entries)[1].Hash.String(), ShouldEqual, lastEntry2.Hash.String())
+				c.So(log.FindHeads(log1.Entries)[0].GetHash().String(), ShouldEqual, lastEntry1.GetHash().String())
+				c.So(log.FindHeads(log1.Entries)[1].GetHash().String(), ShouldEqual, lastEntry2.GetHash().String())
 			})
 
 			c.Convey("finds three heads after three joins", FailureContinues, func(c C) {
@@ -233,9 +236,30 @@ func TestLogHeadsTails(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				c.So(len(log.FindHeads(log1.Entries)), ShouldEqual, 3)
-				c.So(log.FindHeads(log1.Entries)[0].Hash.String(), ShouldEqual, lastEntry1.Hash.String())
-				c.So(log.FindHeads(log1.Entries)[1].Hash.String(), ShouldEqual, lastEntry2.Hash.String())
-				c.So(log.FindHeads(log1.Entries)[2].Hash.String(), ShouldEqual, lastEntry3.Hash.String())
+				c.So(log.FindHeads(log1.Entries)[0].GetHash().String(), ShouldEqual, lastEntry1.GetHash().String())
+				c.So(log.FindHeads(log1.Entries)[1].GetHash().String(), ShouldEqual, lastEntry2.GetHash().String())
+				c.So(log.FindHeads(log1.Entries)[2].GetHash().String(), ShouldEqual, lastEntry3.GetHash().String())
+			})
+
+			c.Convey("finds heads in a deterministic order", FailureContinues, func(c C) {
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+				log2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+
+				a1, err := log1.Append([]byte("helloA1"), 1)
+				c.So(err, ShouldBeNil)
+				a2, err := log1.Append([]byte("helloA2"), 1)
+				c.So(err, ShouldBeNil)
+				b1, err := log2.Append([]byte("helloB1"), 1)
+				c.So(err, ShouldBeNil)
+
+				heads1 := log.FindHeads(entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{a1, a2, b1}))
+				heads2 := log.FindHeads(entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{b1, a2, a1}))
+
+				c.So(len(heads1), ShouldEqual, 2)
+				c.So(heads1, ShouldResemble, heads2)
+				c.So(bytes.Compare(heads1[0].GetClock().ID, heads1[1].GetClock().ID), ShouldBeLessThan, 0)
 			})
 		})
 
@@ -0,0 +1,141 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogEntryHook(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Entry hook", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+		c.So(err, ShouldBeNil)
+
+		indexed := []string{}
+		log1.OnEntry(func(e iface.IPFSLogEntry) error {
+			indexed = append(indexed, string(e.GetPayload()))
+			return nil
+		})
+
+		for i := 0; i < 3; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		c.So(indexed, ShouldResemble, []string{"hello0", "hello1", "hello2"})
+
+		c.Convey("fires once per entry across overlapping joins", FailureHalts, func(c C) {
+			old, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = old.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			for i := 3; i < 5; i++ {
+				_, err := log2.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			log3, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log3.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log3.Append([]byte("hello5"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Join(log3, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+
+			c.So(indexed, ShouldResemble, []string{"hello0", "hello1", "hello2", "hello3", "hello4", "hello5"})
+
+			_, err = log1.Prune(2)
+			c.So(err, ShouldBeNil)
+
+			// The older entries are joined again from a log which
+			// still holds them
+			_, err = log1.Join(old, -1)
+			c.So(err, ShouldBeNil)
+			c.So(log1.Values().Len(), ShouldEqual, 5)
+			c.So(len(indexed), ShouldEqual, 6)
+		})
+
+		c.Convey("skips the truncated entries of a join", FailureHalts, func(c C) {
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			for i := 3; i < 6; i++ {
+				_, err := log2.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			log3, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			joined := []string{}
+			log3.OnEntry(func(e iface.IPFSLogEntry) error {
+				joined = append(joined, string(e.GetPayload()))
+				return nil
+			})
+
+			_, err = log3.Join(log2, 2)
+			c.So(err, ShouldBeNil)
+			c.So(joined, ShouldResemble, entriesAsStrings(log3.Values()))
+		})
+
+		c.Convey("returns the errors of the hook", FailureHalts, func(c C) {
+			log1.OnEntry(func(e iface.IPFSLogEntry) error {
+				return fmt.Errorf("index unavailable")
+			})
+
+			_, err := log1.Append([]byte("hello3"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(log1.Values().Len(), ShouldEqual, 4)
+		})
+
+		c.Convey("replays the entries of the log", FailureHalts, func(c C) {
+			replayed := []string{}
+			err := log1.Replay(func(e iface.IPFSLogEntry) error {
+				replayed = append(replayed, string(e.GetPayload()))
+				return nil
+			})
+			c.So(err, ShouldBeNil)
+			c.So(replayed, ShouldResemble, []string{"hello0", "hello1", "hello2"})
+		})
+	})
+}
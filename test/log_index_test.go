@@ -0,0 +1,107 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// payloadIndex records the payloads of the indexed entries
+type payloadIndex struct {
+	payloads []string
+	resets   int
+}
+
+func (p *payloadIndex) UpdateIndex(e iface.IPFSLogEntry) error {
+	p.payloads = append(p.payloads, string(e.GetPayload()))
+	return nil
+}
+
+func (p *payloadIndex) Reset() error {
+	p.payloads = nil
+	p.resets++
+	return nil
+}
+
+func TestLogIndex(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Index", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+		index := &payloadIndex{}
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", Indexes: []log.Index{index}})
+		c.So(err, ShouldBeNil)
+		c.So(index.resets, ShouldEqual, 1)
+
+		for i := 0; i < 3; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		c.Convey("is updated by appends", FailureHalts, func(c C) {
+			_, err := log1.AppendBatch([][]byte{[]byte("hello3"), []byte("hello4")}, nil)
+			c.So(err, ShouldBeNil)
+			c.So(index.payloads, ShouldResemble, []string{"hello0", "hello1", "hello2", "hello3", "hello4"})
+			c.So(index.resets, ShouldEqual, 1)
+		})
+
+		c.Convey("is updated with the joined entries only", FailureHalts, func(c C) {
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			for i := 3; i < 5; i++ {
+				_, err := log2.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			_, err = log1.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+			c.So(index.payloads, ShouldResemble, entriesAsStrings(log1.Values()))
+
+			_, err = log1.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+			c.So(len(index.payloads), ShouldEqual, 5)
+			c.So(index.resets, ShouldEqual, 1)
+		})
+
+		c.Convey("is rebuilt when entries are removed", FailureHalts, func(c C) {
+			_, err := log1.Prune(2)
+			c.So(err, ShouldBeNil)
+			c.So(index.payloads, ShouldResemble, []string{"hello1", "hello2"})
+			c.So(index.resets, ShouldEqual, 2)
+		})
+
+		c.Convey("is built from the entries of the log", FailureHalts, func(c C) {
+			other := &payloadIndex{}
+			c.So(log1.AddIndex(other), ShouldBeNil)
+			c.So(other.payloads, ShouldResemble, []string{"hello0", "hello1", "hello2"})
+
+			hash, err := log1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			reopened := &payloadIndex{}
+			_, err = log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Indexes: []log.Index{reopened}}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(reopened.payloads, ShouldResemble, []string{"hello0", "hello1", "hello2"})
+		})
+	})
+}
@@ -10,12 +10,17 @@ import (
 	"berty.tech/go-ipfs-log/entry"
 	"berty.tech/go-ipfs-log/errmsg"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/hlc"
 	"berty.tech/go-ipfs-log/utils/lamportclock"
+	"berty.tech/go-ipfs-log/utils/vectorclock"
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/pkg/errors"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -61,27 +66,27 @@ func TestLogJoin(t *testing.T) {
 			}
 
 			c.Convey("joins logs", FailureHalts, func() {
-				var items [3][]*entry.Entry
-				var prev [3]*entry.Entry
-				var curr [3]*entry.Entry
+				var items [3][]iface.IPFSLogEntry
+				var prev [3]iface.IPFSLogEntry
+				var curr [3]iface.IPFSLogEntry
 				var err error
 
 				curr[0], err = entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryA1"), LogID: "X"}, nil)
 				c.So(err, ShouldBeNil)
-				curr[1], err = entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte("entryB1"), LogID: "X", Next: []cid.Cid{curr[0].Hash}}, nil)
+				curr[1], err = entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte("entryB1"), LogID: "X", Next: []cid.Cid{curr[0].GetHash()}}, nil)
 				c.So(err, ShouldBeNil)
-				curr[2], err = entry.CreateEntry(ipfs, identities[2], &entry.Entry{Payload: []byte("entryC1"), LogID: "X", Next: []cid.Cid{curr[0].Hash, curr[1].Hash}}, nil)
+				curr[2], err = entry.CreateEntry(ipfs, identities[2], &entry.Entry{Payload: []byte("entryC1"), LogID: "X", Next: []cid.Cid{curr[0].GetHash(), curr[1].GetHash()}}, nil)
 				c.So(err, ShouldBeNil)
 				for i := 1; i <= 100; i++ {
 					if i > 1 {
 						for j := 0; j < 3; j++ {
 							prev[j] = items[j][len(items[j])-1]
 						}
-						curr[0], err = entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte(fmt.Sprintf("entryA%d", i)), LogID: "X", Next: []cid.Cid{prev[0].Hash}}, nil)
+						curr[0], err = entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte(fmt.Sprintf("entryA%d", i)), LogID: "X", Next: []cid.Cid{prev[0].GetHash()}}, nil)
 						c.So(err, ShouldBeNil)
-						curr[1], err = entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte(fmt.Sprintf("entryB%d", i)), LogID: "X", Next: []cid.Cid{prev[1].Hash, curr[0].Hash}}, nil)
+						curr[1], err = entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte(fmt.Sprintf("entryB%d", i)), LogID: "X", Next: []cid.Cid{prev[1].GetHash(), curr[0].GetHash()}}, nil)
 						c.So(err, ShouldBeNil)
-						curr[2], err = entry.CreateEntry(ipfs, identities[2], &entry.Entry{Payload: []byte(fmt.Sprintf("entryC%d", i)), LogID: "X", Next: []cid.Cid{prev[2].Hash, curr[0].Hash, curr[1].Hash}}, nil)
+						curr[2], err = entry.CreateEntry(ipfs, identities[2], &entry.Entry{Payload: []byte(fmt.Sprintf("entryC%d", i)), LogID: "X", Next: []cid.Cid{prev[2].GetHash(), curr[0].GetHash(), curr[1].GetHash()}}, nil)
 						c.So(err, ShouldBeNil)
 					}
 
@@ -92,11 +97,11 @@ func TestLogJoin(t *testing.T) {
 
 				// Here we're creating a log from entries signed by A and B
 				// but we accept entries from C too
-				logA, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{items[1][len(items[1])-1]}, &log.NewLogOptions{}, &entry.FetchOptions{})
+				logA, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{items[1][len(items[1])-1]}, &log.NewLogOptions{}, &entry.FetchOptions{})
 				c.So(err, ShouldBeNil)
 				// Here we're creating a log from entries signed by peer A, B and C
 				// "logA" accepts entries from peer C so we can join logs A and B
-				logB, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{items[2][len(items[2])-1]}, &log.NewLogOptions{}, &entry.FetchOptions{})
+				logB, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{items[2][len(items[2])-1]}, &log.NewLogOptions{}, &entry.FetchOptions{})
 				c.So(err, ShouldBeNil)
 
 				c.So(entry.EntriesAsStrings(logA.Values().Slice()), ShouldResemble, entry.EntriesAsStrings(append(items[0], items[1]...)))
@@ -138,11 +143,11 @@ func TestLogJoin(t *testing.T) {
 				var result []string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, string(logs[0].Values().UnsafeGet(v).Payload))
+					result = append(result, string(logs[0].Values().UnsafeGet(v).GetPayload()))
 				}
 
 				c.So(expected, ShouldResemble, result)
-				c.So(len(getLastEntry(logs[0].Values()).Next), ShouldEqual, 1)
+				c.So(len(getLastEntry(logs[0].Values()).GetNext()), ShouldEqual, 1)
 			})
 
 			c.Convey("joins logs two ways", FailureHalts, func() {
@@ -169,8 +174,8 @@ func TestLogJoin(t *testing.T) {
 					keys := values.Keys()
 					for _, k := range keys {
 						v := values.UnsafeGet(k)
-						hashes[i] = append(hashes[i], v.Hash)
-						payloads[i] = append(payloads[i], v.Payload)
+						hashes[i] = append(hashes[i], v.GetHash())
+						payloads[i] = append(payloads[i], v.GetPayload())
 					}
 				}
 
@@ -202,7 +207,7 @@ func TestLogJoin(t *testing.T) {
 				var result []string
 
 				for _, v := range logs[1].Values().Keys() {
-					result = append(result, string(logs[1].Values().UnsafeGet(v).Payload))
+					result = append(result, string(logs[1].Values().UnsafeGet(v).GetPayload()))
 				}
 
 				c.So(expected, ShouldResemble, result)
@@ -231,7 +236,7 @@ func TestLogJoin(t *testing.T) {
 				var result []string
 
 				for _, v := range logs[1].Values().Keys() {
-					result = append(result, string(logs[1].Values().UnsafeGet(v).Payload))
+					result = append(result, string(logs[1].Values().UnsafeGet(v).GetPayload()))
 				}
 
 				c.So(expected, ShouldResemble, result)
@@ -322,7 +327,7 @@ func TestLogJoin(t *testing.T) {
 				var result []string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, string(logs[0].Values().UnsafeGet(v).Payload))
+					result = append(result, string(logs[0].Values().UnsafeGet(v).GetPayload()))
 				}
 
 				c.So(expected, ShouldResemble, result)
@@ -369,7 +374,7 @@ func TestLogJoin(t *testing.T) {
 
 				for i := 0; i < 2; i++ {
 					for _, v := range logs[i].Values().Keys() {
-						payloads[i] = append(payloads[i], string(logs[i].Values().UnsafeGet(v).Payload))
+						payloads[i] = append(payloads[i], string(logs[i].Values().UnsafeGet(v).GetPayload()))
 					}
 				}
 
@@ -462,7 +467,7 @@ func TestLogJoin(t *testing.T) {
 				for _, v := range logs[3].Values().Keys() {
 					e, exist := logs[3].Values().Get(v)
 					c.So(exist, ShouldBeTrue)
-					result = append(result, entry.Entry{Payload: e.Payload, LogID: e.LogID, Clock: e.Clock})
+					result = append(result, entry.Entry{Payload: e.GetPayload(), LogID: e.GetLogID(), Clock: e.GetClock()})
 				}
 
 				c.So(reflect.DeepEqual(result, expected), ShouldBeTrue)
@@ -538,7 +543,7 @@ func TestLogJoin(t *testing.T) {
 				var result [][]byte
 
 				for _, v := range logs[3].Values().Keys() {
-					result = append(result, logs[3].Values().UnsafeGet(v).Payload)
+					result = append(result, logs[3].Values().UnsafeGet(v).GetPayload())
 				}
 
 				c.So(reflect.DeepEqual(expected, result), ShouldBeTrue)
@@ -565,12 +570,12 @@ func TestLogJoin(t *testing.T) {
 				var key string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, logs[0].Values().UnsafeGet(v).Payload)
+					result = append(result, logs[0].Values().UnsafeGet(v).GetPayload())
 					key = v
 				}
 
 				c.So(reflect.DeepEqual(expected, result), ShouldBeTrue)
-				c.So(len(logs[0].Values().UnsafeGet(key).Next), ShouldEqual, 1)
+				c.So(len(logs[0].Values().UnsafeGet(key).GetNext()), ShouldEqual, 1)
 			})
 
 			c.Convey("joins only specified amount of entries - two entries", FailureHalts, func() {
@@ -594,12 +599,12 @@ func TestLogJoin(t *testing.T) {
 				var key string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, logs[0].Values().UnsafeGet(v).Payload)
+					result = append(result, logs[0].Values().UnsafeGet(v).GetPayload())
 					key = v
 				}
 
 				c.So(reflect.DeepEqual(expected, result), ShouldBeTrue)
-				c.So(len(logs[0].Values().UnsafeGet(key).Next), ShouldEqual, 1)
+				c.So(len(logs[0].Values().UnsafeGet(key).GetNext()), ShouldEqual, 1)
 			})
 
 			c.Convey("joins only specified amount of entries - three entries", FailureHalts, func() {
@@ -623,12 +628,12 @@ func TestLogJoin(t *testing.T) {
 				var key string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, logs[0].Values().UnsafeGet(v).Payload)
+					result = append(result, logs[0].Values().UnsafeGet(v).GetPayload())
 					key = v
 				}
 
 				c.So(reflect.DeepEqual(expected, result), ShouldBeTrue)
-				c.So(len(logs[0].Values().UnsafeGet(key).Next), ShouldEqual, 1)
+				c.So(len(logs[0].Values().UnsafeGet(key).GetNext()), ShouldEqual, 1)
 			})
 
 			c.Convey("joins only specified amount of entries - (all) four entries", FailureHalts, func() {
@@ -652,12 +657,230 @@ func TestLogJoin(t *testing.T) {
 				var key string
 
 				for _, v := range logs[0].Values().Keys() {
-					result = append(result, logs[0].Values().UnsafeGet(v).Payload)
+					result = append(result, logs[0].Values().UnsafeGet(v).GetPayload())
 					key = v
 				}
 
 				c.So(reflect.DeepEqual(expected, result), ShouldBeTrue)
-				c.So(len(logs[0].Values().UnsafeGet(key).Next), ShouldEqual, 1)
+				c.So(len(logs[0].Values().UnsafeGet(key).GetNext()), ShouldEqual, 1)
+			})
+
+			c.Convey("joins logs using vector clocks", FailureHalts, func(c C) {
+				logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "V", ClockType: vectorclock.Type})
+				c.So(err, ShouldBeNil)
+				logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "V", ClockType: vectorclock.Type})
+				c.So(err, ShouldBeNil)
+
+				a1, err := logA.Append([]byte("helloA1"), 1)
+				c.So(err, ShouldBeNil)
+				b1, err := logB.Append([]byte("helloB1"), 1)
+				c.So(err, ShouldBeNil)
+
+				c.So(a1.GetClockType(), ShouldEqual, vectorclock.Type)
+				c.So(a1.GetVectorClock().Get(identities[0].PublicKey), ShouldEqual, 1)
+				c.So(vectorclock.Compare(a1.GetVectorClock(), b1.GetVectorClock()), ShouldEqual, vectorclock.Concurrent)
+
+				_, err = logA.Join(logB, -1)
+				c.So(err, ShouldBeNil)
+
+				a2, err := logA.Append([]byte("helloA2"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(a2.GetVectorClock().Get(identities[0].PublicKey), ShouldEqual, 2)
+				c.So(a2.GetVectorClock().Get(identities[1].PublicKey), ShouldEqual, 1)
+				c.So(vectorclock.Compare(a1.GetVectorClock(), a2.GetVectorClock()), ShouldEqual, vectorclock.Before)
+				c.So(vectorclock.Compare(a2.GetVectorClock(), b1.GetVectorClock()), ShouldEqual, vectorclock.After)
+
+				hash, err := logA.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				logC, err := log.NewFromMultihash(ipfs, identities[2], hash, &log.NewLogOptions{}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				head := logC.Heads().At(0)
+				c.So(head.GetHash().Equals(a2.GetHash()), ShouldBeTrue)
+				c.So(head.GetVectorClock(), ShouldResemble, a2.GetVectorClock())
+
+				// The clock type is kept by the reopened log
+				logD, err := log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{ClockType: vectorclock.Type}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				a3, err := logD.Append([]byte("helloA3"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(a3.GetClockType(), ShouldEqual, vectorclock.Type)
+				c.So(vectorclock.Compare(a2.GetVectorClock(), a3.GetVectorClock()), ShouldEqual, vectorclock.Before)
+
+				_, err = log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "V", ClockType: "unknown"})
+				c.So(err, ShouldNotBeNil)
+			})
+
+			c.Convey("streams the difference between logs", FailureHalts, func(c C) {
+				for i := 0; i < 3; i++ {
+					_, err := logs[0].Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+					c.So(err, ShouldBeNil)
+					_, err = logs[1].Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				_, err := logs[1].Join(logs[0], -1)
+				c.So(err, ShouldBeNil)
+
+				var streamed []string
+				for e := range log.StreamDifference(context.Background(), logs[1], logs[0]) {
+					streamed = append(streamed, io.CIDString(e.GetHash()))
+				}
+
+				expected := log.Difference(logs[1], logs[0])
+				c.So(streamed, ShouldHaveLength, 3)
+				c.So(streamed, ShouldResemble, expected.Keys())
+
+				ctx, cancel := context.WithCancel(context.Background())
+				stream := log.StreamDifference(ctx, logs[1], logs[0])
+				<-stream
+				cancel()
+				for range stream {
+				}
+
+				c.So(log.Difference(logs[0], logs[1]).Len(), ShouldEqual, 0)
+			})
+
+			c.Convey("skips known entries with a bloom filter", FailureHalts, func(c C) {
+				store := entry.NewDatastoreStore(dssync.MutexWrap(ds.NewMapDatastore()), identities[0].Provider)
+
+				logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "F", EntryStore: store, BloomFilter: 100})
+				c.So(err, ShouldBeNil)
+				logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "F", BloomFilter: 100})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 3; i++ {
+					_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+					c.So(err, ShouldBeNil)
+					_, err = logB.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				_, err = logB.Join(logA, -1)
+				c.So(err, ShouldBeNil)
+				c.So(logB.Values().Len(), ShouldEqual, 6)
+				c.So(log.Difference(logB, logA).Len(), ShouldEqual, 3)
+
+				_, err = logA.Join(logB, -1)
+				c.So(err, ShouldBeNil)
+				c.So(log.Difference(logB, logA).Len(), ShouldEqual, 0)
+
+				// The filter of a reopened log holds the entries of its store
+				reopened, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "F", EntryStore: store, BloomFilter: 100})
+				c.So(err, ShouldBeNil)
+				c.So(log.Difference(logB, reopened).Len(), ShouldEqual, 0)
+			})
+
+			c.Convey("verifies signatures in parallel", FailureHalts, func(c C) {
+				logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "P", VerifyConcurrency: 4})
+				c.So(err, ShouldBeNil)
+				logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "P"})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 20; i++ {
+					_, err := logB.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				_, err = logA.Join(logB, -1)
+				c.So(err, ShouldBeNil)
+				c.So(logA.Values().Len(), ShouldEqual, 20)
+
+				e1, err := entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte("entryB1"), LogID: "Q"}, nil)
+				c.So(err, ShouldBeNil)
+				tampered := e1.Copy()
+				tampered.Payload = []byte("tampered")
+
+				logC, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "Q", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{tampered})})
+				c.So(err, ShouldBeNil)
+				logD, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "Q", VerifyConcurrency: 4})
+				c.So(err, ShouldBeNil)
+
+				_, err = logD.Join(logC, -1)
+				c.So(err, ShouldNotBeNil)
+				c.So(logD.Values().Len(), ShouldEqual, 0)
+			})
+
+			c.Convey("rejects entries with non monotonic clocks when clocks are strict", FailureHalts, func(c C) {
+				e1, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryA1"), LogID: "S"}, lamportclock.New(identities[0].PublicKey, 5))
+				c.So(err, ShouldBeNil)
+				e2, err := entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte("entryB1"), LogID: "S", Next: []cid.Cid{e1.GetHash()}}, lamportclock.New(identities[1].PublicKey, 2))
+				c.So(err, ShouldBeNil)
+
+				other, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "S", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1, e2})})
+				c.So(err, ShouldBeNil)
+
+				strict, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "S", StrictClocks: true})
+				c.So(err, ShouldBeNil)
+
+				_, err = strict.Join(other, -1)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.ClockNotMonotonic)
+				c.So(strict.Values().Len(), ShouldEqual, 0)
+
+				_, err = log.NewFromEntryHash(ipfs, identities[0], e2.GetHash(), &log.NewLogOptions{ID: "S", StrictClocks: true}, &log.FetchOptions{})
+				c.So(errors.Cause(err), ShouldEqual, errmsg.ClockNotMonotonic)
+
+				loose, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "S"})
+				c.So(err, ShouldBeNil)
+
+				_, err = loose.Join(other, -1)
+				c.So(err, ShouldBeNil)
+				c.So(loose.Values().Len(), ShouldEqual, 2)
+			})
+
+			c.Convey("joins logs using hybrid logical clocks", FailureHalts, func(c C) {
+				wall := time.Unix(1000, 0)
+				now := func() time.Time { return wall }
+
+				logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "H", ClockType: hlc.Type, Now: now})
+				c.So(err, ShouldBeNil)
+				logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "H", ClockType: hlc.Type, Now: func() time.Time { return wall.Add(time.Minute) }})
+				c.So(err, ShouldBeNil)
+
+				a1, err := logA.Append([]byte("helloA1"), 1)
+				c.So(err, ShouldBeNil)
+				a2, err := logA.Append([]byte("helloA2"), 1)
+				c.So(err, ShouldBeNil)
+
+				c.So(a1.GetClockType(), ShouldEqual, hlc.Type)
+				c.So(a1.GetHLC().Time(), ShouldResemble, wall)
+				c.So(a1.GetHLC().Logical, ShouldEqual, 0)
+				c.So(a2.GetHLC().Logical, ShouldEqual, 1)
+				c.So(hlc.Compare(a1.GetHLC(), a2.GetHLC()), ShouldBeLessThan, 0)
+
+				b1, err := logB.Append([]byte("helloB1"), 1)
+				c.So(err, ShouldBeNil)
+
+				_, err = logA.Join(logB, -1)
+				c.So(err, ShouldBeNil)
+
+				// logA wall time is behind logB, causality is kept by the
+				// logical counter
+				a3, err := logA.Append([]byte("helloA3"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(a3.GetHLC().Wall, ShouldEqual, b1.GetHLC().Wall)
+				c.So(hlc.Compare(b1.GetHLC(), a3.GetHLC()), ShouldBeLessThan, 0)
+
+				hash, err := logA.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				logC, err := log.NewFromMultihash(ipfs, identities[2], hash, &log.NewLogOptions{}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+				c.So(logC.Heads().At(0).GetHLC(), ShouldResemble, a3.GetHLC())
+
+				// The clock type and the wall clock are kept by the reopened
+				// log
+				later := wall.Add(time.Hour)
+				logD, err := log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{ClockType: hlc.Type, Now: func() time.Time { return later }}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				a4, err := logD.Append([]byte("helloA4"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(a4.GetClockType(), ShouldEqual, hlc.Type)
+				c.So(a4.GetHLC().Time(), ShouldResemble, later)
+				c.So(hlc.Compare(a3.GetHLC(), a4.GetHLC()), ShouldBeLessThan, 0)
 			})
 		})
 	})
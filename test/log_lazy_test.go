@@ -0,0 +1,220 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogLazy(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       fmt.Sprintf("userA"),
+		Type:     "orbitdb",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Lazy", t, FailureHalts, func(c C) {
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 10; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		hash, err := log1.ToMultihash()
+		c.So(err, ShouldBeNil)
+
+		c.Convey("only loads heads when opened", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.IsLazy(), ShouldBeTrue)
+			c.So(log2.Entries.Len(), ShouldEqual, 1)
+			c.So(log2.Heads().Len(), ShouldEqual, 1)
+		})
+
+		c.Convey("fetches entries on demand when traversed", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			values := log2.Values()
+			c.So(values.Len(), ShouldEqual, 10)
+			c.So(entriesAsStrings(values), ShouldResemble, entriesAsStrings(log1.Values()))
+			c.So(log2.Entries.Len(), ShouldEqual, 1)
+			c.So(log2.CacheStats().Misses, ShouldEqual, 9)
+			c.So(log2.CacheStats().Len, ShouldEqual, 9)
+
+			c.So(log2.Values().Len(), ShouldEqual, 10)
+			c.So(log2.CacheStats().Hits, ShouldEqual, 9)
+		})
+
+		c.Convey("returns the errors of failed fetches", FailureHalts, func(c C) {
+			values := log1.Values().Slice()
+
+			partial := io.NewMemoryServices()
+			c.So(copyBlocks(ipfs, partial, append(entryHashes(values), hash)), ShouldBeNil)
+			c.So(partial.BlockStore().DeleteBlock(values[4].GetHash()), ShouldBeNil)
+
+			log2, err := log.NewFromMultihash(partial, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.ValuesE()
+			c.So(err, ShouldNotBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 0)
+
+			_, _, err = log2.GetEntryE(values[4].GetHash())
+			c.So(err, ShouldNotBeNil)
+
+			e, ok, err := log2.GetEntryE(values[5].GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+			c.So(string(e.GetPayload()), ShouldEqual, "hello5")
+		})
+
+		c.Convey("evicts cold entries and fetches them again", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true, CacheSize: 4}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			c.So(log2.Values().Len(), ShouldEqual, 10)
+			c.So(log2.CacheStats().Len, ShouldEqual, 4)
+
+			c.So(entriesAsStrings(log2.Values()), ShouldResemble, entriesAsStrings(log1.Values()))
+			c.So(log2.CacheStats().Misses, ShouldEqual, 18)
+		})
+
+		c.Convey("appends on top of unloaded entries", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			e, err := log2.Append([]byte("hello10"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e.GetClock().Time, ShouldEqual, 11)
+			c.So(log2.Values().Len(), ShouldEqual, 11)
+		})
+
+		c.Convey("keeps entries in a datastore backed entry store", FailureHalts, func(c C) {
+			store := entry.NewDatastoreStore(dssync.MutexWrap(ds.NewMapDatastore()), identity.Provider)
+
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", EntryStore: store, CacheSize: 2})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := log2.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(log2.Entries.Len(), ShouldEqual, 0)
+			c.So(log2.CacheStats().Len, ShouldEqual, 2)
+
+			for _, e := range log2.Values().Slice() {
+				stored, ok, err := store.Get(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+				c.So(string(stored.GetPayload()), ShouldEqual, string(e.GetPayload()))
+			}
+
+			log3, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log3.Join(log2, -1)
+			c.So(err, ShouldBeNil)
+			c.So(entriesAsStrings(log3.Values()), ShouldResemble, entriesAsStrings(log2.Values()))
+		})
+
+		c.Convey("keeps its heads when joined with its own history", FailureHalts, func(c C) {
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			values := log1.Values().Slice()
+			log3, err := log.NewFromEntryHash(ipfs, identity, values[4].GetHash(), &log.NewLogOptions{ID: "A"}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log3, -1)
+			c.So(err, ShouldBeNil)
+			c.So(log2.Entries.Len(), ShouldEqual, 1)
+			c.So(entryHashes(log2.GetHeads()), ShouldResemble, entryHashes(log1.GetHeads()))
+			c.So(entriesAsStrings(log2.Values()), ShouldResemble, entriesAsStrings(log1.Values()))
+		})
+
+		c.Convey("keeps fetched entries in the entry store of a loaded log", FailureHalts, func(c C) {
+			store := entry.NewDatastoreStore(dssync.MutexWrap(ds.NewMapDatastore()), identity.Provider)
+
+			log2, err := log.NewFromMultihash(ipfs, identity, hash, &log.NewLogOptions{Lazy: true, EntryStore: store}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 10)
+
+			for _, e := range log1.Values().Slice()[:9] {
+				ok, err := store.Has(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+			}
+		})
+
+		c.Convey("reopens from a heads index", FailureHalts, func(c C) {
+			index := &log.HeadsIndex{Datastore: dssync.MutexWrap(ds.NewMapDatastore())}
+
+			log2, err := log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 0)
+
+			_, err = log2.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log2.Join(log1, -1)
+			c.So(err, ShouldBeNil)
+
+			log3, err := log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			c.So(log3.IsLazy(), ShouldBeTrue)
+			c.So(entryHashes(log3.GetHeads()), ShouldResemble, entryHashes(log2.GetHeads()))
+			c.So(log3.Clock.Time, ShouldEqual, log2.Clock.Time)
+			c.So(log3.Entries.Len(), ShouldEqual, 2)
+			c.So(entriesAsStrings(log3.Values()), ShouldResemble, entriesAsStrings(log2.Values()))
+
+			e, err := log3.Append([]byte("hello11"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e.GetClock().Time, ShouldEqual, 11)
+
+			_, err = log3.Prune(3)
+			c.So(err, ShouldBeNil)
+
+			log4, err := log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			c.So(entryHashes(log4.GetHeads()), ShouldResemble, entryHashes(log3.GetHeads()))
+			c.So(log4.GetHeads()[0].GetHash().Equals(e.GetHash()), ShouldBeTrue)
+			c.So(log4.Clock.Time, ShouldEqual, 11)
+
+			_, err = log.NewFromHeadsIndex(ipfs, identity, index, &log.NewLogOptions{ID: "B"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log.NewFromHeadsIndex(ipfs, identity, &log.HeadsIndex{Datastore: index.Datastore, Key: ds.NewKey("A")}, &log.NewLogOptions{ID: "B"})
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -11,18 +11,22 @@ import (
 	"time"
 
 	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
 	"berty.tech/go-ipfs-log/test/logcreator"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
 	cid "github.com/ipfs/go-cid"
 	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/pkg/errors"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func BadComparatorReturnsZero(a *entry.Entry, b *entry.Entry) (int, error) {
+func BadComparatorReturnsZero(a iface.IPFSLogEntry, b iface.IPFSLogEntry) (int, error) {
 	return 0, nil
 }
 
@@ -87,7 +91,7 @@ func TestLogLoad(t *testing.T) {
 
 				values := l.Values()
 
-				c.So(l.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(l.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(values.Len(), ShouldEqual, 16)
 				c.So(entriesAsStrings(values), ShouldResemble, fixture.ExpectedData)
 			})
@@ -102,7 +106,7 @@ func TestLogLoad(t *testing.T) {
 				l, err := log.NewFromJSON(ipfs, identities[0], json, &log.NewLogOptions{ID: "X", SortFn: log.FirstWriteWins}, &entry.FetchOptions{Length: intPtr(-1)})
 				c.So(err, ShouldBeNil)
 
-				c.So(l.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(l.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(l.Values().Len(), ShouldEqual, 16)
 				// TODO: found out why firstWriteExpectedData is what it is in JS test
 
@@ -125,7 +129,7 @@ func TestLogLoad(t *testing.T) {
 				_, err = log1.Join(log2, -1)
 				c.So(err, ShouldBeNil)
 
-				c.So(log1.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(log1.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(log1.Values().Len(), ShouldEqual, 16)
 				c.So(entriesAsStrings(log1.Values()), ShouldResemble, fixture.ExpectedData)
 			})
@@ -143,12 +147,47 @@ func TestLogLoad(t *testing.T) {
 				_, err = log1.Join(log2, -1)
 				c.So(err, ShouldBeNil)
 
-				c.So(log1.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(log1.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(log1.Values().Len(), ShouldEqual, 16)
 				c.So(entriesAsStrings(log1.Values()), ShouldResemble, firstWriteExpectedData)
 			})
 		})
 
+		c.Convey("strict validation", FailureHalts, func(c C) {
+			c.Convey("loads a valid log", FailureHalts, func(c C) {
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "V"})
+				c.So(err, ShouldBeNil)
+				for i := 0; i < 5; i++ {
+					_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				hash, err := log1.ToMultihash()
+				c.So(err, ShouldBeNil)
+
+				log2, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{StrictValidation: true}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+				c.So(log2.Values().Len(), ShouldEqual, 5)
+			})
+
+			c.Convey("reports invalid entries", FailureHalts, func(c C) {
+				e1, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryA1"), LogID: "W"}, lamportclock.New(identities[0].PublicKey, 5))
+				c.So(err, ShouldBeNil)
+				e2, err := entry.CreateEntry(ipfs, identities[1], &entry.Entry{Payload: []byte("entryB1"), LogID: "V", Next: []cid.Cid{e1.GetHash()}}, lamportclock.New(identities[1].PublicKey, 2))
+				c.So(err, ShouldBeNil)
+
+				_, err = log.NewFromEntryHash(ipfs, identities[0], e2.GetHash(), &log.NewLogOptions{ID: "V"}, &log.FetchOptions{})
+				c.So(err, ShouldBeNil)
+
+				_, err = log.NewFromEntryHash(ipfs, identities[0], e2.GetHash(), &log.NewLogOptions{ID: "V", StrictValidation: true}, &log.FetchOptions{})
+				c.So(err, ShouldNotBeNil)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.ValidationFailed)
+				c.So(err.Error(), ShouldContainSubstring, "2 invalid entries")
+				c.So(err.Error(), ShouldContainSubstring, e1.GetHash().String()+": entry belongs to log W instead of V")
+				c.So(err.Error(), ShouldContainSubstring, errmsg.ClockNotMonotonic.Error())
+			})
+		})
+
 		c.Convey("fromEntry", FailureHalts, func(c C) {
 			resortedIdentities := [4]*idp.Identity{identities[2], identities[1], identities[0], identities[3]}
 
@@ -161,7 +200,7 @@ func TestLogLoad(t *testing.T) {
 				l, err := log.NewFromEntry(ipfs, identities[0], data.Heads().Slice(), &log.NewLogOptions{}, &entry.FetchOptions{})
 				c.So(err, ShouldBeNil)
 
-				c.So(l.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(l.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(l.Values().Len(), ShouldEqual, 16)
 				c.So(entriesAsStrings(l.Values()), ShouldResemble, fixture.ExpectedData)
 			})
@@ -175,7 +214,7 @@ func TestLogLoad(t *testing.T) {
 				l, err := log.NewFromEntry(ipfs, identities[0], data.Heads().Slice(), &log.NewLogOptions{SortFn: log.FirstWriteWins}, &entry.FetchOptions{Length: intPtr(-1)})
 				c.So(err, ShouldBeNil)
 
-				c.So(l.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(l.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(l.Values().Len(), ShouldEqual, 16)
 				c.So(entriesAsStrings(l.Values()), ShouldResemble, firstWriteExpectedData)
 			})
@@ -189,33 +228,33 @@ func TestLogLoad(t *testing.T) {
 				log1, err := log.NewFromEntry(ipfs, identities[0], data.Heads().Slice(), &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(data.Heads().Len())})
 
 				c.So(err, ShouldBeNil)
-				c.So(log1.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(log1.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(log1.Values().Len(), ShouldEqual, data.Heads().Len())
-				c.So(string(log1.Values().At(0).Payload), ShouldEqual, "entryC0")
-				c.So(string(log1.Values().At(1).Payload), ShouldEqual, "entryA10")
+				c.So(string(log1.Values().At(0).GetPayload()), ShouldEqual, "entryC0")
+				c.So(string(log1.Values().At(1).GetPayload()), ShouldEqual, "entryA10")
 
 				log2, err := log.NewFromEntry(ipfs, identities[0], data.Heads().Slice(), &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(4)})
 
 				c.So(err, ShouldBeNil)
-				c.So(log2.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(log2.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(log2.Values().Len(), ShouldEqual, 4)
-				c.So(string(log2.Values().At(0).Payload), ShouldEqual, "entryC0")
-				c.So(string(log2.Values().At(1).Payload), ShouldEqual, "entryA8")
-				c.So(string(log2.Values().At(2).Payload), ShouldEqual, "entryA9")
-				c.So(string(log2.Values().At(3).Payload), ShouldEqual, "entryA10")
+				c.So(string(log2.Values().At(0).GetPayload()), ShouldEqual, "entryC0")
+				c.So(string(log2.Values().At(1).GetPayload()), ShouldEqual, "entryA8")
+				c.So(string(log2.Values().At(2).GetPayload()), ShouldEqual, "entryA9")
+				c.So(string(log2.Values().At(3).GetPayload()), ShouldEqual, "entryA10")
 
 				log3, err := log.NewFromEntry(ipfs, identities[0], data.Heads().Slice(), &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(7)})
 
 				c.So(err, ShouldBeNil)
-				c.So(log3.ID, ShouldEqual, data.Heads().At(0).LogID)
+				c.So(log3.ID, ShouldEqual, data.Heads().At(0).GetLogID())
 				c.So(log3.Values().Len(), ShouldEqual, 7)
-				c.So(string(log3.Values().At(0).Payload), ShouldEqual, "entryB5")
-				c.So(string(log3.Values().At(1).Payload), ShouldEqual, "entryA6")
-				c.So(string(log3.Values().At(2).Payload), ShouldEqual, "entryC0")
-				c.So(string(log3.Values().At(3).Payload), ShouldEqual, "entryA7")
-				c.So(string(log3.Values().At(4).Payload), ShouldEqual, "entryA8")
-				c.So(string(log3.Values().At(5).Payload), ShouldEqual, "entryA9")
-				c.So(string(log3.Values().At(6).Payload), ShouldEqual, "entryA10")
+				c.So(string(log3.Values().At(0).GetPayload()), ShouldEqual, "entryB5")
+				c.So(string(log3.Values().At(1).GetPayload()), ShouldEqual, "entryA6")
+				c.So(string(log3.Values().At(2).GetPayload()), ShouldEqual, "entryC0")
+				c.So(string(log3.Values().At(3).GetPayload()), ShouldEqual, "entryA7")
+				c.So(string(log3.Values().At(4).GetPayload()), ShouldEqual, "entryA8")
+				c.So(string(log3.Values().At(5).GetPayload()), ShouldEqual, "entryA9")
+				c.So(string(log3.Values().At(6).GetPayload()), ShouldEqual, "entryA10")
 			})
 
 			c.Convey("onProgress callback is fired for each entry", FailureHalts, func(c C) {
@@ -232,9 +271,9 @@ func TestLogLoad(t *testing.T) {
 				log3, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
 				c.So(err, ShouldBeNil)
 
-				var items1 []*entry.Entry
-				var items2 []*entry.Entry
-				var items3 []*entry.Entry
+				var items1 []iface.IPFSLogEntry
+				var items2 []iface.IPFSLogEntry
+				var items3 []iface.IPFSLogEntry
 
 				const amount = 100
 				for i := 1; i <= amount; i++ {
@@ -244,14 +283,14 @@ func TestLogLoad(t *testing.T) {
 
 					var nexts []cid.Cid
 					if prev1 != nil {
-						nexts = []cid.Cid{prev1.Hash}
+						nexts = []cid.Cid{prev1.GetHash()}
 					}
 
 					n1, err := entry.CreateEntry(ipfs, log1.Identity, &entry.Entry{LogID: "X", Payload: []byte(fmt.Sprintf("entryA%d", i)), Next: nexts}, nil)
 					c.So(err, ShouldBeNil)
 
 					if prev2 != nil {
-						nexts = []cid.Cid{prev2.Hash, n1.Hash}
+						nexts = []cid.Cid{prev2.GetHash(), n1.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash}
 					}
@@ -260,7 +299,7 @@ func TestLogLoad(t *testing.T) {
 					c.So(err, ShouldBeNil)
 
 					if prev3 != nil {
-						nexts = []cid.Cid{prev3.Hash, n1.Hash, n2.Hash}
+						nexts = []cid.Cid{prev3.GetHash(), n1.Hash, n2.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash, n2.Hash}
 					}
@@ -274,12 +313,12 @@ func TestLogLoad(t *testing.T) {
 				}
 
 				// limit to 10 entries
-				a, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(10)})
+				a, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(10)})
 				c.So(err, ShouldBeNil)
 				c.So(a.Values().Len(), ShouldEqual, 10)
 
 				// limit to 42 entries
-				b, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(42)})
+				b, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(42)})
 				c.So(err, ShouldBeNil)
 				c.So(b.Values().Len(), ShouldEqual, 42)
 			})
@@ -294,9 +333,9 @@ func TestLogLoad(t *testing.T) {
 				log3, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
 				c.So(err, ShouldBeNil)
 
-				var items1 []*entry.Entry
-				var items2 []*entry.Entry
-				var items3 []*entry.Entry
+				var items1 []iface.IPFSLogEntry
+				var items2 []iface.IPFSLogEntry
+				var items3 []iface.IPFSLogEntry
 
 				const amount = 100
 				for i := 1; i <= amount; i++ {
@@ -306,14 +345,14 @@ func TestLogLoad(t *testing.T) {
 
 					var nexts []cid.Cid
 					if prev1 != nil {
-						nexts = []cid.Cid{prev1.Hash}
+						nexts = []cid.Cid{prev1.GetHash()}
 					}
 
 					n1, err := entry.CreateEntry(ipfs, log1.Identity, &entry.Entry{LogID: "X", Payload: []byte(fmt.Sprintf("entryA%d", i)), Next: nexts}, nil)
 					c.So(err, ShouldBeNil)
 
 					if prev2 != nil {
-						nexts = []cid.Cid{prev2.Hash, n1.Hash}
+						nexts = []cid.Cid{prev2.GetHash(), n1.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash}
 					}
@@ -322,7 +361,7 @@ func TestLogLoad(t *testing.T) {
 					c.So(err, ShouldBeNil)
 
 					if prev3 != nil {
-						nexts = []cid.Cid{prev3.Hash, n2.Hash}
+						nexts = []cid.Cid{prev3.GetHash(), n2.Hash}
 					} else {
 						nexts = []cid.Cid{n2.Hash}
 					}
@@ -335,15 +374,15 @@ func TestLogLoad(t *testing.T) {
 					items3 = append(items3, n3)
 				}
 
-				lA, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
+				lA, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
 				c.So(err, ShouldBeNil)
 				c.So(lA.Values().Len(), ShouldEqual, amount)
 
-				lB, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
+				lB, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
 				c.So(err, ShouldBeNil)
 				c.So(lB.Values().Len(), ShouldEqual, amount*2)
 
-				lC, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
+				lC, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
 				c.So(err, ShouldBeNil)
 				c.So(lC.Values().Len(), ShouldEqual, amount*3)
 			})
@@ -358,9 +397,9 @@ func TestLogLoad(t *testing.T) {
 				log3, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
 				c.So(err, ShouldBeNil)
 
-				var items1 []*entry.Entry
-				var items2 []*entry.Entry
-				var items3 []*entry.Entry
+				var items1 []iface.IPFSLogEntry
+				var items2 []iface.IPFSLogEntry
+				var items3 []iface.IPFSLogEntry
 
 				const amount = 100
 				for i := 1; i <= amount; i++ {
@@ -370,14 +409,14 @@ func TestLogLoad(t *testing.T) {
 
 					var nexts []cid.Cid
 					if prev1 != nil {
-						nexts = []cid.Cid{prev1.Hash}
+						nexts = []cid.Cid{prev1.GetHash()}
 					}
 
 					n1, err := entry.CreateEntry(ipfs, log1.Identity, &entry.Entry{LogID: "X", Payload: []byte(fmt.Sprintf("entryA%d", i)), Next: nexts}, nil)
 					c.So(err, ShouldBeNil)
 
 					if prev2 != nil {
-						nexts = []cid.Cid{prev2.Hash, n1.Hash}
+						nexts = []cid.Cid{prev2.GetHash(), n1.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash}
 					}
@@ -386,7 +425,7 @@ func TestLogLoad(t *testing.T) {
 					c.So(err, ShouldBeNil)
 
 					if prev3 != nil {
-						nexts = []cid.Cid{prev3.Hash, n1.Hash, n2.Hash}
+						nexts = []cid.Cid{prev3.GetHash(), n1.Hash, n2.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash, n2.Hash}
 					}
@@ -399,15 +438,15 @@ func TestLogLoad(t *testing.T) {
 					items3 = append(items3, n3)
 				}
 
-				lA, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
+				lA, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
 				c.So(err, ShouldBeNil)
 				c.So(lA.Values().Len(), ShouldEqual, amount)
 
-				lB, err := log.NewFromEntry(ipfs, identities[1], []*entry.Entry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
+				lB, err := log.NewFromEntry(ipfs, identities[1], []iface.IPFSLogEntry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
 				c.So(err, ShouldBeNil)
 				c.So(lB.Values().Len(), ShouldEqual, amount*2)
 
-				lC, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
+				lC, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
 				c.So(err, ShouldBeNil)
 				c.So(lC.Values().Len(), ShouldEqual, amount*3)
 			})
@@ -422,9 +461,9 @@ func TestLogLoad(t *testing.T) {
 				log3, err := log.NewLog(ipfs, identities[3], &log.NewLogOptions{ID: "X"})
 				c.So(err, ShouldBeNil)
 
-				var items1 []*entry.Entry
-				var items2 []*entry.Entry
-				var items3 []*entry.Entry
+				var items1 []iface.IPFSLogEntry
+				var items2 []iface.IPFSLogEntry
+				var items3 []iface.IPFSLogEntry
 
 				const amount = 10
 				for i := 1; i <= amount; i++ {
@@ -439,14 +478,14 @@ func TestLogLoad(t *testing.T) {
 					log3.Clock.Tick()
 
 					if prev1 != nil {
-						nexts = []cid.Cid{prev1.Hash}
+						nexts = []cid.Cid{prev1.GetHash()}
 					}
 
 					n1, err := entry.CreateEntry(ipfs, log1.Identity, &entry.Entry{LogID: "X", Payload: []byte(fmt.Sprintf("entryA%d", i)), Next: nexts}, log1.Clock)
 					c.So(err, ShouldBeNil)
 
 					if prev2 != nil {
-						nexts = []cid.Cid{prev2.Hash, n1.Hash}
+						nexts = []cid.Cid{prev2.GetHash(), n1.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash}
 					}
@@ -455,7 +494,7 @@ func TestLogLoad(t *testing.T) {
 					c.So(err, ShouldBeNil)
 
 					if prev3 != nil {
-						nexts = []cid.Cid{prev3.Hash, n1.Hash, n2.Hash}
+						nexts = []cid.Cid{prev3.GetHash(), n1.Hash, n2.Hash}
 					} else {
 						nexts = []cid.Cid{n1.Hash, n2.Hash}
 					}
@@ -475,7 +514,7 @@ func TestLogLoad(t *testing.T) {
 					items3 = append(items3, n3)
 				}
 
-				lA, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
+				lA, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 1)})
 				c.So(err, ShouldBeNil)
 				c.So(lA.Values().Len(), ShouldEqual, amount)
 
@@ -502,12 +541,12 @@ func TestLogLoad(t *testing.T) {
 					"entryB10",
 				}
 
-				lB, err := log.NewFromEntry(ipfs, identities[1], []*entry.Entry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
+				lB, err := log.NewFromEntry(ipfs, identities[1], []iface.IPFSLogEntry{lastEntry(items2)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 2)})
 				c.So(err, ShouldBeNil)
 				c.So(lB.Values().Len(), ShouldEqual, amount*2)
 				c.So(entriesAsStrings(lB.Values()), ShouldResemble, itemsInB)
 
-				lC, err := log.NewFromEntry(ipfs, identities[3], []*entry.Entry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
+				lC, err := log.NewFromEntry(ipfs, identities[3], []iface.IPFSLogEntry{lastEntry(items3)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(amount * 3)})
 				c.So(err, ShouldBeNil)
 
 				_, err = lC.Append([]byte("EOF"), 1)
@@ -564,7 +603,7 @@ func TestLogLoad(t *testing.T) {
 				_, err = logX.Append([]byte{'3'}, 1)
 				c.So(err, ShouldBeNil)
 
-				lD, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{lastEntry(logX.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1)})
+				lD, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{lastEntry(logX.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1)})
 				c.So(err, ShouldBeNil)
 
 				_, err = lC.Join(lD, -1)
@@ -579,10 +618,10 @@ func TestLogLoad(t *testing.T) {
 				_, err = lD.Append([]byte("DONE"), 1)
 				c.So(err, ShouldBeNil)
 
-				logF, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{lastEntry(lC.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1), Exclude: nil})
+				logF, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{lastEntry(lC.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1), Exclude: nil})
 				c.So(err, ShouldBeNil)
 
-				logG, err := log.NewFromEntry(ipfs, identities[2], []*entry.Entry{lastEntry(lD.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1), Exclude: nil})
+				logG, err := log.NewFromEntry(ipfs, identities[2], []iface.IPFSLogEntry{lastEntry(lD.Values().Slice())}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1), Exclude: nil})
 				c.So(err, ShouldBeNil)
 
 				c.So(logF.ToString(nil), ShouldEqual, bigLogString)
@@ -725,31 +764,31 @@ func TestLogLoad(t *testing.T) {
 				c.So(entriesAsStrings(entry.NewOrderedMapFromEntries(reverseOrder)), ShouldResemble, expectedData)
 
 				hashOrder := l.Values().Slice()
-				entry.Sort(func(a, b *entry.Entry) (int, error) {
-					return strings.Compare(a.Hash.String(), b.Hash.String()), nil
+				entry.Sort(func(a, b iface.IPFSLogEntry) (int, error) {
+					return strings.Compare(a.GetHash().String(), b.GetHash().String()), nil
 				}, hashOrder)
 				entry.Sort(entry.Compare, hashOrder)
 				c.So(entriesAsStrings(entry.NewOrderedMapFromEntries(hashOrder)), ShouldResemble, expectedData)
 
-				var partialLog []*entry.Entry
+				var partialLog []iface.IPFSLogEntry
 				for _, item := range l.Values().Slice() {
-					if bytes.Compare(item.Payload, []byte("entryC0")) != 0 {
+					if bytes.Compare(item.GetPayload(), []byte("entryC0")) != 0 {
 						partialLog = append(partialLog, item)
 					}
 				}
 				c.So(entriesAsStrings(entry.NewOrderedMapFromEntries(partialLog)), ShouldResemble, expectedData2)
 
-				var partialLog2 []*entry.Entry
+				var partialLog2 []iface.IPFSLogEntry
 				for _, item := range l.Values().Slice() {
-					if bytes.Compare(item.Payload, []byte("entryA10")) != 0 {
+					if bytes.Compare(item.GetPayload(), []byte("entryA10")) != 0 {
 						partialLog2 = append(partialLog2, item)
 					}
 				}
 				c.So(entriesAsStrings(entry.NewOrderedMapFromEntries(partialLog2)), ShouldResemble, expectedData3)
 
-				var partialLog3 []*entry.Entry
+				var partialLog3 []iface.IPFSLogEntry
 				for _, item := range l.Values().Slice() {
-					if bytes.Compare(item.Payload, []byte("entryB5")) != 0 {
+					if bytes.Compare(item.GetPayload(), []byte("entryB5")) != 0 {
 						partialLog3 = append(partialLog3, item)
 					}
 				}
@@ -769,7 +808,7 @@ func TestLogLoad(t *testing.T) {
 
 				for i := 0; i < 1000; i++ {
 					randomOrder := l.Values().Slice()
-					entry.Sort(func(a, b *entry.Entry) (int, error) {
+					entry.Sort(func(a, b iface.IPFSLogEntry) (int, error) {
 						return rand.Int(), nil
 					}, randomOrder)
 					entry.Sort(entry.Compare, randomOrder)
@@ -796,9 +835,13 @@ func TestLogLoad(t *testing.T) {
 				c.So(err, ShouldBeNil)
 
 				_, err = firstWriteWinsLog.Join(testLog.Log, -1)
-				// TODO: the error is only thrown silently when calling .Values(), should we handle it properly
-				//firstWriteWinsLog.Values()
-				//c.So(err, ShouldNotBeNil)
+				c.So(err, ShouldBeNil)
+
+				_, err = firstWriteWinsLog.Traverse(firstWriteWinsLog.Heads(), -1, "")
+				c.So(err, ShouldNotBeNil)
+
+				_, _, err = firstWriteWinsLog.ValuesPage("", -1)
+				c.So(err, ShouldNotBeNil)
 			})
 
 			c.Convey("retrieves partially joined log deterministically - single next pointer", FailureHalts, func(c C) {
@@ -961,7 +1004,7 @@ func TestLogLoad(t *testing.T) {
 			})
 
 			c.Convey("throws an error if ipfs is not defined", FailureHalts, func(c C) {
-				_, err := log.NewFromEntry(nil, identities[0], []*entry.Entry{}, &log.NewLogOptions{ID: "X"}, &entry.FetchOptions{})
+				_, err := log.NewFromEntry(nil, identities[0], []iface.IPFSLogEntry{}, &log.NewLogOptions{ID: "X"}, &entry.FetchOptions{})
 				c.So(err, ShouldNotBeNil)
 				c.So(err.Error(), ShouldContainSubstring, "ipfs instance not defined")
 			})
@@ -979,9 +1022,9 @@ func TestLogLoad(t *testing.T) {
 				log3, err := log.NewLog(ipfs, identities[2], &log.NewLogOptions{ID: "X"})
 				c.So(err, ShouldBeNil)
 
-				var items1 []*entry.Entry
-				var items2 []*entry.Entry
-				var items3 []*entry.Entry
+				var items1 []iface.IPFSLogEntry
+				var items2 []iface.IPFSLogEntry
+				var items3 []iface.IPFSLogEntry
 
 				for i := 1; i <= amount; i++ {
 					var nexts []cid.Cid
@@ -990,7 +1033,7 @@ func TestLogLoad(t *testing.T) {
 					prev3 := lastEntry(items3)
 
 					if prev1 != nil {
-						nexts = []cid.Cid{prev1.Hash}
+						nexts = []cid.Cid{prev1.GetHash()}
 					}
 
 					n1, err := entry.CreateEntry(ipfs, log1.Identity, &entry.Entry{LogID: log1.ID, Payload: []byte(fmt.Sprintf("entryA%d-%d", i, ts)), Next: nexts}, log1.Clock)
@@ -998,7 +1041,7 @@ func TestLogLoad(t *testing.T) {
 
 					nexts = []cid.Cid{n1.Hash}
 					if prev2 != nil {
-						nexts = []cid.Cid{prev2.Hash, n1.Hash}
+						nexts = []cid.Cid{prev2.GetHash(), n1.Hash}
 					}
 
 					n2, err := entry.CreateEntry(ipfs, log2.Identity, &entry.Entry{LogID: log2.ID, Payload: []byte(fmt.Sprintf("entryB%d-%d", i, ts)), Next: nexts}, log2.Clock)
@@ -1006,7 +1049,7 @@ func TestLogLoad(t *testing.T) {
 
 					nexts = []cid.Cid{n1.Hash, n2.Hash}
 					if prev2 != nil {
-						nexts = []cid.Cid{prev3.Hash, n1.Hash, n2.Hash}
+						nexts = []cid.Cid{prev3.GetHash(), n1.Hash, n2.Hash}
 					}
 
 					n3, err := entry.CreateEntry(ipfs, log3.Identity, &entry.Entry{LogID: log3.ID, Payload: []byte(fmt.Sprintf("entryC%d-%d", i, ts)), Next: nexts}, log3.Clock)
@@ -1027,27 +1070,27 @@ func TestLogLoad(t *testing.T) {
 				}
 
 				c.Convey("returns all entries - no excluded entries", FailureHalts, func(c C) {
-					a, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1)})
+					a, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Length: intPtr(-1)})
 					c.So(err, ShouldBeNil)
 
 					c.So(a.Values().Len(), ShouldEqual, amount)
-					c.So(a.Values().At(0).Hash.String(), ShouldEqual, items1[0].Hash.String())
+					c.So(a.Values().At(0).GetHash().String(), ShouldEqual, items1[0].GetHash().String())
 				})
 
 				c.Convey("returns all entries - including excluded entries", FailureHalts, func(c C) {
 					// One entry
-					a, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Exclude: []*entry.Entry{items1[0]}, Length: intPtr(-1)})
+					a, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Exclude: []iface.IPFSLogEntry{items1[0]}, Length: intPtr(-1)})
 					c.So(err, ShouldBeNil)
 
 					c.So(a.Values().Len(), ShouldEqual, amount)
-					c.So(a.Values().At(0).Hash.String(), ShouldEqual, items1[0].Hash.String())
+					c.So(a.Values().At(0).GetHash().String(), ShouldEqual, items1[0].GetHash().String())
 
 					// All entries
-					b, err := log.NewFromEntry(ipfs, identities[0], []*entry.Entry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Exclude: items1, Length: intPtr(-1)})
+					b, err := log.NewFromEntry(ipfs, identities[0], []iface.IPFSLogEntry{lastEntry(items1)}, &log.NewLogOptions{}, &entry.FetchOptions{Exclude: items1, Length: intPtr(-1)})
 					c.So(err, ShouldBeNil)
 
 					c.So(b.Values().Len(), ShouldEqual, amount)
-					c.So(b.Values().At(0).Hash.String(), ShouldEqual, items1[0].Hash.String())
+					c.So(b.Values().At(0).GetHash().String(), ShouldEqual, items1[0].GetHash().String())
 				})
 			})
 		})
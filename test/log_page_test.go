@@ -0,0 +1,130 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogValuesPage(t *testing.T) {
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	payloads := func(entries []iface.IPFSLogEntry) []string {
+		p := []string{}
+		for _, e := range entries {
+			p = append(p, string(e.GetPayload()))
+		}
+
+		return p
+	}
+
+	Convey("Log - Values page", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 5; i++ {
+			_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		_, err = logA.Join(logB, -1)
+		c.So(err, ShouldBeNil)
+
+		values := logA.Values().Slice()
+		reversed := []iface.IPFSLogEntry{}
+		for i := len(values) - 1; i >= 0; i-- {
+			reversed = append(reversed, values[i])
+		}
+
+		c.Convey("returns the entries from the newest", FailureHalts, func(c C) {
+			pages := [][]string{}
+			token := ""
+			for {
+				entries, next, err := logA.ValuesPage(token, 3)
+				c.So(err, ShouldBeNil)
+
+				pages = append(pages, payloads(entries))
+				if next == "" {
+					break
+				}
+
+				token = next
+			}
+
+			c.So(len(pages), ShouldEqual, 4)
+
+			all := []string{}
+			for _, page := range pages {
+				all = append(all, page...)
+			}
+
+			c.So(all, ShouldResemble, payloads(reversed))
+
+			entries, next, err := logA.ValuesPage("", -1)
+			c.So(err, ShouldBeNil)
+			c.So(next, ShouldEqual, "")
+			c.So(payloads(entries), ShouldResemble, payloads(reversed))
+		})
+
+		c.Convey("keeps the next pages when entries are added", FailureHalts, func(c C) {
+			first, token, err := logA.ValuesPage("", 4)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(first), ShouldResemble, payloads(reversed[:4]))
+
+			_, err = logB.Append([]byte("helloB5"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Join(logB, -1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("helloA5"), 1)
+			c.So(err, ShouldBeNil)
+
+			second, _, err := logA.ValuesPage(token, 4)
+			c.So(err, ShouldBeNil)
+			c.So(payloads(second), ShouldResemble, payloads(reversed[4:8]))
+		})
+
+		c.Convey("fails with an invalid token", FailureHalts, func(c C) {
+			_, _, err := logA.ValuesPage("invalid", 4)
+			c.So(err, ShouldEqual, errmsg.InvalidPageToken)
+		})
+
+		c.Convey("fails with an empty page", FailureHalts, func(c C) {
+			_, token, err := logA.ValuesPage("", 4)
+			c.So(err, ShouldBeNil)
+
+			_, _, err = logA.ValuesPage(token, 0)
+			c.So(err, ShouldEqual, errmsg.InvalidPageLimit)
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogQuery(t *testing.T) {
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	payloads := func(entries []iface.IPFSLogEntry) []string {
+		p := []string{}
+		for _, e := range entries {
+			p = append(p, string(e.GetPayload()))
+		}
+
+		return p
+	}
+
+	Convey("Log - Query", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+		wall := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		now := func() time.Time { return wall }
+
+		logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X", Timestamps: true, Now: now})
+		c.So(err, ShouldBeNil)
+
+		logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X", Timestamps: true, Now: now})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 6; i++ {
+			kind := "even"
+			if i%2 == 1 {
+				kind = "odd"
+			}
+
+			_, err := logA.AppendWithOptions([]byte(fmt.Sprintf("helloA%d", i)), &log.AppendOptions{PointerCount: 1, Metadata: map[string]string{"kind": kind}})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.AppendWithOptions([]byte(fmt.Sprintf("helloB%d", i)), &log.AppendOptions{PointerCount: 1, Metadata: map[string]string{"kind": kind}})
+			c.So(err, ShouldBeNil)
+
+			wall = wall.Add(time.Minute)
+		}
+
+		_, err = logA.Join(logB, -1)
+		c.So(err, ShouldBeNil)
+
+		all, err := logA.Query().All()
+		c.So(err, ShouldBeNil)
+		c.So(payloads(all), ShouldResemble, entriesAsStrings(logA.Values()))
+
+		c.Convey("filters by author and metadata", FailureHalts, func(c C) {
+			entries, err := logA.Query().Author(identities[1].ID).Metadata("kind", "odd").All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloB1", "helloB3", "helloB5"})
+		})
+
+		c.Convey("filters by clock range and payload", FailureHalts, func(c C) {
+			entries, err := logA.Query().ClockRange(2, 4).Payload(func(p []byte) bool {
+				return bytes.HasPrefix(p, []byte("helloA"))
+			}).All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloA1", "helloA2", "helloA3"})
+		})
+
+		c.Convey("filters by timestamp", FailureHalts, func(c C) {
+			start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			entries, err := logA.Query().Between(start.Add(4*time.Minute), time.Time{}).Author(identities[0].ID).All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloA4", "helloA5"})
+		})
+
+		c.Convey("limits and orders the entries", FailureHalts, func(c C) {
+			entries, err := logA.Query().Limit(3).All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, payloads(all[:3]))
+
+			entries, err = logA.Query().Descending().Limit(3).All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{
+				string(all[len(all)-1].GetPayload()),
+				string(all[len(all)-2].GetPayload()),
+				string(all[len(all)-3].GetPayload()),
+			})
+
+			entries, err = logA.Query().Author(identities[0].ID).Descending().Limit(2).All()
+			c.So(err, ShouldBeNil)
+			c.So(payloads(entries), ShouldResemble, []string{"helloA5", "helloA4"})
+		})
+
+		c.Convey("is evaluated lazily", FailureHalts, func(c C) {
+			visited := 0
+			query := logA.Query().Descending().Where(func(e iface.IPFSLogEntry) bool {
+				visited++
+				return true
+			})
+			c.So(visited, ShouldEqual, 0)
+
+			first := []iface.IPFSLogEntry{}
+			err := query.Seq(func(e iface.IPFSLogEntry) bool {
+				first = append(first, e)
+				return false
+			})
+			c.So(err, ShouldBeNil)
+			c.So(len(first), ShouldEqual, 1)
+			c.So(visited, ShouldEqual, 1)
+		})
+	})
+}
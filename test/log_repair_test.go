@@ -0,0 +1,126 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogRepair(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       fmt.Sprintf("userA"),
+		Type:     "orbitdb",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - Repair", t, FailureHalts, func(c C) {
+		index := &log.HeadsIndex{Datastore: dssync.MutexWrap(ds.NewMapDatastore())}
+
+		log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", HeadsIndex: index})
+		c.So(err, ShouldBeNil)
+
+		for i := 0; i < 10; i++ {
+			_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+			c.So(err, ShouldBeNil)
+		}
+
+		head := log1.GetHeads()[0]
+
+		var report *log.RepairReport
+		repair := func(r *log.RepairReport) {
+			report = r
+		}
+
+		c.Convey("refetches the heads missing from a snapshot", FailureHalts, func(c C) {
+			snapshot := log1.ToSnapshot()
+			snapshot.Values = snapshot.Values[:9]
+
+			log2, err := log.NewFromSnapshot(ipfs, identity, snapshot, &log.NewLogOptions{Repair: repair})
+			c.So(err, ShouldBeNil)
+			c.So(report.Refetched, ShouldResemble, []cid.Cid{head.GetHash()})
+			c.So(entriesAsStrings(log2.Values()), ShouldResemble, entriesAsStrings(log1.Values()))
+		})
+
+		c.Convey("rolls a snapshot back to the entries it holds", FailureHalts, func(c C) {
+			snapshot := log1.ToSnapshot()
+			snapshot.Values = snapshot.Values[:9]
+
+			log2, err := log.NewFromSnapshot(io.NewMemoryServices(), identity, snapshot, &log.NewLogOptions{Repair: repair})
+			c.So(err, ShouldBeNil)
+			c.So(report.Dropped, ShouldResemble, []cid.Cid{head.GetHash()})
+			c.So(string(log2.GetHeads()[0].GetPayload()), ShouldEqual, "hello8")
+			c.So(log2.Values().Len(), ShouldEqual, 9)
+		})
+
+		c.Convey("drops the heads of an index which can't be read", FailureHalts, func(c C) {
+			_, err := log.NewFromHeadsIndex(io.NewMemoryServices(), identity, index, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldNotBeNil)
+
+			log2, err := log.NewFromHeadsIndex(io.NewMemoryServices(), identity, index, &log.NewLogOptions{ID: "A", Repair: repair})
+			c.So(err, ShouldBeNil)
+			c.So(report.Dropped, ShouldResemble, []cid.Cid{head.GetHash()})
+			c.So(log2.Values().Len(), ShouldEqual, 0)
+
+			log3, err := log.NewFromHeadsIndex(io.NewMemoryServices(), identity, index, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			c.So(log3.Values().Len(), ShouldEqual, 0)
+		})
+
+		c.Convey("removes dangling Next index items", FailureHalts, func(c C) {
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Join(log2, 3)
+			c.So(err, ShouldBeNil)
+
+			report, err := log1.Repair()
+			c.So(err, ShouldBeNil)
+			c.So(report.OK(), ShouldBeFalse)
+			c.So(len(report.DanglingNext), ShouldEqual, 6)
+			c.So(entriesAsStrings(log1.Values()), ShouldResemble, []string{"hello7", "hello8", "hello9"})
+
+			report, err = log1.Repair()
+			c.So(err, ShouldBeNil)
+			c.So(report.OK(), ShouldBeTrue)
+		})
+
+		c.Convey("removes stale heads", FailureHalts, func(c C) {
+			first := log1.Values().At(0)
+
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", Entries: log1.Entries, Heads: []iface.IPFSLogEntry{first, head}})
+			c.So(err, ShouldBeNil)
+
+			report, err := log2.Repair()
+			c.So(err, ShouldBeNil)
+			c.So(report.Stale, ShouldResemble, []cid.Cid{first.GetHash()})
+			c.So(entryHashes(log2.GetHeads()), ShouldResemble, []cid.Cid{head.GetHash()})
+		})
+	})
+}
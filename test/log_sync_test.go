@@ -0,0 +1,225 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// copyBlocks copies the blocks of the given CIDs from a store to another
+func copyBlocks(from, to io.IpfsServices, hashes []cid.Cid) error {
+	for _, h := range hashes {
+		b, err := from.BlockStore().Get(h)
+		if err != nil {
+			return err
+		}
+
+		if err := to.BlockStore().Put(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func entryHashes(entries []iface.IPFSLogEntry) []cid.Cid {
+	hashes := []cid.Cid{}
+	for _, e := range entries {
+		hashes = append(hashes, e.GetHash())
+	}
+
+	return hashes
+}
+
+func TestLogSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Log - SyncFromHeads", t, FailureHalts, func(c C) {
+		c.Convey("only fetches the missing entries", FailureHalts, func(c C) {
+			ipfsA := io.NewMemoryServices()
+			ipfsB := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfsA, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			appendN := func(from, to int) []iface.IPFSLogEntry {
+				entries := []iface.IPFSLogEntry{}
+				for i := from; i < to; i++ {
+					e, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+					entries = append(entries, e)
+				}
+
+				return entries
+			}
+
+			c.So(copyBlocks(ipfsA, ipfsB, entryHashes(appendN(0, 5))), ShouldBeNil)
+
+			logB, err := log.NewLog(ipfsB, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			added, err := logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), nil)
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 5)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+
+			// Only the new blocks are available, the known entries can't
+			// be fetched again
+			c.So(copyBlocks(ipfsA, ipfsB, entryHashes(appendN(5, 10))), ShouldBeNil)
+
+			added, err = logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), nil)
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 5)
+			c.So(string(added[0].GetPayload()), ShouldEqual, "hello9")
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+
+			added, err = logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), nil)
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 0)
+		})
+
+		c.Convey("reports the progress of each entry", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			events := make(chan log.SyncEvent, 64)
+			_, err = logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Events: events})
+			c.So(err, ShouldBeNil)
+			close(events)
+
+			stages := map[string][]log.SyncEventType{}
+			for e := range events {
+				c.So(e.Err, ShouldBeNil)
+				stages[e.Hash.String()] = append(stages[e.Hash.String()], e.Type)
+			}
+
+			c.So(len(stages), ShouldEqual, 3)
+			for _, e := range logA.Values().Slice() {
+				c.So(stages[e.GetHash().String()], ShouldResemble, []log.SyncEventType{
+					log.SyncQueued, log.SyncFetching, log.SyncFetched, log.SyncVerified, log.SyncJoined,
+				})
+			}
+
+			// Entries which can't be fetched fail
+			_, err = logA.Append([]byte("hello3"), 1)
+			c.So(err, ShouldBeNil)
+
+			logC, err := log.NewLog(io.NewMemoryServices(), identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			events = make(chan log.SyncEvent, 64)
+			_, err = logC.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Events: events})
+			c.So(err, ShouldNotBeNil)
+			close(events)
+
+			last := log.SyncEvent{}
+			for e := range events {
+				last = e
+			}
+			c.So(last.Type, ShouldEqual, log.SyncFailed)
+			c.So(last.Err, ShouldNotBeNil)
+
+			// Entries of other logs fail
+			logY, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "Y"})
+			c.So(err, ShouldBeNil)
+
+			events = make(chan log.SyncEvent, 64)
+			added, err := logY.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Events: events})
+			c.So(err, ShouldBeNil)
+			c.So(added, ShouldHaveLength, 0)
+			close(events)
+
+			last = log.SyncEvent{}
+			for e := range events {
+				last = e
+			}
+			c.So(last.Type, ShouldEqual, log.SyncFailed)
+			c.So(last.Hash.String(), ShouldEqual, logA.GetHeads()[0].GetHash().String())
+			c.So(errors.Is(last.Err, errmsg.WrongLog), ShouldBeTrue)
+		})
+
+		c.Convey("limits the number of fetched entries", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{MaxEntries: 2})
+			c.So(err, ShouldNotBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 0)
+
+			added, err := logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{MaxEntries: 5})
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 5)
+		})
+
+		c.Convey("fails when an entry can't be fetched", FailureHalts, func(c C) {
+			ipfsA := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfsA, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(io.NewMemoryServices(), identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Timeout: time.Second})
+			c.So(err, ShouldNotBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 0)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			_, err = logB.SyncFromHeads(canceled, entryHashes(logA.GetHeads()), nil)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,9 +1,10 @@
 package test // import "berty.tech/go-ipfs-log/test"
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
 	"testing"
 	"time"
 
@@ -11,11 +12,16 @@ import (
 
 	"berty.tech/go-ipfs-log/entry"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
 	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/pkg/errors"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -59,16 +65,17 @@ func TestLog(t *testing.T) {
 				c.So(log1.Clock.ID, ShouldResemble, identities[0].PublicKey)
 			})
 
-			c.Convey("sets time.now as id string if id is not passed as an argument", FailureHalts, func(c C) {
-				before := time.Now().Unix() / 1000
-				log1, err := log.NewLog(ipfs, identities[0], nil)
+			c.Convey("sets the address of the name as id if id is not passed as an argument", FailureHalts, func(c C) {
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{Name: "A"})
+				c.So(err, ShouldBeNil)
+
+				addr, err := log.ParseAddress(log1.ID)
 				c.So(err, ShouldBeNil)
-				after := time.Now().Unix() / 1000
+				c.So(addr.Name, ShouldEqual, "A")
 
-				logid, err := strconv.ParseInt(log1.ID, 10, 64)
+				log2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{Name: "A"})
 				c.So(err, ShouldBeNil)
-				c.So(logid, ShouldBeGreaterThanOrEqualTo, before)
-				c.So(logid, ShouldBeLessThanOrEqualTo, after)
+				c.So(log2.ID, ShouldEqual, log1.ID)
 			})
 
 			c.Convey("sets items if given as params", FailureHalts, func(c C) {
@@ -98,7 +105,7 @@ func TestLog(t *testing.T) {
 				e3, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryC"), LogID: "A"}, lamportclock.New(id3.PublicKey, 2))
 				c.So(err, ShouldBeNil)
 
-				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entry.NewOrderedMapFromEntries([]*entry.Entry{e1, e2, e3})})
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1, e2, e3})})
 				c.So(err, ShouldBeNil)
 
 				values := log1.Values()
@@ -106,9 +113,29 @@ func TestLog(t *testing.T) {
 				c.So(values.Len(), ShouldEqual, 3)
 
 				keys := values.Keys()
-				c.So(string(values.UnsafeGet(keys[0]).Payload), ShouldEqual, "entryA")
-				c.So(string(values.UnsafeGet(keys[1]).Payload), ShouldEqual, "entryB")
-				c.So(string(values.UnsafeGet(keys[2]).Payload), ShouldEqual, "entryC")
+				c.So(string(values.UnsafeGet(keys[0]).GetPayload()), ShouldEqual, "entryA")
+				c.So(string(values.UnsafeGet(keys[1]).GetPayload()), ShouldEqual, "entryB")
+				c.So(string(values.UnsafeGet(keys[2]).GetPayload()), ShouldEqual, "entryC")
+			})
+
+			c.Convey("copies the given entries unless it owns them", FailureHalts, func(c C) {
+				e1, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryA"), LogID: "A"}, nil)
+				c.So(err, ShouldBeNil)
+
+				entries := entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1})
+
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entries})
+				c.So(err, ShouldBeNil)
+				c.So(log1.Entries, ShouldNotPointTo, entries)
+
+				log2, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entries, OwnEntries: true})
+				c.So(err, ShouldBeNil)
+				c.So(log2.Entries, ShouldPointTo, entries)
+
+				_, err = log2.Append([]byte("entryB"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(log1.Values().Len(), ShouldEqual, 1)
+				c.So(log2.Values().Len(), ShouldEqual, 2)
 			})
 
 			c.Convey("sets heads if given as params", FailureHalts, func(c C) {
@@ -119,13 +146,13 @@ func TestLog(t *testing.T) {
 				e3, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryC"), LogID: "A"}, nil)
 				c.So(err, ShouldBeNil)
 
-				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "B", Entries: entry.NewOrderedMapFromEntries([]*entry.Entry{e1, e2, e3}), Heads: []*entry.Entry{e3}})
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "B", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1, e2, e3}), Heads: []iface.IPFSLogEntry{e3}})
 				c.So(err, ShouldBeNil)
 				heads := log1.Heads()
 				headsKeys := heads.Keys()
 
 				c.So(heads.Len(), ShouldEqual, 1)
-				c.So(heads.UnsafeGet(headsKeys[0]).Hash.String(), ShouldEqual, e3.Hash.String())
+				c.So(heads.UnsafeGet(headsKeys[0]).GetHash().String(), ShouldEqual, e3.Hash.String())
 			})
 
 			c.Convey("finds heads if heads not given as params", FailureHalts, func(c C) {
@@ -136,23 +163,23 @@ func TestLog(t *testing.T) {
 				e3, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("entryC"), LogID: "A"}, nil)
 				c.So(err, ShouldBeNil)
 
-				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entry.NewOrderedMapFromEntries([]*entry.Entry{e1, e2, e3})})
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1, e2, e3})})
 				c.So(err, ShouldBeNil)
 				heads := log1.Heads()
 
 				headsKeys := heads.Keys()
 
 				c.So(heads.Len(), ShouldEqual, 3)
-				c.So(heads.UnsafeGet(headsKeys[2]).Hash.String(), ShouldEqual, e1.Hash.String())
-				c.So(heads.UnsafeGet(headsKeys[1]).Hash.String(), ShouldEqual, e2.Hash.String())
-				c.So(heads.UnsafeGet(headsKeys[0]).Hash.String(), ShouldEqual, e3.Hash.String())
+				c.So(heads.UnsafeGet(headsKeys[2]).GetHash().String(), ShouldEqual, e1.Hash.String())
+				c.So(heads.UnsafeGet(headsKeys[1]).GetHash().String(), ShouldEqual, e2.Hash.String())
+				c.So(heads.UnsafeGet(headsKeys[0]).GetHash().String(), ShouldEqual, e3.Hash.String())
 			})
 
 			c.Convey("creates default public AccessController if not defined", FailureHalts, func(c C) {
 				log1, err := log.NewLog(ipfs, identities[0], nil)
 				c.So(err, ShouldBeNil)
 
-				err = log1.AccessController.CanAppend(&entry.Entry{Payload: []byte("any")}, identities[0])
+				err = log1.AccessController.CanAppend(context.Background(), &entry.Entry{Payload: []byte("any")}, identities[0].Provider, log1)
 				c.So(err, ShouldBeNil)
 			})
 
@@ -180,5 +207,397 @@ func TestLog(t *testing.T) {
 
 			c.So(log1.ToString(nil), ShouldEqual, expectedData)
 		})
+
+		c.Convey("toBuffer", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			e, err := log1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			data, err := log1.ToBuffer()
+			c.So(err, ShouldBeNil)
+			c.So(string(data), ShouldContainSubstring, `"Heads":[{"/":"`+io.CIDString(e.GetHash())+`"}]`)
+			c.So(io.CIDString(e.GetHash()), ShouldStartWith, "zdpu")
+
+			decoded := &log.JSONLog{}
+			c.So(json.Unmarshal(data, decoded), ShouldBeNil)
+			c.So(decoded, ShouldResemble, log1.ToJSON())
+		})
+
+		c.Convey("streams values", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			for _, val := range []string{"one", "two", "three", "four", "five"} {
+				_, err := log1.Append([]byte(val), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			values := log1.Values().Slice()
+
+			yielded := []iface.IPFSLogEntry{}
+			c.So(log1.ValuesSeq(func(e iface.IPFSLogEntry) bool {
+				yielded = append(yielded, e)
+				return len(yielded) < 2
+			}), ShouldBeNil)
+			c.So(yielded, ShouldResemble, []iface.IPFSLogEntry{values[4], values[3]})
+
+			received := []iface.IPFSLogEntry{}
+			for e := range log1.ValuesChan(context.Background()) {
+				received = append(received, e)
+			}
+			c.So(received, ShouldResemble, []iface.IPFSLogEntry{values[4], values[3], values[2], values[1], values[0]})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := log1.ValuesChan(ctx)
+			<-ch
+			cancel()
+			for range ch {
+			}
+		})
+
+		c.Convey("update listeners", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			first, second := 0, 0
+			unsubscribe := log1.OnUpdate(func(*log.Log) { first++ })
+			log1.OnUpdate(func(*log.Log) { second++ })
+
+			_, err = log1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(first, ShouldEqual, 1)
+			c.So(second, ShouldEqual, 1)
+
+			unsubscribe()
+			unsubscribe()
+
+			_, err = log1.Append([]byte("two"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(first, ShouldEqual, 1)
+			c.So(second, ShouldEqual, 2)
+		})
+
+		c.Convey("inclusion proofs", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			var entries []iface.IPFSLogEntry
+			for i := 0; i < 10; i++ {
+				e, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+				entries = append(entries, e)
+			}
+
+			head := entries[9].GetHash()
+
+			proof, err := log1.Prove(entries[2].GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(proof.Path, ShouldHaveLength, 8)
+
+			proven, err := log.VerifyProof(proof, head)
+			c.So(err, ShouldBeNil)
+			c.So(proven.GetHash().Equals(entries[2].GetHash()), ShouldBeTrue)
+			c.So(string(proven.GetPayload()), ShouldEqual, "hello2")
+
+			_, err = log.VerifyProof(proof, entries[8].GetHash())
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidProof)
+
+			proof.Blocks[3] = proof.Blocks[4]
+			_, err = log.VerifyProof(proof, head)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidProof)
+
+			other, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "B"})
+			c.So(err, ShouldBeNil)
+			e, err := other.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Prove(e.GetHash())
+			c.So(errors.Cause(err), ShouldEqual, errmsg.EntryNotFound)
+		})
+
+		c.Convey("integrity verification", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 10; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 2)
+				c.So(err, ShouldBeNil)
+			}
+
+			report, err := log1.Verify(context.Background())
+			c.So(err, ShouldBeNil)
+			c.So(report.OK(), ShouldBeTrue)
+			c.So(report.Checked, ShouldEqual, 10)
+
+			missing, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: mh.SHA2_256, MhLength: -1}.Sum([]byte("missing"))
+			c.So(err, ShouldBeNil)
+
+			e1, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("hello1"), LogID: "B", Next: []cid.Cid{missing}}, nil)
+			c.So(err, ShouldBeNil)
+			e2, err := entry.CreateEntry(ipfs, identities[0], &entry.Entry{Payload: []byte("hello2"), LogID: "B", Next: []cid.Cid{e1.GetHash()}}, lamportclock.New(identities[0].PublicKey, 1))
+			c.So(err, ShouldBeNil)
+
+			tampered := e2.Copy()
+			tampered.Payload = []byte("tampered")
+
+			log2, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "B", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e1, tampered})})
+			c.So(err, ShouldBeNil)
+
+			report, err = log2.Verify(context.Background())
+			c.So(err, ShouldBeNil)
+			c.So(report.OK(), ShouldBeFalse)
+			c.So(report.Checked, ShouldEqual, 2)
+
+			kinds := map[string]string{}
+			for _, p := range report.Problems {
+				kinds[p.Kind] = p.Hash.String()
+			}
+
+			c.So(kinds, ShouldResemble, map[string]string{
+				log.ProblemHash:        e2.GetHash().String(),
+				log.ProblemSignature:   e2.GetHash().String(),
+				log.ProblemMissingNext: e1.GetHash().String(),
+			})
+
+			// Entries whose block isn't stored are reported
+			unstored, err := entry.CreateEntry(io.NewMemoryServices(), identities[0], &entry.Entry{Payload: []byte("hello"), LogID: "C"}, nil)
+			c.So(err, ShouldBeNil)
+
+			log3, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "C", Entries: entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{unstored})})
+			c.So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			report, err = log3.Verify(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(report.Problems, ShouldHaveLength, 1)
+			c.So(report.Problems[0].Kind, ShouldEqual, log.ProblemMissingBlock)
+			c.So(report.Problems[0].Hash, ShouldResemble, unstored.GetHash())
+
+			ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+			_, err = log1.Verify(ctx)
+			c.So(err, ShouldEqual, context.Canceled)
+		})
+
+		c.Convey("snapshots", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			snapshot := log1.ToSnapshot()
+			c.So(snapshot.Clock, ShouldNotBeNil)
+			c.So(snapshot.Clock.Time, ShouldEqual, 3)
+			c.So(snapshot.Clock.ID, ShouldResemble, identities[0].PublicKey)
+
+			// The clock may be ahead of the heads, it must be kept so new
+			// entries don't reuse older times
+			snapshot.Clock.Time = 10
+
+			log2, err := log.NewFromSnapshot(ipfs, identities[0], snapshot, &log.NewLogOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.ID, ShouldEqual, "A")
+			c.So(log2.Clock.Time, ShouldEqual, 10)
+			c.So(log2.Heads().Len(), ShouldEqual, 1)
+			c.So(log2.Values().Len(), ShouldEqual, 3)
+
+			e, err := log2.Append([]byte("hello3"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e.GetClock().Time, ShouldEqual, 11)
+		})
+
+		c.Convey("persisted snapshots", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			store := ds.NewMapDatastore()
+			key := ds.NewKey("/logs/A")
+
+			err = log.SaveSnapshot(store, key, log1.ToSnapshot())
+			c.So(err, ShouldBeNil)
+
+			_, err = log.LoadSnapshot(store, ds.NewKey("/logs/B"), identities[0].Provider)
+			c.So(errors.Cause(err), ShouldEqual, ds.ErrNotFound)
+
+			snapshot, err := log.LoadSnapshot(store, key, identities[0].Provider)
+			c.So(err, ShouldBeNil)
+			c.So(snapshot.ID, ShouldEqual, "A")
+			c.So(snapshot.Clock.Time, ShouldEqual, 3)
+			c.So(snapshot.Heads, ShouldResemble, []cid.Cid{log1.Heads().At(0).GetHash()})
+			c.So(len(snapshot.Values), ShouldEqual, 3)
+
+			// Entries are restored from the datastore only
+			log2, err := log.NewFromSnapshot(io.NewMemoryServices(), identities[0], snapshot, &log.NewLogOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Len(), ShouldEqual, 3)
+
+			for i, e := range log2.Values().Slice() {
+				c.So(e.GetHash().String(), ShouldEqual, log1.Values().At(uint(i)).GetHash().String())
+				c.So(string(e.GetPayload()), ShouldEqual, fmt.Sprintf("hello%d", i))
+				c.So(e.Verify(identities[0].Provider), ShouldBeNil)
+			}
+		})
+
+		c.Convey("compressed snapshots", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 20; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			raw, err := log1.ToSnapshotBuffer(nil)
+			c.So(err, ShouldBeNil)
+
+			compressed, err := log1.ToSnapshotBuffer(&log.SnapshotOptions{Compression: entry.CompressionGzip})
+			c.So(err, ShouldBeNil)
+			c.So(len(compressed), ShouldBeLessThan, len(raw))
+
+			for _, buf := range [][]byte{raw, compressed} {
+				snapshot, err := log.ReadSnapshot(bytes.NewReader(buf), identities[0].Provider)
+				c.So(err, ShouldBeNil)
+				c.So(snapshot.ID, ShouldEqual, "A")
+				c.So(snapshot.Clock.Time, ShouldEqual, 20)
+				c.So(len(snapshot.Values), ShouldEqual, 20)
+				c.So(snapshot.Values[19].GetHash().String(), ShouldEqual, log1.Values().At(19).GetHash().String())
+			}
+
+			_, err = log1.ToSnapshotBuffer(&log.SnapshotOptions{Compression: "unknown"})
+			c.So(err, ShouldNotBeNil)
+
+			// Chunked in the datastore
+			store := ds.NewMapDatastore()
+			key := ds.NewKey("/logs/A")
+
+			err = log.SaveSnapshotWithOptions(store, key, log1.ToSnapshot(), &log.SnapshotOptions{Compression: entry.CompressionGzip, ChunkSize: 256})
+			c.So(err, ShouldBeNil)
+
+			chunk, err := store.Get(key.ChildString("1"))
+			c.So(err, ShouldBeNil)
+			c.So(len(chunk), ShouldEqual, 256)
+
+			snapshot, err := log.LoadSnapshot(store, key, identities[0].Provider)
+			c.So(err, ShouldBeNil)
+			c.So(snapshot.Clock.Time, ShouldEqual, 20)
+			c.So(len(snapshot.Values), ShouldEqual, 20)
+
+			log2, err := log.NewFromSnapshot(ipfs, identities[0], snapshot, &log.NewLogOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Keys(), ShouldResemble, log1.Values().Keys())
+
+			// Deltas can be based on chunked snapshots
+			_, err = log1.Append([]byte("hello20"), 1)
+			c.So(err, ShouldBeNil)
+
+			err = log.SaveDeltaSnapshot(store, ds.NewKey("/logs/A-1"), key, log1.ToSnapshot())
+			c.So(err, ShouldBeNil)
+
+			snapshot, err = log.LoadSnapshot(store, ds.NewKey("/logs/A-1"), identities[0].Provider)
+			c.So(err, ShouldBeNil)
+			c.So(len(snapshot.Values), ShouldEqual, 21)
+		})
+
+		c.Convey("delta snapshots", FailureHalts, func(c C) {
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			store := ds.NewMapDatastore()
+			keys := []ds.Key{ds.NewKey("/logs/A/0"), ds.NewKey("/logs/A/1"), ds.NewKey("/logs/A/2")}
+
+			for i := 0; i < 2; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(log.SaveSnapshot(store, keys[0], log1.ToSnapshot()), ShouldBeNil)
+
+			for i := 1; i < 3; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i+1)), 1)
+				c.So(err, ShouldBeNil)
+
+				c.So(log.SaveDeltaSnapshot(store, keys[i], keys[i-1], log1.ToSnapshot()), ShouldBeNil)
+			}
+
+			// Deltas only hold the new entries
+			full, err := store.Get(keys[0])
+			c.So(err, ShouldBeNil)
+			delta, err := store.Get(keys[2])
+			c.So(err, ShouldBeNil)
+			c.So(len(delta), ShouldBeLessThan, len(full))
+
+			snapshot, err := log.LoadSnapshot(store, keys[2], identities[0].Provider)
+			c.So(err, ShouldBeNil)
+			c.So(snapshot.Clock.Time, ShouldEqual, 4)
+			c.So(snapshot.Heads, ShouldResemble, []cid.Cid{log1.Heads().At(0).GetHash()})
+			c.So(len(snapshot.Values), ShouldEqual, 4)
+
+			log2, err := log.NewFromSnapshot(ipfs, identities[0], snapshot, &log.NewLogOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(log2.Values().Keys(), ShouldResemble, log1.Values().Keys())
+
+			// Loading an intermediate delta stops at its own heads
+			snapshot, err = log.LoadSnapshot(store, keys[1], identities[0].Provider)
+			c.So(err, ShouldBeNil)
+			c.So(len(snapshot.Values), ShouldEqual, 3)
+
+			c.So(log.SaveDeltaSnapshot(store, keys[0], keys[2], log1.ToSnapshot()), ShouldBeNil)
+			_, err = log.LoadSnapshot(store, keys[2], identities[0].Provider)
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("timestamps", FailureHalts, func(c C) {
+			wall := time.Unix(1000, 0)
+			log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Timestamps: true, Now: func() time.Time { return wall }})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				e, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+				c.So(e.GetTimestamp(), ShouldResemble, wall)
+				c.So(e.Verify(identities[0].Provider), ShouldBeNil)
+
+				wall = wall.Add(time.Minute)
+			}
+
+			iterate := func(options log.IteratorOptions) []string {
+				output := make(chan iface.IPFSLogEntry, 10)
+				c.So(log1.Iterator(options, output), ShouldBeNil)
+				close(output)
+
+				var payloads []string
+				for e := range output {
+					payloads = append(payloads, string(e.GetPayload()))
+				}
+
+				return payloads
+			}
+
+			start := time.Unix(1000, 0)
+			c.So(iterate(log.IteratorOptions{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}), ShouldResemble, []string{"hello2", "hello1"})
+			c.So(iterate(log.IteratorOptions{Since: start.Add(3 * time.Minute)}), ShouldResemble, []string{"hello4", "hello3"})
+
+			amount := 1
+			c.So(iterate(log.IteratorOptions{Until: start.Add(2 * time.Minute), Amount: &amount}), ShouldResemble, []string{"hello1"})
+
+			amount = 2
+			c.So(iterate(log.IteratorOptions{GT: log1.Values().At(0), Since: start.Add(2 * time.Minute), Amount: &amount}), ShouldResemble, []string{"hello3", "hello2"})
+
+			untimed, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+			e, err := untimed.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e.GetTimestamp().IsZero(), ShouldBeTrue)
+		})
 	})
 }
@@ -0,0 +1,105 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// syntheticEntries returns size unsigned entries written by writers
+// concurrent writers, each entry pointing to the previous entry of every
+// writer, so traversals meet both chains and merges
+func syntheticEntries(size int, writers int) []iface.IPFSLogEntry {
+	entries := make([]iface.IPFSLogEntry, 0, size)
+	last := make([]cid.Cid, writers)
+
+	for i := 0; i < size; i++ {
+		w := i % writers
+
+		sum, err := mh.Sum([]byte(fmt.Sprintf("entry %d", i)), mh.SHA2_256, -1)
+		if err != nil {
+			panic(err)
+		}
+
+		next := []cid.Cid{}
+		for _, c := range last {
+			if c.Defined() {
+				next = append(next, c)
+			}
+		}
+
+		e := &entry.Entry{
+			LogID:   "A",
+			Payload: []byte("x"),
+			Next:    next,
+			Clock:   lamportclock.New([]byte{byte(w)}, i/writers+1),
+			Hash:    cid.NewCidV1(cid.DagCBOR, sum),
+		}
+
+		last[w] = e.Hash
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+func benchmarkLog(b *testing.B, size int) *log.Log {
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: newTestKeystore(),
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	l, err := log.NewLog(io.NewMemoryServices(), identity, &log.NewLogOptions{
+		ID:         "A",
+		Entries:    entry.NewOrderedMapFromEntries(syntheticEntries(size, 4)),
+		OwnEntries: true,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return l
+}
+
+func BenchmarkValues(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			l := benchmarkLog(b, size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if values := l.Values(); values.Len() != size {
+					b.Fatalf("expected %d values, got %d", size, values.Len())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTraverseFirstPage(b *testing.B) {
+	for _, size := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			l := benchmarkLog(b, size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				entries, err := l.Traverse(l.Heads(), 100, "")
+				if err != nil || len(entries) != 100 {
+					b.Fatalf("expected 100 entries, got %d: %v", len(entries), err)
+				}
+			}
+		})
+	}
+}
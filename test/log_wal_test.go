@@ -0,0 +1,137 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// crashingDatastore never deletes its records, as if the process stopped
+// right after writing them
+type crashingDatastore struct {
+	ds.Datastore
+}
+
+func (d *crashingDatastore) Delete(ds.Key) error {
+	return nil
+}
+
+// failingStamper fails to timestamp every entry
+type failingStamper struct{}
+
+func (failingStamper) Stamp(context.Context, iface.IPFSLogEntry) error {
+	return errors.New("no calendar")
+}
+
+func countRecords(c C, d ds.Datastore) int {
+	results, err := d.Query(query.Query{KeysOnly: true})
+	c.So(err, ShouldBeNil)
+
+	all, err := results.Rest()
+	c.So(err, ShouldBeNil)
+
+	return len(all)
+}
+
+func TestLogWAL(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       fmt.Sprintf("userA"),
+		Type:     "orbitdb",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Log - WAL", t, FailureHalts, func(c C) {
+		c.Convey("recovers the entries whose write didn't complete", FailureHalts, func(c C) {
+			wal := dssync.MutexWrap(ds.NewMapDatastore())
+
+			log1, err := log.NewLog(io.NewMemoryServices(), identity, &log.NewLogOptions{
+				ID:  "A",
+				WAL: &log.WAL{Datastore: &crashingDatastore{Datastore: wal}},
+			})
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Append([]byte("hello1"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.AppendBatch([][]byte{[]byte("hello2"), []byte("hello3")}, nil)
+			c.So(err, ShouldBeNil)
+			c.So(countRecords(c, wal), ShouldEqual, 2)
+
+			ipfs := io.NewMemoryServices()
+			log2, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", WAL: &log.WAL{Datastore: wal}})
+			c.So(err, ShouldBeNil)
+			c.So(entriesAsStrings(log2.Values()), ShouldResemble, []string{"hello1", "hello2", "hello3"})
+			c.So(countRecords(c, wal), ShouldEqual, 0)
+
+			for _, e := range log2.Values().Slice() {
+				_, err := entry.FromMultihash(ipfs, e.GetHash(), identity.Provider)
+				c.So(err, ShouldBeNil)
+			}
+
+			recovered, err := log2.Recover()
+			c.So(err, ShouldBeNil)
+			c.So(recovered, ShouldBeEmpty)
+		})
+
+		c.Convey("acknowledges async appends before writing them", FailureHalts, func(c C) {
+			wal := dssync.MutexWrap(ds.NewMapDatastore())
+			ipfs := io.NewMemoryServices()
+
+			log1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A", WAL: &log.WAL{Datastore: wal, Async: true}})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := log1.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(log1.Values().Len(), ShouldEqual, 5)
+			c.So(log1.Flush(), ShouldBeNil)
+			c.So(countRecords(c, wal), ShouldEqual, 0)
+
+			for _, e := range log1.Values().Slice() {
+				_, err := entry.FromMultihash(ipfs, e.GetHash(), identity.Provider)
+				c.So(err, ShouldBeNil)
+			}
+		})
+
+		c.Convey("drops the record of a failed append", FailureHalts, func(c C) {
+			wal := dssync.MutexWrap(ds.NewMapDatastore())
+
+			log1, err := log.NewLog(io.NewMemoryServices(), identity, &log.NewLogOptions{ID: "A", WAL: &log.WAL{Datastore: wal, Async: true}, Stamper: failingStamper{}})
+			c.So(err, ShouldBeNil)
+
+			_, err = log1.Append([]byte("hello1"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(log1.Values().Len(), ShouldEqual, 0)
+			c.So(countRecords(c, wal), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,172 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/manager"
+	"berty.tech/go-ipfs-log/replicator"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestManager(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Logs manager", t, FailureHalts, func(c C) {
+		ac := accesscontroller.NewIPFS([]string{identities[0].ID, identities[1].ID})
+		_, err := ac.Save(ipfs)
+		c.So(err, ShouldBeNil)
+
+		c.Convey("opens and caches logs by address", FailureHalts, func(c C) {
+			m, err := manager.New(ipfs, identities[0], &manager.Options{
+				LogOptions: &log.NewLogOptions{Timestamps: true},
+			})
+			c.So(err, ShouldBeNil)
+
+			notes, err := m.Create("notes", ac)
+			c.So(err, ShouldBeNil)
+
+			same, err := m.Open(notes.ID, ac)
+			c.So(err, ShouldBeNil)
+			c.So(same, ShouldEqual, notes)
+
+			todo, err := m.Create("todo", nil)
+			c.So(err, ShouldBeNil)
+			c.So(todo, ShouldNotEqual, notes)
+			c.So(m.Addresses(), ShouldHaveLength, 2)
+
+			// The address doesn't match the access controller
+			_, err = m.Open(todo.ID, ac)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidAddress)
+
+			c.So(m.Do(notes.ID, func(l *log.Log) error {
+				e, err := l.Append([]byte("hello"), 1)
+				c.So(err, ShouldBeNil)
+				c.So(e.GetTimestamp().IsZero(), ShouldBeFalse)
+				return nil
+			}), ShouldBeNil)
+
+			l, ok := m.Get(notes.ID)
+			c.So(ok, ShouldBeTrue)
+			c.So(l.Values().Len(), ShouldEqual, 1)
+			c.So(m.VerificationCache(), ShouldEqual, m.VerificationCache())
+
+			c.So(m.CloseLog(notes.ID), ShouldBeNil)
+			c.So(errors.Cause(m.CloseLog(notes.ID)), ShouldEqual, errmsg.LogNotOpen)
+
+			_, ok = m.Get(notes.ID)
+			c.So(ok, ShouldBeFalse)
+
+			reopened, err := m.Open(notes.ID, ac)
+			c.So(err, ShouldBeNil)
+			c.So(reopened, ShouldNotEqual, notes)
+
+			c.So(m.Close(), ShouldBeNil)
+			c.So(m.Addresses(), ShouldHaveLength, 0)
+
+			_, err = m.Create("notes", ac)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.LogsClosed)
+		})
+
+		c.Convey("reopens logs from their heads", FailureHalts, func(c C) {
+			store := dssync.MutexWrap(ds.NewMapDatastore())
+
+			m, err := manager.New(ipfs, identities[0], &manager.Options{HeadsStore: store})
+			c.So(err, ShouldBeNil)
+
+			notes, err := m.Create("notes", ac)
+			c.So(err, ShouldBeNil)
+
+			c.So(m.Do(notes.ID, func(l *log.Log) error {
+				_, err := l.Append([]byte("hello"), 1)
+				return err
+			}), ShouldBeNil)
+			c.So(m.Close(), ShouldBeNil)
+
+			m, err = manager.New(ipfs, identities[0], &manager.Options{HeadsStore: store})
+			c.So(err, ShouldBeNil)
+			defer m.Close()
+
+			reopened, err := m.Open(notes.ID, ac)
+			c.So(err, ShouldBeNil)
+			c.So(entriesAsStrings(reopened.Values()), ShouldResemble, []string{"hello"})
+
+			todo, err := m.Create("todo", ac)
+			c.So(err, ShouldBeNil)
+			c.So(todo.Values().Len(), ShouldEqual, 0)
+		})
+
+		c.Convey("replicates the open logs", FailureHalts, func(c C) {
+			logA, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{Name: "notes", AccessController: ac})
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			m, err := manager.New(ipfs, identities[0], &manager.Options{
+				Replication: &replicator.Options{
+					Sources: []replicator.HeadSource{
+						replicator.HeadSourceFunc(func(ctx context.Context, id string) ([]*log.JSONLog, error) {
+							if id != logA.ID {
+								return nil, nil
+							}
+
+							return []*log.JSONLog{logA.ToJSON()}, nil
+						}),
+					},
+					Interval: 10 * time.Millisecond,
+				},
+			})
+			c.So(err, ShouldBeNil)
+			defer m.Close()
+
+			_, err = m.Create("todo", ac)
+			c.So(err, ShouldBeNil)
+
+			notes, err := m.Create("notes", ac)
+			c.So(err, ShouldBeNil)
+			c.So(notes.ID, ShouldEqual, logA.ID)
+
+			replicated := 0
+			for replicated == 0 && ctx.Err() == nil {
+				c.So(m.Do(notes.ID, func(l *log.Log) error {
+					replicated = l.Values().Len()
+					return nil
+				}), ShouldBeNil)
+				time.Sleep(5 * time.Millisecond)
+			}
+			c.So(replicated, ShouldEqual, 1)
+
+			c.So(m.Close(), ShouldBeNil)
+			c.So(errors.Cause(m.Do(notes.ID, func(*log.Log) error { return nil })), ShouldEqual, errmsg.LogNotOpen)
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/sorting"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestManifest(t *testing.T) {
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Log manifest", t, FailureHalts, func(c C) {
+		c.Convey("configures the logs loaded from IPFS", FailureHalts, func(c C) {
+			ac := accesscontroller.NewIPFS([]string{identities[0].ID, identities[1].ID})
+			_, err := ac.Save(ipfs)
+			c.So(err, ShouldBeNil)
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{
+				Name:             "notes",
+				AccessController: ac,
+				SortName:         sorting.FirstWriteWinsName,
+			})
+			c.So(err, ShouldBeNil)
+
+			// Concurrent entries are ordered by the sort function
+			for i := 0; i < 3; i++ {
+				writer, err := log.NewLog(ipfs, identities[i%2], &log.NewLogOptions{ID: logA.ID, AccessController: ac})
+				c.So(err, ShouldBeNil)
+
+				_, err = writer.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+
+				_, err = logA.Join(writer, -1)
+				c.So(err, ShouldBeNil)
+			}
+
+			manifest, err := logA.WriteManifest()
+			c.So(err, ShouldBeNil)
+
+			again, err := logA.WriteManifest()
+			c.So(err, ShouldBeNil)
+			c.So(again.String(), ShouldEqual, manifest.String())
+
+			m, err := log.ReadManifest(ipfs, manifest)
+			c.So(err, ShouldBeNil)
+			c.So(m, ShouldResemble, &log.Manifest{
+				Version:          log.ManifestVersion,
+				Name:             "notes",
+				AccessController: io.CIDString(ac.Address()),
+				SortFn:           sorting.FirstWriteWinsName,
+			})
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logB.ID, ShouldEqual, logA.ID)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+			c.So(logB.ToJSON().Manifest, ShouldEqual, io.CIDString(manifest))
+
+			loaded, ok := logB.AccessController.(accesscontroller.Addressable)
+			c.So(ok, ShouldBeTrue)
+			c.So(loaded.Address().String(), ShouldEqual, ac.Address().String())
+
+			// The given options must match the manifest
+			other := accesscontroller.NewIPFS([]string{identities[1].ID})
+			_, err = other.Save(ipfs)
+			c.So(err, ShouldBeNil)
+
+			for _, options := range []*log.NewLogOptions{
+				{SortFn: sorting.LastWriteWins},
+				{SortName: sorting.LastWriteWinsName},
+				{Tiebreaker: sorting.ClockIDTiebreaker},
+				{AccessController: other},
+				{AccessController: &accesscontroller.Default{}},
+			} {
+				_, err = log.NewFromMultihash(ipfs, identities[1], hash, options, &log.FetchOptions{})
+				c.So(errors.Cause(err), ShouldEqual, errmsg.ManifestConflict)
+			}
+
+			logC, err := log.NewFromMultihash(ipfs, identities[1], hash, &log.NewLogOptions{
+				SortFn:           sorting.FirstWriteWins,
+				AccessController: ac,
+			}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logC.Values().Keys(), ShouldResemble, logB.Values().Keys())
+
+			_, err = logB.Append([]byte("hello3"), 1)
+			c.So(err, ShouldBeNil)
+
+			written, err := logB.WriteManifest()
+			c.So(err, ShouldBeNil)
+			c.So(written.String(), ShouldEqual, manifest.String())
+		})
+
+		c.Convey("rejects unknown sort functions and versions", FailureHalts, func(c C) {
+			// The registry is global, the name is unique to the run
+			name := fmt.Sprintf("custom-%d", time.Now().UnixNano())
+
+			_, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X", SortName: name})
+			c.So(errors.Cause(err), ShouldEqual, errmsg.UnknownSortFunction)
+
+			sorting.Register(name, sorting.SortByEntryHash)
+			fn, ok := sorting.Lookup(name)
+			c.So(ok, ShouldBeTrue)
+			c.So(fn, ShouldNotBeNil)
+
+			_, err = log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X", SortName: name})
+			c.So(err, ShouldBeNil)
+
+			hash, err := io.WriteCBOR(ipfs, &log.Manifest{Version: log.ManifestVersion + 1, Name: "notes"})
+			c.So(err, ShouldBeNil)
+
+			_, err = log.ReadManifest(ipfs, hash)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,203 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/anchor/ots"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryCalendar aggregates the digests into blocks once mined
+type memoryCalendar struct {
+	lock   sync.Mutex
+	url    string
+	mined  bool
+	roots  map[uint64][]byte
+	height uint64
+}
+
+func (m *memoryCalendar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/digest":
+		digest, _ := ioutil.ReadAll(r.Body)
+		nonce := []byte("0123456789abcdef")
+
+		commitment := sha256.Sum256(append(append([]byte{}, digest...), nonce...))
+		t := &ots.Timestamp{Msg: commitment[:], Attestations: []ots.Attestation{ots.PendingAttestation(m.url)}}
+		t = &ots.Timestamp{Msg: append(append([]byte{}, digest...), nonce...), Branches: []*ots.Branch{{Op: ots.Op{Tag: ots.OpSHA256}, Timestamp: t}}}
+		t = &ots.Timestamp{Msg: digest, Branches: []*ots.Branch{{Op: ots.Op{Tag: ots.OpAppend, Arg: nonce}, Timestamp: t}}}
+
+		_, _ = w.Write(t.Marshal())
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/timestamp/"):
+		commitment, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/timestamp/"))
+		if err != nil || !m.mined {
+			http.NotFound(w, r)
+			return
+		}
+
+		block := []byte("block")
+		root := sha256.Sum256(append(append([]byte{}, block...), commitment...))
+		m.roots[m.height] = root[:]
+
+		t := &ots.Timestamp{Msg: root[:], Attestations: []ots.Attestation{ots.BitcoinAttestation(m.height)}}
+		t = &ots.Timestamp{Msg: append(append([]byte{}, block...), commitment...), Branches: []*ots.Branch{{Op: ots.Op{Tag: ots.OpSHA256}, Timestamp: t}}}
+		t = &ots.Timestamp{Msg: commitment, Branches: []*ots.Branch{{Op: ots.Op{Tag: ots.OpPrepend, Arg: block}, Timestamp: t}}}
+
+		_, _ = w.Write(t.Marshal())
+
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}
+}
+
+func (m *memoryCalendar) MerkleRoot(_ context.Context, height uint64) ([]byte, time.Time, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	root, ok := m.roots[height]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("unknown block %d", height)
+	}
+
+	return root, time.Unix(int64(height)*600, 0), nil
+}
+
+func TestOpenTimestamps(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("OpenTimestamps", t, FailureHalts, func(c C) {
+		calendar := &memoryCalendar{height: 100, roots: map[uint64][]byte{}}
+		server := httptest.NewServer(calendar)
+		defer server.Close()
+		calendar.url = server.URL
+
+		c.Convey("proves appended entries existed before a block", FailureHalts, func(c C) {
+			calendars := ots.NewCalendars(server.URL)
+			stamper := ots.NewStamper(ipfs, calendars)
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", Stamper: stamper})
+			c.So(err, ShouldBeNil)
+
+			e, err := l.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			proof, ok := stamper.Proof(e.GetHash())
+			c.So(ok, ShouldBeTrue)
+
+			p, ts, err := ots.ReadProof(ctx, ipfs, proof)
+			c.So(err, ShouldBeNil)
+			c.So(p.Entry.Equals(e.GetHash()), ShouldBeTrue)
+			c.So(len(ts.Attested()), ShouldEqual, 1)
+
+			uri, ok := ts.Attested()[0].Attestation.Calendar()
+			c.So(ok, ShouldBeTrue)
+			c.So(uri, ShouldEqual, server.URL)
+
+			// Pending until the calendar commits to a block
+			_, _, err = ots.VerifyEntry(ctx, ipfs, proof, calendar)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.TimestampNotVerified)
+
+			upgraded, err := ots.UpgradeProof(ctx, ipfs, proof, calendars)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.TimestampNotVerified)
+			c.So(upgraded.Equals(proof), ShouldBeTrue)
+
+			calendar.lock.Lock()
+			calendar.mined = true
+			calendar.lock.Unlock()
+
+			// Calendars not listed aren't contacted
+			upgraded, err = ots.UpgradeProof(ctx, ipfs, proof, ots.NewCalendars("http://127.0.0.1:1"))
+			c.So(err, ShouldBeNil)
+			c.So(upgraded.Equals(proof), ShouldBeTrue)
+
+			upgraded, err = ots.UpgradeProof(ctx, ipfs, proof, calendars)
+			c.So(err, ShouldBeNil)
+			c.So(upgraded.Equals(proof), ShouldBeFalse)
+
+			stamped, before, err := ots.VerifyEntry(ctx, ipfs, upgraded, calendar)
+			c.So(err, ShouldBeNil)
+			c.So(stamped.Equals(e.GetHash()), ShouldBeTrue)
+			c.So(before.Equal(time.Unix(100*600, 0)), ShouldBeTrue)
+
+			// The timestamp doesn't prove another entry
+			other, err := l.Append([]byte("world"), 1)
+			c.So(err, ShouldBeNil)
+
+			_, ts, err = ots.ReadProof(ctx, ipfs, upgraded)
+			c.So(err, ShouldBeNil)
+
+			forged, err := ots.WriteProof(ipfs, &ots.Proof{Entry: other.GetHash(), Timestamp: ts.MarshalFile()})
+			c.So(err, ShouldBeNil)
+
+			_, _, err = ots.VerifyEntry(ctx, ipfs, forged, calendar)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.TimestampNotVerified)
+		})
+
+		c.Convey("fails the append when no calendar answers", FailureHalts, func(c C) {
+			down := httptest.NewServer(http.NotFoundHandler())
+			down.Close()
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{
+				ID:      "X",
+				Stamper: ots.NewStamper(ipfs, ots.NewCalendars(down.URL)),
+			})
+			c.So(err, ShouldBeNil)
+
+			_, err = l.Append([]byte("hello"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(l.Values().Len(), ShouldEqual, 0)
+		})
+
+		c.Convey("serializes timestamp files", FailureHalts, func(c C) {
+			digest := sha256.Sum256([]byte("hello"))
+			ts, err := (&ots.Calendar{URL: server.URL}).Submit(ctx, digest[:])
+			c.So(err, ShouldBeNil)
+
+			file := ts.MarshalFile()
+			c.So(string(file[1:15]), ShouldEqual, "OpenTimestamps")
+
+			parsed, err := ots.UnmarshalFile(file)
+			c.So(err, ShouldBeNil)
+			c.So(parsed.Marshal(), ShouldResemble, ts.Marshal())
+			c.So(parsed.Attested()[0].Msg, ShouldResemble, ts.Attested()[0].Msg)
+
+			for _, data := range [][]byte{[]byte("hello"), file[:len(file)-1], append(file, 0)} {
+				_, err := ots.UnmarshalFile(data)
+				c.So(errors.Cause(err), ShouldEqual, errmsg.InvalidTimestamp)
+			}
+		})
+	})
+}
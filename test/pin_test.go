@@ -0,0 +1,90 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	cid "github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// noPinnerServices are services of a node that can't pin
+type noPinnerServices struct {
+	io.IpfsServices
+}
+
+func (s *noPinnerServices) Pinner() io.Pinner {
+	return nil
+}
+
+func TestPin(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Pin", t, FailureHalts, func(c C) {
+		c.Convey("pins the appended entries when asked", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", PayloadThreshold: 16})
+			c.So(err, ShouldBeNil)
+
+			unpinned, err := l.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			pinned, err := l.AppendWithOptions(bytes.Repeat([]byte("a"), 64), &log.AppendOptions{PointerCount: 1, Pin: true})
+			c.So(err, ShouldBeNil)
+			c.So(pinned.GetPayloadRef().Defined(), ShouldBeTrue)
+
+			ok, err := ipfs.Pinner().IsPinned(context.Background(), unpinned.GetHash())
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeFalse)
+
+			for _, h := range []cid.Cid{pinned.GetHash(), pinned.GetPayloadRef()} {
+				ok, err := ipfs.Pinner().IsPinned(context.Background(), h)
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+			}
+		})
+
+		c.Convey("pins every entry of a pinning log", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", Pin: true})
+			c.So(err, ShouldBeNil)
+
+			for _, payload := range []string{"hello1", "hello2"} {
+				e, err := l.Append([]byte(payload), 1)
+				c.So(err, ShouldBeNil)
+
+				ok, err := ipfs.Pinner().IsPinned(context.Background(), e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+			}
+
+			// Services without pinner can't pin
+			noPinner := &noPinnerServices{IpfsServices: io.NewMemoryServices()}
+
+			l, err = log.NewLog(noPinner, identity, &log.NewLogOptions{ID: "X", Pin: true})
+			c.So(err, ShouldBeNil)
+
+			_, err = l.Append([]byte("hello"), 1)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.PinnerNotDefined)
+			c.So(l.Values().Len(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,189 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrune(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	payload := func(i int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%d", i)), 64)
+	}
+
+	Convey("Prune", t, FailureHalts, func(c C) {
+		c.Convey("releases the blocks of the removed entries", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{
+				ID:               "X",
+				PayloadThreshold: 16,
+				Pin:              true,
+				Release:          &log.ReleaseOptions{Unpin: true, Delete: true},
+			})
+			c.So(err, ShouldBeNil)
+
+			entries := []iface.IPFSLogEntry{}
+			for _, i := range []int{0, 1, 2, 3, 0} {
+				e, err := l.Append(payload(i), 1)
+				c.So(err, ShouldBeNil)
+				entries = append(entries, e)
+			}
+
+			// The first and last entries share their payload
+			c.So(entries[0].GetPayloadRef(), ShouldResemble, entries[4].GetPayloadRef())
+
+			removed, err := l.Prune(2)
+			c.So(err, ShouldBeNil)
+			c.So(entryHashes(removed), ShouldResemble, entryHashes(entries[:3]))
+			c.So(l.Values().Len(), ShouldEqual, 2)
+			c.So(entryHashes(l.GetHeads()), ShouldResemble, entryHashes(entries[4:]))
+
+			for i, e := range entries {
+				ok, err := ipfs.BlockStore().Has(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldEqual, i >= 3)
+
+				pinned, err := ipfs.Pinner().IsPinned(context.Background(), e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(pinned, ShouldEqual, i >= 3)
+			}
+
+			// Payloads are unpinned but not deleted, other logs of the
+			// blockstore may reference them
+			for i, e := range entries[:4] {
+				ok, err := ipfs.BlockStore().Has(e.GetPayloadRef())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+
+				pinned, err := ipfs.Pinner().IsPinned(context.Background(), e.GetPayloadRef())
+				c.So(err, ShouldBeNil)
+				c.So(pinned, ShouldEqual, i == 0 || i == 3)
+			}
+
+			// Blocks aren't deleted without pinner
+			_, err = log.NewLog(&noPinnerServices{IpfsServices: ipfs}, identity, &log.NewLogOptions{
+				ID:      "X",
+				Release: &log.ReleaseOptions{Delete: true},
+			})
+			c.So(errors.Is(err, errmsg.PinnerNotDefined), ShouldBeTrue)
+
+			removed, err = l.Prune(5)
+			c.So(err, ShouldBeNil)
+			c.So(len(removed), ShouldEqual, 0)
+		})
+
+		c.Convey("keeps the retained entries causally closed", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			// Orders the entries by payload, regardless of their causality
+			byPayload := func(a, b iface.IPFSLogEntry) (int, error) {
+				return bytes.Compare(a.GetPayload(), b.GetPayload()), nil
+			}
+
+			logA, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", SortFn: byPayload})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", SortFn: byPayload})
+			c.So(err, ShouldBeNil)
+
+			root, err := logA.Append(payload(5), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(logA, -1)
+			c.So(err, ShouldBeNil)
+
+			forkB, err := logB.Append(payload(9), 1)
+			c.So(err, ShouldBeNil)
+
+			forkA, err := logA.Append(payload(0), 1)
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Join(logB, -1)
+			c.So(err, ShouldBeNil)
+			c.So(entryHashes(logA.Values().Slice()), ShouldResemble, entryHashes([]iface.IPFSLogEntry{forkA, root, forkB}))
+
+			// The root is among the newest two but one of its children isn't
+			removed, err := logA.Prune(2)
+			c.So(err, ShouldBeNil)
+			c.So(entryHashes(removed), ShouldResemble, entryHashes([]iface.IPFSLogEntry{forkA, root}))
+			c.So(entryHashes(logA.Values().Slice()), ShouldResemble, entryHashes([]iface.IPFSLogEntry{forkB}))
+			c.So(entryHashes(logA.GetHeads()), ShouldResemble, entryHashes([]iface.IPFSLogEntry{forkB}))
+
+			report, err := logA.Repair()
+			c.So(err, ShouldBeNil)
+			c.So(report.OK(), ShouldBeTrue)
+		})
+
+		c.Convey("keeps the blocks by default", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X", Pin: true})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append(payload(i), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			removed, err := logA.Prune(1)
+			c.So(err, ShouldBeNil)
+			c.So(len(removed), ShouldEqual, 2)
+
+			for _, e := range removed {
+				ok, err := ipfs.BlockStore().Has(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldBeTrue)
+			}
+		})
+
+		c.Convey("releases the entries removed by a join", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append(payload(i), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			logB, err := log.NewLog(ipfs, identity, &log.NewLogOptions{
+				ID:      "X",
+				Release: &log.ReleaseOptions{Delete: true},
+			})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(logA, 1)
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+
+			for i, e := range logA.Values().Slice() {
+				ok, err := ipfs.BlockStore().Has(e.GetHash())
+				c.So(err, ShouldBeNil)
+				c.So(ok, ShouldEqual, i == 2)
+			}
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// memoryPubSub delivers the messages published by its peers to every
+// subscription of the topic, including the publisher's
+type memoryPubSub struct {
+	lock sync.Mutex
+	subs map[string][]*memorySubscription
+	seq  int
+}
+
+type memoryPubSubPeer struct {
+	network *memoryPubSub
+	id      peer.ID
+}
+
+type memorySubscription struct {
+	network  *memoryPubSub
+	topic    string
+	messages chan coreiface.PubSubMessage
+	once     sync.Once
+}
+
+type memoryMessage struct {
+	from  peer.ID
+	data  []byte
+	seq   []byte
+	topic string
+}
+
+func newMemoryPubSub() *memoryPubSub {
+	return &memoryPubSub{subs: map[string][]*memorySubscription{}}
+}
+
+func (m *memoryPubSub) Peer(id string) coreiface.PubSubAPI {
+	return &memoryPubSubPeer{network: m, id: peer.ID(id)}
+}
+
+func (p *memoryPubSubPeer) Ls(ctx context.Context) ([]string, error) {
+	p.network.lock.Lock()
+	defer p.network.lock.Unlock()
+
+	topics := []string{}
+	for t := range p.network.subs {
+		topics = append(topics, t)
+	}
+
+	return topics, nil
+}
+
+func (p *memoryPubSubPeer) Peers(ctx context.Context, opts ...options.PubSubPeersOption) ([]peer.ID, error) {
+	return nil, nil
+}
+
+func (p *memoryPubSubPeer) Publish(ctx context.Context, topic string, data []byte) error {
+	p.network.lock.Lock()
+	defer p.network.lock.Unlock()
+
+	p.network.seq++
+	msg := &memoryMessage{from: p.id, data: data, seq: []byte(fmt.Sprint(p.network.seq)), topic: topic}
+
+	for _, s := range p.network.subs[topic] {
+		select {
+		case s.messages <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (p *memoryPubSubPeer) Subscribe(ctx context.Context, topic string, opts ...options.PubSubSubscribeOption) (coreiface.PubSubSubscription, error) {
+	p.network.lock.Lock()
+	defer p.network.lock.Unlock()
+
+	s := &memorySubscription{network: p.network, topic: topic, messages: make(chan coreiface.PubSubMessage, 64)}
+	p.network.subs[topic] = append(p.network.subs[topic], s)
+
+	return s, nil
+}
+
+func (s *memorySubscription) Next(ctx context.Context) (coreiface.PubSubMessage, error) {
+	select {
+	case msg, ok := <-s.messages:
+		if !ok {
+			return nil, fmt.Errorf("subscription closed")
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() {
+		s.network.lock.Lock()
+		defer s.network.lock.Unlock()
+
+		subs := s.network.subs[s.topic]
+		for i, sub := range subs {
+			if sub == s {
+				s.network.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+
+		close(s.messages)
+	})
+
+	return nil
+}
+
+func (m *memoryMessage) From() peer.ID    { return m.from }
+func (m *memoryMessage) Data() []byte     { return m.data }
+func (m *memoryMessage) Seq() []byte      { return m.seq }
+func (m *memoryMessage) Topics() []string { return []string{m.topic} }
@@ -0,0 +1,141 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/pubsub"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type announcement struct {
+	from  peer.ID
+	heads *log.JSONLog
+}
+
+func TestPubSub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	receive := func(announcements chan announcement) announcement {
+		select {
+		case a := <-announcements:
+			return a
+		case <-ctx.Done():
+			return announcement{}
+		}
+	}
+
+	Convey("PubSub", t, FailureHalts, func(c C) {
+		c.Convey("announces heads on append and join", FailureHalts, func(c C) {
+			network := newMemoryPubSub()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			announcementsA := make(chan announcement, 16)
+			announcementsB := make(chan announcement, 16)
+
+			bA, err := pubsub.NewBroadcaster(ctx, network.Peer("A"), logA, func(from peer.ID, heads *log.JSONLog) {
+				announcementsA <- announcement{from, heads}
+			}, &pubsub.BroadcasterOptions{Self: "A"})
+			c.So(err, ShouldBeNil)
+			defer bA.Close()
+			c.So(bA.Topic(), ShouldEqual, "X")
+
+			bB, err := pubsub.NewBroadcaster(ctx, network.Peer("B"), logB, func(from peer.ID, heads *log.JSONLog) {
+				announcementsB <- announcement{from, heads}
+			}, &pubsub.BroadcasterOptions{Self: "B"})
+			c.So(err, ShouldBeNil)
+			defer bB.Close()
+
+			e, err := logA.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			a := receive(announcementsB)
+			c.So(a.heads, ShouldNotBeNil)
+			c.So(string(a.from), ShouldEqual, "A")
+			c.So(a.heads.ID, ShouldEqual, "X")
+			c.So(len(a.heads.Heads), ShouldEqual, 1)
+			c.So(a.heads.Heads[0].String(), ShouldEqual, e.GetHash().String())
+
+			// A doesn't receive its own announcement
+			c.So(len(announcementsA), ShouldEqual, 0)
+
+			remote, err := log.NewFromJSON(ipfs, identities[1], a.heads, &log.NewLogOptions{}, &entry.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			_, err = logB.Join(remote, -1)
+			c.So(err, ShouldBeNil)
+
+			a = receive(announcementsA)
+			c.So(a.heads, ShouldNotBeNil)
+			c.So(string(a.from), ShouldEqual, "B")
+			c.So(a.heads.Heads[0].String(), ShouldEqual, e.GetHash().String())
+		})
+
+		c.Convey("doesn't announce joins without new entries", FailureHalts, func(c C) {
+			network := newMemoryPubSub()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			announcements := make(chan announcement, 16)
+
+			bA, err := pubsub.NewBroadcaster(ctx, network.Peer("A"), logA, nil, &pubsub.BroadcasterOptions{Self: "A"})
+			c.So(err, ShouldBeNil)
+			defer bA.Close()
+
+			bB, err := pubsub.NewBroadcaster(ctx, network.Peer("B"), logB, func(from peer.ID, heads *log.JSONLog) {
+				announcements <- announcement{from, heads}
+			}, nil)
+			c.So(err, ShouldBeNil)
+			defer bB.Close()
+
+			empty, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Join(empty, -1)
+			c.So(err, ShouldBeNil)
+
+			c.So(bA.Announce(ctx), ShouldBeNil)
+			a := receive(announcements)
+			c.So(a.heads, ShouldNotBeNil)
+			c.So(len(a.heads.Heads), ShouldEqual, 0)
+			c.So(len(announcements), ShouldEqual, 0)
+
+			c.So(bA.Close(), ShouldBeNil)
+			c.So(bA.Announce(ctx), ShouldNotBeNil)
+		})
+	})
+}
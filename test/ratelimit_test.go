@@ -0,0 +1,164 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/syncer"
+	"berty.tech/go-ipfs-log/utils/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Rate limits", t, FailureHalts, func(c C) {
+		c.Convey("spaces tokens once the burst is used", FailureHalts, func(c C) {
+			l := ratelimit.New(100, 1)
+
+			start := time.Now()
+			for i := 0; i < 11; i++ {
+				c.So(l.Wait(ctx), ShouldBeNil)
+			}
+			c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+
+			// Large requests leave the limiter in debt
+			c.So(l.WaitN(ctx, 20), ShouldBeNil)
+			start = time.Now()
+			c.So(l.Wait(ctx), ShouldBeNil)
+			c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			c.So(l.WaitN(canceled, 10), ShouldNotBeNil)
+		})
+
+		c.Convey("never waits when unlimited", FailureHalts, func(c C) {
+			l := ratelimit.New(0, 0)
+			c.So(l, ShouldBeNil)
+
+			start := time.Now()
+			for i := 0; i < 1000; i++ {
+				c.So(l.WaitN(ctx, 1000), ShouldBeNil)
+			}
+			c.So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		c.Convey("limits the entries fetched by a sync", FailureHalts, func(c C) {
+			ipfs := io.NewMemoryServices()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			start := time.Now()
+			added, err := logB.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{
+				EntryLimiter: ratelimit.New(20, 1),
+			})
+			c.So(err, ShouldBeNil)
+			c.So(len(added), ShouldEqual, 5)
+			c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 180*time.Millisecond)
+
+			_, err = logA.Append([]byte("hello5"), 1)
+			c.So(err, ShouldBeNil)
+
+			// The bytes of the first entry exhaust the limiter
+			logC, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			_, err = logC.SyncFromHeads(short, entryHashes(logA.GetHeads()), &log.SyncOptions{
+				ByteLimiter: ratelimit.New(10, 10),
+			})
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("bounds the syncs running at once", FailureHalts, func(c C) {
+			network := newMemoryNetwork()
+
+			logA, err := log.NewLog(io.NewMemoryServices(), identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("hello"), 1)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(io.NewMemoryServices(), identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			syncerA := syncer.NewSyncer(network.Host("A"), nil)
+			defer syncerA.Close()
+			syncerA.Add(logA)
+
+			syncerB := syncer.NewSyncer(network.Host("B"), &syncer.Options{MaxPeers: 1})
+			defer syncerB.Close()
+			syncerB.Add(logB)
+
+			// An idle stream holds the only slot of B
+			idle, err := network.Host("C").NewStream(ctx, "B", syncer.ProtocolID)
+			c.So(err, ShouldBeNil)
+
+			// Returns once the handler took the slot and started reading
+			_, err = idle.Write([]byte{0x05})
+			c.So(err, ShouldBeNil)
+
+			c.So(syncerA.Sync(ctx, "B", "X"), ShouldNotBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 0)
+
+			// Block streams count against the slots too
+			request := logA.Heads().At(0).GetHash().Bytes()
+			blockStream, err := network.Host("C").NewStream(ctx, "B", syncer.BlockProtocolID)
+			c.So(err, ShouldBeNil)
+
+			_, err = blockStream.Write(append([]byte{byte(len(request))}, request...))
+			if err == nil {
+				_, err = blockStream.Read(make([]byte, 1))
+			}
+			c.So(err, ShouldNotBeNil)
+
+			c.So(idle.Reset(), ShouldBeNil)
+
+			// The slot is released once the idle stream fails
+			var syncErr error
+			for i := 0; i < 50; i++ {
+				if syncErr = syncerA.Sync(ctx, "B", "X"); syncErr == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			c.So(syncErr, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/pubsub"
+	"berty.tech/go-ipfs-log/replicator"
+	cid "github.com/ipfs/go-cid"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplicator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Replicator", t, FailureHalts, func(c C) {
+		c.Convey("joins the heads of its sources", FailureHalts, func(c C) {
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			_, err = logB.Append([]byte("helloB0"), 1)
+			c.So(err, ShouldBeNil)
+
+			var progress []replicator.Progress
+			var conflicts [][]iface.IPFSLogEntry
+
+			r := replicator.New(&replicator.Options{
+				Sources: []replicator.HeadSource{
+					replicator.HeadSourceFunc(func(ctx context.Context, id string) ([]*log.JSONLog, error) {
+						return []*log.JSONLog{logA.ToJSON()}, nil
+					}),
+					// heads of other logs are ignored
+					replicator.StaticSource{{ID: "Y", Heads: []cid.Cid{logA.Heads().At(0).GetHash()}}},
+				},
+				OnProgress: func(p replicator.Progress) { progress = append(progress, p) },
+				OnConflict: func(heads []iface.IPFSLogEntry) { conflicts = append(conflicts, heads) },
+			}, logB)
+
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 4)
+			c.So(len(progress), ShouldEqual, 1)
+			c.So(progress[0].Round, ShouldEqual, 1)
+			c.So(progress[0].Added, ShouldEqual, 3)
+			c.So(len(conflicts), ShouldEqual, 1)
+			c.So(len(conflicts[0]), ShouldEqual, 2)
+
+			// Known heads aren't fetched again
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			c.So(len(progress), ShouldEqual, 1)
+
+			c.So(r.Do("X", func(l *log.Log) error {
+				_, err := l.Append([]byte("helloB1"), 1)
+				return err
+			}), ShouldBeNil)
+
+			_, err = logA.Append([]byte("helloA3"), 1)
+			c.So(err, ShouldBeNil)
+
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 6)
+			c.So(progress[1].Round, ShouldEqual, 3)
+			c.So(progress[1].Added, ShouldEqual, 1)
+			c.So(progress[1].ID, ShouldEqual, "X")
+
+			// Removed logs aren't replicated anymore
+			r.Remove("X")
+			c.So(r.Do("X", func(l *log.Log) error { return nil }), ShouldNotBeNil)
+
+			_, err = logA.Append([]byte("helloA4"), 1)
+			c.So(err, ShouldBeNil)
+
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 6)
+		})
+
+		c.Convey("replicates several logs", FailureHalts, func(c C) {
+			sources := map[string]*log.Log{}
+			replicas := []*log.Log{}
+
+			for _, id := range []string{"X", "Y"} {
+				source, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: id})
+				c.So(err, ShouldBeNil)
+
+				_, err = source.Append([]byte("hello"+id), 1)
+				c.So(err, ShouldBeNil)
+				sources[id] = source
+
+				replica, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: id})
+				c.So(err, ShouldBeNil)
+				replicas = append(replicas, replica)
+			}
+
+			var progress []replicator.Progress
+			r := replicator.New(&replicator.Options{
+				Sources: []replicator.HeadSource{
+					replicator.HeadSourceFunc(func(ctx context.Context, id string) ([]*log.JSONLog, error) {
+						return []*log.JSONLog{sources[id].ToJSON()}, nil
+					}),
+				},
+				OnProgress: func(p replicator.Progress) { progress = append(progress, p) },
+			}, replicas...)
+
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			c.So(len(progress), ShouldEqual, 2)
+			c.So(progress[0].ID, ShouldEqual, "X")
+			c.So(progress[1].ID, ShouldEqual, "Y")
+
+			for _, replica := range replicas {
+				c.So(r.Do(replica.ID, func(l *log.Log) error {
+					c.So(entriesAsStrings(l.Values()), ShouldResemble, []string{"hello" + l.ID})
+					return nil
+				}), ShouldBeNil)
+			}
+		})
+
+		c.Convey("sends round and entry events", FailureHalts, func(c C) {
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			events := make(chan replicator.Event, 64)
+			r := replicator.New(&replicator.Options{
+				Sources: []replicator.HeadSource{replicator.StaticSource{logA.ToJSON()}},
+				Events:  events,
+			}, logB)
+
+			c.So(r.Reconcile(ctx), ShouldBeNil)
+			close(events)
+
+			received := []replicator.Event{}
+			for e := range events {
+				c.So(e.Round, ShouldEqual, 1)
+				c.So(e.Time.IsZero(), ShouldBeFalse)
+				received = append(received, e)
+			}
+
+			c.So(len(received), ShouldEqual, 2+2*5)
+			c.So(received[0].Type, ShouldEqual, replicator.EventRoundStarted)
+			c.So(received[len(received)-1].Type, ShouldEqual, replicator.EventRoundFinished)
+			c.So(received[len(received)-1].Err, ShouldBeNil)
+
+			joined := 0
+			for _, e := range received[1 : len(received)-1] {
+				c.So(e.Type, ShouldEqual, replicator.EventEntry)
+				if e.Entry.Type == log.SyncJoined {
+					joined++
+				}
+			}
+			c.So(joined, ShouldEqual, 2)
+		})
+
+		c.Convey("reports errors and keeps going", FailureHalts, func(c C) {
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			_, err = logA.Append([]byte("helloA0"), 1)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			var errs []error
+			r := replicator.New(&replicator.Options{
+				Sources: []replicator.HeadSource{
+					replicator.HeadSourceFunc(func(ctx context.Context, id string) ([]*log.JSONLog, error) {
+						return nil, fmt.Errorf("unreachable")
+					}),
+					replicator.StaticSource{logA.ToJSON()},
+				},
+				OnError: func(err error) { errs = append(errs, err) },
+			}, logB)
+
+			c.So(r.Reconcile(ctx), ShouldNotBeNil)
+			c.So(len(errs), ShouldEqual, 1)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+		})
+
+		c.Convey("replicates in the background from pubsub announcements", FailureHalts, func(c C) {
+			network := newMemoryPubSub()
+
+			logA, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			bA, err := pubsub.NewBroadcaster(ctx, network.Peer("A"), logA, nil, &pubsub.BroadcasterOptions{Self: "A"})
+			c.So(err, ShouldBeNil)
+			defer bA.Close()
+
+			cache := pubsub.NewHeadsCache()
+			bB, err := pubsub.NewBroadcaster(ctx, network.Peer("B"), logB, cache.Add, &pubsub.BroadcasterOptions{Self: "B"})
+			c.So(err, ShouldBeNil)
+			defer bB.Close()
+
+			joined := make(chan replicator.Progress, 16)
+			r := replicator.New(&replicator.Options{
+				Sources:    []replicator.HeadSource{cache},
+				Interval:   10 * time.Millisecond,
+				OnProgress: func(p replicator.Progress) { joined <- p },
+			}, logB)
+			r.Start(ctx)
+			defer r.Close()
+
+			_, err = logA.Append([]byte("helloA0"), 1)
+			c.So(err, ShouldBeNil)
+
+			select {
+			case p := <-joined:
+				c.So(p.Added, ShouldEqual, 1)
+			case <-ctx.Done():
+				c.So(ctx.Err(), ShouldBeNil)
+			}
+
+			c.So(r.Close(), ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+		})
+	})
+}
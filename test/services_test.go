@@ -0,0 +1,208 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryExchange serves the blocks of another blockstore
+type memoryExchange struct {
+	remote bstore.Blockstore
+}
+
+func (e *memoryExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.remote.Get(c)
+}
+
+func (e *memoryExchange) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block, len(cids))
+	defer close(out)
+
+	for _, c := range cids {
+		if b, err := e.remote.Get(c); err == nil {
+			out <- b
+		}
+	}
+
+	return out, nil
+}
+
+func (e *memoryExchange) HasBlock(blocks.Block) error { return nil }
+func (e *memoryExchange) IsOnline() bool              { return true }
+func (e *memoryExchange) Close() error                { return nil }
+
+// hangingExchange never finds blocks, requests wait for their context
+type hangingExchange struct{}
+
+func (hangingExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingExchange) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+func (hangingExchange) HasBlock(blocks.Block) error { return nil }
+func (hangingExchange) IsOnline() bool              { return true }
+func (hangingExchange) Close() error                { return nil }
+
+func TestServices(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("Services", t, FailureHalts, func(c C) {
+		c.Convey("persist blocks in the datastore", FailureHalts, func(c C) {
+			db := dssync.MutexWrap(ds.NewMapDatastore())
+
+			logA, err := log.NewLog(io.NewServices(db, nil), identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewFromMultihash(io.NewServices(db, nil), identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+		})
+
+		c.Convey("fetch missing blocks through the exchange", FailureHalts, func(c C) {
+			remote := io.NewMemoryServices()
+
+			logA, err := log.NewLog(remote, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			services := io.NewServices(dssync.MutexWrap(ds.NewMapDatastore()), &memoryExchange{remote: remote.BlockStore()})
+
+			logB, err := log.NewFromMultihash(services, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+
+			// Offline services only read local blocks
+			_, err = log.NewFromMultihash(io.NewServices(dssync.MutexWrap(ds.NewMapDatastore()), nil), identity, hash, &log.NewLogOptions{}, &log.FetchOptions{})
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("exchange blocks with bitswap over libp2p", FailureHalts, func(c C) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			mn := mocknet.New(ctx)
+
+			nodes := []io.IpfsServices{}
+			for i := 0; i < 2; i++ {
+				h, err := mn.GenPeer()
+				c.So(err, ShouldBeNil)
+
+				services, err := io.NewNodeServices(ctx, dssync.MutexWrap(ds.NewMapDatastore()), h, nil)
+				c.So(err, ShouldBeNil)
+
+				nodes = append(nodes, services)
+			}
+
+			c.So(mn.LinkAll(), ShouldBeNil)
+			c.So(mn.ConnectAllButSelf(), ShouldBeNil)
+
+			logA, err := log.NewLog(nodes[0], identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			_, err = io.ReadCBORContext(ctx, nodes[1], hash)
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewFromMultihash(nodes[1], identity, hash, &log.NewLogOptions{}, &log.FetchOptions{Timeout: 5 * time.Second})
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Keys(), ShouldResemble, logA.Values().Keys())
+		})
+
+		c.Convey("only read local blocks when offline", FailureHalts, func(c C) {
+			remote := io.NewMemoryServices()
+
+			logA, err := log.NewLog(remote, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := logA.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			local := io.NewServices(dssync.MutexWrap(ds.NewMapDatastore()), hangingExchange{})
+			c.So(copyBlocks(remote, local, entryHashes(logA.GetHeads())), ShouldBeNil)
+
+			_, err = io.ReadCBOR(io.Offline(local), hash)
+			c.So(errors.Cause(err), ShouldEqual, errmsg.BlockNotLocal)
+
+			_, err = log.NewFromMultihash(local, identity, hash, &log.NewLogOptions{}, &log.FetchOptions{Offline: true})
+			c.So(errors.Cause(err), ShouldEqual, errmsg.BlockNotLocal)
+
+			// Only the local head is loaded
+			logB, err := log.NewFromEntryHash(local, identity, logA.GetHeads()[0].GetHash(), &log.NewLogOptions{ID: "X"}, &log.FetchOptions{Offline: true})
+			c.So(err, ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 1)
+
+			logC, err := log.NewLog(local, identity, &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err = logC.SyncFromHeads(ctx, entryHashes(logA.GetHeads()), &log.SyncOptions{Offline: true})
+			c.So(errors.Cause(err), ShouldEqual, errmsg.BlockNotLocal)
+			c.So(ctx.Err(), ShouldBeNil)
+			c.So(logC.Values().Len(), ShouldEqual, 0)
+		})
+	})
+}
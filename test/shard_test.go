@@ -0,0 +1,144 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/shard"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShard(t *testing.T) {
+	keystore := newTestKeystore()
+
+	identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	payloads := func(from, to int) []string {
+		p := []string{}
+		for i := from; i < to; i++ {
+			p = append(p, fmt.Sprintf("hello%d", i))
+		}
+
+		return p
+	}
+
+	Convey("Sharded log", t, FailureHalts, func(c C) {
+		ipfs := io.NewMemoryServices()
+
+		values := func(s *shard.Log) []string {
+			entries, err := s.Values()
+			c.So(err, ShouldBeNil)
+
+			p := []string{}
+			for _, e := range entries {
+				p = append(p, string(e.GetPayload()))
+			}
+
+			return p
+		}
+
+		c.Convey("splits the entries by epoch", FailureHalts, func(c C) {
+			s, err := shard.New(ipfs, identity, "A", &shard.Options{MaxEntries: 3})
+			c.So(err, ShouldBeNil)
+
+			for _, p := range payloads(0, 8) {
+				_, err := s.Append([]byte(p))
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(s.Shards(), ShouldResemble, []string{"A/0/0", "A/0/1", "A/0/2"})
+			c.So(s.Loaded(), ShouldEqual, 1)
+			c.So(s.Len(), ShouldEqual, 8)
+			c.So(values(s), ShouldResemble, payloads(0, 8))
+			c.So(s.Loaded(), ShouldEqual, 1)
+		})
+
+		c.Convey("splits the entries by hash", FailureHalts, func(c C) {
+			s, err := shard.New(ipfs, identity, "A", &shard.Options{MaxEntries: 2, Buckets: 2})
+			c.So(err, ShouldBeNil)
+
+			for _, p := range payloads(0, 10) {
+				_, err := s.Append([]byte(p))
+				c.So(err, ShouldBeNil)
+			}
+
+			buckets := map[string]bool{}
+			for _, id := range s.Shards() {
+				buckets[id[:3]] = true
+			}
+
+			c.So(len(buckets), ShouldEqual, 2)
+			c.So(s.Loaded(), ShouldBeLessThanOrEqualTo, 2)
+			c.So(s.Len(), ShouldEqual, 10)
+
+			// The clock is shared by the shards
+			c.So(values(s), ShouldResemble, payloads(0, 10))
+		})
+
+		c.Convey("reopens from its multihash", FailureHalts, func(c C) {
+			s, err := shard.New(ipfs, identity, "A", &shard.Options{MaxEntries: 3})
+			c.So(err, ShouldBeNil)
+
+			for _, p := range payloads(0, 8) {
+				_, err := s.Append([]byte(p))
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := s.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			s2, err := shard.NewFromMultihash(ipfs, identity, hash, nil)
+			c.So(err, ShouldBeNil)
+			c.So(s2.Loaded(), ShouldEqual, 0)
+			c.So(s2.Shards(), ShouldResemble, s.Shards())
+			c.So(values(s2), ShouldResemble, payloads(0, 8))
+
+			e, err := s2.Append([]byte("hello8"))
+			c.So(err, ShouldBeNil)
+			c.So(e.GetClock().Time, ShouldEqual, 9)
+			c.So(s2.Shards(), ShouldResemble, s.Shards())
+			c.So(values(s2), ShouldResemble, payloads(0, 9))
+		})
+
+		c.Convey("joins the shards with the same ID", FailureHalts, func(c C) {
+			s1, err := shard.New(ipfs, identity, "A", &shard.Options{MaxEntries: 3})
+			c.So(err, ShouldBeNil)
+
+			s2, err := shard.New(ipfs, identity, "A", &shard.Options{MaxEntries: 3})
+			c.So(err, ShouldBeNil)
+
+			for _, p := range payloads(0, 4) {
+				_, err := s1.Append([]byte(p))
+				c.So(err, ShouldBeNil)
+			}
+
+			for _, p := range payloads(4, 9) {
+				_, err := s2.Append([]byte(p))
+				c.So(err, ShouldBeNil)
+			}
+
+			c.So(s1.Join(s2), ShouldBeNil)
+			c.So(s1.Shards(), ShouldResemble, []string{"A/0/0", "A/0/1"})
+			c.So(s1.Len(), ShouldEqual, 9)
+
+			joined := values(s1)
+			sort.Strings(joined)
+			c.So(joined, ShouldResemble, payloads(0, 9))
+
+			other, err := shard.New(ipfs, identity, "A", &shard.Options{Buckets: 2})
+			c.So(err, ShouldBeNil)
+			c.So(s1.Join(other), ShouldNotBeNil)
+		})
+	})
+}
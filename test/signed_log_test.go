@@ -2,19 +2,24 @@ package test // import "berty.tech/go-ipfs-log/test"
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"berty.tech/go-ipfs-log/accesscontroller"
 	"berty.tech/go-ipfs-log/entry"
 	"berty.tech/go-ipfs-log/errmsg"
 	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io"
 	ks "berty.tech/go-ipfs-log/keystore"
 	"berty.tech/go-ipfs-log/log"
+	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	crypto "github.com/libp2p/go-libp2p-crypto"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -30,7 +35,7 @@ func mustBytes(data []byte, err error) []byte {
 type DenyAll struct {
 }
 
-func (*DenyAll) CanAppend(*entry.Entry, *idp.Identity) error {
+func (*DenyAll) CanAppend(context.Context, iface.IPFSLogEntry, idp.Interface, accesscontroller.LogState) error {
 	return errors.New("denied")
 }
 
@@ -38,14 +43,26 @@ type TestACL struct {
 	refIdentity *idp.Identity
 }
 
-func (t *TestACL) CanAppend(e *entry.Entry, i *idp.Identity) error {
-	if e.Identity.ID == t.refIdentity.ID {
+func (t *TestACL) CanAppend(_ context.Context, e iface.IPFSLogEntry, _ idp.Interface, _ accesscontroller.LogState) error {
+	if e.GetIdentity().ID == t.refIdentity.ID {
 		return errors.New("denied")
 	}
 
 	return nil
 }
 
+// countingSigner counts the signatures made by a signer
+type countingSigner struct {
+	idp.Signer
+	calls int
+}
+
+func (s *countingSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	s.calls++
+
+	return s.Signer.Sign(ctx, data)
+}
+
 func TestSignedLog(t *testing.T) {
 	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
@@ -122,8 +139,8 @@ func TestSignedLog(t *testing.T) {
 			_, err = l.Append([]byte("one"), 1)
 			c.So(err, ShouldBeNil)
 
-			c.So(l.Values().At(0).Sig, ShouldNotBeNil)
-			c.So(l.Values().At(0).Identity.Filtered(), ShouldResemble, identities[0].Filtered())
+			c.So(l.Values().At(0).GetSig(), ShouldNotBeNil)
+			c.So(l.Values().At(0).GetIdentity().Filtered(), ShouldResemble, identities[0].Filtered())
 		})
 
 		c.Convey("doesn't sign entries when identity is not defined", FailureHalts, func(c C) {
@@ -152,7 +169,7 @@ func TestSignedLog(t *testing.T) {
 
 			c.So(l1.ID, ShouldEqual, "A")
 			c.So(l1.Values().Len(), ShouldEqual, 1)
-			c.So(l1.Values().At(0).Payload, ShouldResemble, []byte("one"))
+			c.So(l1.Values().At(0).GetPayload(), ShouldResemble, []byte("one"))
 		})
 
 		c.Convey("throws an error if log is signed but trying to merge with an entry that doesn't have public signing key", FailureHalts, func(c C) {
@@ -168,11 +185,12 @@ func TestSignedLog(t *testing.T) {
 			_, err = l2.Append([]byte("two"), 1)
 			c.So(err, ShouldBeNil)
 
-			l2.Values().At(0).Key = nil
+			l2.Values().At(0).(*entry.Entry).Key = nil
 
 			_, err = l1.Join(l2, -1)
 			c.So(err, ShouldNotBeNil)
 			c.So(err.Error(), ShouldContainSubstring, "Entry doesn't have a key")
+			c.So(errors.Is(err, errmsg.MalformedEntry), ShouldBeTrue)
 		})
 
 		c.Convey("throws an error if log is signed but trying to merge an entry that doesn't have a signature", FailureHalts, func(c C) {
@@ -188,11 +206,12 @@ func TestSignedLog(t *testing.T) {
 			_, err = l2.Append([]byte("two"), 1)
 			c.So(err, ShouldBeNil)
 
-			l2.Values().At(0).Sig = nil
+			l2.Values().At(0).(*entry.Entry).Sig = nil
 
 			_, err = l1.Join(l2, -1)
 			c.So(err, ShouldNotBeNil)
 			c.So(err.Error(), ShouldContainSubstring, "Entry doesn't have a signature")
+			c.So(errors.Is(err, errmsg.MalformedEntry), ShouldBeTrue)
 		})
 
 		c.Convey("throws an error if log is signed but the signature doesn't verify", FailureHalts, func(c C) {
@@ -208,14 +227,15 @@ func TestSignedLog(t *testing.T) {
 			_, err = l2.Append([]byte("two"), 1)
 			c.So(err, ShouldBeNil)
 
-			l2.Values().At(0).Sig = l1.Values().At(0).Sig
+			l2.Values().At(0).(*entry.Entry).Sig = l1.Values().At(0).GetSig()
 
 			_, err = l1.Join(l2, -1)
 			c.So(err, ShouldNotBeNil)
 			c.So(err.Error(), ShouldContainSubstring, "unable to verify entry signature")
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeTrue)
 
 			c.So(l1.Values().Len(), ShouldEqual, 1)
-			c.So(l1.Values().At(0).Payload, ShouldResemble, []byte("one"))
+			c.So(l1.Values().At(0).GetPayload(), ShouldResemble, []byte("one"))
 		})
 
 		c.Convey("throws an error if entry doesn't have append access", FailureHalts, func(c C) {
@@ -231,6 +251,7 @@ func TestSignedLog(t *testing.T) {
 			_, err = l2.Append([]byte("two"), 1)
 			c.So(err, ShouldNotBeNil)
 			c.So(err.Error(), ShouldContainSubstring, "append failed: denied")
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
 		})
 
 		c.Convey("throws an error upon join if entry doesn't have append access", FailureHalts, func(c C) {
@@ -249,6 +270,346 @@ func TestSignedLog(t *testing.T) {
 			_, err = l1.Join(l2, -1)
 			c.So(err, ShouldNotBeNil)
 			c.So(err.Error(), ShouldContainSubstring, "join failed: denied")
+			c.So(errors.Is(err, errmsg.AccessDenied), ShouldBeTrue)
+		})
+
+		c.Convey("classifies verification errors", FailureHalts, func(c C) {
+			l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			e, err := l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			// Signed by another identity than the one it carries
+			forged := *e.(*entry.Entry)
+			forged.Identity = identities[1]
+			err = entry.VerifyIdentity(&forged, nil)
+			c.So(errors.Is(err, errmsg.UnknownIdentity), ShouldBeTrue)
+
+			forged.Identity = nil
+			err = entry.VerifyIdentity(&forged, nil)
+			c.So(errors.Is(err, errmsg.UnknownIdentity), ShouldBeTrue)
+
+			_, err = entry.FromRawData([]byte("not an entry"), e.GetHash(), identities[0].Provider)
+			c.So(errors.Is(err, errmsg.MalformedEntry), ShouldBeTrue)
+			c.So(errors.Is(err, errmsg.BadSignature), ShouldBeFalse)
+		})
+
+		c.Convey("signs entries with ed25519 identities", FailureHalts, func(c C) {
+			identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userEd25519",
+				Type:     idp.Ed25519Type,
+			})
+			c.So(err, ShouldBeNil)
+			c.So(identity.Type, ShouldEqual, "ed25519")
+			c.So(len(identity.PublicKey), ShouldEqual, 32)
+			c.So(idp.VerifyIdentity(identity), ShouldBeNil)
+
+			// The same keys are used again
+			again, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userEd25519",
+				Type:     idp.Ed25519Type,
+			})
+			c.So(err, ShouldBeNil)
+			c.So(again.ID, ShouldEqual, identity.ID)
+			c.So(again.PublicKey, ShouldResemble, identity.PublicKey)
+
+			l1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			l2, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			e, err := l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e.GetKey(), ShouldResemble, identity.PublicKey)
+			c.So(e.Verify(identity.Provider), ShouldBeNil)
+			c.So(entry.VerifyIdentity(e, nil), ShouldBeNil)
+
+			_, err = l2.Append([]byte("two"), 1)
+			c.So(err, ShouldBeNil)
+
+			// Both key types can be mixed in a log
+			_, err = l2.Join(l1, -1)
+			c.So(err, ShouldBeNil)
+			c.So(l2.Values().Len(), ShouldEqual, 2)
+
+			tampered := e.(*entry.Entry).Copy()
+			tampered.Payload = []byte("three")
+			c.So(tampered.Verify(identity.Provider), ShouldNotBeNil)
+		})
+
+		c.Convey("accepts entries signed with rotated keys", FailureHalts, func(c C) {
+			identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userRotated",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			l1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			e1, err := l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			rotated, err := idp.RotateKey(identity, keystore)
+			c.So(err, ShouldBeNil)
+			c.So(rotated.ID, ShouldEqual, identity.ID)
+			c.So(rotated.PublicKey, ShouldResemble, identity.PublicKey)
+			c.So(len(rotated.Rotations), ShouldEqual, 1)
+			c.So(rotated.SigningKey(), ShouldNotResemble, identity.PublicKey)
+
+			keys, err := rotated.Keys()
+			c.So(err, ShouldBeNil)
+			c.So(keys, ShouldResemble, [][]byte{identity.PublicKey, rotated.SigningKey()})
+
+			l2, err := log.NewLog(ipfs, rotated, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = l2.Join(l1, -1)
+			c.So(err, ShouldBeNil)
+
+			e2, err := l2.Append([]byte("two"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(e2.GetKey(), ShouldResemble, rotated.SigningKey())
+			c.So(e2.GetClock().ID, ShouldResemble, identity.PublicKey)
+
+			// Entries carrying rotations are canonical and decode to the
+			// same entry
+			c.So(entry.VerifyEncoding(e2.(*entry.Entry)), ShouldBeNil)
+
+			decoded, err := entry.FromMultihash(ipfs, e2.GetHash(), rotated.Provider)
+			c.So(err, ShouldBeNil)
+			c.So(decoded.Identity.Rotations, ShouldResemble, e2.GetIdentity().Rotations)
+			c.So(entry.VerifyEncoding(decoded), ShouldBeNil)
+			c.So(decoded.GetHash().Equals(e2.GetHash()), ShouldBeTrue)
+
+			// Both keys are accepted once the log is loaded again
+			hash, err := l2.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			l3, err := log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{StrictValidation: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(l3.Values().Len(), ShouldEqual, 2)
+
+			for _, e := range []iface.IPFSLogEntry{e1, e2} {
+				c.So(entry.VerifyIdentity(e, nil), ShouldBeNil)
+			}
+
+			// The rotation must be signed by both keys
+			other, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userOther",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			forged := *rotated.Rotations[0]
+			forged.NextKey = other.PublicKey
+			c.So(forged.Verify(), ShouldNotBeNil)
+
+			forgedIdentity := rotated.Filtered()
+			forgedIdentity.Rotations = []*idp.KeyRotation{&forged}
+			c.So(forgedIdentity.HasKey(other.PublicKey), ShouldNotBeNil)
+		})
+
+		c.Convey("accepts entries signed by delegated devices", FailureHalts, func(c C) {
+			primary, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userPrimary",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			newDevice := func() *idp.Identities {
+				deviceKeystore, err := ks.NewKeystore(dssync.MutexWrap(ds.NewMapDatastore()))
+				c.So(err, ShouldBeNil)
+
+				return idp.NewIdentities(deviceKeystore)
+			}
+
+			// The device only holds its own key
+			device := newDevice()
+			deviceKey, err := device.CreateDeviceKey(primary.ID)
+			c.So(err, ShouldBeNil)
+
+			delegation, err := idp.NewIdentities(keystore).Delegate(primary, deviceKey)
+			c.So(err, ShouldBeNil)
+
+			deviceIdentity, err := device.DelegatedIdentity(primary, delegation)
+			c.So(err, ShouldBeNil)
+			c.So(deviceIdentity.ID, ShouldEqual, primary.ID)
+			c.So(deviceIdentity.SigningKey(), ShouldResemble, deviceKey)
+
+			// Devices can delegate to other devices
+			subDevice := newDevice()
+			subDeviceKey, err := subDevice.CreateDeviceKey(primary.ID)
+			c.So(err, ShouldBeNil)
+
+			subDelegation, err := device.Delegate(deviceIdentity, subDeviceKey)
+			c.So(err, ShouldBeNil)
+
+			subDeviceIdentity, err := subDevice.DelegatedIdentity(deviceIdentity, subDelegation)
+			c.So(err, ShouldBeNil)
+			c.So(len(subDeviceIdentity.Delegations), ShouldEqual, 2)
+
+			l1, err := log.NewLog(ipfs, primary, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			_, err = l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+
+			for i, identity := range []*idp.Identity{deviceIdentity, subDeviceIdentity} {
+				l, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+				c.So(err, ShouldBeNil)
+
+				e, err := l.Append([]byte(fmt.Sprintf("device%d", i)), 1)
+				c.So(err, ShouldBeNil)
+				c.So(e.GetKey(), ShouldResemble, identity.SigningKey())
+				c.So(entry.VerifyIdentity(e, nil), ShouldBeNil)
+
+				_, err = l1.Join(l, -1)
+				c.So(err, ShouldBeNil)
+			}
+
+			hash, err := l1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			l2, err := log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{StrictValidation: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+			c.So(l2.Values().Len(), ShouldEqual, 3)
+
+			// Delegations must be issued by the identity
+			other, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       "userOther",
+				Type:     "orbitdb",
+			})
+			c.So(err, ShouldBeNil)
+
+			forged, err := idp.NewIdentities(keystore).Delegate(other, deviceKey)
+			c.So(err, ShouldBeNil)
+
+			_, err = device.DelegatedIdentity(primary, forged)
+			c.So(err, ShouldNotBeNil)
+
+			forgedIdentity := primary.Filtered()
+			forgedIdentity.Delegations = []*idp.KeyDelegation{forged}
+			c.So(forgedIdentity.HasKey(deviceKey), ShouldNotBeNil)
+
+			// Delegations issued by a key rotated out are rejected
+			rotated, err := idp.RotateKey(primary, keystore)
+			c.So(err, ShouldBeNil)
+
+			_, err = device.DelegatedIdentity(rotated, delegation)
+			c.So(err, ShouldNotBeNil)
+
+			staleIdentity := rotated.Filtered()
+			staleIdentity.Delegations = []*idp.KeyDelegation{delegation}
+			c.So(staleIdentity.HasKey(deviceKey), ShouldNotBeNil)
+
+			delegation, err = idp.NewIdentities(keystore).Delegate(rotated, deviceKey)
+			c.So(err, ShouldBeNil)
+
+			deviceIdentity, err = device.DelegatedIdentity(rotated, delegation)
+			c.So(err, ShouldBeNil)
+			c.So(deviceIdentity.HasKey(deviceKey), ShouldBeNil)
+		})
+
+		c.Convey("rejects entries signed by revoked keys", FailureHalts, func(c C) {
+			l2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			for _, payload := range []string{"one", "two", "three"} {
+				_, err = l2.Append([]byte(payload), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			// Entries held when the key is revoked are kept
+			revocations := accesscontroller.NewRevocations()
+			revocations.Revoke(identities[1].PublicKey, l2)
+
+			l1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Revocations: revocations})
+			c.So(err, ShouldBeNil)
+
+			_, err = l1.Join(l2, -1)
+			c.So(err, ShouldBeNil)
+			c.So(l1.Values().Len(), ShouldEqual, 3)
+
+			_, err = l2.Append([]byte("four"), 1)
+			c.So(err, ShouldBeNil)
+
+			l3, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Revocations: revocations})
+			c.So(err, ShouldBeNil)
+
+			_, err = l3.Join(l2, -1)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.KeyRevoked.Error())
+
+			// Entries can't be backdated with a lower clock
+			l4, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A", Revocations: revocations})
+			c.So(err, ShouldBeNil)
+
+			_, err = l4.Append([]byte("backdated"), 1)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errmsg.KeyRevoked.Error())
+
+			hash, err := l2.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			_, err = log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{StrictValidation: true, Revocations: revocations}, &log.FetchOptions{})
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, "validation failed: 1 invalid entries")
+
+			// A later revocation only keeps the entries kept by both
+			revocations.Revoke(identities[1].PublicKey, l2)
+			c.So(revocations.IsRevoked(l2.Values().At(3)), ShouldBeTrue)
+
+			revocations.Revoke(identities[1].PublicKey, nil)
+			c.So(revocations.IsRevoked(l2.Values().At(0)), ShouldBeTrue)
+		})
+
+		c.Convey("signs entries with remote signers", FailureHalts, func(c C) {
+			key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+			c.So(err, ShouldBeNil)
+
+			signer := &countingSigner{Signer: idp.NewKeySigner(key)}
+
+			identity, err := idp.NewSignerIdentity(context.Background(), signer)
+			c.So(err, ShouldBeNil)
+			c.So(identity.Type, ShouldEqual, idp.SignerType)
+			c.So(idp.VerifyIdentity(identity), ShouldBeNil)
+
+			l1, err := log.NewLog(ipfs, identity, &log.NewLogOptions{ID: "A"})
+			c.So(err, ShouldBeNil)
+
+			calls := signer.calls
+			e, err := l1.Append([]byte("one"), 1)
+			c.So(err, ShouldBeNil)
+			c.So(signer.calls, ShouldEqual, calls+1)
+			c.So(e.Verify(identity.Provider), ShouldBeNil)
+			c.So(entry.VerifyIdentity(e, nil), ShouldBeNil)
+
+			hash, err := l1.ToMultihash()
+			c.So(err, ShouldBeNil)
+
+			_, err = log.NewFromMultihash(ipfs, identities[0], hash, &log.NewLogOptions{StrictValidation: true}, &log.FetchOptions{})
+			c.So(err, ShouldBeNil)
+
+			// Entries of keystore backed identities can be signed remotely
+			private, err := keystore.GetKey(identities[0].ID)
+			c.So(err, ShouldBeNil)
+
+			signer = &countingSigner{Signer: idp.NewKeySigner(private)}
+			e2, err := entry.CreateEntryWithOptions(ipfs, identities[0], &entry.Entry{Payload: []byte("two"), LogID: "A"}, nil, &entry.CreateEntryOptions{Signer: signer})
+			c.So(err, ShouldBeNil)
+			c.So(signer.calls, ShouldEqual, 1)
+			c.So(e2.GetKey(), ShouldResemble, identities[0].PublicKey)
+			c.So(e2.Verify(identities[0].Provider), ShouldBeNil)
+			c.So(entry.VerifyIdentity(e2, nil), ShouldBeNil)
 		})
 	})
 }
@@ -0,0 +1,145 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/sorting"
+	"berty.tech/go-ipfs-log/utils/lamportclock"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSorting(t *testing.T) {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	ipfs := io.NewMemoryServices()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore())
+	keystore, err := ks.NewKeystore(datastore)
+	if err != nil {
+		panic(err)
+	}
+
+	var identities [2]*idp.Identity
+
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	create := func(identity *idp.Identity, payload string, clock *lamportclock.LamportClock) *entry.Entry {
+		e, err := entry.CreateEntry(ipfs, identity, &entry.Entry{Payload: []byte(payload), LogID: "A"}, clock)
+		if err != nil {
+			panic(err)
+		}
+
+		return e
+	}
+
+	Convey("Sorting", t, FailureHalts, func(c C) {
+		e1 := create(identities[0], "one", lamportclock.New(identities[0].PublicKey, 1))
+		e2 := create(identities[0], "two", lamportclock.New(identities[0].PublicKey, 2))
+		e3 := create(identities[1], "three", lamportclock.New(identities[1].PublicKey, 2))
+		e4 := create(identities[0], "four", lamportclock.New(identities[0].PublicKey, 2))
+
+		c.Convey("LastWriteWins sorts by clock time then clock id", FailureHalts, func(c C) {
+			res, err := sorting.LastWriteWins(e1, e2)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldEqual, -1)
+
+			res, err = sorting.LastWriteWins(e2, e3)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldNotEqual, 0)
+
+			reversed, err := sorting.FirstWriteWins(e2, e3)
+			c.So(err, ShouldBeNil)
+			c.So(reversed, ShouldEqual, -res)
+		})
+
+		c.Convey("SortByEntryHash breaks ties using the entry hash", FailureHalts, func(c C) {
+			res, err := sorting.SortByEntryHash(e2, e4)
+			c.So(err, ShouldBeNil)
+
+			if io.CIDString(e2.Hash) < io.CIDString(e4.Hash) {
+				c.So(res, ShouldEqual, -1)
+			} else {
+				c.So(res, ShouldEqual, 1)
+			}
+
+			res, err = sorting.SortByEntryHash(e1, e4)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldEqual, -1)
+		})
+
+		c.Convey("LastWriteWins accepts a custom tiebreaker", FailureHalts, func(c C) {
+			byPayload := func(a, b iface.IPFSLogEntry) (int, error) {
+				return strings.Compare(string(a.GetPayload()), string(b.GetPayload())), nil
+			}
+
+			sortFn := sorting.LastWriteWinsWithTiebreaker(byPayload)
+
+			res, err := sortFn(e2, e3)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldEqual, 1)
+
+			res, err = sortFn(e3, e2)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldEqual, -1)
+
+			res, err = sortFn(e1, e3)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldEqual, -1)
+
+			for _, payloads := range [][]string{{"a", "b"}, {"b", "a"}} {
+				log1, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", Tiebreaker: byPayload})
+				c.So(err, ShouldBeNil)
+				log2, err := log.NewLog(ipfs, identities[1], &log.NewLogOptions{ID: "A", Tiebreaker: byPayload})
+				c.So(err, ShouldBeNil)
+
+				_, err = log1.Append([]byte(payloads[0]), 1)
+				c.So(err, ShouldBeNil)
+				_, err = log2.Append([]byte(payloads[1]), 1)
+				c.So(err, ShouldBeNil)
+
+				_, err = log1.Join(log2, -1)
+				c.So(err, ShouldBeNil)
+				c.So(entriesAsStrings(log1.Values()), ShouldResemble, []string{"a", "b"})
+			}
+		})
+
+		c.Convey("logs accept any sorting strategy", FailureHalts, func(c C) {
+			for _, sortFn := range []func(a, b iface.IPFSLogEntry) (int, error){sorting.LastWriteWins, sorting.FirstWriteWins, sorting.SortByEntryHash} {
+				l, err := log.NewLog(ipfs, identities[0], &log.NewLogOptions{ID: "A", SortFn: sortFn})
+				c.So(err, ShouldBeNil)
+
+				for i := 0; i < 3; i++ {
+					_, err := l.Append([]byte(fmt.Sprintf("hello%d", i)), 1)
+					c.So(err, ShouldBeNil)
+				}
+
+				c.So(l.Values().Len(), ShouldEqual, 3)
+			}
+		})
+	})
+}
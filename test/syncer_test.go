@@ -0,0 +1,228 @@
+package test // import "berty.tech/go-ipfs-log/test"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/io"
+	"berty.tech/go-ipfs-log/log"
+	"berty.tech/go-ipfs-log/syncer"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryHost connects the hosts of a network with in-memory streams
+type memoryHost struct {
+	network  *memoryNetwork
+	id       peer.ID
+	handlers map[protocol.ID]inet.StreamHandler
+}
+
+type memoryNetwork struct {
+	lock  sync.Mutex
+	hosts map[peer.ID]*memoryHost
+}
+
+// memoryStream only implements the methods of inet.Stream used by the
+// syncer
+type memoryStream struct {
+	inet.Stream
+	pipe     net.Conn
+	protocol protocol.ID
+}
+
+func newMemoryNetwork() *memoryNetwork {
+	return &memoryNetwork{hosts: map[peer.ID]*memoryHost{}}
+}
+
+func (n *memoryNetwork) Host(id string) *memoryHost {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	h := &memoryHost{network: n, id: peer.ID(id), handlers: map[protocol.ID]inet.StreamHandler{}}
+	n.hosts[h.id] = h
+
+	return h
+}
+
+func (h *memoryHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	h.network.lock.Lock()
+	defer h.network.lock.Unlock()
+
+	h.handlers[pid] = handler
+}
+
+func (h *memoryHost) RemoveStreamHandler(pid protocol.ID) {
+	h.network.lock.Lock()
+	defer h.network.lock.Unlock()
+
+	delete(h.handlers, pid)
+}
+
+func (h *memoryHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	h.network.lock.Lock()
+	defer h.network.lock.Unlock()
+
+	remote, ok := h.network.hosts[p]
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %s", p)
+	}
+
+	for _, pid := range pids {
+		if handler, ok := remote.handlers[pid]; ok {
+			local, other := net.Pipe()
+			go handler(&memoryStream{pipe: other, protocol: pid})
+
+			return &memoryStream{pipe: local, protocol: pid}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("protocol not supported")
+}
+
+func (s *memoryStream) Read(b []byte) (int, error)         { return s.pipe.Read(b) }
+func (s *memoryStream) Write(b []byte) (int, error)        { return s.pipe.Write(b) }
+func (s *memoryStream) Close() error                       { return s.pipe.Close() }
+func (s *memoryStream) Reset() error                       { return s.pipe.Close() }
+func (s *memoryStream) SetDeadline(t time.Time) error      { return s.pipe.SetDeadline(t) }
+func (s *memoryStream) SetReadDeadline(t time.Time) error  { return s.pipe.SetReadDeadline(t) }
+func (s *memoryStream) SetWriteDeadline(t time.Time) error { return s.pipe.SetWriteDeadline(t) }
+func (s *memoryStream) Protocol() protocol.ID              { return s.protocol }
+func (s *memoryStream) SetProtocol(pid protocol.ID)        { s.protocol = pid }
+
+func TestSyncer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	keystore := newTestKeystore()
+
+	var identities [2]*idp.Identity
+	for i, id := range []string{"userA", "userB"} {
+		identity, err := idp.CreateIdentity(&idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       id,
+			Type:     "orbitdb",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		identities[i] = identity
+	}
+
+	Convey("Syncer", t, FailureHalts, func(c C) {
+		c.Convey("exchanges the missing entries of both peers", FailureHalts, func(c C) {
+			network := newMemoryNetwork()
+
+			// Separate offline stores, every block has to go through the stream
+			logA, err := log.NewLog(io.NewMemoryServices(), identities[0], &log.NewLogOptions{ID: "X", PayloadThreshold: 1024})
+			c.So(err, ShouldBeNil)
+
+			logB, err := log.NewLog(io.NewMemoryServices(), identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := logA.Append([]byte(fmt.Sprintf("helloA%d", i)), 1)
+				c.So(err, ShouldBeNil)
+
+				_, err = logB.Append([]byte(fmt.Sprintf("helloB%d", i)), 1)
+				c.So(err, ShouldBeNil)
+			}
+
+			large := bytes.Repeat([]byte("a"), 300*1024)
+			_, err = logA.Append(large, 1)
+			c.So(err, ShouldBeNil)
+
+			syncerA := syncer.NewSyncer(network.Host("A"), nil)
+			defer syncerA.Close()
+			syncerA.Add(logA)
+
+			syncerB := syncer.NewSyncer(network.Host("B"), nil)
+			defer syncerB.Close()
+			syncerB.Add(logB)
+
+			c.So(syncerA.Sync(ctx, "B", "X"), ShouldBeNil)
+
+			var valuesB []string
+			c.So(syncerB.Do("X", func(l *log.Log) error {
+				valuesB = l.Values().Keys()
+				return nil
+			}), ShouldBeNil)
+
+			c.So(logA.Values().Len(), ShouldEqual, 7)
+			c.So(valuesB, ShouldResemble, logA.Values().Keys())
+			c.So(logB.Heads().Len(), ShouldEqual, 2)
+
+			// The external payload was transferred along with its entry
+			c.So(syncerB.Do("X", func(l *log.Log) error {
+				found := false
+				for _, e := range l.Values().Slice() {
+					if bytes.Equal(e.GetPayload(), large) {
+						found = true
+					}
+				}
+				c.So(found, ShouldBeTrue)
+				return nil
+			}), ShouldBeNil)
+
+			// Entries appended afterwards are sent on the next sync
+			_, err = logA.Append([]byte("helloA3"), 1)
+			c.So(err, ShouldBeNil)
+
+			c.So(syncerA.Sync(ctx, "B", "X"), ShouldBeNil)
+			c.So(logB.Values().Len(), ShouldEqual, 8)
+			c.So(logB.Heads().Len(), ShouldEqual, 1)
+		})
+
+		c.Convey("fails for unknown logs and peers", FailureHalts, func(c C) {
+			network := newMemoryNetwork()
+
+			logA, err := log.NewLog(io.NewMemoryServices(), identities[0], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			syncerA := syncer.NewSyncer(network.Host("A"), nil)
+			defer syncerA.Close()
+			syncerA.Add(logA)
+
+			syncerB := syncer.NewSyncer(network.Host("B"), nil)
+			defer syncerB.Close()
+
+			c.So(syncerA.Sync(ctx, "B", "Y"), ShouldNotBeNil)
+			c.So(syncerA.Sync(ctx, "B", "X"), ShouldNotBeNil)
+			c.So(syncerA.Sync(ctx, "C", "X"), ShouldNotBeNil)
+
+			syncerA.Remove("X")
+			c.So(syncerA.Do("X", func(l *log.Log) error { return nil }), ShouldNotBeNil)
+		})
+
+		c.Convey("closes the streams of idle peers", FailureHalts, func(c C) {
+			network := newMemoryNetwork()
+
+			logB, err := log.NewLog(io.NewMemoryServices(), identities[1], &log.NewLogOptions{ID: "X"})
+			c.So(err, ShouldBeNil)
+
+			syncerB := syncer.NewSyncer(network.Host("B"), &syncer.Options{StreamTimeout: 50 * time.Millisecond})
+			defer syncerB.Close()
+			syncerB.Add(logB)
+
+			for _, pid := range []protocol.ID{syncer.ProtocolID, syncer.BlockProtocolID} {
+				idle, err := network.Host("C").NewStream(ctx, "B", pid)
+				c.So(err, ShouldBeNil)
+
+				start := time.Now()
+				_, err = idle.Read(make([]byte, 1))
+				c.So(err, ShouldNotBeNil)
+				c.So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+			}
+		})
+	})
+}
@@ -1,8 +1,11 @@
 package test // import "berty.tech/go-ipfs-log/test"
 
-import "berty.tech/go-ipfs-log/entry"
+import (
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/iface"
+)
 
-func lastEntry(entries []*entry.Entry) *entry.Entry {
+func lastEntry(entries []iface.IPFSLogEntry) iface.IPFSLogEntry {
 	length := len(entries)
 	if length > 0 {
 		return entries[len(entries)-1]
@@ -14,13 +17,13 @@ func lastEntry(entries []*entry.Entry) *entry.Entry {
 func entriesAsStrings(values *entry.OrderedMap) []string {
 	var foundEntries []string
 	for _, k := range values.Keys() {
-		foundEntries = append(foundEntries, string(values.UnsafeGet(k).Payload))
+		foundEntries = append(foundEntries, string(values.UnsafeGet(k).GetPayload()))
 	}
 
 	return foundEntries
 }
 
-func getLastEntry(omap *entry.OrderedMap) *entry.Entry {
+func getLastEntry(omap *entry.OrderedMap) iface.IPFSLogEntry {
 	lastKey := omap.Keys()[len(omap.Keys())-1]
 
 	return omap.UnsafeGet(lastKey)
@@ -0,0 +1,100 @@
+package hlc // import "berty.tech/go-ipfs-log/utils/hlc"
+
+import (
+	"sync"
+	"time"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+// Type is the name recorded in entries carrying a hybrid logical clock
+const Type = "hlc"
+
+// Timestamp is a hybrid logical clock value, Wall is a Unix time in
+// milliseconds and Logical orders events sharing the same wall time
+type Timestamp struct {
+	Wall    int64 `json:"wall"`
+	Logical int   `json:"logical"`
+}
+
+// Time returns the wall time of the timestamp
+func (t *Timestamp) Time() time.Time {
+	return time.Unix(0, t.Wall*int64(time.Millisecond))
+}
+
+// Compare returns a negative value if a happened before b, a positive one
+// if it happened after and 0 if both are equal
+func Compare(a, b *Timestamp) int {
+	switch {
+	case a.Wall < b.Wall:
+		return -1
+	case a.Wall > b.Wall:
+		return 1
+	}
+
+	return a.Logical - b.Logical
+}
+
+// Clock produces timestamps that are always greater than the ones it
+// produced or observed before
+type Clock struct {
+	mu   sync.Mutex
+	last Timestamp
+	now  func() time.Time
+}
+
+// New creates a clock, time.Now is used when now is nil
+func New(now func() time.Time) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Clock{now: now}
+}
+
+func (c *Clock) ClockType() string {
+	return Type
+}
+
+func (c *Clock) wall() int64 {
+	return c.now().UnixNano() / int64(time.Millisecond)
+}
+
+// Now returns a timestamp for a local event
+func (c *Clock) Now() *Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if wall := c.wall(); wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall}
+	} else {
+		c.last.Logical++
+	}
+
+	return &Timestamp{Wall: c.last.Wall, Logical: c.last.Logical}
+}
+
+// Update merges a timestamp received from another writer
+func (c *Clock) Update(t *Timestamp) {
+	if t == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if Compare(t, &c.last) > 0 {
+		c.last = *t
+	}
+}
+
+var AtlasTimestamp = atlas.BuildEntry(Timestamp{}).
+	StructMap().
+	AddField("Wall", atlas.StructMapEntry{SerialName: "wall"}).
+	AddField("Logical", atlas.StructMapEntry{SerialName: "logical"}).
+	Complete()
+
+func init() {
+	cbornode.RegisterCborType(AtlasTimestamp)
+}
@@ -93,3 +93,10 @@ var AtlasLamportClock = atlas.BuildEntry(CborLamportClock{}).
 func init() {
 	cbornode.RegisterCborType(AtlasLamportClock)
 }
+
+// Type is the name recorded in entries carrying a Lamport clock only
+const Type = "lamport"
+
+func (l *LamportClock) ClockType() string {
+	return Type
+}
@@ -0,0 +1,189 @@
+package orderedmap // import "berty.tech/go-ipfs-log/utils/orderedmap"
+
+import (
+	"sync"
+)
+
+// OrderedMap is a map keeping the insertion order of its keys, it is safe
+// for concurrent use
+type OrderedMap[K comparable, V any] struct {
+	mu     sync.RWMutex
+	keys   []K
+	values map[K]V
+}
+
+func New[K comparable, V any]() *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{
+		values: map[K]V{},
+	}
+}
+
+// NewWithCapacity returns a map with room for size keys, avoiding the
+// growth of the map while it is filled
+func NewWithCapacity[K comparable, V any](size int) *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{
+		keys:   make([]K, 0, size),
+		values: make(map[K]V, size),
+	}
+}
+
+// Get returns the value for the given key
+func (o *OrderedMap[K, V]) Get(key K) (V, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	v, ok := o.values[key]
+
+	return v, ok
+}
+
+// Has returns true if the key is set
+func (o *OrderedMap[K, V]) Has(key K) bool {
+	_, ok := o.Get(key)
+
+	return ok
+}
+
+// Set sets the value for the given key, keeping its position if it is
+// already set
+func (o *OrderedMap[K, V]) Set(key K, value V) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+
+	o.values[key] = value
+}
+
+// Delete removes the given key
+func (o *OrderedMap[K, V]) Delete(key K) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+
+	delete(o.values, key)
+
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (o *OrderedMap[K, V]) Len() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return len(o.keys)
+}
+
+// Keys returns a copy of the keys in order
+func (o *OrderedMap[K, V]) Keys() []K {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	out := make([]K, len(o.keys))
+	copy(out, o.keys)
+
+	return out
+}
+
+// Values returns the values in order
+func (o *OrderedMap[K, V]) Values() []V {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	out := make([]V, 0, len(o.keys))
+	for _, k := range o.keys {
+		out = append(out, o.values[k])
+	}
+
+	return out
+}
+
+// At returns the key and value at the given position
+func (o *OrderedMap[K, V]) At(index int) (K, V, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if index < 0 || index >= len(o.keys) {
+		var k K
+		var v V
+		return k, v, false
+	}
+
+	k := o.keys[index]
+
+	return k, o.values[k], true
+}
+
+// Range calls f for each key and value in order until f returns false, it
+// iterates over a snapshot so the map can be modified by f
+func (o *OrderedMap[K, V]) Range(f func(key K, value V) bool) {
+	o.mu.RLock()
+	keys := make([]K, len(o.keys))
+	values := make([]V, len(o.keys))
+	for i, k := range o.keys {
+		keys[i] = k
+		values[i] = o.values[k]
+	}
+	o.mu.RUnlock()
+
+	for i := range keys {
+		if !f(keys[i], values[i]) {
+			return
+		}
+	}
+}
+
+// Copy returns a shallow copy of the map
+func (o *OrderedMap[K, V]) Copy() *OrderedMap[K, V] {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	c := &OrderedMap[K, V]{
+		keys:   make([]K, len(o.keys)),
+		values: make(map[K]V, len(o.values)),
+	}
+
+	copy(c.keys, o.keys)
+	for k, v := range o.values {
+		c.values[k] = v
+	}
+
+	return c
+}
+
+// SortKeys reorders the map using the keys sorted by sortFunc, keys that
+// aren't set are ignored
+func (o *OrderedMap[K, V]) SortKeys(sortFunc func(keys []K)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	keys := make([]K, len(o.keys))
+	copy(keys, o.keys)
+	sortFunc(keys)
+
+	ordered := make([]K, 0, len(keys))
+	seen := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := o.values[k]; !ok {
+			continue
+		}
+
+		if _, ok := seen[k]; ok {
+			continue
+		}
+
+		seen[k] = struct{}{}
+		ordered = append(ordered, k)
+	}
+
+	o.keys = ordered
+}
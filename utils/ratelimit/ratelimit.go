@@ -0,0 +1,91 @@
+package ratelimit // import "berty.tech/go-ipfs-log/utils/ratelimit"
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket refilled with rate tokens per second up to
+// burst tokens, a nil limiter never waits
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing rate tokens per second and bursts of burst
+// tokens, the burst is one second of tokens when 0
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+
+	return &Limiter{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+// Wait waits for a single token
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN takes n tokens, waiting until they are available. Taking more
+// tokens than the burst is allowed, the following calls wait for them to
+// be refilled.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// Requests larger than the burst only wait for a full bucket and leave
+	// it in debt
+	need := float64(n)
+	if need > l.burst {
+		need = l.burst
+	}
+
+	wait := time.Duration(0)
+	if l.tokens < need {
+		wait = time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens -= float64(n)
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
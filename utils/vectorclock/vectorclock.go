@@ -0,0 +1,92 @@
+package vectorclock // import "berty.tech/go-ipfs-log/utils/vectorclock"
+
+import (
+	"encoding/hex"
+)
+
+// Type is the name recorded in entries carrying a vector clock
+const Type = "vector"
+
+// Relation is the causal relation between two vector clocks
+type Relation int
+
+const (
+	Equal Relation = iota
+	Before
+	After
+	Concurrent
+)
+
+// VectorClock tracks the time of each writer, keyed by the hex encoded
+// writer ID
+type VectorClock map[string]int
+
+func New() VectorClock {
+	return VectorClock{}
+}
+
+func (v VectorClock) ClockType() string {
+	return Type
+}
+
+// Get returns the time of a writer
+func (v VectorClock) Get(id []byte) int {
+	return v[hex.EncodeToString(id)]
+}
+
+// Tick increments the time of a writer
+func (v VectorClock) Tick(id []byte) VectorClock {
+	v[hex.EncodeToString(id)]++
+
+	return v
+}
+
+// Merge sets each writer time to the maximum of both clocks
+func (v VectorClock) Merge(clock VectorClock) VectorClock {
+	for id, t := range clock {
+		if t > v[id] {
+			v[id] = t
+		}
+	}
+
+	return v
+}
+
+func (v VectorClock) Clone() VectorClock {
+	c := make(VectorClock, len(v))
+	for id, t := range v {
+		c[id] = t
+	}
+
+	return c
+}
+
+// Compare returns the causal relation of a to b
+func Compare(a, b VectorClock) Relation {
+	before, after := false, false
+
+	for id, t := range a {
+		if t > b[id] {
+			after = true
+		} else if t < b[id] {
+			before = true
+		}
+	}
+
+	for id, t := range b {
+		if _, ok := a[id]; !ok && t > 0 {
+			before = true
+		}
+	}
+
+	switch {
+	case before && after:
+		return Concurrent
+	case before:
+		return Before
+	case after:
+		return After
+	}
+
+	return Equal
+}